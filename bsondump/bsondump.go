@@ -22,6 +22,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
+	"github.com/mongodb/mongo-tools/mongoexport"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -38,6 +39,23 @@ type BSONDump struct {
 	Out io.WriteCloser
 
 	BSONSource *db.BSONSource
+
+	// query from --filter, parsed on first use
+	filter *filter
+
+	// fields kept in JSON output with --fields
+	projection projection
+
+	// reads BSONSource with --objcheck-recover
+	recovering *recoveringSource
+	// ranges skipped in the sources read before BSONSource
+	skippedBefore int
+
+	// the documents selected by --skipDocs and --limitDocs
+	sliced *slicedSource
+
+	// structural violations found with --validate
+	violations int
 }
 
 type ReadNopCloser struct {
@@ -53,8 +71,12 @@ type WriteNopCloser struct {
 func (WriteNopCloser) Close() error { return nil }
 
 // GetWriter opens and returns an io.WriteCloser for the OutFileName in BSONDumpOptions
-// or nil if none is set. The caller is responsible for closing it.
+// or nil if none is set. With --splitDocs or --splitSize, it writes to numbered
+// files named after OutFileName instead. The caller is responsible for closing it.
 func (bdo *BSONDumpOptions) GetWriter() (io.WriteCloser, error) {
+	if bdo.SplitDocs > 0 || bdo.splitBytes > 0 {
+		return newSplitWriter(bdo.OutFileName, bdo.SplitDocs, bdo.splitBytes), nil
+	}
 	if bdo.OutFileName != "" {
 		file, err := os.Create(util.ToUniversalPath(bdo.OutFileName))
 		if err != nil {
@@ -66,27 +88,56 @@ func (bdo *BSONDumpOptions) GetWriter() (io.WriteCloser, error) {
 	return WriteNopCloser{os.Stdout}, nil
 }
 
-// GetBSONReader opens and returns an io.ReadCloser for the BSONFileName in BSONDumpOptions
-// or nil if none is set. The caller is responsible for closing it.
+// GetBSONReader opens and returns an io.ReadCloser for the BSONFileName in BSONDumpOptions,
+// or for stdin if none is set or it is "-". Input compressed with gzip or zstd
+// is decompressed. The caller is responsible for closing it.
 func (bdo *BSONDumpOptions) GetBSONReader() (io.ReadCloser, error) {
-	if bdo.BSONFileName != "" {
+	var in io.ReadCloser = ReadNopCloser{os.Stdin}
+	if bdo.BSONFileName != "" && bdo.BSONFileName != "-" {
 		file, err := os.Open(util.ToUniversalPath(bdo.BSONFileName))
 		if err != nil {
 			return nil, fmt.Errorf("couldn't open BSON file: %v", err)
 		}
-		return file, nil
+		in = file
+	}
+	reader, err := decompress(in)
+	if err != nil {
+		in.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// ValidateJSONFormat checks --jsonFormat, which selects the extended JSON
+// dialect of JSON output.
+func (bdo *BSONDumpOptions) ValidateJSONFormat() error {
+	bdo.JSONFormat = strings.ToLower(bdo.JSONFormat)
+	switch bdo.JSONFormat {
+	case "", mongoexport.JSONFormatLegacy:
+	case bsonutil.ExtJSONCanonical, bsonutil.ExtJSONRelaxed:
+		if bdo.Type != "" && bdo.Type != "json" {
+			return fmt.Errorf("--jsonFormat can only be used with --type=json")
+		}
+	default:
+		return fmt.Errorf("invalid --jsonFormat '%v', choose 'canonical', 'relaxed' or 'legacy'", bdo.JSONFormat)
 	}
-	return ReadNopCloser{os.Stdin}, nil
+	return nil
 }
 
-func formatJSON(doc *bson.Raw, pretty bool) ([]byte, error) {
+func formatJSON(doc *bson.Raw, pretty bool, format string) ([]byte, error) {
 	decodedDoc := bson.D{}
 	err := bson.Unmarshal(doc.Data, &decodedDoc)
 	if err != nil {
 		return nil, err
 	}
 
-	extendedDoc, err := bsonutil.ConvertBSONValueToJSON(decodedDoc)
+	var extendedDoc interface{}
+	switch format {
+	case bsonutil.ExtJSONCanonical, bsonutil.ExtJSONRelaxed:
+		extendedDoc, err = bsonutil.ConvertBSONValueToExtJSONv2(decodedDoc, format == bsonutil.ExtJSONCanonical)
+	default:
+		extendedDoc, err = bsonutil.ConvertBSONValueToJSON(decodedDoc)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error converting BSON to extended JSON: %v", err)
 	}
@@ -102,43 +153,121 @@ func formatJSON(doc *bson.Raw, pretty bool) ([]byte, error) {
 	return jsonBytes, nil
 }
 
+// source returns the source of the documents to dump: BSONSource or, with
+// --objcheck-recover, the valid documents that can be salvaged from it, from
+// --skipDocs on and up to --limitDocs of them.
+func (bd *BSONDump) source() db.RawDocSource {
+	if bd.sliced != nil {
+		return bd.sliced
+	}
+	var source db.RawDocSource = bd.BSONSource
+	if bd.BSONDumpOptions.ObjCheckRecover {
+		bd.recovering = newRecoveringSource(bd.BSONSource.Stream)
+		source = bd.recovering
+	}
+	bd.sliced = &slicedSource{
+		RawDocSource: source,
+		skip:         bd.BSONDumpOptions.SkipDocs,
+		limit:        bd.BSONDumpOptions.LimitDocs,
+	}
+	return bd.sliced
+}
+
+// nextSource moves on to reading another BSON file.
+func (bd *BSONDump) nextSource(source *db.BSONSource) {
+	if bd.recovering != nil {
+		bd.skippedBefore += len(bd.recovering.skipped)
+	}
+	bd.BSONSource, bd.recovering, bd.sliced = source, nil, nil
+}
+
+// SkippedRanges returns the number of ranges of corrupt bytes that
+// --objcheck-recover skipped.
+func (bd *BSONDump) SkippedRanges() int {
+	if bd.recovering == nil {
+		return bd.skippedBefore
+	}
+	return bd.skippedBefore + len(bd.recovering.skipped)
+}
+
+// initFilter parses the query given with --filter, if any.
+func (bd *BSONDump) initFilter() error {
+	if bd.BSONDumpOptions.Filter == "" || bd.filter != nil {
+		return nil
+	}
+	var err error
+	bd.filter, err = newFilter(bd.BSONDumpOptions.Filter)
+	return err
+}
+
+// matches returns true if a document matches the query given with --filter,
+// or if there is none.
+func (bd *BSONDump) matches(data []byte) (bool, error) {
+	if bd.filter == nil {
+		return true, nil
+	}
+	return bd.filter.Matches(data)
+}
+
 // JSON iterates through the BSON file and for each document it finds,
 // recursively descends into objects and arrays and prints the human readable
 // JSON representation.
 // It returns the number of documents processed and a non-nil error if one is
-// encountered before the end of the file is reached.
+// encountered before the end of the file is reached. With --filter, only the
+// documents matching it are processed. Documents are converted on
+// NumDecodingWorkers goroutines and written in the order they were read.
+// With --fields, only the given fields of each document are written.
 func (bd *BSONDump) JSON() (int, error) {
 	numFound := 0
 
 	if bd.BSONSource == nil {
 		panic("Tried to call JSON() before opening file")
 	}
+	if err := bd.initFilter(); err != nil {
+		return 0, err
+	}
+	if bd.BSONDumpOptions.Fields != "" {
+		bd.projection = newProjection(bd.BSONDumpOptions.fieldList())
+	}
 
-	decodedStream := db.NewDecodedBSONSource(bd.BSONSource)
+	source := bd.source()
+	done := make(chan struct{})
+	defer close(done)
 
-	var result bson.Raw
-	for decodedStream.Next(&result) {
-		if bytes, err := formatJSON(&result, bd.BSONDumpOptions.Pretty); err != nil {
-			log.Logvf(log.Always, "unable to dump document %v: %v", numFound+1, err)
+	for batch := range bd.convertParallel(source, done) {
+		<-batch.ready
+		for _, result := range batch.results {
+			if result.matchErr != nil {
+				log.Logvf(log.Always, "unable to match document against --filter: %v", result.matchErr)
+				if bd.BSONDumpOptions.ObjCheck {
+					return numFound, result.matchErr
+				}
+				continue
+			}
+			if result.skip {
+				continue
+			}
+			if err := result.formatErr; err != nil {
+				log.Logvf(log.Always, "unable to dump document %v: %v", numFound+1, err)
 
-			//if objcheck is turned on, stop now. otherwise keep on dumpin'
-			if bd.BSONDumpOptions.ObjCheck {
-				return numFound, err
+				//if objcheck is turned on, stop now. otherwise keep on dumpin'
+				if bd.BSONDumpOptions.ObjCheck {
+					return numFound, err
+				}
+			} else {
+				bytes := append(result.json, '\n')
+				_, err := bd.Out.Write(bytes)
+				if err != nil {
+					return numFound, err
+				}
 			}
-		} else {
-			bytes = append(bytes, '\n')
-			_, err := bd.Out.Write(bytes)
-			if err != nil {
-				return numFound, err
+			numFound++
+			if failpoint.Enabled(failpoint.SlowBSONDump) {
+				time.Sleep(2 * time.Second)
 			}
 		}
-		numFound++
-		if failpoint.Enabled(failpoint.SlowBSONDump) {
-			time.Sleep(2 * time.Second)
-		}
-
 	}
-	if err := decodedStream.Err(); err != nil {
+	if err := source.Err(); err != nil {
 		return numFound, err
 	}
 	return numFound, nil
@@ -155,10 +284,14 @@ func (bd *BSONDump) Debug() (int, error) {
 	if bd.BSONSource == nil {
 		panic("Tried to call Debug() before opening file")
 	}
+	if err := bd.initFilter(); err != nil {
+		return 0, err
+	}
 
+	source := bd.source()
 	var result bson.Raw
 	for {
-		doc := bd.BSONSource.LoadNext()
+		doc := source.LoadNext()
 		if doc == nil {
 			break
 		}
@@ -172,14 +305,22 @@ func (bd *BSONDump) Debug() (int, error) {
 				return numFound, fmt.Errorf("failed to validate bson during objcheck: %v", err)
 			}
 		}
-		err := printBSON(result, 0, bd.Out)
+		matched, err := bd.matches(result.Data)
+		if err != nil {
+			log.Logvf(log.Always, "unable to match document against --filter: %v", err)
+			continue
+		}
+		if !matched {
+			continue
+		}
+		err = printBSON(result, 0, bd.Out)
 		if err != nil {
 			log.Logvf(log.Always, "encountered error debugging BSON data: %v", err)
 		}
 		numFound++
 	}
 
-	if err := bd.BSONSource.Err(); err != nil {
+	if err := source.Err(); err != nil {
 		// This error indicates the BSON document header is corrupted;
 		// either the 4-byte header couldn't be read in full, or
 		// the size in the header would require reading more bytes
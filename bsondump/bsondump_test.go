@@ -123,6 +123,19 @@ func TestBsondump(t *testing.T) {
 		So(bufDumpStr, ShouldEqual, bufRefStr)
 	})
 
+	Convey("Test bsondump only writing documents matching --filter", t, func() {
+		cmd := exec.Command("../bin/bsondump", "--filter", `{"a": {"$gte": 4}, "b": {"$ne": "string3"}}`,
+			"testdata/sample.bson")
+
+		// Attach a buffer to stdout of command.
+		cmdOutput := &bytes.Buffer{}
+		cmd.Stdout = cmdOutput
+
+		err := cmd.Run()
+		So(err, ShouldBeNil)
+		So(cmdOutput.String(), ShouldEqual, `{"_id":{"$oid":"546652084bf6e4cb017c5314"},"a":4.0,"b":"string2"}`+"\n")
+	})
+
 	Convey("Test bsondump reading from a file with --bsonFile and writing to a file", t, func() {
 		cmd := exec.Command("../bin/bsondump", "--outFile", "out.json",
 			"--bsonFile", "testdata/sample.bson")
@@ -0,0 +1,125 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/mongoexport"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Output types that write one row per document.
+const (
+	CSV = "csv"
+	TSV = "tsv"
+)
+
+// ValidateCSVOptions checks the options that only apply to CSV and TSV
+// output.
+func (bdo *BSONDumpOptions) ValidateCSVOptions() error {
+	tabular := bdo.Type == CSV || bdo.Type == TSV
+	projecting := tabular || bdo.Type == "" || bdo.Type == "json"
+	switch {
+	case tabular && bdo.Fields == "":
+		return fmt.Errorf("--fields is required with --type=%v", bdo.Type)
+	case !projecting && bdo.Fields != "":
+		return fmt.Errorf("--fields can only be used with --type=json, --type=csv or --type=tsv")
+	case !tabular && (bdo.NoHeaderLine || bdo.Flatten):
+		return fmt.Errorf("--noHeaderLine and --flatten can only be used with --type=csv or --type=tsv")
+	}
+	bdo.FlattenArrays = strings.ToLower(bdo.FlattenArrays)
+	if bdo.FlattenArrays != mongoexport.FlattenArraysIndex && bdo.FlattenArrays != mongoexport.FlattenArraysJSON {
+		return fmt.Errorf("invalid --flattenArrays mode '%v', choose 'index' or 'json'", bdo.FlattenArrays)
+	}
+	if bdo.FlattenDepth < 0 {
+		return fmt.Errorf("--flattenDepth cannot be negative")
+	}
+	return nil
+}
+
+// csvOutput returns the writer of CSV or TSV rows, laid out as mongoexport
+// lays them out.
+func (bd *BSONDump) csvOutput() *mongoexport.CSVExportOutput {
+	opts := bd.BSONDumpOptions
+	output := mongoexport.NewCSVExportOutput(opts.fieldList(), opts.NoHeaderLine, bd.Out)
+	if opts.Type == TSV {
+		output.SetDelimiter('\t')
+	}
+	if opts.Flatten {
+		output.Flatten = &mongoexport.CSVFlattenOptions{
+			FlattenOptions: bsonutil.FlattenOptions{
+				ExpandArrays: opts.FlattenArrays == mongoexport.FlattenArraysIndex,
+				MaxDepth:     opts.FlattenDepth,
+			},
+			Separator: opts.FlattenSeparator,
+		}
+	}
+	return output
+}
+
+// CSV iterates through the BSON file and writes the fields given with
+// --fields of each document it finds as a row of CSV, or TSV with
+// --type=tsv. Nested fields are extracted and flattened by the same rules
+// as mongoexport's.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) CSV() (int, error) {
+	numFound := 0
+
+	if bd.BSONSource == nil {
+		panic("Tried to call CSV() before opening file")
+	}
+	if err := bd.initFilter(); err != nil {
+		return 0, err
+	}
+
+	output := bd.csvOutput()
+	if err := output.WriteHeader(); err != nil {
+		return 0, err
+	}
+	source := bd.source()
+	for {
+		data := source.LoadNext()
+		if data == nil {
+			break
+		}
+		matched, err := bd.matches(data)
+		if err != nil {
+			log.Logvf(log.Always, "unable to match document against --filter: %v", err)
+			if bd.BSONDumpOptions.ObjCheck {
+				return numFound, err
+			}
+			continue
+		}
+		if !matched {
+			continue
+		}
+		doc := bson.D{}
+		if err = bson.Unmarshal(data, &doc); err == nil {
+			err = output.ExportDocument(doc)
+		}
+		if err != nil {
+			log.Logvf(log.Always, "unable to dump document %v: %v", numFound+1, err)
+			if bd.BSONDumpOptions.ObjCheck {
+				return numFound, err
+			}
+		}
+		numFound++
+	}
+	if err := source.Err(); err != nil {
+		output.Flush()
+		return numFound, err
+	}
+	if err := output.WriteFooter(); err != nil {
+		return numFound, err
+	}
+	return numFound, output.Flush()
+}
@@ -0,0 +1,79 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestCSV(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a stream of documents", t, func() {
+		input := &bytes.Buffer{}
+		for _, doc := range []bson.D{
+			{{"name", "ada"}, {"address", bson.D{{"city", "London"}, {"zip", "N1"}}}},
+			{{"name", "grace, hopper"}, {"address", bson.D{{"city", "New York"}}}},
+		} {
+			data, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			input.Write(data)
+		}
+		out := &bytes.Buffer{}
+		opts := &BSONDumpOptions{
+			Type:             CSV,
+			Fields:           "name,address.city",
+			FlattenArrays:    "json",
+			FlattenSeparator: ".",
+		}
+		bd := BSONDump{
+			ToolOptions:     &options.ToolOptions{},
+			BSONDumpOptions: opts,
+			Out:             WriteNopCloser{out},
+			BSONSource:      db.NewBSONSource(ioutil.NopCloser(input)),
+		}
+
+		Convey("--type=csv should write the given fields", func() {
+			So(opts.ValidateCSVOptions(), ShouldBeNil)
+			numFound, err := bd.CSV()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 2)
+			So(out.String(), ShouldEqual, "name,address.city\nada,London\n\"grace, hopper\",New York\n")
+		})
+
+		Convey("--type=tsv with --flatten should expand nested documents", func() {
+			opts.Type = TSV
+			opts.Fields = "address"
+			opts.Flatten = true
+			opts.FlattenSeparator = "_"
+			So(opts.ValidateCSVOptions(), ShouldBeNil)
+			numFound, err := bd.CSV()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 2)
+			So(out.String(), ShouldEqual, "address_city\taddress_zip\nLondon\tN1\nNew York\t\n")
+		})
+
+		Convey("--fields should be required with csv and only allowed with json, csv and tsv", func() {
+			opts.Fields = ""
+			So(opts.ValidateCSVOptions(), ShouldNotBeNil)
+			opts.Type = "json"
+			So(opts.ValidateCSVOptions(), ShouldBeNil)
+			opts.Fields = "name"
+			So(opts.ValidateCSVOptions(), ShouldBeNil)
+			opts.Type = Stats
+			So(opts.ValidateCSVOptions(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,255 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DiffSummary counts the documents compared by Diff.
+type DiffSummary struct {
+	Added     int
+	Removed   int
+	Changed   int
+	Unchanged int
+}
+
+// Differ returns true if the files compared have any different documents.
+func (s DiffSummary) Differ() bool {
+	return s.Added > 0 || s.Removed > 0 || s.Changed > 0
+}
+
+func (s DiffSummary) String() string {
+	return fmt.Sprintf("%v added, %v removed, %v changed, %v unchanged", s.Added, s.Removed, s.Changed, s.Unchanged)
+}
+
+// ValidateDiffOptions checks the options that apply to --diff.
+func (bdo *BSONDumpOptions) ValidateDiffOptions() error {
+	if !bdo.Diff {
+		return nil
+	}
+	switch {
+	case bdo.Type != "" && bdo.Type != "json":
+		return fmt.Errorf("--diff cannot be used with --type")
+	case bdo.Fields != "" || bdo.SplitDocs != 0 || bdo.SplitSize != "":
+		return fmt.Errorf("--diff cannot be used with --fields, --splitDocs or --splitSize")
+	case bdo.SkipDocs != 0 || bdo.LimitDocs != 0:
+		return fmt.Errorf("--diff cannot be used with --skipDocs or --limitDocs")
+	case bdo.DiffKey == "":
+		return fmt.Errorf("--diffKey cannot be empty")
+	}
+	return nil
+}
+
+// diffKey returns the value of the --diffKey field of a document as a map
+// key, along with the value itself, or false if the document has no such
+// field.
+func (bd *BSONDump) diffKey(data []byte) (string, bson.Raw, bool, error) {
+	value := bson.Raw{Kind: 0x03, Data: data}
+	for _, name := range strings.Split(bd.BSONDumpOptions.DiffKey, ".") {
+		if value.Kind != 0x03 {
+			return "", value, false, nil
+		}
+		var elems bson.RawD
+		if err := bson.Unmarshal(value.Data, &elems); err != nil {
+			return "", value, false, err
+		}
+		found := false
+		for _, elem := range elems {
+			if elem.Name == name {
+				value, found = elem.Value, true
+				break
+			}
+		}
+		if !found {
+			return "", value, false, nil
+		}
+	}
+	return string(value.Kind) + string(value.Data), value, true, nil
+}
+
+// valueJSON returns a BSON value as extended JSON.
+func valueJSON(value bson.Raw) string {
+	var decoded interface{}
+	var err error
+	if value.Kind == 0x03 {
+		doc := bson.D{}
+		err = value.Unmarshal(&doc)
+		decoded = doc
+	} else {
+		err = value.Unmarshal(&decoded)
+	}
+	if err == nil {
+		decoded, err = bsonutil.ConvertBSONValueToJSON(decoded)
+	}
+	var out []byte
+	if err == nil {
+		out, err = json.Marshal(decoded)
+	}
+	if err != nil {
+		return fmt.Sprintf("<invalid value: %v>", err)
+	}
+	return string(out)
+}
+
+// diffFields writes a line for each field that differs between two
+// documents, or arrays, descending into the ones found in both.
+func diffFields(out *bytes.Buffer, prefix string, a, b []byte) error {
+	var aElems, bElems bson.RawD
+	if err := bson.Unmarshal(a, &aElems); err != nil {
+		return err
+	}
+	if err := bson.Unmarshal(b, &bElems); err != nil {
+		return err
+	}
+	inB := make(map[string]bson.Raw, len(bElems))
+	for _, elem := range bElems {
+		inB[elem.Name] = elem.Value
+	}
+	inA := make(map[string]bool, len(aElems))
+	for _, elem := range aElems {
+		inA[elem.Name] = true
+		path := prefix + elem.Name
+		other, ok := inB[elem.Name]
+		switch {
+		case !ok:
+			fmt.Fprintf(out, "\tremoved %v: %v\n", path, valueJSON(elem.Value))
+		case elem.Value.Kind == other.Kind && bytes.Equal(elem.Value.Data, other.Data):
+		case elem.Value.Kind == other.Kind && (other.Kind == 0x03 || other.Kind == 0x04):
+			if err := diffFields(out, path+".", elem.Value.Data, other.Data); err != nil {
+				return err
+			}
+		default:
+			fmt.Fprintf(out, "\tchanged %v: %v -> %v\n", path, valueJSON(elem.Value), valueJSON(other))
+		}
+	}
+	for _, elem := range bElems {
+		if !inA[elem.Name] {
+			fmt.Fprintf(out, "\tadded %v: %v\n", prefix+elem.Name, valueJSON(elem.Value))
+		}
+	}
+	return nil
+}
+
+// Diff compares the documents of BSONSource with the documents of other,
+// matching them by the --diffKey field, and writes the documents only in
+// other as added, the ones only in BSONSource as removed, and the fields that
+// differ between the ones in both as changed. Documents that differ only in
+// the order of their fields are changed. With --filter, only the documents
+// matching it are compared. The documents of BSONSource are held in memory.
+func (bd *BSONDump) Diff(other *db.BSONSource) (DiffSummary, error) {
+	var summary DiffSummary
+
+	if bd.BSONSource == nil || other == nil {
+		panic("Tried to call Diff() before opening files")
+	}
+	if err := bd.initFilter(); err != nil {
+		return summary, err
+	}
+
+	// load reads the documents of a file that match --filter and have a key
+	load := func(source db.RawDocSource, name string, each func(key string, keyValue bson.Raw, data []byte) error) error {
+		for i := 1; ; i++ {
+			data := source.LoadNext()
+			if data == nil {
+				return source.Err()
+			}
+			matched, err := bd.matches(data)
+			if err != nil {
+				return fmt.Errorf("unable to match document %v of the %v file against --filter: %v", i, name, err)
+			}
+			if !matched {
+				continue
+			}
+			key, keyValue, ok, err := bd.diffKey(data)
+			if err != nil {
+				return fmt.Errorf("unable to read document %v of the %v file: %v", i, name, err)
+			}
+			if !ok {
+				log.Logvf(log.Always, "skipping document %v of the %v file, which has no %v field", i, name, bd.BSONDumpOptions.DiffKey)
+				continue
+			}
+			if err = each(key, keyValue, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the keys of the first file in the order they were read
+	var order []string
+	before := map[string][]byte{}
+	err := load(bd.source(), "first", func(key string, _ bson.Raw, data []byte) error {
+		if _, ok := before[key]; ok {
+			log.Logvf(log.Always, "skipping document with duplicate %v in the first file: %v", bd.BSONDumpOptions.DiffKey, valueJSON(bson.Raw{Kind: 0x03, Data: data}))
+			return nil
+		}
+		order = append(order, key)
+		// sources reuse their buffer for the next document
+		before[key] = append([]byte{}, data...)
+		return nil
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	seen := map[string]bool{}
+	label := func(keyValue bson.Raw) string {
+		return fmt.Sprintf("%v %v", bd.BSONDumpOptions.DiffKey, valueJSON(keyValue))
+	}
+	err = load(other, "second", func(key string, keyValue bson.Raw, data []byte) error {
+		if seen[key] {
+			log.Logvf(log.Always, "skipping document with duplicate %v in the second file: %v", bd.BSONDumpOptions.DiffKey, valueJSON(bson.Raw{Kind: 0x03, Data: data}))
+			return nil
+		}
+		seen[key] = true
+		old, ok := before[key]
+		out := &bytes.Buffer{}
+		switch {
+		case !ok:
+			summary.Added++
+			fmt.Fprintf(out, "added %v: %v\n", label(keyValue), valueJSON(bson.Raw{Kind: 0x03, Data: data}))
+		case bytes.Equal(old, data):
+			summary.Unchanged++
+		default:
+			summary.Changed++
+			fmt.Fprintf(out, "changed %v:\n", label(keyValue))
+			header := out.Len()
+			if err := diffFields(out, "", old, data); err != nil {
+				return err
+			}
+			if out.Len() == header {
+				out.WriteString("\tfield order changed\n")
+			}
+		}
+		_, err := bd.Out.Write(out.Bytes())
+		return err
+	})
+	if err != nil {
+		return summary, err
+	}
+
+	for _, key := range order {
+		if seen[key] {
+			continue
+		}
+		summary.Removed++
+		data := before[key]
+		_, keyValue, _, _ := bd.diffKey(data)
+		if _, err = fmt.Fprintf(bd.Out, "removed %v: %v\n", label(keyValue), valueJSON(bson.Raw{Kind: 0x03, Data: data})); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
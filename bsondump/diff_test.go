@@ -0,0 +1,90 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func bsonStream(docs ...bson.D) *db.BSONSource {
+	input := &bytes.Buffer{}
+	for _, doc := range docs {
+		data, err := bson.Marshal(doc)
+		So(err, ShouldBeNil)
+		input.Write(data)
+	}
+	return db.NewBSONSource(ioutil.NopCloser(input))
+}
+
+func TestDiff(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With two BSON files", t, func() {
+		out := &bytes.Buffer{}
+		opts := &BSONDumpOptions{Diff: true, DiffKey: "_id"}
+		bd := BSONDump{
+			ToolOptions:     &options.ToolOptions{},
+			BSONDumpOptions: opts,
+			Out:             WriteNopCloser{out},
+			BSONSource: bsonStream(
+				bson.D{{"_id", 1}, {"a", 1}},
+				bson.D{{"_id", 2}, {"a", 1}, {"b", bson.D{{"c", true}, {"d", "x"}}}, {"tags", []string{"p", "q"}}},
+				bson.D{{"_id", 3}, {"a", 1}},
+				bson.D{{"_id", 4}, {"a", 1}, {"b", 2}},
+			),
+		}
+		other := bsonStream(
+			bson.D{{"_id", 3}, {"a", 1}},
+			bson.D{{"_id", 2}, {"a", int64(1)}, {"b", bson.D{{"c", false}, {"e", 5}}}, {"tags", []string{"p", "r"}}},
+			bson.D{{"_id", 5}, {"a", 2}},
+			bson.D{{"_id", 4}, {"b", 2}, {"a", 1}},
+		)
+
+		Convey("added, removed and changed documents should be written with their changed fields", func() {
+			summary, err := bd.Diff(other)
+			So(err, ShouldBeNil)
+			So(summary, ShouldResemble, DiffSummary{Added: 1, Removed: 1, Changed: 2, Unchanged: 1})
+			So(summary.Differ(), ShouldBeTrue)
+			So(out.String(), ShouldEqual, ""+
+				"changed _id 2:\n"+
+				"\tchanged a: 1 -> {\"$numberLong\":\"1\"}\n"+
+				"\tchanged b.c: true -> false\n"+
+				"\tremoved b.d: \"x\"\n"+
+				"\tadded b.e: 5\n"+
+				"\tchanged tags.1: \"q\" -> \"r\"\n"+
+				"added _id 5: {\"_id\":5,\"a\":2}\n"+
+				"changed _id 4:\n"+
+				"\tfield order changed\n"+
+				"removed _id 1: {\"_id\":1,\"a\":1}\n")
+		})
+
+		Convey("--diffKey should match documents by another field", func() {
+			opts.DiffKey = "a"
+			bd.BSONSource = bsonStream(bson.D{{"_id", 1}, {"a", "k"}})
+			summary, err := bd.Diff(bsonStream(bson.D{{"_id", 2}, {"a", "k"}}, bson.D{{"_id", 3}}))
+			So(err, ShouldBeNil)
+			So(summary, ShouldResemble, DiffSummary{Changed: 1})
+			So(out.String(), ShouldEqual, "changed a \"k\":\n\tchanged _id: 1 -> 2\n")
+		})
+
+		Convey("identical files should not differ", func() {
+			bd.BSONSource = bsonStream(bson.D{{"_id", 1}})
+			summary, err := bd.Diff(bsonStream(bson.D{{"_id", 1}}))
+			So(err, ShouldBeNil)
+			So(summary.Differ(), ShouldBeFalse)
+			So(out.String(), ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,274 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+// IsDirectory returns true if the input is a directory, such as the output
+// of mongodump, rather than a single BSON file.
+func (bdo *BSONDumpOptions) IsDirectory() bool {
+	if bdo.BSONFileName == "" || bdo.BSONFileName == "-" {
+		return false
+	}
+	info, err := os.Stat(util.ToUniversalPath(bdo.BSONFileName))
+	return err == nil && info.IsDir()
+}
+
+// ValidateDirectoryOptions checks that a directory isn't given as the input
+// of modes that only read a single file.
+func (bdo *BSONDumpOptions) ValidateDirectoryOptions() error {
+	if !bdo.IsDirectory() {
+		return nil
+	}
+	switch {
+	case bdo.Type == Raw:
+		return fmt.Errorf("--type=raw cannot read a directory")
+	case bdo.Diff || bdo.Reverse:
+		return fmt.Errorf("--diff and --reverse cannot read a directory")
+	case bdo.SplitDocs != 0 || bdo.SplitSize != "":
+		return fmt.Errorf("--splitDocs and --splitSize cannot be used when reading a directory")
+	}
+	return nil
+}
+
+// suffixes of the files that mongodump writes for each collection, with and
+// without --gzip
+var (
+	bsonSuffixes     = []string{".bson", ".bson.gz"}
+	metadataSuffixes = []string{".metadata.json", ".metadata.json.gz"}
+)
+
+// dumpCollection is the files of one collection in a mongodump directory.
+// Either may be missing: views have no BSON file, and dumps made with
+// older versions or of the oplog have no metadata file.
+type dumpCollection struct {
+	Namespace    string
+	BSONPath     string
+	MetadataPath string
+}
+
+// dumpMetadata is the part of a .metadata.json file reported on.
+type dumpMetadata struct {
+	Options map[string]interface{} `json:"options"`
+	Indexes []interface{}          `json:"indexes"`
+}
+
+func trimSuffixes(name string, suffixes []string) (string, bool) {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), true
+		}
+	}
+	return name, false
+}
+
+// findDumpCollections returns the collections in a mongodump directory,
+// sorted by namespace. The directory holds either a directory per database,
+// as mongodump writes by default, or the files of a single database, as
+// with --db.
+func findDumpCollections(dir string) ([]*dumpCollection, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byNamespace := map[string]*dumpCollection{}
+	add := func(database, dbDir string, files []os.FileInfo) {
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			name, isBSON := trimSuffixes(file.Name(), bsonSuffixes)
+			isMetadata := false
+			if !isBSON {
+				name, isMetadata = trimSuffixes(file.Name(), metadataSuffixes)
+			}
+			if !isBSON && !isMetadata {
+				continue
+			}
+			namespace := name
+			if database != "" {
+				namespace = database + "." + name
+			}
+			collection, ok := byNamespace[namespace]
+			if !ok {
+				collection = &dumpCollection{Namespace: namespace}
+				byNamespace[namespace] = collection
+			}
+			if isBSON {
+				collection.BSONPath = filepath.Join(dbDir, file.Name())
+			} else {
+				collection.MetadataPath = filepath.Join(dbDir, file.Name())
+			}
+		}
+	}
+
+	hasDatabases := false
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		hasDatabases = true
+		dbDir := filepath.Join(dir, entry.Name())
+		files, err := ioutil.ReadDir(dbDir)
+		if err != nil {
+			return nil, err
+		}
+		add(entry.Name(), dbDir, files)
+	}
+	if hasDatabases {
+		// only the oplog of --oplog is written beside the databases
+		add("", dir, entries)
+	} else {
+		add(filepath.Base(filepath.Clean(dir)), dir, entries)
+	}
+
+	collections := make([]*dumpCollection, 0, len(byNamespace))
+	for _, collection := range byNamespace {
+		collections = append(collections, collection)
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].Namespace < collections[j].Namespace
+	})
+	return collections, nil
+}
+
+// openDumpFile opens a file of a mongodump directory, decompressing it if
+// it was written with --gzip.
+func openDumpFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+func (c *dumpCollection) readMetadata() (*dumpMetadata, error) {
+	if c.MetadataPath == "" {
+		return nil, nil
+	}
+	reader, err := openDumpFile(c.MetadataPath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	metadata := &dumpMetadata{}
+	if err = json.Unmarshal(contents, metadata); err != nil {
+		return nil, fmt.Errorf("error reading %v: %v", c.MetadataPath, err)
+	}
+	return metadata, nil
+}
+
+// prefixWriter writes a prefix at the start of every line. Closing it
+// leaves the underlying writer open.
+type prefixWriter struct {
+	io.Writer
+	prefix    []byte
+	lineStart bool
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.lineStart {
+			if _, err := w.Writer.Write(w.prefix); err != nil {
+				return written, err
+			}
+			w.lineStart = false
+		}
+		line := p
+		if i := bytes.IndexByte(p, '\n'); i >= 0 {
+			line = p[:i+1]
+			w.lineStart = true
+		}
+		n, err := w.Writer.Write(line)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[len(line):]
+	}
+	return written, nil
+}
+
+func (w *prefixWriter) Close() error { return nil }
+
+// DumpDirectory calls dump for the BSON file of every collection in a
+// mongodump directory, with each line of its output prefixed by the
+// namespace of the collection and a tab. Views, which have only metadata,
+// are reported and skipped. Options such as --filter and --skipDocs apply
+// to each collection separately.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before every collection is dumped.
+func (bd *BSONDump) DumpDirectory(dir string, dump func() (int, error)) (int, error) {
+	collections, err := findDumpCollections(dir)
+	if err != nil {
+		return 0, fmt.Errorf("error reading directory %v: %v", dir, err)
+	}
+	if len(collections) == 0 {
+		return 0, fmt.Errorf("no BSON files found in %v", dir)
+	}
+
+	out := bd.Out
+	defer func() { bd.Out = out }()
+	numFound := 0
+	for _, collection := range collections {
+		metadata, err := collection.readMetadata()
+		if err != nil {
+			return numFound, err
+		}
+		if collection.BSONPath == "" {
+			if metadata != nil && metadata.Options["viewOn"] != nil {
+				log.Logvf(log.Always, "skipping %v, a view on %v", collection.Namespace, metadata.Options["viewOn"])
+			} else {
+				log.Logvf(log.Always, "skipping %v, which has metadata but no BSON file", collection.Namespace)
+			}
+			continue
+		}
+		if metadata != nil {
+			log.Logvf(log.Info, "dumping %v, with %v index(es)", collection.Namespace, len(metadata.Indexes))
+		} else {
+			log.Logvf(log.Info, "dumping %v", collection.Namespace)
+		}
+
+		reader, err := openDumpFile(collection.BSONPath)
+		if err != nil {
+			return numFound, fmt.Errorf("error opening %v: %v", collection.BSONPath, err)
+		}
+		bd.nextSource(db.NewBSONSource(reader))
+		bd.Out = &prefixWriter{Writer: out, prefix: []byte(collection.Namespace + "\t"), lineStart: true}
+		found, err := dump()
+		bd.BSONSource.Close()
+		numFound += found
+		if err != nil {
+			return numFound, fmt.Errorf("error dumping %v: %v", collection.Namespace, err)
+		}
+	}
+	return numFound, nil
+}
@@ -0,0 +1,100 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestDumpDirectory(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a mongodump output directory", t, func() {
+		dir, err := ioutil.TempDir("", "bsondump_directory")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		writeFile := func(path string, compress bool, docs ...bson.D) {
+			contents := &bytes.Buffer{}
+			for _, doc := range docs {
+				data, err := bson.Marshal(doc)
+				So(err, ShouldBeNil)
+				contents.Write(data)
+			}
+			if compress {
+				compressed := &bytes.Buffer{}
+				gz := gzip.NewWriter(compressed)
+				_, err := gz.Write(contents.Bytes())
+				So(err, ShouldBeNil)
+				So(gz.Close(), ShouldBeNil)
+				contents = compressed
+			}
+			So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(path, contents.Bytes(), 0644), ShouldBeNil)
+		}
+		writeFile(filepath.Join(dir, "shop", "orders.bson"), false, bson.D{{"_id", 1}}, bson.D{{"_id", 2}})
+		writeFile(filepath.Join(dir, "shop", "customers.bson.gz"), true, bson.D{{"_id", "ada"}})
+		writeFile(filepath.Join(dir, "admin", "system.version.bson"), false, bson.D{{"_id", "v"}})
+		writeFile(filepath.Join(dir, "oplog.bson"), false)
+		So(ioutil.WriteFile(filepath.Join(dir, "shop", "orders.metadata.json"),
+			[]byte(`{"options":{},"indexes":[{"v":2,"key":{"_id":1},"name":"_id_"}]}`), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(dir, "shop", "recent.metadata.json"),
+			[]byte(`{"options":{"viewOn":"orders","pipeline":[]},"indexes":[]}`), 0644), ShouldBeNil)
+
+		out := &bytes.Buffer{}
+		opts := &BSONDumpOptions{NumDecodingWorkers: 1, BSONFileName: dir}
+		bd := BSONDump{
+			ToolOptions:     &options.ToolOptions{},
+			BSONDumpOptions: opts,
+			Out:             WriteNopCloser{out},
+		}
+
+		Convey("the collections should be found by namespace", func() {
+			collections, err := findDumpCollections(dir)
+			So(err, ShouldBeNil)
+			var namespaces []string
+			for _, collection := range collections {
+				namespaces = append(namespaces, collection.Namespace)
+			}
+			So(namespaces, ShouldResemble, []string{"admin.system.version", "oplog", "shop.customers", "shop.orders", "shop.recent"})
+			So(opts.IsDirectory(), ShouldBeTrue)
+		})
+
+		Convey("every line of output should start with its namespace", func() {
+			numFound, err := bd.DumpDirectory(dir, bd.JSON)
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 4)
+			So(out.String(), ShouldEqual, ""+
+				"admin.system.version\t{\"_id\":\"v\"}\n"+
+				"shop.customers\t{\"_id\":\"ada\"}\n"+
+				"shop.orders\t{\"_id\":1}\n"+
+				"shop.orders\t{\"_id\":2}\n")
+		})
+
+		Convey("a database directory should be read on its own", func() {
+			numFound, err := bd.DumpDirectory(filepath.Join(dir, "shop"), bd.Offsets)
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 3)
+			So(out.String(), ShouldEqual, "shop.customers\t0\t0\t18\nshop.orders\t0\t0\t14\nshop.orders\t1\t14\t14\n")
+		})
+
+		Convey("modes that read a single file should be rejected", func() {
+			opts.Type = Raw
+			So(opts.ValidateDirectoryOptions(), ShouldNotBeNil)
+		})
+	})
+}
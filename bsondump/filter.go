@@ -0,0 +1,617 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// filter matches documents against a query given with --filter. It supports
+// the query operators that can be evaluated on a single document: comparisons,
+// $in, $nin, $exists, $type, $regex, $size, $all, $elemMatch, $not, $and,
+// $or and $nor.
+type filter struct {
+	query bson.M
+}
+
+// newFilter parses a query in extended JSON.
+func newFilter(raw string) (*filter, error) {
+	parsed := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil, fmt.Errorf("error parsing --filter as json: %v", err)
+	}
+	if err := bsonutil.ConvertJSONDocumentToBSON(parsed); err != nil {
+		return nil, fmt.Errorf("error converting --filter to bson: %v", err)
+	}
+	// a round trip through BSON gives the query the same types as the
+	// documents it is matched against
+	data, err := bson.Marshal(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("error converting --filter to bson: %v", err)
+	}
+	f := &filter{query: bson.M{}}
+	if err = bson.Unmarshal(data, &f.query); err != nil {
+		return nil, fmt.Errorf("error converting --filter to bson: %v", err)
+	}
+	// match an empty document once so unsupported operators are reported
+	// before any output is written
+	if _, err = matchQuery(bson.M{}, f.query); err != nil {
+		return nil, fmt.Errorf("invalid --filter: %v", err)
+	}
+	return f, nil
+}
+
+// Matches returns true if the BSON document matches the query.
+func (f *filter) Matches(data []byte) (bool, error) {
+	doc := bson.M{}
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return false, err
+	}
+	return matchQuery(doc, f.query)
+}
+
+// matchQuery returns true if doc matches every clause of query.
+func matchQuery(doc bson.M, query bson.M) (bool, error) {
+	for key, cond := range query {
+		var matched bool
+		var err error
+		switch key {
+		case "$and", "$or", "$nor":
+			matched, err = matchLogical(doc, key, cond)
+		case "$comment":
+			matched = true
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, fmt.Errorf("unsupported query operator %v", key)
+			}
+			matched, err = matchField(doc, key, cond)
+		}
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.M, op string, cond interface{}) (bool, error) {
+	clauses, ok := cond.([]interface{})
+	if !ok || len(clauses) == 0 {
+		return false, fmt.Errorf("%v needs a non-empty array", op)
+	}
+	for _, clause := range clauses {
+		query, ok := clause.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("%v needs an array of documents", op)
+		}
+		matched, err := matchQuery(doc, query)
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case op == "$and" && !matched:
+			return false, nil
+		case op == "$or" && matched:
+			return true, nil
+		case op == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+// resolve returns the values at a dotted path, descending into the elements
+// of arrays along the way as the server does.
+func resolve(value interface{}, path []string) []interface{} {
+	if len(path) == 0 {
+		return []interface{}{value}
+	}
+	switch v := value.(type) {
+	case bson.M:
+		child, ok := v[path[0]]
+		if !ok {
+			return nil
+		}
+		return resolve(child, path[1:])
+	case []interface{}:
+		var values []interface{}
+		if i, err := strconv.Atoi(path[0]); err == nil && i >= 0 && i < len(v) {
+			values = append(values, resolve(v[i], path[1:])...)
+		}
+		for _, elem := range v {
+			if doc, ok := elem.(bson.M); ok {
+				values = append(values, resolve(doc, path)...)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// candidates returns the values a condition is tested against: each value
+// at the path and, for arrays, each of their elements.
+func candidates(values []interface{}) []interface{} {
+	var out []interface{}
+	for _, value := range values {
+		out = append(out, value)
+		if array, ok := value.([]interface{}); ok {
+			out = append(out, array...)
+		}
+	}
+	return out
+}
+
+func matchField(doc bson.M, path string, cond interface{}) (bool, error) {
+	values := resolve(doc, strings.Split(path, "."))
+	return matchCondition(values, cond)
+}
+
+// isOperatorDoc returns true if cond is a document of query operators
+// rather than a value to compare with.
+func isOperatorDoc(cond interface{}) (bson.M, bool) {
+	ops, ok := cond.(bson.M)
+	if !ok || len(ops) == 0 {
+		return nil, false
+	}
+	for key := range ops {
+		if !strings.HasPrefix(key, "$") {
+			return nil, false
+		}
+	}
+	return ops, true
+}
+
+// matchCondition returns true if the values at a path, which are missing if
+// there are none, satisfy cond.
+func matchCondition(values []interface{}, cond interface{}) (bool, error) {
+	ops, ok := isOperatorDoc(cond)
+	if !ok {
+		return matchEquals(values, cond)
+	}
+	for op, arg := range ops {
+		matched, err := matchOperator(values, op, arg, ops)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchEquals(values []interface{}, want interface{}) (bool, error) {
+	if regex, ok := want.(bson.RegEx); ok {
+		return matchRegex(values, regex)
+	}
+	if len(values) == 0 {
+		return want == nil, nil
+	}
+	for _, value := range candidates(values) {
+		if equalValues(value, want) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchOperator(values []interface{}, op string, arg interface{}, ops bson.M) (bool, error) {
+	switch op {
+	case "$eq":
+		return matchEquals(values, arg)
+	case "$ne":
+		matched, err := matchEquals(values, arg)
+		return !matched, err
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, value := range candidates(values) {
+			cmp, ok := compareValues(value, arg)
+			if !ok {
+				continue
+			}
+			if op == "$gt" && cmp > 0 || op == "$gte" && cmp >= 0 || op == "$lt" && cmp < 0 || op == "$lte" && cmp <= 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$in", "$nin":
+		list, ok := arg.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("%v needs an array", op)
+		}
+		matched := false
+		for _, want := range list {
+			m, err := matchEquals(values, want)
+			if err != nil {
+				return false, err
+			}
+			if m {
+				matched = true
+				break
+			}
+		}
+		return matched == (op == "$in"), nil
+	case "$exists":
+		return (len(values) > 0) == truthy(arg), nil
+	case "$type":
+		return matchType(values, arg)
+	case "$regex":
+		regex := bson.RegEx{}
+		switch pattern := arg.(type) {
+		case string:
+			regex.Pattern = pattern
+		case bson.RegEx:
+			regex = pattern
+		default:
+			return false, fmt.Errorf("$regex needs a string")
+		}
+		if options, ok := ops["$options"].(string); ok {
+			regex.Options = options
+		}
+		return matchRegex(values, regex)
+	case "$options":
+		if _, ok := ops["$regex"]; !ok {
+			return false, fmt.Errorf("$options needs a $regex")
+		}
+		return true, nil
+	case "$size":
+		size, ok := toInt(arg)
+		if !ok {
+			return false, fmt.Errorf("$size needs a number")
+		}
+		for _, value := range values {
+			if array, ok := value.([]interface{}); ok && int64(len(array)) == size {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		list, ok := arg.([]interface{})
+		if !ok {
+			return false, fmt.Errorf("$all needs an array")
+		}
+		if len(list) == 0 {
+			return false, nil
+		}
+		for _, want := range list {
+			matched, err := matchCondition(values, want)
+			if err != nil || !matched {
+				return false, err
+			}
+		}
+		return true, nil
+	case "$elemMatch":
+		cond, ok := arg.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("$elemMatch needs a document")
+		}
+		_, onValues := isOperatorDoc(cond)
+		for _, value := range values {
+			array, ok := value.([]interface{})
+			if !ok {
+				continue
+			}
+			for _, elem := range array {
+				var matched bool
+				var err error
+				if onValues {
+					matched, err = matchCondition([]interface{}{elem}, cond)
+				} else if doc, ok := elem.(bson.M); ok {
+					matched, err = matchQuery(doc, cond)
+				}
+				if err != nil {
+					return false, err
+				}
+				if matched {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "$not":
+		switch arg.(type) {
+		case bson.M, bson.RegEx:
+		default:
+			return false, fmt.Errorf("$not needs a document or a regular expression")
+		}
+		matched, err := matchCondition(values, arg)
+		return !matched, err
+	}
+	return false, fmt.Errorf("unsupported query operator %v", op)
+}
+
+func matchRegex(values []interface{}, regex bson.RegEx) (bool, error) {
+	flags := ""
+	for _, option := range regex.Options {
+		switch option {
+		case 'i', 'm', 's':
+			flags += string(option)
+		case 'x':
+		default:
+			return false, fmt.Errorf("unsupported regular expression option '%c'", option)
+		}
+	}
+	pattern := regex.Pattern
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return false, fmt.Errorf("invalid regular expression '%v': %v", regex.Pattern, err)
+	}
+	for _, value := range candidates(values) {
+		switch v := value.(type) {
+		case string:
+			if compiled.MatchString(v) {
+				return true, nil
+			}
+		case bson.RegEx:
+			if v == regex {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// bsonTypes maps the aliases accepted by $type to BSON type numbers.
+var bsonTypes = map[string]int{
+	"double":     0x01,
+	"string":     0x02,
+	"object":     0x03,
+	"array":      0x04,
+	"binData":    0x05,
+	"undefined":  0x06,
+	"objectId":   0x07,
+	"bool":       0x08,
+	"date":       0x09,
+	"null":       0x0A,
+	"regex":      0x0B,
+	"dbPointer":  0x0C,
+	"javascript": 0x0D,
+	"symbol":     0x0E,
+	"int":        0x10,
+	"timestamp":  0x11,
+	"long":       0x12,
+	"decimal":    0x13,
+	"minKey":     -1,
+	"maxKey":     0x7F,
+}
+
+// typeOf returns the BSON type number of a decoded value.
+func typeOf(value interface{}) int {
+	switch v := value.(type) {
+	case float64:
+		return 0x01
+	case string:
+		return 0x02
+	case bson.M:
+		return 0x03
+	case []interface{}:
+		return 0x04
+	case bson.Binary, []byte:
+		return 0x05
+	case bson.ObjectId:
+		return 0x07
+	case bool:
+		return 0x08
+	case time.Time:
+		return 0x09
+	case nil:
+		return 0x0A
+	case bson.RegEx:
+		return 0x0B
+	case bson.DBPointer:
+		return 0x0C
+	case bson.JavaScript:
+		if v.Scope != nil {
+			return 0x0F
+		}
+		return 0x0D
+	case bson.Symbol:
+		return 0x0E
+	case int, int32:
+		return 0x10
+	case bson.MongoTimestamp:
+		return 0x11
+	case int64:
+		return 0x12
+	case bson.Decimal128:
+		return 0x13
+	}
+	switch value {
+	case bson.Undefined:
+		return 0x06
+	case bson.MinKey:
+		return -1
+	case bson.MaxKey:
+		return 0x7F
+	}
+	return 0
+}
+
+func matchType(values []interface{}, arg interface{}) (bool, error) {
+	wanted := []interface{}{arg}
+	if list, ok := arg.([]interface{}); ok {
+		wanted = list
+	}
+	for _, want := range wanted {
+		var types []int
+		if name, ok := want.(string); ok {
+			if name == "number" {
+				types = []int{0x01, 0x10, 0x12, 0x13}
+			} else if code, ok := bsonTypes[name]; ok {
+				types = []int{code}
+			} else {
+				return false, fmt.Errorf("unknown $type '%v'", name)
+			}
+		} else if code, ok := toInt(want); ok {
+			types = []int{int(code)}
+		} else {
+			return false, fmt.Errorf("$type needs a type name or number")
+		}
+		for _, value := range candidates(values) {
+			for _, t := range types {
+				if typeOf(value) == t {
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+
+// truthy returns whether a value counts as true, as $exists sees it.
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case nil:
+		return false
+	}
+	if n, ok := toFloat(value); ok {
+		return n != 0
+	}
+	return true
+}
+
+func toInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float64:
+		if v == float64(int64(v)) {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case bson.Decimal128:
+		f, err := strconv.ParseFloat(v.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compareValues orders two values of the same kind, returning false if they
+// can't be compared, as the server won't compare values of different kinds.
+func compareValues(a, b interface{}) (int, bool) {
+	if x, ok := toInt(a); ok {
+		if y, ok := toInt(b); ok {
+			return compareInt64(x, y), true
+		}
+	}
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			switch {
+			case x < y:
+				return -1, true
+			case x > y:
+				return 1, true
+			}
+			return 0, x == y
+		}
+		return 0, false
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), true
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return compareInt64(x.UnixNano(), y.UnixNano()), true
+		}
+	case bson.ObjectId:
+		if y, ok := b.(bson.ObjectId); ok {
+			return strings.Compare(string(x), string(y)), true
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			if x == y {
+				return 0, true
+			}
+			if x {
+				return 1, true
+			}
+			return -1, true
+		}
+	case bson.MongoTimestamp:
+		if y, ok := b.(bson.MongoTimestamp); ok {
+			return compareInt64(int64(x), int64(y)), true
+		}
+	case bson.Binary:
+		if y, ok := b.(bson.Binary); ok && x.Kind == y.Kind {
+			return bytes.Compare(x.Data, y.Data), true
+		}
+	}
+	return 0, false
+}
+
+func compareInt64(x, y int64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// equalValues returns true if two values are equal, comparing numbers by
+// value and documents regardless of the order of their fields.
+func equalValues(a, b interface{}) bool {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp == 0
+	}
+	switch x := a.(type) {
+	case bson.M:
+		y, ok := b.(bson.M)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !equalValues(value, other) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalValues(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
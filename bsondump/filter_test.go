@@ -0,0 +1,81 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestFilter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	doc, err := bson.Marshal(bson.D{
+		{"status", "failed"},
+		{"attempts", 3},
+		{"score", 2.5},
+		{"tags", []string{"billing", "retry"}},
+		{"owner", bson.D{{"name", "ops"}, {"level", int64(2)}}},
+		{"items", []bson.D{{{"sku", "a"}, {"qty", 1}}, {{"sku", "b"}, {"qty", 5}}}},
+		{"note", nil},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	matches := func(query string) bool {
+		f, err := newFilter(query)
+		So(err, ShouldBeNil)
+		matched, err := f.Matches(doc)
+		So(err, ShouldBeNil)
+		return matched
+	}
+
+	Convey("Filters should match fields by value", t, func() {
+		So(matches(`{}`), ShouldBeTrue)
+		So(matches(`{"status": "failed"}`), ShouldBeTrue)
+		So(matches(`{"status": "done"}`), ShouldBeFalse)
+		So(matches(`{"attempts": 3.0}`), ShouldBeTrue)
+		So(matches(`{"owner.name": "ops", "owner.level": 2}`), ShouldBeTrue)
+		So(matches(`{"owner": {"level": 2, "name": "ops"}}`), ShouldBeTrue)
+		So(matches(`{"tags": "retry"}`), ShouldBeTrue)
+		So(matches(`{"tags.0": "billing"}`), ShouldBeTrue)
+		So(matches(`{"items.sku": "b"}`), ShouldBeTrue)
+		So(matches(`{"note": null}`), ShouldBeTrue)
+		So(matches(`{"missing": null}`), ShouldBeTrue)
+	})
+
+	Convey("Filters should support query operators", t, func() {
+		So(matches(`{"attempts": {"$gt": 2, "$lte": 3}}`), ShouldBeTrue)
+		So(matches(`{"score": {"$lt": 2}}`), ShouldBeFalse)
+		So(matches(`{"status": {"$gt": 1}}`), ShouldBeFalse)
+		So(matches(`{"status": {"$in": ["done", "failed"]}}`), ShouldBeTrue)
+		So(matches(`{"status": {"$nin": ["done", "failed"]}}`), ShouldBeFalse)
+		So(matches(`{"status": {"$ne": "done"}}`), ShouldBeTrue)
+		So(matches(`{"missing": {"$exists": false}, "note": {"$exists": true}}`), ShouldBeTrue)
+		So(matches(`{"status": {"$regex": "^FAIL", "$options": "i"}}`), ShouldBeTrue)
+		So(matches(`{"status": {"$not": {"$regex": "^fail"}}}`), ShouldBeFalse)
+		So(matches(`{"tags": {"$size": 2, "$all": ["retry", "billing"]}}`), ShouldBeTrue)
+		So(matches(`{"items": {"$elemMatch": {"sku": "a", "qty": {"$gt": 2}}}}`), ShouldBeFalse)
+		So(matches(`{"items": {"$elemMatch": {"sku": "b", "qty": {"$gt": 2}}}}`), ShouldBeTrue)
+		So(matches(`{"owner.level": {"$type": "long"}, "attempts": {"$type": "number"}}`), ShouldBeTrue)
+		So(matches(`{"$or": [{"status": "done"}, {"attempts": 3}]}`), ShouldBeTrue)
+		So(matches(`{"$nor": [{"status": "done"}, {"attempts": 3}]}`), ShouldBeFalse)
+		So(matches(`{"$and": [{"status": "failed"}, {"score": {"$gte": 2.5}}]}`), ShouldBeTrue)
+	})
+
+	Convey("Filters should reject what they can't evaluate", t, func() {
+		_, err := newFilter(`{"$where": "this.a > 1"}`)
+		So(err, ShouldNotBeNil)
+		_, err = newFilter(`{"a": {"$near": [0, 0]}}`)
+		So(err, ShouldNotBeNil)
+		_, err = newFilter(`{"a": `)
+		So(err, ShouldNotBeNil)
+	})
+}
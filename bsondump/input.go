@@ -0,0 +1,68 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+var (
+	// the gzip magic number followed by the deflate method. Uncompressed BSON
+	// can only start with it if its first document is exactly 559,903 bytes.
+	gzipMagic = []byte{0x1f, 0x8b, 0x08}
+	// the zstd frame magic number, which is never a valid document size
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// decompressedReader reads the decompressed data of a compressed input, and
+// closes the input along with it.
+type decompressedReader struct {
+	io.ReadCloser
+	input io.Closer
+}
+
+func (r decompressedReader) Close() error {
+	err := r.ReadCloser.Close()
+	if inputErr := r.input.Close(); err == nil {
+		err = inputErr
+	}
+	return err
+}
+
+// decompress returns a reader of the BSON data of in, which is decompressed
+// if in starts with the magic number of gzip or zstd.
+func decompress(in io.ReadCloser) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(in)
+	magic, _ := buffered.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		log.Logv(log.DebugLow, "reading gzip-compressed input")
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read gzip-compressed input: %v", err)
+		}
+		return decompressedReader{gz, in}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		log.Logv(log.DebugLow, "reading zstd-compressed input")
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read zstd-compressed input: %v", err)
+		}
+		return decompressedReader{zr.IOReadCloser(), in}, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{buffered, in}, nil
+}
@@ -0,0 +1,85 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestCompressedInput(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With BSON files written plainly and compressed", t, func() {
+		plain := &bytes.Buffer{}
+		for i := 0; i < 3; i++ {
+			doc, err := bson.Marshal(bson.D{{"n", i}})
+			So(err, ShouldBeNil)
+			plain.Write(doc)
+		}
+		compressed := &bytes.Buffer{}
+		gz := gzip.NewWriter(compressed)
+		_, err := gz.Write(plain.Bytes())
+		So(err, ShouldBeNil)
+		So(gz.Close(), ShouldBeNil)
+
+		dir, err := ioutil.TempDir("", "bsondump_input")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		read := func(contents []byte) ([]byte, error) {
+			opts := &BSONDumpOptions{BSONFileName: filepath.Join(dir, "input.bson")}
+			So(ioutil.WriteFile(opts.BSONFileName, contents, 0644), ShouldBeNil)
+			reader, err := opts.GetBSONReader()
+			if err != nil {
+				return nil, err
+			}
+			source := db.NewBSONSource(reader)
+			defer source.Close()
+			read := &bytes.Buffer{}
+			for doc := source.LoadNext(); doc != nil; doc = source.LoadNext() {
+				read.Write(doc)
+			}
+			return read.Bytes(), source.Err()
+		}
+
+		Convey("plain input should be read as is", func() {
+			data, err := read(plain.Bytes())
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, plain.Bytes())
+		})
+
+		Convey("gzip-compressed input should be decompressed", func() {
+			data, err := read(compressed.Bytes())
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, plain.Bytes())
+		})
+
+		Convey("zstd-compressed input should be decompressed", func() {
+			encoder, err := zstd.NewWriter(nil)
+			So(err, ShouldBeNil)
+			data, err := read(encoder.EncodeAll(plain.Bytes(), nil))
+			So(err, ShouldBeNil)
+			So(data, ShouldResemble, plain.Bytes())
+		})
+
+		Convey("corrupt zstd-compressed input should be an error", func() {
+			_, err := read(append(append([]byte{}, zstdMagic...), plain.Bytes()...))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
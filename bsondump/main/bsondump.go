@@ -10,10 +10,12 @@ package main
 import (
 	"github.com/mongodb/mongo-tools/bsondump"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/failure"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/util"
+	"io"
 	"os"
 )
 
@@ -41,8 +43,25 @@ func main() {
 	}
 
 	log.SetVerbosity(opts.Verbosity)
+	log.SetFormat(opts.LogFormat, opts.AppName)
 	signals.Handle()
 
+	// --diff compares the first file to the second
+	var diffFileName string
+	if bsonDumpOpts.Diff {
+		if bsonDumpOpts.BSONFileName != "" {
+			args = append([]string{bsonDumpOpts.BSONFileName}, args...)
+			bsonDumpOpts.BSONFileName = ""
+		}
+		if len(args) != 2 {
+			log.Logvf(log.Always, "--diff needs two BSON files to compare")
+			log.Logvf(log.Always, "try 'bsondump --help' for more information")
+			os.Exit(util.ExitBadOptions)
+		}
+		diffFileName = args[1]
+		args = args[:1]
+	}
+
 	if len(args) > 1 {
 		log.Logvf(log.Always, "too many positional arguments: %v", args)
 		log.Logvf(log.Always, "try 'bsondump --help' for more information")
@@ -59,44 +78,141 @@ func main() {
 		bsonDumpOpts.BSONFileName = args[0]
 	}
 
+	log.Logvf(log.DebugLow, "running bsondump with --objcheck: %v", bsonDumpOpts.ObjCheck)
+
+	switch bsonDumpOpts.Type {
+	case "", "debug", "json", bsondump.CSV, bsondump.TSV, bsondump.Stats, bsondump.Offsets, bsondump.Raw:
+	default:
+		log.Logvf(log.Always, "Unsupported output type '%v'. Must be one of 'debug', 'json', 'csv', 'tsv', 'stats', 'offsets' or 'raw'", bsonDumpOpts.Type)
+		os.Exit(util.ExitBadOptions)
+	}
+	if err := bsonDumpOpts.ValidateJSONFormat(); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if err := bsonDumpOpts.ValidateCSVOptions(); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if err := bsonDumpOpts.ValidateSplitOptions(); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if err := bsonDumpOpts.ValidateDiffOptions(); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if err := bsonDumpOpts.ValidateReverseOptions(); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if err := bsonDumpOpts.ValidateStructureOptions(); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if err := bsonDumpOpts.ValidateDirectoryOptions(); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if err := opts.RejectProgressEvents(); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if bsonDumpOpts.SkipDocs < 0 || bsonDumpOpts.LimitDocs < 0 {
+		log.Logvf(log.Always, "--skipDocs and --limitDocs cannot be negative")
+		os.Exit(util.ExitBadOptions)
+	}
+	if bsonDumpOpts.NumDecodingWorkers < 1 {
+		log.Logvf(log.Always, "--numDecodingWorkers must be at least 1")
+		os.Exit(util.ExitBadOptions)
+	}
+
 	dumper := bsondump.BSONDump{
 		ToolOptions:     opts,
 		BSONDumpOptions: bsonDumpOpts,
 	}
 
-	reader, err := bsonDumpOpts.GetBSONReader()
-	if err != nil {
-		log.Logvf(log.Always, "Getting BSON Reader Failed: %v", err)
-		os.Exit(util.ExitError)
+	directory := bsonDumpOpts.IsDirectory()
+	var reader io.ReadCloser
+	if !directory {
+		reader, err = bsonDumpOpts.GetBSONReader()
+		if err != nil {
+			log.Logvf(log.Always, "Getting BSON Reader Failed: %v", err)
+			os.Exit(failure.ExitCode(err))
+		}
+		dumper.BSONSource = db.NewBSONSource(reader)
+		defer dumper.BSONSource.Close()
 	}
-	dumper.BSONSource = db.NewBSONSource(reader)
-	defer dumper.BSONSource.Close()
 
 	writer, err := bsonDumpOpts.GetWriter()
 	if err != nil {
 		log.Logvf(log.Always, "Getting Writer Failed: %v", err)
-		os.Exit(util.ExitError)
+		os.Exit(failure.ExitCode(err))
 	}
 	dumper.Out = writer
 	defer dumper.Out.Close()
 
-	log.Logvf(log.DebugLow, "running bsondump with --objcheck: %v", bsonDumpOpts.ObjCheck)
+	if bsonDumpOpts.Diff {
+		otherOpts := *bsonDumpOpts
+		otherOpts.BSONFileName = diffFileName
+		otherReader, err := otherOpts.GetBSONReader()
+		if err != nil {
+			log.Logvf(log.Always, "Getting BSON Reader Failed: %v", err)
+			os.Exit(failure.ExitCode(err))
+		}
+		other := db.NewBSONSource(otherReader)
+		defer other.Close()
+
+		summary, err := dumper.Diff(other)
+		log.Logvf(log.Always, "%v", summary)
+		if err != nil {
+			log.Logv(log.Always, err.Error())
+			os.Exit(failure.ExitCode(err))
+		}
+		if summary.Differ() {
+			os.Exit(util.ExitError)
+		}
+		return
+	}
 
-	if len(bsonDumpOpts.Type) != 0 && bsonDumpOpts.Type != "debug" && bsonDumpOpts.Type != "json" {
-		log.Logvf(log.Always, "Unsupported output type '%v'. Must be either 'debug' or 'json'", bsonDumpOpts.Type)
-		os.Exit(util.ExitBadOptions)
+	dump := dumper.JSON
+	switch bsonDumpOpts.Type {
+	case "debug":
+		dump = dumper.Debug
+	case bsondump.CSV, bsondump.TSV:
+		dump = dumper.CSV
+	case bsondump.Stats:
+		dump = dumper.Stats
+	case bsondump.Offsets:
+		dump = dumper.Offsets
+	case bsondump.Raw:
+		dump = dumper.Raw
+	}
+	if bsonDumpOpts.ValidateStructure {
+		dump = dumper.ValidateStructure
 	}
 
 	var numFound int
-	if bsonDumpOpts.Type == "debug" {
-		numFound, err = dumper.Debug()
-	} else {
-		numFound, err = dumper.JSON()
+	switch {
+	case bsonDumpOpts.Reverse:
+		numFound, err = dumper.Reverse(reader)
+	case directory:
+		numFound, err = dumper.DumpDirectory(bsonDumpOpts.BSONFileName, dump)
+	default:
+		numFound, err = dump()
 	}
 
 	log.Logvf(log.Always, "%v objects found", numFound)
+	if skipped := dumper.SkippedRanges(); skipped > 0 {
+		log.Logvf(log.Always, "%v range(s) of corrupt data skipped", skipped)
+	}
 	if err != nil {
 		log.Logv(log.Always, err.Error())
+		os.Exit(failure.ExitCode(err))
+	}
+	if dumper.Violations() > 0 {
 		os.Exit(util.ExitError)
 	}
 }
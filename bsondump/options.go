@@ -7,26 +7,88 @@
 package bsondump
 
 var Usage = `<options> <file>
+       bsondump --diff <options> <file> <file>
+       bsondump --reverse <options> <file>
 
-View and debug .bson files.
+View and debug .bson files. The file is read from stdin if it is '-' or
+omitted, and is decompressed if it is compressed with gzip or zstd. Given the
+output directory of mongodump, every collection in it is read, and each line
+of output starts with the collection's namespace.
 
 See http://docs.mongodb.org/manual/reference/program/bsondump/ for more information.`
 
 type BSONDumpOptions struct {
 	// Format to display the BSON data file
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"type of output: debug, json (default 'json')"`
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"type of output: debug, json, csv, tsv, stats, a report of document sizes and of the types, sizes and number of distinct values of each field, offsets, a line with the index, byte offset and length of each document, or raw, the BSON of each document unchanged (default 'json')"`
 
 	// Validate each BSON document before displaying
 	ObjCheck bool `long:"objcheck" description:"validate BSON during processing"`
 
+	// Skip past corrupt data instead of stopping at it
+	ObjCheckRecover bool `long:"objcheck-recover" description:"validate BSON during processing, skipping past corrupt data to the next valid document and reporting the byte ranges skipped"`
+
 	// Display JSON data with indents
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
 
+	// Extended JSON dialect of JSON output
+	JSONFormat string `long:"jsonFormat" value-name:"<type>" description:"the extended JSON format to output, either canonical or relaxed (v2), or legacy (defaults to 'legacy')"`
+
 	// Path to input BSON file
-	BSONFileName string `long:"bsonFile" description:"path to BSON file to dump to JSON; default is stdin"`
+	BSONFileName string `long:"bsonFile" description:"path to BSON file to dump to JSON, which may be compressed with gzip or zstd; default or '-' is stdin"`
 
 	// Path to output file
 	OutFileName string `long:"outFile" description:"path to output file to dump BSON to; default is stdout"`
+
+	// Maximum number of documents in each output file
+	SplitDocs int64 `long:"splitDocs" value-name:"<count>" description:"split JSON output into numbered files of at most this many documents each, named after --outFile, e.g. out.0000.json"`
+
+	// Maximum size of each output file
+	SplitSize string `long:"splitSize" value-name:"<size>" description:"split JSON output into numbered files of at most this size each, e.g. 512MB or 1GB, named after --outFile; a larger document gets a file of its own"`
+
+	// SplitSize in bytes, set by ValidateSplitOptions
+	splitBytes int64
+
+	// Fields kept in JSON output, or written as the columns of CSV and TSV output
+	Fields string `long:"fields" value-name:"<field>[,<field>]*" description:"comma separated list of field names to keep in JSON output, or to write as the columns of CSV or TSV output, e.g. --fields \"name,address.city\""`
+
+	// Write CSV and TSV output without a header line
+	NoHeaderLine bool `long:"noHeaderLine" description:"write CSV or TSV output without a list of field names at the first line"`
+
+	// Expand nested documents in CSV and TSV output into one column per nested field
+	Flatten bool `long:"flatten" description:"expand nested documents in CSV or TSV output into one column per nested field, as mongoexport does, using the first document to determine the columns"`
+
+	// Separator between nested field names in the header
+	FlattenSeparator string `long:"flattenSeparator" value-name:"<string>" default:"." default-mask:"-" description:"separator between nested field names in the header when using --flatten (defaults to '.')"`
+
+	// How --flatten handles arrays
+	FlattenArrays string `long:"flattenArrays" value-name:"<mode>" default:"json" default-mask:"-" description:"how --flatten handles arrays, either index (one column per element) or json (defaults to 'json')"`
+
+	// Maximum number of nesting levels --flatten expands
+	FlattenDepth int `long:"flattenDepth" value-name:"<depth>" description:"maximum number of nesting levels expanded by --flatten; deeper values are written as JSON (defaults to unlimited)"`
+
+	// Number of goroutines converting documents to JSON
+	NumDecodingWorkers int `long:"numDecodingWorkers" value-name:"<count>" default:"1" default-mask:"-" description:"number of documents to decode and convert to JSON concurrently; output stays in order (default is 1)"`
+
+	// Compare two BSON files instead of displaying one
+	Diff bool `long:"diff" description:"compare the documents of two BSON files, given as positional arguments, and write the ones added, removed or changed in the second; exits with 1 if the files differ"`
+
+	// Field that matches the documents of the files compared with --diff
+	DiffKey string `long:"diffKey" value-name:"<field>" default:"_id" default-mask:"-" description:"field that matches the documents compared with --diff (defaults to '_id')"`
+
+	// Convert extended JSON to BSON instead of BSON to JSON
+	Reverse bool `long:"reverse" description:"read extended JSON documents, such as the output of bsondump, and write them as BSON, e.g. to pack edited documents back into a .bson file with --outFile"`
+
+	// Check the structure of the documents instead of displaying them
+	ValidateStructure bool `long:"validate" description:"check the structure of every document without converting it, writing the byte offset and reason of every violation and a summary; exits with 1 if any are found"`
+
+	// Number of documents at the start of the file to skip
+	SkipDocs int64 `long:"skipDocs" value-name:"<count>" description:"skip this many documents at the start of the file, before any --filter"`
+
+	// Maximum number of documents to read after --skipDocs
+	LimitDocs int64 `long:"limitDocs" value-name:"<count>" description:"read at most this many documents after --skipDocs, e.g. --type=raw --skipDocs=41 --limitDocs=1 extracts the 42nd document"`
+
+	// Query that documents must match to be displayed
+	Filter string `long:"filter" value-name:"<json>" description:"only display documents matching this query, in extended JSON, e.g. '{\"status\": \"failed\"}'"`
 }
 
 func (_ *BSONDumpOptions) Name() string {
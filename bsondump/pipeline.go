@@ -0,0 +1,114 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"github.com/mongodb/mongo-tools/common/db"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// decodingBatchSize is the number of documents handed to a decoding worker
+// at a time, so that workers don't contend over every small document.
+const decodingBatchSize = 64
+
+// jsonResult is the outcome of converting one document to JSON.
+type jsonResult struct {
+	// the document as JSON, without a trailing newline
+	json []byte
+	// true if the document doesn't match --filter
+	skip bool
+	// set if the document couldn't be matched against --filter
+	matchErr error
+	// set if the document couldn't be converted to JSON
+	formatErr error
+}
+
+// convert matches a document against --filter and converts the fields kept
+// by --fields to JSON.
+func (bd *BSONDump) convert(data []byte) jsonResult {
+	matched, err := bd.matches(data)
+	if err != nil {
+		return jsonResult{matchErr: err}
+	}
+	if !matched {
+		return jsonResult{skip: true}
+	}
+	if bd.projection != nil {
+		if data, err = bd.projection.apply(data); err != nil {
+			return jsonResult{formatErr: err}
+		}
+	}
+	json, err := formatJSON(&bson.Raw{Kind: 0x03, Data: data}, bd.BSONDumpOptions.Pretty, bd.BSONDumpOptions.JSONFormat)
+	return jsonResult{json: json, formatErr: err}
+}
+
+// jsonBatch is a run of consecutive documents converted by one worker.
+type jsonBatch struct {
+	docs    [][]byte
+	results []jsonResult
+	// closed once results are set
+	ready chan struct{}
+}
+
+// convertParallel reads the documents of source and converts them on
+// NumDecodingWorkers goroutines. It returns the batches of documents in the
+// order they were read; each batch's results can be used once it is ready.
+// Closing done stops the reading. The returned channel is closed once every
+// document is read, after which source.Err() reports any error reading it.
+func (bd *BSONDump) convertParallel(source db.RawDocSource, done <-chan struct{}) <-chan *jsonBatch {
+	workers := bd.BSONDumpOptions.NumDecodingWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan *jsonBatch, workers*2)
+	ordered := make(chan *jsonBatch, workers*2)
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			for batch := range jobs {
+				batch.results = make([]jsonResult, len(batch.docs))
+				for j, doc := range batch.docs {
+					batch.results[j] = bd.convert(doc)
+				}
+				close(batch.ready)
+			}
+		}()
+	}
+
+	go func() {
+		defer close(ordered)
+		defer close(jobs)
+		for {
+			batch := &jsonBatch{ready: make(chan struct{})}
+			for len(batch.docs) < decodingBatchSize {
+				doc := source.LoadNext()
+				if doc == nil {
+					break
+				}
+				// sources reuse their buffer for the next document
+				batch.docs = append(batch.docs, append([]byte{}, doc...))
+			}
+			if len(batch.docs) == 0 {
+				return
+			}
+			select {
+			case jobs <- batch:
+			case <-done:
+				return
+			}
+			select {
+			case ordered <- batch:
+			case <-done:
+				return
+			}
+			if len(batch.docs) < decodingBatchSize {
+				return
+			}
+		}
+	}()
+	return ordered
+}
@@ -0,0 +1,98 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParallelJSON(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a stream of many documents", t, func() {
+		input := &bytes.Buffer{}
+		var wanted, expected []string
+		for i := 0; i < 1000; i++ {
+			doc, err := bson.Marshal(bson.D{{"n", i}})
+			So(err, ShouldBeNil)
+			input.Write(doc)
+			if i%3 == 0 {
+				wanted = append(wanted, fmt.Sprint(i))
+				expected = append(expected, fmt.Sprintf(`{"n":%v}`, i))
+			}
+		}
+		out := &bytes.Buffer{}
+		bd := BSONDump{
+			ToolOptions: &options.ToolOptions{},
+			BSONDumpOptions: &BSONDumpOptions{
+				NumDecodingWorkers: 8,
+				Filter:             `{"n": {"$in": [` + strings.Join(wanted, ",") + `]}}`,
+			},
+			Out:        WriteNopCloser{out},
+			BSONSource: db.NewBSONSource(ioutil.NopCloser(input)),
+		}
+
+		Convey("several workers should write matching documents in order", func() {
+			numFound, err := bd.JSON()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, len(expected))
+			So(out.String(), ShouldEqual, strings.Join(expected, "\n")+"\n")
+		})
+	})
+}
+
+func TestJSONFormat(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a document of numbers and dates", t, func() {
+		doc, err := bson.Marshal(bson.D{{"n", int64(3)}, {"d", time.Unix(0, 0)}})
+		So(err, ShouldBeNil)
+		out := &bytes.Buffer{}
+		opts := &BSONDumpOptions{NumDecodingWorkers: 1}
+		bd := BSONDump{
+			ToolOptions:     &options.ToolOptions{},
+			BSONDumpOptions: opts,
+			Out:             WriteNopCloser{out},
+			BSONSource:      db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(doc))),
+		}
+
+		Convey("--jsonFormat=canonical should preserve every type", func() {
+			opts.JSONFormat = "Canonical"
+			So(opts.ValidateJSONFormat(), ShouldBeNil)
+			_, err := bd.JSON()
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldEqual, `{"n":{"$numberLong":"3"},"d":{"$date":{"$numberLong":"0"}}}`+"\n")
+		})
+
+		Convey("--jsonFormat=relaxed should use plain numbers and ISO-8601 dates", func() {
+			opts.JSONFormat = "relaxed"
+			So(opts.ValidateJSONFormat(), ShouldBeNil)
+			_, err := bd.JSON()
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldEqual, `{"n":3,"d":{"$date":"1970-01-01T00:00:00.000Z"}}`+"\n")
+		})
+
+		Convey("--jsonFormat should reject unknown formats and other output types", func() {
+			opts.JSONFormat = "v3"
+			So(opts.ValidateJSONFormat(), ShouldNotBeNil)
+			opts.JSONFormat = "relaxed"
+			opts.Type = CSV
+			So(opts.ValidateJSONFormat(), ShouldNotBeNil)
+		})
+	})
+}
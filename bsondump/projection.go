@@ -0,0 +1,126 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"strconv"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// fieldList returns the field paths given with --fields.
+func (bdo *BSONDumpOptions) fieldList() []string {
+	var fields []string
+	for _, field := range strings.Split(bdo.Fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// projection is a tree of the field paths to keep in each document. A field
+// with a nil subtree is kept whole.
+type projection map[string]projection
+
+// newProjection builds the projection that keeps the given dotted paths.
+// A path inside a field that is already kept whole changes nothing.
+func newProjection(paths []string) projection {
+	root := projection{}
+	for _, path := range paths {
+		node := root
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			child, ok := node[name]
+			if ok && child == nil {
+				break
+			}
+			if i == len(names)-1 {
+				node[name] = nil
+				break
+			}
+			if !ok {
+				child = projection{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return root
+}
+
+// apply returns a copy of a document with only the projected fields. The
+// values of other fields are never decoded, so skipping large ones is cheap.
+// As with queries, a path through an array applies to each document in it.
+func (p projection) apply(data []byte) ([]byte, error) {
+	kept, err := p.applyFields(data)
+	if err != nil {
+		return nil, err
+	}
+	return bson.Marshal(kept)
+}
+
+func (p projection) applyFields(data []byte) (bson.RawD, error) {
+	var elems bson.RawD
+	if err := bson.Unmarshal(data, &elems); err != nil {
+		return nil, err
+	}
+	kept := bson.RawD{}
+	for _, elem := range elems {
+		child, ok := p[elem.Name]
+		if !ok {
+			continue
+		}
+		if child == nil {
+			kept = append(kept, elem)
+			continue
+		}
+		value, ok, err := child.applyValue(elem.Value)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			kept = append(kept, bson.RawDocElem{Name: elem.Name, Value: value})
+		}
+	}
+	return kept, nil
+}
+
+// applyValue projects the fields of an embedded document, or of each
+// document in an array. It returns false if the value has no such fields
+// to project.
+func (p projection) applyValue(value bson.Raw) (bson.Raw, bool, error) {
+	switch value.Kind {
+	case 0x03:
+		kept, err := p.applyFields(value.Data)
+		if err != nil {
+			return value, false, err
+		}
+		data, err := bson.Marshal(kept)
+		return bson.Raw{Kind: 0x03, Data: data}, true, err
+	case 0x04:
+		var elems bson.RawD
+		if err := bson.Unmarshal(value.Data, &elems); err != nil {
+			return value, false, err
+		}
+		kept := bson.RawD{}
+		for _, elem := range elems {
+			projected, ok, err := p.applyValue(elem.Value)
+			if err != nil {
+				return value, false, err
+			}
+			if ok {
+				// arrays are documents keyed by their contiguous indexes
+				kept = append(kept, bson.RawDocElem{Name: strconv.Itoa(len(kept)), Value: projected})
+			}
+		}
+		data, err := bson.Marshal(kept)
+		return bson.Raw{Kind: 0x04, Data: data}, true, err
+	}
+	return value, false, nil
+}
@@ -0,0 +1,72 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestProjection(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a document with nested fields", t, func() {
+		doc, err := bson.Marshal(bson.D{
+			{"_id", 1},
+			{"name", "ada"},
+			{"blob", bytes.Repeat([]byte{'x'}, 1024)},
+			{"address", bson.D{{"city", "London"}, {"zip", "N1"}}},
+			{"orders", []interface{}{bson.D{{"sku", "a"}, {"qty", 2}}, 5, bson.D{{"qty", 1}}}},
+		})
+		So(err, ShouldBeNil)
+
+		project := func(paths ...string) bson.D {
+			data, err := newProjection(paths).apply(doc)
+			So(err, ShouldBeNil)
+			projected := bson.D{}
+			So(bson.Unmarshal(data, &projected), ShouldBeNil)
+			return projected
+		}
+
+		Convey("top-level fields should be kept in document order", func() {
+			So(project("name", "_id"), ShouldResemble, bson.D{{"_id", 1}, {"name", "ada"}})
+		})
+
+		Convey("nested paths should keep only the named subfields", func() {
+			So(project("address.zip", "missing.field"), ShouldResemble, bson.D{{"address", bson.D{{"zip", "N1"}}}})
+		})
+
+		Convey("a field kept whole should win over paths inside it", func() {
+			So(project("address.zip", "address"), ShouldResemble, bson.D{{"address", bson.D{{"city", "London"}, {"zip", "N1"}}}})
+		})
+
+		Convey("paths through arrays should apply to each document in them", func() {
+			So(project("orders.qty"), ShouldResemble, bson.D{{"orders", []interface{}{bson.D{{"qty", 2}}, bson.D{{"qty", 1}}}}})
+		})
+
+		Convey("--fields should project JSON output", func() {
+			out := &bytes.Buffer{}
+			bd := BSONDump{
+				ToolOptions:     &options.ToolOptions{},
+				BSONDumpOptions: &BSONDumpOptions{Fields: "name, address.city", NumDecodingWorkers: 1},
+				Out:             WriteNopCloser{out},
+				BSONSource:      db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(doc))),
+			}
+			numFound, err := bd.JSON()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 1)
+			So(out.String(), ShouldEqual, `{"name":"ada","address":{"city":"London"}}`+"\n")
+		})
+	})
+}
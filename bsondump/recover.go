@@ -0,0 +1,130 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// skippedRange is a range of bytes in a BSON file that holds no valid
+// document, from Start up to but not including End.
+type skippedRange struct {
+	Start, End int64
+}
+
+// recoveringSource reads the valid documents of a BSON stream that may be
+// corrupt. Where a valid document doesn't start, it scans forward a byte at
+// a time for the next place one does, and records the bytes it skipped.
+type recoveringSource struct {
+	stream  io.ReadCloser
+	reader  *bufio.Reader
+	buf     []byte
+	offset  int64
+	err     error
+	skipped []skippedRange
+}
+
+func newRecoveringSource(in io.ReadCloser) *recoveringSource {
+	return &recoveringSource{stream: in, reader: bufio.NewReaderSize(in, db.MaxBSONSize)}
+}
+
+// LoadNext returns the next valid document in the stream, or nil at its end
+// or if reading it fails. The returned slice is reused by the next call.
+func (rs *recoveringSource) LoadNext() []byte {
+	start := rs.offset
+	for {
+		doc, err := rs.peekDocument()
+		if err == io.EOF {
+			rs.skip(start)
+			return nil
+		}
+		if err != nil {
+			rs.err = err
+			return nil
+		}
+		if doc != nil {
+			rs.skip(start)
+			rs.buf = append(rs.buf[:0], doc...)
+			rs.discard(len(doc))
+			return rs.buf
+		}
+		rs.discard(1)
+	}
+}
+
+// peekDocument returns the document starting at the current offset without
+// consuming it, nil if no valid document starts there, or io.EOF at the end
+// of the stream.
+func (rs *recoveringSource) peekDocument() ([]byte, error) {
+	header, err := rs.reader.Peek(4)
+	if len(header) == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	if len(header) < 4 {
+		return nil, notEOF(err)
+	}
+	size := int32(binary.LittleEndian.Uint32(header))
+	if size < 5 || size > db.MaxBSONSize {
+		return nil, nil
+	}
+	data, err := rs.reader.Peek(int(size))
+	if len(data) < int(size) {
+		return nil, notEOF(err)
+	}
+	// cheap checks before decoding: a document ends with a null byte, and
+	// its first byte is either that null byte or a valid element type
+	if data[size-1] != 0 || !validElementType(data[4]) {
+		return nil, nil
+	}
+	if bson.Unmarshal(data, &bson.D{}) != nil {
+		return nil, nil
+	}
+	return data, nil
+}
+
+// notEOF returns err unless it is io.EOF, which only means that what is
+// left of the stream is too short to hold a document.
+func notEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+func validElementType(kind byte) bool {
+	return kind <= 0x13 || kind == 0x7F || kind == 0xFF
+}
+
+func (rs *recoveringSource) discard(n int) {
+	discarded, _ := rs.reader.Discard(n)
+	rs.offset += int64(discarded)
+}
+
+// skip records and reports the bytes from start to the current offset, if
+// there are any.
+func (rs *recoveringSource) skip(start int64) {
+	if rs.offset == start {
+		return
+	}
+	rs.skipped = append(rs.skipped, skippedRange{start, rs.offset})
+	log.Logvf(log.Always, "skipped %v bytes of corrupt data at offsets %v to %v",
+		rs.offset-start, start, rs.offset-1)
+}
+
+func (rs *recoveringSource) Close() error {
+	return rs.stream.Close()
+}
+
+func (rs *recoveringSource) Err() error {
+	return rs.err
+}
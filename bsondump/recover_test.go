@@ -0,0 +1,85 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestRecoveringSource(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	var docs [][]byte
+	for i := 0; i < 4; i++ {
+		doc, err := bson.Marshal(bson.D{{"n", i}, {"s", "some text"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs = append(docs, doc)
+	}
+	readAll := func(stream []byte) ([]int, []skippedRange) {
+		source := newRecoveringSource(ioutil.NopCloser(bytes.NewReader(stream)))
+		var found []int
+		for {
+			doc := source.LoadNext()
+			if doc == nil {
+				break
+			}
+			var decoded struct{ N int }
+			So(bson.Unmarshal(doc, &decoded), ShouldBeNil)
+			found = append(found, decoded.N)
+		}
+		So(source.Err(), ShouldBeNil)
+		return found, source.skipped
+	}
+
+	Convey("An intact stream should be read whole", t, func() {
+		found, skipped := readAll(bytes.Join(docs, nil))
+		So(found, ShouldResemble, []int{0, 1, 2, 3})
+		So(skipped, ShouldBeEmpty)
+	})
+
+	Convey("A document with a corrupt header should be skipped", t, func() {
+		stream := bytes.Join(docs, nil)
+		second := int64(len(docs[0]))
+		stream[second] = 0xFF
+		stream[second+3] = 0x7F
+		found, skipped := readAll(stream)
+		So(found, ShouldResemble, []int{0, 2, 3})
+		So(skipped, ShouldResemble, []skippedRange{{second, second + int64(len(docs[1]))}})
+	})
+
+	Convey("A document with corrupt contents should be skipped", t, func() {
+		stream := bytes.Join(docs, nil)
+		// the type of the first element of the third document
+		third := int64(len(docs[0]) + len(docs[1]))
+		stream[third+4] = 0x42
+		found, skipped := readAll(stream)
+		So(found, ShouldResemble, []int{0, 1, 3})
+		So(skipped, ShouldResemble, []skippedRange{{third, third + int64(len(docs[2]))}})
+	})
+
+	Convey("Garbage between documents and a truncated tail should be skipped", t, func() {
+		stream := append([]byte{}, docs[0]...)
+		stream = append(stream, []byte("garbage")...)
+		stream = append(stream, docs[1]...)
+		stream = append(stream, docs[2][:10]...)
+		found, skipped := readAll(stream)
+		So(found, ShouldResemble, []int{0, 1})
+		end := int64(len(stream))
+		So(skipped, ShouldResemble, []skippedRange{
+			{int64(len(docs[0])), int64(len(docs[0])) + 7},
+			{end - 10, end},
+		})
+	})
+}
@@ -0,0 +1,77 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ValidateReverseOptions checks that --reverse isn't used with options that
+// only apply to reading BSON.
+func (bdo *BSONDumpOptions) ValidateReverseOptions() error {
+	if !bdo.Reverse {
+		return nil
+	}
+	switch {
+	case bdo.Type != "" && bdo.Type != "json":
+		return fmt.Errorf("--reverse cannot be used with --type")
+	case bdo.Diff:
+		return fmt.Errorf("--reverse cannot be used with --diff")
+	case bdo.Filter != "" || bdo.Fields != "":
+		return fmt.Errorf("--reverse cannot be used with --filter or --fields")
+	case bdo.SplitDocs != 0 || bdo.SplitSize != "":
+		return fmt.Errorf("--reverse cannot be used with --splitDocs or --splitSize")
+	case bdo.SkipDocs != 0 || bdo.LimitDocs != 0 || bdo.ObjCheckRecover:
+		return fmt.Errorf("--reverse cannot be used with --skipDocs, --limitDocs or --objcheck-recover")
+	}
+	return nil
+}
+
+// Reverse reads extended JSON documents from in, as written by JSON in any
+// of the --jsonFormat dialects, pretty or not, and writes them as BSON, so
+// that the output of bsondump can be edited and packed back into a file that
+// mongorestore can read. It stops at the first document that can't be
+// converted.
+// It returns the number of documents written and a non-nil error if one is
+// encountered before the end of the input is reached.
+func (bd *BSONDump) Reverse(in io.Reader) (int, error) {
+	numFound := 0
+	decoder := json.NewDecoder(in)
+	for {
+		raw, err := decoder.ScanObject()
+		if err == io.EOF {
+			return numFound, nil
+		}
+		if err != nil {
+			return numFound, fmt.Errorf("error reading document %v: %v", numFound+1, err)
+		}
+		doc, err := json.UnmarshalBsonD(raw)
+		if err == nil {
+			doc, err = bsonutil.GetExtendedBsonD(doc)
+		}
+		if err != nil {
+			return numFound, fmt.Errorf("error converting document %v: %v", numFound+1, err)
+		}
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			return numFound, fmt.Errorf("error converting document %v to BSON: %v", numFound+1, err)
+		}
+		if len(data) > db.MaxBSONSize {
+			return numFound, fmt.Errorf("document %v is %v bytes, more than the maximum of %v", numFound+1, len(data), db.MaxBSONSize)
+		}
+		if _, err = bd.Out.Write(data); err != nil {
+			return numFound, err
+		}
+		numFound++
+	}
+}
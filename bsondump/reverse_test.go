@@ -0,0 +1,70 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestReverse(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a stream of documents of several types", t, func() {
+		input := &bytes.Buffer{}
+		for _, doc := range []bson.D{
+			{{"_id", bson.ObjectIdHex("5a1e2c3d4e5f60718293a4b5")}, {"n", int64(1) << 40}, {"i", 7}},
+			{{"d", time.Unix(1500000000, 0).UTC()}, {"b", []byte("bin")}, {"f", 1.5}, {"nested", bson.D{{"a", []interface{}{"x", true, nil}}}}},
+		} {
+			data, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			input.Write(data)
+		}
+		original := append([]byte{}, input.Bytes()...)
+
+		for _, format := range []string{"", "canonical", "relaxed"} {
+			for _, pretty := range []bool{false, true} {
+				Convey(fmt.Sprintf("JSON written with --jsonFormat='%v' and --pretty=%v should convert back to the same BSON", format, pretty), func() {
+					asJSON := &bytes.Buffer{}
+					bd := BSONDump{
+						ToolOptions:     &options.ToolOptions{},
+						BSONDumpOptions: &BSONDumpOptions{NumDecodingWorkers: 1, JSONFormat: format, Pretty: pretty},
+						Out:             WriteNopCloser{asJSON},
+						BSONSource:      db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(original))),
+					}
+					_, err := bd.JSON()
+					So(err, ShouldBeNil)
+
+					asBSON := &bytes.Buffer{}
+					bd.Out = WriteNopCloser{asBSON}
+					numFound, err := bd.Reverse(asJSON)
+					So(err, ShouldBeNil)
+					So(numFound, ShouldEqual, 2)
+					So(asBSON.Bytes(), ShouldResemble, original)
+				})
+			}
+		}
+
+		Convey("invalid JSON should stop the conversion", func() {
+			out := &bytes.Buffer{}
+			bd := BSONDump{ToolOptions: &options.ToolOptions{}, BSONDumpOptions: &BSONDumpOptions{}, Out: WriteNopCloser{out}}
+			numFound, err := bd.Reverse(strings.NewReader(`{"a": 1}` + "\n" + `{"b": }`))
+			So(err, ShouldNotBeNil)
+			So(numFound, ShouldEqual, 1)
+		})
+	})
+}
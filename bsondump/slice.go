@@ -0,0 +1,120 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// Output types for inspecting where documents are stored.
+const (
+	// Offsets writes the index, byte offset and length of each document.
+	Offsets = "offsets"
+	// Raw writes each document's BSON bytes unchanged.
+	Raw = "raw"
+)
+
+// slicedSource reads the documents of a source from index skip on, up to
+// limit of them if limit is positive, and tracks where in the input each
+// document starts. Indexes and offsets count from 0.
+type slicedSource struct {
+	db.RawDocSource
+	skip, limit int64
+
+	read     int64
+	returned int64
+	// the index and offset of the last document returned
+	index, offset int64
+	// the offset just past the last document read
+	end int64
+}
+
+func (s *slicedSource) LoadNext() []byte {
+	for {
+		if s.limit > 0 && s.returned >= s.limit {
+			return nil
+		}
+		doc := s.RawDocSource.LoadNext()
+		if doc == nil {
+			return nil
+		}
+		// with --objcheck-recover, corrupt bytes may lie between documents
+		if recovering, ok := s.RawDocSource.(*recoveringSource); ok {
+			s.end = recovering.offset
+		} else {
+			s.end += int64(len(doc))
+		}
+		s.index, s.offset = s.read, s.end-int64(len(doc))
+		s.read++
+		if s.index >= s.skip {
+			s.returned++
+			return doc
+		}
+	}
+}
+
+// Offsets iterates through the BSON file and writes a line with the index,
+// byte offset and length of each document it finds, separated by tabs.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) Offsets() (int, error) {
+	return bd.eachDocument("Offsets", func(data []byte) error {
+		_, err := fmt.Fprintf(bd.Out, "%v\t%v\t%v\n", bd.sliced.index, bd.sliced.offset, len(data))
+		return err
+	})
+}
+
+// Raw iterates through the BSON file and writes the BSON bytes of each
+// document it finds unchanged, e.g. to extract a single document from a
+// large file with --skipDocs and --limitDocs.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) Raw() (int, error) {
+	return bd.eachDocument("Raw", func(data []byte) error {
+		_, err := bd.Out.Write(data)
+		return err
+	})
+}
+
+// eachDocument calls write with each document that matches --filter.
+func (bd *BSONDump) eachDocument(name string, write func(data []byte) error) (int, error) {
+	numFound := 0
+
+	if bd.BSONSource == nil {
+		panic(fmt.Sprintf("Tried to call %v() before opening file", name))
+	}
+	if err := bd.initFilter(); err != nil {
+		return 0, err
+	}
+
+	source := bd.source()
+	for {
+		data := source.LoadNext()
+		if data == nil {
+			break
+		}
+		matched, err := bd.matches(data)
+		if err != nil {
+			log.Logvf(log.Always, "unable to match document against --filter: %v", err)
+			if bd.BSONDumpOptions.ObjCheck {
+				return numFound, err
+			}
+			continue
+		}
+		if !matched {
+			continue
+		}
+		if err = write(data); err != nil {
+			return numFound, err
+		}
+		numFound++
+	}
+	return numFound, source.Err()
+}
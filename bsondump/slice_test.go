@@ -0,0 +1,81 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSlicing(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a stream of documents", t, func() {
+		var docs [][]byte
+		input := &bytes.Buffer{}
+		for _, value := range []string{"a", "bb", "ccc", "dddd"} {
+			doc, err := bson.Marshal(bson.D{{"v", value}})
+			So(err, ShouldBeNil)
+			docs = append(docs, doc)
+			input.Write(doc)
+		}
+		out := &bytes.Buffer{}
+		opts := &BSONDumpOptions{NumDecodingWorkers: 1}
+		bd := BSONDump{
+			ToolOptions:     &options.ToolOptions{},
+			BSONDumpOptions: opts,
+			Out:             WriteNopCloser{out},
+			BSONSource:      db.NewBSONSource(ioutil.NopCloser(input)),
+		}
+
+		Convey("--type=offsets should write the index, offset and length of each document", func() {
+			numFound, err := bd.Offsets()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 4)
+			So(out.String(), ShouldEqual, "0\t0\t14\n1\t14\t15\n2\t29\t16\n3\t45\t17\n")
+		})
+
+		Convey("--skipDocs and --limitDocs should select documents by index", func() {
+			opts.SkipDocs = 1
+			opts.LimitDocs = 2
+			numFound, err := bd.JSON()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 2)
+			So(out.String(), ShouldEqual, "{\"v\":\"bb\"}\n{\"v\":\"ccc\"}\n")
+		})
+
+		Convey("--type=raw should extract documents unchanged", func() {
+			opts.SkipDocs = 2
+			opts.LimitDocs = 1
+			numFound, err := bd.Raw()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 1)
+			So(out.Bytes(), ShouldResemble, docs[2])
+		})
+
+		Convey("offsets should account for corrupt data skipped with --objcheck-recover", func() {
+			corrupt := &bytes.Buffer{}
+			corrupt.Write(docs[0])
+			corrupt.Write([]byte{0xff, 0xff, 0xff})
+			corrupt.Write(docs[1])
+			bd.BSONSource = db.NewBSONSource(ioutil.NopCloser(corrupt))
+			opts.ObjCheckRecover = true
+			opts.SkipDocs = 1
+			numFound, err := bd.Offsets()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 1)
+			So(out.String(), ShouldEqual, "1\t17\t15\n")
+		})
+	})
+}
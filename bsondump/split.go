@@ -0,0 +1,110 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+// ValidateSplitOptions checks --splitDocs and --splitSize, which split JSON
+// output into numbered files.
+func (bdo *BSONDumpOptions) ValidateSplitOptions() error {
+	if bdo.SplitDocs == 0 && bdo.SplitSize == "" {
+		return nil
+	}
+	if bdo.Type != "" && bdo.Type != "json" {
+		return fmt.Errorf("--splitDocs and --splitSize can only be used with --type=json")
+	}
+	if bdo.OutFileName == "" {
+		return fmt.Errorf("--splitDocs and --splitSize need --outFile to name the output files after")
+	}
+	if bdo.SplitDocs < 0 {
+		return fmt.Errorf("--splitDocs cannot be negative")
+	}
+	if bdo.SplitSize != "" {
+		size, err := text.ParseByteAmount(bdo.SplitSize)
+		if err != nil {
+			return fmt.Errorf("invalid --splitSize: %v", err)
+		}
+		if size == 0 {
+			return fmt.Errorf("--splitSize must be more than 0 bytes")
+		}
+		bdo.splitBytes = size
+	}
+	return nil
+}
+
+// splitFileName returns the name of the numbered output file, which has the
+// number of the file before the extension of --outFile, e.g. "out.0003.json".
+func splitFileName(outFile string, number int) string {
+	ext := filepath.Ext(outFile)
+	return fmt.Sprintf("%v.%04d%v", outFile[:len(outFile)-len(ext)], number, ext)
+}
+
+// splitWriter writes documents to numbered files, moving on to the next file
+// once the current one holds maxDocs documents, or once the next document
+// would take it past maxBytes. Each call to Write must be one whole document,
+// so that documents are never split across files. A document larger than
+// maxBytes gets a file of its own.
+type splitWriter struct {
+	outFile  string
+	maxDocs  int64
+	maxBytes int64
+
+	file   io.WriteCloser
+	number int
+	docs   int64
+	bytes  int64
+}
+
+func newSplitWriter(outFile string, maxDocs, maxBytes int64) *splitWriter {
+	return &splitWriter{outFile: outFile, maxDocs: maxDocs, maxBytes: maxBytes, number: -1}
+}
+
+func (w *splitWriter) full(next int) bool {
+	if w.maxDocs > 0 && w.docs >= w.maxDocs {
+		return true
+	}
+	return w.maxBytes > 0 && w.docs > 0 && w.bytes+int64(next) > w.maxBytes
+}
+
+func (w *splitWriter) Write(p []byte) (int, error) {
+	if w.file == nil || w.full(len(p)) {
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+		w.number++
+		name := splitFileName(w.outFile, w.number)
+		file, err := os.Create(util.ToUniversalPath(name))
+		if err != nil {
+			return 0, err
+		}
+		log.Logvf(log.Info, "writing to %v", name)
+		w.file, w.docs, w.bytes = file, 0, 0
+	}
+	n, err := w.file.Write(p)
+	w.docs++
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Close closes the current file.
+func (w *splitWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
@@ -0,0 +1,95 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestSplitOutput(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a stream of documents and an output directory", t, func() {
+		input := &bytes.Buffer{}
+		for i := 0; i < 5; i++ {
+			doc, err := bson.Marshal(bson.D{{"n", i}})
+			So(err, ShouldBeNil)
+			input.Write(doc)
+		}
+		dir, err := ioutil.TempDir("", "bsondump_split")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		opts := &BSONDumpOptions{NumDecodingWorkers: 1, OutFileName: filepath.Join(dir, "out.json")}
+
+		dump := func() []string {
+			So(opts.ValidateSplitOptions(), ShouldBeNil)
+			out, err := opts.GetWriter()
+			So(err, ShouldBeNil)
+			bd := BSONDump{
+				ToolOptions:     &options.ToolOptions{},
+				BSONDumpOptions: opts,
+				Out:             out,
+				BSONSource:      db.NewBSONSource(ioutil.NopCloser(input)),
+			}
+			numFound, err := bd.JSON()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 5)
+			So(out.Close(), ShouldBeNil)
+
+			var files []string
+			for i := 0; ; i++ {
+				contents, err := ioutil.ReadFile(filepath.Join(dir, fmt.Sprintf("out.%04d.json", i)))
+				if os.IsNotExist(err) {
+					return files
+				}
+				So(err, ShouldBeNil)
+				files = append(files, string(contents))
+			}
+		}
+
+		Convey("--splitDocs should write that many documents to each file", func() {
+			opts.SplitDocs = 2
+			So(dump(), ShouldResemble, []string{
+				"{\"n\":0}\n{\"n\":1}\n",
+				"{\"n\":2}\n{\"n\":3}\n",
+				"{\"n\":4}\n",
+			})
+		})
+
+		Convey("--splitSize should keep files within the size but not split documents", func() {
+			opts.SplitSize = "20"
+			So(dump(), ShouldResemble, []string{
+				"{\"n\":0}\n{\"n\":1}\n",
+				"{\"n\":2}\n{\"n\":3}\n",
+				"{\"n\":4}\n",
+			})
+		})
+
+		Convey("splitting should need --outFile and JSON output", func() {
+			opts.SplitDocs = 2
+			opts.Type = Stats
+			So(opts.ValidateSplitOptions(), ShouldNotBeNil)
+			opts.Type = "json"
+			opts.OutFileName = ""
+			So(opts.ValidateSplitOptions(), ShouldNotBeNil)
+			opts.OutFileName = "out.json"
+			opts.SplitSize = "0KB"
+			So(opts.ValidateSplitOptions(), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,301 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Stats is the output type that reports on the shape of the documents.
+const Stats = "stats"
+
+// ArrayElementPath is appended to the path of an array to name its elements
+// in the stats report, e.g. "tags.[]".
+const ArrayElementPath = "[]"
+
+// sizeSampleSize is the number of document sizes kept to compute
+// percentiles from; past it, they are estimated from a uniform sample.
+const sizeSampleSize = 100000
+
+// cardinalityPrecision is the number of bits of each hash that pick a
+// register of a cardinality estimate, which has 2^cardinalityPrecision
+// registers and a standard error of about 1.04/sqrt(2^cardinalityPrecision).
+const cardinalityPrecision = 10
+
+// cardinality estimates the number of distinct values added to it with
+// HyperLogLog, in a fixed amount of memory.
+type cardinality struct {
+	registers [1 << cardinalityPrecision]uint8
+}
+
+func (c *cardinality) add(value bson.Raw) {
+	hash := fnv.New64a()
+	hash.Write([]byte{value.Kind})
+	hash.Write(value.Data)
+	// FNV alone spreads short values poorly over the high bits that pick
+	// the register, so mix them as MurmurHash3's finalizer does
+	sum := hash.Sum64()
+	sum ^= sum >> 33
+	sum *= 0xff51afd7ed558ccd
+	sum ^= sum >> 33
+	sum *= 0xc4ceb9fe1a85ec53
+	sum ^= sum >> 33
+	register := sum >> (64 - cardinalityPrecision)
+	rank := uint8(bits.LeadingZeros64(sum<<cardinalityPrecision|1<<(cardinalityPrecision-1))) + 1
+	if rank > c.registers[register] {
+		c.registers[register] = rank
+	}
+}
+
+func (c *cardinality) estimate() int64 {
+	m := float64(len(c.registers))
+	sum := 0.0
+	zeros := 0
+	for _, rank := range c.registers {
+		sum += math.Pow(2, -float64(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// small counts are estimated better from the registers still unset
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(estimate + 0.5)
+}
+
+// fieldStats sums up the values found at one field path.
+type fieldStats struct {
+	path     string
+	count    int64
+	types    map[byte]int64
+	minSize  int
+	maxSize  int
+	sumSize  int64
+	distinct cardinality
+}
+
+func (f *fieldStats) add(value bson.Raw) {
+	size := len(value.Data)
+	if f.count == 0 || size < f.minSize {
+		f.minSize = size
+	}
+	if size > f.maxSize {
+		f.maxSize = size
+	}
+	f.count++
+	f.sumSize += int64(size)
+	f.types[value.Kind]++
+	f.distinct.add(value)
+}
+
+// statsCollector gathers the statistics of a stream of documents.
+type statsCollector struct {
+	documents int64
+	totalSize int64
+	sizes     []int
+	random    *rand.Rand
+	// fields in the order they were first found
+	fields []*fieldStats
+	byPath map[string]*fieldStats
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{random: rand.New(rand.NewSource(1)), byPath: map[string]*fieldStats{}}
+}
+
+// addDocument adds a top-level document to the statistics.
+func (s *statsCollector) addDocument(data []byte) error {
+	s.documents++
+	s.totalSize += int64(len(data))
+	// keep a uniform sample of the sizes once there are too many to keep
+	if len(s.sizes) < sizeSampleSize {
+		s.sizes = append(s.sizes, len(data))
+	} else if i := s.random.Int63n(s.documents); i < sizeSampleSize {
+		s.sizes[i] = len(data)
+	}
+	return s.addFields("", data)
+}
+
+func (s *statsCollector) addFields(prefix string, data []byte) error {
+	var elems bson.RawD
+	if err := bson.Unmarshal(data, &elems); err != nil {
+		return err
+	}
+	for _, elem := range elems {
+		path := elem.Name
+		if prefix != "" {
+			path = prefix + "." + elem.Name
+		}
+		if err := s.addValue(path, elem.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *statsCollector) addValue(path string, value bson.Raw) error {
+	field, ok := s.byPath[path]
+	if !ok {
+		field = &fieldStats{path: path, types: map[byte]int64{}}
+		s.byPath[path] = field
+		s.fields = append(s.fields, field)
+	}
+	field.add(value)
+
+	switch value.Kind {
+	case 0x03:
+		return s.addFields(path, value.Data)
+	case 0x04:
+		var elems bson.RawD
+		if err := bson.Unmarshal(value.Data, &elems); err != nil {
+			return err
+		}
+		for _, elem := range elems {
+			if err := s.addValue(path+"."+ArrayElementPath, elem.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// percentile returns the given percentile of the sorted sizes.
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// typeName returns the $type alias of a BSON type.
+func typeName(kind byte) string {
+	for name, code := range bsonTypes {
+		if byte(code) == kind {
+			return name
+		}
+	}
+	if kind == 0x0F {
+		return "javascriptWithScope"
+	}
+	return fmt.Sprintf("type %v", kind)
+}
+
+// typeDistribution describes how many values of each type were found, most
+// common first.
+func (f *fieldStats) typeDistribution() string {
+	kinds := make([]byte, 0, len(f.types))
+	for kind := range f.types {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		if f.types[kinds[i]] != f.types[kinds[j]] {
+			return f.types[kinds[i]] > f.types[kinds[j]]
+		}
+		return kinds[i] < kinds[j]
+	})
+	parts := make([]string, 0, len(kinds))
+	for _, kind := range kinds {
+		parts = append(parts, fmt.Sprintf("%v:%v", typeName(kind), f.types[kind]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// write writes the report.
+func (s *statsCollector) write(out io.Writer) {
+	sorted := append([]int{}, s.sizes...)
+	sort.Ints(sorted)
+	fmt.Fprintf(out, "documents: %v\n", s.documents)
+	fmt.Fprintf(out, "total size: %v\n", text.FormatByteAmount(s.totalSize))
+	if s.documents > 0 {
+		fmt.Fprintf(out, "document size: min %v, p50 %v, p90 %v, p99 %v, max %v, avg %v\n",
+			sorted[0], percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99),
+			sorted[len(sorted)-1], s.totalSize/s.documents)
+	}
+	if s.documents > sizeSampleSize {
+		fmt.Fprintf(out, "(document size percentiles estimated from a sample of %v documents)\n", sizeSampleSize)
+	}
+	fmt.Fprintln(out)
+
+	grid := &text.GridWriter{ColumnPadding: 2}
+	grid.WriteCells("field", "count", "types", "min size", "max size", "avg size", "~distinct")
+	grid.EndRow()
+	for _, field := range s.fields {
+		grid.WriteCells(
+			field.path,
+			fmt.Sprint(field.count),
+			field.typeDistribution(),
+			fmt.Sprint(field.minSize),
+			fmt.Sprint(field.maxSize),
+			fmt.Sprintf("%.1f", float64(field.sumSize)/float64(field.count)),
+			fmt.Sprint(field.distinct.estimate()),
+		)
+		grid.EndRow()
+	}
+	grid.Flush(out)
+}
+
+// Stats iterates through the BSON file and writes a report of the documents
+// it finds: the distribution of their sizes and, for each field path, how
+// often it occurs, the types and sizes of its values and about how many
+// distinct values it has. Value sizes are in bytes, as stored in BSON.
+// It returns the number of documents processed and a non-nil error if one is
+// encountered before the end of the file is reached.
+func (bd *BSONDump) Stats() (int, error) {
+	numFound := 0
+
+	if bd.BSONSource == nil {
+		panic("Tried to call Stats() before opening file")
+	}
+	if err := bd.initFilter(); err != nil {
+		return 0, err
+	}
+
+	stats := newStatsCollector()
+	source := bd.source()
+	for {
+		data := source.LoadNext()
+		if data == nil {
+			break
+		}
+		matched, err := bd.matches(data)
+		if err == nil && !matched {
+			continue
+		}
+		if err == nil {
+			err = stats.addDocument(data)
+		}
+		if err != nil {
+			log.Logvf(log.Always, "unable to read document %v: %v", numFound+1, err)
+			if bd.BSONDumpOptions.ObjCheck {
+				return numFound, err
+			}
+		}
+		numFound++
+	}
+	if err := source.Err(); err != nil {
+		return numFound, err
+	}
+	stats.write(bd.Out)
+	return numFound, nil
+}
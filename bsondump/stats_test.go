@@ -0,0 +1,80 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestStats(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Cardinality estimates should be close to the number of distinct values", t, func() {
+		var empty cardinality
+		So(empty.estimate(), ShouldEqual, 0)
+		for _, distinct := range []int{10, 1000, 50000} {
+			var c cardinality
+			for i := 0; i < distinct*2; i++ {
+				c.add(bson.Raw{Kind: 0x02, Data: []byte(fmt.Sprint(i % distinct))})
+			}
+			estimate := float64(c.estimate())
+			So(estimate, ShouldBeBetweenOrEqual, float64(distinct)*0.9, float64(distinct)*1.1)
+		}
+	})
+
+	Convey("With a stream of documents", t, func() {
+		input := &bytes.Buffer{}
+		for i := 0; i < 10; i++ {
+			doc := bson.D{{"n", i}, {"tags", []string{"a", "b"}}}
+			if i%2 == 0 {
+				doc = append(doc, bson.DocElem{"owner", bson.D{{"name", "ops"}}})
+			} else {
+				doc = append(doc, bson.DocElem{"owner", nil})
+			}
+			data, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			input.Write(data)
+		}
+		out := &bytes.Buffer{}
+		bd := BSONDump{
+			ToolOptions:     &options.ToolOptions{},
+			BSONDumpOptions: &BSONDumpOptions{Type: Stats},
+			Out:             WriteNopCloser{out},
+			BSONSource:      db.NewBSONSource(ioutil.NopCloser(input)),
+		}
+
+		Convey("--type=stats should report on each field path", func() {
+			numFound, err := bd.Stats()
+			So(err, ShouldBeNil)
+			So(numFound, ShouldEqual, 10)
+
+			report := out.String()
+			So(report, ShouldContainSubstring, "documents: 10\n")
+			lines := map[string][]string{}
+			for _, line := range strings.Split(report, "\n") {
+				if fields := strings.Fields(line); len(fields) > 0 {
+					lines[fields[0]] = fields
+				}
+			}
+			So(lines["n"], ShouldResemble, []string{"n", "10", "int:10", "4", "4", "4.0", "10"})
+			So(lines["tags.[]"][1:3], ShouldResemble, []string{"20", "string:20"})
+			So(lines["tags.[]"][6], ShouldEqual, "2")
+			So(lines["owner"][1:4], ShouldResemble, []string{"10", "object:5", "null:5"})
+			So(lines["owner.name"][1], ShouldEqual, "5")
+		})
+	})
+}
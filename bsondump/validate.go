@@ -0,0 +1,325 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/mongodb/mongo-tools/common/db"
+)
+
+// ValidateStructureOptions checks that --validate isn't used with options
+// that only apply to the output of documents.
+func (bdo *BSONDumpOptions) ValidateStructureOptions() error {
+	if !bdo.ValidateStructure {
+		return nil
+	}
+	switch {
+	case bdo.Type != "" && bdo.Type != "json":
+		return fmt.Errorf("--validate cannot be used with --type")
+	case bdo.Diff || bdo.Reverse:
+		return fmt.Errorf("--validate cannot be used with --diff or --reverse")
+	case bdo.Filter != "" || bdo.Fields != "":
+		return fmt.Errorf("--validate cannot be used with --filter or --fields")
+	case bdo.SplitDocs != 0 || bdo.SplitSize != "":
+		return fmt.Errorf("--validate cannot be used with --splitDocs or --splitSize")
+	case bdo.SkipDocs != 0 || bdo.LimitDocs != 0 || bdo.ObjCheckRecover:
+		return fmt.Errorf("--validate cannot be used with --skipDocs, --limitDocs or --objcheck-recover")
+	}
+	return nil
+}
+
+// violation is a structural error in a BSON file.
+type violation struct {
+	// the offset in the file of the bytes in error
+	Offset int64
+	// the index of the document holding them, counting from 0
+	Document int
+	Reason   string
+}
+
+func (v violation) String() string {
+	return fmt.Sprintf("offset %v (document %v): %v", v.Offset, v.Document, v.Reason)
+}
+
+// structureChecker walks the elements of one document, recording every
+// violation it finds. A violation that leaves the extent of the rest of the
+// document unknown, such as a bad length, ends the walk of the document or
+// string holding it.
+type structureChecker struct {
+	data []byte
+	// the offset of data in the file
+	base       int64
+	index      int
+	violations []violation
+}
+
+func (c *structureChecker) report(at int, format string, args ...interface{}) {
+	c.violations = append(c.violations, violation{
+		Offset:   c.base + int64(at),
+		Document: c.index,
+		Reason:   fmt.Sprintf(format, args...),
+	})
+}
+
+// int32At returns the little-endian int32 at i, or false if it doesn't fit
+// before end.
+func (c *structureChecker) int32At(i, end int) (int32, bool) {
+	if i+4 > end {
+		return 0, false
+	}
+	return int32(binary.LittleEndian.Uint32(c.data[i:])), true
+}
+
+// cstring returns the index just past the null byte ending the cstring at
+// i, or false if there is none before end.
+func (c *structureChecker) cstring(i, end int, what string) (int, bool) {
+	for j := i; j < end; j++ {
+		if c.data[j] == 0 {
+			if !utf8.Valid(c.data[i:j]) {
+				c.report(i, "%v is not valid UTF-8", what)
+			}
+			return j + 1, true
+		}
+	}
+	c.report(i, "%v has no terminating null byte", what)
+	return end, false
+}
+
+// str checks the length-prefixed string at i and returns the index just
+// past it, or false if its length is invalid.
+func (c *structureChecker) str(i, end int, path string) (int, bool) {
+	size, ok := c.int32At(i, end)
+	if !ok {
+		c.report(i, "string length of field '%v' runs past the end of its document", path)
+		return end, false
+	}
+	if size < 1 || int64(i)+4+int64(size) > int64(end) {
+		c.report(i, "invalid string length %v of field '%v'", size, path)
+		return end, false
+	}
+	last := i + 4 + int(size) - 1
+	if c.data[last] != 0 {
+		c.report(last, "string of field '%v' has no terminating null byte", path)
+	}
+	if !utf8.Valid(c.data[i+4 : last]) {
+		c.report(i+4, "string of field '%v' is not valid UTF-8", path)
+	}
+	return last + 1, true
+}
+
+// document checks the embedded document, or array, at i and returns the
+// index just past it, or false if its length is invalid.
+func (c *structureChecker) document(i, end int, path string, array bool) (int, bool) {
+	size, ok := c.int32At(i, end)
+	if !ok || size < 5 || int64(i)+int64(size) > int64(end) {
+		if path == "" {
+			c.report(i, "invalid document length %v", size)
+		} else {
+			c.report(i, "invalid length %v of field '%v'", size, path)
+		}
+		return end, false
+	}
+	docEnd := i + int(size)
+	if c.data[docEnd-1] != 0 {
+		if path == "" {
+			c.report(docEnd-1, "document has no terminating null byte")
+		} else {
+			c.report(docEnd-1, "document of field '%v' has no terminating null byte", path)
+		}
+	}
+	c.elements(i+4, docEnd-1, path, array)
+	return docEnd, true
+}
+
+// elements checks the elements from i up to end, the index of the null byte
+// ending their document.
+func (c *structureChecker) elements(i, end int, prefix string, array bool) {
+	for index := 0; i < end; index++ {
+		kind := c.data[i]
+		if kind == 0 {
+			c.report(i, "null byte where an element was expected, before the end given by the length of its document")
+			return
+		}
+		if !validElementType(kind) {
+			c.report(i, "invalid element type 0x%02x", kind)
+			return
+		}
+		nameEnd, ok := c.cstring(i+1, end, "field name")
+		if !ok {
+			return
+		}
+		name := string(c.data[i+1 : nameEnd-1])
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if array && name != strconv.Itoa(index) {
+			c.report(i+1, "array '%v' has key '%v' where '%v' was expected", prefix, name, index)
+		}
+		if i, ok = c.value(kind, nameEnd, end, path); !ok {
+			return
+		}
+		if i > end {
+			c.report(end, "value of field '%v' runs past the end of its document", path)
+			return
+		}
+	}
+}
+
+// fixedSizes are the sizes of the values of fixed size types.
+var fixedSizes = map[byte]int{
+	0x01: 8, 0x06: 0, 0x07: 12, 0x08: 1, 0x09: 8, 0x0A: 0,
+	0x10: 4, 0x11: 8, 0x12: 8, 0x13: 16, 0x7F: 0, 0xFF: 0,
+}
+
+// value checks the value of the given type at i and returns the index just
+// past it, or false if its extent is unknown.
+func (c *structureChecker) value(kind byte, i, end int, path string) (int, bool) {
+	if size, ok := fixedSizes[kind]; ok {
+		if kind == 0x08 && i < end && c.data[i] > 1 {
+			c.report(i, "boolean field '%v' has value %v, not 0 or 1", path, c.data[i])
+		}
+		return i + size, true
+	}
+	switch kind {
+	case 0x02, 0x0D, 0x0E:
+		return c.str(i, end, path)
+	case 0x03, 0x04:
+		return c.document(i, end, path, kind == 0x04)
+	case 0x05:
+		size, ok := c.int32At(i, end)
+		if !ok || size < 0 || int64(i)+5+int64(size) > int64(end) {
+			c.report(i, "invalid binary length %v of field '%v'", size, path)
+			return end, false
+		}
+		if c.data[i+4] == 0x02 {
+			inner, ok := c.int32At(i+5, i+5+int(size))
+			if !ok || inner != size-4 {
+				c.report(i+5, "old binary field '%v' has inner length %v, not %v", path, inner, size-4)
+			}
+		}
+		return i + 5 + int(size), true
+	case 0x0B:
+		next, ok := c.cstring(i, end, fmt.Sprintf("regular expression of field '%v'", path))
+		if !ok {
+			return end, false
+		}
+		return c.cstring(next, end, fmt.Sprintf("regular expression options of field '%v'", path))
+	case 0x0C:
+		next, ok := c.str(i, end, path)
+		if !ok {
+			return end, false
+		}
+		return next + 12, true
+	case 0x0F:
+		size, ok := c.int32At(i, end)
+		if !ok || size < 14 || int64(i)+int64(size) > int64(end) {
+			c.report(i, "invalid code with scope length %v of field '%v'", size, path)
+			return end, false
+		}
+		scopeEnd := i + int(size)
+		next, ok := c.str(i+4, scopeEnd, path)
+		if !ok {
+			return scopeEnd, true
+		}
+		if next, ok = c.document(next, scopeEnd, path+".$scope", false); ok && next != scopeEnd {
+			c.report(i, "code with scope length %v of field '%v' doesn't match its contents", size, path)
+		}
+		return scopeEnd, true
+	}
+	// the types valid for an element that are left are deprecated ones
+	// without a fixed size, and there are none
+	return end, false
+}
+
+// ValidateStructure checks the structure of every document in the BSON file
+// without converting it: the lengths of documents, strings and binary data,
+// the element types, the null bytes ending documents, strings and field
+// names, the UTF-8 of strings and field names, and the keys of arrays. It
+// writes a line with the offset and reason of every violation, followed by
+// a summary. It stops at a document length that is invalid, since the next
+// document can't be found from it; --objcheck-recover can skip past it.
+// It returns the number of documents checked, and a non-nil error if the
+// file can't be read.
+func (bd *BSONDump) ValidateStructure() (int, error) {
+	if bd.BSONSource == nil {
+		panic("Tried to call ValidateStructure() before opening file")
+	}
+
+	reader := bufio.NewReader(bd.BSONSource.Stream)
+	var offset int64
+	numFound, violations := 0, 0
+	write := func(v violation) error {
+		violations++
+		_, err := fmt.Fprintln(bd.Out, v)
+		return err
+	}
+	for {
+		header, err := reader.Peek(4)
+		if len(header) == 0 && err == io.EOF {
+			break
+		}
+		if len(header) < 4 {
+			if err != io.EOF {
+				return numFound, err
+			}
+			if err = write(violation{offset, numFound, fmt.Sprintf("%v trailing byte(s), too few to hold a document", len(header))}); err != nil {
+				return numFound, err
+			}
+			break
+		}
+		size := int32(binary.LittleEndian.Uint32(header))
+		if size < 5 || size > db.MaxBSONSize {
+			if err = write(violation{offset, numFound, fmt.Sprintf("invalid document length %v, checking stopped", size)}); err != nil {
+				return numFound, err
+			}
+			break
+		}
+		data := make([]byte, size)
+		n, err := io.ReadFull(reader, data)
+		if err == io.ErrUnexpectedEOF {
+			if err = write(violation{offset, numFound, fmt.Sprintf("document truncated: its length is %v but only %v byte(s) remain", size, n)}); err != nil {
+				return numFound, err
+			}
+			numFound++
+			break
+		}
+		if err != nil {
+			return numFound, err
+		}
+
+		checker := &structureChecker{data: data, base: offset, index: numFound}
+		checker.document(0, len(data), "", false)
+		for _, v := range checker.violations {
+			if err = write(v); err != nil {
+				return numFound, err
+			}
+		}
+		offset += int64(size)
+		numFound++
+	}
+
+	bd.violations += violations
+	result := "PASS"
+	if violations > 0 {
+		result = "FAIL"
+	}
+	_, err := fmt.Fprintf(bd.Out, "%v: %v document(s) checked, %v violation(s)\n", result, numFound, violations)
+	return numFound, err
+}
+
+// Violations returns the number of structural violations ValidateStructure
+// found.
+func (bd *BSONDump) Violations() int {
+	return bd.violations
+}
@@ -0,0 +1,103 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsondump
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestValidateStructure(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With documents of every kind of value", t, func() {
+		valid, err := bson.Marshal(bson.D{
+			{"s", "str"}, {"d", bson.D{{"x", 1.5}}}, {"a", []interface{}{int64(1), true, nil}},
+			{"b", []byte("bin")}, {"r", bson.RegEx{"^a", "i"}}, {"j", bson.JavaScript{"f()", bson.M{"v": 1}}},
+			{"o", bson.NewObjectId()}, {"m", bson.MinKey},
+		})
+		So(err, ShouldBeNil)
+
+		check := func(input []byte) (string, int) {
+			out := &bytes.Buffer{}
+			bd := BSONDump{
+				ToolOptions:     &options.ToolOptions{},
+				BSONDumpOptions: &BSONDumpOptions{ValidateStructure: true},
+				Out:             WriteNopCloser{out},
+				BSONSource:      db.NewBSONSource(ioutil.NopCloser(bytes.NewReader(input))),
+			}
+			_, err := bd.ValidateStructure()
+			So(err, ShouldBeNil)
+			return out.String(), bd.Violations()
+		}
+		// corrupt returns a copy of the valid document with the bytes of old
+		// after the given field name replaced
+		corrupt := func(field string, old, replacement []byte) []byte {
+			data := append([]byte{}, valid...)
+			at := bytes.Index(data, append([]byte(field), 0)) + len(field) + 1
+			So(bytes.HasPrefix(data[at:], old), ShouldBeTrue)
+			copy(data[at:], replacement)
+			return data
+		}
+
+		Convey("valid documents should pass", func() {
+			out, violations := check(append(append([]byte{}, valid...), valid...))
+			So(violations, ShouldEqual, 0)
+			So(out, ShouldEqual, "PASS: 2 document(s) checked, 0 violation(s)\n")
+		})
+
+		Convey("invalid UTF-8 and booleans should be reported and checking should go on", func() {
+			data := corrupt("s", []byte{4, 0, 0, 0, 's'}, []byte{4, 0, 0, 0, 0xff})
+			data = append(data, corrupt("1", []byte{1}, []byte{7})...)
+			out, violations := check(data)
+			So(violations, ShouldEqual, 2)
+			lines := strings.Split(strings.TrimSpace(out), "\n")
+			So(lines, ShouldHaveLength, 3)
+			So(lines[0], ShouldEqual, "offset 11 (document 0): string of field 's' is not valid UTF-8")
+			So(lines[1], ShouldEndWith, "(document 1): boolean field 'a.1' has value 7, not 0 or 1")
+			So(lines[2], ShouldEqual, "FAIL: 2 document(s) checked, 2 violation(s)")
+		})
+
+		Convey("bad nested lengths and types should be reported at their offset", func() {
+			out, violations := check(corrupt("d", []byte{16, 0, 0, 0}, []byte{0x0f, 0x27, 0, 0}))
+			So(violations, ShouldEqual, 1)
+			So(out, ShouldStartWith, "offset 18 (document 0): invalid length 9999 of field 'd'\n")
+
+			// the type of field d.x
+			data := append([]byte{}, valid...)
+			So(data[22], ShouldEqual, 0x01)
+			data[22] = 0x42
+			out, violations = check(data)
+			So(violations, ShouldEqual, 1)
+			So(out, ShouldStartWith, "offset 22 (document 0): invalid element type 0x42\n")
+		})
+
+		Convey("a missing trailing null and a truncated document should be reported", func() {
+			data := append([]byte{}, valid...)
+			data[len(data)-1] = 1
+			data = append(data, valid[:10]...)
+			out, violations := check(data)
+			So(violations, ShouldEqual, 2)
+			So(out, ShouldContainSubstring, "document has no terminating null byte")
+			So(out, ShouldContainSubstring, "document truncated")
+		})
+
+		Convey("an invalid document length should stop checking", func() {
+			out, violations := check(append([]byte{1, 0, 0, 0}, valid...))
+			So(violations, ShouldEqual, 1)
+			So(out, ShouldStartWith, "offset 0 (document 0): invalid document length 1, checking stopped\n")
+		})
+	})
+}
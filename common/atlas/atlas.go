@@ -0,0 +1,196 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package atlas looks up clusters with the Atlas Admin API, so the tools can
+// be given a project and a cluster name instead of a connection string.
+package atlas
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/fips"
+)
+
+// DefaultBaseURL is the URL of the Atlas Admin API.
+const DefaultBaseURL = "https://cloud.mongodb.com/api/atlas/v1.0"
+
+// projectID matches the IDs of projects, which can be given instead of their
+// names.
+var projectID = regexp.MustCompile(`^[0-9a-f]{24}$`)
+
+// Client calls the Atlas Admin API with a programmatic API key.
+type Client struct {
+	BaseURL    string
+	PublicKey  string
+	PrivateKey string
+
+	client *http.Client
+}
+
+// NewClient returns a client of the API at baseURL, or DefaultBaseURL if it
+// is empty, authenticating with the API key.
+func NewClient(baseURL, publicKey, privateKey string) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:    baseURL,
+		PublicKey:  publicKey,
+		PrivateKey: privateKey,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Cluster is an Atlas cluster, as the API describes it.
+type Cluster struct {
+	Name              string            `json:"name"`
+	ClusterType       string            `json:"clusterType"`
+	StateName         string            `json:"stateName"`
+	Paused            bool              `json:"paused"`
+	MongoDBVersion    string            `json:"mongoDBVersion"`
+	ConnectionStrings ConnectionStrings `json:"connectionStrings"`
+}
+
+// ConnectionStrings are the connection strings of a cluster: the standard
+// ones, and the private ones for networks peered with the cluster's.
+type ConnectionStrings struct {
+	Standard    string `json:"standard"`
+	StandardSrv string `json:"standardSrv"`
+	Private     string `json:"private"`
+	PrivateSrv  string `json:"privateSrv"`
+}
+
+// ConnectionString returns the mongodb:// connection string of the cluster,
+// which lists its hosts and its replica set, or the private one.
+func (c *Cluster) ConnectionString(private bool) (string, error) {
+	cs := c.ConnectionStrings.Standard
+	if private {
+		if c.ConnectionStrings.Private == "" {
+			return "", fmt.Errorf("cluster %v has no private connection string, "+
+				"as no network is peered with it", c.Name)
+		}
+		cs = c.ConnectionStrings.Private
+	}
+	if cs == "" {
+		return "", fmt.Errorf("cluster %v has no connection string yet", c.Name)
+	}
+	return cs, nil
+}
+
+// Sharded returns whether the cluster is sharded, with the tools connecting
+// to its mongos routers.
+func (c *Cluster) Sharded() bool {
+	return c.ClusterType == "SHARDED" || c.ClusterType == "GEOSHARDED"
+}
+
+// project is the part of a project the API returns that is needed.
+type project struct {
+	ID string `json:"id"`
+}
+
+// apiError is the body of the API's error responses.
+type apiError struct {
+	Detail    string `json:"detail"`
+	ErrorCode string `json:"errorCode"`
+}
+
+// Cluster returns the cluster with the given name in the project, given by
+// its ID or its name. It returns an error if the cluster is paused, or is
+// being created or deleted.
+func (c *Client) Cluster(projectName, clusterName string) (*Cluster, error) {
+	groupID := projectName
+	if !projectID.MatchString(projectName) {
+		p := project{}
+		if err := c.get("/groups/byName/"+url.PathEscape(projectName), &p); err != nil {
+			return nil, fmt.Errorf("error finding Atlas project %v: %v", projectName, err)
+		}
+		groupID = p.ID
+	}
+	cluster := &Cluster{}
+	err := c.get("/groups/"+groupID+"/clusters/"+url.PathEscape(clusterName), cluster)
+	if err != nil {
+		return nil, fmt.Errorf("error finding Atlas cluster %v: %v", clusterName, err)
+	}
+	switch {
+	case cluster.Paused:
+		return nil, fmt.Errorf("Atlas cluster %v is paused", clusterName)
+	case cluster.StateName == "CREATING", cluster.StateName == "DELETING", cluster.StateName == "DELETED":
+		return nil, fmt.Errorf("Atlas cluster %v can't be connected to while %v", clusterName, cluster.StateName)
+	}
+	return cluster, nil
+}
+
+// get gets the resource at the path of the API into result, answering the
+// digest challenge of the API.
+func (c *Client) get(path string, result interface{}) error {
+	// API keys are checked with HTTP digest authentication, which hashes
+	// them with MD5
+	if err := fips.Forbid("MD5", "give the connection string of the cluster with --uri instead"); err != nil {
+		return err
+	}
+	resp, err := c.do(path, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authorization, err := digestAuthorization(challenge, http.MethodGet, requestURI(c.BaseURL+path),
+			c.PublicKey, c.PrivateKey)
+		if err != nil {
+			return err
+		}
+		if resp, err = c.do(path, authorization); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (c *Client) do(path, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, c.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return c.client.Do(req)
+}
+
+// requestURI returns the path and query of a URL, which the digest is
+// computed over.
+func requestURI(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return u.RequestURI()
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	e := apiError{}
+	if json.Unmarshal(body, &e) == nil && e.Detail != "" {
+		return fmt.Errorf("%v (%v)", e.Detail, e.ErrorCode)
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("the API key was not accepted: %v", resp.Status)
+	}
+	return fmt.Errorf("unexpected response: %v", resp.Status)
+}
@@ -0,0 +1,122 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package atlas
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	testRealm = "MMS Public API"
+	testNonce = "nonce-1"
+)
+
+// api serves the clusters of a project named "prod", answering requests
+// not authenticated with the key "public:private" with a digest challenge.
+func api(clusters map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authenticated(r, "public", "private") {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Digest realm="%v", domain="", nonce="%v", algorithm=MD5, qop="auth", stale=false`, testRealm, testNonce))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/groups/byName/prod":
+			fmt.Fprint(w, `{"id": "5f1d7e8a9b0c1d2e3f4a5b6c", "name": "prod"}`)
+		case strings.HasPrefix(r.URL.Path, "/groups/5f1d7e8a9b0c1d2e3f4a5b6c/clusters/"):
+			cluster, ok := clusters[strings.TrimPrefix(r.URL.Path, "/groups/5f1d7e8a9b0c1d2e3f4a5b6c/clusters/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"detail": "No cluster named missing exists in group.", "errorCode": "CLUSTER_NOT_FOUND"}`)
+				return
+			}
+			fmt.Fprint(w, cluster)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func authenticated(r *http.Request, username, password string) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Digest ") {
+		return false
+	}
+	params := parseChallenge(strings.TrimPrefix(header, "Digest "))
+	ha1 := md5Hex(username + ":" + testRealm + ":" + password)
+	ha2 := md5Hex(r.Method + ":" + r.URL.RequestURI())
+	expected := md5Hex(strings.Join([]string{ha1, testNonce, params["nc"], params["cnonce"], "auth", ha2}, ":"))
+	return params["username"] == username && params["uri"] == r.URL.RequestURI() && params["response"] == expected
+}
+
+func TestCluster(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With the Atlas API serving a project's clusters", t, func() {
+		server := httptest.NewServer(api(map[string]string{
+			"Cluster0": `{"name": "Cluster0", "clusterType": "REPLICASET", "stateName": "IDLE", "mongoDBVersion": "4.4.1",
+				"connectionStrings": {"standard": "mongodb://a:27017,b:27017/?ssl=true&authSource=admin&replicaSet=atlas-x-shard-0"}}`,
+			"Paused": `{"name": "Paused", "paused": true}`,
+		}))
+		defer server.Close()
+
+		Convey("clusters should be found by the name of their project", func() {
+			cluster, err := NewClient(server.URL, "public", "private").Cluster("prod", "Cluster0")
+			So(err, ShouldBeNil)
+			So(cluster.Name, ShouldEqual, "Cluster0")
+			So(cluster.Sharded(), ShouldBeFalse)
+			cs, err := cluster.ConnectionString(false)
+			So(err, ShouldBeNil)
+			So(cs, ShouldStartWith, "mongodb://a:27017,b:27017/")
+
+			Convey("but have no private connection string without peering", func() {
+				_, err := cluster.ConnectionString(true)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("clusters should be found by the ID of their project", func() {
+			_, err := NewClient(server.URL, "public", "private").Cluster("5f1d7e8a9b0c1d2e3f4a5b6c", "Cluster0")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("paused clusters should not be returned", func() {
+			_, err := NewClient(server.URL, "public", "private").Cluster("prod", "Paused")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "paused")
+		})
+
+		Convey("errors of the API should be reported", func() {
+			_, err := NewClient(server.URL, "public", "private").Cluster("prod", "missing")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "CLUSTER_NOT_FOUND")
+		})
+
+		Convey("a wrong key should not be accepted", func() {
+			_, err := NewClient(server.URL, "public", "wrong").Cluster("prod", "Cluster0")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "API key was not accepted")
+		})
+	})
+}
+
+func TestParseChallenge(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Digest challenges should be parsed with quoted and bare values", t, func() {
+		So(parseChallenge(`realm="a, b", nonce="n", algorithm=MD5, qop="auth,auth-int", stale=false`), ShouldResemble,
+			map[string]string{"realm": "a, b", "nonce": "n", "algorithm": "MD5", "qop": "auth,auth-int", "stale": "false"})
+	})
+}
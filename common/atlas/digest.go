@@ -0,0 +1,102 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package atlas
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// digestAuthorization returns the Authorization header answering the HTTP
+// digest challenge of a WWW-Authenticate header (RFC 2617), for a request
+// with the given method and URI. Only the MD5 algorithm and the auth quality
+// of protection, which the API uses, are supported.
+func digestAuthorization(challenge, method, uri, username, password string) (string, error) {
+	if !strings.HasPrefix(challenge, "Digest ") {
+		return "", fmt.Errorf("the API key was not accepted: unexpected authentication challenge %q", challenge)
+	}
+	params := parseChallenge(strings.TrimPrefix(challenge, "Digest "))
+	if algorithm := params["algorithm"]; algorithm != "" && !strings.EqualFold(algorithm, "MD5") {
+		return "", fmt.Errorf("unsupported digest algorithm %v", algorithm)
+	}
+	qop := ""
+	for _, q := range strings.Split(params["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+
+	ha1 := md5Hex(username + ":" + params["realm"] + ":" + password)
+	ha2 := md5Hex(method + ":" + uri)
+	nc := "00000001"
+	cnonce, err := newCnonce()
+	if err != nil {
+		return "", err
+	}
+	response := md5Hex(ha1 + ":" + params["nonce"] + ":" + ha2)
+	if qop != "" {
+		response = md5Hex(strings.Join([]string{ha1, params["nonce"], nc, cnonce, qop, ha2}, ":"))
+	}
+
+	header := fmt.Sprintf(`Digest username="%v", realm="%v", nonce="%v", uri="%v", response="%v", algorithm=MD5`,
+		username, params["realm"], params["nonce"], uri, response)
+	if qop != "" {
+		header += fmt.Sprintf(`, qop=%v, nc=%v, cnonce="%v"`, qop, nc, cnonce)
+	}
+	if opaque := params["opaque"]; opaque != "" {
+		header += fmt.Sprintf(`, opaque="%v"`, opaque)
+	}
+	return header, nil
+}
+
+// parseChallenge returns the parameters of a digest challenge, a
+// comma-separated list of key=value pairs whose values may be quoted.
+func parseChallenge(challenge string) map[string]string {
+	params := map[string]string{}
+	for len(challenge) > 0 {
+		eq := strings.IndexByte(challenge, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(challenge[:eq]))
+		rest := strings.TrimSpace(challenge[eq+1:])
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			value, rest = rest[1:end+1], rest[end+1:]
+			if len(rest) > 0 {
+				rest = rest[1:]
+			}
+		} else if comma := strings.IndexByte(rest, ','); comma >= 0 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = strings.TrimSpace(value)
+		challenge = strings.TrimPrefix(strings.TrimSpace(rest), ",")
+	}
+	return params
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func newCnonce() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -17,6 +17,7 @@ import (
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -235,6 +236,116 @@ func ParseSpecialKeys(special interface{}) (interface{}, error) {
 			return bson.MinKey, nil
 		}
 
+		// the remaining types only exist in extended JSON v2
+
+		if jsonValue, ok := doc["$numberDouble"]; ok {
+			switch v := jsonValue.(type) {
+			case string:
+				// ParseFloat accepts the "Infinity", "-Infinity" and "NaN" forms
+				return strconv.ParseFloat(v, 64)
+			default:
+				return nil, errors.New("expected $numberDouble field to have string value")
+			}
+		}
+
+		if jsonValue, ok := doc["$symbol"]; ok {
+			switch v := jsonValue.(type) {
+			case string:
+				return bson.Symbol(v), nil
+			default:
+				return nil, errors.New("expected $symbol field to have string value")
+			}
+		}
+
+		if jsonValue, ok := doc["$binary"]; ok {
+			binDoc, ok := subdocumentAsMap(jsonValue)
+			if !ok {
+				return nil, errors.New("expected $binary key to have internal document")
+			}
+			data, ok := binDoc["base64"].(string)
+			if !ok {
+				return nil, errors.New("expected $binary to have string 'base64' field")
+			}
+			bytes, err := base64.StdEncoding.DecodeString(data)
+			if err != nil {
+				return nil, err
+			}
+			typ, ok := binDoc["subType"].(string)
+			if !ok {
+				return nil, errors.New("expected $binary to have string 'subType' field")
+			}
+			if len(typ) == 1 {
+				typ = "0" + typ
+			}
+			kind, err := hex.DecodeString(typ)
+			if err != nil {
+				return nil, err
+			} else if len(kind) != 1 {
+				return nil, errors.New("expected single byte (as hexadecimal string) for $binary 'subType' field")
+			}
+			return bson.Binary{Kind: kind[0], Data: bytes}, nil
+		}
+
+		if jsonValue, ok := doc["$uuid"]; ok {
+			text, ok := jsonValue.(string)
+			if !ok {
+				return nil, errors.New("expected $uuid field to have string value")
+			}
+			// the only accepted form is 8-4-4-4-12 hexadecimal digits
+			if len(text) != 36 || text[8] != '-' || text[13] != '-' || text[18] != '-' || text[23] != '-' {
+				return nil, fmt.Errorf("invalid $uuid '%v'", text)
+			}
+			bytes, err := hex.DecodeString(strings.Replace(text, "-", "", -1))
+			if err != nil {
+				return nil, fmt.Errorf("invalid $uuid '%v': %v", text, err)
+			}
+			return bson.Binary{Kind: 0x04, Data: bytes}, nil
+		}
+
+		if jsonValue, ok := doc["$regularExpression"]; ok {
+			regexDoc, ok := subdocumentAsMap(jsonValue)
+			if !ok {
+				return nil, errors.New("expected $regularExpression key to have internal document")
+			}
+			pattern, ok := regexDoc["pattern"].(string)
+			if !ok {
+				return nil, errors.New("expected $regularExpression to have string 'pattern' field")
+			}
+			options, ok := regexDoc["options"].(string)
+			if !ok {
+				return nil, errors.New("expected $regularExpression to have string 'options' field")
+			}
+			for i := range options {
+				switch o := options[i]; o {
+				default:
+					return nil, fmt.Errorf("invalid regular expression option '%v'", o)
+
+				case 'i', 'l', 'm', 's', 'u', 'x': // allowed
+				}
+			}
+			return bson.RegEx{Pattern: pattern, Options: options}, nil
+		}
+
+		if jsonValue, ok := doc["$dbPointer"]; ok {
+			pointerDoc, ok := subdocumentAsMap(jsonValue)
+			if !ok {
+				return nil, errors.New("expected $dbPointer key to have internal document")
+			}
+			namespace, ok := pointerDoc["$ref"].(string)
+			if !ok {
+				return nil, errors.New("expected $dbPointer to have string '$ref' field")
+			}
+			id, err := ParseJSONValue(pointerDoc["$id"])
+			if err != nil {
+				return nil, fmt.Errorf("error parsing $dbPointer '$id' field: %v", err)
+			}
+			oid, ok := id.(bson.ObjectId)
+			if !ok {
+				return nil, errors.New("expected $dbPointer '$id' field to be an ObjectId")
+			}
+			return bson.DBPointer{Namespace: namespace, Id: oid}, nil
+		}
+
 	case 2: // document has two fields
 		if jsonValue, ok := doc["$code"]; ok {
 			code := bson.JavaScript{}
@@ -398,6 +509,17 @@ func ParseSpecialKeys(special interface{}) (interface{}, error) {
 	}
 }
 
+// subdocumentAsMap returns the fields of a nested JSON document.
+func subdocumentAsMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case bson.D:
+		return v.Map(), true
+	}
+	return nil, false
+}
+
 // ParseJSONValue takes any value generated by the json package and returns a
 // BSON version of that value.
 func ParseJSONValue(jsonValue interface{}) (interface{}, error) {
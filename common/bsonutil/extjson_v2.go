@@ -0,0 +1,241 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Extended JSON v2 output modes, as described in the MongoDB Extended JSON
+// specification.
+const (
+	// ExtJSONCanonical preserves every BSON type, at the cost of readability.
+	ExtJSONCanonical = "canonical"
+	// ExtJSONRelaxed writes numbers and dates in their natural JSON forms
+	// where that loses no information.
+	ExtJSONRelaxed = "relaxed"
+)
+
+// MarshalExtJSON returns the extended JSON v2 encoding of a BSON document or
+// value, in canonical mode if canonical is set and relaxed mode otherwise.
+func MarshalExtJSON(value interface{}, canonical bool) ([]byte, error) {
+	converted, err := ConvertBSONValueToExtJSONv2(value, canonical)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(converted)
+}
+
+// UnmarshalExtJSON parses a JSON document, in extended JSON v2 in either mode
+// or in the legacy extended JSON of earlier tools, into a BSON document.
+func UnmarshalExtJSON(data []byte) (bson.D, error) {
+	doc, err := json.UnmarshalBsonD(data)
+	if err != nil {
+		return nil, err
+	}
+	return GetExtendedBsonD(doc)
+}
+
+// ConvertBSONValueToExtJSONv2 converts a BSON value to a value that marshals
+// as extended JSON v2, in canonical mode if canonical is set and relaxed mode
+// otherwise. Unlike ConvertBSONValueToJSON, it does not mutate its argument.
+func ConvertBSONValueToExtJSONv2(x interface{}, canonical bool) (interface{}, error) {
+	switch v := x.(type) {
+	case nil:
+		return nil, nil
+	case bool, string:
+		return v, nil
+
+	case bson.D:
+		out := make(MarshalD, 0, len(v))
+		for _, elem := range v {
+			value, err := ConvertBSONValueToExtJSONv2(elem.Value, canonical)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, bson.DocElem{Name: elem.Name, Value: value})
+		}
+		return out, nil
+	case *bson.D:
+		return ConvertBSONValueToExtJSONv2(*v, canonical)
+	case bson.Raw:
+		doc := bson.D{}
+		if err := v.Unmarshal(&doc); err != nil {
+			return nil, err
+		}
+		return ConvertBSONValueToExtJSONv2(doc, canonical)
+	case *bson.Raw:
+		return ConvertBSONValueToExtJSONv2(*v, canonical)
+	case *bson.M:
+		return convertMapToExtJSONv2(*v, canonical)
+	case bson.M:
+		return convertMapToExtJSONv2(v, canonical)
+	case map[string]interface{}:
+		return convertMapToExtJSONv2(v, canonical)
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			value, err := ConvertBSONValueToExtJSONv2(elem, canonical)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value)
+		}
+		return out, nil
+
+	case int: // the BSON decoder returns int32 values as int
+		return extJSONv2Integer("$numberInt", int64(v), canonical), nil
+	case int32:
+		return extJSONv2Integer("$numberInt", int64(v), canonical), nil
+	case int64:
+		return extJSONv2Integer("$numberLong", v, canonical), nil
+	case float32:
+		return extJSONv2Double(float64(v), canonical), nil
+	case float64:
+		return extJSONv2Double(v, canonical), nil
+	case bson.Decimal128:
+		return extJSONv2Wrapper("$numberDecimal", v.String()), nil
+
+	case bson.ObjectId:
+		return extJSONv2Wrapper("$oid", v.Hex()), nil
+	case time.Time:
+		return extJSONv2Date(v, canonical), nil
+	case bson.MongoTimestamp:
+		return extJSONv2Wrapper("$timestamp", MarshalD{
+			{Name: "t", Value: json.Number(strconv.FormatUint(uint64(uint64(v)>>32), 10))},
+			{Name: "i", Value: json.Number(strconv.FormatUint(uint64(uint32(v)), 10))},
+		}), nil
+
+	case []byte:
+		return extJSONv2Binary(0x00, v), nil
+	case bson.Binary:
+		return extJSONv2Binary(v.Kind, v.Data), nil
+
+	case bson.RegEx:
+		// the specification requires the options in alphabetical order
+		options := strings.Split(v.Options, "")
+		sort.Strings(options)
+		return extJSONv2Wrapper("$regularExpression", MarshalD{
+			{Name: "pattern", Value: v.Pattern},
+			{Name: "options", Value: strings.Join(options, "")},
+		}), nil
+
+	case bson.JavaScript:
+		if v.Scope == nil {
+			return extJSONv2Wrapper("$code", v.Code), nil
+		}
+		scope, err := ConvertBSONValueToExtJSONv2(v.Scope, canonical)
+		if err != nil {
+			return nil, err
+		}
+		return MarshalD{{Name: "$code", Value: v.Code}, {Name: "$scope", Value: scope}}, nil
+	case bson.Symbol:
+		return extJSONv2Wrapper("$symbol", string(v)), nil
+
+	case mgo.DBRef:
+		id, err := ConvertBSONValueToExtJSONv2(v.Id, canonical)
+		if err != nil {
+			return nil, err
+		}
+		ref := MarshalD{{Name: "$ref", Value: v.Collection}, {Name: "$id", Value: id}}
+		if v.Database != "" {
+			ref = append(ref, bson.DocElem{Name: "$db", Value: v.Database})
+		}
+		return ref, nil
+	case bson.DBPointer:
+		return extJSONv2Wrapper("$dbPointer", MarshalD{
+			{Name: "$ref", Value: v.Namespace},
+			{Name: "$id", Value: extJSONv2Wrapper("$oid", v.Id.Hex())},
+		}), nil
+
+	default:
+		switch x {
+		case bson.MinKey:
+			return extJSONv2Wrapper("$minKey", json.Number("1")), nil
+		case bson.MaxKey:
+			return extJSONv2Wrapper("$maxKey", json.Number("1")), nil
+		case bson.Undefined:
+			return extJSONv2Wrapper("$undefined", true), nil
+		}
+	}
+
+	return nil, fmt.Errorf("conversion of BSON value '%v' of type '%T' not supported", x, x)
+}
+
+func convertMapToExtJSONv2(m map[string]interface{}, canonical bool) (interface{}, error) {
+	out := make(map[string]interface{}, len(m))
+	for key, elem := range m {
+		value, err := ConvertBSONValueToExtJSONv2(elem, canonical)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = value
+	}
+	return out, nil
+}
+
+// extJSONv2Wrapper returns the single-key document used to represent most
+// BSON types in extended JSON.
+func extJSONv2Wrapper(key string, value interface{}) MarshalD {
+	return MarshalD{{Name: key, Value: value}}
+}
+
+func extJSONv2Integer(key string, n int64, canonical bool) interface{} {
+	if canonical {
+		return extJSONv2Wrapper(key, strconv.FormatInt(n, 10))
+	}
+	return json.Number(strconv.FormatInt(n, 10))
+}
+
+func extJSONv2Double(f float64, canonical bool) interface{} {
+	var text string
+	switch {
+	case math.IsNaN(f):
+		text = "NaN"
+	case math.IsInf(f, 1):
+		text = "Infinity"
+	case math.IsInf(f, -1):
+		text = "-Infinity"
+	default:
+		if !canonical {
+			// NumberFloat keeps a decimal point on integral values, so they
+			// are not read back as integers
+			return json.NumberFloat(f)
+		}
+		text = strconv.FormatFloat(f, 'G', -1, 64)
+		if !strings.ContainsAny(text, ".EN") {
+			text += ".0"
+		}
+	}
+	return extJSONv2Wrapper("$numberDouble", text)
+}
+
+func extJSONv2Date(t time.Time, canonical bool) interface{} {
+	ms := t.Unix()*1000 + int64(t.Nanosecond()/1e6)
+	// relaxed mode only uses ISO-8601 strings for years 1970 through 9999
+	if !canonical && ms >= 0 && t.UTC().Year() <= 9999 {
+		return extJSONv2Wrapper("$date", t.UTC().Format(json.JSON_DATE_FORMAT))
+	}
+	return extJSONv2Wrapper("$date", extJSONv2Wrapper("$numberLong", strconv.FormatInt(ms, 10)))
+}
+
+func extJSONv2Binary(kind byte, data []byte) interface{} {
+	return extJSONv2Wrapper("$binary", MarshalD{
+		{Name: "base64", Value: base64.StdEncoding.EncodeToString(data)},
+		{Name: "subType", Value: fmt.Sprintf("%02x", kind)},
+	})
+}
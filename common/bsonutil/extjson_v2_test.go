@@ -0,0 +1,173 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func marshalExtJSONv2(value interface{}, canonical bool) string {
+	converted, err := ConvertBSONValueToExtJSONv2(value, canonical)
+	So(err, ShouldBeNil)
+	out, err := json.Marshal(converted)
+	So(err, ShouldBeNil)
+	return string(out)
+}
+
+func TestExtJSONv2Output(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	date := time.Date(2018, 3, 1, 12, 30, 0, 5e6, time.UTC)
+
+	Convey("With canonical extended JSON v2", t, func() {
+		Convey("numbers should keep their types", func() {
+			So(marshalExtJSONv2(int32(5), true), ShouldEqual, `{"$numberInt":"5"}`)
+			So(marshalExtJSONv2(int64(5), true), ShouldEqual, `{"$numberLong":"5"}`)
+			So(marshalExtJSONv2(1.0, true), ShouldEqual, `{"$numberDouble":"1.0"}`)
+			So(marshalExtJSONv2(-1.5, true), ShouldEqual, `{"$numberDouble":"-1.5"}`)
+			So(marshalExtJSONv2(math.Inf(-1), true), ShouldEqual, `{"$numberDouble":"-Infinity"}`)
+		})
+
+		Convey("dates should be written as milliseconds", func() {
+			So(marshalExtJSONv2(date, true), ShouldEqual, `{"$date":{"$numberLong":"1519907400005"}}`)
+		})
+
+		Convey("binary data and regular expressions should use nested documents", func() {
+			So(marshalExtJSONv2(bson.Binary{Kind: 4, Data: []byte("abc")}, true),
+				ShouldEqual, `{"$binary":{"base64":"YWJj","subType":"04"}}`)
+			So(marshalExtJSONv2(bson.RegEx{Pattern: "^a", Options: "mi"}, true),
+				ShouldEqual, `{"$regularExpression":{"pattern":"^a","options":"im"}}`)
+		})
+
+		Convey("the original document should not be modified", func() {
+			doc := bson.D{{"a", int64(1)}}
+			marshalExtJSONv2(doc, true)
+			So(doc, ShouldResemble, bson.D{{"a", int64(1)}})
+		})
+	})
+
+	Convey("With relaxed extended JSON v2", t, func() {
+		Convey("finite numbers should be plain JSON numbers", func() {
+			So(marshalExtJSONv2(bson.D{{"i", int32(5)}, {"l", int64(5)}, {"f", 2.0}}, false),
+				ShouldEqual, `{"i":5,"l":5,"f":2.0}`)
+			So(marshalExtJSONv2(math.NaN(), false), ShouldEqual, `{"$numberDouble":"NaN"}`)
+		})
+
+		Convey("dates should be ISO-8601 strings only when representable", func() {
+			So(marshalExtJSONv2(date, false), ShouldEqual, `{"$date":"2018-03-01T12:30:00.005Z"}`)
+			So(marshalExtJSONv2(time.Unix(-1, 0), false), ShouldEqual, `{"$date":{"$numberLong":"-1000"}}`)
+		})
+	})
+}
+
+func TestExtJSONv2RoundTrip(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Documents written as extended JSON v2 should parse back to the same BSON", t, func() {
+		oid := bson.NewObjectId()
+		decimal, err := bson.ParseDecimal128("1.25")
+		So(err, ShouldBeNil)
+		original := bson.M{
+			"oid":     oid,
+			"int":     int32(7),
+			"long":    int64(1) << 40,
+			"double":  2.0,
+			"inf":     math.Inf(1),
+			"decimal": decimal,
+			"date":    time.Unix(1519907400, 5e6),
+			"ts":      bson.MongoTimestamp(int64(5)<<32 | 3),
+			"bin":     bson.Binary{Kind: 0x80, Data: []byte{1, 2, 3}},
+			"regex":   bson.RegEx{Pattern: "a+", Options: "ix"},
+			"symbol":  bson.Symbol("sym"),
+			"pointer": bson.DBPointer{Namespace: "db.coll", Id: oid},
+			"min":     bson.MinKey,
+		}
+
+		for _, canonical := range []bool{true, false} {
+			converted, err := ConvertBSONValueToExtJSONv2(original, canonical)
+			So(err, ShouldBeNil)
+			out, err := json.Marshal(converted)
+			So(err, ShouldBeNil)
+
+			parsed := map[string]interface{}{}
+			So(json.Unmarshal(out, &parsed), ShouldBeNil)
+			So(ConvertJSONDocumentToBSON(parsed), ShouldBeNil)
+			for key, value := range original {
+				if date, ok := value.(time.Time); ok {
+					So(parsed[key].(time.Time).Equal(date), ShouldBeTrue)
+					continue
+				}
+				So(parsed[key], ShouldResemble, value)
+			}
+		}
+	})
+}
+
+func TestExtJSONv2API(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With the extended JSON v2 API", t, func() {
+		Convey("documents should marshal in order, in either mode", func() {
+			doc := bson.D{{"b", int32(1)}, {"a", int64(2)}}
+			out, err := MarshalExtJSON(doc, true)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `{"b":{"$numberInt":"1"},"a":{"$numberLong":"2"}}`)
+			out, err = MarshalExtJSON(&doc, false)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `{"b":1,"a":2}`)
+		})
+
+		Convey("raw documents should marshal like decoded ones", func() {
+			data, err := bson.Marshal(bson.D{{"a", int64(2)}})
+			So(err, ShouldBeNil)
+			out, err := MarshalExtJSON(bson.Raw{Kind: 0x03, Data: data}, true)
+			So(err, ShouldBeNil)
+			So(string(out), ShouldEqual, `{"a":{"$numberLong":"2"}}`)
+		})
+
+		Convey("canonical output should unmarshal back to the original document", func() {
+			oid := bson.NewObjectId()
+			original := bson.D{
+				{"_id", oid},
+				{"n", int32(-3)},
+				{"sub", bson.D{{"l", int64(1) << 40}, {"d", 0.5}}},
+				{"arr", []interface{}{bson.MaxKey, bson.Undefined, "s"}},
+				{"code", bson.JavaScript{Code: "f()"}},
+			}
+			out, err := MarshalExtJSON(original, true)
+			So(err, ShouldBeNil)
+			parsed, err := UnmarshalExtJSON(out)
+			So(err, ShouldBeNil)
+			So(parsed[0].Value, ShouldEqual, oid)
+			So(parsed[1].Value, ShouldEqual, int32(-3))
+			So(parsed[2].Value, ShouldResemble, bson.D{{"l", int64(1) << 40}, {"d", 0.5}})
+			So(parsed[3].Value, ShouldResemble, []interface{}{bson.MaxKey, bson.Undefined, "s"})
+			So(parsed[4].Value, ShouldResemble, bson.JavaScript{Code: "f()"})
+		})
+
+		Convey("$uuid should unmarshal as binary data of subtype 4", func() {
+			parsed, err := UnmarshalExtJSON([]byte(`{"u": {"$uuid": "30313233-3435-3637-3839-616263646566"}}`))
+			So(err, ShouldBeNil)
+			So(parsed[0].Value, ShouldResemble, bson.Binary{Kind: 0x04, Data: []byte("0123456789abcdef")})
+
+			_, err = UnmarshalExtJSON([]byte(`{"u": {"$uuid": "3031323334353637-3839-6162-63646566"}}`))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("invalid JSON should be an error", func() {
+			_, err := UnmarshalExtJSON([]byte(`{"a": `))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
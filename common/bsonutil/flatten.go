@@ -0,0 +1,106 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"sort"
+	"strconv"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// FlattenOptions controls how nested documents and arrays are expanded
+// into a flat list of leaf values.
+type FlattenOptions struct {
+	// ExpandArrays, if set, expands arrays into one leaf per element, using
+	// the element index as the path component. Otherwise arrays are leaves.
+	ExpandArrays bool
+
+	// MaxDepth is the maximum number of levels to expand below the starting
+	// value. Values nested deeper than this are returned as leaves. Zero
+	// means there is no limit.
+	MaxDepth int
+}
+
+// FlattenedField is a single leaf value produced by Flatten, along with
+// the path of field names (or array indexes) leading to it.
+type FlattenedField struct {
+	Path  []string
+	Value interface{}
+}
+
+// Flatten walks value and returns its leaves in document order. The path of
+// each leaf begins with prefix. Documents may be bson.D, MarshalD, bson.M or
+// map[string]interface{}; the keys of unordered maps are visited in sorted
+// order so the output is deterministic. Empty documents and arrays are
+// returned as leaves so that they are never silently dropped.
+func Flatten(prefix []string, value interface{}, opts FlattenOptions) []FlattenedField {
+	return flatten(prefix, value, opts, 0, nil)
+}
+
+func flatten(path []string, value interface{}, opts FlattenOptions, depth int, out []FlattenedField) []FlattenedField {
+	if opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+		return appendLeaf(path, value, out)
+	}
+
+	switch v := value.(type) {
+	case bson.D:
+		return flattenD(path, v, opts, depth, out)
+	case MarshalD:
+		return flattenD(path, bson.D(v), opts, depth, out)
+	case bson.M:
+		return flattenMap(path, v, opts, depth, out)
+	case map[string]interface{}:
+		return flattenMap(path, v, opts, depth, out)
+	case []interface{}:
+		if !opts.ExpandArrays || len(v) == 0 {
+			return appendLeaf(path, value, out)
+		}
+		for i, elem := range v {
+			out = flatten(appendPath(path, strconv.Itoa(i)), elem, opts, depth+1, out)
+		}
+		return out
+	}
+	return appendLeaf(path, value, out)
+}
+
+func flattenD(path []string, doc bson.D, opts FlattenOptions, depth int, out []FlattenedField) []FlattenedField {
+	if len(doc) == 0 {
+		return appendLeaf(path, doc, out)
+	}
+	for _, elem := range doc {
+		out = flatten(appendPath(path, elem.Name), elem.Value, opts, depth+1, out)
+	}
+	return out
+}
+
+func flattenMap(path []string, doc map[string]interface{}, opts FlattenOptions, depth int, out []FlattenedField) []FlattenedField {
+	if len(doc) == 0 {
+		return appendLeaf(path, doc, out)
+	}
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		out = flatten(appendPath(path, key), doc[key], opts, depth+1, out)
+	}
+	return out
+}
+
+func appendLeaf(path []string, value interface{}, out []FlattenedField) []FlattenedField {
+	return append(out, FlattenedField{Path: path, Value: value})
+}
+
+// appendPath returns a copy of path with name added, so that sibling
+// leaves never share a backing array.
+func appendPath(path []string, name string) []string {
+	newPath := make([]string, len(path), len(path)+1)
+	copy(newPath, path)
+	return append(newPath, name)
+}
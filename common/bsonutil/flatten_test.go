@@ -0,0 +1,56 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestFlatten(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a nested document", t, func() {
+		doc := bson.D{
+			{"a", 1},
+			{"b", bson.D{{"c", "x"}, {"d", bson.M{"f": 2, "e": 3}}}},
+			{"g", []interface{}{bson.D{{"h", 4}}, 5}},
+			{"i", bson.D{}},
+		}
+
+		Convey("leaves should be returned in document order", func() {
+			leaves := Flatten(nil, doc, FlattenOptions{})
+			So(leaves, ShouldResemble, []FlattenedField{
+				{Path: []string{"a"}, Value: 1},
+				{Path: []string{"b", "c"}, Value: "x"},
+				{Path: []string{"b", "d", "e"}, Value: 3},
+				{Path: []string{"b", "d", "f"}, Value: 2},
+				{Path: []string{"g"}, Value: []interface{}{bson.D{{"h", 4}}, 5}},
+				{Path: []string{"i"}, Value: bson.D{}},
+			})
+		})
+
+		Convey("arrays should be expanded by index if requested", func() {
+			leaves := Flatten([]string{"root"}, doc, FlattenOptions{ExpandArrays: true})
+			So(leaves[4], ShouldResemble, FlattenedField{Path: []string{"root", "g", "0", "h"}, Value: 4})
+			So(leaves[5], ShouldResemble, FlattenedField{Path: []string{"root", "g", "1"}, Value: 5})
+		})
+
+		Convey("values deeper than the maximum depth should be leaves", func() {
+			leaves := Flatten(nil, doc, FlattenOptions{MaxDepth: 2})
+			So(leaves[2], ShouldResemble, FlattenedField{Path: []string{"b", "d"}, Value: bson.M{"f": 2, "e": 3}})
+		})
+	})
+
+	Convey("A scalar value should be a single leaf", t, func() {
+		So(Flatten([]string{"x"}, "y", FlattenOptions{}), ShouldResemble,
+			[]FlattenedField{{Path: []string{"x"}, Value: "y"}})
+	})
+}
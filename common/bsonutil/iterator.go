@@ -0,0 +1,283 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// MaxDocumentSize is the largest BSON document an Iterator accepts.
+	MaxDocumentSize = 16 * 1024 * 1024
+
+	iteratorBufferSize = 64 * 1024
+)
+
+// Iterator reads a stream of BSON documents, either a whole document at a
+// time with Next, or one top-level element at a time with NextDocument and
+// NextElement. It reuses a single buffer, which only grows to the size of
+// the largest document, or element, read, so that it allocates little
+// however large the stream is.
+type Iterator struct {
+	r   *bufio.Reader
+	buf []byte
+	// left is the number of bytes of the document started by NextDocument
+	// that NextElement hasn't read yet
+	left int
+	err  error
+}
+
+// Element is a top-level element of a document read by an Iterator.
+type Element struct {
+	Name  string
+	Value bson.Raw
+}
+
+// NewIterator returns an Iterator reading the documents of r, which it
+// buffers unless it is a *bufio.Reader already.
+func NewIterator(r io.Reader) *Iterator {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReaderSize(r, iteratorBufferSize)
+	}
+	return &Iterator{r: br}
+}
+
+// Err returns the error that stopped the iteration, or nil if the end of the
+// stream was reached. Once an error happens, the Iterator reads no more.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Next returns the next document of the stream, or nil at its end or on an
+// error. The document is only valid until the next call to the Iterator, as
+// its buffer is reused. What is left of a document started by NextDocument
+// is skipped.
+func (it *Iterator) Next() []byte {
+	size, ok := it.nextSize()
+	if !ok {
+		return nil
+	}
+	doc := it.grow(size)
+	binary.LittleEndian.PutUint32(doc, uint32(size))
+	if !it.readFull(doc[4:]) {
+		return nil
+	}
+	return doc
+}
+
+// NextDocument starts the next document of the stream, whose elements are
+// then read with NextElement, and returns its size. It returns false at the
+// end of the stream or on an error. What is left of the previous document is
+// skipped.
+func (it *Iterator) NextDocument() (int, bool) {
+	size, ok := it.nextSize()
+	if !ok {
+		return 0, false
+	}
+	it.left = size - 4
+	return size, true
+}
+
+// NextElement returns the next top-level element of the document started by
+// NextDocument, reading no more of the stream than that element. The value
+// is only valid until the next call to the Iterator. It returns false after
+// the last element of the document, or on an error.
+func (it *Iterator) NextElement() (Element, bool) {
+	if it.left <= 0 || it.err != nil {
+		return Element{}, false
+	}
+	kind, err := it.r.ReadByte()
+	if err != nil {
+		it.fail(err)
+		return Element{}, false
+	}
+	it.left--
+	if kind == 0x00 {
+		if it.left != 0 {
+			it.fail(fmt.Errorf("invalid bson: document ends %v bytes before its size", it.left))
+		}
+		return Element{}, false
+	}
+
+	name, ok := it.readCString(it.buf[:0])
+	if !ok {
+		return Element{}, false
+	}
+	it.buf = name
+	element := Element{Name: string(name[:len(name)-1])}
+	if element.Value.Data, ok = it.readValue(kind); !ok {
+		return Element{}, false
+	}
+	element.Value.Kind = kind
+	return element, true
+}
+
+// nextSize skips the rest of the current document, and reads and checks the
+// size of the next one.
+func (it *Iterator) nextSize() (int, bool) {
+	if it.err != nil {
+		return 0, false
+	}
+	if it.left > 0 {
+		if _, err := io.CopyN(ioutil.Discard, it.r, int64(it.left)); err != nil {
+			it.fail(err)
+			return 0, false
+		}
+		it.left = 0
+	}
+
+	var header [4]byte
+	_, err := io.ReadFull(it.r, header[:])
+	switch err {
+	case nil:
+	case io.EOF:
+		// the stream ends between documents
+		return 0, false
+	default:
+		it.err = err
+		return 0, false
+	}
+	size := int32(binary.LittleEndian.Uint32(header[:]))
+	// a document is at least its size and its terminating null byte
+	if size > MaxDocumentSize || size < 5 {
+		it.err = fmt.Errorf("invalid BSONSize: %v bytes", size)
+		return 0, false
+	}
+	return int(size), true
+}
+
+// readValue reads the value of an element of the given kind.
+func (it *Iterator) readValue(kind byte) ([]byte, bool) {
+	var size int
+	switch kind {
+	case 0x06, 0x0A, 0x7F, 0xFF: // undefined, null, max key, min key
+		size = 0
+	case 0x08: // boolean
+		size = 1
+	case 0x10: // int32
+		size = 4
+	case 0x01, 0x09, 0x11, 0x12: // double, date, timestamp, int64
+		size = 8
+	case 0x07: // ObjectId
+		size = 12
+	case 0x13: // decimal128
+		size = 16
+	case 0x0B: // regular expression, as pattern and options C strings
+		pattern, ok := it.readCString(it.buf[:0])
+		if !ok {
+			return nil, false
+		}
+		value, ok := it.readCString(pattern)
+		if ok {
+			it.buf = value
+		}
+		return value, ok
+	case 0x02, 0x0D, 0x0E, 0x03, 0x04, 0x0F, 0x05, 0x0C:
+		// the value starts with its length
+		if it.left < 4 {
+			it.fail(fmt.Errorf("invalid bson: element overflows its document"))
+			return nil, false
+		}
+		var header [4]byte
+		if !it.readFull(header[:]) {
+			return nil, false
+		}
+		it.left -= 4
+		length := int(int32(binary.LittleEndian.Uint32(header[:])))
+		switch kind {
+		case 0x02, 0x0D, 0x0E: // string, JavaScript, symbol
+			size = 4 + length
+		case 0x03, 0x04, 0x0F: // document, array, JavaScript with scope
+			size = length
+		case 0x05: // binary, whose subtype follows the length
+			size = 4 + 1 + length
+		case 0x0C: // DBPointer, as a string and an ObjectId
+			size = 4 + length + 12
+		}
+		if size < 4 || size-4 > it.left {
+			it.fail(fmt.Errorf("invalid bson: element overflows its document"))
+			return nil, false
+		}
+		value := it.grow(size)
+		copy(value, header[:])
+		if !it.readFull(value[4:]) {
+			return nil, false
+		}
+		it.left -= size - 4
+		return value, true
+	default:
+		it.fail(fmt.Errorf("invalid bson: unknown element type 0x%02x", kind))
+		return nil, false
+	}
+
+	if size > it.left {
+		it.fail(fmt.Errorf("invalid bson: element overflows its document"))
+		return nil, false
+	}
+	value := it.grow(size)
+	if !it.readFull(value) {
+		return nil, false
+	}
+	it.left -= size
+	return value, true
+}
+
+// readCString appends a null-terminated string of the current document,
+// with its null byte, to buf.
+func (it *Iterator) readCString(buf []byte) ([]byte, bool) {
+	for {
+		if it.left <= 0 {
+			it.fail(fmt.Errorf("invalid bson: element overflows its document"))
+			return nil, false
+		}
+		c, err := it.r.ReadByte()
+		if err != nil {
+			it.fail(err)
+			return nil, false
+		}
+		it.left--
+		buf = append(buf, c)
+		if c == 0x00 {
+			return buf, true
+		}
+	}
+}
+
+// readFull fills buf from the stream, where the end of the stream means the
+// document is truncated.
+func (it *Iterator) readFull(buf []byte) bool {
+	if _, err := io.ReadFull(it.r, buf); err != nil {
+		it.fail(err)
+		return false
+	}
+	return true
+}
+
+// fail stops the iteration with err.
+func (it *Iterator) fail(err error) {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// the stream ends inside a document
+		err = fmt.Errorf("invalid bson: %v", err)
+	}
+	it.err = err
+	it.left = 0
+}
+
+// grow returns the reused buffer, with the given length.
+func (it *Iterator) grow(size int) []byte {
+	if cap(it.buf) < size {
+		it.buf = make([]byte, size)
+	}
+	return it.buf[:size]
+}
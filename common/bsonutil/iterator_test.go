@@ -0,0 +1,126 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package bsonutil
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestIterator(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a stream of BSON documents", t, func() {
+		docs := []bson.D{
+			{{"_id", 1}, {"name", "a"}},
+			{
+				{"_id", 2},
+				{"sub", bson.D{{"x", int64(3)}}},
+				{"arr", []interface{}{"b", 4.5}},
+				{"bin", bson.Binary{Kind: 0x80, Data: []byte("data")}},
+				{"regex", bson.RegEx{Pattern: "^a", Options: "i"}},
+				{"ts", bson.MongoTimestamp(5)},
+				{"null", nil},
+				{"big", strings.Repeat("x", 100000)},
+			},
+		}
+		var stream bytes.Buffer
+		for _, doc := range docs {
+			data, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			stream.Write(data)
+		}
+		data := stream.Bytes()
+
+		Convey("Next should return each whole document", func() {
+			it := NewIterator(bytes.NewReader(data))
+			for _, doc := range docs {
+				raw := it.Next()
+				So(raw, ShouldNotBeNil)
+				decoded := bson.D{}
+				So(bson.Unmarshal(raw, &decoded), ShouldBeNil)
+				So(decoded, ShouldResemble, doc)
+			}
+			So(it.Next(), ShouldBeNil)
+			So(it.Err(), ShouldBeNil)
+		})
+
+		Convey("NextElement should return each top-level element", func() {
+			it := NewIterator(bytes.NewReader(data))
+			for _, doc := range docs {
+				size, ok := it.NextDocument()
+				So(ok, ShouldBeTrue)
+				So(size, ShouldBeGreaterThan, 5)
+				for _, expected := range doc {
+					element, ok := it.NextElement()
+					So(ok, ShouldBeTrue)
+					So(element.Name, ShouldEqual, expected.Name)
+					var value interface{}
+					So(element.Value.Unmarshal(&value), ShouldBeNil)
+					if d, isD := expected.Value.(bson.D); isD {
+						// nested documents decode as maps into an interface{}
+						So(value, ShouldResemble, d.Map())
+						continue
+					}
+					So(value, ShouldResemble, expected.Value)
+				}
+				_, ok = it.NextElement()
+				So(ok, ShouldBeFalse)
+				So(it.Err(), ShouldBeNil)
+			}
+			_, ok := it.NextDocument()
+			So(ok, ShouldBeFalse)
+			So(it.Err(), ShouldBeNil)
+		})
+
+		Convey("the rest of a partly read document should be skipped", func() {
+			it := NewIterator(bytes.NewReader(data))
+			_, ok := it.NextDocument()
+			So(ok, ShouldBeTrue)
+			element, ok := it.NextElement()
+			So(ok, ShouldBeTrue)
+			So(element.Name, ShouldEqual, "_id")
+			second := it.Next()
+			decoded := bson.D{}
+			So(bson.Unmarshal(second, &decoded), ShouldBeNil)
+			So(decoded, ShouldResemble, docs[1])
+		})
+
+		Convey("a truncated document should be an error", func() {
+			it := NewIterator(bytes.NewReader(data[:len(data)-10]))
+			So(it.Next(), ShouldNotBeNil)
+			So(it.Next(), ShouldBeNil)
+			So(it.Err(), ShouldNotBeNil)
+			So(it.Next(), ShouldBeNil)
+		})
+
+		Convey("an invalid size should be an error", func() {
+			it := NewIterator(bytes.NewReader([]byte{0x02, 0x00, 0x00, 0x00, 0x00}))
+			So(it.Next(), ShouldBeNil)
+			So(it.Err().Error(), ShouldContainSubstring, "invalid BSONSize")
+		})
+
+		Convey("an element larger than its document should be an error", func() {
+			corrupt := append([]byte{}, data...)
+			// the length of the "name" string of the first document
+			corrupt[19] = 0x7f
+			it := NewIterator(bytes.NewReader(corrupt))
+			_, ok := it.NextDocument()
+			So(ok, ShouldBeTrue)
+			_, ok = it.NextElement()
+			So(ok, ShouldBeTrue)
+			_, ok = it.NextElement()
+			So(ok, ShouldBeFalse)
+			So(it.Err(), ShouldNotBeNil)
+		})
+	})
+}
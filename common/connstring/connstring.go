@@ -34,6 +34,7 @@ type ConnString struct {
 	AuthMechanism           string
 	AuthMechanismProperties map[string]string
 	AuthSource              string
+	Compressors             []string
 	Connect                 ConnectMode
 	ConnectTimeout          time.Duration
 	Database                string
@@ -48,12 +49,19 @@ type ConnString struct {
 	MaxConnsPerHost         uint16
 	MaxConnsPerHostSet      bool
 	MaxIdleConnsPerHost     uint16
+	MaxStalenessSeconds     int
 	MaxIdleConnsPerHostSet  bool
+	MinConnsPerHost         uint16
+	MinConnsPerHostSet      bool
 	Password                string
 	PasswordSet             bool
 	ReadPreference          string
 	ReadPreferenceTagSets   []map[string]string
 	ReplicaSet              string
+	RetryReads              bool
+	RetryReadsSet           bool
+	RetryWrites             bool
+	RetryWritesSet          bool
 	ServerSelectionTimeout  time.Duration
 	SocketTimeout           time.Duration
 	Username                string
@@ -63,6 +71,9 @@ type ConnString struct {
 	WTimeout                time.Duration
 
 	UsingSRV bool
+	// the hostname of a mongodb+srv URI, whose SRV records list the hosts
+	SRVHostname    string
+	SRVServiceName string
 
 	Options        map[string][]string
 	UnknownOptions map[string][]string
@@ -169,7 +180,12 @@ func (p *parser) parse(original string) error {
 		if len(parsedHosts) != 1 {
 			return fmt.Errorf("URI with SRV must include one and only one hostname")
 		}
-		parsedHosts, err = fetchSeedlistFromSRV(parsedHosts[0])
+		p.SRVHostname = parsedHosts[0]
+		p.SRVServiceName, err = srvServiceNameFromURI(uri)
+		if err != nil {
+			return err
+		}
+		parsedHosts, err = fetchSeedlistFromSRV(p.SRVHostname, p.SRVServiceName)
 		if err != nil {
 			return err
 		}
@@ -232,7 +248,40 @@ func (p *parser) parse(original string) error {
 	return nil
 }
 
-func fetchSeedlistFromSRV(host string) ([]string, error) {
+// FetchSRVSeedlist looks up the SRV records of a mongodb+srv URI again and
+// returns the hosts they list, to find the hosts added and removed since it
+// was parsed.
+func (cs *ConnString) FetchSRVSeedlist() ([]string, error) {
+	if !cs.UsingSRV {
+		return nil, fmt.Errorf("not a mongodb+srv URI")
+	}
+	return fetchSeedlistFromSRV(cs.SRVHostname, cs.SRVServiceName)
+}
+
+// srvServiceNameFromURI returns the srvServiceName option of the rest of a
+// mongodb+srv URI, which is needed before its other options are parsed, or
+// "mongodb" if there is none.
+func srvServiceNameFromURI(uri string) (string, error) {
+	idx := strings.IndexRune(uri, '?')
+	if idx == -1 {
+		return "mongodb", nil
+	}
+	name := "mongodb"
+	for _, pair := range strings.FieldsFunc(uri[idx+1:], func(r rune) bool { return r == ';' || r == '&' }) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.ToLower(kv[0]) != "srvservicename" {
+			continue
+		}
+		value, err := url.QueryUnescape(kv[1])
+		if err != nil || value == "" {
+			return "", fmt.Errorf("invalid value for srvServiceName: %s", kv[1])
+		}
+		name = value
+	}
+	return name, nil
+}
+
+func fetchSeedlistFromSRV(host, serviceName string) ([]string, error) {
 	var err error
 
 	_, _, err = net.SplitHostPort(host)
@@ -243,10 +292,13 @@ func fetchSeedlistFromSRV(host string) ([]string, error) {
 		return nil, fmt.Errorf("URI with srv must not include a port number")
 	}
 
-	_, addresses, err := net.LookupSRV("mongodb", "tcp", host)
+	_, addresses, err := net.LookupSRV(serviceName, "tcp", host)
 	if err != nil {
 		return nil, err
 	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("no SRV records found for %s", host)
+	}
 	parsedHosts := make([]string, len(addresses))
 	for i, address := range addresses {
 		trimmedAddressTarget := strings.TrimSuffix(address.Target, ".")
@@ -334,6 +386,12 @@ func (p *parser) addOption(pair string) error {
 		default:
 			return fmt.Errorf("invalid 'connect' value: %s", value)
 		}
+	case "compressors":
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				p.Compressors = append(p.Compressors, strings.ToLower(name))
+			}
+		}
 	case "connecttimeoutms":
 		n, err := strconv.Atoi(value)
 		if err != nil || n < 0 {
@@ -358,6 +416,11 @@ func (p *parser) addOption(pair string) error {
 			return fmt.Errorf("invalid value for %s: %s", key, value)
 		}
 		p.Journal = j
+	case "srvservicename":
+		// already used to look up the SRV records
+		if !p.UsingSRV {
+			return fmt.Errorf("srvServiceName can only be used with mongodb+srv")
+		}
 	case "gssapiservicename":
 		p.KerberosService = value
 	case "gssapihostname":
@@ -397,6 +460,19 @@ func (p *parser) addOption(pair string) error {
 		p.MaxConnsPerHostSet = true
 		p.MaxIdleConnsPerHost = uint16(n)
 		p.MaxIdleConnsPerHostSet = true
+	case "maxstalenessseconds":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < -1 {
+			return fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		p.MaxStalenessSeconds = n
+	case "minpoolsize":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		p.MinConnsPerHost = uint16(n)
+		p.MinConnsPerHostSet = true
 	case "readpreference":
 		p.ReadPreference = value
 	case "readpreferencetags":
@@ -412,6 +488,16 @@ func (p *parser) addOption(pair string) error {
 		p.ReadPreferenceTagSets = append(p.ReadPreferenceTagSets, tags)
 	case "replicaset":
 		p.ReplicaSet = value
+	case "retryreads", "retrywrites":
+		retry, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %s", key, value)
+		}
+		if lowerKey == "retryreads" {
+			p.RetryReads, p.RetryReadsSet = retry, true
+		} else {
+			p.RetryWrites, p.RetryWritesSet = retry, true
+		}
 	case "serverselectiontimeoutms":
 		n, err := strconv.Atoi(value)
 		if err != nil || n < 0 {
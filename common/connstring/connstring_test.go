@@ -0,0 +1,98 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package connstring
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSRVServiceName(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When reading srvServiceName from a mongodb+srv URI", t, func() {
+		Convey("it should default to mongodb", func() {
+			name, err := srvServiceNameFromURI("cluster.example.com/db")
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "mongodb")
+
+			name, err = srvServiceNameFromURI("cluster.example.com/?replicaSet=rs0")
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "mongodb")
+		})
+
+		Convey("it should be found among the other options, in any case", func() {
+			name, err := srvServiceNameFromURI("cluster.example.com/?replicaSet=rs0&SRVSERVICENAME=custom%2Dsvc")
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, "custom-svc")
+		})
+
+		Convey("an empty value should be an error", func() {
+			_, err := srvServiceNameFromURI("cluster.example.com/?srvServiceName=")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("srvServiceName should be rejected without mongodb+srv", t, func() {
+		_, err := ParseURIConnectionString("mongodb://localhost/?srvServiceName=custom")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("FetchSRVSeedlist should fail for a URI not using SRV", t, func() {
+		cs, err := ParseURIConnectionString("mongodb://localhost")
+		So(err, ShouldBeNil)
+		_, err = cs.FetchSRVSeedlist()
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestRetryOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When parsing retryWrites and retryReads", t, func() {
+		Convey("they should be unset by default", func() {
+			cs, err := ParseURIConnectionString("mongodb://localhost")
+			So(err, ShouldBeNil)
+			So(cs.RetryWritesSet, ShouldBeFalse)
+			So(cs.RetryReadsSet, ShouldBeFalse)
+		})
+
+		Convey("their values should be parsed", func() {
+			cs, err := ParseURIConnectionString("mongodb://localhost/?retryWrites=false&retryReads=true")
+			So(err, ShouldBeNil)
+			So(cs.RetryWritesSet, ShouldBeTrue)
+			So(cs.RetryWrites, ShouldBeFalse)
+			So(cs.RetryReadsSet, ShouldBeTrue)
+			So(cs.RetryReads, ShouldBeTrue)
+		})
+
+		Convey("an invalid value should be an error", func() {
+			_, err := ParseURIConnectionString("mongodb://localhost/?retryWrites=maybe")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMaxStalenessSeconds(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When parsing maxStalenessSeconds", t, func() {
+		cs, err := ParseURIConnectionString("mongodb://localhost/?readPreference=secondary&maxStalenessSeconds=120")
+		So(err, ShouldBeNil)
+		So(cs.ReadPreference, ShouldEqual, "secondary")
+		So(cs.MaxStalenessSeconds, ShouldEqual, 120)
+
+		cs, err = ParseURIConnectionString("mongodb://localhost/?maxStalenessSeconds=-1")
+		So(err, ShouldBeNil)
+		So(cs.MaxStalenessSeconds, ShouldEqual, -1)
+
+		_, err = ParseURIConnectionString("mongodb://localhost/?maxStalenessSeconds=soon")
+		So(err, ShouldNotBeNil)
+	})
+}
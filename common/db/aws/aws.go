@@ -0,0 +1,166 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package aws implements authentication to MongoDB using AWS IAM credentials
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"gopkg.in/mgo.v2"
+)
+
+const authMechanism = "MONGODB-AWS"
+
+// the endpoints serving the credentials of the role of an ECS task or an EC2
+// instance, variables so tests can replace them
+var (
+	ecsEndpoint = "http://169.254.170.2"
+	ec2Endpoint = "http://169.254.169.254"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// credentials are AWS credentials, as the ECS and EC2 endpoints return them.
+type credentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+}
+
+// AddAWSOpts sets the credentials of the dial info when authenticating with
+// MONGODB-AWS. They are, in order of precedence: the username and password
+// given as the access key ID and secret access key, with --awsSessionToken
+// for temporary ones; the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables; the role of the ECS task; and the
+// role of the EC2 instance.
+func AddAWSOpts(opts options.ToolOptions, dialInfo *mgo.DialInfo) error {
+	if dialInfo == nil || opts.Auth == nil || opts.Auth.Mechanism != authMechanism {
+		return nil
+	}
+	creds, err := findCredentials(opts.Auth)
+	if err != nil {
+		return fmt.Errorf("error getting AWS credentials: %v", err)
+	}
+	dialInfo.Username = creds.AccessKeyID
+	dialInfo.Password = creds.SecretAccessKey
+	dialInfo.SessionToken = creds.Token
+	dialInfo.Mechanism = authMechanism
+	return nil
+}
+
+func findCredentials(auth *options.Auth) (*credentials, error) {
+	if auth.Username != "" || auth.Password != "" {
+		if auth.Username == "" || auth.Password == "" {
+			return nil, fmt.Errorf("both the access key ID and the secret access key must be given, " +
+				"as the username and password")
+		}
+		return &credentials{auth.Username, auth.Password, auth.AWSSessionToken}, nil
+	}
+	if auth.AWSSessionToken != "" {
+		return nil, fmt.Errorf("a session token can only be given with an access key ID and secret access key")
+	}
+	return environmentCredentials()
+}
+
+// EnvironmentCredentials returns the AWS credentials of the environment the
+// tool runs in: the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables, or else the credentials of the
+// role of the ECS task or of the EC2 instance.
+func EnvironmentCredentials() (accessKeyID, secretAccessKey, sessionToken string, err error) {
+	creds, err := environmentCredentials()
+	if err != nil {
+		return "", "", "", fmt.Errorf("error getting AWS credentials: %v", err)
+	}
+	return creds.AccessKeyID, creds.SecretAccessKey, creds.Token, nil
+}
+
+func environmentCredentials() (*credentials, error) {
+	id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if id != "" || secret != "" {
+		if id == "" || secret == "" {
+			return nil, fmt.Errorf("both AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+		}
+		log.Logvf(log.DebugLow, "using AWS credentials from the environment")
+		return &credentials{id, secret, os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		log.Logvf(log.DebugLow, "using AWS credentials of the ECS task role")
+		return fetchCredentials(ecsEndpoint+uri, nil)
+	}
+
+	log.Logvf(log.DebugLow, "using AWS credentials of the EC2 instance role")
+	return ec2Credentials()
+}
+
+// ec2Credentials gets the credentials of the role of the EC2 instance from
+// the instance metadata service, with a session token as version 2 of the
+// service requires.
+func ec2Credentials() (*credentials, error) {
+	token, err := fetch("PUT", ec2Endpoint+"/latest/api/token",
+		map[string]string{"X-aws-ec2-metadata-token-ttl-seconds": "30"})
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{"X-aws-ec2-metadata-token": string(token)}
+	rolesURL := ec2Endpoint + "/latest/meta-data/iam/security-credentials/"
+	role, err := fetch("GET", rolesURL, headers)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(strings.SplitN(string(role), "\n", 2)[0])
+	if name == "" {
+		return nil, fmt.Errorf("the EC2 instance has no IAM role")
+	}
+	return fetchCredentials(rolesURL+name, headers)
+}
+
+func fetchCredentials(url string, headers map[string]string) (*credentials, error) {
+	body, err := fetch("GET", url, headers)
+	if err != nil {
+		return nil, err
+	}
+	creds := &credentials{}
+	if err = json.Unmarshal(body, creds); err != nil {
+		return nil, fmt.Errorf("invalid credentials from %v: %v", url, err)
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("incomplete credentials from %v", url)
+	}
+	return creds, nil
+}
+
+func fetch(method, url string, headers map[string]string) ([]byte, error) {
+	request, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v %v returned %v", method, url, response.Status)
+	}
+	return body, nil
+}
@@ -0,0 +1,130 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package aws
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+)
+
+var awsEnv = []string{
+	"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+}
+
+func TestAddAWSOpts(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	saved := map[string]string{}
+	for _, name := range awsEnv {
+		saved[name] = os.Getenv(name)
+		os.Unsetenv(name)
+	}
+	defer func() {
+		for name, value := range saved {
+			os.Setenv(name, value)
+		}
+	}()
+
+	const credsJSON = `{"AccessKeyId": "roleID", "SecretAccessKey": "roleSecret", "Token": "roleToken", "Expiration": "2030-01-01T00:00:00Z"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "PUT" && r.URL.Path == "/latest/api/token":
+			w.Write([]byte("ec2token"))
+		case r.Header.Get("X-aws-ec2-metadata-token") != "ec2token" && r.URL.Path != "/ecs/creds":
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("role\n"))
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/role", r.URL.Path == "/ecs/creds":
+			w.Write([]byte(credsJSON))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	ecsEndpoint, ec2Endpoint = server.URL, server.URL
+
+	Convey("With options using MONGODB-AWS", t, func() {
+		opts := options.ToolOptions{Auth: &options.Auth{Mechanism: "MONGODB-AWS"}}
+		dialInfo := &mgo.DialInfo{}
+		Reset(func() {
+			for _, name := range awsEnv {
+				os.Unsetenv(name)
+			}
+		})
+
+		Convey("the username and password are the access key ID and secret access key", func() {
+			opts.Auth.Username, opts.Auth.Password, opts.Auth.AWSSessionToken = "id", "secret", "token"
+			os.Setenv("AWS_ACCESS_KEY_ID", "envID")
+			os.Setenv("AWS_SECRET_ACCESS_KEY", "envSecret")
+			So(AddAWSOpts(opts, dialInfo), ShouldBeNil)
+			So(dialInfo.Username, ShouldEqual, "id")
+			So(dialInfo.Password, ShouldEqual, "secret")
+			So(dialInfo.SessionToken, ShouldEqual, "token")
+			So(dialInfo.Mechanism, ShouldEqual, "MONGODB-AWS")
+		})
+
+		Convey("a username without a password is an error", func() {
+			opts.Auth.Username = "id"
+			So(AddAWSOpts(opts, dialInfo), ShouldNotBeNil)
+		})
+
+		Convey("a session token without keys is an error", func() {
+			opts.Auth.AWSSessionToken = "token"
+			So(AddAWSOpts(opts, dialInfo), ShouldNotBeNil)
+		})
+
+		Convey("credentials are read from the environment", func() {
+			os.Setenv("AWS_ACCESS_KEY_ID", "envID")
+			os.Setenv("AWS_SECRET_ACCESS_KEY", "envSecret")
+			os.Setenv("AWS_SESSION_TOKEN", "envToken")
+			So(AddAWSOpts(opts, dialInfo), ShouldBeNil)
+			So(dialInfo.Username, ShouldEqual, "envID")
+			So(dialInfo.Password, ShouldEqual, "envSecret")
+			So(dialInfo.SessionToken, ShouldEqual, "envToken")
+		})
+
+		Convey("an access key ID without a secret in the environment is an error", func() {
+			os.Setenv("AWS_ACCESS_KEY_ID", "envID")
+			So(AddAWSOpts(opts, dialInfo), ShouldNotBeNil)
+		})
+
+		Convey("credentials are read from the ECS endpoint", func() {
+			os.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/ecs/creds")
+			So(AddAWSOpts(opts, dialInfo), ShouldBeNil)
+			So(dialInfo.Username, ShouldEqual, "roleID")
+			So(dialInfo.Password, ShouldEqual, "roleSecret")
+			So(dialInfo.SessionToken, ShouldEqual, "roleToken")
+		})
+
+		Convey("an error from the ECS endpoint is returned", func() {
+			os.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "/ecs/missing")
+			So(AddAWSOpts(opts, dialInfo), ShouldNotBeNil)
+		})
+
+		Convey("credentials are read from the EC2 instance metadata", func() {
+			So(AddAWSOpts(opts, dialInfo), ShouldBeNil)
+			So(dialInfo.Username, ShouldEqual, "roleID")
+			So(dialInfo.Password, ShouldEqual, "roleSecret")
+			So(dialInfo.SessionToken, ShouldEqual, "roleToken")
+		})
+	})
+
+	Convey("Other mechanisms are left alone", t, func() {
+		opts := options.ToolOptions{Auth: &options.Auth{Mechanism: "SCRAM-SHA-256", Username: "user"}}
+		dialInfo := &mgo.DialInfo{Username: "user"}
+		So(AddAWSOpts(opts, dialInfo), ShouldBeNil)
+		So(dialInfo.Mechanism, ShouldEqual, "")
+	})
+}
@@ -7,7 +7,7 @@
 package db
 
 import (
-	"fmt"
+	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"gopkg.in/mgo.v2/bson"
 	"io"
 )
@@ -15,9 +15,10 @@ import (
 // BSONSource reads documents from the underlying io.ReadCloser, Stream which
 // wraps a stream of BSON documents.
 type BSONSource struct {
-	reusableBuf []byte
-	Stream      io.ReadCloser
-	err         error
+	Stream   io.ReadCloser
+	iterator *bsonutil.Iterator
+	// copyDocs is set if each document returned must be individually allocated
+	copyDocs bool
 }
 
 // DecodedBSONSource reads documents from the underlying io.ReadCloser, Stream which
@@ -36,12 +37,12 @@ type RawDocSource interface {
 
 // NewBSONSource creates a BSONSource with a reusable I/O buffer
 func NewBSONSource(in io.ReadCloser) *BSONSource {
-	return &BSONSource{make([]byte, MaxBSONSize), in, nil}
+	return &BSONSource{Stream: in, iterator: bsonutil.NewIterator(in)}
 }
 
 // NewBufferlessBSONSource creates a BSONSource without a reusable I/O buffer
 func NewBufferlessBSONSource(in io.ReadCloser) *BSONSource {
-	return &BSONSource{nil, in, nil}
+	return &BSONSource{Stream: in, iterator: bsonutil.NewIterator(in), copyDocs: true}
 }
 
 // Close closes the BSONSource, rendering it unusable for I/O.
@@ -79,68 +80,18 @@ func (dbs *DecodedBSONSource) Next(result interface{}) bool {
 
 // LoadNext reads and returns the next BSON document in the stream. If the
 // BSONSource was created with NewBSONSource then each returned []byte will be
-// a slice of a single reused I/O buffer. If the BSONSource was created with
+// a slice of a single reused I/O buffer, which grows to the size of the
+// largest document read. If the BSONSource was created with
 // NewBufferlessBSONSource then each returned []byte will be individually
 // allocated
 func (bs *BSONSource) LoadNext() []byte {
-	var into []byte
-	if bs.reusableBuf == nil {
-		into = make([]byte, 4)
-	} else {
-		into = bs.reusableBuf
+	doc := bs.iterator.Next()
+	if doc == nil || !bs.copyDocs {
+		return doc
 	}
-	// read the bson object size (a 4 byte integer)
-	_, err := io.ReadAtLeast(bs.Stream, into[0:4], 4)
-	if err != nil {
-		if err != io.EOF {
-			bs.err = err
-			return nil
-		}
-		// we hit EOF right away, so we're at the end of the stream.
-		bs.err = nil
-		return nil
-	}
-
-	bsonSize := int32(
-		(uint32(into[0]) << 0) |
-			(uint32(into[1]) << 8) |
-			(uint32(into[2]) << 16) |
-			(uint32(into[3]) << 24),
-	)
-
-	// Verify that the size of the BSON object we are about to read can
-	// actually fit into the buffer that was provided. If not, either the BSON is
-	// invalid, or the buffer passed in is too small.
-	// Verify that we do not have an invalid BSON document with size < 5.
-	if bsonSize > MaxBSONSize || bsonSize < 5 {
-		bs.err = fmt.Errorf("invalid BSONSize: %v bytes", bsonSize)
-		return nil
-	}
-	if int(bsonSize) > cap(into) {
-		bigInto := make([]byte, bsonSize)
-		copy(bigInto, into)
-		into = bigInto
-		if bs.reusableBuf != nil {
-			bs.reusableBuf = bigInto
-		}
-	}
-	into = into[:int(bsonSize)]
-	_, err = io.ReadAtLeast(bs.Stream, into[4:], int(bsonSize-4))
-	if err != nil {
-		if err != io.EOF {
-			bs.err = err
-			return nil
-		}
-		// this case means we hit EOF but read a partial document,
-		// so there's a broken doc in the stream. Treat this as error.
-		bs.err = fmt.Errorf("invalid bson: %v", err)
-		return nil
-	}
-
-	bs.err = nil
-	return into
+	return append([]byte(nil), doc...)
 }
 
 func (bs *BSONSource) Err() error {
-	return bs.err
+	return bs.iterator.Err()
 }
@@ -8,6 +8,10 @@ package db
 
 import (
 	"fmt"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/throttle"
+	"github.com/mongodb/mongo-tools/common/trace"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -24,6 +28,7 @@ type BufferedBulkInserter struct {
 	byteCount       int
 	docCount        int
 	unordered       bool
+	limiter         *throttle.Limiter
 }
 
 // NewBufferedBulkInserter returns an initialized BufferedBulkInserter
@@ -44,6 +49,12 @@ func (bb *BufferedBulkInserter) Unordered() {
 	bb.bulk.Unordered()
 }
 
+// SetLimiter limits the rate at which documents are inserted, and reports
+// the time each bulk insert takes to the limiter.
+func (bb *BufferedBulkInserter) SetLimiter(limiter *throttle.Limiter) {
+	bb.limiter = limiter
+}
+
 // throw away the old bulk and init a new one
 func (bb *BufferedBulkInserter) resetBulk() {
 	bb.bulk = bb.collection.Bulk()
@@ -61,6 +72,7 @@ func (bb *BufferedBulkInserter) Insert(doc interface{}) error {
 	if err != nil {
 		return fmt.Errorf("bson encoding error: %v", err)
 	}
+	bb.limiter.Wait(1, len(rawBytes))
 	// flush if we are full
 	if bb.docCount >= bb.docLimit || bb.byteCount+len(rawBytes) > MaxBSONSize {
 		err = bb.Flush()
@@ -78,8 +90,13 @@ func (bb *BufferedBulkInserter) Flush() error {
 		return nil
 	}
 	defer bb.resetBulk()
-	if _, err := bb.bulk.Run(); err != nil {
-		return err
-	}
-	return nil
+	span := trace.Start("batch insert")
+	span.SetAttribute("db.namespace", bb.collection.FullName)
+	span.SetAttribute("documents", bb.docCount)
+	span.SetAttribute("bytes", bb.byteCount)
+	start := time.Now()
+	_, err := bb.bulk.Run()
+	bb.limiter.Observe(time.Since(start))
+	span.End(err)
+	return err
 }
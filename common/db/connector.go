@@ -10,7 +10,9 @@ import (
 	"net"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/db/aws"
 	"github.com/mongodb/mongo-tools/common/db/kerberos"
+	"github.com/mongodb/mongo-tools/common/db/proxy"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
@@ -38,7 +40,7 @@ func (self *VanillaDBConnector) Configure(opts options.ToolOptions) error {
 
 	// create the dialer func that will be used to connect
 	dialer := func(addr *mgo.ServerAddr) (net.Conn, error) {
-		conn, err := net.DialTimeout("tcp", addr.String(), timeout)
+		conn, err := proxy.Dial(opts, addr.String(), timeout)
 		if err != nil {
 			return nil, err
 		}
@@ -52,14 +54,20 @@ func (self *VanillaDBConnector) Configure(opts options.ToolOptions) error {
 
 	// set up the dial info
 	self.dialInfo = &mgo.DialInfo{
-		Direct:         opts.Direct,
-		ReplicaSetName: opts.ReplicaSetName,
-		Username:       opts.Auth.Username,
-		Password:       opts.Auth.Password,
-		Source:         opts.GetAuthenticationDatabase(),
-		Mechanism:      opts.Auth.Mechanism,
-		DialServer:     dialer,
-		Timeout:        timeout,
+		Direct:               opts.Direct,
+		ReplicaSetName:       opts.ReplicaSetName,
+		Username:             opts.Auth.Username,
+		Password:             opts.Auth.Password,
+		Source:               opts.GetAuthenticationDatabase(),
+		Mechanism:            opts.Auth.Mechanism,
+		PoolLimit:            opts.MaxPoolSize,
+		MinPoolSize:          opts.MinPoolSize,
+		MaxIdleTimeMS:        opts.MaxIdleTimeMS,
+		HeartbeatFrequencyMS: opts.HeartbeatFrequencyMS,
+		Compressors:          opts.GetCompressors(),
+		ServerAPI:            &mgo.ServerAPI{Version: opts.APIVersion, Strict: opts.APIStrict, DeprecationErrors: opts.APIDeprecationErrors},
+		DialServer:           dialer,
+		Timeout:              timeout,
 	}
 
 	// create or fetch the addresses to be used to connect
@@ -70,6 +78,9 @@ func (self *VanillaDBConnector) Configure(opts options.ToolOptions) error {
 	}
 
 	kerberos.AddKerberosOpts(opts, self.dialInfo)
+	if err := aws.AddAWSOpts(opts, self.dialInfo); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -0,0 +1,111 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package csfle
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// keyLength is the length of data keys and of the local master key: a MAC
+// key, an encryption key and a key for deterministic IVs, of 32 bytes each.
+const keyLength = 96
+
+const (
+	ivLength  = aes.BlockSize
+	tagLength = 32
+)
+
+// encrypt encrypts plaintext with AEAD_AES_256_CBC_HMAC_SHA_512, binding it
+// to the associated data. The IV is derived from the key, associated data
+// and plaintext if deterministic is set, so that equal values encrypt the
+// same, and random otherwise.
+func encrypt(key, plaintext, associatedData []byte, deterministic bool) ([]byte, error) {
+	if len(key) != keyLength {
+		return nil, fmt.Errorf("key must be %v bytes, not %v", keyLength, len(key))
+	}
+	macKey, encKey, ivKey := key[:32], key[32:64], key[64:]
+	al := associatedDataLength(associatedData)
+
+	iv := make([]byte, ivLength)
+	if deterministic {
+		mac := hmac.New(sha512.New, ivKey)
+		mac.Write(associatedData)
+		mac.Write(al)
+		mac.Write(plaintext)
+		copy(iv, mac.Sum(nil))
+	} else if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	// PKCS #7 padding, always adding a block of padding to a full block
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, ivLength+len(padded))
+	copy(ciphertext, iv)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext[ivLength:], padded)
+
+	return append(ciphertext, tag(macKey, associatedData, ciphertext, al)...), nil
+}
+
+// decrypt verifies and decrypts ciphertext produced by encrypt with the same
+// key and associated data.
+func decrypt(key, ciphertext, associatedData []byte) ([]byte, error) {
+	if len(key) != keyLength {
+		return nil, fmt.Errorf("key must be %v bytes, not %v", keyLength, len(key))
+	}
+	macKey, encKey := key[:32], key[32:64]
+	if len(ciphertext) < ivLength+aes.BlockSize+tagLength ||
+		(len(ciphertext)-ivLength-tagLength)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("ciphertext has an invalid length %v", len(ciphertext))
+	}
+	sealed, expected := ciphertext[:len(ciphertext)-tagLength], ciphertext[len(ciphertext)-tagLength:]
+	if !hmac.Equal(tag(macKey, associatedData, sealed, associatedDataLength(associatedData)), expected) {
+		return nil, fmt.Errorf("authentication failed, the key is wrong or the data was modified")
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(sealed)-ivLength)
+	cipher.NewCBCDecrypter(block, sealed[:ivLength]).CryptBlocks(plaintext, sealed[ivLength:])
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+// associatedDataLength is the length in bits of the associated data, as a
+// 64-bit big-endian integer.
+func associatedDataLength(associatedData []byte) []byte {
+	al := make([]byte, 8)
+	binary.BigEndian.PutUint64(al, uint64(len(associatedData))*8)
+	return al
+}
+
+// tag is the truncated HMAC-SHA-512 authenticating the associated data and
+// the IV and ciphertext.
+func tag(macKey, associatedData, sealed, al []byte) []byte {
+	mac := hmac.New(sha512.New, macKey)
+	mac.Write(associatedData)
+	mac.Write(sealed)
+	mac.Write(al)
+	return mac.Sum(nil)[:tagLength]
+}
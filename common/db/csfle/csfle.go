@@ -0,0 +1,363 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package csfle implements client-side field level encryption: decrypting
+// the encrypted fields of documents read from MongoDB, and encrypting the
+// fields of documents written to it as a schema map says, with data keys
+// from a key vault collection protected by a local master key. Unlike the
+// drivers, it can't use data keys protected by a KMS provider such as AWS,
+// Azure or GCP.
+package csfle
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/options"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// The algorithms of the encrypt keyword of JSON schemas.
+const (
+	DeterministicAlgorithm = "AEAD_AES_256_CBC_HMAC_SHA_512-Deterministic"
+	RandomAlgorithm        = "AEAD_AES_256_CBC_HMAC_SHA_512-Random"
+)
+
+// the first byte of encrypted values, for each algorithm
+const (
+	deterministic byte = 1
+	random        byte = 2
+)
+
+// BSON binary subtypes
+const (
+	binaryUUID      byte = 0x04
+	binaryEncrypted byte = 0x06
+)
+
+// encrypted values start with a header of the algorithm, the id of the data
+// key and the BSON type of the value, which is authenticated as the
+// associated data, before the ciphertext
+const headerLength = 1 + 16 + 1
+
+// BSON types that deterministic encryption refuses, as they either have no
+// single encoding or are better left unencrypted
+var nonDeterministicTypes = map[byte]string{
+	0x01: "double",
+	0x03: "object",
+	0x04: "array",
+	0x08: "bool",
+	0x13: "decimal",
+}
+
+// keyDocument is a data key in the key vault.
+type keyDocument struct {
+	KeyMaterial []byte `bson:"keyMaterial"`
+	MasterKey   bson.M `bson:"masterKey"`
+}
+
+// Client decrypts and encrypts the fields of documents. It is safe for
+// concurrent use.
+type Client struct {
+	masterKey []byte
+	schemaMap map[string]*schema
+	// looks up a data key in the key vault
+	findKey func(id []byte) (*keyDocument, error)
+
+	keysLock sync.Mutex
+	// the decrypted data keys, by id
+	keys map[string][]byte
+}
+
+// New returns a Client using the key vault through the session provider, or
+// nil if encryption isn't enabled by the options.
+func New(provider *db.SessionProvider, opts *options.Encryption) (*Client, error) {
+	if !opts.Enabled() {
+		if opts != nil && (opts.LocalMasterKeyFile != "" || opts.SchemaMapFile != "") {
+			return nil, fmt.Errorf("--localMasterKeyFile and --schemaMapFile require --keyVaultNamespace")
+		}
+		return nil, nil
+	}
+	dot := strings.Index(opts.KeyVaultNamespace, ".")
+	if dot <= 0 || dot == len(opts.KeyVaultNamespace)-1 {
+		return nil, fmt.Errorf("--keyVaultNamespace must be <database>.<collection>, not '%v'", opts.KeyVaultNamespace)
+	}
+	keyVaultDB, keyVaultC := opts.KeyVaultNamespace[:dot], opts.KeyVaultNamespace[dot+1:]
+	if opts.LocalMasterKeyFile == "" {
+		return nil, fmt.Errorf("--keyVaultNamespace requires --localMasterKeyFile, since only data keys protected by a local master key can be used")
+	}
+	masterKey, err := readMasterKey(opts.LocalMasterKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var schemaMap map[string]*schema
+	if opts.SchemaMapFile != "" {
+		if schemaMap, err = loadSchemaMap(opts.SchemaMapFile); err != nil {
+			return nil, err
+		}
+	}
+
+	findKey := func(id []byte) (*keyDocument, error) {
+		session, err := provider.GetSession()
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+		key := &keyDocument{}
+		err = session.DB(keyVaultDB).C(keyVaultC).FindId(bson.Binary{Kind: binaryUUID, Data: id}).One(key)
+		if err == mgo.ErrNotFound {
+			return nil, fmt.Errorf("no data key with id %x in %v", id, opts.KeyVaultNamespace)
+		}
+		return key, err
+	}
+	return newClient(masterKey, schemaMap, findKey), nil
+}
+
+func newClient(masterKey []byte, schemaMap map[string]*schema, findKey func([]byte) (*keyDocument, error)) *Client {
+	return &Client{
+		masterKey: masterKey,
+		schemaMap: schemaMap,
+		findKey:   findKey,
+		keys:      map[string][]byte{},
+	}
+}
+
+// readMasterKey reads the local master key, as 96 raw bytes or their base64
+// encoding.
+func readMasterKey(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading local master key: %v", err)
+	}
+	if len(data) == keyLength {
+		return data, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil || len(key) != keyLength {
+		return nil, fmt.Errorf("the local master key in %v must be %v bytes, raw or base64 encoded", path, keyLength)
+	}
+	return key, nil
+}
+
+// dataKey returns the decrypted data key with the given id.
+func (c *Client) dataKey(id []byte) ([]byte, error) {
+	c.keysLock.Lock()
+	defer c.keysLock.Unlock()
+	if key, ok := c.keys[string(id)]; ok {
+		return key, nil
+	}
+
+	doc, err := c.findKey(id)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching data key: %v", err)
+	}
+	if provider, _ := doc.MasterKey["provider"].(string); provider != "local" {
+		return nil, fmt.Errorf("data key %x is protected by the KMS provider '%v', but only data keys protected by a local master key can be used", id, provider)
+	}
+	key, err := decrypt(c.masterKey, doc.KeyMaterial, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting data key %x with the local master key: %v", id, err)
+	}
+	c.keys[string(id)] = key
+	return key, nil
+}
+
+// Decrypt replaces the encrypted values of a document, including those in
+// its subdocuments and arrays, with their plaintext. It returns whether any
+// value was decrypted.
+func (c *Client) Decrypt(doc bson.D) (bool, error) {
+	decrypted := false
+	for i := range doc {
+		value, changed, err := c.decryptValue(doc[i].Value)
+		if err != nil {
+			return false, fmt.Errorf("error decrypting field '%v': %v", doc[i].Name, err)
+		}
+		if changed {
+			doc[i].Value = value
+			decrypted = true
+		}
+	}
+	return decrypted, nil
+}
+
+func (c *Client) decryptValue(value interface{}) (interface{}, bool, error) {
+	switch v := value.(type) {
+	case bson.Binary:
+		if v.Kind != binaryEncrypted {
+			return value, false, nil
+		}
+		plain, err := c.decryptBinary(v.Data)
+		return plain, err == nil, err
+	case bson.D:
+		changed, err := c.Decrypt(v)
+		return v, changed, err
+	case []interface{}:
+		decrypted := false
+		for i := range v {
+			element, changed, err := c.decryptValue(v[i])
+			if err != nil {
+				return nil, false, err
+			}
+			if changed {
+				v[i] = element
+				decrypted = true
+			}
+		}
+		return v, decrypted, nil
+	}
+	return value, false, nil
+}
+
+func (c *Client) decryptBinary(data []byte) (interface{}, error) {
+	if len(data) <= headerLength || (data[0] != deterministic && data[0] != random) {
+		return nil, fmt.Errorf("not a supported encrypted value")
+	}
+	key, err := c.dataKey(data[1:17])
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := decrypt(key, data[headerLength:], data[:headerLength])
+	if err != nil {
+		return nil, err
+	}
+	return unmarshalValue(data[17], plaintext)
+}
+
+// DecryptRaw is Decrypt for a BSON document. The returned document is always
+// a copy.
+func (c *Client) DecryptRaw(data []byte) ([]byte, error) {
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	decrypted, err := c.Decrypt(doc)
+	if err != nil {
+		return nil, err
+	}
+	if !decrypted {
+		return append([]byte{}, data...), nil
+	}
+	return bson.Marshal(doc)
+}
+
+// Encrypt encrypts the fields of a document of the namespace, as the schema
+// map says. Values that are already encrypted, and null values, are left as
+// they are. It returns whether any value was encrypted.
+func (c *Client) Encrypt(namespace string, doc bson.D) (bool, error) {
+	s, ok := c.schemaMap[namespace]
+	if !ok {
+		return false, nil
+	}
+	return c.encryptDocument(s, doc)
+}
+
+// Encrypts reports whether the schema map has a schema for the namespace.
+func (c *Client) Encrypts(namespace string) bool {
+	_, ok := c.schemaMap[namespace]
+	return ok
+}
+
+func (c *Client) encryptDocument(s *schema, doc bson.D) (bool, error) {
+	encrypted := false
+	for i := range doc {
+		if spec, ok := s.fields[doc[i].Name]; ok {
+			if b, ok := doc[i].Value.(bson.Binary); (ok && b.Kind == binaryEncrypted) || doc[i].Value == nil {
+				continue
+			}
+			value, err := c.encryptValue(spec, doc[i].Value)
+			if err != nil {
+				return false, fmt.Errorf("error encrypting field '%v': %v", doc[i].Name, err)
+			}
+			doc[i].Value = value
+			encrypted = true
+		} else if nested, ok := s.nested[doc[i].Name]; ok {
+			subdoc, ok := doc[i].Value.(bson.D)
+			if !ok {
+				continue
+			}
+			changed, err := c.encryptDocument(nested, subdoc)
+			if err != nil {
+				return false, fmt.Errorf("in field '%v': %v", doc[i].Name, err)
+			}
+			encrypted = encrypted || changed
+		}
+	}
+	return encrypted, nil
+}
+
+func (c *Client) encryptValue(spec *encryptSpec, value interface{}) (bson.Binary, error) {
+	bsonType, plaintext, err := marshalValue(value)
+	if err != nil {
+		return bson.Binary{}, err
+	}
+	if name, ok := nonDeterministicTypes[bsonType]; ok && spec.algorithm == deterministic {
+		return bson.Binary{}, fmt.Errorf("deterministic encryption doesn't support %v values", name)
+	}
+	key, err := c.dataKey(spec.keyID)
+	if err != nil {
+		return bson.Binary{}, err
+	}
+	associatedData := append(append([]byte{spec.algorithm}, spec.keyID...), bsonType)
+	ciphertext, err := encrypt(key, plaintext, associatedData, spec.algorithm == deterministic)
+	if err != nil {
+		return bson.Binary{}, err
+	}
+	return bson.Binary{Kind: binaryEncrypted, Data: append(associatedData, ciphertext...)}, nil
+}
+
+// EncryptRaw is Encrypt for a BSON document. The returned document is always
+// a copy.
+func (c *Client) EncryptRaw(namespace string, data []byte) ([]byte, error) {
+	if !c.Encrypts(namespace) {
+		return append([]byte{}, data...), nil
+	}
+	var doc bson.D
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	encrypted, err := c.Encrypt(namespace, doc)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		return append([]byte{}, data...), nil
+	}
+	return bson.Marshal(doc)
+}
+
+// marshalValue returns the BSON type and encoding of a value, which are
+// encrypted.
+func marshalValue(value interface{}) (byte, []byte, error) {
+	data, err := bson.Marshal(bson.D{{"v", value}})
+	if err != nil {
+		return 0, nil, err
+	}
+	// the length, the type, the name "v" and its terminator, the value and
+	// the document terminator
+	return data[4], data[7 : len(data)-1], nil
+}
+
+// unmarshalValue decodes a value marshaled by marshalValue.
+func unmarshalValue(bsonType byte, data []byte) (interface{}, error) {
+	raw := bson.Raw{Kind: 0x03, Data: make([]byte, 0, len(data)+8)}
+	raw.Data = append(raw.Data, 0, 0, 0, 0, bsonType, 'v', 0)
+	raw.Data = append(raw.Data, data...)
+	raw.Data = append(raw.Data, 0)
+	length := len(raw.Data)
+	raw.Data[0], raw.Data[1], raw.Data[2], raw.Data[3] = byte(length), byte(length>>8), byte(length>>16), byte(length>>24)
+	var doc bson.D
+	if err := raw.Unmarshal(&doc); err != nil || len(doc) != 1 {
+		return nil, fmt.Errorf("invalid decrypted value: %v", err)
+	}
+	return doc[0].Value, nil
+}
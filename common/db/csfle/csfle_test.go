@@ -0,0 +1,241 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package csfle
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	testMasterKey = bytes.Repeat([]byte{0x4d}, keyLength)
+	testDataKey   = bytes.Repeat([]byte{0x2a}, keyLength)
+	testKeyID     = []byte("0123456789abcdef")
+)
+
+const testSchemaMap = `{
+	"test.people": {
+		"bsonType": "object",
+		"encryptMetadata": {
+			"keyId": [{"$binary": "MDEyMzQ1Njc4OWFiY2RlZg==", "$type": "04"}]
+		},
+		"properties": {
+			"ssn": {"encrypt": {"bsonType": "string", "algorithm": "AEAD_AES_256_CBC_HMAC_SHA_512-Deterministic"}},
+			"medical": {
+				"bsonType": "object",
+				"properties": {
+					"records": {"encrypt": {"bsonType": "array", "algorithm": "AEAD_AES_256_CBC_HMAC_SHA_512-Random"}}
+				}
+			}
+		}
+	}
+}`
+
+// testClient returns a client whose key vault holds testDataKey, wrapped by
+// testMasterKey, under testKeyID.
+func testClient() *Client {
+	wrapped, err := encrypt(testMasterKey, testDataKey, nil, false)
+	So(err, ShouldBeNil)
+	schemaMap, err := parseSchemaMap([]byte(testSchemaMap))
+	So(err, ShouldBeNil)
+	return newClient(testMasterKey, schemaMap, func(id []byte) (*keyDocument, error) {
+		if !bytes.Equal(id, testKeyID) {
+			return nil, fmt.Errorf("no data key with id %x", id)
+		}
+		return &keyDocument{KeyMaterial: wrapped, MasterKey: bson.M{"provider": "local"}}, nil
+	})
+}
+
+func TestAEAD(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With AEAD_AES_256_CBC_HMAC_SHA_512", t, func() {
+		ad := []byte("associated")
+
+		Convey("encrypted values should decrypt to their plaintext", func() {
+			for _, plaintext := range [][]byte{{}, []byte("short"), bytes.Repeat([]byte("x"), 32)} {
+				ciphertext, err := encrypt(testDataKey, plaintext, ad, false)
+				So(err, ShouldBeNil)
+				decrypted, err := decrypt(testDataKey, ciphertext, ad)
+				So(err, ShouldBeNil)
+				So(bytes.Equal(decrypted, plaintext), ShouldBeTrue)
+			}
+		})
+
+		Convey("deterministic encryption should be repeatable, and random encryption not", func() {
+			first, _ := encrypt(testDataKey, []byte("value"), ad, true)
+			second, _ := encrypt(testDataKey, []byte("value"), ad, true)
+			So(bytes.Equal(first, second), ShouldBeTrue)
+			first, _ = encrypt(testDataKey, []byte("value"), ad, false)
+			second, _ = encrypt(testDataKey, []byte("value"), ad, false)
+			So(bytes.Equal(first, second), ShouldBeFalse)
+		})
+
+		Convey("modified ciphertext or associated data should fail to decrypt", func() {
+			ciphertext, _ := encrypt(testDataKey, []byte("value"), ad, false)
+			_, err := decrypt(testDataKey, ciphertext, []byte("other"))
+			So(err, ShouldNotBeNil)
+			ciphertext[20] ^= 1
+			_, err = decrypt(testDataKey, ciphertext, ad)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a client and a schema map", t, func() {
+		client := testClient()
+		doc := bson.D{
+			{"_id", 1},
+			{"name", "Ann"},
+			{"ssn", "123-45-6789"},
+			{"medical", bson.D{{"records", []interface{}{"flu", int32(2019)}}}},
+		}
+
+		Convey("the fields of the schema should be encrypted, and decrypt back", func() {
+			encrypted, err := client.Encrypt("test.people", doc)
+			So(err, ShouldBeNil)
+			So(encrypted, ShouldBeTrue)
+			So(doc[1].Value, ShouldEqual, "Ann")
+			ssn, ok := doc[2].Value.(bson.Binary)
+			So(ok, ShouldBeTrue)
+			So(ssn.Kind, ShouldEqual, binaryEncrypted)
+			So(ssn.Data[0], ShouldEqual, deterministic)
+			records := doc[3].Value.(bson.D)[0].Value.(bson.Binary)
+			So(records.Data[0], ShouldEqual, random)
+
+			decrypted, err := client.Decrypt(doc)
+			So(err, ShouldBeNil)
+			So(decrypted, ShouldBeTrue)
+			So(doc[2].Value, ShouldEqual, "123-45-6789")
+			So(doc[3].Value, ShouldResemble, bson.D{{"records", []interface{}{"flu", 2019}}})
+		})
+
+		Convey("raw documents should round trip", func() {
+			raw, err := bson.Marshal(doc)
+			So(err, ShouldBeNil)
+			encrypted, err := client.EncryptRaw("test.people", raw)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(encrypted, raw), ShouldBeFalse)
+			decrypted, err := client.DecryptRaw(encrypted)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(decrypted, raw), ShouldBeTrue)
+		})
+
+		Convey("other namespaces should be left as they are", func() {
+			encrypted, err := client.Encrypt("test.other", doc)
+			So(err, ShouldBeNil)
+			So(encrypted, ShouldBeFalse)
+			So(doc[2].Value, ShouldEqual, "123-45-6789")
+		})
+
+		Convey("deterministic encryption of a double should be an error", func() {
+			_, err := client.Encrypt("test.people", bson.D{{"ssn", 1.5}})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a value encrypted with an unknown key should fail to decrypt", func() {
+			client.Encrypt("test.people", doc)
+			ssn := doc[2].Value.(bson.Binary)
+			copy(ssn.Data[1:17], "fedcba9876543210")
+			_, err := client.Decrypt(doc)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestParseSchemaMap(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When parsing schema maps", t, func() {
+		Convey("keyId should be accepted as $uuid", func() {
+			schemaMap, err := parseSchemaMap([]byte(`{"test.c": {"properties": {"a": {"encrypt": {
+				"keyId": [{"$uuid": "30313233-3435-3637-3839-616263646566"}],
+				"algorithm": "AEAD_AES_256_CBC_HMAC_SHA_512-Random"}}}}}`))
+			So(err, ShouldBeNil)
+			So(schemaMap["test.c"].fields["a"].keyID, ShouldResemble, testKeyID)
+		})
+
+		Convey("an encrypted field without a key should be an error", func() {
+			_, err := parseSchemaMap([]byte(`{"test.c": {"properties": {"a": {"encrypt": {
+				"algorithm": "AEAD_AES_256_CBC_HMAC_SHA_512-Random"}}}}}`))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("an unknown algorithm should be an error", func() {
+			_, err := parseSchemaMap([]byte(`{"test.c": {"properties": {"a": {"encrypt": {
+				"keyId": [{"$uuid": "30313233-3435-3637-3839-616263646566"}], "algorithm": "rot13"}}}}}`))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a key that isn't a namespace should be an error", func() {
+			_, err := parseSchemaMap([]byte(`{"people": {}}`))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestNew(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With encryption options", t, func() {
+		dir, err := ioutil.TempDir("", "csfle")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		keyFile := filepath.Join(dir, "master-key.txt")
+		So(ioutil.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(testMasterKey)+"\n"), 0600), ShouldBeNil)
+
+		Convey("no key vault should disable encryption", func() {
+			client, err := New(nil, &options.Encryption{})
+			So(err, ShouldBeNil)
+			So(client, ShouldBeNil)
+		})
+
+		Convey("a master key without a key vault should be an error", func() {
+			_, err := New(nil, &options.Encryption{LocalMasterKeyFile: keyFile})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a key vault needs a master key", func() {
+			_, err := New(nil, &options.Encryption{KeyVaultNamespace: "encryption.__keyVault"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a base64 encoded master key should be read", func() {
+			client, err := New(nil, &options.Encryption{KeyVaultNamespace: "encryption.__keyVault", LocalMasterKeyFile: keyFile})
+			So(err, ShouldBeNil)
+			So(client.masterKey, ShouldResemble, testMasterKey)
+		})
+
+		Convey("a master key of the wrong length should be an error", func() {
+			So(ioutil.WriteFile(keyFile, []byte("c2hvcnQ="), 0600), ShouldBeNil)
+			_, err := New(nil, &options.Encryption{KeyVaultNamespace: "encryption.__keyVault", LocalMasterKeyFile: keyFile})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("a data key protected by a KMS provider should be an error", func() {
+			client := newClient(testMasterKey, nil, func(id []byte) (*keyDocument, error) {
+				return &keyDocument{MasterKey: bson.M{"provider": "aws"}}, nil
+			})
+			_, err := client.dataKey(testKeyID)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "'aws'")
+		})
+	})
+}
@@ -0,0 +1,159 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package csfle
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// encryptSpec is how a field is encrypted, from its encrypt keyword.
+type encryptSpec struct {
+	keyID     []byte
+	algorithm byte
+}
+
+// schema holds the fields of a document to encrypt, and the schemas of its
+// subdocuments.
+type schema struct {
+	fields map[string]*encryptSpec
+	nested map[string]*schema
+}
+
+// loadSchemaMap reads a JSON file mapping namespaces to JSON schemas.
+func loadSchemaMap(path string) (map[string]*schema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema map file: %v", err)
+	}
+	schemaMap, err := parseSchemaMap(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing schema map file %v: %v", path, err)
+	}
+	return schemaMap, nil
+}
+
+// parseSchemaMap parses a JSON document mapping namespaces to JSON schemas.
+// Only the properties, encrypt and encryptMetadata keywords are used.
+func parseSchemaMap(data []byte) (map[string]*schema, error) {
+	var asJSON interface{}
+	if err := json.Unmarshal(data, &asJSON); err != nil {
+		return nil, err
+	}
+	converted, err := bsonutil.ConvertJSONValueToBSON(asJSON)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := converted.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("the schema map must be a JSON object")
+	}
+
+	schemaMap := make(map[string]*schema, len(doc))
+	for namespace, value := range doc {
+		if !strings.Contains(namespace, ".") {
+			return nil, fmt.Errorf("'%v' is not a <database>.<collection> namespace", namespace)
+		}
+		jsonSchema, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("the schema of %v must be a JSON object", namespace)
+		}
+		s, err := parseSchema(jsonSchema, encryptSpec{})
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema of %v: %v", namespace, err)
+		}
+		schemaMap[namespace] = s
+	}
+	return schemaMap, nil
+}
+
+// parseSchema parses a JSON schema of a document, whose encrypt keywords
+// default to the given key and algorithm.
+func parseSchema(jsonSchema map[string]interface{}, defaults encryptSpec) (*schema, error) {
+	if metadata, ok := jsonSchema["encryptMetadata"]; ok {
+		var err error
+		if defaults, err = parseEncrypt(metadata, defaults); err != nil {
+			return nil, fmt.Errorf("invalid encryptMetadata: %v", err)
+		}
+	}
+
+	s := &schema{fields: map[string]*encryptSpec{}, nested: map[string]*schema{}}
+	properties, _ := jsonSchema["properties"].(map[string]interface{})
+	for field, value := range properties {
+		property, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("the schema of field '%v' must be a JSON object", field)
+		}
+		if encrypt, ok := property["encrypt"]; ok {
+			spec, err := parseEncrypt(encrypt, defaults)
+			if err != nil {
+				return nil, fmt.Errorf("invalid encrypt keyword of field '%v': %v", field, err)
+			}
+			if spec.keyID == nil || spec.algorithm == 0 {
+				return nil, fmt.Errorf("field '%v' needs a keyId and an algorithm", field)
+			}
+			s.fields[field] = &spec
+		} else if _, ok := property["properties"]; ok {
+			nested, err := parseSchema(property, defaults)
+			if err != nil {
+				return nil, fmt.Errorf("in field '%v': %v", field, err)
+			}
+			s.nested[field] = nested
+		}
+	}
+	return s, nil
+}
+
+// parseEncrypt parses an encrypt or encryptMetadata keyword, whose missing
+// keyId or algorithm are taken from the defaults.
+func parseEncrypt(value interface{}, defaults encryptSpec) (encryptSpec, error) {
+	keyword, ok := value.(map[string]interface{})
+	if !ok {
+		return defaults, fmt.Errorf("must be a JSON object")
+	}
+	spec := defaults
+	if keyIDs, ok := keyword["keyId"]; ok {
+		ids, ok := keyIDs.([]interface{})
+		if !ok || len(ids) != 1 {
+			return defaults, fmt.Errorf("keyId must be an array of one UUID")
+		}
+		id, err := parseUUID(ids[0])
+		if err != nil {
+			return defaults, fmt.Errorf("invalid keyId: %v", err)
+		}
+		spec.keyID = id
+	}
+	if algorithm, ok := keyword["algorithm"]; ok {
+		switch algorithm {
+		case DeterministicAlgorithm:
+			spec.algorithm = deterministic
+		case RandomAlgorithm:
+			spec.algorithm = random
+		default:
+			return defaults, fmt.Errorf("unknown algorithm %v", algorithm)
+		}
+	}
+	return spec, nil
+}
+
+// parseUUID parses a UUID, given as binary data of subtype 4 or as {$uuid:
+// <string>}, both of which the extended JSON parser returns as binary data.
+func parseUUID(value interface{}) ([]byte, error) {
+	id, ok := value.(bson.Binary)
+	if !ok || id.Kind != binaryUUID {
+		return nil, fmt.Errorf("expected a UUID")
+	}
+	if len(id.Data) != 16 {
+		return nil, fmt.Errorf("a UUID is 16 bytes, not %v", len(id.Data))
+	}
+	return id.Data, nil
+}
@@ -9,15 +9,21 @@
 package db
 
 import (
+	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/password"
+	"github.com/mongodb/mongo-tools/common/trace"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 	"sync"
+	"time"
 )
 
 type (
@@ -62,6 +68,10 @@ var (
 	GetConnectorFuncs = []GetConnectorFunc{}
 )
 
+// srvPollInterval is how often the SRV records of a mongodb+srv URI are
+// looked up again, to follow the hosts added to and removed from them.
+var srvPollInterval = 60 * time.Second
+
 // Used to manage database sessions
 type SessionProvider struct {
 
@@ -79,6 +89,16 @@ type SessionProvider struct {
 	flags                    sessionFlag
 	readPreference           mgo.Mode
 	tags                     bson.D
+	readPrefOptions          ReadPreferenceOptions
+	retryWrites              bool
+	retryReads               bool
+	socketTimeout            time.Duration
+	serverSelectionTimeout   time.Duration
+
+	// looks up the hosts of a mongodb+srv URI, nil for other URIs
+	srvSeedlist func() ([]string, error)
+	// closed to stop polling the SRV records
+	stopSRVPolling chan struct{}
 }
 
 // ApplyOpsResponse represents the response from an 'applyOps' command.
@@ -112,7 +132,9 @@ func (self *SessionProvider) GetSession() (*mgo.Session, error) {
 
 	// initialize the provider's master session
 	var err error
+	span := trace.Start("connect")
 	self.masterSession, err = self.connector.GetNewSession()
+	span.End(err)
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to db server: %v", err)
 	}
@@ -120,6 +142,11 @@ func (self *SessionProvider) GetSession() (*mgo.Session, error) {
 	// update masterSession based on flags
 	self.refresh()
 
+	if self.srvSeedlist != nil {
+		self.stopSRVPolling = make(chan struct{})
+		go self.pollSRV(self.stopSRVPolling)
+	}
+
 	// copy the provider's master session, for connection pooling
 	return self.masterSession.Copy(), nil
 }
@@ -128,11 +155,43 @@ func (self *SessionProvider) GetSession() (*mgo.Session, error) {
 func (self *SessionProvider) Close() {
 	self.masterSessionLock.Lock()
 	defer self.masterSessionLock.Unlock()
+	if self.stopSRVPolling != nil {
+		close(self.stopSRVPolling)
+		self.stopSRVPolling = nil
+	}
 	if self.masterSession != nil {
 		self.masterSession.Close()
 	}
 }
 
+// pollSRV looks up the SRV records of the URI every srvPollInterval and
+// updates the hosts of the master session with them, until stop is closed.
+// A failed lookup, or one finding no hosts, keeps the current hosts.
+func (self *SessionProvider) pollSRV(stop chan struct{}) {
+	ticker := time.NewTicker(srvPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		hosts, err := self.srvSeedlist()
+		if err != nil {
+			log.Logvf(log.DebugLow, "error polling SRV records, keeping the current hosts: %v", err)
+			continue
+		}
+		self.masterSessionLock.Lock()
+		select {
+		case <-stop:
+		default:
+			log.Logvf(log.DebugHigh, "updating hosts from SRV records: %v", hosts)
+			self.masterSession.UpdateSeeds(hosts)
+		}
+		self.masterSessionLock.Unlock()
+	}
+}
+
 // refresh is a helper for modifying the session based on the
 // session provider flags passed in with SetFlags.
 // This helper assumes a lock is already taken.
@@ -143,13 +202,26 @@ func (self *SessionProvider) refresh() {
 	// handle readPreference
 	self.masterSession.SetMode(self.readPreference, true)
 
-	// disable timeouts
+	// retry writes and reads once after a retryable error, such as an election
+	self.masterSession.SetRetryWrites(self.retryWrites)
+	self.masterSession.SetRetryReads(self.retryReads)
+
+	// disable timeouts, or set them from the options
 	if (self.flags & DisableSocketTimeout) > 0 {
 		self.masterSession.SetSocketTimeout(0)
+	} else if self.socketTimeout > 0 {
+		self.masterSession.SetSocketTimeout(self.socketTimeout)
+	}
+	if self.serverSelectionTimeout > 0 {
+		self.masterSession.SetSyncTimeout(self.serverSelectionTimeout)
 	}
 	if self.tags != nil {
 		self.masterSession.SelectServers(self.tags)
 	}
+	self.masterSession.SetMaxStaleness(self.readPrefOptions.MaxStaleness)
+	if self.readPrefOptions.Hedge != nil {
+		self.masterSession.SetHedgedReads(*self.readPrefOptions.Hedge)
+	}
 }
 
 // SetFlags allows certain modifications to the masterSession after initial creation.
@@ -178,6 +250,20 @@ func (self *SessionProvider) SetReadPreference(pref mgo.Mode) {
 	}
 }
 
+// SetReadPreferenceOptions sets the maxStalenessSeconds and hedge options
+// of the read preference in the SessionProvider and eventually in the
+// masterSession
+func (self *SessionProvider) SetReadPreferenceOptions(opts ReadPreferenceOptions) {
+	self.masterSessionLock.Lock()
+	defer self.masterSessionLock.Unlock()
+
+	self.readPrefOptions = opts
+
+	if self.masterSession != nil {
+		self.refresh()
+	}
+}
+
 // SetBypassDocumentValidation sets whether to bypass document validation in the SessionProvider
 // and eventually in the masterSession
 func (self *SessionProvider) SetBypassDocumentValidation(bypassDocumentValidation bool) {
@@ -217,6 +303,27 @@ func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
 	if opts.Auth.ShouldAskForPassword() {
 		opts.Auth.Password = password.Prompt()
 	}
+	if opts.SSL != nil && opts.SSLPEMKeyFile != "" && opts.SSLPEMKeyPassword == "" {
+		keyFile := opts.SSLPEMKeyFile
+		if opts.SSLKeyFile != "" {
+			keyFile = opts.SSLKeyFile
+		}
+		if keyFileIsEncrypted(keyFile) {
+			opts.SSLPEMKeyPassword = password.PromptFor("password for the private key")
+		}
+	}
+
+	if opts.Connection != nil {
+		provider.retryWrites = opts.RetryWrites == nil || *opts.RetryWrites
+		provider.retryReads = opts.RetryReads == nil || *opts.RetryReads
+		provider.socketTimeout = time.Duration(opts.SocketTimeoutMS) * time.Millisecond
+		provider.serverSelectionTimeout = time.Duration(opts.ServerSelectionTimeoutMS) * time.Millisecond
+	}
+	if opts.URI != nil {
+		if cs := opts.URI.ParsedConnString(); cs != nil && cs.UsingSRV {
+			provider.srvSeedlist = cs.FetchSRVSeedlist
+		}
+	}
 
 	// create the connector for dialing the database
 	provider.connector = getConnector(opts)
@@ -229,6 +336,27 @@ func NewSessionProvider(opts options.ToolOptions) (*SessionProvider, error) {
 	return provider, nil
 }
 
+// keyFileIsEncrypted returns true if the private key in a .pem file is
+// encrypted, either as PKCS#8 or as PKCS#1 with a DEK-Info header. Errors
+// reading the file are left for the connector to report.
+func keyFileIsEncrypted(path string) bool {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return false
+		}
+		if block.Type == "ENCRYPTED PRIVATE KEY" ||
+			(strings.HasSuffix(block.Type, "PRIVATE KEY") && x509.IsEncryptedPEMBlock(block)) {
+			return true
+		}
+	}
+}
+
 // IsConnectionError returns a boolean indicating if a given error is due to
 // an error in an underlying DB connection (as opposed to some other write
 // failure such as a duplicate key error)
@@ -251,6 +379,60 @@ func IsConnectionError(err error) bool {
 	return false
 }
 
+// Server error codes which indicate that an open cursor was lost because of
+// a stepdown, a shutdown, or a cursor timeout, rather than because the query
+// itself failed.
+var cursorLostErrorCodes = map[int]bool{
+	43:    true, // CursorNotFound
+	91:    true, // ShutdownInProgress
+	136:   true, // CappedPositionLost
+	189:   true, // PrimarySteppedDown
+	237:   true, // CursorKilled
+	10107: true, // NotMaster
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotMasterNoSlaveOk
+	13436: true, // NotMasterOrSecondary
+}
+
+// IsCursorLostError returns a boolean indicating if a given error means that
+// a cursor is no longer usable, either because the server discarded it or
+// because the connection was lost, such that re-issuing the query may succeed.
+func IsCursorLostError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == mgo.ErrCursor {
+		return true
+	}
+	if qerr, ok := err.(*mgo.QueryError); ok && cursorLostErrorCodes[qerr.Code] {
+		return true
+	}
+	if IsConnectionError(err) {
+		return true
+	}
+	return strings.Contains(strings.ToLower(err.Error()), ErrLostConnection)
+}
+
+// IsServerAPIError returns a boolean indicating if a given error means that
+// the server rejected a command because of the declared server API version:
+// the command is outside the version under --apiStrict, deprecated in it
+// under --apiDeprecationErrors, or the version is missing or unknown.
+func IsServerAPIError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if qerr, ok := err.(*mgo.QueryError); ok {
+		switch qerr.Code {
+		case mgo.APIVersionErrorCode, mgo.APIStrictErrorCode, mgo.APIDeprecationErrorCode:
+			return true
+		}
+	}
+	// wrapped errors only keep the server's message
+	message := err.Error()
+	return strings.Contains(message, "in API Version") || strings.Contains(message, "API version")
+}
+
 // Get the right type of connector, based on the options
 func getConnector(opts options.ToolOptions) DBConnector {
 	for _, getConnectorFunc := range GetConnectorFuncs {
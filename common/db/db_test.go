@@ -7,6 +7,9 @@
 package db
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"reflect"
 	"testing"
 
@@ -148,3 +151,50 @@ type listDatabasesCommand struct {
 func (self *listDatabasesCommand) AsRunnable() interface{} {
 	return "listDatabases"
 }
+
+func TestIsCursorLostError(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Errors from lost cursors should be recognized", t, func() {
+		So(IsCursorLostError(mgo.ErrCursor), ShouldBeTrue)
+		So(IsCursorLostError(&mgo.QueryError{Code: 43, Message: "cursor id 123 not found"}), ShouldBeTrue)
+		So(IsCursorLostError(&mgo.QueryError{Code: 11602, Message: "operation was interrupted"}), ShouldBeTrue)
+		So(IsCursorLostError(io.EOF), ShouldBeTrue)
+		So(IsCursorLostError(errors.New("lost connection to server")), ShouldBeTrue)
+	})
+
+	Convey("Other errors should not be recognized", t, func() {
+		So(IsCursorLostError(nil), ShouldBeFalse)
+		So(IsCursorLostError(&mgo.QueryError{Code: 2, Message: "bad query"}), ShouldBeFalse)
+		So(IsCursorLostError(errors.New("unauthorized")), ShouldBeFalse)
+	})
+}
+
+func TestIsServerAPIError(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Commands rejected because of the server API should be recognized", t, func() {
+		So(IsServerAPIError(&mgo.QueryError{Code: 323, Message: "Provided apiStrict:true, but the command listIndexes is not in API Version 1"}), ShouldBeTrue)
+		So(IsServerAPIError(fmt.Errorf("error reading indexes: %v", "Provided apiStrict:true, but the command listIndexes is not in API Version 1")), ShouldBeTrue)
+		So(IsServerAPIError(&mgo.QueryError{Code: 322, Message: "The apiVersion parameter is required"}), ShouldBeTrue)
+		So(IsServerAPIError(nil), ShouldBeFalse)
+		So(IsServerAPIError(&mgo.QueryError{Code: 2, Message: "bad query"}), ShouldBeFalse)
+	})
+}
+
+func TestKeyFileIsEncrypted(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Encrypted private keys should be recognized", t, func() {
+		So(keyFileIsEncrypted("tlsgo/testdata/pkcs1-encrypted.pem"), ShouldBeTrue)
+		So(keyFileIsEncrypted("tlsgo/testdata/pkcs8-encrypted-rev.pem"), ShouldBeTrue)
+		So(keyFileIsEncrypted("tlsgo/testdata/key-pkcs8-des3.pem"), ShouldBeTrue)
+	})
+
+	Convey("Unencrypted private keys and missing files should not be recognized", t, func() {
+		So(keyFileIsEncrypted("tlsgo/testdata/pkcs1.pem"), ShouldBeFalse)
+		So(keyFileIsEncrypted("tlsgo/testdata/pkcs8-rev.pem"), ShouldBeFalse)
+		So(keyFileIsEncrypted("tlsgo/testdata/cert.pem"), ShouldBeFalse)
+		So(keyFileIsEncrypted("tlsgo/testdata/missing.pem"), ShouldBeFalse)
+	})
+}
@@ -30,5 +30,7 @@ func AddKerberosOpts(opts options.ToolOptions, dialInfo *mgo.DialInfo) {
 	}
 	dialInfo.Service = opts.Kerberos.Service
 	dialInfo.ServiceHost = opts.Kerberos.ServiceHost
+	dialInfo.ServiceRealm = opts.Kerberos.ServiceRealm
+	dialInfo.CanonicalizeHostName = opts.Kerberos.CanonicalizeHostName
 	dialInfo.Mechanism = authMechanism
 }
@@ -15,7 +15,9 @@ import (
 	"time"
 
 	"github.com/10gen/openssl"
+	"github.com/mongodb/mongo-tools/common/db/aws"
 	"github.com/mongodb/mongo-tools/common/db/kerberos"
+	"github.com/mongodb/mongo-tools/common/db/proxy"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
@@ -46,7 +48,7 @@ func (self *SSLDBConnector) Configure(opts options.ToolOptions) error {
 	}
 	// create the dialer func that will be used to connect
 	dialer := func(addr *mgo.ServerAddr) (net.Conn, error) {
-		conn, err := openssl.Dial("tcp", addr.String(), self.ctx, flags)
+		conn, err := dial(opts, addr.String(), self.ctx, flags)
 		if err != nil {
 			// mgo discards dialer errors so log it now
 			log.Logvf(log.Always, "error dialing %v: %v", addr.String(), err)
@@ -67,14 +69,20 @@ func (self *SSLDBConnector) Configure(opts options.ToolOptions) error {
 
 	// set up the dial info
 	self.dialInfo = &mgo.DialInfo{
-		Timeout:        timeout,
-		Direct:         opts.Direct,
-		ReplicaSetName: opts.ReplicaSetName,
-		DialServer:     dialer,
-		Username:       opts.Auth.Username,
-		Password:       opts.Auth.Password,
-		Source:         opts.GetAuthenticationDatabase(),
-		Mechanism:      opts.Auth.Mechanism,
+		Timeout:              timeout,
+		Direct:               opts.Direct,
+		ReplicaSetName:       opts.ReplicaSetName,
+		DialServer:           dialer,
+		Username:             opts.Auth.Username,
+		Password:             opts.Auth.Password,
+		Source:               opts.GetAuthenticationDatabase(),
+		Mechanism:            opts.Auth.Mechanism,
+		PoolLimit:            opts.MaxPoolSize,
+		MinPoolSize:          opts.MinPoolSize,
+		MaxIdleTimeMS:        opts.MaxIdleTimeMS,
+		HeartbeatFrequencyMS: opts.HeartbeatFrequencyMS,
+		Compressors:          opts.GetCompressors(),
+		ServerAPI:            &mgo.ServerAPI{Version: opts.APIVersion, Strict: opts.APIStrict, DeprecationErrors: opts.APIDeprecationErrors},
 	}
 
 	// create or fetch the addresses to be used to connect
@@ -84,6 +92,9 @@ func (self *SSLDBConnector) Configure(opts options.ToolOptions) error {
 		self.dialInfo.Addrs = util.CreateConnectionAddrs(opts.Host, opts.Port)
 	}
 	kerberos.AddKerberosOpts(opts, self.dialInfo)
+	if err := aws.AddAWSOpts(opts, self.dialInfo); err != nil {
+		return err
+	}
 	return nil
 
 }
@@ -93,6 +104,38 @@ func (self *SSLDBConnector) GetNewSession() (*mgo.Session, error) {
 	return mgo.DialWithInfo(self.dialInfo)
 }
 
+// dial connects to addr and does the SSL handshake as openssl.Dial does,
+// connecting through the proxy if one is given.
+func dial(opts options.ToolOptions, addr string, ctx *openssl.Ctx, flags openssl.DialFlags) (*openssl.Conn, error) {
+	if opts.Connection == nil || opts.ProxyHost == "" {
+		return openssl.Dial("tcp", addr, ctx, flags)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	tcpConn, err := proxy.Dial(opts, addr, 0)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := openssl.Client(tcpConn, ctx)
+	if err != nil {
+		tcpConn.Close()
+		return nil, err
+	}
+	if err = conn.SetTlsExtHostName(host); err == nil {
+		err = conn.Handshake()
+	}
+	if err == nil && flags&openssl.InsecureSkipHostVerification == 0 {
+		err = conn.VerifyHostname(host)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
 // To be handed to mgo.DialInfo for connecting to the server.
 type dialerFunc func(addr *mgo.ServerAddr) (net.Conn, error)
 
@@ -127,19 +170,43 @@ func setupCtx(opts options.ToolOptions) (*openssl.Ctx, error) {
 	// !aNULL - Disable anonymous auth ciphers
 	// @STRENGTH - Sort ciphers based on strength
 	ctx.SetCipherList("HIGH:!EXPORT:!aNULL@STRENGTH")
+	if opts.TLSCipherSuites != "" {
+		if err = ctx.SetCipherList(opts.TLSCipherSuites); err != nil {
+			return nil, fmt.Errorf("invalid --tlsCipherSuites: %v", err)
+		}
+	}
+
+	// disable the TLS versions older than --tlsMinVersion; TLS 1.3, where the
+	// library supports it, is never disabled
+	switch opts.TLSMinVersion {
+	case "1.1":
+		ctx.SetOptions(openssl.NoTLSv1)
+	case "1.2":
+		ctx.SetOptions(openssl.NoTLSv1 | openssl.NoTLSv1_1)
+	case "1.3":
+		ctx.SetOptions(openssl.NoTLSv1 | openssl.NoTLSv1_1 | openssl.NoTLSv1_2)
+	}
+
+	if opts.TLSVerifyOCSPStapling {
+		return nil, fmt.Errorf("--tlsVerifyOCSPStapling is not supported when built with OpenSSL")
+	}
 
 	// add the PEM key file with the cert and private key, if specified
 	if opts.SSLPEMKeyFile != "" {
 		if err = ctx.UseCertificateChainFile(opts.SSLPEMKeyFile); err != nil {
 			return nil, fmt.Errorf("UseCertificateChainFile: %v", err)
 		}
+		keyFile := opts.SSLPEMKeyFile
+		if opts.SSLKeyFile != "" {
+			keyFile = opts.SSLKeyFile
+		}
 		if opts.SSLPEMKeyPassword != "" {
 			if err = ctx.UsePrivateKeyFileWithPassword(
-				opts.SSLPEMKeyFile, openssl.FiletypePEM, opts.SSLPEMKeyPassword); err != nil {
+				keyFile, openssl.FiletypePEM, opts.SSLPEMKeyPassword); err != nil {
 				return nil, fmt.Errorf("UsePrivateKeyFile: %v", err)
 			}
 		} else {
-			if err = ctx.UsePrivateKeyFile(opts.SSLPEMKeyFile, openssl.FiletypePEM); err != nil {
+			if err = ctx.UsePrivateKeyFile(keyFile, openssl.FiletypePEM); err != nil {
 				return nil, fmt.Errorf("UsePrivateKeyFile: %v", err)
 			}
 		}
@@ -187,7 +254,9 @@ func setupCtx(opts options.ToolOptions) (*openssl.Ctx, error) {
 		if err != nil {
 			return nil, fmt.Errorf("AddLookup(X509LookupFile()): %v", err)
 		}
-		lookup.LoadCRLFile(opts.SSLCRLFile)
+		if err = lookup.LoadCRLFile(opts.SSLCRLFile); err != nil {
+			return nil, fmt.Errorf("LoadCRLFile: %v", err)
+		}
 	}
 
 	return ctx, nil
@@ -0,0 +1,121 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/throttle"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultPrefetchSize is the number of documents a PrefetchingIter reads
+// ahead of its consumer when no batch size is known.
+const DefaultPrefetchSize = 1000
+
+// Iterator is a cursor over the documents of a query, as implemented by
+// *mgo.Iter.
+type Iterator interface {
+	Next(result interface{}) bool
+	Err() error
+	Close() error
+}
+
+// PrefetchingIter reads the documents of a cursor in its own goroutine, up
+// to a batch of documents ahead of its consumer. Together with a session
+// prefetch of 1.0, which requests the next batch as soon as one arrives,
+// the next batch is fetched while the current one is being written out
+// instead of after it.
+type PrefetchingIter struct {
+	iter    Iterator
+	limiter *throttle.Limiter
+	docs    chan bson.Raw
+	done    chan struct{}
+	stop    sync.Once
+
+	// err is set by the reading goroutine before docs is closed
+	err       error
+	decodeErr error
+}
+
+// NewPrefetchingIter starts reading the documents of iter, buffering up to
+// size of them. The time each read takes, which includes waiting on the
+// server for a batch, is reported to the limiter, if there is one; callers
+// that throttle reads should keep size small, as the documents are read
+// ahead of their throttle.
+func NewPrefetchingIter(iter Iterator, size int, limiter *throttle.Limiter) *PrefetchingIter {
+	if size <= 0 {
+		size = DefaultPrefetchSize
+	}
+	p := &PrefetchingIter{
+		iter:    iter,
+		limiter: limiter,
+		docs:    make(chan bson.Raw, size),
+		done:    make(chan struct{}),
+	}
+	go p.prefetch()
+	return p
+}
+
+func (p *PrefetchingIter) prefetch() {
+	defer close(p.docs)
+	for {
+		raw := bson.Raw{}
+		start := time.Now()
+		if !p.iter.Next(&raw) {
+			p.err = p.iter.Err()
+			return
+		}
+		p.limiter.Observe(time.Since(start))
+		select {
+		case p.docs <- raw:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Next decodes the next document into result, waiting for it to be read if
+// it hasn't been yet. It returns false once the cursor is exhausted or
+// fails, after which Err returns the error, if any.
+func (p *PrefetchingIter) Next(result interface{}) bool {
+	if p.decodeErr != nil {
+		return false
+	}
+	raw, ok := <-p.docs
+	if !ok {
+		return false
+	}
+	if out, ok := result.(*bson.Raw); ok {
+		*out = raw
+		return true
+	}
+	if err := raw.Unmarshal(result); err != nil {
+		p.decodeErr = err
+		return false
+	}
+	return true
+}
+
+// Err returns the error that ended the iteration, if any. It must only be
+// called once Next has returned false.
+func (p *PrefetchingIter) Err() error {
+	if p.decodeErr != nil {
+		return p.decodeErr
+	}
+	return p.err
+}
+
+// Close stops reading documents and closes the underlying cursor.
+func (p *PrefetchingIter) Close() error {
+	p.stop.Do(func() { close(p.done) })
+	// wait for the reading goroutine, so the cursor isn't used once closed
+	for range p.docs {
+	}
+	return p.iter.Close()
+}
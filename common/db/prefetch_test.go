@@ -0,0 +1,134 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/common/throttle"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// sliceIter is an Iterator over marshaled documents, failing with err once
+// they are used up.
+type sliceIter struct {
+	docs   [][]byte
+	err    error
+	read   int
+	closed bool
+	// delay is how long reading each document takes
+	delay time.Duration
+}
+
+func newSliceIter(count int, err error) *sliceIter {
+	iter := &sliceIter{err: err}
+	for i := 0; i < count; i++ {
+		data, err := bson.Marshal(bson.D{{"_id", i}})
+		if err != nil {
+			panic(err)
+		}
+		iter.docs = append(iter.docs, data)
+	}
+	return iter
+}
+
+func (iter *sliceIter) Next(result interface{}) bool {
+	if iter.closed || iter.read == len(iter.docs) {
+		return false
+	}
+	time.Sleep(iter.delay)
+	*result.(*bson.Raw) = bson.Raw{Kind: 0x03, Data: iter.docs[iter.read]}
+	iter.read++
+	return true
+}
+
+func (iter *sliceIter) Err() error {
+	if iter.read < len(iter.docs) {
+		return nil
+	}
+	return iter.err
+}
+
+func (iter *sliceIter) Close() error {
+	iter.closed = true
+	return nil
+}
+
+func TestPrefetchingIter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a prefetching iterator over a cursor", t, func() {
+		Convey("all documents should be decoded in order", func() {
+			cursor := NewPrefetchingIter(newSliceIter(25, nil), 4, nil)
+			var doc bson.D
+			for i := 0; i < 25; i++ {
+				So(cursor.Next(&doc), ShouldBeTrue)
+				So(doc, ShouldResemble, bson.D{{"_id", i}})
+			}
+			So(cursor.Next(&doc), ShouldBeFalse)
+			So(cursor.Err(), ShouldBeNil)
+			So(cursor.Close(), ShouldBeNil)
+		})
+
+		Convey("raw documents should be returned as read", func() {
+			iter := newSliceIter(2, nil)
+			cursor := NewPrefetchingIter(iter, 0, nil)
+			raw := bson.Raw{}
+			So(cursor.Next(&raw), ShouldBeTrue)
+			So(raw.Data, ShouldResemble, iter.docs[0])
+		})
+
+		Convey("the error of the cursor should be returned after its documents", func() {
+			cursor := NewPrefetchingIter(newSliceIter(3, fmt.Errorf("cursor not found")), 1, nil)
+			var doc bson.M
+			for i := 0; i < 3; i++ {
+				So(cursor.Next(&doc), ShouldBeTrue)
+			}
+			So(cursor.Next(&doc), ShouldBeFalse)
+			So(cursor.Err(), ShouldResemble, fmt.Errorf("cursor not found"))
+		})
+
+		Convey("a document that can't be decoded should end the iteration", func() {
+			iter := newSliceIter(3, nil)
+			iter.docs[0] = iter.docs[0][:len(iter.docs[0])-2]
+			cursor := NewPrefetchingIter(iter, 1, nil)
+			var doc bson.D
+			So(cursor.Next(&doc), ShouldBeFalse)
+			So(cursor.Err(), ShouldNotBeNil)
+			So(cursor.Next(&doc), ShouldBeFalse)
+			So(cursor.Close(), ShouldBeNil)
+		})
+
+		Convey("slow reads should be reported to the limiter", func() {
+			iter := newSliceIter(1, nil)
+			iter.delay = 100 * time.Millisecond
+			// without a rate, a read over the latency target holds back
+			// the next ones for as long as it overran
+			limiter := throttle.New(0, 0, 10*time.Millisecond)
+			cursor := NewPrefetchingIter(iter, 1, limiter)
+			var doc bson.D
+			So(cursor.Next(&doc), ShouldBeTrue)
+			start := time.Now()
+			limiter.Wait(1, 0)
+			So(time.Since(start), ShouldBeGreaterThan, 20*time.Millisecond)
+		})
+
+		Convey("closing it early should stop reading and close the cursor", func() {
+			iter := newSliceIter(100, nil)
+			cursor := NewPrefetchingIter(iter, 2, nil)
+			var doc bson.D
+			So(cursor.Next(&doc), ShouldBeTrue)
+			So(cursor.Close(), ShouldBeNil)
+			So(iter.closed, ShouldBeTrue)
+			So(iter.read, ShouldBeLessThan, 100)
+		})
+	})
+}
@@ -0,0 +1,231 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package proxy implements connecting to MongoDB through a SOCKS5 or HTTP
+// proxy
+package proxy
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/options"
+)
+
+// the default ports of the proxy types
+var defaultPorts = map[string]int{
+	"socks5": 1080,
+	"http":   8080,
+}
+
+// Dial connects to addr, through the proxy given in opts if there is one.
+// The timeout covers connecting to the proxy and its handshake; zero means
+// no timeout.
+func Dial(opts options.ToolOptions, addr string, timeout time.Duration) (net.Conn, error) {
+	if opts.Connection == nil || opts.ProxyHost == "" {
+		return net.DialTimeout("tcp", addr, timeout)
+	}
+
+	proxyType := opts.ProxyType
+	if proxyType == "" {
+		proxyType = "socks5"
+	}
+	port := opts.ProxyPort
+	if port == 0 {
+		port = defaultPorts[proxyType]
+	}
+	proxyAddr := net.JoinHostPort(opts.ProxyHost, strconv.Itoa(port))
+
+	conn, err := net.DialTimeout("tcp", proxyAddr, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to proxy %v: %v", proxyAddr, err)
+	}
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+	}
+	switch proxyType {
+	case "socks5":
+		err = socks5Connect(conn, addr, opts.ProxyUsername, opts.ProxyPassword)
+	case "http":
+		err = httpConnect(conn, addr, opts.ProxyUsername, opts.ProxyPassword)
+	default:
+		err = fmt.Errorf("unsupported proxy type '%v'", proxyType)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error connecting to %v through proxy %v: %v", addr, proxyAddr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// SOCKS5 protocol values, from RFC 1928 and RFC 1929
+const (
+	socks5Version        = 0x05
+	socks5NoAuth         = 0x00
+	socks5PasswordAuth   = 0x02
+	socks5NoAcceptable   = 0xFF
+	socks5PasswordAuthV1 = 0x01
+	socks5CmdConnect     = 0x01
+	socks5IPv4           = 0x01
+	socks5Domain         = 0x03
+	socks5IPv6           = 0x04
+)
+
+var socks5Errors = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// socks5Connect asks the SOCKS5 proxy at the other end of conn to connect to
+// addr, authenticating with the username and password if they are given.
+// Host names are resolved by the proxy.
+func socks5Connect(conn net.Conn, addr, username, password string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 0 || port > 65535 {
+		return fmt.Errorf("invalid port '%v'", portStr)
+	}
+
+	methods := []byte{socks5NoAuth}
+	if username != "" {
+		methods = []byte{socks5NoAuth, socks5PasswordAuth}
+	}
+	greeting := append([]byte{socks5Version, byte(len(methods))}, methods...)
+	if _, err = conn.Write(greeting); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != socks5Version {
+		return fmt.Errorf("not a SOCKS5 proxy")
+	}
+	switch reply[1] {
+	case socks5NoAuth:
+	case socks5PasswordAuth:
+		if username == "" {
+			return fmt.Errorf("the proxy requires a username and password")
+		}
+		if len(username) > 255 || len(password) > 255 {
+			return fmt.Errorf("the proxy username and password must be at most 255 bytes")
+		}
+		request := []byte{socks5PasswordAuthV1, byte(len(username))}
+		request = append(request, username...)
+		request = append(request, byte(len(password)))
+		request = append(request, password...)
+		if _, err = conn.Write(request); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return fmt.Errorf("proxy authentication failed")
+		}
+	case socks5NoAcceptable:
+		return fmt.Errorf("the proxy accepts none of the authentication methods offered")
+	default:
+		return fmt.Errorf("the proxy chose an unsupported authentication method %v", reply[1])
+	}
+
+	request := []byte{socks5Version, socks5CmdConnect, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return fmt.Errorf("host name '%v' is too long", host)
+		}
+		request = append(request, socks5Domain, byte(len(host)))
+		request = append(request, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		request = append(request, socks5IPv4)
+		request = append(request, ip4...)
+	} else {
+		request = append(request, socks5IPv6)
+		request = append(request, ip...)
+	}
+	portBytes := make([]byte, 2)
+	binary.BigEndian.PutUint16(portBytes, uint16(port))
+	request = append(request, portBytes...)
+	if _, err = conn.Write(request); err != nil {
+		return err
+	}
+
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		if reason, ok := socks5Errors[header[1]]; ok {
+			return fmt.Errorf("proxy error: %v", reason)
+		}
+		return fmt.Errorf("proxy error %v", header[1])
+	}
+	// skip the address the proxy bound, and its port
+	var skip int
+	switch header[3] {
+	case socks5IPv4:
+		skip = net.IPv4len + 2
+	case socks5IPv6:
+		skip = net.IPv6len + 2
+	case socks5Domain:
+		length := make([]byte, 1)
+		if _, err = io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0]) + 2
+	default:
+		return fmt.Errorf("proxy replied with an unknown address type %v", header[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip))
+	return err
+}
+
+// httpConnect asks the HTTP proxy at the other end of conn to open a tunnel
+// to addr with a CONNECT request, authenticating with the username and
+// password if they are given.
+func httpConnect(conn net.Conn, addr, username, password string) error {
+	request := "CONNECT " + addr + " HTTP/1.1\r\nHost: " + addr + "\r\n"
+	if username != "" {
+		credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+		request += "Proxy-Authorization: Basic " + credentials + "\r\n"
+	}
+	if _, err := io.WriteString(conn, request+"\r\n"); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, &http.Request{Method: "CONNECT"})
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("proxy replied %v", response.Status)
+	}
+	// the server doesn't speak first, so nothing past the response can have
+	// been read
+	if reader.Buffered() > 0 {
+		return fmt.Errorf("unexpected data from the proxy after its response")
+	}
+	return nil
+}
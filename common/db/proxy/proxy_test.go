@@ -0,0 +1,212 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package proxy
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// listen serves every connection accepted on a local port with handle, and
+// returns the port.
+func listen(handle func(net.Conn)) (net.Listener, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	So(err, ShouldBeNil)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return listener, listener.Addr().(*net.TCPAddr).Port
+}
+
+func echo(conn net.Conn) {
+	defer conn.Close()
+	io.Copy(conn, conn)
+}
+
+// tunnel connects conn to addr, in both directions.
+func tunnel(conn net.Conn, addr string) {
+	target, err := net.Dial("tcp", addr)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go func() {
+		io.Copy(target, conn)
+		target.Close()
+	}()
+	io.Copy(conn, target)
+	conn.Close()
+}
+
+// socks5Server is a minimal SOCKS5 proxy that requires the username "user"
+// and password "pass" if auth is set, and only accepts host names.
+func socks5Server(auth bool) func(net.Conn) {
+	return func(conn net.Conn) {
+		header := make([]byte, 2)
+		io.ReadFull(conn, header)
+		methods := make([]byte, header[1])
+		io.ReadFull(conn, methods)
+		if !auth {
+			conn.Write([]byte{5, 0})
+		} else {
+			conn.Write([]byte{5, 2})
+			request := make([]byte, 2)
+			io.ReadFull(conn, request)
+			username := make([]byte, request[1])
+			io.ReadFull(conn, username)
+			io.ReadFull(conn, request[:1])
+			password := make([]byte, request[0])
+			io.ReadFull(conn, password)
+			if string(username) != "user" || string(password) != "pass" {
+				conn.Write([]byte{1, 1})
+				conn.Close()
+				return
+			}
+			conn.Write([]byte{1, 0})
+		}
+
+		request := make([]byte, 5)
+		io.ReadFull(conn, request)
+		if request[3] != socks5Domain {
+			conn.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0})
+			conn.Close()
+			return
+		}
+		host := make([]byte, request[4]+2)
+		io.ReadFull(conn, host)
+		port := binary.BigEndian.Uint16(host[len(host)-2:])
+		addr := net.JoinHostPort(string(host[:len(host)-2]), strconv.Itoa(int(port)))
+		conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+		tunnel(conn, addr)
+	}
+}
+
+// httpServer is a minimal HTTP proxy handling CONNECT requests.
+func httpServer(conn net.Conn) {
+	request, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil || request.Method != "CONNECT" {
+		conn.Close()
+		return
+	}
+	if request.Header.Get("Proxy-Authorization") != "Basic dXNlcjpwYXNz" {
+		io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+		conn.Close()
+		return
+	}
+	io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+	tunnel(conn, request.Host)
+}
+
+func checkEcho(conn net.Conn) {
+	_, err := conn.Write([]byte("ping"))
+	So(err, ShouldBeNil)
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	So(err, ShouldBeNil)
+	So(string(reply), ShouldEqual, "ping")
+}
+
+func TestDial(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an echo server", t, func() {
+		server, port := listen(echo)
+		defer server.Close()
+		addr := "localhost:" + strconv.Itoa(port)
+		opts := options.ToolOptions{Connection: &options.Connection{}}
+
+		Convey("it should be reached directly without a proxy", func() {
+			conn, err := Dial(opts, addr, time.Second)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			checkEcho(conn)
+		})
+
+		Convey("it should be reached through a SOCKS5 proxy", func() {
+			proxy, proxyPort := listen(socks5Server(false))
+			defer proxy.Close()
+			opts.ProxyHost, opts.ProxyPort, opts.ProxyType = "127.0.0.1", proxyPort, "socks5"
+
+			conn, err := Dial(opts, addr, time.Second)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+			checkEcho(conn)
+		})
+
+		Convey("with a SOCKS5 proxy requiring authentication", func() {
+			proxy, proxyPort := listen(socks5Server(true))
+			defer proxy.Close()
+			opts.ProxyHost, opts.ProxyPort, opts.ProxyType = "127.0.0.1", proxyPort, "socks5"
+
+			Convey("the right credentials should be accepted", func() {
+				opts.ProxyUsername, opts.ProxyPassword = "user", "pass"
+				conn, err := Dial(opts, addr, time.Second)
+				So(err, ShouldBeNil)
+				defer conn.Close()
+				checkEcho(conn)
+			})
+
+			Convey("wrong credentials should be an error", func() {
+				opts.ProxyUsername, opts.ProxyPassword = "user", "wrong"
+				_, err := Dial(opts, addr, time.Second)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "authentication failed")
+			})
+
+			Convey("no credentials should be an error", func() {
+				_, err := Dial(opts, addr, time.Second)
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("a SOCKS5 error should be reported", func() {
+			proxy, proxyPort := listen(socks5Server(false))
+			defer proxy.Close()
+			opts.ProxyHost, opts.ProxyPort, opts.ProxyType = "127.0.0.1", proxyPort, "socks5"
+
+			_, err := Dial(opts, "127.0.0.1:"+strconv.Itoa(port), time.Second)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "address type not supported")
+		})
+
+		Convey("with an HTTP proxy", func() {
+			proxy, proxyPort := listen(httpServer)
+			defer proxy.Close()
+			opts.ProxyHost, opts.ProxyPort, opts.ProxyType = "127.0.0.1", proxyPort, "http"
+
+			Convey("it should be reached with the right credentials", func() {
+				opts.ProxyUsername, opts.ProxyPassword = "user", "pass"
+				conn, err := Dial(opts, addr, time.Second)
+				So(err, ShouldBeNil)
+				defer conn.Close()
+				checkEcho(conn)
+			})
+
+			Convey("a refusal should be an error", func() {
+				_, err := Dial(opts, addr, time.Second)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "407")
+			})
+		})
+	})
+}
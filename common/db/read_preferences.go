@@ -8,6 +8,7 @@ package db
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/mongodb/mongo-tools/common/json"
 	"gopkg.in/mgo.v2"
@@ -15,43 +16,95 @@ import (
 )
 
 type readPrefDoc struct {
-	Mode string
-	Tags bson.D
+	Mode                string
+	Tags                bson.D
+	MaxStalenessSeconds *int `json:"maxStalenessSeconds"`
+	Hedge               *hedgeDoc
+}
+
+type hedgeDoc struct {
+	Enabled bool
+}
+
+// ReadPreferenceOptions are the parts of a read preference besides its mode
+// and tags.
+type ReadPreferenceOptions struct {
+	// MaxStaleness, if not zero, keeps reads away from secondaries whose
+	// replication lags further behind.
+	MaxStaleness time.Duration
+	// Hedge, if set, enables or disables hedged reads on mongos.
+	Hedge *bool
 }
 
 const (
 	WarningNonPrimaryMongosConnection = "Warning: using a non-primary readPreference with a " +
 		"connection to mongos may produce inconsistent duplicates or miss some documents."
+
+	// MinMaxStalenessSeconds is the smallest maxStalenessSeconds servers
+	// accept.
+	MinMaxStalenessSeconds = 90
 )
 
 func ParseReadPreference(rp string) (mgo.Mode, bson.D, error) {
-	var mode string
-	var tags bson.D
+	mode, tags, _, err := parseReadPreference(rp)
+	return mode, tags, err
+}
+
+// ParseReadPreferenceOptions returns the maxStalenessSeconds and hedge
+// options of a read preference, which only a JSON object can hold, as in
+// {mode: "nearest", maxStalenessSeconds: 120, hedge: {enabled: true}}.
+func ParseReadPreferenceOptions(rp string) (ReadPreferenceOptions, error) {
+	_, _, opts, err := parseReadPreference(rp)
+	return opts, err
+}
+
+func parseReadPreference(rp string) (mgo.Mode, bson.D, ReadPreferenceOptions, error) {
+	var opts ReadPreferenceOptions
 	if rp == "" {
-		return mgo.Nearest, nil, nil
+		return mgo.Nearest, nil, opts, nil
 	}
+	var doc readPrefDoc
 	if rp[0] != '{' {
-		mode = rp
+		doc.Mode = rp
 	} else {
-		var doc readPrefDoc
 		err := json.Unmarshal([]byte(rp), &doc)
 		if err != nil {
-			return 0, nil, fmt.Errorf("invalid --ReadPreferences json object: %v", err)
+			return 0, nil, opts, fmt.Errorf("invalid --ReadPreferences json object: %v", err)
 		}
-		tags = doc.Tags
-		mode = doc.Mode
 	}
-	switch mode {
+
+	var mode mgo.Mode
+	switch doc.Mode {
 	case "primary":
-		return mgo.Primary, tags, nil
+		mode = mgo.Primary
 	case "primaryPreferred":
-		return mgo.PrimaryPreferred, tags, nil
+		mode = mgo.PrimaryPreferred
 	case "secondary":
-		return mgo.Secondary, tags, nil
+		mode = mgo.Secondary
 	case "secondaryPreferred":
-		return mgo.SecondaryPreferred, tags, nil
+		mode = mgo.SecondaryPreferred
 	case "nearest":
-		return mgo.Nearest, tags, nil
+		mode = mgo.Nearest
+	default:
+		return 0, nil, opts, fmt.Errorf("invalid readPreference mode '%v'", doc.Mode)
+	}
+
+	// -1 means no maximum, as in connection strings
+	if doc.MaxStalenessSeconds != nil && *doc.MaxStalenessSeconds != -1 {
+		switch seconds := *doc.MaxStalenessSeconds; {
+		case mode == mgo.Primary:
+			return 0, nil, opts, fmt.Errorf("maxStalenessSeconds can't be used with the primary readPreference mode")
+		case seconds < MinMaxStalenessSeconds:
+			return 0, nil, opts, fmt.Errorf("invalid maxStalenessSeconds %v: must be at least %v", seconds, MinMaxStalenessSeconds)
+		default:
+			opts.MaxStaleness = time.Duration(seconds) * time.Second
+		}
+	}
+	if doc.Hedge != nil {
+		if mode == mgo.Primary {
+			return 0, nil, opts, fmt.Errorf("hedged reads can't be used with the primary readPreference mode")
+		}
+		opts.Hedge = &doc.Hedge.Enabled
 	}
-	return 0, nil, fmt.Errorf("invalid readPreference mode '%v'", mode)
+	return mode, doc.Tags, opts, nil
 }
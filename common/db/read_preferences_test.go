@@ -0,0 +1,62 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseReadPreference(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Read preferences should be parsed", t, func() {
+		Convey("from a mode name", func() {
+			mode, tags, err := ParseReadPreference("secondaryPreferred")
+			So(err, ShouldBeNil)
+			So(mode, ShouldEqual, mgo.SecondaryPreferred)
+			So(tags, ShouldBeNil)
+			opts, err := ParseReadPreferenceOptions("secondaryPreferred")
+			So(err, ShouldBeNil)
+			So(opts, ShouldResemble, ReadPreferenceOptions{})
+
+			_, _, err = ParseReadPreference("fastest")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("from a JSON object with tags, maxStalenessSeconds and hedge", func() {
+			rp := `{mode: "nearest", tags: {dc: "east"}, maxStalenessSeconds: 120, hedge: {enabled: true}}`
+			mode, tags, err := ParseReadPreference(rp)
+			So(err, ShouldBeNil)
+			So(mode, ShouldEqual, mgo.Nearest)
+			So(tags, ShouldResemble, bson.D{{"dc", "east"}})
+			opts, err := ParseReadPreferenceOptions(rp)
+			So(err, ShouldBeNil)
+			So(opts.MaxStaleness, ShouldEqual, 120*time.Second)
+			So(*opts.Hedge, ShouldBeTrue)
+
+			opts, err = ParseReadPreferenceOptions(`{mode: "secondary", maxStalenessSeconds: -1, hedge: {enabled: false}}`)
+			So(err, ShouldBeNil)
+			So(opts.MaxStaleness, ShouldEqual, 0)
+			So(*opts.Hedge, ShouldBeFalse)
+		})
+
+		Convey("rejecting invalid maxStalenessSeconds and hedge options", func() {
+			_, err := ParseReadPreferenceOptions(`{mode: "secondary", maxStalenessSeconds: 30}`)
+			So(err, ShouldNotBeNil)
+			_, err = ParseReadPreferenceOptions(`{mode: "primary", maxStalenessSeconds: 120}`)
+			So(err, ShouldNotBeNil)
+			_, err = ParseReadPreferenceOptions(`{mode: "primary", hedge: {enabled: true}}`)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -12,19 +12,35 @@ package tlsgo
 import (
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/hex"
 	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"strings"
+
+	"github.com/mongodb/mongo-tools/common/fips"
 )
 
 // TLSConfig contains options for configuring an SSL connection to the server.
 type TLSConfig struct {
-	caCert     *x509.Certificate
-	clientCert *tls.Certificate
-	insecure   bool
+	caCert       *x509.Certificate
+	clientCert   *tls.Certificate
+	insecure     bool
+	minVersion   uint16
+	cipherSuites []uint16
+	crl          *pkix.CertificateList
+	verifyOCSP   bool
+	fips         bool
+}
+
+// tlsVersions are the TLS versions, by the names --tlsMinVersion takes.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
 }
 
 // NewTLSConfig creates a new TLSConfig.
@@ -39,9 +55,76 @@ func (c *TLSConfig) SetInsecure(allow bool) {
 	c.insecure = allow
 }
 
+// SetMinVersion sets the oldest TLS version to accept, given as "1.0", "1.1",
+// "1.2" or "1.3". An empty version leaves the default of the Go TLS library.
+func (c *TLSConfig) SetMinVersion(version string) error {
+	if version == "" {
+		c.minVersion = 0
+		return nil
+	}
+	v, ok := tlsVersions[version]
+	if !ok {
+		return fmt.Errorf("unsupported TLS version '%v'", version)
+	}
+	c.minVersion = v
+	return nil
+}
+
+// SetCipherSuites sets the cipher suites to allow for TLS 1.2 and older, given
+// as a comma-separated list of their IANA names, such as
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256. The cipher suites of TLS 1.3 can't
+// be restricted.
+func (c *TLSConfig) SetCipherSuites(list string) error {
+	byName := map[string]uint16{}
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		byName[suite.Name] = suite.ID
+	}
+	var suites []uint16
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("unsupported cipher suite '%v'", name)
+		}
+		suites = append(suites, id)
+	}
+	if len(suites) == 0 {
+		return fmt.Errorf("no cipher suites given")
+	}
+	c.cipherSuites = suites
+	return nil
+}
+
+// AddCRLFromFile adds a certificate revocation list, PEM or DER encoded, to
+// the configuration given a path to the containing file. A server
+// certificate it lists is rejected.
+func (c *TLSConfig) AddCRLFromFile(crlFile string) error {
+	data, err := ioutil.ReadFile(crlFile)
+	if err != nil {
+		return err
+	}
+	crl, err := x509.ParseCRL(data)
+	if err != nil {
+		return fmt.Errorf("invalid CRL file %v: %v", crlFile, err)
+	}
+	c.crl = crl
+	return nil
+}
+
+// SetVerifyOCSPStapling sets whether to check the OCSP response the server
+// staples to its certificate, if any, rejecting a revoked certificate.
+func (c *TLSConfig) SetVerifyOCSPStapling(verify bool) {
+	c.verifyOCSP = verify
+}
+
 // AddClientCertFromFile adds a client certificate to the configuration given a path to the
-// containing file and returns the certificate's subject name.
-func (c *TLSConfig) AddClientCertFromFile(clientFile, password string) (string, error) {
+// containing file and returns the certificate's subject name. The private key is read from
+// keyFile, or from clientFile if keyFile is empty. It may be PKCS#1 or PKCS#8, and encrypted
+// with the password.
+func (c *TLSConfig) AddClientCertFromFile(clientFile, keyFile, password string) (string, error) {
 	data, err := ioutil.ReadFile(clientFile)
 	if err != nil {
 		return "", err
@@ -52,14 +135,27 @@ func (c *TLSConfig) AddClientCertFromFile(clientFile, password string) (string,
 		return "", err
 	}
 
+	if keyFile != "" {
+		if data, err = ioutil.ReadFile(keyFile); err != nil {
+			return "", err
+		}
+	}
 	keyPEM, err := loadPEMBlock(data, "PRIVATE KEY")
 	if err != nil {
 		return "", err
 	}
-	// This check only covers encrypted PEM data with a DEK-Info header. It
-	// does not detect unencrypted PEM containing PKCS#8 format data with an
-	// encrypted private key.
-	if x509.IsEncryptedPEMBlock(keyPEM) {
+	switch {
+	case keyPEM.Type == "ENCRYPTED PRIVATE KEY":
+		if password == "" {
+			return "", fmt.Errorf("No password provided to decrypt private key")
+		}
+		decrypted, err := decryptPKCS8(keyPEM.Bytes, []byte(password))
+		if err != nil {
+			return "", err
+		}
+		keyPEM = &pem.Block{Bytes: decrypted, Type: "PRIVATE KEY"}
+	case x509.IsEncryptedPEMBlock(keyPEM):
+		// PKCS#1 encrypted PEM data with a DEK-Info header
 		if password == "" {
 			return "", fmt.Errorf("No password provided to decrypt private key")
 		}
@@ -70,10 +166,6 @@ func (c *TLSConfig) AddClientCertFromFile(clientFile, password string) (string,
 		keyPEM = &pem.Block{Bytes: decrypted, Type: keyPEM.Type}
 	}
 
-	if strings.Contains(keyPEM.Type, "ENCRYPTED") {
-		return "", fmt.Errorf("PKCS#8 encrypted private keys are not supported")
-	}
-
 	cert, err := tls.X509KeyPair(pem.EncodeToMemory(certPEM), pem.EncodeToMemory(keyPEM))
 	if err != nil {
 		return "", err
@@ -116,6 +208,12 @@ func (c *TLSConfig) AddCaCertFromFile(caFile string) error {
 	return nil
 }
 
+// SetFIPS sets whether to restrict TLS to FIPS-approved versions, cipher
+// suites and curves.
+func (c *TLSConfig) SetFIPS(enabled bool) {
+	c.fips = enabled
+}
+
 // MakeConfig constructs a new tls.Config from the configuration specified.
 func (c *TLSConfig) MakeConfig() (*tls.Config, error) {
 	cfg := &tls.Config{}
@@ -136,6 +234,16 @@ func (c *TLSConfig) MakeConfig() (*tls.Config, error) {
 	}
 
 	cfg.InsecureSkipVerify = c.insecure
+	cfg.MinVersion = c.minVersion
+	cfg.CipherSuites = c.cipherSuites
+	if c.crl != nil || c.verifyOCSP {
+		cfg.VerifyConnection = c.checkRevocation
+	}
+	if c.fips {
+		if err := fips.RestrictTLS(cfg); err != nil {
+			return nil, err
+		}
+	}
 
 	return cfg, nil
 }
@@ -1,45 +1,172 @@
 package tlsgo
 
 import (
-	"strings"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/mongodb/mongo-tools/common/testtype"
+	"golang.org/x/crypto/ocsp"
 )
 
 func TestAddClientCert(t *testing.T) {
 	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
 
 	cases := []struct {
-		Path  string
-		Pass  string
-		Valid bool
+		Path    string
+		KeyPath string
+		Pass    string
+		Valid   bool
 	}{
 		{Path: "testdata/pkcs1.pem", Valid: true},
 		{Path: "testdata/pkcs1-rev.pem", Valid: true},
 		{Path: "testdata/pkcs1-encrypted.pem", Pass: "qwerty", Valid: true},
 		{Path: "testdata/pkcs1-encrypted-rev.pem", Pass: "qwerty", Valid: true},
+		{Path: "testdata/pkcs1-encrypted.pem", Valid: false},
 
 		{Path: "testdata/pkcs8.pem", Valid: true},
 		{Path: "testdata/pkcs8-rev.pem", Valid: true},
+		{Path: "testdata/pkcs8-encrypted.pem", Pass: "qwerty", Valid: true},
+		{Path: "testdata/pkcs8-encrypted-rev.pem", Pass: "qwerty", Valid: true},
 		{Path: "testdata/pkcs8-encrypted.pem", Valid: false},
-		{Path: "testdata/pkcs8-encrypted-rev.pem", Valid: false},
+		{Path: "testdata/pkcs8-encrypted.pem", Pass: "wrong", Valid: false},
+
+		{Path: "testdata/cert.pem", KeyPath: "testdata/key-pkcs8-encrypted.pem", Pass: "qwerty", Valid: true},
+		{Path: "testdata/cert.pem", KeyPath: "testdata/key-pkcs8-aes256-sha256.pem", Pass: "qwerty", Valid: true},
+		{Path: "testdata/cert.pem", KeyPath: "testdata/key-pkcs8-des3.pem", Pass: "qwerty", Valid: true},
+		{Path: "testdata/cert.pem", Valid: false},
 	}
 
 	for _, v := range cases {
 		tlsc := NewTLSConfig()
-		_, err := tlsc.AddClientCertFromFile(v.Path, v.Pass)
+		_, err := tlsc.AddClientCertFromFile(v.Path, v.KeyPath, v.Pass)
 		switch v.Valid {
 		case true:
 			if err != nil {
-				t.Errorf("Error parsing %s: %s", v.Path, err.Error())
+				t.Errorf("Error parsing %s (key %q): %s", v.Path, v.KeyPath, err.Error())
 			}
 		case false:
 			if err == nil {
-				t.Errorf("Expected error parsing %s but parsed OK", v.Path)
-			} else if !strings.Contains(err.Error(), "encrypted private keys are not supported") {
-				t.Errorf("Incorrect error for %s: %s", v.Path, err.Error())
+				t.Errorf("Expected error parsing %s (key %q, password %q) but parsed OK", v.Path, v.KeyPath, v.Pass)
 			}
 		}
 	}
 }
+
+func TestSetMinVersionAndCipherSuites(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	tlsc := NewTLSConfig()
+	if err := tlsc.SetMinVersion("1.3"); err != nil {
+		t.Fatalf("Error setting TLS 1.3: %v", err)
+	}
+	if err := tlsc.SetMinVersion("1.4"); err == nil {
+		t.Errorf("Expected error setting TLS 1.4")
+	}
+	if err := tlsc.SetCipherSuites("TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"); err != nil {
+		t.Fatalf("Error setting cipher suites: %v", err)
+	}
+	if err := tlsc.SetCipherSuites("TLS_NOT_A_SUITE"); err == nil {
+		t.Errorf("Expected error setting an unknown cipher suite")
+	}
+
+	cfg, err := tlsc.MakeConfig()
+	if err != nil {
+		t.Fatalf("Error making config: %v", err)
+	}
+	if cfg.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Expected minimum version TLS 1.3, got %x", cfg.MinVersion)
+	}
+	if len(cfg.CipherSuites) != 2 || cfg.CipherSuites[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("Unexpected cipher suites %v", cfg.CipherSuites)
+	}
+}
+
+func loadTestCert(t *testing.T, path string) *x509.Certificate {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestCheckRevocation(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	ca := loadTestCert(t, "testdata/ca.pem")
+	server := loadTestCert(t, "testdata/server.pem")
+	revoked := loadTestCert(t, "testdata/revoked.pem")
+	state := func(cert *x509.Certificate) tls.ConnectionState {
+		return tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert, ca}}}
+	}
+
+	tlsc := NewTLSConfig()
+	if err := tlsc.AddCRLFromFile("testdata/crl.pem"); err != nil {
+		t.Fatalf("Error reading CRL: %v", err)
+	}
+	if err := tlsc.AddCRLFromFile("testdata/cert.pem"); err == nil {
+		t.Errorf("Expected error reading a certificate as a CRL")
+	}
+	if err := tlsc.checkRevocation(state(server)); err != nil {
+		t.Errorf("Unexpected error checking a certificate not in the CRL: %v", err)
+	}
+	if err := tlsc.checkRevocation(state(revoked)); err == nil {
+		t.Errorf("Expected error checking a certificate in the CRL")
+	}
+	if err := tlsc.checkRevocation(tls.ConnectionState{}); err != nil {
+		t.Errorf("Unexpected error checking unverified certificates: %v", err)
+	}
+
+	keyData, err := ioutil.ReadFile("testdata/ca-key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBlock, _ := pem.Decode(keyData)
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	staple := func(cert *x509.Certificate, status int) []byte {
+		response, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+			Status:       status,
+			SerialNumber: cert.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Hour),
+			NextUpdate:   time.Now().Add(time.Hour),
+			RevokedAt:    time.Now().Add(-time.Hour),
+		}, key.(crypto.Signer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	tlsc = NewTLSConfig()
+	tlsc.SetVerifyOCSPStapling(true)
+	good := state(server)
+	good.OCSPResponse = staple(server, ocsp.Good)
+	if err := tlsc.checkRevocation(good); err != nil {
+		t.Errorf("Unexpected error checking a good OCSP response: %v", err)
+	}
+	bad := state(server)
+	bad.OCSPResponse = staple(server, ocsp.Revoked)
+	if err := tlsc.checkRevocation(bad); err == nil {
+		t.Errorf("Expected error checking a revoked OCSP response")
+	}
+	other := state(server)
+	other.OCSPResponse = staple(revoked, ocsp.Good)
+	if err := tlsc.checkRevocation(other); err == nil {
+		t.Errorf("Expected error checking an OCSP response for another certificate")
+	}
+	if err := tlsc.checkRevocation(state(server)); err != nil {
+		t.Errorf("Unexpected error checking without a stapled response: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright (C) MongoDB, Inc. 2018-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package tlsgo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Object identifiers of the algorithms of encrypted PKCS#8 private keys, from
+// RFC 8018.
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+)
+
+// pbkdf2PRFs are the pseudorandom functions of PBKDF2, by the string of their
+// object identifier. PBKDF2 uses HMAC-SHA1 if none is given.
+var pbkdf2PRFs = map[string]func() hash.Hash{
+	"":                    sha1.New,
+	"1.2.840.113549.2.7":  sha1.New,
+	"1.2.840.113549.2.8":  sha256.New224,
+	"1.2.840.113549.2.9":  sha256.New,
+	"1.2.840.113549.2.10": sha512.New384,
+	"1.2.840.113549.2.11": sha512.New,
+}
+
+// pkcs8Cipher is a block cipher used in CBC mode to encrypt private keys.
+type pkcs8Cipher struct {
+	keySize  int
+	newBlock func(key []byte) (cipher.Block, error)
+}
+
+// pkcs8Ciphers are the supported encryption schemes, by the string of their
+// object identifier.
+var pkcs8Ciphers = map[string]pkcs8Cipher{
+	"2.16.840.1.101.3.4.1.2":  {16, aes.NewCipher},
+	"2.16.840.1.101.3.4.1.22": {24, aes.NewCipher},
+	"2.16.840.1.101.3.4.1.42": {32, aes.NewCipher},
+	"1.2.840.113549.3.7":      {24, des.NewTripleDESCipher},
+}
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 decrypts the DER of an encrypted PKCS#8 private key, as found
+// in an "ENCRYPTED PRIVATE KEY" PEM block, and returns the DER of the
+// unencrypted PKCS#8 private key. Only PBES2 encryption, which is what
+// OpenSSL uses by default, is supported.
+func decryptPKCS8(der []byte, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, fmt.Errorf("invalid encrypted private key: %v", err)
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %v: only PBES2 is supported",
+			info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("invalid PBES2 parameters: %v", err)
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %v: only PBKDF2 is supported",
+			params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, fmt.Errorf("invalid PBKDF2 parameters: %v", err)
+	}
+	prf, ok := pbkdf2PRFs[kdf.PRF.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported PBKDF2 pseudorandom function %v", kdf.PRF.Algorithm)
+	}
+
+	scheme, ok := pkcs8Ciphers[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key cipher %v", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, fmt.Errorf("invalid private key cipher parameters: %v", err)
+	}
+
+	key := pbkdf2.Key(password, kdf.Salt, kdf.IterationCount, scheme.keySize, prf)
+	block, err := scheme.newBlock(key)
+	if err != nil {
+		return nil, err
+	}
+	data := info.EncryptedData
+	if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("invalid encrypted private key")
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	// an incorrect password almost always leaves invalid padding
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > block.BlockSize() {
+		return nil, fmt.Errorf("incorrect password for the private key")
+	}
+	for _, b := range decrypted[len(decrypted)-padding:] {
+		if int(b) != padding {
+			return nil, fmt.Errorf("incorrect password for the private key")
+		}
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
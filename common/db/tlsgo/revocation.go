@@ -0,0 +1,87 @@
+// Copyright (C) MongoDB, Inc. 2018-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package tlsgo
+
+import (
+	"crypto/tls"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// checkRevocation checks the verified certificate chains of a connection
+// against the CRL, and the server certificate against the OCSP response the
+// server stapled, if those checks are configured. Nothing is checked when
+// certificates aren't verified.
+func (c *TLSConfig) checkRevocation(state tls.ConnectionState) error {
+	if len(state.VerifiedChains) == 0 {
+		return nil
+	}
+	if c.crl != nil {
+		if err := c.checkCRL(state); err != nil {
+			return err
+		}
+	}
+	if c.verifyOCSP && len(state.OCSPResponse) > 0 {
+		if err := checkOCSPStaple(state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCRL rejects a certificate of the chains listed by the CRL, when the
+// CRL is signed by the certificate's issuer.
+func (c *TLSConfig) checkCRL(state tls.ConnectionState) error {
+	if c.crl.HasExpired(time.Now()) {
+		return fmt.Errorf("the CRL has expired")
+	}
+	revoked := map[string]bool{}
+	for _, entry := range c.crl.TBSCertList.RevokedCertificates {
+		revoked[entry.SerialNumber.String()] = true
+	}
+	for _, chain := range state.VerifiedChains {
+		for i := 0; i+1 < len(chain); i++ {
+			cert, issuer := chain[i], chain[i+1]
+			if issuer.CheckCRLSignature(c.crl) != nil {
+				continue
+			}
+			if revoked[cert.SerialNumber.String()] {
+				return fmt.Errorf("certificate '%v' has been revoked", x509CertSubject(cert))
+			}
+		}
+	}
+	return nil
+}
+
+// checkOCSPStaple rejects the server certificate if the stapled OCSP
+// response is invalid, out of date, or shows it revoked.
+func checkOCSPStaple(state tls.ConnectionState) error {
+	chain := state.VerifiedChains[0]
+	if len(chain) < 2 {
+		return fmt.Errorf("can't verify the stapled OCSP response without the certificate's issuer")
+	}
+	cert := chain[0]
+	response, err := ocsp.ParseResponse(state.OCSPResponse, chain[1])
+	if err != nil {
+		return fmt.Errorf("invalid stapled OCSP response: %v", err)
+	}
+	if response.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		return fmt.Errorf("the stapled OCSP response is for another certificate")
+	}
+	if !response.NextUpdate.IsZero() && response.NextUpdate.Before(time.Now()) {
+		return fmt.Errorf("the stapled OCSP response is out of date")
+	}
+	switch response.Status {
+	case ocsp.Good:
+		return nil
+	case ocsp.Revoked:
+		return fmt.Errorf("certificate '%v' has been revoked", x509CertSubject(cert))
+	}
+	return fmt.Errorf("the stapled OCSP response doesn't know the certificate's status")
+}
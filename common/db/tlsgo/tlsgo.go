@@ -9,12 +9,14 @@ package tlsgo
 
 import (
 	"crypto/tls"
-	"fmt"
 	"net"
 	"strings"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/db/aws"
 	"github.com/mongodb/mongo-tools/common/db/kerberos"
+	"github.com/mongodb/mongo-tools/common/db/proxy"
+	"github.com/mongodb/mongo-tools/common/fips"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/util"
@@ -30,22 +32,30 @@ type TLSDBConnector struct {
 // Configure the connector to connect to the server over ssl. Sets up the
 // correct function to dial the server based on the ssl options passed in.
 func (c *TLSDBConnector) Configure(opts options.ToolOptions) error {
-	if opts.SSLFipsMode {
-		return fmt.Errorf("FIPS mode not supported")
-	}
+	c.config = NewTLSConfig()
 
+	if err := c.config.SetMinVersion(opts.TLSMinVersion); err != nil {
+		return err
+	}
+	if opts.TLSCipherSuites != "" {
+		if err := c.config.SetCipherSuites(opts.TLSCipherSuites); err != nil {
+			return err
+		}
+	}
 	if opts.SSLCRLFile != "" {
-		return fmt.Errorf("CRL files are not supported on this platform")
+		if err := c.config.AddCRLFromFile(opts.SSLCRLFile); err != nil {
+			return err
+		}
 	}
-
-	c.config = NewTLSConfig()
+	c.config.SetVerifyOCSPStapling(opts.TLSVerifyOCSPStapling)
+	c.config.SetFIPS(opts.SSLFipsMode || fips.Enabled())
 
 	if opts.SSLAllowInvalidCert || opts.SSLAllowInvalidHost {
 		c.config.SetInsecure(true)
 	}
 
 	if opts.SSLPEMKeyFile != "" {
-		subject, err := c.config.AddClientCertFromFile(opts.SSLPEMKeyFile, opts.SSLPEMKeyPassword)
+		subject, err := c.config.AddClientCertFromFile(opts.SSLPEMKeyFile, opts.SSLKeyFile, opts.SSLPEMKeyPassword)
 		if err != nil {
 			return err
 		}
@@ -60,14 +70,20 @@ func (c *TLSDBConnector) Configure(opts options.ToolOptions) error {
 
 	// set up the dial info
 	c.dialInfo = &mgo.DialInfo{
-		Timeout:        time.Duration(opts.Timeout) * time.Second,
-		Direct:         opts.Direct,
-		ReplicaSetName: opts.ReplicaSetName,
-		DialServer:     c.makeDialer(opts),
-		Username:       opts.Auth.Username,
-		Password:       opts.Auth.Password,
-		Source:         opts.GetAuthenticationDatabase(),
-		Mechanism:      opts.Auth.Mechanism,
+		Timeout:              time.Duration(opts.Timeout) * time.Second,
+		Direct:               opts.Direct,
+		ReplicaSetName:       opts.ReplicaSetName,
+		DialServer:           c.makeDialer(opts),
+		Username:             opts.Auth.Username,
+		Password:             opts.Auth.Password,
+		Source:               opts.GetAuthenticationDatabase(),
+		Mechanism:            opts.Auth.Mechanism,
+		PoolLimit:            opts.MaxPoolSize,
+		MinPoolSize:          opts.MinPoolSize,
+		MaxIdleTimeMS:        opts.MaxIdleTimeMS,
+		HeartbeatFrequencyMS: opts.HeartbeatFrequencyMS,
+		Compressors:          opts.GetCompressors(),
+		ServerAPI:            &mgo.ServerAPI{Version: opts.APIVersion, Strict: opts.APIStrict, DeprecationErrors: opts.APIDeprecationErrors},
 	}
 
 	// create or fetch the addresses to be used to connect
@@ -77,6 +93,9 @@ func (c *TLSDBConnector) Configure(opts options.ToolOptions) error {
 		c.dialInfo.Addrs = util.CreateConnectionAddrs(opts.Host, opts.Port)
 	}
 	kerberos.AddKerberosOpts(opts, c.dialInfo)
+	if err := aws.AddAWSOpts(opts, c.dialInfo); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -91,7 +110,7 @@ type dialerFunc func(addr *mgo.ServerAddr) (net.Conn, error)
 func (c *TLSDBConnector) makeDialer(opts options.ToolOptions) dialerFunc {
 	return func(addr *mgo.ServerAddr) (net.Conn, error) {
 		address := addr.String()
-		conn, err := net.Dial("tcp", address)
+		conn, err := proxy.Dial(opts, address, 0)
 		if err != nil {
 			// mgo discards dialer errors so log it now
 			log.Logvf(log.Always, "error dialing %v: %v", address, err)
@@ -106,30 +125,40 @@ func (c *TLSDBConnector) makeDialer(opts options.ToolOptions) dialerFunc {
 			return nil, err
 		}
 
-		tlsConfig, err := c.config.MakeConfig()
+		client, err := c.Handshake(conn, address)
 		if err != nil {
+			// mgo discards dialer errors so log it now
+			log.Logvf(log.Always, "error doing TLS handshake with %v: %v", address, err)
 			return nil, err
 		}
 
-		if !tlsConfig.InsecureSkipVerify {
-			colonPos := strings.LastIndex(address, ":")
-			if colonPos == -1 {
-				colonPos = len(address)
-			}
+		return client, nil
+	}
+}
 
-			hostname := address[:colonPos]
-			tlsConfig.ServerName = hostname
-		}
+// Handshake does the TLS handshake with the server at address over conn,
+// closing conn if it fails. Configure must have been called.
+func (c *TLSDBConnector) Handshake(conn net.Conn, address string) (*tls.Conn, error) {
+	tlsConfig, err := c.config.MakeConfig()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
 
-		client := tls.Client(conn, tlsConfig)
-		err = client.Handshake()
-		if err != nil {
-			// mgo discards dialer errors so log it now
-			log.Logvf(log.Always, "error doing TLS handshake with %v: %v", address, err)
-			client.Close()
-			return nil, err
+	if !tlsConfig.InsecureSkipVerify {
+		colonPos := strings.LastIndex(address, ":")
+		if colonPos == -1 {
+			colonPos = len(address)
 		}
 
-		return client, nil
+		hostname := address[:colonPos]
+		tlsConfig.ServerName = hostname
+	}
+
+	client := tls.Client(conn, tlsConfig)
+	if err = client.Handshake(); err != nil {
+		client.Close()
+		return nil, err
 	}
+	return client, nil
 }
@@ -0,0 +1,350 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package diagnose tests each step of connecting a tool to the server for
+// --diagnose, from resolving the host names of the server to checking the
+// privileges of the user, so that the step a connection fails at, and why,
+// can be told apart.
+package diagnose
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/db/proxy"
+	"github.com/mongodb/mongo-tools/common/failure"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Result is the outcome of a step.
+type Result string
+
+const (
+	OK      Result = "ok"
+	Failed  Result = "FAILED"
+	Skipped Result = "skipped"
+)
+
+// Step is a step of connecting to the server, for one of its hosts or for
+// all of them.
+type Step struct {
+	Name   string
+	Result Result
+	Detail string
+	// Hint suggests what to check when the step failed
+	Hint string
+
+	exitCode int
+}
+
+// Report is the list of steps tested by Diagnose, in order.
+type Report struct {
+	Steps []Step
+}
+
+// handshake does the TLS handshake with the server at address over conn,
+// and closes it, when the tools are built with Go native TLS.
+var handshake func(opts options.ToolOptions, conn net.Conn, address string) (tls.ConnectionState, error)
+
+// dialTimeout is how long to wait for each TCP connection when no
+// --dialTimeout is given.
+const dialTimeout = 3 * time.Second
+
+func (r *Report) add(step Step) {
+	r.Steps = append(r.Steps, step)
+}
+
+func (r *Report) ok(name, detail string) {
+	r.add(Step{Name: name, Result: OK, Detail: detail})
+}
+
+func (r *Report) skip(name, detail string) {
+	r.add(Step{Name: name, Result: Skipped, Detail: detail})
+}
+
+func (r *Report) fail(name string, err error, hint string, exitCode int) {
+	r.add(Step{Name: name, Result: Failed, Detail: err.Error(), Hint: hint, exitCode: exitCode})
+}
+
+// ExitCode returns the exit code of the first failed step: util.ExitConnection
+// for the steps of reaching the server and util.ExitAuth for those of
+// authenticating, or util.ExitClean when none failed.
+func (r *Report) ExitCode() int {
+	for _, step := range r.Steps {
+		if step.Result == Failed {
+			return step.exitCode
+		}
+	}
+	return util.ExitClean
+}
+
+// Write writes the steps as a table, followed by the hints of the failed
+// ones.
+func (r *Report) Write(w io.Writer) error {
+	table := text.NewTable("step", "result", "details")
+	for i := range table.Columns {
+		table.Columns[i].Align = text.AlignLeft
+	}
+	table.Padding = 2
+	for _, step := range r.Steps {
+		table.AddRow(step.Name, string(step.Result), step.Detail)
+	}
+	if err := table.WriteText(w); err != nil {
+		return err
+	}
+	for _, step := range r.Steps {
+		if step.Result == Failed && step.Hint != "" {
+			if _, err := fmt.Fprintf(w, "%v: %v\n", step.Name, step.Hint); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Run tests connecting to the server described by opts, writes the report to
+// w, and returns the exit code of the tool.
+func Run(opts *options.ToolOptions, w io.Writer) int {
+	report := Diagnose(opts)
+	if err := report.Write(w); err != nil {
+		return util.ExitError
+	}
+	return report.ExitCode()
+}
+
+// Diagnose tests each step of connecting to the server described by opts.
+// The steps of a host are skipped once one fails, and authenticating is
+// skipped when no host could be reached.
+func Diagnose(opts *options.ToolOptions) *Report {
+	report := &Report{}
+	addrs := lookupSRV(opts, report)
+
+	timeout := dialTimeout
+	if opts.Connection != nil && opts.Timeout > 0 {
+		timeout = time.Duration(opts.Timeout) * time.Second
+	}
+	useProxy := opts.Connection != nil && opts.ProxyHost != ""
+	if useProxy {
+		// the proxy resolves the host names of the server
+		if err := resolve(opts.ProxyHost, report); err != nil {
+			return report
+		}
+	}
+
+	reached := false
+	for _, addr := range addrs {
+		if !useProxy && resolve(hostname(addr), report) != nil {
+			continue
+		}
+		conn, ok := connect(*opts, addr, timeout, report)
+		if !ok {
+			continue
+		}
+		if shakeHands(*opts, conn, addr, report) {
+			reached = true
+		}
+	}
+	if !reached {
+		report.skip("authentication", "no server could be reached")
+		return report
+	}
+
+	session, ok := authenticate(opts, report)
+	if !ok {
+		return report
+	}
+	defer session.close()
+	checkPrivileges(opts, session, report)
+	return report
+}
+
+// lookupSRV looks up the SRV records of a mongodb+srv URI, and returns the
+// addresses of the hosts to connect to.
+func lookupSRV(opts *options.ToolOptions, report *Report) []string {
+	if opts.URI == nil || opts.URI.ConnectionString == "" {
+		host, port := "", ""
+		if opts.Connection != nil {
+			host, port = opts.Host, opts.Port
+		}
+		return util.CreateConnectionAddrs(host, port)
+	}
+	addrs := opts.URI.GetConnectionAddrs()
+	cs := opts.URI.ParsedConnString()
+	if !cs.UsingSRV {
+		return addrs
+	}
+	name := "SRV lookup " + cs.SRVHostname
+	seedlist, err := cs.FetchSRVSeedlist()
+	if err != nil {
+		report.fail(name, err, "check that the host name of the mongodb+srv URI has SRV records, "+
+			"and that this machine's DNS servers can be reached", util.ExitConnection)
+		return addrs
+	}
+	report.ok(name, strings.Join(seedlist, ", "))
+	return seedlist
+}
+
+// hostname returns the host name of an address, without the port.
+func hostname(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// resolve looks up the addresses of a host name.
+func resolve(host string, report *Report) error {
+	name := "DNS " + host
+	if net.ParseIP(host) != nil {
+		report.skip(name, "an IP address")
+		return nil
+	}
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		report.fail(name, err, "check the spelling of the host name, "+
+			"and that this machine's DNS servers can resolve it", util.ExitConnection)
+		return err
+	}
+	report.ok(name, strings.Join(ips, ", "))
+	return nil
+}
+
+// connect opens a TCP connection to addr, through the proxy if there is one.
+func connect(opts options.ToolOptions, addr string, timeout time.Duration, report *Report) (net.Conn, bool) {
+	name := "TCP " + addr
+	start := time.Now()
+	conn, err := proxy.Dial(opts, addr, timeout)
+	if err != nil {
+		report.fail(name, err, "check that the server is running and listening on that port, "+
+			"and that no firewall or security group blocks it", util.ExitConnection)
+		return nil, false
+	}
+	report.ok(name, fmt.Sprintf("connected to %v in %v", conn.RemoteAddr(), time.Since(start).Round(time.Millisecond)))
+	return conn, true
+}
+
+// shakeHands does the TLS handshake over conn when TLS is enabled, and
+// closes conn.
+func shakeHands(opts options.ToolOptions, conn net.Conn, addr string, report *Report) bool {
+	name := "TLS " + addr
+	if opts.SSL == nil || !opts.UseSSL {
+		conn.Close()
+		report.skip(name, "TLS is not enabled")
+		return true
+	}
+	if handshake == nil {
+		conn.Close()
+		report.skip(name, "done by OpenSSL when authenticating")
+		return true
+	}
+	state, err := handshake(opts, conn, addr)
+	if err != nil {
+		report.fail(name, err, "check --sslCAFile and --sslPEMKeyFile, "+
+			"that the server has TLS enabled, and that its certificate matches its host name", util.ExitConnection)
+		return false
+	}
+	detail := tlsVersions[state.Version]
+	if len(state.PeerCertificates) > 0 {
+		cert := state.PeerCertificates[0]
+		detail += fmt.Sprintf(", certificate of %v valid until %v",
+			cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+	}
+	report.ok(name, detail)
+	return true
+}
+
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "TLS 1.0",
+	tls.VersionTLS11: "TLS 1.1",
+	tls.VersionTLS12: "TLS 1.2",
+	tls.VersionTLS13: "TLS 1.3",
+}
+
+// session is a session of the tool's SessionProvider, which is closed with
+// it.
+type session struct {
+	*mgo.Session
+	provider *db.SessionProvider
+}
+
+func (s *session) close() {
+	s.Session.Close()
+	s.provider.Close()
+}
+
+// authenticate connects to the server as the tool does, authenticating if
+// credentials are given, and runs a ping.
+func authenticate(opts *options.ToolOptions, report *Report) (*session, bool) {
+	name := "authentication"
+	provider, err := db.NewSessionProvider(*opts)
+	if err != nil {
+		report.fail(name, err, "check the connection options", util.ExitConnection)
+		return nil, false
+	}
+	s, err := provider.GetSession()
+	if err == nil {
+		if err = s.Run(bson.D{{"ping", 1}}, &bson.M{}); err != nil {
+			s.Close()
+		}
+	}
+	if err != nil {
+		provider.Close()
+		hint := "check that the server is reachable and selectable with the read preference"
+		exitCode := util.ExitConnection
+		if failure.Classify(err) == failure.Auth {
+			hint = "check the username, the password, --authenticationDatabase and --authenticationMechanism"
+			exitCode = util.ExitAuth
+		}
+		report.fail(name, err, hint, exitCode)
+		return nil, false
+	}
+	if opts.Auth == nil || opts.Auth.Username == "" {
+		report.skip(name, "no credentials given")
+	} else {
+		mechanism := opts.Auth.Mechanism
+		if mechanism == "" {
+			mechanism = "the default mechanism"
+		}
+		report.ok(name, fmt.Sprintf("as %v@%v with %v", opts.Auth.Username, opts.GetAuthenticationDatabase(), mechanism))
+	}
+	return &session{provider: provider, Session: s}, true
+}
+
+// checkPrivileges checks that the user has the privileges the tool needs.
+func checkPrivileges(opts *options.ToolOptions, s *session, report *Report) {
+	name := "privileges"
+	required := RequiredPrivileges(opts)
+	if len(required) == 0 {
+		report.skip(name, "none required")
+		return
+	}
+	if opts.Auth == nil || opts.Auth.Username == "" {
+		report.skip(name, "no user to check them for")
+		return
+	}
+	status := connectionStatus{}
+	err := s.Run(bson.D{{"connectionStatus", 1}, {"showPrivileges", true}}, &status)
+	if err != nil {
+		report.fail(name, err, "the server could not list the privileges of the user", util.ExitAuth)
+		return
+	}
+	missing := Missing(required, status.AuthInfo.Privileges)
+	if len(missing) == 0 {
+		report.ok(name, "the user has every privilege "+opts.AppName+" needs")
+		return
+	}
+	report.fail(name, fmt.Errorf("missing %v", strings.Join(missing, ", ")),
+		"grant the user a role with the missing actions", util.ExitAuth)
+}
@@ -0,0 +1,105 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package diagnose
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/common/util"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReachingTheServer(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a server listening on a local port", t, func() {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer listener.Close()
+		addr := listener.Addr().String()
+		opts := options.New("mongodump", "", options.EnabledOptions{Connection: true})
+		report := &Report{}
+
+		Convey("IP addresses should not be resolved", func() {
+			So(resolve("127.0.0.1", report), ShouldBeNil)
+			So(report.Steps[0].Result, ShouldEqual, Skipped)
+		})
+
+		Convey("connecting should succeed, and TLS be skipped when not enabled", func() {
+			conn, ok := connect(*opts, addr, time.Second, report)
+			So(ok, ShouldBeTrue)
+			So(shakeHands(*opts, conn, addr, report), ShouldBeTrue)
+			So(report.Steps[0].Name, ShouldEqual, "TCP "+addr)
+			So(report.Steps[0].Result, ShouldEqual, OK)
+			So(report.Steps[1].Result, ShouldEqual, Skipped)
+			So(report.ExitCode(), ShouldEqual, util.ExitClean)
+		})
+
+		Convey("connecting to a closed port should fail with a hint", func() {
+			listener.Close()
+			_, ok := connect(*opts, addr, time.Second, report)
+			So(ok, ShouldBeFalse)
+			So(report.Steps[0].Result, ShouldEqual, Failed)
+			So(report.ExitCode(), ShouldEqual, util.ExitConnection)
+
+			buf := &bytes.Buffer{}
+			So(report.Write(buf), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, "step")
+			So(buf.String(), ShouldContainSubstring, "TCP "+addr+": check that the server is running")
+		})
+	})
+}
+
+func TestPrivileges(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The privileges of a tool", t, func() {
+		opts := options.New("mongodump", "", options.EnabledOptions{Namespace: true})
+
+		Convey("should include listing the databases when none is given", func() {
+			So(RequiredPrivileges(opts), ShouldResemble, []Requirement{
+				{Action: "find"},
+				{Action: "listCollections"},
+				{Action: "listIndexes"},
+				{Action: "listDatabases", Resource: Resource{Cluster: true}},
+			})
+		})
+
+		Convey("should be on the namespace given", func() {
+			opts.DB = "test"
+			required := RequiredPrivileges(opts)
+			So(required, ShouldHaveLength, 3)
+			So(required[0], ShouldResemble, Requirement{Action: "find", Resource: Resource{DB: "test"}})
+
+			Convey("and be granted by privileges on the database or every database", func() {
+				So(Missing(required, []Privilege{
+					{Resource: Resource{DB: "test"}, Actions: []string{"find", "listCollections"}},
+					{Resource: Resource{}, Actions: []string{"listIndexes"}},
+				}), ShouldBeEmpty)
+				So(Missing(required, []Privilege{
+					{Resource: Resource{AnyResource: true}, Actions: []string{"anyAction"}},
+				}), ShouldBeEmpty)
+			})
+
+			Convey("and not by privileges on other resources", func() {
+				So(Missing(required, []Privilege{
+					{Resource: Resource{DB: "other"}, Actions: []string{"find", "listCollections", "listIndexes"}},
+					{Resource: Resource{Cluster: true}, Actions: []string{"find"}},
+				}), ShouldResemble, []string{
+					"find on database test",
+					"listCollections on database test",
+					"listIndexes on database test",
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,36 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// +build ssl,openssl_pre_1.0
+
+package diagnose
+
+import (
+	"crypto/tls"
+	"net"
+
+	"github.com/mongodb/mongo-tools/common/db/tlsgo"
+	"github.com/mongodb/mongo-tools/common/options"
+)
+
+func init() {
+	handshake = tlsgoHandshake
+}
+
+// tlsgoHandshake does the TLS handshake with the TLS settings of the tool.
+func tlsgoHandshake(opts options.ToolOptions, conn net.Conn, address string) (tls.ConnectionState, error) {
+	connector := &tlsgo.TLSDBConnector{}
+	if err := connector.Configure(opts); err != nil {
+		conn.Close()
+		return tls.ConnectionState{}, err
+	}
+	client, err := connector.Handshake(conn, address)
+	if err != nil {
+		return tls.ConnectionState{}, err
+	}
+	defer client.Close()
+	return client.ConnectionState(), nil
+}
@@ -0,0 +1,130 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package diagnose
+
+import (
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/options"
+)
+
+// Privilege is an action on a resource: the cluster, or the namespace of a
+// database and collection, where empty names stand for every database or
+// collection.
+type Privilege struct {
+	Resource Resource `bson:"resource"`
+	Actions  []string `bson:"actions"`
+}
+
+// Resource is the resource of a Privilege.
+type Resource struct {
+	DB          string `bson:"db"`
+	Collection  string `bson:"collection"`
+	Cluster     bool   `bson:"cluster"`
+	AnyResource bool   `bson:"anyResource"`
+}
+
+// Requirement is an action a tool needs to be granted on a resource.
+type Requirement struct {
+	Action   string
+	Resource Resource
+}
+
+// toolActions are the actions each tool needs on the namespace it works on,
+// and clusterActions those it needs on the cluster.
+var (
+	toolActions = map[string][]string{
+		"mongodump":    {"find", "listCollections", "listIndexes"},
+		"mongoexport":  {"find"},
+		"mongofiles":   {"find", "insert", "remove"},
+		"mongoimport":  {"insert", "update"},
+		"mongorestore": {"insert", "createCollection", "createIndex"},
+	}
+	clusterActions = map[string][]string{
+		"mongostat": {"serverStatus"},
+		"mongotop":  {"top"},
+	}
+)
+
+type connectionStatus struct {
+	AuthInfo struct {
+		Privileges []Privilege `bson:"authenticatedUserPrivileges"`
+	} `bson:"authInfo"`
+}
+
+// RequiredPrivileges returns the actions the tool opts are for needs, on the
+// namespace given by --db and --collection.
+func RequiredPrivileges(opts *options.ToolOptions) []Requirement {
+	namespace := Resource{}
+	if opts.Namespace != nil {
+		namespace = Resource{DB: opts.DB, Collection: opts.Collection}
+	}
+	var required []Requirement
+	for _, action := range toolActions[opts.AppName] {
+		required = append(required, Requirement{Action: action, Resource: namespace})
+	}
+	for _, action := range clusterActions[opts.AppName] {
+		required = append(required, Requirement{Action: action, Resource: Resource{Cluster: true}})
+	}
+	if opts.AppName == "mongodump" && namespace.DB == "" {
+		// to find the databases to dump
+		required = append(required, Requirement{Action: "listDatabases", Resource: Resource{Cluster: true}})
+	}
+	return required
+}
+
+// covers returns whether the privileges of r extend to the resource.
+func (r Resource) covers(resource Resource) bool {
+	if r.AnyResource {
+		return true
+	}
+	if r.Cluster || resource.Cluster {
+		return r.Cluster == resource.Cluster
+	}
+	return (r.DB == "" || r.DB == resource.DB) &&
+		(r.Collection == "" || r.Collection == resource.Collection)
+}
+
+func (r Resource) String() string {
+	switch {
+	case r.Cluster:
+		return "the cluster"
+	case r.DB == "" && r.Collection == "":
+		return "every database"
+	case r.DB == "":
+		return fmt.Sprintf("collection %v of every database", r.Collection)
+	case r.Collection == "":
+		return fmt.Sprintf("database %v", r.DB)
+	}
+	return r.DB + "." + r.Collection
+}
+
+// Missing returns the required actions that the privileges don't grant,
+// each with its resource.
+func Missing(required []Requirement, privileges []Privilege) []string {
+	var missing []string
+	for _, requirement := range required {
+		if !granted(requirement, privileges) {
+			missing = append(missing, fmt.Sprintf("%v on %v", requirement.Action, requirement.Resource))
+		}
+	}
+	return missing
+}
+
+func granted(requirement Requirement, privileges []Privilege) bool {
+	for _, privilege := range privileges {
+		if !privilege.Resource.covers(requirement.Resource) {
+			continue
+		}
+		for _, action := range privilege.Actions {
+			if action == requirement.Action || action == "anyAction" {
+				return true
+			}
+		}
+	}
+	return false
+}
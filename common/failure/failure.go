@@ -0,0 +1,171 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package failure classifies the errors that stop the tools, so that their
+// exit codes tell automation what kind of failure happened. Every tool exits
+// with one of these codes:
+//
+//	0  success
+//	1  internal error, or an error of no other class
+//	3  user error: invalid options, arguments or input
+//	4  killed by a second signal
+//	5  interrupted by a signal, after saving its progress
+//	6  connection failure: the server couldn't be reached, or was lost
+//	7  authentication failure, or an operation that wasn't authorized
+//	8  partial data: some of the data was written, but not all of it, as when
+//	   mongoreplay record drops packets
+package failure
+
+import (
+	"net"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+)
+
+// Class is the kind of failure an error reports.
+type Class int
+
+const (
+	Internal Class = iota
+	User
+	Interrupted
+	Connection
+	Auth
+	PartialData
+)
+
+var classNames = map[Class]string{
+	Internal:    "internal error",
+	User:        "user error",
+	Interrupted: "interrupted",
+	Connection:  "connection failure",
+	Auth:        "authentication failure",
+	PartialData: "partial data error",
+}
+
+func (c Class) String() string {
+	return classNames[c]
+}
+
+// ExitCode returns the exit code of a tool that failed with an error of the
+// class.
+func (c Class) ExitCode() int {
+	switch c {
+	case User:
+		return util.ExitBadOptions
+	case Interrupted:
+		return util.ExitInterrupted
+	case Connection:
+		return util.ExitConnection
+	case Auth:
+		return util.ExitAuth
+	case PartialData:
+		return util.ExitPartialData
+	}
+	return util.ExitError
+}
+
+// Error is an error whose class is known where it happens.
+type Error struct {
+	Class Class
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// New returns err classified as class, or nil if err is nil.
+func New(class Class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Class: class, Err: err}
+}
+
+// authErrorCodes are the server error codes of failed authentication and
+// missing privileges.
+var authErrorCodes = map[int]bool{
+	13: true, // Unauthorized
+	18: true, // AuthenticationFailed
+}
+
+// authErrorMessages are found in the messages of authentication errors that
+// the driver reports without a code.
+var authErrorMessages = []string{
+	"authentication failed",
+	"auth failed",
+	"authentication step",
+	"unable to authenticate",
+	"not authorized",
+}
+
+// connectionErrorMessages are found in the messages of connection errors
+// that were wrapped with more context.
+var connectionErrorMessages = []string{
+	db.ErrNoReachableServers,
+	db.ErrLostConnection,
+	"connection refused",
+	"i/o timeout",
+}
+
+// Classify returns the class of err: the class it was given with New, or
+// else the class its type or message implies, and Internal when nothing
+// does.
+func Classify(err error) Class {
+	switch e := err.(type) {
+	case *Error:
+		return e.Class
+	case *mgo.QueryError:
+		if authErrorCodes[e.Code] {
+			return Auth
+		}
+	case *mgo.LastError:
+		if authErrorCodes[e.Code] {
+			return Auth
+		}
+		return PartialData
+	case *mgo.BulkError:
+		return PartialData
+	case net.Error:
+		return Connection
+	}
+	if err == util.ErrTerminated {
+		return Interrupted
+	}
+	if db.IsServerAPIError(err) {
+		// the declared API options rule the command out
+		return User
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, fragment := range authErrorMessages {
+		if strings.Contains(message, fragment) {
+			return Auth
+		}
+	}
+	if db.IsConnectionError(err) {
+		return Connection
+	}
+	for _, fragment := range connectionErrorMessages {
+		if strings.Contains(message, fragment) {
+			return Connection
+		}
+	}
+	return Internal
+}
+
+// ExitCode returns the exit code of a tool that stopped with err, which is
+// util.ExitClean if err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return util.ExitClean
+	}
+	return Classify(err).ExitCode()
+}
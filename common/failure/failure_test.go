@@ -0,0 +1,85 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package failure
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/common/util"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2"
+)
+
+func TestClassify(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When classifying errors", t, func() {
+		Convey("an explicit class should win", func() {
+			err := New(User, errors.New("no reachable servers"))
+			So(Classify(err), ShouldEqual, User)
+			So(err.Error(), ShouldEqual, "no reachable servers")
+			So(New(User, nil), ShouldBeNil)
+		})
+
+		Convey("connection errors should be recognized, even wrapped", func() {
+			So(Classify(errors.New("no reachable servers")), ShouldEqual, Connection)
+			So(Classify(fmt.Errorf("error connecting to host: %v", "no reachable servers")), ShouldEqual, Connection)
+			So(Classify(&net.OpError{Op: "dial", Err: errors.New("refused")}), ShouldEqual, Connection)
+		})
+
+		Convey("authentication errors should be recognized by code or message", func() {
+			So(Classify(&mgo.QueryError{Code: 18, Message: "Authentication failed."}), ShouldEqual, Auth)
+			So(Classify(&mgo.QueryError{Code: 13, Message: "not authorized on admin"}), ShouldEqual, Auth)
+			So(Classify(fmt.Errorf("error connecting to host: server returned error on SASL authentication step: bad")),
+				ShouldEqual, Auth)
+		})
+
+		Convey("write errors should be partial data errors", func() {
+			So(Classify(&mgo.LastError{Code: 11000, Err: "E11000 duplicate key error"}), ShouldEqual, PartialData)
+			So(Classify(&mgo.BulkError{}), ShouldEqual, PartialData)
+		})
+
+		Convey("commands ruled out by the server API options should be user errors", func() {
+			So(Classify(&mgo.QueryError{Code: 323, Message: "the command is not in API Version 1"}), ShouldEqual, User)
+		})
+
+		Convey("termination should be an interruption", func() {
+			So(Classify(util.ErrTerminated), ShouldEqual, Interrupted)
+		})
+
+		Convey("other errors should be internal errors", func() {
+			So(Classify(errors.New("unexpected")), ShouldEqual, Internal)
+			So(Classify(&mgo.QueryError{Code: 2, Message: "bad value"}), ShouldEqual, Internal)
+		})
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Each class should have its own exit code", t, func() {
+		So(ExitCode(nil), ShouldEqual, util.ExitClean)
+		So(ExitCode(util.ErrTerminated), ShouldEqual, util.ExitInterrupted)
+		So(ExitCode(errors.New("unexpected")), ShouldEqual, util.ExitError)
+
+		codes := map[int]Class{}
+		for class := range classNames {
+			code := class.ExitCode()
+			_, seen := codes[code]
+			So(seen, ShouldBeFalse)
+			codes[code] = class
+			So(class.String(), ShouldNotBeEmpty)
+		}
+		So(codes[util.ExitBadOptions], ShouldEqual, User)
+		_, killed := codes[util.ExitKill]
+		So(killed, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package fips restricts the tools to FIPS-approved algorithms when FIPS
+// mode is enabled, with --fips or by building with the fips build tag: TLS
+// 1.2 or newer with approved cipher suites and curves, and no MD5 or SHA-1
+// hashing of data or passwords.
+package fips
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync/atomic"
+)
+
+// enabled is 1 when FIPS mode is enabled.
+var enabled int32
+
+// Enable enables FIPS mode for the rest of the run.
+func Enable() {
+	atomic.StoreInt32(&enabled, 1)
+}
+
+// Enabled returns whether FIPS mode is enabled.
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// Forbid returns an error naming the alternative if FIPS mode is enabled,
+// for operations that would use an algorithm it doesn't approve, such as
+// MD5. It returns nil otherwise.
+func Forbid(algorithm, alternative string) error {
+	if !Enabled() {
+		return nil
+	}
+	return fmt.Errorf("%v is not a FIPS-approved algorithm and can't be used in FIPS mode; %v", algorithm, alternative)
+}
+
+// forbiddenMechanisms are the authentication mechanisms that hash the
+// password with MD5.
+var forbiddenMechanisms = map[string]bool{
+	"MONGODB-CR":  true,
+	"SCRAM-SHA-1": true,
+}
+
+// CheckMechanism returns an error if FIPS mode is enabled and the
+// authentication mechanism isn't allowed by it.
+func CheckMechanism(mechanism string) error {
+	if !forbiddenMechanisms[mechanism] {
+		return nil
+	}
+	return Forbid("the "+mechanism+" authentication mechanism, which hashes the password with MD5,",
+		"use SCRAM-SHA-256, MONGODB-X509, GSSAPI, PLAIN or MONGODB-AWS instead")
+}
+
+// CipherSuites are the FIPS-approved TLS 1.2 cipher suites, those with
+// ECDHE key exchange and AES-GCM. TLS 1.3 suites are all approved except
+// ChaCha20-Poly1305, which Go only uses without AES hardware support.
+var CipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// curves are the FIPS-approved elliptic curves.
+var curves = []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521}
+
+// RestrictTLS restricts the TLS configuration to FIPS-approved versions,
+// cipher suites and curves. The cipher suites already configured are kept
+// if they are approved, and it returns an error if none are.
+func RestrictTLS(config *tls.Config) error {
+	if config.MinVersion < tls.VersionTLS12 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	config.CurvePreferences = curves
+	if len(config.CipherSuites) == 0 {
+		config.CipherSuites = CipherSuites
+		return nil
+	}
+	var suites []uint16
+	for _, suite := range config.CipherSuites {
+		for _, approved := range CipherSuites {
+			if suite == approved {
+				suites = append(suites, suite)
+			}
+		}
+	}
+	if len(suites) == 0 {
+		return fmt.Errorf("none of the cipher suites given are FIPS-approved")
+	}
+	config.CipherSuites = suites
+	return nil
+}
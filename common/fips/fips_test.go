@@ -0,0 +1,81 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package fips
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFIPSMode(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Outside of FIPS mode", t, func() {
+		So(Enabled(), ShouldBeFalse)
+
+		Convey("every algorithm and mechanism should be allowed", func() {
+			So(Forbid("MD5", "use SHA-256"), ShouldBeNil)
+			So(CheckMechanism("SCRAM-SHA-1"), ShouldBeNil)
+		})
+	})
+
+	Convey("In FIPS mode", t, func() {
+		Enable()
+		So(Enabled(), ShouldBeTrue)
+
+		Convey("forbidden algorithms should be reported with their alternative", func() {
+			err := Forbid("MD5", "use SHA-256")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "MD5 is not a FIPS-approved algorithm")
+			So(err.Error(), ShouldEndWith, "; use SHA-256")
+		})
+
+		Convey("only mechanisms not hashing the password with MD5 should be allowed", func() {
+			So(CheckMechanism("MONGODB-CR"), ShouldNotBeNil)
+			So(CheckMechanism("SCRAM-SHA-1"), ShouldNotBeNil)
+			So(CheckMechanism("SCRAM-SHA-256"), ShouldBeNil)
+			So(CheckMechanism("MONGODB-X509"), ShouldBeNil)
+		})
+	})
+}
+
+func TestRestrictTLS(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Restricting a TLS configuration", t, func() {
+		Convey("should require TLS 1.2 and the approved cipher suites and curves", func() {
+			config := &tls.Config{MinVersion: tls.VersionTLS10}
+			So(RestrictTLS(config), ShouldBeNil)
+			So(config.MinVersion, ShouldEqual, tls.VersionTLS12)
+			So(config.CipherSuites, ShouldResemble, CipherSuites)
+			So(config.CurvePreferences, ShouldResemble, []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521})
+		})
+
+		Convey("should keep a newer minimum version", func() {
+			config := &tls.Config{MinVersion: tls.VersionTLS13}
+			So(RestrictTLS(config), ShouldBeNil)
+			So(config.MinVersion, ShouldEqual, tls.VersionTLS13)
+		})
+
+		Convey("should keep only the approved cipher suites given", func() {
+			config := &tls.Config{CipherSuites: []uint16{
+				tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+				tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			}}
+			So(RestrictTLS(config), ShouldBeNil)
+			So(config.CipherSuites, ShouldResemble, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384})
+		})
+
+		Convey("should fail when none of the cipher suites given are approved", func() {
+			config := &tls.Config{CipherSuites: []uint16{tls.TLS_RSA_WITH_AES_128_CBC_SHA}}
+			So(RestrictTLS(config), ShouldNotBeNil)
+		})
+	})
+}
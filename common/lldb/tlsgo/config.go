@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strings"
+
+	"github.com/mongodb/mongo-tools/common/fips"
 )
 
 // TLSConfig contains options for configuring an SSL connection to the server.
@@ -25,6 +27,7 @@ type TLSConfig struct {
 	caCert     *x509.Certificate
 	clientCert *tls.Certificate
 	insecure   bool
+	fips       bool
 }
 
 // NewTLSConfig creates a new TLSConfig.
@@ -116,6 +119,12 @@ func (c *TLSConfig) AddCaCertFromFile(caFile string) error {
 	return nil
 }
 
+// SetFIPS sets whether to restrict TLS to FIPS-approved versions, cipher
+// suites and curves.
+func (c *TLSConfig) SetFIPS(enabled bool) {
+	c.fips = enabled
+}
+
 // MakeConfig constructs a new tls.Config from the configuration specified.
 func (c *TLSConfig) MakeConfig() (*tls.Config, error) {
 	cfg := &tls.Config{}
@@ -136,6 +145,11 @@ func (c *TLSConfig) MakeConfig() (*tls.Config, error) {
 	}
 
 	cfg.InsecureSkipVerify = c.insecure
+	if c.fips {
+		if err := fips.RestrictTLS(cfg); err != nil {
+			return nil, err
+		}
+	}
 
 	return cfg, nil
 }
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	mgo "github.com/10gen/llmgo"
+	"github.com/mongodb/mongo-tools/common/fips"
 	"github.com/mongodb/mongo-tools/common/lldb/kerberos"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
@@ -30,15 +31,12 @@ type TLSDBConnector struct {
 // Configure the connector to connect to the server over ssl. Sets up the
 // correct function to dial the server based on the ssl options passed in.
 func (c *TLSDBConnector) Configure(opts options.ToolOptions) error {
-	if opts.SSLFipsMode {
-		return fmt.Errorf("FIPS mode not supported")
-	}
-
 	if opts.SSLCRLFile != "" {
 		return fmt.Errorf("CRL files are not supported on this platform")
 	}
 
 	c.config = NewTLSConfig()
+	c.config.SetFIPS(opts.SSLFipsMode || fips.Enabled())
 
 	if opts.SSLAllowInvalidCert || opts.SSLAllowInvalidHost {
 		c.config.SetInsecure(true)
@@ -8,9 +8,12 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
@@ -27,6 +30,27 @@ const (
 	ToolTimeFormat = "2006-01-02T15:04:05.000-0700"
 )
 
+// Log formats
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// levelNames are the names of the verbosity levels in JSON log lines.
+var levelNames = []string{"info", "info", "debug", "trace"}
+
+// Fields are structured data attached to a log message.
+type Fields map[string]interface{}
+
+// jsonLine is a log line in the JSON format.
+type jsonLine struct {
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Component string `json:"component"`
+	Message   string `json:"message"`
+	Fields    Fields `json:"fields,omitempty"`
+}
+
 //// Tool Logger Definition
 
 type ToolLogger struct {
@@ -34,6 +58,11 @@ type ToolLogger struct {
 	writer    io.Writer
 	format    string
 	verbosity int
+
+	// whether lines are JSON objects rather than text, and the component
+	// named in them
+	json      bool
+	component string
 }
 
 type VerbosityLevel interface {
@@ -62,6 +91,23 @@ func (tl *ToolLogger) SetDateFormat(dateFormat string) {
 	tl.format = dateFormat
 }
 
+// SetFormat sets the format of log lines, TextFormat or JSONFormat. In the
+// JSON format, every line is an object with the timestamp, level, component,
+// message and fields of the message, the component being the given name of
+// the tool.
+func (tl *ToolLogger) SetFormat(format, component string) error {
+	switch format {
+	case TextFormat, "":
+		tl.json = false
+	case JSONFormat:
+		tl.json = true
+	default:
+		return fmt.Errorf("unknown log format '%v'", format)
+	}
+	tl.component = component
+	return nil
+}
+
 func (tl *ToolLogger) Logvf(minVerb int, format string, a ...interface{}) {
 	if minVerb < 0 {
 		panic("cannot set a minimum log verbosity that is less than 0")
@@ -70,11 +116,17 @@ func (tl *ToolLogger) Logvf(minVerb int, format string, a ...interface{}) {
 	if minVerb <= tl.verbosity {
 		tl.mutex.Lock()
 		defer tl.mutex.Unlock()
-		tl.log(fmt.Sprintf(format, a...))
+		tl.log(minVerb, fmt.Sprintf(format, a...), nil)
 	}
 }
 
 func (tl *ToolLogger) Logv(minVerb int, msg string) {
+	tl.LogvFields(minVerb, msg, nil)
+}
+
+// LogvFields logs a message with fields, which are key=value pairs after the
+// message in the text format.
+func (tl *ToolLogger) LogvFields(minVerb int, msg string, fields Fields) {
 	if minVerb < 0 {
 		panic("cannot set a minimum log verbosity that is less than 0")
 	}
@@ -82,12 +134,56 @@ func (tl *ToolLogger) Logv(minVerb int, msg string) {
 	if minVerb <= tl.verbosity {
 		tl.mutex.Lock()
 		defer tl.mutex.Unlock()
-		tl.log(msg)
+		tl.log(minVerb, msg, fields)
 	}
 }
 
-func (tl *ToolLogger) log(msg string) {
-	fmt.Fprintf(tl.writer, "%v\t%v\n", time.Now().Format(tl.format), msg)
+func (tl *ToolLogger) log(minVerb int, msg string, fields Fields) {
+	timestamp := time.Now().Format(tl.format)
+	if !tl.json {
+		fmt.Fprintf(tl.writer, "%v\t%v%v\n", timestamp, msg, formatFields(fields))
+		return
+	}
+
+	level := levelNames[len(levelNames)-1]
+	if minVerb < len(levelNames) {
+		level = levelNames[minVerb]
+	}
+	line, err := json.Marshal(jsonLine{
+		Timestamp: timestamp,
+		Level:     level,
+		Component: tl.component,
+		Message:   strings.TrimRight(msg, "\n"),
+		Fields:    fields,
+	})
+	if err != nil {
+		// a field can't be encoded, so log it as text
+		line, _ = json.Marshal(jsonLine{
+			Timestamp: timestamp,
+			Level:     level,
+			Component: tl.component,
+			Message:   strings.TrimRight(msg, "\n") + formatFields(fields),
+		})
+	}
+	fmt.Fprintf(tl.writer, "%s\n", line)
+}
+
+// formatFields returns the fields as key=value pairs sorted by key, each
+// preceded by a space.
+func formatFields(fields Fields) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %v=%v", key, fields[key])
+	}
+	return b.String()
 }
 
 func NewToolLogger(verbosity VerbosityLevel) *ToolLogger {
@@ -145,6 +241,10 @@ func Logv(minVerb int, msg string) {
 	globalToolLogger.Logv(minVerb, msg)
 }
 
+func LogvFields(minVerb int, msg string, fields Fields) {
+	globalToolLogger.LogvFields(minVerb, msg, fields)
+}
+
 func SetVerbosity(verbosity VerbosityLevel) {
 	globalToolLogger.SetVerbosity(verbosity)
 }
@@ -157,6 +257,10 @@ func SetDateFormat(dateFormat string) {
 	globalToolLogger.SetDateFormat(dateFormat)
 }
 
+func SetFormat(format, component string) error {
+	return globalToolLogger.SetFormat(format, component)
+}
+
 func Writer(minVerb int) io.Writer {
 	return globalToolLogger.Writer(minVerb)
 }
@@ -8,6 +8,7 @@ package log
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"strings"
 	"testing"
@@ -127,3 +128,50 @@ func TestToolLoggerWriter(t *testing.T) {
 		})
 	})
 }
+
+func TestJSONFormat(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a tool logger writing JSON to a buffer", t, func() {
+		buf := &bytes.Buffer{}
+		tl := NewToolLogger(&verbosity{L: 3})
+		tl.SetWriter(buf)
+		So(tl.SetFormat(JSONFormat, "mongodump"), ShouldBeNil)
+
+		Convey("every message should be one JSON object per line", func() {
+			tl.Logvf(Always, "done dumping %v", "test.foo")
+			tl.LogvFields(DebugLow, "dumped collection", Fields{"ns": "test.foo", "docs": 3})
+			tl.Writer(Info).Write([]byte("from a writer\n"))
+
+			lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			So(len(lines), ShouldEqual, 3)
+
+			var line map[string]interface{}
+			So(json.Unmarshal([]byte(lines[0]), &line), ShouldBeNil)
+			So(line["level"], ShouldEqual, "info")
+			So(line["component"], ShouldEqual, "mongodump")
+			So(line["message"], ShouldEqual, "done dumping test.foo")
+			So(line["timestamp"], ShouldNotBeEmpty)
+			So(line, ShouldNotContainKey, "fields")
+
+			line = nil
+			So(json.Unmarshal([]byte(lines[1]), &line), ShouldBeNil)
+			So(line["level"], ShouldEqual, "debug")
+			So(line["fields"], ShouldResemble, map[string]interface{}{"ns": "test.foo", "docs": 3.0})
+
+			line = nil
+			So(json.Unmarshal([]byte(lines[2]), &line), ShouldBeNil)
+			So(line["message"], ShouldEqual, "from a writer")
+		})
+
+		Convey("the text format should show fields after the message", func() {
+			So(tl.SetFormat(TextFormat, "mongodump"), ShouldBeNil)
+			tl.LogvFields(Always, "dumped collection", Fields{"ns": "test.foo", "docs": 3})
+			So(buf.String(), ShouldEndWith, "\tdumped collection docs=3 ns=test.foo\n")
+		})
+
+		Convey("an unknown format should be an error", func() {
+			So(tl.SetFormat("xml", "mongodump"), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,224 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package manifest records the sizes and SHA-256 checksums of the files of a
+// dump directory, so that copies of the dump can be checked for truncated or
+// corrupted files before they are restored.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileName is the name of the manifest in the root of a dump directory.
+const FileName = "manifest.json"
+
+// Entry is the size and checksum of a file of a dump.
+type Entry struct {
+	// Path is the path of the file relative to the dump directory, with
+	// forward slashes
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest is the list of the files of a dump directory. Files can be added
+// to it concurrently.
+type Manifest struct {
+	Files []Entry `json:"files"`
+
+	dir   string
+	mutex sync.Mutex
+}
+
+// New returns an empty Manifest of the dump directory.
+func New(dir string) *Manifest {
+	return &Manifest{dir: dir}
+}
+
+// Read reads the manifest of the dump directory. The error satisfies
+// os.IsNotExist if the dump has no manifest.
+func Read(dir string) (*Manifest, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, FileName))
+	if err != nil {
+		return nil, err
+	}
+	m := New(dir)
+	if err = json.Unmarshal(content, m); err != nil {
+		return nil, fmt.Errorf("error reading manifest %v: %v", filepath.Join(dir, FileName), err)
+	}
+	return m, nil
+}
+
+// Dir returns the dump directory of the manifest.
+func (m *Manifest) Dir() string {
+	return m.dir
+}
+
+// Add adds the entry of a file, replacing any entry it had.
+func (m *Manifest) Add(entry Entry) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i := range m.Files {
+		if m.Files[i].Path == entry.Path {
+			m.Files[i] = entry
+			return
+		}
+	}
+	m.Files = append(m.Files, entry)
+}
+
+// Merge adds the entries of another manifest of the same directory that
+// this one has no entry for, if their files still exist, so that dumping
+// part of a dump again keeps the entries of the rest of it.
+func (m *Manifest) Merge(other *Manifest) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	paths := make(map[string]bool)
+	for _, entry := range m.Files {
+		paths[entry.Path] = true
+	}
+	for _, entry := range other.Files {
+		if paths[entry.Path] {
+			continue
+		}
+		if _, err := os.Stat(m.path(entry.Path)); err == nil {
+			m.Files = append(m.Files, entry)
+		}
+	}
+}
+
+// Write writes the manifest, sorted by path, to the root of its directory.
+// It is written to a temporary file first, so that a manifest is never
+// partially written.
+func (m *Manifest) Write() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	sort.Sort(byPath(m.Files))
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(m.dir, FileName)
+	if err = ioutil.WriteFile(path+".tmp", append(content, '\n'), 0644); err != nil {
+		return fmt.Errorf("error writing manifest %v: %v", path, err)
+	}
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("error writing manifest %v: %v", path, err)
+	}
+	return nil
+}
+
+// Track returns a WriteCloser writing to w which, when it is closed, adds
+// the entry of the file at path with the bytes written to it.
+func (m *Manifest) Track(path string, w io.WriteCloser) io.WriteCloser {
+	return &trackingWriter{WriteCloser: w, manifest: m, path: path, hash: sha256.New()}
+}
+
+// Verify checks the files of the entries whose paths are under prefix, or
+// all of them if it is empty, against their sizes and checksums. It returns
+// a problem for each file that is missing or doesn't match its entry.
+func (m *Manifest) Verify(prefix string) ([]string, error) {
+	var problems []string
+	verified := 0
+	for _, entry := range m.Files {
+		if prefix != "" && entry.Path != prefix && !strings.HasPrefix(entry.Path, prefix+"/") {
+			continue
+		}
+		actual, err := Checksum(m.path(entry.Path), entry.Path)
+		if os.IsNotExist(err) {
+			problems = append(problems, fmt.Sprintf("%v is missing", entry.Path))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case actual.Size != entry.Size:
+			problems = append(problems, fmt.Sprintf("%v has %v bytes, but should have %v", entry.Path, actual.Size, entry.Size))
+		case actual.SHA256 != entry.SHA256:
+			problems = append(problems, fmt.Sprintf("%v has SHA-256 %v, but should have %v", entry.Path, actual.SHA256, entry.SHA256))
+		}
+		verified++
+	}
+	if verified == 0 && len(problems) == 0 {
+		return nil, fmt.Errorf("manifest %v lists no files under %v", filepath.Join(m.dir, FileName), prefix)
+	}
+	return problems, nil
+}
+
+// Checksum returns the entry of the file at path, under the given path
+// relative to its dump directory.
+func Checksum(path, relative string) (Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Entry{}, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return Entry{}, fmt.Errorf("error reading %v: %v", path, err)
+	}
+	return Entry{Path: relative, Size: size, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// Relative returns the path of a file relative to the dump directory, as
+// entries have it.
+func (m *Manifest) Relative(path string) (string, error) {
+	relative, err := filepath.Rel(m.dir, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(relative), nil
+}
+
+func (m *Manifest) path(relative string) string {
+	return filepath.Join(m.dir, filepath.FromSlash(relative))
+}
+
+// trackingWriter hashes the bytes written to a file of a dump, for its
+// entry in the manifest.
+type trackingWriter struct {
+	io.WriteCloser
+	manifest *Manifest
+	path     string
+	hash     hash.Hash
+	size     int64
+}
+
+func (w *trackingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteCloser.Write(p)
+	w.hash.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *trackingWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	w.manifest.Add(Entry{Path: w.path, Size: w.size, SHA256: hex.EncodeToString(w.hash.Sum(nil))})
+	return nil
+}
+
+// byPath sorts entries by their paths.
+type byPath []Entry
+
+func (s byPath) Len() int           { return len(s) }
+func (s byPath) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byPath) Less(i, j int) bool { return s[i].Path < s[j].Path }
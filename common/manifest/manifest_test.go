@@ -0,0 +1,118 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// writeDumpFile writes a file of a dump through the manifest.
+func writeDumpFile(m *Manifest, relative, content string) error {
+	path := filepath.Join(m.Dir(), filepath.FromSlash(relative))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := m.Track(relative, file)
+	if _, err = w.Write([]byte(content)); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func TestManifest(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a dump directory written through a manifest", t, func() {
+		dir, err := ioutil.TempDir("", "manifest")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+
+		m := New(dir)
+		So(writeDumpFile(m, "test/c.bson", "documents"), ShouldBeNil)
+		So(writeDumpFile(m, "test/c.metadata.json", `{"indexes":[]}`), ShouldBeNil)
+		So(writeDumpFile(m, "other/d.bson", "more documents"), ShouldBeNil)
+		So(m.Write(), ShouldBeNil)
+
+		read, err := Read(dir)
+		So(err, ShouldBeNil)
+		So(read.Files, ShouldHaveLength, 3)
+		So(read.Files[0].Path, ShouldEqual, "other/d.bson")
+		So(read.Files[1], ShouldResemble, Entry{
+			Path:   "test/c.bson",
+			Size:   9,
+			SHA256: "9b16b44d0e0a5cac4f968befb0b5b5eba913f9ef3dfa1501ed728b6ead72a357",
+		})
+
+		Convey("the unchanged files should match it", func() {
+			problems, err := read.Verify("")
+			So(err, ShouldBeNil)
+			So(problems, ShouldBeEmpty)
+		})
+
+		Convey("truncated, corrupted and missing files should be problems", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "test", "c.bson"), []byte("docu"), 0644), ShouldBeNil)
+			So(ioutil.WriteFile(filepath.Join(dir, "test", "c.metadata.json"), []byte(`{"indexes":[}]`), 0644), ShouldBeNil)
+			So(os.Remove(filepath.Join(dir, "other", "d.bson")), ShouldBeNil)
+			problems, err := read.Verify("")
+			So(err, ShouldBeNil)
+			So(problems, ShouldResemble, []string{
+				"other/d.bson is missing",
+				"test/c.bson has 4 bytes, but should have 9",
+				"test/c.metadata.json has SHA-256 " + mustChecksum(filepath.Join(dir, "test", "c.metadata.json")) +
+					", but should have " + read.Files[2].SHA256,
+			})
+
+			Convey("but only those under the prefix verified", func() {
+				problems, err := read.Verify("other")
+				So(err, ShouldBeNil)
+				So(problems, ShouldResemble, []string{"other/d.bson is missing"})
+			})
+		})
+
+		Convey("a prefix with no files should be an error", func() {
+			_, err := read.Verify("nothing")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("dumping part of the dump again should keep the entries of the rest", func() {
+			again := New(dir)
+			So(writeDumpFile(again, "test/c.bson", "new documents"), ShouldBeNil)
+			again.Merge(read)
+			So(again.Write(), ShouldBeNil)
+			merged, err := Read(dir)
+			So(err, ShouldBeNil)
+			So(merged.Files, ShouldHaveLength, 3)
+			So(merged.Files[1].Size, ShouldEqual, 13)
+			problems, err := merged.Verify("")
+			So(err, ShouldBeNil)
+			So(problems, ShouldBeEmpty)
+		})
+	})
+
+	Convey("A directory without a manifest should have none to read", t, func() {
+		_, err := Read(os.TempDir() + "/no-such-dump")
+		So(os.IsNotExist(err), ShouldBeTrue)
+	})
+}
+
+func mustChecksum(path string) string {
+	entry, err := Checksum(path, "")
+	if err != nil {
+		panic(err)
+	}
+	return entry.SHA256
+}
@@ -0,0 +1,97 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package options
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/atlas"
+	"github.com/mongodb/mongo-tools/common/connstring"
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// The environment variables the Atlas API key is read from when it isn't
+// given, which the Atlas CLI also reads.
+const (
+	AtlasPublicKeyEnv  = "MONGODB_ATLAS_PUBLIC_API_KEY"
+	AtlasPrivateKeyEnv = "MONGODB_ATLAS_PRIVATE_API_KEY"
+)
+
+// Atlas holds the options of connecting to an Atlas cluster given by name,
+// whose hosts are looked up with the Atlas Admin API.
+type Atlas struct {
+	AtlasProject    string `long:"atlasProject" value-name:"<project>" description:"name or ID of the Atlas project of --atlasCluster"`
+	AtlasCluster    string `long:"atlasCluster" value-name:"<cluster>" description:"name of an Atlas cluster to connect to, whose hosts, replica set and TLS settings are looked up with the Atlas Admin API instead of being given with --uri or --host"`
+	AtlasPublicKey  string `long:"atlasPublicKey" value-name:"<key>" description:"public key of the Atlas programmatic API key to look up the cluster with (defaults to $MONGODB_ATLAS_PUBLIC_API_KEY)"`
+	AtlasPrivateKey string `long:"atlasPrivateKey" value-name:"<key>" description:"private key of the Atlas programmatic API key (defaults to $MONGODB_ATLAS_PRIVATE_API_KEY)"`
+	AtlasPrivate    bool   `long:"atlasPrivate" description:"connect with the private connection string of the cluster, from a network peered with it"`
+	AtlasBaseURL    string `long:"atlasBaseURL" hidden:"true"`
+}
+
+// resolveAtlas looks up the cluster given with --atlasCluster, and connects
+// to its hosts: through its replica set, or to its mongos routers when it is
+// sharded, with TLS and the authentication database of the cluster.
+func (o *ToolOptions) resolveAtlas() error {
+	a := o.Atlas
+	if a == nil || a.AtlasCluster == "" {
+		if a != nil && (a.AtlasProject != "" || a.AtlasPrivate) {
+			return fmt.Errorf("--atlasProject and --atlasPrivate require --atlasCluster")
+		}
+		return nil
+	}
+	switch {
+	case a.AtlasProject == "":
+		return fmt.Errorf("--atlasCluster requires --atlasProject")
+	case o.URI != nil && o.URI.ConnectionString != "":
+		return fmt.Errorf("illegal argument combination: cannot specify --atlasCluster and --uri")
+	case o.Host != "" || o.Port != "":
+		return fmt.Errorf("illegal argument combination: cannot specify --atlasCluster and --host or --port")
+	}
+	if a.AtlasPublicKey == "" {
+		a.AtlasPublicKey = os.Getenv(AtlasPublicKeyEnv)
+	}
+	if a.AtlasPrivateKey == "" {
+		a.AtlasPrivateKey = os.Getenv(AtlasPrivateKeyEnv)
+	}
+	if a.AtlasPublicKey == "" || a.AtlasPrivateKey == "" {
+		return fmt.Errorf("--atlasCluster requires an API key, given with --atlasPublicKey and --atlasPrivateKey "+
+			"or with $%v and $%v", AtlasPublicKeyEnv, AtlasPrivateKeyEnv)
+	}
+
+	client := atlas.NewClient(a.AtlasBaseURL, a.AtlasPublicKey, a.AtlasPrivateKey)
+	cluster, err := client.Cluster(a.AtlasProject, a.AtlasCluster)
+	if err != nil {
+		return err
+	}
+	uri, err := cluster.ConnectionString(a.AtlasPrivate)
+	if err != nil {
+		return err
+	}
+	cs, err := connstring.ParseURIConnectionString(uri)
+	if err != nil {
+		return fmt.Errorf("error parsing the connection string of Atlas cluster %v: %v", cluster.Name, err)
+	}
+
+	o.Host = strings.Join(cs.Hosts, ",")
+	if cs.ReplicaSet != "" && !cluster.Sharded() {
+		o.Host = cs.ReplicaSet + "/" + o.Host
+	}
+	if cs.UseSSL || !cs.UseSSLSeen {
+		if !BuiltWithSSL {
+			return fmt.Errorf("cannot connect to Atlas cluster %v: tool not built with SSL support", cluster.Name)
+		}
+		o.SSL.UseSSL = true
+	}
+	if o.Auth != nil && o.Auth.Source == "" && cs.AuthSource != "" {
+		o.Auth.Source = cs.AuthSource
+	}
+	log.Logvf(log.DebugLow, "connecting to Atlas cluster %v (%v, MongoDB %v) at %v",
+		cluster.Name, strings.ToLower(cluster.ClusterType), cluster.MongoDBVersion, o.Host)
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package options
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestResolveAtlas(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	clusters := map[string]string{
+		"rs": `{"name": "rs", "clusterType": "REPLICASET", "connectionStrings": {
+			"standard": "mongodb://a.example.net:27017,b.example.net:27017/?ssl=true&authSource=admin&replicaSet=atlas-x-shard-0"}}`,
+		"sharded": `{"name": "sharded", "clusterType": "SHARDED", "connectionStrings": {
+			"standard": "mongodb://s0.example.net:27016,s1.example.net:27016/?ssl=true&authSource=admin"}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the project is given by ID, and authentication is left to the
+		// tests of the atlas package
+		fmt.Fprint(w, clusters[r.URL.Path[len("/groups/5f1d7e8a9b0c1d2e3f4a5b6c/clusters/"):]])
+	}))
+	defer server.Close()
+
+	builtWithSSL := BuiltWithSSL
+	BuiltWithSSL = true
+	defer func() { BuiltWithSSL = builtWithSSL }()
+
+	parse := func(args ...string) (*ToolOptions, error) {
+		opts := New("test", "", EnabledOptions{Connection: true, Auth: true, URI: true})
+		args = append([]string{"--atlasProject", "5f1d7e8a9b0c1d2e3f4a5b6c", "--atlasBaseURL", server.URL,
+			"--atlasPublicKey", "public", "--atlasPrivateKey", "private"}, args...)
+		_, err := opts.ParseArgs(args)
+		return opts, err
+	}
+
+	Convey("Connecting to an Atlas cluster given by name", t, func() {
+		Convey("should connect through the replica set of a replica set cluster, with TLS", func() {
+			opts, err := parse("--atlasCluster", "rs")
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "atlas-x-shard-0/a.example.net:27017,b.example.net:27017")
+			So(opts.ReplicaSetName, ShouldEqual, "atlas-x-shard-0")
+			So(opts.Direct, ShouldBeFalse)
+			So(opts.UseSSL, ShouldBeTrue)
+			So(opts.Source, ShouldEqual, "admin")
+		})
+
+		Convey("should connect to the mongos routers of a sharded cluster", func() {
+			opts, err := parse("--atlasCluster", "sharded", "--authenticationDatabase", "$external")
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "s0.example.net:27016,s1.example.net:27016")
+			So(opts.Direct, ShouldBeTrue)
+			So(opts.Source, ShouldEqual, "$external")
+		})
+
+		Convey("should fail with --uri or --host", func() {
+			_, err := parse("--atlasCluster", "rs", "--uri", "mongodb://localhost")
+			So(err, ShouldNotBeNil)
+			_, err = parse("--atlasCluster", "rs", "--host", "localhost")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should fail without a project", func() {
+			opts := New("test", "", EnabledOptions{Connection: true})
+			_, err := opts.ParseArgs([]string{"--atlasCluster", "rs"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "--atlasProject")
+		})
+	})
+}
@@ -0,0 +1,218 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package options
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configPath returns the path given with --config in the command line args,
+// if any.
+func configPath(args []string) string {
+	for i, arg := range args {
+		switch {
+		case arg == "--":
+			return ""
+		case arg == "--config" && i+1 < len(args):
+			return args[i+1]
+		case strings.HasPrefix(arg, "--config="):
+			return strings.TrimPrefix(arg, "--config=")
+		}
+	}
+	return ""
+}
+
+// configArgs reads a config file and returns its options as command line
+// args, to be parsed before the ones actually given so that those take
+// precedence. The keys of the file are the long names of options, and its
+// values are strings, numbers, booleans, or lists for options that can be
+// given more than once. A boolean option is given by a true value.
+func (o *ToolOptions) configArgs(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %v", err)
+	}
+	var values map[string]interface{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		decoder := json.NewDecoder(bytes.NewReader(trimmed))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	} else {
+		values, err = parseYAMLConfig(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config file %v: %v", path, err)
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args []string
+	for _, key := range keys {
+		option := o.parser.FindOptionByLongName(key)
+		if option == nil || key == "config" {
+			return nil, fmt.Errorf("error in config file %v: unknown option '%v'", path, key)
+		}
+		isBool := reflect.ValueOf(option.Value()).Kind() == reflect.Bool
+
+		items, isList := values[key].([]interface{})
+		if !isList {
+			items = []interface{}{values[key]}
+		}
+		for _, item := range items {
+			value, err := configValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("error in config file %v: option '%v' %v", path, key, err)
+			}
+			if !isBool {
+				args = append(args, "--"+key+"="+value)
+				continue
+			}
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("error in config file %v: option '%v' must be true or false", path, key)
+			}
+			if enabled {
+				args = append(args, "--"+key)
+			}
+		}
+	}
+	return args, nil
+}
+
+// configValue returns a config value as it would be given on the command
+// line.
+func configValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case json.Number:
+		return v.String(), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("must be a string, number, boolean or list of them")
+}
+
+// parseYAMLConfig parses the subset of YAML needed for config files: keys
+// with scalar values, plain or quoted, and lists of them, in flow style
+// ("[a, b]") or block style (lines of "- a"), with comments.
+func parseYAMLConfig(data []byte) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	// the key of a block list being read
+	listKey := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(stripYAMLComment(line), " \t\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		lineNumber := i + 1
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if listKey == "" {
+				return nil, fmt.Errorf("line %v: list item without a key", lineNumber)
+			}
+			item, err := yamlScalar(strings.TrimSpace(strings.TrimPrefix(trimmed, "-")))
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", lineNumber, err)
+			}
+			values[listKey] = append(values[listKey].([]interface{}), item)
+			continue
+		}
+		if line != trimmed {
+			return nil, fmt.Errorf("line %v: nested keys are not supported", lineNumber)
+		}
+
+		colon := strings.Index(line, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("line %v: expected 'key: value'", lineNumber)
+		}
+		key := strings.TrimSpace(line[:colon])
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %v: duplicate key '%v'", lineNumber, key)
+		}
+		raw := strings.TrimSpace(line[colon+1:])
+		listKey = ""
+		switch {
+		case raw == "":
+			// the value is a block list on the following lines
+			listKey = key
+			values[key] = []interface{}{}
+		case strings.HasPrefix(raw, "[") && strings.HasSuffix(raw, "]"):
+			items := []interface{}{}
+			if inner := strings.TrimSpace(raw[1 : len(raw)-1]); inner != "" {
+				for _, item := range strings.Split(inner, ",") {
+					value, err := yamlScalar(strings.TrimSpace(item))
+					if err != nil {
+						return nil, fmt.Errorf("line %v: %v", lineNumber, err)
+					}
+					items = append(items, value)
+				}
+			}
+			values[key] = items
+		default:
+			value, err := yamlScalar(raw)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %v", lineNumber, err)
+			}
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// stripYAMLComment removes a comment, which starts with a '#' at the start
+// of the line or after a space, outside of quotes.
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// yamlScalar returns the value of a scalar, unquoting it if it is quoted.
+// Unquoted true and false are booleans, and everything else is a string.
+func yamlScalar(raw string) (interface{}, error) {
+	switch {
+	case len(raw) >= 2 && raw[0] == '"' && raw[len(raw)-1] == '"':
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quoted string %v", raw)
+		}
+		return value, nil
+	case len(raw) >= 2 && raw[0] == '\'' && raw[len(raw)-1] == '\'':
+		return strings.Replace(raw[1:len(raw)-1], "''", "'", -1), nil
+	case raw == "true" || raw == "false":
+		return raw == "true", nil
+	case raw == "~" || raw == "null":
+		return nil, nil
+	}
+	return raw, nil
+}
@@ -0,0 +1,141 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConfigFile(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	dir, err := ioutil.TempDir("", "config_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	Convey("With a new ToolOptions", t, func() {
+		opts := New("test", "", EnabledOptions{Auth: true, Connection: true, Namespace: true})
+
+		Convey("options are read from a YAML config file", func() {
+			path := write("config.yaml", `# connection
+host: "db.example.com"
+port: 27018 # not the default
+username: 'o''brien'
+password: se#cret
+quiet: true
+verbose:
+  - ""
+  - ""
+`)
+			_, err := opts.ParseArgs([]string{"--config", path})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "db.example.com")
+			So(opts.Port, ShouldEqual, "27018")
+			So(opts.Username, ShouldEqual, "o'brien")
+			So(opts.Password, ShouldEqual, "se#cret")
+			So(opts.Quiet, ShouldBeTrue)
+			So(opts.Level(), ShouldEqual, 2)
+		})
+
+		Convey("options are read from a JSON config file", func() {
+			path := write("config.json", `{"host": "db.example.com", "port": 27018, "quiet": false, "db": "test"}`)
+			_, err := opts.ParseArgs([]string{"--config=" + path})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "db.example.com")
+			So(opts.Port, ShouldEqual, "27018")
+			So(opts.Quiet, ShouldBeFalse)
+			So(opts.DB, ShouldEqual, "test")
+		})
+
+		Convey("options given on the command line take precedence", func() {
+			path := write("precedence.yaml", "host: db.example.com\ndb: fromFile\n")
+			_, err := opts.ParseArgs([]string{"--host", "other.example.com", "--config", path})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "other.example.com")
+			So(opts.DB, ShouldEqual, "fromFile")
+		})
+
+		Convey("options given more than once on the command line replace those of the file", func() {
+			filters := &testFilterOptions{}
+			opts.AddOptions(filters)
+			path := write("repeated.yaml", "nsInclude: [a.*, b.*]\n")
+			_, err := opts.ParseArgs([]string{"--config", path, "--nsInclude", "c.*"})
+			So(err, ShouldBeNil)
+			So(filters.NSInclude, ShouldResemble, []string{"c.*"})
+		})
+
+		Convey("a URI on the command line replaces the host and port of the file", func() {
+			opts = New("test", "", EnabledOptions{Auth: true, Connection: true, Namespace: true, URI: true})
+			path := write("uri.yaml", "host: db.example.com\nport: 27018\n")
+			_, err := opts.ParseArgs([]string{"--config", path, "--uri", "mongodb://other.example.com:27019"})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "")
+			So(opts.Port, ShouldEqual, "")
+			So(opts.ConnectionString, ShouldEqual, "mongodb://other.example.com:27019")
+		})
+
+		Convey("unknown options are an error naming the file", func() {
+			path := write("unknown.yaml", "hots: db.example.com\n")
+			_, err := opts.ParseArgs([]string{"--config", path})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, path)
+			So(err.Error(), ShouldContainSubstring, "hots")
+		})
+
+		Convey("a config file can't give another config file", func() {
+			path := write("nested.yaml", "config: other.yaml\n")
+			_, err := opts.ParseArgs([]string{"--config", path})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("boolean options must be true or false", func() {
+			path := write("bool.yaml", "quiet: sometimes\n")
+			_, err := opts.ParseArgs([]string{"--config", path})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("nested YAML keys are an error", func() {
+			path := write("nested-keys.yaml", "net:\n  port: 27018\n")
+			_, err := opts.ParseArgs([]string{"--config", path})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line 2")
+		})
+
+		Convey("a missing config file is an error", func() {
+			_, err := opts.ParseArgs([]string{"--config", filepath.Join(dir, "missing.yaml")})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("--config after -- is not read", func() {
+			_, err := opts.ParseArgs([]string{"--", "--config", filepath.Join(dir, "missing.yaml")})
+			So(err, ShouldBeNil)
+		})
+	})
+}
+
+// testFilterOptions is a group with an option that can be given more than
+// once.
+type testFilterOptions struct {
+	NSInclude []string `long:"nsInclude"`
+}
+
+func (*testFilterOptions) Name() string { return "filter" }
@@ -0,0 +1,171 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package options
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jessevdk/go-flags"
+)
+
+// EnvPrefix starts the names of the environment variables options are read
+// from, e.g. MONGO_TOOLS_URI for --uri.
+const EnvPrefix = "MONGO_TOOLS_"
+
+// unboundOptions are never read from the environment.
+var unboundOptions = map[string]bool{
+	"help":    true,
+	"version": true,
+}
+
+// EnvName returns the name of the environment variable an option is read
+// from, given its long name: the words of the name in upper case, joined by
+// underscores, after EnvPrefix, e.g. MONGO_TOOLS_AUTHENTICATION_DATABASE
+// for --authenticationDatabase and MONGO_TOOLS_SSL_PEM_KEY_FILE for
+// --sslPEMKeyFile.
+func EnvName(longName string) string {
+	runes := []rune(longName)
+	var name []rune
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			name = append(name, '_')
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			// a word starts after a lower case letter or a digit, or with
+			// the last capital of an acronym followed by a lower case letter
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) ||
+				unicode.IsUpper(previous) && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+				name = append(name, '_')
+			}
+		}
+		name = append(name, unicode.ToUpper(r))
+	}
+	return EnvPrefix + string(name)
+}
+
+// boundOptions returns the options of the group and its subgroups that can
+// be read from the environment.
+func boundOptions(group *flags.Group) []*flags.Option {
+	var options []*flags.Option
+	for _, option := range group.Options() {
+		if option.LongName == "" || unboundOptions[option.LongName] {
+			continue
+		}
+		options = append(options, option)
+	}
+	for _, subgroup := range group.Groups() {
+		options = append(options, boundOptions(subgroup)...)
+	}
+	return options
+}
+
+// showEnvNames sets the environment variables of the options, to show them
+// in the help. They aren't set while parsing, as the parser would then also
+// read the options overridden by the command line from the environment.
+func (o *ToolOptions) showEnvNames() {
+	for _, option := range boundOptions(o.parser.Group) {
+		option.EnvDefaultKey = EnvName(option.LongName)
+	}
+}
+
+// givenOptions returns the long names of the options given in the command
+// line args.
+func (o *ToolOptions) givenOptions(args []string) map[string]bool {
+	given := map[string]bool{}
+	for _, arg := range args {
+		switch {
+		case arg == "--":
+			return given
+		case strings.HasPrefix(arg, "--"):
+			given[strings.SplitN(arg[2:], "=", 2)[0]] = true
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// clustered short options, e.g. -vvv, up to one taking a value
+			for _, short := range arg[1:] {
+				option := o.parser.FindOptionByShortName(short)
+				if option == nil {
+					break
+				}
+				given[option.LongName] = true
+				if reflect.ValueOf(option.Value()).Kind() != reflect.Bool {
+					break
+				}
+			}
+		}
+	}
+	return given
+}
+
+// conflictingOptions maps options to the ones they can't be given with, which
+// they override when given with higher precedence.
+var conflictingOptions = map[string][]string{
+	"uri":  {"host", "port"},
+	"host": {"uri"},
+	"port": {"uri"},
+}
+
+// overriddenOptions returns the long names of the options that the options
+// named are given with precedence over: themselves, so that values of
+// options that can be given more than once aren't combined, and the options
+// conflicting with them.
+func overriddenOptions(names map[string]bool) map[string]bool {
+	overridden := map[string]bool{}
+	for name := range names {
+		overridden[name] = true
+		for _, conflicting := range conflictingOptions[name] {
+			overridden[conflicting] = true
+		}
+	}
+	return overridden
+}
+
+// envArgs returns the options set in the environment as command line args,
+// leaving out the options in given, and the long names of the options it
+// returns. Boolean options are enabled by a true value, e.g. "true" or "1",
+// and options that can be given more than once take a single value.
+func (o *ToolOptions) envArgs(given map[string]bool) ([]string, map[string]bool, error) {
+	var envArgs []string
+	set := map[string]bool{}
+	for _, option := range boundOptions(o.parser.Group) {
+		name := EnvName(option.LongName)
+		value, ok := os.LookupEnv(name)
+		if !ok || given[option.LongName] {
+			continue
+		}
+		set[option.LongName] = true
+		if reflect.ValueOf(option.Value()).Kind() != reflect.Bool {
+			envArgs = append(envArgs, "--"+option.LongName+"="+value)
+			continue
+		}
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid value for %v: '%v' must be true or false", name, value)
+		}
+		if enabled {
+			envArgs = append(envArgs, "--"+option.LongName)
+		}
+	}
+	return envArgs, set, nil
+}
+
+// withoutOptions returns the args, made by configArgs or envArgs, without
+// the options whose long names are in names.
+func withoutOptions(args []string, names map[string]bool) []string {
+	var kept []string
+	for _, arg := range args {
+		if !names[strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)[0]] {
+			kept = append(kept, arg)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,112 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package options
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEnvName(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Environment variable names should be made of the words of the long names", t, func() {
+		So(EnvName("uri"), ShouldEqual, "MONGO_TOOLS_URI")
+		So(EnvName("authenticationDatabase"), ShouldEqual, "MONGO_TOOLS_AUTHENTICATION_DATABASE")
+		So(EnvName("sslPEMKeyFile"), ShouldEqual, "MONGO_TOOLS_SSL_PEM_KEY_FILE")
+		So(EnvName("TCPKeepAliveSeconds"), ShouldEqual, "MONGO_TOOLS_TCP_KEEP_ALIVE_SECONDS")
+		So(EnvName("heartbeatFrequencyMS"), ShouldEqual, "MONGO_TOOLS_HEARTBEAT_FREQUENCY_MS")
+		So(EnvName("gzip"), ShouldEqual, "MONGO_TOOLS_GZIP")
+	})
+}
+
+func TestEnvironment(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	setenv := func(values map[string]string) func() {
+		for name, value := range values {
+			os.Setenv(name, value)
+		}
+		return func() {
+			for name := range values {
+				os.Unsetenv(name)
+			}
+		}
+	}
+
+	Convey("With a new ToolOptions", t, func() {
+		opts := New("test", "", EnabledOptions{Auth: true, Connection: true, Namespace: true, URI: true})
+
+		Convey("options should be read from the environment", func() {
+			defer setenv(map[string]string{
+				"MONGO_TOOLS_HOST":     "db.example.com",
+				"MONGO_TOOLS_PORT":     "27018",
+				"MONGO_TOOLS_USERNAME": "user",
+				"MONGO_TOOLS_PASSWORD": "secret",
+				"MONGO_TOOLS_QUIET":    "true",
+				"MONGO_TOOLS_VERBOSE":  "3",
+			})()
+			_, err := opts.ParseArgs([]string{})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "db.example.com")
+			So(opts.Port, ShouldEqual, "27018")
+			So(opts.Username, ShouldEqual, "user")
+			So(opts.Password, ShouldEqual, "secret")
+			So(opts.Quiet, ShouldBeTrue)
+			So(opts.Level(), ShouldEqual, 3)
+		})
+
+		Convey("a false boolean should leave the option disabled", func() {
+			defer setenv(map[string]string{"MONGO_TOOLS_QUIET": "0"})()
+			_, err := opts.ParseArgs([]string{})
+			So(err, ShouldBeNil)
+			So(opts.Quiet, ShouldBeFalse)
+		})
+
+		Convey("an invalid boolean should be an error naming the variable", func() {
+			defer setenv(map[string]string{"MONGO_TOOLS_QUIET": "yes please"})()
+			_, err := opts.ParseArgs([]string{})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "MONGO_TOOLS_QUIET")
+		})
+
+		Convey("options given on the command line should take precedence", func() {
+			defer setenv(map[string]string{"MONGO_TOOLS_HOST": "env.example.com", "MONGO_TOOLS_DB": "fromEnv"})()
+			_, err := opts.ParseArgs([]string{"-h", "cli.example.com"})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "cli.example.com")
+			So(opts.DB, ShouldEqual, "fromEnv")
+		})
+
+		Convey("a URI on the command line should replace the host of the environment", func() {
+			defer setenv(map[string]string{"MONGO_TOOLS_HOST": "env.example.com"})()
+			_, err := opts.ParseArgs([]string{"--uri", "mongodb://cli.example.com"})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "")
+			So(opts.ConnectionString, ShouldEqual, "mongodb://cli.example.com")
+		})
+
+		Convey("the environment should take precedence over the config file, which it can name", func() {
+			dir, err := ioutil.TempDir("", "env_test")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "config.yaml")
+			So(ioutil.WriteFile(path, []byte("host: file.example.com\ndb: fromFile\n"), 0644), ShouldBeNil)
+
+			defer setenv(map[string]string{"MONGO_TOOLS_CONFIG": path, "MONGO_TOOLS_HOST": "env.example.com"})()
+			_, err = opts.ParseArgs([]string{})
+			So(err, ShouldBeNil)
+			So(opts.Host, ShouldEqual, "env.example.com")
+			So(opts.DB, ShouldEqual, "fromFile")
+		})
+	})
+}
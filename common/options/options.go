@@ -20,7 +20,9 @@ import (
 	"github.com/jessevdk/go-flags"
 	"github.com/mongodb/mongo-tools/common/connstring"
 	"github.com/mongodb/mongo-tools/common/failpoint"
+	"github.com/mongodb/mongo-tools/common/fips"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/password"
 	"github.com/mongodb/mongo-tools/common/util"
 )
 
@@ -31,13 +33,14 @@ var (
 )
 
 var (
-	KnownURIOptionsAuth           = []string{"authsource", "authmechanism"}
-	KnownURIOptionsConnection     = []string{"connecttimeoutms"}
+	KnownURIOptionsAuth           = []string{"authsource", "authmechanism", "authmechanismproperties"}
+	KnownURIOptionsConnection     = []string{"connecttimeoutms", "retrywrites", "retryreads", "maxpoolsize", "minpoolsize", "maxidletimems", "sockettimeoutms", "serverselectiontimeoutms", "heartbeatfrequencyms", "compressors"}
 	KnownURIOptionsSSL            = []string{"ssl"}
-	KnownURIOptionsReadPreference = []string{"readpreference"}
+	KnownURIOptionsReadPreference = []string{"readpreference", "maxstalenessseconds"}
 	KnownURIOptionsKerberos       = []string{"gssapiservicename", "gssapihostname"}
 	KnownURIOptionsWriteConcern   = []string{"wtimeout", "w", "j", "fsync"}
 	KnownURIOptionsReplicaSet     = []string{"replicaset"}
+	KnownURIOptionsSRV            = []string{"srvservicename"}
 )
 
 var (
@@ -45,6 +48,10 @@ var (
 	BuiltWithGSSAPI bool
 )
 
+// PasswordEnv is the environment variable the password is read from when a
+// username is given without one.
+const PasswordEnv = "MONGODB_PASSWORD"
+
 const IncompatibleArgsErrorFormat = "illegal argument combination: cannot specify %s and --uri"
 const ConflictingArgsErrorFormat = "illegal argument combination: %s conflicts with --uri"
 
@@ -67,6 +74,7 @@ type ToolOptions struct {
 	*Auth
 	*Kerberos
 	*Namespace
+	*Atlas
 
 	// Force direct connection to the server and disable the
 	// drivers automatic repl set discovery logic.
@@ -96,6 +104,13 @@ type General struct {
 	Help    bool `long:"help" description:"print usage"`
 	Version bool `long:"version" description:"print the tool version and exit"`
 
+	ConfigPath string `long:"config" value-name:"<filename>" description:"path to a YAML or JSON file of options keyed by their long names, e.g. 'password: secret', to keep them off the command line; options given on the command line or in the environment take precedence"`
+
+	FIPS bool `long:"fips" description:"restrict TLS, authentication and checksums to FIPS-approved algorithms, refusing operations that would use others such as MD5 (always on in builds with the fips tag)"`
+
+	ProgressFD     int    `long:"progressFD" value-name:"<fd>" description:"file descriptor to write progress events to, as one JSON object per line"`
+	ProgressSocket string `long:"progressSocket" value-name:"<path>" description:"Unix socket to write progress events to, as one JSON object per line"`
+
 	MaxProcs   int    `long:"numThreads" hidden:"true"`
 	Failpoints string `long:"failpoints" hidden:"true"`
 }
@@ -104,6 +119,7 @@ type General struct {
 type Verbosity struct {
 	SetVerbosity func(string) `short:"v" long:"verbose" value-name:"<level>" description:"more detailed log output (include multiple times for more verbosity, e.g. -vvvvv, or specify a numeric value, e.g. --verbose=N)" optional:"true" optional-value:""`
 	Quiet        bool         `long:"quiet" description:"hide all log output"`
+	LogFormat    string       `long:"logFormat" value-name:"<format>" default:"text" choice:"text" choice:"json" description:"format of log output: text, or json for one JSON object per line with the timestamp, level, component, message and fields"`
 	VLevel       int          `no-flag:"true"`
 }
 
@@ -129,7 +145,78 @@ type Connection struct {
 	Port string `long:"port" value-name:"<port>" description:"server port (can also use --host hostname:port)"`
 
 	Timeout             int `long:"dialTimeout" default:"3" hidden:"true" description:"dial timeout in seconds"`
-	TCPKeepAliveSeconds int `long:"TCPKeepAliveSeconds" default:"30" hidden:"true" description:"seconds between TCP keep alives"`
+	TCPKeepAliveSeconds int `long:"TCPKeepAliveSeconds" value-name:"<seconds>" default:"30" description:"seconds between TCP keep alives on connections to the server; 0 disables them (default 30)"`
+
+	ProxyHost     string `long:"proxyHost" value-name:"<hostname>" description:"host of a proxy to connect to the server through"`
+	ProxyPort     int    `long:"proxyPort" value-name:"<port>" description:"port of the proxy (defaults to 1080 for socks5 and 8080 for http)"`
+	ProxyType     string `long:"proxyType" value-name:"<type>" default:"socks5" choice:"socks5" choice:"http" description:"protocol of the proxy, socks5 or http (using CONNECT)"`
+	ProxyUsername string `long:"proxyUsername" value-name:"<username>" description:"username for authentication to the proxy"`
+	ProxyPassword string `long:"proxyPassword" value-name:"<password>" description:"password for authentication to the proxy"`
+
+	MaxPoolSize              int `long:"maxPoolSize" value-name:"<count>" description:"maximum number of connections to each server (defaults to 4096)"`
+	MinPoolSize              int `long:"minPoolSize" value-name:"<count>" description:"number of connections kept open to each server, even when idle (defaults to 0)"`
+	MaxIdleTimeMS            int `long:"maxIdleTimeMS" value-name:"<milliseconds>" description:"time a connection may stay idle before it is closed (defaults to 0, keeping idle connections open)"`
+	SocketTimeoutMS          int `long:"socketTimeoutMS" value-name:"<milliseconds>" description:"time to wait for a response from the server before giving up on a connection (defaults to 60000)"`
+	ServerSelectionTimeoutMS int `long:"serverSelectionTimeoutMS" value-name:"<milliseconds>" description:"time to wait for a suitable server to become available (defaults to 7000)"`
+	HeartbeatFrequencyMS     int `long:"heartbeatFrequencyMS" value-name:"<milliseconds>" description:"time between pings of the server, also sent on connections idle for that long to keep them alive through firewalls (defaults to 15000, without pinging idle connections)"`
+
+	APIVersion           string `long:"apiVersion" value-name:"<version>" description:"version of the server API to declare in every command, which must be 1, for clusters that require one"`
+	APIStrict            bool   `long:"apiStrict" description:"have the server reject the commands outside the declared API version, to find out whether the tool relies on any (requires --apiVersion)"`
+	APIDeprecationErrors bool   `long:"apiDeprecationErrors" description:"have the server reject the commands deprecated in the declared API version (requires --apiVersion)"`
+
+	Compressors string `long:"compressors" value-name:"<compressor>[,<compressor>]" description:"comma-separated list of compressors to offer the server for network traffic, by order of preference: snappy, zstd or zlib (defaults to no compression)"`
+
+	Diagnose bool `long:"diagnose" description:"test each step of connecting to the server, from resolving its host names to checking the privileges the tool needs, print a report of them and exit"`
+
+	// whether to retry writes and reads once after an error such as an
+	// election, set by the retryWrites and retryReads URI options; both are
+	// retried when unset. Only single-document writes and the initial query
+	// of a cursor are retried, not the getMores that continue it
+	RetryWrites *bool `no-flag:"true"`
+	RetryReads  *bool `no-flag:"true"`
+}
+
+// Encryption holds the options of encrypting fields with data keys protected
+// by a local master key, for the tools that decrypt the fields they read or
+// encrypt those they write. Data keys protected by a KMS provider, such as
+// AWS, Azure or GCP, can't be used.
+type Encryption struct {
+	KeyVaultNamespace  string `long:"keyVaultNamespace" value-name:"<database>.<collection>" description:"namespace of the key vault holding the data keys of encrypted fields, which must be protected by the local master key rather than by a KMS provider such as AWS, Azure or GCP; enables field encryption"`
+	LocalMasterKeyFile string `long:"localMasterKeyFile" value-name:"<filename>" description:"file holding the 96-byte local master key protecting the data keys, raw or base64 encoded"`
+	SchemaMapFile      string `long:"schemaMapFile" value-name:"<filename>" description:"JSON file mapping namespaces to JSON schemas, whose encrypt keywords select the fields to encrypt when writing"`
+}
+
+// Name returns a human-readable group name for encryption options.
+func (*Encryption) Name() string {
+	return "local master key encryption"
+}
+
+// Enabled returns whether a key vault was given, enabling encryption.
+func (e *Encryption) Enabled() bool {
+	return e != nil && e.KeyVaultNamespace != ""
+}
+
+// Tracing holds the options of exporting traces of the tools' operations to
+// an OpenTelemetry collector.
+type Tracing struct {
+	OTelEndpoint string `long:"otelEndpoint" value-name:"<url>" description:"OTLP/HTTP endpoint of an OpenTelemetry collector to export trace spans to, e.g. http://localhost:4318; a W3C TRACEPARENT environment variable makes the run part of that trace"`
+}
+
+// Name returns a human-readable group name for tracing options.
+func (*Tracing) Name() string {
+	return "tracing"
+}
+
+// Throttle holds the options limiting the load a tool puts on the server.
+type Throttle struct {
+	MaxDocsPerSec  int   `long:"maxDocsPerSec" value-name:"<count>" description:"maximum number of documents to read or write per second, to limit the load on the server"`
+	MaxBytesPerSec int64 `long:"maxBytesPerSec" value-name:"<bytes>" description:"maximum number of bytes of documents to read or write per second"`
+	MaxLatencyMS   int   `long:"maxLatencyMS" value-name:"<milliseconds>" description:"slow down adaptively while server operations take longer than this"`
+}
+
+// Name returns a human-readable group name for throttle options.
+func (*Throttle) Name() string {
+	return "throttle"
 }
 
 // Struct holding ssl-related options
@@ -137,11 +224,16 @@ type SSL struct {
 	UseSSL              bool   `long:"ssl" description:"connect to a mongod or mongos that has ssl enabled"`
 	SSLCAFile           string `long:"sslCAFile" value-name:"<filename>" description:"the .pem file containing the root certificate chain from the certificate authority"`
 	SSLPEMKeyFile       string `long:"sslPEMKeyFile" value-name:"<filename>" description:"the .pem file containing the certificate and key"`
-	SSLPEMKeyPassword   string `long:"sslPEMKeyPassword" value-name:"<password>" description:"the password to decrypt the sslPEMKeyFile, if necessary"`
+	SSLKeyFile          string `long:"sslKeyFile" value-name:"<filename>" description:"the .pem file containing the key, if it isn't in the sslPEMKeyFile"`
+	SSLPEMKeyPassword   string `long:"sslPEMKeyPassword" value-name:"<password>" description:"the password to decrypt the key, if necessary; prompted for if the key is encrypted and none is given"`
 	SSLCRLFile          string `long:"sslCRLFile" value-name:"<filename>" description:"the .pem file containing the certificate revocation list"`
 	SSLAllowInvalidCert bool   `long:"sslAllowInvalidCertificates" description:"bypass the validation for server certificates"`
 	SSLAllowInvalidHost bool   `long:"sslAllowInvalidHostnames" description:"bypass the validation for server name"`
 	SSLFipsMode         bool   `long:"sslFIPSMode" description:"use FIPS mode of the installed openssl library"`
+
+	TLSMinVersion         string `long:"tlsMinVersion" value-name:"<version>" choice:"1.0" choice:"1.1" choice:"1.2" choice:"1.3" description:"the oldest TLS version to accept: 1.0, 1.1, 1.2 or 1.3"`
+	TLSCipherSuites       string `long:"tlsCipherSuites" value-name:"<suites>" description:"the cipher suites to allow for TLS 1.2 and older, as a comma-separated list of IANA names, or an OpenSSL cipher list when built with OpenSSL"`
+	TLSVerifyOCSPStapling bool   `long:"tlsVerifyOCSPStapling" description:"check the OCSP response stapled by the server, rejecting a revoked certificate (not supported when built with OpenSSL)"`
 }
 
 // Struct holding auth-related options
@@ -149,13 +241,22 @@ type Auth struct {
 	Username  string `short:"u" value-name:"<username>" long:"username" description:"username for authentication"`
 	Password  string `short:"p" value-name:"<password>" long:"password" description:"password for authentication"`
 	Source    string `long:"authenticationDatabase" value-name:"<database-name>" description:"database that holds the user's credentials"`
-	Mechanism string `long:"authenticationMechanism" value-name:"<mechanism>" description:"authentication mechanism to use"`
+	Mechanism string `long:"authenticationMechanism" value-name:"<mechanism>" description:"authentication mechanism to use: SCRAM-SHA-1, SCRAM-SHA-256, MONGODB-CR, PLAIN, GSSAPI, MONGODB-X509 or MONGODB-AWS (negotiated with the server by default)"`
+
+	PasswordFile    string `long:"passwordFile" value-name:"<filename>" description:"file whose first line is the password for authentication"`
+	PasswordCommand string `long:"passwordCommand" value-name:"<command>" description:"credential helper command, run by the shell, that prints the password for authentication"`
+	PasswordKeyring string `long:"passwordKeyring" value-name:"<service>" description:"read the password of --username for the service from the OS keychain: the macOS keychain, or the Secret Service on Linux"`
+
+	AWSSessionToken string `long:"awsSessionToken" value-name:"<aws-session-token>" description:"session token of temporary AWS credentials to authenticate with MONGODB-AWS, whose access key ID and secret access key are given as the username and password"`
 }
 
 // Struct for Kerberos/GSSAPI-specific options
 type Kerberos struct {
 	Service     string `long:"gssapiServiceName" value-name:"<service-name>" description:"service name to use when authenticating using GSSAPI/Kerberos ('mongodb' by default)"`
 	ServiceHost string `long:"gssapiHostName" value-name:"<host-name>" description:"hostname to use when authenticating using GSSAPI/Kerberos (remote server's address by default)"`
+
+	ServiceRealm         string `long:"gssapiServiceRealm" value-name:"<realm>" description:"realm of the service principal when authenticating using GSSAPI/Kerberos, if it differs from the user's (Windows only)"`
+	CanonicalizeHostName bool   `long:"gssapiCanonicalizeHostName" description:"use the canonical name of the remote server's address, following CNAME records, when authenticating using GSSAPI/Kerberos"`
 }
 type WriteConcern struct {
 	// Specifies the write concern for each write operation that mongofiles writes to the target database.
@@ -202,6 +303,7 @@ func New(appName, usageStr string, enabled EnabledOptions) *ToolOptions {
 		Auth:       &Auth{},
 		Namespace:  &Namespace{},
 		Kerberos:   &Kerberos{},
+		Atlas:      &Atlas{},
 		parser: flags.NewNamedParser(
 			fmt.Sprintf("%v %v", appName, usageStr), flags.None),
 		enabledOptions: enabled,
@@ -226,6 +328,7 @@ func New(appName, usageStr string, enabled EnabledOptions) *ToolOptions {
 	opts.parser.UnknownOptionHandler = opts.handleUnknownOption
 
 	opts.URI.AddKnownURIParameters(KnownURIOptionsReplicaSet)
+	opts.URI.AddKnownURIParameters(KnownURIOptionsSRV)
 
 	if _, err := opts.parser.AddGroup("general options", "", opts.General); err != nil {
 		panic(fmt.Errorf("couldn't register general options: %v", err))
@@ -242,6 +345,9 @@ func New(appName, usageStr string, enabled EnabledOptions) *ToolOptions {
 		if _, err := opts.parser.AddGroup("connection options", "", opts.Connection); err != nil {
 			panic(fmt.Errorf("couldn't register connection options: %v", err))
 		}
+		if _, err := opts.parser.AddGroup("atlas options", "", opts.Atlas); err != nil {
+			panic(fmt.Errorf("couldn't register atlas options: %v", err))
+		}
 
 		// Register options that were enabled at compile time with build tags (ssl, sasl)
 		for _, optionRegistrationFunction := range ConnectionOptFunctions {
@@ -293,6 +399,7 @@ func (o *ToolOptions) FindOptionByLongName(name string) *flags.Option {
 // help flag is specified.
 func (o *ToolOptions) PrintHelp(force bool) bool {
 	if o.Help || force {
+		o.showEnvNames()
 		o.parser.WriteHelp(os.Stdout)
 	}
 	return o.Help
@@ -334,8 +441,171 @@ type URISetter interface {
 	SetOptionsFromURI(connstring.ConnString) error
 }
 
+// AuthMechanisms are the supported authentication mechanisms. When none is
+// given, the driver negotiates one with the server: servers from 4.0 on list
+// the mechanisms of the user in the saslSupportedMechs field of isMaster,
+// and SCRAM-SHA-256 is used if it is among them, SCRAM-SHA-1 otherwise.
+// Older servers use SCRAM-SHA-1, or MONGODB-CR before 3.0.
+var AuthMechanisms = []string{"SCRAM-SHA-1", "SCRAM-SHA-256", "MONGODB-CR", "PLAIN", "GSSAPI", "MONGODB-X509", "MONGODB-AWS"}
+
+// NormalizeMechanism sets the authentication mechanism to its name as the
+// server expects it, ignoring case, and returns an error if it isn't one of
+// AuthMechanisms.
+func (auth *Auth) NormalizeMechanism() error {
+	if auth.Mechanism == "" {
+		return nil
+	}
+	for _, mechanism := range AuthMechanisms {
+		if strings.EqualFold(auth.Mechanism, mechanism) {
+			auth.Mechanism = mechanism
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported authentication mechanism '%v', expected one of %v",
+		auth.Mechanism, strings.Join(AuthMechanisms, ", "))
+}
+
+// LoadPassword reads the password from the source it was given with:
+// --passwordFile, --passwordCommand or --passwordKeyring. When there is
+// none and a username is given without a password, the password is read
+// from the PasswordEnv environment variable, if it is set. It returns an
+// error if the password is given more than one way, or can't be read.
+func (auth *Auth) LoadPassword() error {
+	sources := 0
+	for _, given := range []bool{auth.Password != "", auth.PasswordFile != "",
+		auth.PasswordCommand != "", auth.PasswordKeyring != ""} {
+		if given {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return fmt.Errorf("illegal argument combination: only one of --password, --passwordFile, " +
+			"--passwordCommand and --passwordKeyring can be given")
+	}
+
+	var err error
+	switch {
+	case auth.PasswordFile != "":
+		auth.Password, err = password.ReadFile(auth.PasswordFile)
+	case auth.PasswordCommand != "":
+		auth.Password, err = password.FromCommand(auth.PasswordCommand)
+	case auth.PasswordKeyring != "":
+		if auth.Username == "" {
+			return fmt.Errorf("--passwordKeyring requires --username")
+		}
+		auth.Password, err = password.FromKeyring(auth.PasswordKeyring, auth.Username)
+	case auth.Password == "" && auth.Username != "":
+		auth.Password = os.Getenv(PasswordEnv)
+	}
+	return err
+}
+
+// ValidateFIPS enables FIPS mode if --fips is given, and then returns an
+// error if the authentication mechanism isn't FIPS-approved. In FIPS mode,
+// SCRAM-SHA-256 is used rather than negotiated, as the server could pick
+// SCRAM-SHA-1, and TLS is set up in the FIPS mode of OpenSSL when built
+// with it.
+func (o *ToolOptions) ValidateFIPS() error {
+	if o.General != nil && o.FIPS {
+		fips.Enable()
+	}
+	if !fips.Enabled() {
+		return nil
+	}
+	if o.SSL != nil {
+		o.SSLFipsMode = true
+	}
+	if o.Auth == nil {
+		return nil
+	}
+	if o.Auth.Mechanism == "" && o.Auth.Username != "" {
+		o.Auth.Mechanism = "SCRAM-SHA-256"
+	}
+	return fips.CheckMechanism(o.Auth.Mechanism)
+}
+
+// RejectProgressEvents returns an error if --progressFD or --progressSocket
+// is given, for the tools that don't write progress events.
+func (o *ToolOptions) RejectProgressEvents() error {
+	if o.General == nil || (o.ProgressFD == 0 && o.ProgressSocket == "") {
+		return nil
+	}
+	return fmt.Errorf("%v doesn't write progress events, so --progressFD and --progressSocket can't be used", o.AppName)
+}
+
+// ValidateProxy returns an error if the proxy options are given without a
+// proxy host, or with only one of the proxy username and password.
+func (c *Connection) ValidateProxy() error {
+	if c.ProxyHost == "" {
+		if c.ProxyPort != 0 || c.ProxyUsername != "" || c.ProxyPassword != "" {
+			return fmt.Errorf("--proxyPort, --proxyUsername and --proxyPassword require --proxyHost")
+		}
+		return nil
+	}
+	if c.ProxyPort < 0 || c.ProxyPort > 65535 {
+		return fmt.Errorf("invalid --proxyPort %v", c.ProxyPort)
+	}
+	if (c.ProxyUsername == "") != (c.ProxyPassword == "") {
+		return fmt.Errorf("--proxyUsername and --proxyPassword must be given together")
+	}
+	return nil
+}
+
+// Compressors are the network compressors that can be named in --compressors.
+var Compressors = []string{"snappy", "zstd", "zlib"}
+
+// GetCompressors returns the compressors named in --compressors, by order of
+// preference.
+func (c *Connection) GetCompressors() []string {
+	var names []string
+	for _, name := range strings.Split(c.Compressors, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ValidatePool returns an error if the connection pool, timeout, keepalive
+// or heartbeat options are negative, if the minimum pool size exceeds the
+// maximum, if an unknown compressor is named, or if the server API options
+// are invalid.
+func (c *Connection) ValidatePool() error {
+	for _, name := range c.GetCompressors() {
+		if !util.StringSliceContains(Compressors, name) {
+			return fmt.Errorf("invalid --compressors value '%v': must be one of %v", name, strings.Join(Compressors, ", "))
+		}
+	}
+	switch {
+	case c.APIVersion != "" && c.APIVersion != "1":
+		return fmt.Errorf("invalid --apiVersion %v: the only server API version is 1", c.APIVersion)
+	case c.APIVersion == "" && c.APIStrict:
+		return fmt.Errorf("--apiStrict requires --apiVersion")
+	case c.APIVersion == "" && c.APIDeprecationErrors:
+		return fmt.Errorf("--apiDeprecationErrors requires --apiVersion")
+	case c.MaxPoolSize < 0:
+		return fmt.Errorf("invalid --maxPoolSize %v", c.MaxPoolSize)
+	case c.MinPoolSize < 0:
+		return fmt.Errorf("invalid --minPoolSize %v", c.MinPoolSize)
+	case c.MaxPoolSize > 0 && c.MinPoolSize > c.MaxPoolSize:
+		return fmt.Errorf("--minPoolSize %v cannot exceed --maxPoolSize %v", c.MinPoolSize, c.MaxPoolSize)
+	case c.MaxIdleTimeMS < 0:
+		return fmt.Errorf("invalid --maxIdleTimeMS %v", c.MaxIdleTimeMS)
+	case c.SocketTimeoutMS < 0:
+		return fmt.Errorf("invalid --socketTimeoutMS %v", c.SocketTimeoutMS)
+	case c.ServerSelectionTimeoutMS < 0:
+		return fmt.Errorf("invalid --serverSelectionTimeoutMS %v", c.ServerSelectionTimeoutMS)
+	case c.HeartbeatFrequencyMS < 0:
+		return fmt.Errorf("invalid --heartbeatFrequencyMS %v", c.HeartbeatFrequencyMS)
+	case c.TCPKeepAliveSeconds < 0:
+		return fmt.Errorf("invalid --TCPKeepAliveSeconds %v", c.TCPKeepAliveSeconds)
+	}
+	return nil
+}
+
 func (auth *Auth) RequiresExternalDB() bool {
-	return auth.Mechanism == "GSSAPI" || auth.Mechanism == "PLAIN" || auth.Mechanism == "MONGODB-X509"
+	return auth.Mechanism == "GSSAPI" || auth.Mechanism == "PLAIN" || auth.Mechanism == "MONGODB-X509" ||
+		auth.Mechanism == "MONGODB-AWS"
 }
 
 // ShouldAskForPassword returns true if the user specifies a username flag
@@ -405,6 +675,25 @@ func (o *ToolOptions) GetAuthenticationDatabase() string {
 	return ""
 }
 
+// DirectTo returns a copy of the options that connects directly to the
+// server at host and port, with the same credentials, TLS and connection
+// settings, for the tools that monitor each member of a deployment they
+// discover.
+func (o ToolOptions) DirectTo(host, port string) ToolOptions {
+	connection := Connection{}
+	if o.Connection != nil {
+		connection = *o.Connection
+	}
+	connection.Host, connection.Port = host, port
+	o.Connection = &connection
+	// the server replaces the hosts of the connection string, whose other
+	// settings were already set on the options
+	o.URI = nil
+	o.ReplicaSetName = ""
+	o.Direct = true
+	return o
+}
+
 // AddOptions registers an additional options group to this instance
 func (o *ToolOptions) AddOptions(opts ExtraOptions) {
 	_, err := o.parser.AddGroup(opts.Name()+" options", "", opts)
@@ -418,14 +707,40 @@ func (o *ToolOptions) AddOptions(opts ExtraOptions) {
 	}
 }
 
-// Parse the command line args.  Returns any extra args not accounted for by
+// Parse the command line args, after the options set in the environment
+// and those of the file given with --config, if any. Options given on the
+// command line take precedence over the environment, which takes precedence
+// over the config file. Returns any extra args not accounted for by
 // parsing, as well as an error if the parsing returns an error.
 func (o *ToolOptions) ParseArgs(args []string) ([]string, error) {
-	args, err := o.parser.ParseArgs(args)
+	given := overriddenOptions(o.givenOptions(args))
+	envArgs, envOptions, err := o.envArgs(given)
+	if err != nil {
+		return []string{}, err
+	}
+	path := configPath(args)
+	if path == "" {
+		path = os.Getenv(EnvName("config"))
+	}
+	if path != "" {
+		fileArgs, err := o.configArgs(path)
+		if err != nil {
+			return []string{}, err
+		}
+		for name := range overriddenOptions(envOptions) {
+			given[name] = true
+		}
+		envArgs = append(withoutOptions(fileArgs, given), envArgs...)
+	}
+	args, err = o.parser.ParseArgs(append(envArgs, args...))
 	if err != nil {
 		return []string{}, err
 	}
 
+	if err = o.resolveAtlas(); err != nil {
+		return []string{}, err
+	}
+
 	// connect directly, unless a replica set name is explicitly specified
 	if o.Host != "" {
 		_, o.ReplicaSetName = util.ParseConnectionString(o.Host)
@@ -445,6 +760,22 @@ func (o *ToolOptions) ParseArgs(args []string) ([]string, error) {
 		}
 	}
 
+	if err = o.Auth.NormalizeMechanism(); err != nil {
+		return []string{}, err
+	}
+	if err = o.ValidateFIPS(); err != nil {
+		return []string{}, err
+	}
+	if err = o.Auth.LoadPassword(); err != nil {
+		return []string{}, err
+	}
+	if err = o.Connection.ValidateProxy(); err != nil {
+		return []string{}, err
+	}
+	if err = o.Connection.ValidatePool(); err != nil {
+		return []string{}, err
+	}
+
 	return args, err
 }
 
@@ -470,8 +801,49 @@ func (opts *ToolOptions) setOptionsFromURI(cs connstring.ConnString) error {
 			return fmt.Errorf(IncompatibleArgsErrorFormat, "--port")
 		case opts.Connection.Timeout != 3:
 			return fmt.Errorf(IncompatibleArgsErrorFormat, "--dialTimeout")
+		case opts.Connection.MaxPoolSize != 0 && cs.MaxConnsPerHostSet:
+			return fmt.Errorf(ConflictingArgsErrorFormat, "--maxPoolSize")
+		case opts.Connection.MinPoolSize != 0 && cs.MinConnsPerHostSet:
+			return fmt.Errorf(ConflictingArgsErrorFormat, "--minPoolSize")
+		case opts.Connection.MaxIdleTimeMS != 0 && cs.MaxConnIdleTime != 0:
+			return fmt.Errorf(ConflictingArgsErrorFormat, "--maxIdleTimeMS")
+		case opts.Connection.SocketTimeoutMS != 0 && cs.SocketTimeout != 0:
+			return fmt.Errorf(ConflictingArgsErrorFormat, "--socketTimeoutMS")
+		case opts.Connection.ServerSelectionTimeoutMS != 0 && cs.ServerSelectionTimeout != 0:
+			return fmt.Errorf(ConflictingArgsErrorFormat, "--serverSelectionTimeoutMS")
+		case opts.Connection.HeartbeatFrequencyMS != 0 && cs.HeartbeatInterval != 0:
+			return fmt.Errorf(ConflictingArgsErrorFormat, "--heartbeatFrequencyMS")
+		case opts.Connection.Compressors != "" && len(cs.Compressors) > 0:
+			return fmt.Errorf(ConflictingArgsErrorFormat, "--compressors")
 		}
 		opts.Connection.Timeout = int(cs.ConnectTimeout / time.Millisecond)
+		if cs.RetryWritesSet {
+			opts.Connection.RetryWrites = &cs.RetryWrites
+		}
+		if cs.RetryReadsSet {
+			opts.Connection.RetryReads = &cs.RetryReads
+		}
+		if cs.MaxConnsPerHostSet {
+			opts.Connection.MaxPoolSize = int(cs.MaxConnsPerHost)
+		}
+		if cs.MinConnsPerHostSet {
+			opts.Connection.MinPoolSize = int(cs.MinConnsPerHost)
+		}
+		if cs.MaxConnIdleTime != 0 {
+			opts.Connection.MaxIdleTimeMS = int(cs.MaxConnIdleTime / time.Millisecond)
+		}
+		if cs.SocketTimeout != 0 {
+			opts.Connection.SocketTimeoutMS = int(cs.SocketTimeout / time.Millisecond)
+		}
+		if cs.ServerSelectionTimeout != 0 {
+			opts.Connection.ServerSelectionTimeoutMS = int(cs.ServerSelectionTimeout / time.Millisecond)
+		}
+		if cs.HeartbeatInterval != 0 {
+			opts.Connection.HeartbeatFrequencyMS = int(cs.HeartbeatInterval / time.Millisecond)
+		}
+		if len(cs.Compressors) > 0 {
+			opts.Connection.Compressors = strings.Join(cs.Compressors, ",")
+		}
 	}
 
 	if opts.enabledOptions.Auth {
@@ -485,11 +857,16 @@ func (opts *ToolOptions) setOptionsFromURI(cs connstring.ConnString) error {
 			return fmt.Errorf(IncompatibleArgsErrorFormat, "--authenticationDatabase")
 		case opts.Auth.Mechanism != "":
 			return fmt.Errorf(IncompatibleArgsErrorFormat, "--authenticationMechanism")
+		case opts.AWSSessionToken != "" && cs.AuthMechanismProperties["AWS_SESSION_TOKEN"] != "":
+			return fmt.Errorf(IncompatibleArgsErrorFormat, "--awsSessionToken")
 		}
 		opts.Username = cs.Username
 		opts.Password = cs.Password
 		opts.Source = cs.AuthSource
 		opts.Auth.Mechanism = cs.AuthMechanism
+		if token := cs.AuthMechanismProperties["AWS_SESSION_TOKEN"]; token != "" {
+			opts.AWSSessionToken = token
+		}
 	}
 	if opts.enabledOptions.Namespace {
 		if opts.Namespace != nil && opts.Namespace.DB != "" {
@@ -515,6 +892,25 @@ func (opts *ToolOptions) setOptionsFromURI(cs connstring.ConnString) error {
 		opts.SSL.UseSSL = cs.UseSSL
 	}
 
+	// the authMechanismProperties of GSSAPI
+	if service := cs.AuthMechanismProperties["SERVICE_NAME"]; service != "" {
+		if cs.KerberosService != "" && cs.KerberosService != service {
+			return fmt.Errorf("illegal argument combination: gssapiServiceName conflicts with SERVICE_NAME in the uri")
+		}
+		cs.KerberosService = service
+	}
+	realm := cs.AuthMechanismProperties["SERVICE_REALM"]
+	canonicalize := false
+	if value, ok := cs.AuthMechanismProperties["CANONICALIZE_HOST_NAME"]; ok {
+		var err error
+		if canonicalize, err = strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("invalid value for CANONICALIZE_HOST_NAME: %v", value)
+		}
+	}
+	if (realm != "" || canonicalize) && !BuiltWithGSSAPI {
+		return fmt.Errorf("cannot specify SERVICE_REALM or CANONICALIZE_HOST_NAME: tool not built with kerberos support")
+	}
+
 	if cs.KerberosService != "" && !BuiltWithGSSAPI {
 		return fmt.Errorf("cannot specify gssapiservicename: tool not built with kerberos support")
 	}
@@ -524,6 +920,12 @@ func (opts *ToolOptions) setOptionsFromURI(cs connstring.ConnString) error {
 
 	opts.Kerberos.Service = cs.KerberosService
 	opts.Kerberos.ServiceHost = cs.KerberosServiceHost
+	if realm != "" {
+		opts.Kerberos.ServiceRealm = realm
+	}
+	if canonicalize {
+		opts.Kerberos.CanonicalizeHostName = true
+	}
 
 	for _, extraOpts := range opts.URI.extraOptionsRegistry {
 		if uriSetter, ok := extraOpts.(URISetter); ok {
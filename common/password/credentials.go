@@ -0,0 +1,97 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+// ReadFile returns the password held in the first line of the file at path.
+// It warns when other users can read the file.
+func ReadFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening password file: %v", err)
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		log.Logvf(log.Always, "warning: password file %v is accessible by other users", path)
+	}
+	pass, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && pass == "" {
+		return "", fmt.Errorf("error reading password file %v: no password found", path)
+	}
+	return strings.TrimRight(pass, "\r\n"), nil
+}
+
+// FromCommand runs a credential helper, a command run by the shell which
+// prints the password on its standard output, and returns the first line of
+// that output. What the command writes to standard error is shown to the
+// user, so it can prompt for whatever unlocks the password.
+func FromCommand(command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("error running password command: %v", err)
+	}
+	return firstLine(out, "password command")
+}
+
+// FromKeyring returns the password stored in the operating system's
+// keychain for the account of the service: the login keychain on macOS, and
+// the Secret Service, such as GNOME Keyring or KWallet, on Linux.
+func FromKeyring(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	case "linux", "freebsd", "openbsd", "netbsd":
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "username", account)
+	default:
+		return "", fmt.Errorf("reading passwords from the keychain is not supported on %v", runtime.GOOS)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			err = fmt.Errorf("%v: %v", err, message)
+		}
+		return "", fmt.Errorf("error reading the password of %v for service %v from the keychain: %v",
+			account, service, err)
+	}
+	return firstLine(out, "keychain")
+}
+
+// firstLine returns the first line of the output of a password source,
+// which must not be empty.
+func firstLine(out []byte, source string) (string, error) {
+	pass := string(out)
+	if i := strings.IndexAny(pass, "\r\n"); i >= 0 {
+		pass = pass[:i]
+	}
+	if pass == "" {
+		return "", fmt.Errorf("%v returned no password", source)
+	}
+	return pass, nil
+}
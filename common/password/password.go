@@ -27,14 +27,20 @@ const (
 // Prompt displays a prompt asking for the password and returns the
 // password the user enters as a string.
 func Prompt() string {
+	return PromptFor("password")
+}
+
+// PromptFor displays a prompt asking for the named secret, such as the
+// password of a key file, and returns what the user enters as a string.
+func PromptFor(name string) string {
 	var pass string
 	if IsTerminal() {
-		log.Logv(log.DebugLow, "standard input is a terminal; reading password from terminal")
-		fmt.Fprintf(os.Stderr, "Enter password:")
+		log.Logvf(log.DebugLow, "standard input is a terminal; reading %v from terminal", name)
+		fmt.Fprintf(os.Stderr, "Enter %v:", name)
 		pass = GetPass()
 	} else {
-		log.Logv(log.Always, "reading password from standard input")
-		fmt.Fprintf(os.Stderr, "Enter password:")
+		log.Logvf(log.Always, "reading %v from standard input", name)
+		fmt.Fprintf(os.Stderr, "Enter %v:", name)
 		pass = readPassFromStdin()
 	}
 	fmt.Fprintln(os.Stderr)
@@ -0,0 +1,285 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Event is a progress event, written as one JSON object per line.
+type Event struct {
+	Time  string `json:"time"`
+	Tool  string `json:"tool"`
+	Task  string `json:"task"`
+	Event string `json:"event"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total"`
+	Unit  string `json:"unit"`
+	// units done per second since the task started
+	Rate float64 `json:"rate"`
+	// seconds left at that rate, when there is one and the total is known
+	ETA float64 `json:"etaSeconds,omitempty"`
+	// the error of a failed event
+	Error string `json:"error,omitempty"`
+}
+
+// Event types: "start" when a task is attached, "progress" periodically
+// while it runs, and "done" when it is detached. A task that fails is
+// detached with a "failed" event instead, and a tool that stops with an
+// error writes a "failed" event with no task.
+const (
+	EventStart    = "start"
+	EventProgress = "progress"
+	EventDone     = "done"
+	EventFailed   = "failed"
+)
+
+type eventTask struct {
+	name     string
+	watching Progressor
+	started  time.Time
+}
+
+// EventWriter implements Manager. It writes a start and a done event for each
+// of its progressors, and a progress event for each at every interval, so
+// that orchestrators can track tools uniformly. Writing stops at the first
+// error, as when the reader of the events goes away.
+type EventWriter struct {
+	sync.Mutex
+
+	waitTime time.Duration
+	writer   io.Writer
+	tool     string
+	unit     string
+	tasks    []*eventTask
+	stopChan chan struct{}
+	err      error
+}
+
+// NewEventWriter returns an initialized EventWriter for the named tool, whose
+// progressors count bytes if isBytes is true or documents otherwise, waiting
+// the given duration between progress events.
+func NewEventWriter(w io.Writer, tool string, waitTime time.Duration, isBytes bool) *EventWriter {
+	unit := "documents"
+	if isBytes {
+		unit = "bytes"
+	}
+	return &EventWriter{
+		waitTime: waitTime,
+		writer:   w,
+		tool:     tool,
+		unit:     unit,
+		stopChan: make(chan struct{}),
+	}
+}
+
+// OpenEventWriter returns an EventWriter writing to the file descriptor fd,
+// or to the Unix socket at socketPath, or nil if neither is given. Stopping
+// it closes the file or socket.
+func OpenEventWriter(fd int, socketPath, tool string, waitTime time.Duration, isBytes bool) (*EventWriter, error) {
+	var w io.Writer
+	switch {
+	case fd != 0 && socketPath != "":
+		return nil, fmt.Errorf("cannot use both --progressFD and --progressSocket")
+	case fd < 0:
+		return nil, fmt.Errorf("invalid --progressFD %v", fd)
+	case fd > 0:
+		file := os.NewFile(uintptr(fd), "progress")
+		if _, err := file.Stat(); err != nil {
+			return nil, fmt.Errorf("can't write progress events to file descriptor %v: %v", fd, err)
+		}
+		w = file
+	case socketPath != "":
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't write progress events to %v: %v", socketPath, err)
+		}
+		w = conn
+	default:
+		return nil, nil
+	}
+	return NewEventWriter(w, tool, waitTime, isBytes), nil
+}
+
+// SetUnit replaces the unit of the progressors, for tools that count neither
+// bytes nor documents.
+func (manager *EventWriter) SetUnit(unit string) {
+	manager.Lock()
+	defer manager.Unlock()
+	manager.unit = unit
+}
+
+// Attach registers the given progressor with the manager and writes its
+// start event.
+func (manager *EventWriter) Attach(name string, progressor Progressor) {
+	manager.Lock()
+	defer manager.Unlock()
+
+	for _, task := range manager.tasks {
+		if task.name == name {
+			panic(fmt.Sprintf("progressor with name '%s' already exists in manager", name))
+		}
+	}
+	task := &eventTask{name: name, watching: progressor, started: time.Now()}
+	manager.tasks = append(manager.tasks, task)
+	manager.write(task, EventStart, nil)
+}
+
+// Detach removes the progressor with the given name from the manager and
+// writes its done event.
+func (manager *EventWriter) Detach(name string) {
+	manager.detach(name, EventDone, nil)
+}
+
+// Fail removes the progressor with the given name from the manager and
+// writes its failed event.
+func (manager *EventWriter) Fail(name string, err error) {
+	manager.detach(name, EventFailed, err)
+}
+
+func (manager *EventWriter) detach(name, eventType string, err error) {
+	manager.Lock()
+	defer manager.Unlock()
+
+	for i, task := range manager.tasks {
+		if task.name == name {
+			manager.write(task, eventType, err)
+			manager.tasks = append(manager.tasks[:i], manager.tasks[i+1:]...)
+			return
+		}
+	}
+	panic("could not find progressor")
+}
+
+// write writes an event of the task, or of the tool if task is nil. The lock
+// must be held.
+func (manager *EventWriter) write(task *eventTask, eventType string, taskErr error) {
+	if manager.err != nil {
+		return
+	}
+	now := time.Now()
+	event := Event{
+		Time:  now.Format(time.RFC3339Nano),
+		Tool:  manager.tool,
+		Event: eventType,
+		Unit:  manager.unit,
+	}
+	if taskErr != nil {
+		event.Error = taskErr.Error()
+	}
+	if task != nil {
+		event.Task = task.name
+		event.Done, event.Total = task.watching.Progress()
+		if elapsed := now.Sub(task.started).Seconds(); elapsed > 0 {
+			event.Rate = float64(event.Done) / elapsed
+		}
+		if event.Rate > 0 && event.Total > event.Done {
+			event.ETA = float64(event.Total-event.Done) / event.Rate
+		}
+	}
+	line, err := json.Marshal(event)
+	if err == nil {
+		_, err = manager.writer.Write(append(line, '\n'))
+	}
+	manager.err = err
+}
+
+// Start kicks off the timed writing of progress events.
+func (manager *EventWriter) Start() {
+	if manager.writer == nil {
+		panic("Cannot use a progress.EventWriter with an unset Writer")
+	}
+	go manager.start()
+}
+
+func (manager *EventWriter) start() {
+	if manager.waitTime <= 0 {
+		manager.waitTime = DefaultWaitTime
+	}
+	ticker := time.NewTicker(manager.waitTime)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-manager.stopChan:
+			return
+		case <-ticker.C:
+			manager.Lock()
+			for _, task := range manager.tasks {
+				manager.write(task, EventProgress, nil)
+			}
+			manager.Unlock()
+		}
+	}
+}
+
+// Stop ends the main manager goroutine, and closes the writer if it can be
+// closed.
+func (manager *EventWriter) Stop() {
+	manager.stopChan <- struct{}{}
+	if closer, ok := manager.writer.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// StopWithError writes a failed event for each progressor still attached
+// and one for the tool, and then stops the manager as Stop does. The tools
+// call it before exiting with an error, which skips their deferred calls to
+// Stop. It does nothing on a nil EventWriter, as when no stream was asked for.
+func (manager *EventWriter) StopWithError(err error) {
+	if manager == nil {
+		return
+	}
+	manager.Lock()
+	for _, task := range manager.tasks {
+		manager.write(task, EventFailed, err)
+	}
+	manager.write(nil, EventFailed, err)
+	manager.Unlock()
+	manager.Stop()
+}
+
+// Managers is a Manager that attaches progressors to all of its managers,
+// such as a BarWriter and an EventWriter.
+type Managers []Manager
+
+// Attach registers the progressor with all of the managers.
+func (managers Managers) Attach(name string, progressor Progressor) {
+	for _, manager := range managers {
+		manager.Attach(name, progressor)
+	}
+}
+
+// Detach removes the progressor with the given name from all of the managers.
+func (managers Managers) Detach(name string) {
+	for _, manager := range managers {
+		manager.Detach(name)
+	}
+}
+
+// Fail removes the progressor with the given name from all of the managers,
+// reporting its failure to those that tell it apart.
+func (managers Managers) Fail(name string, err error) {
+	for _, manager := range managers {
+		Finish(manager, name, err)
+	}
+}
+
+// SetTotal sets the total of the managers that show one.
+func (managers Managers) SetTotal(progressor Progressor) {
+	for _, manager := range managers {
+		if setter, ok := manager.(TotalSetter); ok {
+			setter.SetTotal(progressor)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// eventsIn decodes the events written to a buffer.
+func eventsIn(data string) []Event {
+	var events []Event
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		var event Event
+		So(json.Unmarshal(scanner.Bytes(), &event), ShouldBeNil)
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestEventWriter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an EventWriter writing to a buffer", t, func() {
+		buf := &safeBuffer{}
+		manager := NewEventWriter(buf, "mongorestore", 10*time.Millisecond, true)
+		counter := NewCounter(100)
+
+		Convey("attaching and detaching a progressor should write start and done events", func() {
+			manager.Attach("test.foo", counter)
+			counter.Inc(40)
+			time.Sleep(5 * time.Millisecond)
+			counter.Inc(60)
+			manager.Detach("test.foo")
+
+			events := eventsIn(buf.String())
+			So(len(events), ShouldEqual, 2)
+			So(events[0].Event, ShouldEqual, EventStart)
+			So(events[0].Tool, ShouldEqual, "mongorestore")
+			So(events[0].Task, ShouldEqual, "test.foo")
+			So(events[0].Unit, ShouldEqual, "bytes")
+			So(events[0].Done, ShouldEqual, 0)
+			So(events[0].Total, ShouldEqual, 100)
+			So(events[1].Event, ShouldEqual, EventDone)
+			So(events[1].Done, ShouldEqual, 100)
+			So(events[1].Rate, ShouldBeGreaterThan, 0)
+			So(events[1].ETA, ShouldEqual, 0)
+		})
+
+		Convey("a started writer should write progress events with an ETA", func() {
+			manager.Attach("test.foo", counter)
+			counter.Inc(50)
+			manager.Start()
+			time.Sleep(50 * time.Millisecond)
+			manager.Stop()
+			manager.Detach("test.foo")
+
+			events := eventsIn(buf.String())
+			So(len(events), ShouldBeGreaterThan, 2)
+			progress := events[1]
+			So(progress.Event, ShouldEqual, EventProgress)
+			So(progress.Done, ShouldEqual, 50)
+			So(progress.ETA, ShouldBeGreaterThan, 0)
+		})
+
+		Convey("failing a progressor should write a failed event with the error", func() {
+			manager.Attach("test.foo", counter)
+			counter.Inc(40)
+			Finish(manager, "test.foo", errors.New("disk full"))
+
+			events := eventsIn(buf.String())
+			So(len(events), ShouldEqual, 2)
+			So(events[1].Event, ShouldEqual, EventFailed)
+			So(events[1].Task, ShouldEqual, "test.foo")
+			So(events[1].Done, ShouldEqual, 40)
+			So(events[1].Error, ShouldEqual, "disk full")
+		})
+
+		Convey("finishing a progressor without an error should write a done event", func() {
+			manager.Attach("test.foo", counter)
+			Finish(manager, "test.foo", nil)
+
+			events := eventsIn(buf.String())
+			So(len(events), ShouldEqual, 2)
+			So(events[1].Event, ShouldEqual, EventDone)
+			So(events[1].Error, ShouldEqual, "")
+		})
+
+		Convey("stopping with an error should fail the attached progressors and the tool", func() {
+			manager.Attach("test.foo", counter)
+			manager.Start()
+			manager.StopWithError(errors.New("lost connection"))
+
+			events := eventsIn(buf.String())
+			So(len(events), ShouldEqual, 3)
+			So(events[1].Event, ShouldEqual, EventFailed)
+			So(events[1].Task, ShouldEqual, "test.foo")
+			So(events[2].Event, ShouldEqual, EventFailed)
+			So(events[2].Task, ShouldEqual, "")
+			So(events[2].Error, ShouldEqual, "lost connection")
+		})
+
+		Convey("SetUnit should replace the unit of the events", func() {
+			manager.SetUnit("ops")
+			manager.Attach("test.foo", counter)
+			manager.Detach("test.foo")
+			So(eventsIn(buf.String())[0].Unit, ShouldEqual, "ops")
+		})
+
+		Convey("Managers should attach to every manager", func() {
+			other := &safeBuffer{}
+			managers := Managers{manager, NewEventWriter(other, "mongorestore", time.Second, true)}
+			managers.Attach("test.foo", counter)
+			managers.Detach("test.foo")
+			So(len(eventsIn(buf.String())), ShouldEqual, 2)
+			So(len(eventsIn(other.String())), ShouldEqual, 2)
+		})
+
+		Convey("Managers should fail on the managers that report failures", func() {
+			bars := NewBarWriter(&safeBuffer{}, time.Second, 10, true)
+			managers := Managers{bars, manager}
+			managers.Attach("test.foo", counter)
+			managers.Fail("test.foo", errors.New("disk full"))
+			events := eventsIn(buf.String())
+			So(len(events), ShouldEqual, 2)
+			So(events[1].Event, ShouldEqual, EventFailed)
+		})
+	})
+
+	Convey("StopWithError should do nothing on a nil EventWriter", t, func() {
+		var manager *EventWriter
+		So(func() { manager.StopWithError(errors.New("failed")) }, ShouldNotPanic)
+	})
+
+	Convey("OpenEventWriter", t, func() {
+		Convey("should return nil when no output is given", func() {
+			manager, err := OpenEventWriter(0, "", "mongodump", time.Second, false)
+			So(err, ShouldBeNil)
+			So(manager, ShouldBeNil)
+		})
+
+		Convey("should reject both a file descriptor and a socket", func() {
+			_, err := OpenEventWriter(3, "/tmp/progress.sock", "mongodump", time.Second, false)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("should write to a Unix socket", func() {
+			dir, err := ioutil.TempDir("", "progress")
+			So(err, ShouldBeNil)
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "progress.sock")
+			listener, err := net.Listen("unix", path)
+			So(err, ShouldBeNil)
+			defer listener.Close()
+
+			received := make(chan []byte)
+			go func() {
+				conn, err := listener.Accept()
+				if err != nil {
+					close(received)
+					return
+				}
+				data, _ := ioutil.ReadAll(conn)
+				received <- data
+			}()
+
+			manager, err := OpenEventWriter(0, path, "mongodump", time.Second, false)
+			So(err, ShouldBeNil)
+			manager.Start()
+			manager.Attach("test.foo", NewCounter(10))
+			manager.Detach("test.foo")
+			manager.Stop()
+
+			events := eventsIn(string(<-received))
+			So(len(events), ShouldEqual, 2)
+			So(events[0].Unit, ShouldEqual, "documents")
+		})
+	})
+}
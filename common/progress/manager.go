@@ -26,6 +26,31 @@ type Manager interface {
 	Detach(name string)
 }
 
+// TotalSetter is implemented by the managers that total the progress of
+// their tasks. SetTotal replaces the sum of the tasks with the progress of
+// the whole run, for tools whose tasks are all read from one stream, such as
+// an archive.
+type TotalSetter interface {
+	SetTotal(progressor Progressor)
+}
+
+// Failer is implemented by the managers that report a task that failed
+// differently from one that finished. Fail detaches the progressor as
+// Detach does.
+type Failer interface {
+	Fail(name string, err error)
+}
+
+// Finish detaches the progressor with the given name from the manager when
+// its task ends, as failed if err is not nil and the manager is a Failer.
+func Finish(manager Manager, name string, err error) {
+	if failer, ok := manager.(Failer); ok && err != nil {
+		failer.Fail(name, err)
+		return
+	}
+	manager.Detach(name)
+}
+
 const GridPadding = 2
 
 // BarWriter implements Manager. It periodically prints the status of all of its
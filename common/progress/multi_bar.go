@@ -0,0 +1,306 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+)
+
+const (
+	// cursorUp moves the cursor up the given number of lines, and
+	// clearToEnd clears the screen from the cursor on.
+	cursorUp   = "\x1b[%dA"
+	clearToEnd = "\x1b[J"
+
+	// TotalBarName is the name of the line totalling the tasks.
+	TotalBarName = "total"
+)
+
+// MultiBarWriter implements Manager for tools running several tasks at once.
+// On a terminal, it redraws one line per task and a line totalling them in
+// place, below the lines of the log. Elsewhere, it writes all the lines as a
+// block at each interval, so that the lines of concurrent tasks never
+// interleave.
+type MultiBarWriter struct {
+	sync.Mutex
+
+	waitTime time.Duration
+	// writer is where blocks of bars are written when there is no terminal
+	writer io.Writer
+	// terminal, if set, is where bars are drawn in place
+	terminal  io.Writer
+	bars      []*Bar
+	stopChan  chan struct{}
+	barLength int
+	isBytes   bool
+
+	// lines is the number of lines last drawn on the terminal
+	lines int
+	// detached counts the bars detached so far, and done totals their
+	// progress, so that the total includes finished tasks
+	detached int
+	done     totalProgressor
+	// total, if set, is shown as the total in place of the sum of the bars
+	total Progressor
+}
+
+// totalProgressor is a Progressor with fixed values.
+type totalProgressor struct {
+	current, max int64
+}
+
+func (t *totalProgressor) Progress() (int64, int64) {
+	return t.current, t.max
+}
+
+// NewMultiBarWriter returns an initialized MultiBarWriter with the given bar
+// length and byte-formatting toggle, waiting the given duration between
+// writes. Bars are drawn in place on terminal if it is set, e.g. to the
+// result of Terminal, or else written to w.
+func NewMultiBarWriter(w, terminal io.Writer, waitTime time.Duration, barLength int, isBytes bool) *MultiBarWriter {
+	return &MultiBarWriter{
+		waitTime:  waitTime,
+		writer:    w,
+		terminal:  terminal,
+		stopChan:  make(chan struct{}),
+		barLength: barLength,
+		isBytes:   isBytes,
+	}
+}
+
+// Terminal returns the standard error, where the log is written, if it is a
+// terminal on which bars can be drawn in place, or else nil.
+func Terminal() io.Writer {
+	if runtime.GOOS == "windows" || os.Getenv("TERM") == "dumb" {
+		return nil
+	}
+	info, err := os.Stderr.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return os.Stderr
+}
+
+// Attach registers the given progressor with the manager.
+func (manager *MultiBarWriter) Attach(name string, progressor Progressor) {
+	pb := &Bar{
+		Name:      name,
+		Watching:  progressor,
+		BarLength: manager.barLength,
+		IsBytes:   manager.isBytes,
+		startTime: time.Now(),
+	}
+	pb.validate()
+
+	manager.Lock()
+	defer manager.Unlock()
+
+	for _, bar := range manager.bars {
+		if bar.Name == name {
+			panic(fmt.Sprintf("progress bar with name '%s' already exists in manager", name))
+		}
+	}
+	manager.bars = append(manager.bars, pb)
+}
+
+// Detach removes the progressor with the given name from the manager,
+// writing its bar one last time if it has been written before.
+func (manager *MultiBarWriter) Detach(name string) {
+	manager.Lock()
+	defer manager.Unlock()
+	index := -1
+	for i, bar := range manager.bars {
+		if bar.Name == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		panic("could not find progressor")
+	}
+	pb := manager.bars[index]
+	manager.bars = append(manager.bars[:index:index], manager.bars[index+1:]...)
+
+	current, max := pb.Watching.Progress()
+	manager.done.current += current
+	manager.done.max += max
+	manager.detached++
+
+	var final []string
+	if pb.hasRendered {
+		final = manager.renderLines([]*Bar{pb}, false)
+	}
+	if manager.terminal == nil {
+		for _, line := range final {
+			manager.writer.Write([]byte(line))
+		}
+		return
+	}
+	// leave the final line of the bar above the ones still running
+	manager.draw(final)
+}
+
+// SetTotal shows the progressor as the total of the bars, in place of their
+// sum, as long as any bar is running.
+func (manager *MultiBarWriter) SetTotal(progressor Progressor) {
+	manager.Lock()
+	defer manager.Unlock()
+	manager.total = progressor
+}
+
+// renderLines returns the lines of the bars, and of their total if asked
+// to, with their columns aligned.
+func (manager *MultiBarWriter) renderLines(bars []*Bar, withTotal bool) []string {
+	grid := &text.GridWriter{
+		ColumnPadding: GridPadding,
+	}
+	total := manager.done
+	for _, bar := range bars {
+		bar.renderToGridRow(grid)
+		current, max := bar.Watching.Progress()
+		total.current += current
+		total.max += max
+	}
+	if withTotal {
+		var watching Progressor = &total
+		if manager.total != nil {
+			watching = manager.total
+		}
+		totalBar := &Bar{
+			Name:      TotalBarName,
+			Watching:  watching,
+			BarLength: manager.barLength,
+			IsBytes:   manager.isBytes,
+		}
+		totalBar.renderToGridRow(grid)
+	}
+	buf := &bytes.Buffer{}
+	grid.Flush(buf)
+	// every row ends with a newline, which doesn't start another line
+	rows := strings.TrimSuffix(buf.String(), "\n")
+	if rows == "" {
+		return nil
+	}
+	return strings.Split(rows, "\n")
+}
+
+// draw redraws the bars on the terminal, preceded by the given lines, which
+// stay above them. The caller must hold the lock.
+func (manager *MultiBarWriter) draw(above []string) {
+	if manager.lines == 0 && len(above) == 0 && len(manager.bars) == 0 {
+		return
+	}
+	buf := &bytes.Buffer{}
+	if manager.lines > 0 {
+		fmt.Fprintf(buf, cursorUp, manager.lines)
+	}
+	buf.WriteString(clearToEnd)
+	for _, line := range above {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	lines := manager.renderLines(manager.bars, manager.showTotal())
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteString("\n")
+	}
+	manager.lines = len(lines)
+	manager.terminal.Write(buf.Bytes())
+}
+
+// showTotal returns true if there is more than one task to total, or a
+// total set with SetTotal.
+func (manager *MultiBarWriter) showTotal() bool {
+	if manager.total != nil {
+		return len(manager.bars) > 0
+	}
+	return len(manager.bars) > 0 && len(manager.bars)+manager.detached > 1
+}
+
+// renderAllBars writes all bars, and their total.
+func (manager *MultiBarWriter) renderAllBars() {
+	manager.Lock()
+	defer manager.Unlock()
+	if manager.terminal != nil {
+		manager.draw(nil)
+		return
+	}
+	if len(manager.bars) == 0 {
+		return
+	}
+	for _, line := range manager.renderLines(manager.bars, manager.showTotal()) {
+		manager.writer.Write([]byte(line))
+	}
+	if len(manager.bars) > 1 {
+		// an empty write makes an empty log line between blocks
+		manager.writer.Write([]byte{})
+	}
+}
+
+// Write writes a line of the log above the bars drawn on the terminal. While
+// a MultiBarWriter is drawing on a terminal, the log is written through it.
+func (manager *MultiBarWriter) Write(p []byte) (int, error) {
+	manager.Lock()
+	defer manager.Unlock()
+	manager.draw([]string{strings.TrimSuffix(string(p), "\n")})
+	return len(p), nil
+}
+
+// Start kicks off the timed writing of progress bars.
+func (manager *MultiBarWriter) Start() {
+	if manager.writer == nil && manager.terminal == nil {
+		panic("Cannot use a progress.MultiBarWriter with an unset Writer")
+	}
+	if manager.terminal != nil {
+		log.SetWriter(manager)
+	}
+	go manager.start()
+}
+
+func (manager *MultiBarWriter) start() {
+	if manager.waitTime <= 0 {
+		manager.waitTime = DefaultWaitTime
+	}
+	ticker := time.NewTicker(manager.waitTime)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-manager.stopChan:
+			return
+		case <-ticker.C:
+			manager.renderAllBars()
+		}
+	}
+}
+
+// Stop ends the main manager goroutine, stopping the manager's bars from
+// being written. Bars drawn on the terminal are cleared, and the log is
+// written to the terminal directly again.
+func (manager *MultiBarWriter) Stop() {
+	manager.stopChan <- struct{}{}
+	if manager.terminal == nil {
+		return
+	}
+	log.SetWriter(manager.terminal)
+	manager.Lock()
+	defer manager.Unlock()
+	if manager.lines > 0 {
+		fmt.Fprintf(manager.terminal, cursorUp+clearToEnd, manager.lines)
+		manager.lines = 0
+	}
+}
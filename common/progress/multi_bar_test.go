@@ -0,0 +1,115 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package progress
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMultiBarWriterBlocks(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a MultiBarWriter writing blocks to a log", t, func() {
+		cw := new(CountWriter)
+		writeBuffer := new(safeBuffer)
+		manager := NewMultiBarWriter(writeBuffer, nil, time.Second, 10, false)
+		first, second := NewCounter(10), NewCounter(30)
+		first.Inc(5)
+		second.Inc(15)
+
+		Convey("a single bar should be written without a total", func() {
+			manager.writer = cw
+			manager.Attach("TEST1", first)
+			manager.renderAllBars()
+			So(cw.Count(), ShouldEqual, 1)
+		})
+
+		Convey("concurrent bars should be written as a block with their total", func() {
+			manager.Attach("TEST1", first)
+			manager.Attach("TEST2", second)
+			manager.renderAllBars()
+			output := writeBuffer.String()
+			So(strings.Index(output, "TEST1"), ShouldBeLessThan, strings.Index(output, "TEST2"))
+			So(strings.Index(output, "TEST2"), ShouldBeLessThan, strings.Index(output, TotalBarName))
+			So(output, ShouldContainSubstring, "20/40")
+
+			manager.writer = cw
+			manager.renderAllBars()
+			So(cw.Count(), ShouldEqual, 4)
+		})
+
+		Convey("the total should include detached bars", func() {
+			manager.Attach("TEST1", first)
+			manager.Attach("TEST2", second)
+			manager.renderAllBars()
+			manager.Detach("TEST1")
+			writeBuffer.Reset()
+			manager.renderAllBars()
+			output := writeBuffer.String()
+			So(output, ShouldNotContainSubstring, "TEST1")
+			So(output, ShouldContainSubstring, "20/40")
+		})
+
+		Convey("a total set with SetTotal should be shown in place of the sum", func() {
+			manager.Attach("TEST1", first)
+			manager.SetTotal(NewCounter(100))
+			manager.renderAllBars()
+			output := writeBuffer.String()
+			So(output, ShouldContainSubstring, TotalBarName)
+			So(output, ShouldContainSubstring, "0/100")
+		})
+	})
+}
+
+func TestMultiBarWriterTerminal(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a MultiBarWriter drawing on a terminal", t, func() {
+		terminal := new(safeBuffer)
+		manager := NewMultiBarWriter(nil, terminal, time.Second, 10, false)
+		first, second := NewCounter(10), NewCounter(10)
+		manager.Attach("TEST1", first)
+		manager.Attach("TEST2", second)
+
+		Convey("bars should be redrawn in place", func() {
+			manager.renderAllBars()
+			So(strings.HasPrefix(terminal.String(), clearToEnd), ShouldBeTrue)
+			So(strings.Count(terminal.String(), "\n"), ShouldEqual, 3)
+
+			terminal.Reset()
+			manager.renderAllBars()
+			So(strings.HasPrefix(terminal.String(), fmt.Sprintf(cursorUp, 3)+clearToEnd), ShouldBeTrue)
+		})
+
+		Convey("log lines should be written above the bars", func() {
+			manager.renderAllBars()
+			terminal.Reset()
+			manager.Write([]byte("a log line\n"))
+			output := terminal.String()
+			So(strings.HasPrefix(output, fmt.Sprintf(cursorUp, 3)+clearToEnd+"a log line\n"), ShouldBeTrue)
+			So(output, ShouldContainSubstring, "TEST2")
+		})
+
+		Convey("a detached bar should be left above the others", func() {
+			manager.renderAllBars()
+			terminal.Reset()
+			manager.Detach("TEST1")
+			lines := strings.Split(strings.TrimSuffix(terminal.String(), "\n"), "\n")
+			So(len(lines), ShouldEqual, 3)
+			So(lines[0], ShouldContainSubstring, "TEST1")
+			So(lines[1], ShouldContainSubstring, "TEST2")
+			So(lines[2], ShouldContainSubstring, TotalBarName)
+			So(manager.lines, ShouldEqual, 2)
+		})
+	})
+}
@@ -36,6 +36,10 @@ type Bar struct {
 	// be applied to the numeric output
 	IsBytes bool
 
+	// ShowRate denotes whether the rate of progress since the bar was
+	// started, and the time left at that rate, should be printed
+	ShowRate bool
+
 	// Watching is the object that implements the Progressor to expose the
 	// values necessary for calculation
 	Watching Progressor
@@ -47,6 +51,7 @@ type Bar struct {
 
 	stopChan     chan struct{}
 	stopChanSync chan struct{}
+	startTime    time.Time
 
 	// hasRendered indicates that the bar has been rendered at least once
 	// and implies that when detaching should be rendered one more time
@@ -65,6 +70,7 @@ func (pb *Bar) Start() {
 	}
 	pb.stopChan = make(chan struct{})
 	pb.stopChanSync = make(chan struct{})
+	pb.startTime = time.Now()
 
 	go pb.start()
 }
@@ -105,22 +111,48 @@ func (pb *Bar) renderToWriter() {
 	pb.hasRendered = true
 	currentCount, maxCount := pb.Watching.Progress()
 	maxStr, currentStr := pb.formatCounts()
+	rate := ""
+	if pb.ShowRate {
+		rate = formatRate(currentCount, maxCount, time.Since(pb.startTime), pb.IsBytes)
+	}
 	if maxCount == 0 {
 		// if we have no max amount, just print a count
-		fmt.Fprintf(pb.Writer, "%v\t%v", pb.Name, currentStr)
+		fmt.Fprintf(pb.Writer, "%v\t%v%v", pb.Name, currentStr, rate)
 		return
 	}
 	// otherwise, print a bar and percents
 	percent := float64(currentCount) / float64(maxCount)
-	fmt.Fprintf(pb.Writer, "%v %v\t%s/%s (%2.1f%%)",
+	fmt.Fprintf(pb.Writer, "%v %v\t%s/%s (%2.1f%%)%v",
 		drawBar(pb.BarLength, percent),
 		pb.Name,
 		currentStr,
 		maxStr,
 		percent*100,
+		rate,
 	)
 }
 
+// formatRate returns the rate of progress over the elapsed time, and the
+// time left at that rate if the max amount is known, e.g.
+//  " 12.0 MB/s, 1m20s left"
+func formatRate(current, max int64, elapsed time.Duration, isBytes bool) string {
+	if elapsed <= 0 || current <= 0 {
+		return ""
+	}
+	perSecond := float64(current) / elapsed.Seconds()
+	var rate string
+	if isBytes {
+		rate = fmt.Sprintf(" %v/s", text.FormatByteAmount(int64(perSecond)))
+	} else {
+		rate = fmt.Sprintf(" %.1f/s", perSecond)
+	}
+	if max <= current {
+		return rate
+	}
+	left := time.Duration(float64(max-current) / perSecond * float64(time.Second))
+	return fmt.Sprintf("%v, %v left", rate, left.Round(time.Second))
+}
+
 func (pb *Bar) renderToGridRow(grid *text.GridWriter) {
 	pb.hasRendered = true
 	currentCount, maxCount := pb.Watching.Progress()
@@ -197,3 +197,20 @@ func TestBarUnits(t *testing.T) {
 		})
 	})
 }
+
+func TestBarRate(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a rate of progress", t, func() {
+		Convey("bytes should be formatted with units and the time left", func() {
+			So(formatRate(50*1024*1024, 100*1024*1024, 5*time.Second, true),
+				ShouldEqual, " 10.0MB/s, 5s left")
+		})
+		Convey("counts should be formatted as is", func() {
+			So(formatRate(30, 0, 10*time.Second, false), ShouldEqual, " 3.0/s")
+		})
+		Convey("nothing should be printed before any progress", func() {
+			So(formatRate(0, 100, time.Second, true), ShouldEqual, "")
+		})
+	})
+}
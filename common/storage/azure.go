@@ -0,0 +1,289 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+const (
+	// azureBlockSize is the size of each block of a block blob upload.
+	azureBlockSize = 8 * 1024 * 1024
+
+	azureVersion = "2020-04-08"
+)
+
+// azureTokenURL serves the token of the managed identity of an Azure VM; a
+// variable so tests can replace it.
+var azureTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token" +
+	"?api-version=2018-02-01&resource=https%3A%2F%2Fstorage.azure.com%2F"
+
+// azureClient sends requests to Azure Blob Storage, authorized with the
+// account's shared key, a SAS token, or an OAuth token of a managed
+// identity.
+type azureClient struct {
+	// Endpoint is the URL of the account's blob service, e.g.
+	// https://account.blob.core.windows.net.
+	Endpoint    string
+	Account     string
+	Key         []byte
+	SASToken    string
+	BearerToken string
+	HTTPClient  *http.Client
+
+	// now returns the request time; it is replaced in tests.
+	now func() time.Time
+}
+
+// newAzureClient returns a client configured from the environment: the
+// account of AZURE_STORAGE_ACCOUNT, with the shared key of
+// AZURE_STORAGE_KEY, or the SAS token of AZURE_STORAGE_SAS_TOKEN, or else
+// the managed identity of the VM. AZURE_STORAGE_ENDPOINT overrides the
+// service URL, e.g. for an emulator.
+func newAzureClient() (*azureClient, error) {
+	client := &azureClient{
+		Account:    os.Getenv("AZURE_STORAGE_ACCOUNT"),
+		SASToken:   strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?"),
+		HTTPClient: http.DefaultClient,
+		now:        time.Now,
+	}
+	if client.Account == "" {
+		return nil, fmt.Errorf("AZURE_STORAGE_ACCOUNT must be set for az:// URLs")
+	}
+	client.Endpoint = fmt.Sprintf("https://%v.blob.core.windows.net", client.Account)
+	if endpoint := os.Getenv("AZURE_STORAGE_ENDPOINT"); endpoint != "" {
+		client.Endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+
+	switch key := os.Getenv("AZURE_STORAGE_KEY"); {
+	case key != "":
+		decoded, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AZURE_STORAGE_KEY: %v", err)
+		}
+		client.Key = decoded
+	case client.SASToken != "":
+	default:
+		token, err := fetchToken(azureTokenURL, map[string]string{"Metadata": "true"})
+		if err != nil {
+			return nil, fmt.Errorf("no credentials found for az:// URLs: set AZURE_STORAGE_KEY or "+
+				"AZURE_STORAGE_SAS_TOKEN, or run with a managed identity: %v", err)
+		}
+		client.BearerToken = token
+	}
+	return client, nil
+}
+
+// blobURL returns the URL of the given blob.
+func (c *azureClient) blobURL(container, blob string, query url.Values) *url.URL {
+	u, _ := url.Parse(c.Endpoint)
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + container + "/" + blob
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+	if c.SASToken != "" {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += c.SASToken
+	}
+	return u
+}
+
+// send sends an authorized request, retrying transient failures, and
+// returns the response of a successful request, whose body the caller must
+// close.
+func (c *azureClient) send(method, container, blob string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	return send(c.HTTPClient, func() (*http.Request, error) {
+		req, err := http.NewRequest(method, c.blobURL(container, blob, query).String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		c.authorize(req, query)
+		return req, nil
+	})
+}
+
+// authorize adds the version, date and authorization headers to the
+// request.
+func (c *azureClient) authorize(req *http.Request, query url.Values) {
+	req.Header.Set("x-ms-version", azureVersion)
+	req.Header.Set("x-ms-date", c.now().UTC().Format(http.TimeFormat))
+	switch {
+	case c.Key != nil:
+		req.Header.Set("Authorization", fmt.Sprintf("SharedKey %v:%v", c.Account, c.signature(req, query)))
+	case c.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	}
+}
+
+// signature returns the Shared Key signature of the request.
+func (c *azureClient) signature(req *http.Request, query url.Values) string {
+	contentLength := ""
+	if req.ContentLength > 0 {
+		contentLength = strconv.FormatInt(req.ContentLength, 10)
+	}
+	var headerNames []string
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-ms-") {
+			headerNames = append(headerNames, lower)
+		}
+	}
+	sort.Strings(headerNames)
+	var canonical bytes.Buffer
+	fmt.Fprintf(&canonical, "%v\n\n\n%v\n\n%v\n\n\n\n\n\n%v\n", req.Method, contentLength,
+		req.Header.Get("Content-Type"), req.Header.Get("Range"))
+	for _, name := range headerNames {
+		fmt.Fprintf(&canonical, "%v:%v\n", name, strings.TrimSpace(req.Header.Get(name)))
+	}
+	fmt.Fprintf(&canonical, "/%v%v", c.Account, escapePath(req.URL.Path))
+	var queryNames []string
+	for name := range query {
+		queryNames = append(queryNames, name)
+	}
+	sort.Strings(queryNames)
+	for _, name := range queryNames {
+		values := append([]string{}, query[name]...)
+		sort.Strings(values)
+		fmt.Fprintf(&canonical, "\n%v:%v", strings.ToLower(name), strings.Join(values, ","))
+	}
+
+	mac := hmac.New(sha256.New, c.Key)
+	mac.Write(canonical.Bytes())
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Open returns a reader of the blob, which resumes reading where it stopped
+// if the connection drops.
+func (c *azureClient) Open(container, blob string) (io.ReadCloser, error) {
+	reader := &objectReader{
+		name: fmt.Sprintf("%v/%v", container, blob),
+		get: func(offset int64) (*http.Response, error) {
+			header := http.Header{}
+			if r := rangeHeader(offset); r != "" {
+				header.Set("Range", r)
+			}
+			return c.send("GET", container, blob, nil, header, nil)
+		},
+	}
+	resp, err := reader.get(0)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v/%v: %v", container, blob, err)
+	}
+	reader.body = resp.Body
+	return reader, nil
+}
+
+// Create starts the upload of a block blob.
+func (c *azureClient) Create(container, blob string) (Writer, error) {
+	return &azureUpload{client: c, container: container, blob: blob}, nil
+}
+
+// azureUpload uploads a block blob. Data is buffered into blocks which are
+// uploaded as they fill up, and committed when the upload is closed; small
+// blobs are uploaded with a single request.
+type azureUpload struct {
+	client    *azureClient
+	container string
+	blob      string
+	buf       bytes.Buffer
+	blockIDs  []string
+	closed    bool
+}
+
+type azureBlockList struct {
+	XMLName xml.Name `xml:"BlockList"`
+	Latest  []string `xml:"Latest"`
+}
+
+// Write buffers data, uploading a block whenever a full block is available.
+func (u *azureUpload) Write(p []byte) (int, error) {
+	if u.closed {
+		return 0, fmt.Errorf("write to closed upload of %v/%v", u.container, u.blob)
+	}
+	n, _ := u.buf.Write(p)
+	for u.buf.Len() >= azureBlockSize {
+		if err := u.uploadBlock(u.buf.Next(azureBlockSize)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (u *azureUpload) uploadBlock(data []byte) error {
+	// the IDs of the blocks of a blob must all have the same length
+	id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("block-%08d", len(u.blockIDs))))
+	query := url.Values{"comp": {"block"}, "blockid": {id}}
+	resp, err := u.client.send("PUT", u.container, u.blob, query, nil, data)
+	if err != nil {
+		return fmt.Errorf("error uploading block %v of %v/%v: %v", len(u.blockIDs)+1, u.container, u.blob, err)
+	}
+	resp.Body.Close()
+	u.blockIDs = append(u.blockIDs, id)
+	log.Logvf(log.DebugHigh, "uploaded block %v of %v/%v", len(u.blockIDs), u.container, u.blob)
+	return nil
+}
+
+// Close uploads any buffered data and commits the blob.
+func (u *azureUpload) Close() error {
+	if u.closed {
+		return nil
+	}
+	u.closed = true
+
+	if len(u.blockIDs) == 0 {
+		// everything fit in a single block
+		header := http.Header{"X-Ms-Blob-Type": {"BlockBlob"}}
+		resp, err := u.client.send("PUT", u.container, u.blob, nil, header, u.buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("error uploading %v/%v: %v", u.container, u.blob, err)
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	if u.buf.Len() > 0 {
+		if err := u.uploadBlock(u.buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	blockList, err := xml.Marshal(azureBlockList{Latest: u.blockIDs})
+	if err != nil {
+		return err
+	}
+	resp, err := u.client.send("PUT", u.container, u.blob, url.Values{"comp": {"blocklist"}}, nil,
+		append([]byte(xml.Header), blockList...))
+	if err != nil {
+		return fmt.Errorf("error committing upload of %v/%v: %v", u.container, u.blob, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Abort discards the upload. Blocks that are never committed don't make a
+// blob, and are deleted by the service.
+func (u *azureUpload) Abort() error {
+	u.closed = true
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package storage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeAzure records the requests made by an azureUpload.
+type fakeAzure struct {
+	sync.Mutex
+	requests []string
+	blobs    map[string][]byte
+	blocks   map[string][]byte
+	headers  []http.Header
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	query := r.URL.Query()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path+"?"+query.Get("comp"))
+	f.headers = append(f.headers, r.Header)
+	switch {
+	case r.Method == "GET":
+		blob, ok := f.blobs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(blob)
+	case query.Get("comp") == "block":
+		f.blocks[query.Get("blockid")] = body
+		w.WriteHeader(http.StatusCreated)
+	case query.Get("comp") == "blocklist":
+		list := azureBlockList{}
+		xml.Unmarshal(body, &list)
+		var blob []byte
+		for _, id := range list.Latest {
+			blob = append(blob, f.blocks[id]...)
+		}
+		f.blobs[r.URL.Path] = blob
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "PUT" && r.Header.Get("x-ms-blob-type") == "BlockBlob":
+		f.blobs[r.URL.Path] = body
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func TestAzureUpload(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a fake Azure Blob Storage server", t, func() {
+		fake := &fakeAzure{blobs: map[string][]byte{}, blocks: map[string][]byte{}}
+		server := httptest.NewServer(fake)
+		defer server.Close()
+		client := &azureClient{
+			Endpoint:   server.URL + "/account",
+			Account:    "account",
+			Key:        []byte("key"),
+			HTTPClient: http.DefaultClient,
+			now:        time.Now,
+		}
+
+		Convey("small blobs should be uploaded with a single signed request", func() {
+			upload, err := client.Create("container", "dir/out.json")
+			So(err, ShouldBeNil)
+			_, err = upload.Write([]byte(`{"a":1}`))
+			So(err, ShouldBeNil)
+			So(upload.Close(), ShouldBeNil)
+			So(fake.requests, ShouldResemble, []string{"PUT /account/container/dir/out.json?"})
+			So(string(fake.blobs["/account/container/dir/out.json"]), ShouldEqual, `{"a":1}`)
+			So(strings.HasPrefix(fake.headers[0].Get("Authorization"), "SharedKey account:"), ShouldBeTrue)
+			So(fake.headers[0].Get("x-ms-version"), ShouldEqual, azureVersion)
+		})
+
+		Convey("large blobs should be uploaded in blocks and read back", func() {
+			data := bytes.Repeat([]byte("0123456789abcdef"), (azureBlockSize+1024)/16)
+			upload, err := client.Create("container", "out.json")
+			So(err, ShouldBeNil)
+			_, err = upload.Write(data)
+			So(err, ShouldBeNil)
+			So(upload.Close(), ShouldBeNil)
+			So(fake.requests, ShouldResemble, []string{
+				"PUT /account/container/out.json?block",
+				"PUT /account/container/out.json?block",
+				"PUT /account/container/out.json?blocklist",
+			})
+
+			reader, err := client.Open("container", "out.json")
+			So(err, ShouldBeNil)
+			read, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(read, data), ShouldBeTrue)
+		})
+
+		Convey("a SAS token should be sent instead of a signature", func() {
+			client.Key = nil
+			client.SASToken = "sv=2020&sig=abc"
+			u := client.blobURL("container", "out.json", nil)
+			So(u.RawQuery, ShouldEqual, "sv=2020&sig=abc")
+			upload, _ := client.Create("container", "out.json")
+			So(upload.Close(), ShouldBeNil)
+			So(fake.headers[0].Get("Authorization"), ShouldEqual, "")
+		})
+	})
+}
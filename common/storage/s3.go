@@ -0,0 +1,487 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/db/aws"
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+const (
+	// s3PartSize is the size of the first parts of a multipart upload. S3
+	// requires every part but the last to be at least 5MB.
+	s3PartSize = 8 * 1024 * 1024
+	// s3PartSizeGrowth is the number of parts after which the part size
+	// doubles, so that objects up to the 5TB S3 allows fit in s3MaxParts.
+	s3PartSizeGrowth = 1000
+	// s3MaxParts is the number of parts S3 allows in a multipart upload.
+	s3MaxParts = 10000
+
+	s3TimeFormat = "20060102T150405Z"
+	s3DateFormat = "20060102"
+)
+
+// gceTokenURL serves the OAuth token of the service account of a Google
+// Compute Engine instance; a variable so tests can replace it.
+var gceTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// s3Credentials holds the keys used to sign requests, or the OAuth token
+// sent instead of a signature to Google Cloud Storage.
+type s3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	BearerToken     string
+}
+
+// s3Client signs and sends requests to an S3-compatible object store.
+type s3Client struct {
+	// Endpoint is the scheme and host of the service, e.g. https://s3.amazonaws.com.
+	Endpoint string
+	Region   string
+	// PathStyle, if set, addresses buckets as the first path component
+	// instead of as a subdomain of the endpoint.
+	PathStyle   bool
+	Credentials s3Credentials
+	HTTPClient  *http.Client
+
+	// refresh, if set, gets new credentials once temporary ones expire
+	refresh      func() (s3Credentials, error)
+	refreshMutex sync.Mutex
+
+	// now returns the signing time; it is replaced in tests.
+	now func() time.Time
+}
+
+// newS3Client returns a client for the given URL scheme, configured from the
+// environment. s3:// URLs use the standard AWS_* variables, or the role of
+// the ECS task or EC2 instance; gs:// URLs use the S3-compatible XML API of
+// Google Cloud Storage, with HMAC keys, an OAuth token, or the service
+// account of the Compute Engine instance.
+func newS3Client(scheme string) (*s3Client, error) {
+	client := &s3Client{HTTPClient: http.DefaultClient, now: time.Now}
+	var err error
+	switch scheme {
+	case "s3":
+		client.Region = firstEnv("AWS_REGION", "AWS_DEFAULT_REGION")
+		if client.Region == "" {
+			client.Region = "us-east-1"
+		}
+		if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+			client.Endpoint = strings.TrimSuffix(endpoint, "/")
+			client.PathStyle = true
+		} else {
+			client.Endpoint = fmt.Sprintf("https://s3.%v.amazonaws.com", client.Region)
+		}
+		client.refresh = awsCredentials
+	case "gs":
+		client.Region = "auto"
+		client.Endpoint = "https://storage.googleapis.com"
+		client.PathStyle = true
+		client.refresh = googleCredentials
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme '%v'", scheme)
+	}
+	if client.Credentials, err = client.refresh(); err != nil {
+		return nil, fmt.Errorf("no credentials found for %v:// URLs: %v", scheme, err)
+	}
+	return client, nil
+}
+
+func awsCredentials() (s3Credentials, error) {
+	id, secret, token, err := aws.EnvironmentCredentials()
+	return s3Credentials{AccessKeyID: id, SecretAccessKey: secret, SessionToken: token}, err
+}
+
+// googleCredentials returns the HMAC keys of the GOOGLE_HMAC_ACCESS_ID and
+// GOOGLE_HMAC_SECRET environment variables, or else the OAuth token of
+// GOOGLE_OAUTH_ACCESS_TOKEN, or else the token of the service account of the
+// Compute Engine instance.
+func googleCredentials() (s3Credentials, error) {
+	id, secret := os.Getenv("GOOGLE_HMAC_ACCESS_ID"), os.Getenv("GOOGLE_HMAC_SECRET")
+	if id != "" || secret != "" {
+		if id == "" || secret == "" {
+			return s3Credentials{}, fmt.Errorf("both GOOGLE_HMAC_ACCESS_ID and GOOGLE_HMAC_SECRET must be set")
+		}
+		return s3Credentials{AccessKeyID: id, SecretAccessKey: secret}, nil
+	}
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return s3Credentials{BearerToken: token}, nil
+	}
+	token, err := fetchToken(gceTokenURL, map[string]string{"Metadata-Flavor": "Google"})
+	if err != nil {
+		return s3Credentials{}, fmt.Errorf("error getting the token of the instance service account: %v", err)
+	}
+	return s3Credentials{BearerToken: token}, nil
+}
+
+// fetchToken gets an OAuth access token from an instance metadata service.
+func fetchToken(tokenURL string, headers map[string]string) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	req, err := http.NewRequest("GET", tokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %v returned %v", tokenURL, resp.Status)
+	}
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&token); err != nil || token.AccessToken == "" {
+		return "", fmt.Errorf("invalid token from %v", tokenURL)
+	}
+	return token.AccessToken, nil
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// objectURL returns the URL of the given object.
+func (c *s3Client) objectURL(bucket, key string, query url.Values) *url.URL {
+	u, _ := url.Parse(c.Endpoint)
+	if c.PathStyle {
+		u.Path = "/" + bucket + "/" + key
+	} else {
+		u.Host = bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	// send the path exactly as it is encoded for signing
+	u.RawPath = escapePath(u.Path)
+	u.RawQuery = canonicalQuery(query)
+	return u
+}
+
+// send sends a signed request, retrying transient failures, and returns
+// the response of a successful request, whose body the caller must close.
+// Expired temporary credentials are refreshed once.
+func (c *s3Client) send(method, bucket, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(method, c.objectURL(bucket, key, query).String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		c.sign(req, body)
+		return req, nil
+	}
+	resp, err := send(c.HTTPClient, newRequest)
+	if e, ok := err.(*statusError); ok && c.refresh != nil && strings.Contains(e.Body, "ExpiredToken") {
+		log.Logvf(log.DebugLow, "refreshing expired credentials")
+		c.refreshMutex.Lock()
+		c.Credentials, err = c.refresh()
+		c.refreshMutex.Unlock()
+		if err != nil {
+			return nil, fmt.Errorf("error refreshing expired credentials: %v", err)
+		}
+		resp, err = send(c.HTTPClient, newRequest)
+	}
+	return resp, err
+}
+
+// do sends a signed request, like send, and returns the response body of a
+// successful request.
+func (c *s3Client) do(method, bucket, key string, query url.Values, body []byte) (*http.Response, []byte, error) {
+	resp, err := c.send(method, bucket, key, query, nil, body)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, respBody, nil
+}
+
+// Open returns a reader of the object, which resumes reading where it
+// stopped if the connection drops.
+func (c *s3Client) Open(bucket, key string) (io.ReadCloser, error) {
+	reader := &objectReader{
+		name: fmt.Sprintf("%v/%v", bucket, key),
+		get: func(offset int64) (*http.Response, error) {
+			header := http.Header{}
+			if r := rangeHeader(offset); r != "" {
+				header.Set("Range", r)
+			}
+			return c.send("GET", bucket, key, nil, header, nil)
+		},
+	}
+	// fail now if the object can't be read
+	resp, err := reader.get(0)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %v/%v: %v", bucket, key, err)
+	}
+	reader.body = resp.Body
+	return reader, nil
+}
+
+// Create starts a multipart upload of the object.
+func (c *s3Client) Create(bucket, key string) (Writer, error) {
+	return newS3Upload(c, bucket, key), nil
+}
+
+// sign adds AWS Signature Version 4 headers to the request.
+func (c *s3Client) sign(req *http.Request, body []byte) {
+	c.refreshMutex.Lock()
+	creds := c.Credentials
+	c.refreshMutex.Unlock()
+	if creds.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+creds.BearerToken)
+		return
+	}
+
+	now := c.now().UTC()
+	amzDate := now.Format(s3TimeFormat)
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("x-amz-security-token", creds.SessionToken)
+	}
+
+	headerNames := []string{"host"}
+	for name := range req.Header {
+		headerNames = append(headerNames, strings.ToLower(name))
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders bytes.Buffer
+	for _, name := range headerNames {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+		}
+		fmt.Fprintf(&canonicalHeaders, "%v:%v\n", name, strings.TrimSpace(value))
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		escapePath(req.URL.Path),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%v/%v/s3/aws4_request", now.Format(s3DateFormat), c.Region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), now.Format(s3DateFormat))
+	signingKey = hmacSHA256(signingKey, c.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%v/%v, SignedHeaders=%v, Signature=%v",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath URI-encodes every byte of the path except unreserved characters
+// and slashes, as required for the canonical request.
+func escapePath(path string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			buf.WriteByte(c)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		}
+	}
+	return buf.String()
+}
+
+// canonicalQuery encodes the query with sorted keys and %20 for spaces.
+func canonicalQuery(query url.Values) string {
+	return strings.Replace(query.Encode(), "+", "%20", -1)
+}
+
+// s3Upload is a multipart upload of a single object. Data is buffered into
+// parts which are uploaded as they fill up; small objects are uploaded with
+// a single request when the upload is closed.
+type s3Upload struct {
+	client   *s3Client
+	bucket   string
+	key      string
+	uploadID string
+	buf      bytes.Buffer
+	parts    []s3CompletedPart
+	closed   bool
+}
+
+type s3CompletedPart struct {
+	XMLName    xml.Name `xml:"Part"`
+	PartNumber int      `xml:"PartNumber"`
+	ETag       string   `xml:"ETag"`
+}
+
+type s3InitiateResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompleteRequest struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+func newS3Upload(client *s3Client, bucket, key string) *s3Upload {
+	return &s3Upload{client: client, bucket: bucket, key: key}
+}
+
+// Write buffers data, uploading a part whenever a full part is available.
+func (u *s3Upload) Write(p []byte) (int, error) {
+	if u.closed {
+		return 0, fmt.Errorf("write to closed upload of %v/%v", u.bucket, u.key)
+	}
+	n, _ := u.buf.Write(p)
+	for {
+		size := s3PartSizeOf(len(u.parts) + 1)
+		if u.buf.Len() < size {
+			return n, nil
+		}
+		if err := u.uploadPart(u.buf.Next(size)); err != nil {
+			return n, err
+		}
+	}
+}
+
+// s3PartSizeOf returns the size of the part with the given number, which
+// doubles every s3PartSizeGrowth parts: the first 1000 parts hold 8GB, the
+// next 1000 16GB, and so on.
+func s3PartSizeOf(partNumber int) int {
+	return s3PartSize << uint((partNumber-1)/s3PartSizeGrowth)
+}
+
+func (u *s3Upload) uploadPart(data []byte) error {
+	if u.uploadID == "" {
+		_, body, err := u.client.do("POST", u.bucket, u.key, url.Values{"uploads": {""}}, nil)
+		if err != nil {
+			return fmt.Errorf("error starting upload of %v/%v: %v", u.bucket, u.key, err)
+		}
+		result := s3InitiateResult{}
+		if err = xml.Unmarshal(body, &result); err != nil || result.UploadID == "" {
+			return fmt.Errorf("error starting upload of %v/%v: unexpected response %q", u.bucket, u.key, body)
+		}
+		u.uploadID = result.UploadID
+	}
+
+	partNumber := len(u.parts) + 1
+	if partNumber > s3MaxParts {
+		return fmt.Errorf("error uploading %v/%v: more than the %v parts S3 allows in an upload",
+			u.bucket, u.key, s3MaxParts)
+	}
+	query := url.Values{
+		"partNumber": {fmt.Sprintf("%v", partNumber)},
+		"uploadId":   {u.uploadID},
+	}
+	resp, _, err := u.client.do("PUT", u.bucket, u.key, query, data)
+	if err != nil {
+		return fmt.Errorf("error uploading part %v of %v/%v: %v", partNumber, u.bucket, u.key, err)
+	}
+	u.parts = append(u.parts, s3CompletedPart{PartNumber: partNumber, ETag: resp.Header.Get("ETag")})
+	log.Logvf(log.DebugHigh, "uploaded part %v of %v/%v", partNumber, u.bucket, u.key)
+	return nil
+}
+
+// Close uploads any buffered data and completes the upload.
+func (u *s3Upload) Close() error {
+	if u.closed {
+		return nil
+	}
+	u.closed = true
+
+	if u.uploadID == "" {
+		// everything fit in a single part
+		_, _, err := u.client.do("PUT", u.bucket, u.key, nil, u.buf.Bytes())
+		if err != nil {
+			return fmt.Errorf("error uploading %v/%v: %v", u.bucket, u.key, err)
+		}
+		return nil
+	}
+
+	if u.buf.Len() > 0 {
+		if err := u.uploadPart(u.buf.Bytes()); err != nil {
+			u.Abort()
+			return err
+		}
+	}
+	complete, err := xml.Marshal(s3CompleteRequest{Parts: u.parts})
+	if err != nil {
+		return err
+	}
+	_, body, err := u.client.do("POST", u.bucket, u.key, url.Values{"uploadId": {u.uploadID}}, complete)
+	if err == nil && bytes.Contains(body, []byte("<Error>")) {
+		// a completion can fail after the 200 response has started
+		err = fmt.Errorf("%s", body)
+	}
+	if err != nil {
+		return fmt.Errorf("error completing upload of %v/%v: %v", u.bucket, u.key, err)
+	}
+	return nil
+}
+
+// Abort discards the upload so that no partial object is left behind.
+func (u *s3Upload) Abort() error {
+	u.closed = true
+	if u.uploadID == "" {
+		return nil
+	}
+	_, _, err := u.client.do("DELETE", u.bucket, u.key, url.Values{"uploadId": {u.uploadID}}, nil)
+	return err
+}
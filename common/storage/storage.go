@@ -0,0 +1,264 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package storage reads and writes objects in cloud storage, so that every
+// tool accepts the same URLs wherever it reads or writes a file:
+//
+//	s3://<bucket>/<key>          Amazon S3, or an S3-compatible store
+//	gs://<bucket>/<key>          Google Cloud Storage
+//	az://<container>/<blob>      Azure Blob Storage
+//
+// Credentials are read from the environment, or else from the role of the
+// instance the tool runs on. Requests failing with transient errors are
+// retried, and reads resume where a dropped connection left off.
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+const (
+	// maxAttempts is the number of times a request is attempted before
+	// giving up on transient failures.
+	maxAttempts = 5
+
+	maxBackoff = 16 * time.Second
+)
+
+// schemes are the URL schemes of the supported object stores.
+var schemes = []string{"s3", "gs", "az"}
+
+// backoff returns how long to wait before the given retry of a request; it
+// is replaced in tests.
+var backoff = func(retry int) time.Duration {
+	wait := time.Duration(1<<uint(retry-1)) * time.Second
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// Object identifies an object in cloud storage.
+type Object struct {
+	Scheme string
+	Bucket string
+	Key    string
+}
+
+func (o *Object) String() string {
+	return fmt.Sprintf("%v://%v/%v", o.Scheme, o.Bucket, o.Key)
+}
+
+// Backend is an object store.
+type Backend interface {
+	// Open returns a reader of the content of the object.
+	Open(bucket, key string) (io.ReadCloser, error)
+
+	// Create returns a writer uploading the content of the object, which
+	// only exists once the writer is closed without error.
+	Create(bucket, key string) (Writer, error)
+}
+
+// Writer uploads an object.
+type Writer interface {
+	io.WriteCloser
+
+	// Abort discards the upload so that no partial object is left behind.
+	Abort() error
+}
+
+// IsURL returns true if name is a URL of one of the supported object
+// stores rather than a local path.
+func IsURL(name string) bool {
+	for _, scheme := range schemes {
+		if strings.HasPrefix(name, scheme+"://") {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseURL parses a URL of an object in one of the supported object stores.
+// It returns nil and no error if name is a local path.
+func ParseURL(name string) (*Object, error) {
+	if !IsURL(name) {
+		return nil, nil
+	}
+	u, err := url.Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URL '%v': %v", name, err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" || strings.HasSuffix(key, "/") {
+		return nil, fmt.Errorf("invalid storage URL '%v': expected %v://<bucket>/<key>", name, u.Scheme)
+	}
+	return &Object{Scheme: u.Scheme, Bucket: u.Host, Key: key}, nil
+}
+
+// NewBackend returns the object store of the URL scheme, configured from
+// the environment.
+func NewBackend(scheme string) (Backend, error) {
+	switch scheme {
+	case "s3", "gs":
+		return newS3Client(scheme)
+	case "az":
+		return newAzureClient()
+	}
+	return nil, fmt.Errorf("unsupported storage scheme '%v'", scheme)
+}
+
+// Open opens the object at the URL for reading.
+func Open(name string) (io.ReadCloser, error) {
+	object, backend, err := resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Open(object.Bucket, object.Key)
+}
+
+// Create starts the upload of the object at the URL.
+func Create(name string) (Writer, error) {
+	object, backend, err := resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Create(object.Bucket, object.Key)
+}
+
+func resolve(name string) (*Object, Backend, error) {
+	object, err := ParseURL(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if object == nil {
+		return nil, nil, fmt.Errorf("'%v' is not a storage URL", name)
+	}
+	backend, err := NewBackend(object.Scheme)
+	if err != nil {
+		return nil, nil, err
+	}
+	return object, backend, nil
+}
+
+// statusError is the error response of an object store.
+type statusError struct {
+	Method     string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%v %v: %v", e.Method, e.Status, e.Body)
+}
+
+// isTransient returns true if the request failing with err may succeed if
+// it is sent again.
+func isTransient(err error) bool {
+	e, ok := err.(*statusError)
+	if !ok {
+		// the request or its response was lost
+		return true
+	}
+	return e.StatusCode == http.StatusRequestTimeout || e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= 500
+}
+
+// send sends the request newRequest builds, which it calls again for every
+// attempt, retrying transient failures. It returns the response of a
+// successful request, whose body the caller must close, or the error of the
+// last attempt.
+func send(client *http.Client, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	var lastErr error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff(attempt - 1))
+		}
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err == nil && resp.StatusCode >= 300 {
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			err = &statusError{req.Method, resp.StatusCode, resp.Status, strings.TrimSpace(string(body))}
+		}
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+		if !isTransient(err) {
+			break
+		}
+		log.Logvf(log.DebugLow, "attempt %v of %v %v failed: %v", attempt, req.Method, req.URL.Path, err)
+	}
+	return nil, lastErr
+}
+
+// objectReader reads an object, resuming from where it stopped when the
+// connection drops part way.
+type objectReader struct {
+	name string
+	// get sends a request for the object from the offset on
+	get    func(offset int64) (*http.Response, error)
+	offset int64
+	body   io.ReadCloser
+	drops  int
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	for {
+		if r.body == nil {
+			resp, err := r.get(r.offset)
+			if err != nil {
+				return 0, fmt.Errorf("error reading %v: %v", r.name, err)
+			}
+			r.body = resp.Body
+		}
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		r.body.Close()
+		r.body = nil
+		r.drops++
+		if r.drops >= maxAttempts {
+			return n, fmt.Errorf("error reading %v: %v", r.name, err)
+		}
+		log.Logvf(log.DebugLow, "resuming read of %v at byte %v after error: %v", r.name, r.offset, err)
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (r *objectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// rangeHeader returns the Range header requesting an object from the
+// offset on, or "" for the whole object.
+func rangeHeader(offset int64) string {
+	if offset == 0 {
+		return ""
+	}
+	return fmt.Sprintf("bytes=%v-", offset)
+}
@@ -0,0 +1,140 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func init() {
+	// don't wait between retries
+	backoff = func(int) time.Duration { return 0 }
+}
+
+func TestParseURL(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Cloud storage URLs should be recognized", t, func() {
+		object, err := ParseURL("s3://bucket/path/to/out.json.gz")
+		So(err, ShouldBeNil)
+		So(object, ShouldResemble, &Object{Scheme: "s3", Bucket: "bucket", Key: "path/to/out.json.gz"})
+		So(object.String(), ShouldEqual, "s3://bucket/path/to/out.json.gz")
+
+		object, err = ParseURL("gs://bucket/out.csv")
+		So(err, ShouldBeNil)
+		So(object, ShouldResemble, &Object{Scheme: "gs", Bucket: "bucket", Key: "out.csv"})
+
+		object, err = ParseURL("az://container/dump.archive")
+		So(err, ShouldBeNil)
+		So(object, ShouldResemble, &Object{Scheme: "az", Bucket: "container", Key: "dump.archive"})
+
+		object, err = ParseURL("out/file.json")
+		So(err, ShouldBeNil)
+		So(object, ShouldBeNil)
+		So(IsURL("out/file.json"), ShouldBeFalse)
+
+		_, err = ParseURL("s3://bucket")
+		So(err, ShouldNotBeNil)
+		_, err = ParseURL("s3://bucket/dir/")
+		So(err, ShouldNotBeNil)
+		_, err = Open("local/file.json")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestSend(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a server failing its first requests", t, func() {
+		var requests int
+		status := http.StatusServiceUnavailable
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests < 3 {
+				w.WriteHeader(status)
+				w.Write([]byte("failed"))
+				return
+			}
+			w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+		newRequest := func() (*http.Request, error) { return http.NewRequest("GET", server.URL, nil) }
+
+		Convey("transient failures should be retried", func() {
+			resp, err := send(http.DefaultClient, newRequest)
+			So(err, ShouldBeNil)
+			body, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			So(string(body), ShouldEqual, "ok")
+			So(requests, ShouldEqual, 3)
+		})
+
+		Convey("other failures should not be retried", func() {
+			status = http.StatusForbidden
+			_, err := send(http.DefaultClient, newRequest)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "403")
+			So(err.Error(), ShouldContainSubstring, "failed")
+			So(requests, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestObjectReader(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a server dropping the connection part way", t, func() {
+		object := bytes.Repeat([]byte("0123456789"), 1000)
+		var ranges []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ranges = append(ranges, r.Header.Get("Range"))
+			var offset int
+			if r.Header.Get("Range") != "" {
+				offset, _ = strconv.Atoi(r.Header.Get("Range")[len("bytes=") : len(r.Header.Get("Range"))-1])
+			}
+			rest := object[offset:]
+			if len(ranges) == 1 {
+				// promise the whole object, and only send part of it
+				w.Header().Set("Content-Length", strconv.Itoa(len(rest)))
+				w.Write(rest[:4000])
+				w.(http.Flusher).Flush()
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.(*net.TCPConn).Close()
+				return
+			}
+			w.Write(rest)
+		}))
+		defer server.Close()
+
+		Convey("the rest of the object should be read from where it stopped", func() {
+			reader := &objectReader{name: "object", get: func(offset int64) (*http.Response, error) {
+				return send(http.DefaultClient, func() (*http.Request, error) {
+					req, err := http.NewRequest("GET", server.URL, nil)
+					if err == nil && offset > 0 {
+						req.Header.Set("Range", rangeHeader(offset))
+					}
+					return req, err
+				})
+			}}
+			data, err := ioutil.ReadAll(reader)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(data, object), ShouldBeTrue)
+			So(ranges, ShouldResemble, []string{"", "bytes=4000-"})
+			So(reader.Close(), ShouldBeNil)
+		})
+	})
+}
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"unicode/utf8"
 )
 
 type Cell struct {
@@ -117,8 +118,9 @@ func (gw *GridWriter) calculateWidths() []int {
 				continue
 			}
 			// Set the size for the row to be the largest
-			// of all the cells in the column
-			newMin := max(gw.MinWidth, len(gw.Grid[i][j].contents))
+			// of all the cells in the column, counting characters rather
+			// than bytes since padding is applied by character
+			newMin := max(gw.MinWidth, utf8.RuneCountInString(gw.Grid[i][j].contents))
 			if newMin > colWidths[j] {
 				colWidths[j] = newMin
 			}
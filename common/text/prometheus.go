@@ -0,0 +1,19 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package text
+
+import (
+	"strings"
+)
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// EscapePrometheusLabel escapes a label value for the Prometheus text
+// exposition format, in which it is written between double quotes.
+func EscapePrometheusLabel(value string) string {
+	return prometheusLabelEscaper.Replace(value)
+}
@@ -0,0 +1,23 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package text
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEscapePrometheusLabel(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Backslashes, quotes and newlines should be escaped in label values", t, func() {
+		So(EscapePrometheusLabel("localhost:27017"), ShouldEqual, "localhost:27017")
+		So(EscapePrometheusLabel(`a\b"c`+"\nd"), ShouldEqual, `a\\b\"c\nd`)
+	})
+}
@@ -0,0 +1,348 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package text
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// The formats a Table can be written in.
+const (
+	FormatText = "text"
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// Align is the alignment of the cells of a column in text.
+type Align int
+
+const (
+	AlignRight Align = iota
+	AlignLeft
+)
+
+const (
+	// ellipsis ends the contents of truncated cells
+	ellipsis = "…"
+	// minTruncatedWidth is the narrowest a column is made to fit MaxWidth
+	minTruncatedWidth = 3
+
+	boldStart = "\x1b[1m"
+	boldEnd   = "\x1b[0m"
+)
+
+// Column describes a column of a Table.
+type Column struct {
+	Name  string
+	Align Align
+}
+
+// tableRow is a row of cells. The last cell of an overflow row extends past
+// its column, over the following ones.
+type tableRow struct {
+	cells    []string
+	overflow bool
+}
+
+// Table renders rows of cells under named columns, as aligned text for
+// people to read, or as CSV or JSON for programs.
+type Table struct {
+	Columns []Column
+
+	// Padding is the number of spaces between the columns of text without
+	// borders.
+	Padding int
+	// MaxWidth, if positive, is the width that lines of text are kept
+	// within by truncating the widest columns.
+	MaxWidth int
+	// MinWidths are the minimum widths of the columns in text, e.g. the
+	// widths a previous block of rows was written with, so that columns
+	// don't shift from one block to the next.
+	MinWidths []int
+	// Color writes the header of text in bold, with ANSI escapes.
+	Color bool
+	// Borders draws the lines around and between the cells of text with
+	// Unicode box-drawing characters.
+	Borders bool
+	// NoHeader leaves the header out of text and CSV. Its names still count
+	// toward the widths of the columns, so that blocks written with and
+	// without a header line up.
+	NoHeader bool
+
+	rows   []tableRow
+	widths []int
+}
+
+// NewTable returns a Table with right-aligned columns of the given names and
+// a padding of one space.
+func NewTable(names ...string) *Table {
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		columns[i] = Column{Name: name}
+	}
+	return &Table{Columns: columns, Padding: 1}
+}
+
+// AddRow adds a row of cells, one per column. Missing cells are empty.
+func (t *Table) AddRow(cells ...string) {
+	t.rows = append(t.rows, tableRow{cells: cells})
+}
+
+// AddOverflowRow adds a row whose last cell, e.g. an error message, extends
+// past its column over the following ones, without widening its column.
+func (t *Table) AddOverflowRow(cells ...string) {
+	t.rows = append(t.rows, tableRow{cells: cells, overflow: true})
+}
+
+// Len returns the number of rows in the table.
+func (t *Table) Len() int {
+	return len(t.rows)
+}
+
+// Reset discards the rows of the table, keeping its columns and settings.
+func (t *Table) Reset() {
+	t.rows = nil
+}
+
+// Widths returns the widths of the columns the text was last written with,
+// or would be written with if it hasn't been yet.
+func (t *Table) Widths() []int {
+	if t.widths == nil {
+		t.widths = t.calculateWidths()
+	}
+	return t.widths
+}
+
+// Write writes the table in the given format: FormatText, or "" for it,
+// FormatCSV or FormatJSON.
+func (t *Table) Write(w io.Writer, format string) error {
+	switch format {
+	case "", FormatText:
+		return t.WriteText(w)
+	case FormatCSV:
+		return t.WriteCSV(w)
+	case FormatJSON:
+		return t.WriteJSON(w)
+	}
+	return fmt.Errorf("unknown table format '%v'", format)
+}
+
+func width(s string) int {
+	return utf8.RuneCountInString(s)
+}
+
+// calculateWidths returns the widths of the columns in text: the widest of
+// their names, cells and minimum widths, narrowed to fit MaxWidth.
+func (t *Table) calculateWidths() []int {
+	widths := make([]int, len(t.Columns))
+	for i, column := range t.Columns {
+		widths[i] = width(column.Name)
+		if i < len(t.MinWidths) {
+			widths[i] = max(widths[i], t.MinWidths[i])
+		}
+	}
+	for _, row := range t.rows {
+		for i, cell := range row.cells {
+			if i >= len(widths) || row.overflow && i == len(row.cells)-1 {
+				break
+			}
+			widths[i] = max(widths[i], width(cell))
+		}
+	}
+	if t.MaxWidth <= 0 {
+		return widths
+	}
+	for t.lineWidth(widths) > t.MaxWidth {
+		widest := 0
+		for i := range widths {
+			if widths[i] > widths[widest] {
+				widest = i
+			}
+		}
+		if widths[widest] <= minTruncatedWidth {
+			break
+		}
+		widths[widest]--
+	}
+	return widths
+}
+
+// lineWidth returns the width of the lines of text with the given column
+// widths.
+func (t *Table) lineWidth(widths []int) int {
+	total := 0
+	for _, w := range widths {
+		total += w
+	}
+	if t.Borders {
+		// "│ " before each cell, " " after each, and the closing "│"
+		return total + 3*len(widths) + 1
+	}
+	return total + t.Padding*(len(widths)-1)
+}
+
+// fit pads or truncates the contents of a cell to the width.
+func fit(s string, width int, align Align) string {
+	n := utf8.RuneCountInString(s)
+	if n > width {
+		runes := []rune(s)
+		if width <= 1 {
+			return string(runes[:width])
+		}
+		return string(runes[:width-1]) + ellipsis
+	}
+	padding := strings.Repeat(" ", width-n)
+	if align == AlignLeft {
+		return s + padding
+	}
+	return padding + s
+}
+
+// WriteText writes the table as lines of aligned text.
+func (t *Table) WriteText(w io.Writer) error {
+	t.widths = t.calculateWidths()
+	buf := &bytes.Buffer{}
+	if t.Borders {
+		t.writeBorder(buf, "┌", "┬", "┐")
+	}
+	if !t.NoHeader {
+		names := make([]string, len(t.Columns))
+		for i, column := range t.Columns {
+			names[i] = column.Name
+		}
+		t.writeLine(buf, tableRow{cells: names}, t.Color)
+		if t.Borders {
+			t.writeBorder(buf, "├", "┼", "┤")
+		}
+	}
+	for _, row := range t.rows {
+		t.writeLine(buf, row, false)
+	}
+	if t.Borders {
+		t.writeBorder(buf, "└", "┴", "┘")
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func (t *Table) writeBorder(buf *bytes.Buffer, left, middle, right string) {
+	buf.WriteString(left)
+	for i, w := range t.widths {
+		if i > 0 {
+			buf.WriteString(middle)
+		}
+		buf.WriteString(strings.Repeat("─", w+2))
+	}
+	buf.WriteString(right)
+	buf.WriteString("\n")
+}
+
+func (t *Table) writeLine(buf *bytes.Buffer, row tableRow, bold bool) {
+	line := &bytes.Buffer{}
+	for i, column := range t.Columns {
+		cell := ""
+		if i < len(row.cells) {
+			cell = row.cells[i]
+		}
+		last := i == len(t.Columns)-1
+		overflow := row.overflow && i == len(row.cells)-1
+		if t.Borders {
+			line.WriteString("│ ")
+		} else if i > 0 {
+			line.WriteString(strings.Repeat(" ", t.Padding))
+		}
+		switch {
+		case overflow && t.Borders:
+			// span the following columns, and their borders
+			span := t.lineWidth(t.widths[i:]) - 4
+			line.WriteString(fit(cell, span, AlignLeft))
+		case overflow:
+			line.WriteString(cell)
+		default:
+			cell = fit(cell, t.widths[i], column.Align)
+			if bold {
+				cell = boldStart + cell + boldEnd
+			}
+			line.WriteString(cell)
+		}
+		if t.Borders {
+			line.WriteString(" ")
+			if last || overflow {
+				line.WriteString("│")
+			}
+		}
+		if overflow {
+			break
+		}
+	}
+	s := line.String()
+	if !t.Borders {
+		// left-aligned last columns leave no trailing spaces
+		if n := len(t.Columns); n > 0 && t.Columns[n-1].Align == AlignLeft || row.overflow {
+			s = strings.TrimRight(s, " ")
+		}
+	}
+	buf.WriteString(s)
+	buf.WriteString("\n")
+}
+
+// record returns the cells of a row, one per column.
+func (t *Table) record(row tableRow) []string {
+	record := make([]string, len(t.Columns))
+	copy(record, row.cells)
+	return record
+}
+
+// WriteCSV writes the table as CSV, with the column names as the header.
+func (t *Table) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if !t.NoHeader {
+		names := make([]string, len(t.Columns))
+		for i, column := range t.Columns {
+			names[i] = column.Name
+		}
+		writer.Write(names)
+	}
+	for _, row := range t.rows {
+		writer.Write(t.record(row))
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSON writes the table as one JSON object per row, keyed by the
+// column names in their order. Empty cells are left out.
+func (t *Table) WriteJSON(w io.Writer) error {
+	buf := &bytes.Buffer{}
+	for _, row := range t.rows {
+		buf.WriteString("{")
+		first := true
+		for i, cell := range t.record(row) {
+			if cell == "" {
+				continue
+			}
+			if !first {
+				buf.WriteString(",")
+			}
+			first = false
+			name, _ := json.Marshal(t.Columns[i].Name)
+			value, _ := json.Marshal(cell)
+			buf.Write(name)
+			buf.WriteString(":")
+			buf.Write(value)
+		}
+		buf.WriteString("}\n")
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
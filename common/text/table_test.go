@@ -0,0 +1,129 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package text
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTable(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a table of two rows", t, func() {
+		table := NewTable("name", "count")
+		table.AddRow("a", "1")
+		table.AddRow("longer", "1000000")
+		buf := &bytes.Buffer{}
+
+		Convey("text should be aligned to the widest cells", func() {
+			So(table.WriteText(buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, ""+
+				"  name   count\n"+
+				"     a       1\n"+
+				"longer 1000000\n")
+			So(table.Widths(), ShouldResemble, []int{6, 7})
+		})
+
+		Convey("left-aligned columns should be padded on the right", func() {
+			table.Columns[0].Align = AlignLeft
+			table.Columns[1].Align = AlignLeft
+			So(table.WriteText(buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, ""+
+				"name   count\n"+
+				"a      1\n"+
+				"longer 1000000\n")
+		})
+
+		Convey("minimum widths should widen the columns", func() {
+			table.MinWidths = []int{8}
+			table.Padding = 2
+			So(table.WriteText(buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, ""+
+				"    name    count\n"+
+				"       a        1\n"+
+				"  longer  1000000\n")
+		})
+
+		Convey("cells should be truncated to fit the maximum width", func() {
+			table.MaxWidth = 13
+			So(table.WriteText(buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, ""+
+				"  name  count\n"+
+				"     a      1\n"+
+				"longer 10000…\n")
+		})
+
+		Convey("the header should be left out when asked", func() {
+			table.NoHeader = true
+			So(table.WriteText(buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, ""+
+				"     a       1\n"+
+				"longer 1000000\n")
+		})
+
+		Convey("borders should be drawn around the cells", func() {
+			table.Borders = true
+			So(table.WriteText(buf), ShouldBeNil)
+			So(buf.String(), ShouldEqual, ""+
+				"┌────────┬─────────┐\n"+
+				"│   name │   count │\n"+
+				"├────────┼─────────┤\n"+
+				"│      a │       1 │\n"+
+				"│ longer │ 1000000 │\n"+
+				"└────────┴─────────┘\n")
+		})
+
+		Convey("the header should be bold in color", func() {
+			table.Color = true
+			So(table.WriteText(buf), ShouldBeNil)
+			So(buf.String(), ShouldStartWith, "\x1b[1m  name\x1b[0m \x1b[1m  count\x1b[0m\n")
+		})
+
+		Convey("CSV should have the names as the header", func() {
+			So(table.Write(buf, FormatCSV), ShouldBeNil)
+			So(buf.String(), ShouldEqual, "name,count\na,1\nlonger,1000000\n")
+		})
+
+		Convey("JSON should have an object per row", func() {
+			table.AddRow("empty")
+			So(table.Write(buf, FormatJSON), ShouldBeNil)
+			So(buf.String(), ShouldEqual, ""+
+				`{"name":"a","count":"1"}`+"\n"+
+				`{"name":"longer","count":"1000000"}`+"\n"+
+				`{"name":"empty"}`+"\n")
+		})
+
+		Convey("an unknown format should be an error", func() {
+			So(table.Write(buf, "xml"), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Overflow rows should extend past their last column", t, func() {
+		table := NewTable("host", "a", "b")
+		table.AddRow("x", "1", "2")
+		table.AddOverflowRow("y", "connection refused")
+		buf := &bytes.Buffer{}
+
+		So(table.WriteText(buf), ShouldBeNil)
+		So(buf.String(), ShouldEqual, ""+
+			"host a b\n"+
+			"   x 1 2\n"+
+			"   y connection refused\n")
+
+		Convey("and span the following columns within borders", func() {
+			buf.Reset()
+			table.Borders = true
+			table.MaxWidth = 16
+			So(table.WriteText(buf), ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, "│    y │ conn… │\n")
+		})
+	})
+}
@@ -9,6 +9,8 @@ package text
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -29,6 +31,12 @@ func FormatByteAmount(size int64) string {
 	return formatUnitAmount(binary, size, 3, longByteUnits)
 }
 
+// FormatShortByteAmount is equivalent to FormatByteAmount but uses
+// single-letter units, e.g. 12.4G, 0B, 124.5K
+func FormatShortByteAmount(size int64) string {
+	return formatUnitAmount(binary, size, 3, shortByteUnits)
+}
+
 // FormatMegabyteAmount is equivalent to FormatByteAmount but expects
 // an amount of MB instead of bytes.
 func FormatMegabyteAmount(size int64) string {
@@ -42,6 +50,30 @@ func FormatBits(size int64) string {
 	return formatUnitAmount(decimal, size, 3, shortBitUnits)
 }
 
+// ParseByteAmount parses a size in bytes written with an optional unit of
+// FormatByteAmount or FormatShortByteAmount, case insensitively and in
+// powers of 1024, e.g. "1GB", "512m" or "1.5K". Plain numbers are bytes.
+func ParseByteAmount(amount string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(amount))
+	number, multiplier := upper, 1.0
+	for i := len(longByteUnits) - 1; i >= 0; i-- {
+		if long := longByteUnits[i]; strings.HasSuffix(upper, long) {
+			number = upper[:len(upper)-len(long)]
+		} else if short := strings.ToUpper(shortByteUnits[i]); strings.HasSuffix(upper, short) {
+			number = upper[:len(upper)-len(short)]
+		} else {
+			continue
+		}
+		multiplier = math.Pow(binary, float64(i))
+		break
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || value < 0 || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("invalid size '%v', expected a number of bytes with an optional unit, e.g. 1GB or 512MB", amount)
+	}
+	return int64(value * multiplier), nil
+}
+
 // formatUnitAmount formats the size using the units and at least minDigits
 // numbers, unless the number is already less than the base, where no decimal
 // will be added
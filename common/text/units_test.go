@@ -110,3 +110,31 @@ func TestBitFormatPrecision(t *testing.T) {
 		})
 	})
 }
+
+func TestParseByteAmount(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+	Convey("With some sample sizes", t, func() {
+		Convey("sizes with or without units should be parsed in powers of 1024", func() {
+			for amount, expected := range map[string]int64{
+				"0":     0,
+				"100":   100,
+				"12B":   12,
+				"1k":    1024,
+				"1.5KB": 1536,
+				"512M":  512 * 1024 * 1024,
+				" 1GB ": 1024 * 1024 * 1024,
+				"2 gb":  2 * 1024 * 1024 * 1024,
+			} {
+				size, err := ParseByteAmount(amount)
+				So(err, ShouldBeNil)
+				So(size, ShouldEqual, expected)
+			}
+		})
+		Convey("other sizes should be rejected", func() {
+			for _, amount := range []string{"", "GB", "-1MB", "1TB", "ten"} {
+				_, err := ParseByteAmount(amount)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
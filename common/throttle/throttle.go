@@ -0,0 +1,193 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package throttle limits the load the tools put on the server, so that
+// the same throttle options behave the same way in every tool.
+package throttle
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+)
+
+const (
+	// maxBurst is how far a limiter may fall behind its schedule, e.g.
+	// while waiting on the server, before it stops trying to catch up. This
+	// keeps a stall from being followed by an unthrottled burst.
+	maxBurst = time.Second
+
+	// cutRatio is what the rates are multiplied by when operations are
+	// slower than the latency target, but not more often than cutInterval.
+	cutRatio    = 0.5
+	cutInterval = time.Second
+	// minFactor is the smallest fraction of the rates that cuts go down to.
+	minFactor = 0.05
+	// recoveryPerSecond is the fraction of the rates regained every second
+	// after a cut.
+	recoveryPerSecond = 0.05
+)
+
+// Limiter limits the rate of documents and bytes a tool reads or writes,
+// and backs off adaptively while the server's operations take longer than a
+// latency target. It is safe for concurrent use, and a nil *Limiter limits
+// nothing.
+type Limiter struct {
+	mutex sync.Mutex
+
+	docs  *schedule
+	bytes *schedule
+
+	maxLatency time.Duration
+	// factor is the fraction of the rates in effect after the last cut
+	factor  float64
+	lastCut time.Time
+	// pauseUntil holds back operations after a slow one when no rate is set
+	pauseUntil time.Time
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// schedule spaces units, e.g. documents, by a rate.
+type schedule struct {
+	rate float64
+	// next is the earliest time at which the next unit may go
+	next time.Time
+}
+
+// reserve schedules n units at the rate scaled by factor, and returns how
+// long to wait before they may go.
+func (s *schedule) reserve(now time.Time, n int, factor float64) time.Duration {
+	if s.next.IsZero() || now.Sub(s.next) > maxBurst {
+		s.next = now
+	}
+	wait := s.next.Sub(now)
+	s.next = s.next.Add(time.Duration(float64(n) / (s.rate * factor) * float64(time.Second)))
+	return wait
+}
+
+// New returns a Limiter allowing at most docsPerSec documents and
+// bytesPerSec bytes per second, where 0 is no limit, and backing off while
+// operations take longer than maxLatency, if it isn't 0. It returns nil if
+// nothing is limited.
+func New(docsPerSec int, bytesPerSec int64, maxLatency time.Duration) *Limiter {
+	if docsPerSec == 0 && bytesPerSec == 0 && maxLatency == 0 {
+		return nil
+	}
+	l := &Limiter{maxLatency: maxLatency, factor: 1, now: time.Now, sleep: time.Sleep}
+	if docsPerSec > 0 {
+		l.docs = &schedule{rate: float64(docsPerSec)}
+	}
+	if bytesPerSec > 0 {
+		l.bytes = &schedule{rate: float64(bytesPerSec)}
+	}
+	return l
+}
+
+// FromOptions returns the Limiter of the throttle options, or nil if they
+// don't limit anything.
+func FromOptions(opts *options.Throttle) (*Limiter, error) {
+	if opts == nil {
+		return nil, nil
+	}
+	switch {
+	case opts.MaxDocsPerSec < 0:
+		return nil, fmt.Errorf("invalid --maxDocsPerSec %v: must be positive", opts.MaxDocsPerSec)
+	case opts.MaxBytesPerSec < 0:
+		return nil, fmt.Errorf("invalid --maxBytesPerSec %v: must be positive", opts.MaxBytesPerSec)
+	case opts.MaxLatencyMS < 0:
+		return nil, fmt.Errorf("invalid --maxLatencyMS %v: must be positive", opts.MaxLatencyMS)
+	}
+	return New(opts.MaxDocsPerSec, opts.MaxBytesPerSec, time.Duration(opts.MaxLatencyMS)*time.Millisecond), nil
+}
+
+// DocsPerSec returns the configured document rate, or 0 if documents aren't
+// limited.
+func (l *Limiter) DocsPerSec() int {
+	if l == nil || l.docs == nil {
+		return 0
+	}
+	return int(l.docs.rate)
+}
+
+// LimitsBytes returns true if the Limiter limits bytes, so that callers
+// only measure the size of what they send when it is needed.
+func (l *Limiter) LimitsBytes() bool {
+	return l != nil && l.bytes != nil
+}
+
+// Wait blocks until the given number of documents and bytes may be read or
+// written.
+func (l *Limiter) Wait(docs, bytes int) {
+	if l == nil {
+		return
+	}
+	l.mutex.Lock()
+	now := l.now()
+	factor := l.factorAt(now)
+	var wait time.Duration
+	if l.docs != nil && docs > 0 {
+		wait = l.docs.reserve(now, docs, factor)
+	}
+	if l.bytes != nil && bytes > 0 {
+		if w := l.bytes.reserve(now, bytes, factor); w > wait {
+			wait = w
+		}
+	}
+	if w := l.pauseUntil.Sub(now); w > wait {
+		wait = w
+	}
+	l.mutex.Unlock()
+	if wait > 0 {
+		l.sleep(wait)
+	}
+}
+
+// Observe reports how long an operation on the server took. Operations
+// slower than the latency target cut the rates in half, down to a
+// twentieth of them, which then recover gradually; when no rate is set, a
+// slow operation instead holds back the next ones for as long as it
+// overran.
+func (l *Limiter) Observe(latency time.Duration) {
+	if l == nil || l.maxLatency == 0 || latency <= l.maxLatency {
+		return
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := l.now()
+	if l.docs == nil && l.bytes == nil {
+		if until := now.Add(latency - l.maxLatency); until.After(l.pauseUntil) {
+			l.pauseUntil = until
+		}
+		return
+	}
+	if !l.lastCut.IsZero() && now.Sub(l.lastCut) < cutInterval {
+		return
+	}
+	l.factor = l.factorAt(now) * cutRatio
+	if l.factor < minFactor {
+		l.factor = minFactor
+	}
+	l.lastCut = now
+	log.Logvf(log.DebugLow, "an operation took %v, over the %v target: throttling to %.0f%% of the rate",
+		latency, l.maxLatency, l.factor*100)
+}
+
+// factorAt returns the fraction of the rates in effect at the time.
+func (l *Limiter) factorAt(now time.Time) float64 {
+	if l.lastCut.IsZero() {
+		return l.factor
+	}
+	factor := l.factor + recoveryPerSecond*now.Sub(l.lastCut).Seconds()
+	if factor > 1 {
+		factor = 1
+	}
+	return factor
+}
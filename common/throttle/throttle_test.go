@@ -0,0 +1,142 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package throttle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeClock makes a limiter sleep on a fake clock, recording how long.
+func fakeClock(l *Limiter) (now *time.Time, slept *time.Duration) {
+	now, slept = new(time.Time), new(time.Duration)
+	*now = time.Unix(1000, 0)
+	l.now = func() time.Time { return *now }
+	l.sleep = func(d time.Duration) {
+		*slept += d
+		*now = now.Add(d)
+	}
+	return now, slept
+}
+
+func TestLimiter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a document limit on a fake clock", t, func() {
+		limiter := New(4, 0, 0)
+		now, slept := fakeClock(limiter)
+
+		Convey("documents should be spaced by the rate", func() {
+			for i := 0; i < 9; i++ {
+				limiter.Wait(1, 100)
+			}
+			So(*slept, ShouldEqual, 2*time.Second)
+			So(limiter.DocsPerSec(), ShouldEqual, 4)
+			So(limiter.LimitsBytes(), ShouldBeFalse)
+		})
+
+		Convey("a long stall should not be followed by a burst", func() {
+			limiter.Wait(1, 0)
+			*now = now.Add(10 * time.Second)
+			limiter.Wait(1, 0)
+			limiter.Wait(1, 0)
+			So(*slept, ShouldEqual, 250*time.Millisecond)
+		})
+	})
+
+	Convey("With a byte limit on a fake clock", t, func() {
+		limiter := New(0, 1000, 0)
+		_, slept := fakeClock(limiter)
+
+		Convey("documents should be spaced by their size", func() {
+			limiter.Wait(1, 500)
+			limiter.Wait(1, 1500)
+			limiter.Wait(1, 10)
+			So(*slept, ShouldEqual, 2*time.Second)
+			So(limiter.LimitsBytes(), ShouldBeTrue)
+		})
+	})
+
+	Convey("With a rate and a latency target on a fake clock", t, func() {
+		limiter := New(10, 0, 100*time.Millisecond)
+		now, slept := fakeClock(limiter)
+
+		Convey("fast operations should not slow it down", func() {
+			limiter.Observe(50 * time.Millisecond)
+			for i := 0; i < 11; i++ {
+				limiter.Wait(1, 0)
+			}
+			So(*slept, ShouldEqual, time.Second)
+		})
+
+		Convey("slow operations should cut the rate, at most once a second", func() {
+			limiter.Observe(time.Second)
+			limiter.Observe(time.Second)
+			So(limiter.factor, ShouldEqual, 0.5)
+			limiter.Wait(1, 0)
+			limiter.Wait(1, 0)
+			So(*slept, ShouldEqual, 200*time.Millisecond)
+
+			*now = now.Add(time.Second)
+			limiter.Observe(time.Second)
+			So(limiter.factor, ShouldAlmostEqual, 0.28)
+		})
+
+		Convey("the rate should not be cut below the minimum, and should recover", func() {
+			for i := 0; i < 20; i++ {
+				limiter.Observe(time.Second)
+				*now = now.Add(cutInterval)
+			}
+			So(limiter.factor, ShouldAlmostEqual, minFactor, 0.001)
+			*now = now.Add(time.Minute)
+			So(limiter.factorAt(*now), ShouldEqual, 1)
+		})
+	})
+
+	Convey("With only a latency target on a fake clock", t, func() {
+		limiter := New(0, 0, 100*time.Millisecond)
+		_, slept := fakeClock(limiter)
+
+		Convey("a slow operation should hold back the next for its overrun", func() {
+			limiter.Wait(1, 0)
+			limiter.Observe(400 * time.Millisecond)
+			limiter.Wait(1, 0)
+			limiter.Wait(1, 0)
+			So(*slept, ShouldEqual, 300*time.Millisecond)
+		})
+	})
+
+	Convey("A nil limiter should limit nothing", t, func() {
+		var limiter *Limiter
+		limiter.Wait(1, 1000)
+		limiter.Observe(time.Hour)
+		So(limiter.DocsPerSec(), ShouldEqual, 0)
+		So(limiter.LimitsBytes(), ShouldBeFalse)
+	})
+}
+
+func TestFromOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Throttle options should make a limiter", t, func() {
+		limiter, err := FromOptions(&options.Throttle{})
+		So(err, ShouldBeNil)
+		So(limiter, ShouldBeNil)
+
+		limiter, err = FromOptions(&options.Throttle{MaxDocsPerSec: 100, MaxLatencyMS: 250})
+		So(err, ShouldBeNil)
+		So(limiter.DocsPerSec(), ShouldEqual, 100)
+		So(limiter.maxLatency, ShouldEqual, 250*time.Millisecond)
+
+		_, err = FromOptions(&options.Throttle{MaxBytesPerSec: -1})
+		So(err, ShouldNotBeNil)
+	})
+}
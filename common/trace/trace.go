@@ -0,0 +1,345 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+// Package trace exports spans of the tools' operations to an OpenTelemetry
+// collector, with the OTLP/HTTP JSON protocol. Tracing is off until Init is
+// called, and every function and Span method is a no-op while it is off, so
+// that operations can be instrumented unconditionally.
+package trace
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+)
+
+const (
+	// TraceParentEnv is the environment variable a W3C traceparent header is
+	// read from, to make a run part of the trace of whatever invoked it.
+	TraceParentEnv = "TRACEPARENT"
+
+	tracesPath    = "/v1/traces"
+	flushInterval = 5 * time.Second
+	exportTimeout = 10 * time.Second
+	scopeName     = "github.com/mongodb/mongo-tools"
+
+	statusCodeError = 2
+	spanKindClient  = 3
+)
+
+// the tracer of the run, or nil if tracing is off
+var (
+	tracerLock sync.Mutex
+	tracer     *Tracer
+)
+
+// Tracer collects the ended spans of a run and exports them in batches.
+type Tracer struct {
+	endpoint string
+	service  string
+	client   *http.Client
+	traceID  [16]byte
+	root     *Span
+
+	mutex sync.Mutex
+	ended []*Span
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Span is a timed operation of a trace. A nil *Span is valid, and does
+// nothing.
+type Span struct {
+	tracer   *Tracer
+	id       [8]byte
+	parentID [8]byte
+	name     string
+	start    time.Time
+
+	mutex      sync.Mutex
+	end        time.Time
+	attributes []attribute
+	err        error
+}
+
+type attribute struct {
+	key   string
+	value interface{}
+}
+
+// Init turns tracing on, exporting spans to the collector at endpoint under
+// the service name. An endpoint without a path has the standard traces path
+// appended. The run's root span, named after the service, is started, as a
+// child of the span in the TRACEPARENT environment variable if it is set.
+// An empty endpoint leaves tracing off.
+func Init(endpoint, service string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid OpenTelemetry endpoint '%v': expected an http or https URL", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = tracesPath
+	}
+
+	t := &Tracer{
+		endpoint: u.String(),
+		service:  service,
+		client:   &http.Client{Timeout: exportTimeout},
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	var parentID [8]byte
+	if parent := os.Getenv(TraceParentEnv); parent != "" {
+		if t.traceID, parentID, err = parseTraceParent(parent); err != nil {
+			log.Logvf(log.Always, "ignoring %v: %v", TraceParentEnv, err)
+		}
+	}
+	if t.traceID == [16]byte{} {
+		randomID(t.traceID[:])
+	}
+	t.root = t.newSpan(service, parentID)
+
+	tracerLock.Lock()
+	tracer = t
+	tracerLock.Unlock()
+	go t.flushLoop()
+	return nil
+}
+
+// Shutdown ends the root span, with err as the outcome of the run, exports
+// every span not exported yet and turns tracing off.
+func Shutdown(err error) {
+	tracerLock.Lock()
+	t := tracer
+	tracer = nil
+	tracerLock.Unlock()
+	if t == nil {
+		return
+	}
+	t.root.End(err)
+	close(t.stop)
+	<-t.done
+	t.flush()
+}
+
+// Start starts a span as a child of the run's root span. It returns nil if
+// tracing is off.
+func Start(name string) *Span {
+	tracerLock.Lock()
+	t := tracer
+	tracerLock.Unlock()
+	if t == nil {
+		return nil
+	}
+	return t.root.Start(name)
+}
+
+// Start starts a span as a child of s.
+func (s *Span) Start(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	return s.tracer.newSpan(name, s.id)
+}
+
+// SetAttribute records a string, boolean, integer or floating point value
+// of the span's operation. Other values are recorded as strings.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	s.attributes = append(s.attributes, attribute{key, value})
+	s.mutex.Unlock()
+}
+
+// End ends the span, with err as the outcome of its operation. Only the
+// first call has an effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	if !s.end.IsZero() {
+		s.mutex.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.err = err
+	s.mutex.Unlock()
+
+	s.tracer.mutex.Lock()
+	s.tracer.ended = append(s.tracer.ended, s)
+	s.tracer.mutex.Unlock()
+}
+
+func (t *Tracer) newSpan(name string, parentID [8]byte) *Span {
+	s := &Span{tracer: t, parentID: parentID, name: name, start: time.Now()}
+	randomID(s.id[:])
+	return s
+}
+
+func (t *Tracer) flushLoop() {
+	defer close(t.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.flush()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+// flush exports the spans ended since the last flush. Export failures are
+// logged, and never fail the run.
+func (t *Tracer) flush() {
+	t.mutex.Lock()
+	spans := t.ended
+	t.ended = nil
+	t.mutex.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.export(spans); err != nil {
+		log.Logvf(log.Always, "error exporting %v trace spans: %v", len(spans), err)
+	}
+}
+
+func (t *Tracer) export(spans []*Span) error {
+	payload, err := json.Marshal(t.request(spans))
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector responded with %v", resp.Status)
+	}
+	return nil
+}
+
+// request returns the body of an OTLP export request of the spans.
+func (t *Tracer) request(spans []*Span) map[string]interface{} {
+	encoded := make([]interface{}, 0, len(spans))
+	for _, s := range spans {
+		encoded = append(encoded, t.encodeSpan(s))
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": encodeAttributes([]attribute{{"service.name", t.service}}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": scopeName},
+						"spans": encoded,
+					},
+				},
+			},
+		},
+	}
+}
+
+func (t *Tracer) encodeSpan(s *Span) map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	encoded := map[string]interface{}{
+		"traceId":           hex.EncodeToString(t.traceID[:]),
+		"spanId":            hex.EncodeToString(s.id[:]),
+		"name":              s.name,
+		"kind":              spanKindClient,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        encodeAttributes(s.attributes),
+	}
+	if s.parentID != [8]byte{} {
+		encoded["parentSpanId"] = hex.EncodeToString(s.parentID[:])
+	}
+	if s.err != nil {
+		encoded["status"] = map[string]interface{}{
+			"code":    statusCodeError,
+			"message": s.err.Error(),
+		}
+	}
+	return encoded
+}
+
+func encodeAttributes(attributes []attribute) []interface{} {
+	encoded := make([]interface{}, 0, len(attributes))
+	for _, a := range attributes {
+		var value map[string]interface{}
+		switch v := a.value.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		case int:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+		case int32:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		encoded = append(encoded, map[string]interface{}{"key": a.key, "value": value})
+	}
+	return encoded
+}
+
+// parseTraceParent returns the trace and parent span ids of a W3C
+// traceparent header, "<version>-<trace id>-<span id>-<flags>".
+func parseTraceParent(header string) (traceID [16]byte, spanID [8]byte, err error) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceID, spanID, fmt.Errorf("invalid traceparent '%v'", header)
+	}
+	if _, err = hex.Decode(traceID[:], []byte(parts[1])); err != nil {
+		return [16]byte{}, [8]byte{}, fmt.Errorf("invalid trace id in traceparent '%v'", header)
+	}
+	if _, err = hex.Decode(spanID[:], []byte(parts[2])); err != nil {
+		return [16]byte{}, [8]byte{}, fmt.Errorf("invalid span id in traceparent '%v'", header)
+	}
+	if traceID == [16]byte{} || spanID == [8]byte{} {
+		return [16]byte{}, [8]byte{}, fmt.Errorf("invalid all-zero id in traceparent '%v'", header)
+	}
+	return traceID, spanID, nil
+}
+
+func randomID(id []byte) {
+	// crypto/rand only fails if the system has no source of randomness, in
+	// which case the clock keeps the ids distinct enough to be useful
+	if _, err := rand.Read(id); err != nil {
+		now := uint64(time.Now().UnixNano())
+		for i := range id {
+			id[i] = byte(now >> uint(8*(i%8)))
+		}
+	}
+}
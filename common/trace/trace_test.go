@@ -0,0 +1,175 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Start        string `json:"startTimeUnixNano"`
+	End          string `json:"endTimeUnixNano"`
+	Attributes   []struct {
+		Key   string                 `json:"key"`
+		Value map[string]interface{} `json:"value"`
+	} `json:"attributes"`
+	Status *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+type exportRequest struct {
+	ResourceSpans []struct {
+		Resource struct {
+			Attributes []struct {
+				Key   string                 `json:"key"`
+				Value map[string]interface{} `json:"value"`
+			} `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []struct {
+			Spans []exportedSpan `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
+
+// collector is a test OTLP endpoint that records the spans exported to it.
+type collector struct {
+	mutex    sync.Mutex
+	paths    []string
+	services []string
+	spans    map[string]exportedSpan
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var request exportRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.paths = append(c.paths, r.URL.Path)
+	for _, resourceSpans := range request.ResourceSpans {
+		for _, attribute := range resourceSpans.Resource.Attributes {
+			if attribute.Key == "service.name" {
+				c.services = append(c.services, fmt.Sprint(attribute.Value["stringValue"]))
+			}
+		}
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				c.spans[span.Name] = span
+			}
+		}
+	}
+}
+
+func TestTracing(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an OTLP collector", t, func() {
+		c := &collector{spans: map[string]exportedSpan{}}
+		server := httptest.NewServer(c)
+		defer server.Close()
+		os.Unsetenv(TraceParentEnv)
+
+		Convey("spans should be exported with their parents, attributes and status", func() {
+			So(Init(server.URL, "mongotest"), ShouldBeNil)
+			span := Start("dump collection")
+			span.SetAttribute("db.namespace", "test.c")
+			span.SetAttribute("documents", 42)
+			span.SetAttribute("capped", true)
+			child := span.Start("batch insert")
+			child.End(fmt.Errorf("bulk write failed"))
+			span.End(nil)
+			Shutdown(nil)
+
+			So(c.paths, ShouldResemble, []string{"/v1/traces"})
+			So(c.services, ShouldResemble, []string{"mongotest"})
+			So(len(c.spans), ShouldEqual, 3)
+			root := c.spans["mongotest"]
+			dump := c.spans["dump collection"]
+			insert := c.spans["batch insert"]
+			So(root.ParentSpanID, ShouldEqual, "")
+			So(dump.ParentSpanID, ShouldEqual, root.SpanID)
+			So(insert.ParentSpanID, ShouldEqual, dump.SpanID)
+			So(insert.TraceID, ShouldEqual, root.TraceID)
+			So(len(root.TraceID), ShouldEqual, 32)
+			So(len(dump.SpanID), ShouldEqual, 16)
+			So(dump.End >= dump.Start, ShouldBeTrue)
+
+			So(len(dump.Attributes), ShouldEqual, 3)
+			So(dump.Attributes[0].Value["stringValue"], ShouldEqual, "test.c")
+			So(dump.Attributes[1].Value["intValue"], ShouldEqual, "42")
+			So(dump.Attributes[2].Value["boolValue"], ShouldEqual, true)
+			So(dump.Status, ShouldBeNil)
+			So(insert.Status.Code, ShouldEqual, statusCodeError)
+			So(insert.Status.Message, ShouldEqual, "bulk write failed")
+		})
+
+		Convey("a TRACEPARENT should make the run part of its trace", func() {
+			os.Setenv(TraceParentEnv, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+			defer os.Unsetenv(TraceParentEnv)
+			So(Init(server.URL+"/custom/path", "mongotest"), ShouldBeNil)
+			Shutdown(nil)
+
+			So(c.paths, ShouldResemble, []string{"/custom/path"})
+			root := c.spans["mongotest"]
+			So(root.TraceID, ShouldEqual, "0af7651916cd43dd8448eb211c80319c")
+			So(root.ParentSpanID, ShouldEqual, "b7ad6b7169203331")
+		})
+
+		Convey("an invalid endpoint should be an error", func() {
+			So(Init("localhost:4318", "mongotest"), ShouldNotBeNil)
+			So(Init("ftp://localhost", "mongotest"), ShouldNotBeNil)
+		})
+	})
+
+	Convey("With tracing off, spans should do nothing", t, func() {
+		So(Init("", "mongotest"), ShouldBeNil)
+		span := Start("dump collection")
+		So(span, ShouldBeNil)
+		span.SetAttribute("documents", 1)
+		So(span.Start("child"), ShouldBeNil)
+		span.End(nil)
+		Shutdown(nil)
+	})
+}
+
+func TestParseTraceParent(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When parsing traceparent headers", t, func() {
+		Convey("malformed headers should be errors", func() {
+			for _, header := range []string{
+				"",
+				"00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331",
+				"00-0af7651916cd43dd-b7ad6b7169203331-01",
+				"00-zzf7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+				"00-00000000000000000000000000000000-b7ad6b7169203331-01",
+			} {
+				_, _, err := parseTraceParent(header)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
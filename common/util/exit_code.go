@@ -15,6 +15,19 @@ const (
 	ExitClean      int = 0
 	ExitBadOptions int = 3
 	ExitKill       int = 4
+	// ExitInterrupted is the exit code of a tool stopped by a signal after
+	// finishing the work in flight and saving its progress; ExitKill is used
+	// when a second signal cuts that short.
+	ExitInterrupted int = 5
+	// ExitConnection is the exit code of a tool that couldn't reach the
+	// server, or lost its connection to it.
+	ExitConnection int = 6
+	// ExitAuth is the exit code of a tool that failed to authenticate, or
+	// wasn't authorized to run an operation.
+	ExitAuth int = 7
+	// ExitPartialData is the exit code of a tool that stopped after writing
+	// some of the data, but not all of it.
+	ExitPartialData int = 8
 	// Go reserves exit code 2 for its own use
 )
 
@@ -0,0 +1,93 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MinPollInterval is the shortest polling interval the monitoring tools accept.
+const MinPollInterval = 10 * time.Millisecond
+
+// ParseInterval parses a polling interval given either as a number of
+// seconds, which may be fractional, e.g. "0.25", or as a duration with a
+// unit, e.g. "250ms".
+func ParseInterval(arg string) (time.Duration, error) {
+	var interval time.Duration
+	if seconds, err := strconv.ParseFloat(arg, 64); err == nil {
+		interval = time.Duration(seconds * float64(time.Second))
+	} else if interval, err = time.ParseDuration(arg); err != nil {
+		return 0, fmt.Errorf("invalid interval '%v', expected seconds or a duration such as '250ms'", arg)
+	}
+	if interval < MinPollInterval {
+		return 0, fmt.Errorf("interval must be at least %v", MinPollInterval)
+	}
+	return interval, nil
+}
+
+// BatchWriter buffers writes and passes them on periodically, so that output
+// produced many times a second is rendered in batches.
+type BatchWriter struct {
+	out  io.Writer
+	buf  bytes.Buffer
+	lock sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBatchWriter returns a BatchWriter that flushes to out every period.
+func NewBatchWriter(out io.Writer, period time.Duration) *BatchWriter {
+	bw := &BatchWriter{
+		out:  out,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(bw.done)
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				bw.Flush()
+			case <-bw.stop:
+				return
+			}
+		}
+	}()
+	return bw
+}
+
+// Write buffers p until the next flush.
+func (bw *BatchWriter) Write(p []byte) (int, error) {
+	bw.lock.Lock()
+	defer bw.lock.Unlock()
+	return bw.buf.Write(p)
+}
+
+// Flush writes out everything buffered so far.
+func (bw *BatchWriter) Flush() error {
+	bw.lock.Lock()
+	defer bw.lock.Unlock()
+	if bw.buf.Len() == 0 {
+		return nil
+	}
+	_, err := bw.buf.WriteTo(bw.out)
+	return err
+}
+
+// Close stops the periodic flushing and flushes any remaining output.
+func (bw *BatchWriter) Close() error {
+	close(bw.stop)
+	<-bw.done
+	return bw.Flush()
+}
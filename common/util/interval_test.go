@@ -0,0 +1,67 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package util
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseInterval(t *testing.T) {
+
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When parsing a polling interval", t, func() {
+
+		Convey("whole and fractional seconds should be accepted", func() {
+			interval, err := ParseInterval("5")
+			So(err, ShouldBeNil)
+			So(interval, ShouldEqual, 5*time.Second)
+
+			interval, err = ParseInterval("0.25")
+			So(err, ShouldBeNil)
+			So(interval, ShouldEqual, 250*time.Millisecond)
+		})
+
+		Convey("durations with units should be accepted", func() {
+			interval, err := ParseInterval("250ms")
+			So(err, ShouldBeNil)
+			So(interval, ShouldEqual, 250*time.Millisecond)
+
+			interval, err = ParseInterval("1m")
+			So(err, ShouldBeNil)
+			So(interval, ShouldEqual, time.Minute)
+		})
+
+		Convey("invalid and too short intervals should be rejected", func() {
+			for _, arg := range []string{"", "fast", "0", "-1", "1ms", "0.001"} {
+				_, err := ParseInterval(arg)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestBatchWriter(t *testing.T) {
+
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A BatchWriter should hold output until it is flushed", t, func() {
+		out := &bytes.Buffer{}
+		bw := NewBatchWriter(out, time.Hour)
+		bw.Write([]byte("one\n"))
+		bw.Write([]byte("two\n"))
+		So(out.String(), ShouldEqual, "")
+
+		So(bw.Close(), ShouldBeNil)
+		So(out.String(), ShouldEqual, "one\ntwo\n")
+	})
+}
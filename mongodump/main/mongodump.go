@@ -8,13 +8,17 @@
 package main
 
 import (
+	"io"
 	"os"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/diagnose"
+	"github.com/mongodb/mongo-tools/common/failure"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/signals"
+	"github.com/mongodb/mongo-tools/common/trace"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongodump"
 )
@@ -32,6 +36,12 @@ func main() {
 	opts.AddOptions(inputOpts)
 	outputOpts := &mongodump.OutputOptions{}
 	opts.AddOptions(outputOpts)
+	encryptionOpts := &options.Encryption{}
+	opts.AddOptions(encryptionOpts)
+	throttleOpts := &options.Throttle{}
+	opts.AddOptions(throttleOpts)
+	tracingOpts := &options.Tracing{}
+	opts.AddOptions(tracingOpts)
 	opts.URI.AddKnownURIParameters(options.KnownURIOptionsReadPreference)
 
 	args, err := opts.ParseArgs(os.Args[1:])
@@ -59,20 +69,53 @@ func main() {
 
 	// init logger
 	log.SetVerbosity(opts.Verbosity)
+	log.SetFormat(opts.LogFormat, opts.AppName)
 
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
+	// test connecting to the server step by step, if specified
+	if opts.Diagnose {
+		os.Exit(diagnose.Run(opts, os.Stdout))
+	}
+
+	if err = trace.Init(tracingOpts.OTelEndpoint, opts.AppName); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		log.Logvf(log.Always, "try 'mongodump --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+
 	// kick off the progress bar manager
-	progressManager := progress.NewBarWriter(log.Writer(0), progressBarWaitTime, progressBarLength, false)
-	progressManager.Start()
-	defer progressManager.Stop()
+	// draw the bars in place on a terminal, unless the log is JSON
+	var terminal io.Writer
+	if opts.LogFormat != log.JSONFormat {
+		terminal = progress.Terminal()
+	}
+	barWriter := progress.NewMultiBarWriter(log.Writer(0), terminal, progressBarWaitTime, progressBarLength, false)
+	barWriter.Start()
+	defer barWriter.Stop()
+
+	// write progress events as well, if asked to
+	var progressManager progress.Manager = barWriter
+	eventWriter, err := progress.OpenEventWriter(opts.ProgressFD, opts.ProgressSocket, opts.AppName, progressBarWaitTime, false)
+	if err != nil {
+		log.Logvf(log.Always, "error opening progress event stream: %v", err)
+		trace.Shutdown(err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if eventWriter != nil {
+		eventWriter.Start()
+		defer eventWriter.Stop()
+		progressManager = progress.Managers{barWriter, eventWriter}
+	}
 
 	dump := mongodump.MongoDump{
-		ToolOptions:     opts,
-		OutputOptions:   outputOpts,
-		InputOptions:    inputOpts,
-		ProgressManager: progressManager,
+		ToolOptions:       opts,
+		OutputOptions:     outputOpts,
+		InputOptions:      inputOpts,
+		EncryptionOptions: encryptionOpts,
+		ThrottleOptions:   throttleOpts,
+		ProgressManager:   progressManager,
 	}
 
 	finishedChan := signals.HandleWithInterrupt(dump.HandleInterrupt)
@@ -80,14 +123,16 @@ func main() {
 
 	if err = dump.Init(); err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		eventWriter.StopWithError(err)
+		os.Exit(failure.ExitCode(err))
 	}
 
 	if err = dump.Dump(); err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		if err == util.ErrTerminated {
-			os.Exit(util.ExitKill)
-		}
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		eventWriter.StopWithError(err)
+		os.Exit(failure.ExitCode(err))
 	}
+	trace.Shutdown(nil)
 }
@@ -12,12 +12,17 @@ import (
 	"github.com/mongodb/mongo-tools/common/auth"
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/db/csfle"
 	"github.com/mongodb/mongo-tools/common/failpoint"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/manifest"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/storage"
+	"github.com/mongodb/mongo-tools/common/throttle"
+	"github.com/mongodb/mongo-tools/common/trace"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -41,6 +46,10 @@ type MongoDump struct {
 	ToolOptions   *options.ToolOptions
 	InputOptions  *InputOptions
 	OutputOptions *OutputOptions
+	// decrypts encrypted fields if enabled
+	EncryptionOptions *options.Encryption
+	// limits the rate at which documents are read
+	ThrottleOptions *options.Throttle
 
 	// Skip dumping users and roles, regardless of namespace, when true.
 	SkipUsersAndRoles bool
@@ -57,6 +66,8 @@ type MongoDump struct {
 	isMongos        bool
 	authVersion     int
 	archive         *archive.Writer
+	// archiveUpload is the upload of an archive written to cloud storage
+	archiveUpload storage.Writer
 	// shutdownIntentsNotifier is provided to the multiplexer
 	// as well as the signal handler, and allows them to notify
 	// the intent dumpers that they should shutdown
@@ -66,6 +77,11 @@ type MongoDump struct {
 	OutputWriter io.Writer
 	readPrefMode mgo.Mode
 	readPrefTags []bson.D
+	encryption   *csfle.Client
+	limiter      *throttle.Limiter
+	// manifest records the sizes and checksums of the files of a dump to a
+	// directory
+	manifest *manifest.Manifest
 }
 
 type notifier struct {
@@ -90,8 +106,8 @@ func (dump *MongoDump) ValidateOptions() error {
 		return fmt.Errorf("cannot dump using a queryFile without a specified collection")
 	case dump.InputOptions.Query != "" && dump.InputOptions.QueryFile != "":
 		return fmt.Errorf("either query or queryFile can be specified as a query option, not both")
-	case dump.InputOptions.Query != "" && dump.InputOptions.TableScan:
-		return fmt.Errorf("cannot use --forceTableScan when specifying --query")
+	case dump.InputOptions.HasQuery() && dump.InputOptions.TableScan:
+		return fmt.Errorf("cannot use --forceTableScan when specifying --query or --queryFile")
 	case dump.OutputOptions.DumpDBUsersAndRoles && dump.ToolOptions.Namespace.DB == "":
 		return fmt.Errorf("must specify a database when running with dumpDbUsersAndRoles")
 	case dump.OutputOptions.DumpDBUsersAndRoles && dump.ToolOptions.Namespace.Collection != "":
@@ -126,6 +142,10 @@ func (dump *MongoDump) Init() error {
 	if err != nil {
 		return fmt.Errorf("bad option: %v", err)
 	}
+	dump.limiter, err = throttle.FromOptions(dump.ThrottleOptions)
+	if err != nil {
+		return fmt.Errorf("bad option: %v", err)
+	}
 	if dump.OutputWriter == nil {
 		dump.OutputWriter = os.Stdout
 	}
@@ -161,6 +181,11 @@ func (dump *MongoDump) Init() error {
 		if len(tags) > 0 {
 			dump.SessionProvider.SetTags(tags)
 		}
+		readPrefOptions, err := db.ParseReadPreferenceOptions(dump.InputOptions.ReadPreference)
+		if err != nil {
+			return fmt.Errorf("error parsing --readPreference : %v", err)
+		}
+		dump.SessionProvider.SetReadPreferenceOptions(readPrefOptions)
 	}
 
 	// warn if we are trying to dump from a secondary in a sharded cluster
@@ -177,6 +202,14 @@ func (dump *MongoDump) Init() error {
 		return fmt.Errorf("--repair flag cannot be used on a mongos")
 	}
 
+	dump.encryption, err = csfle.New(dump.SessionProvider, dump.EncryptionOptions)
+	if err != nil {
+		return err
+	}
+	if dump.encryption != nil {
+		log.Logvf(log.Always, "decrypting encrypted fields: the dump will hold their plaintext")
+	}
+
 	dump.manager = intents.NewIntentManager()
 	return nil
 }
@@ -244,7 +277,12 @@ func (dump *MongoDump) Dump() (err error) {
 			// The Mux runs until its Control is closed
 			close(dump.archive.Mux.Control)
 			muxErr := <-dump.archive.Mux.Completed
-			archiveOut.Close()
+			if dump.archiveUpload != nil && (err != nil || muxErr != nil) {
+				// don't leave a partial archive behind in cloud storage
+				dump.archiveUpload.Abort()
+			} else if closeErr := archiveOut.Close(); closeErr != nil && muxErr == nil {
+				muxErr = closeErr
+			}
 			if muxErr != nil {
 				if err != nil {
 					err = fmt.Errorf("archive writer: %v / %v", err, muxErr)
@@ -258,6 +296,10 @@ func (dump *MongoDump) Dump() (err error) {
 		}()
 	}
 
+	if dump.OutputOptions.Archive == "" && dump.OutputOptions.Out != "-" {
+		dump.manifest = manifest.New(dump.outputPath("", ""))
+	}
+
 	// switch on what kind of execution to do
 	switch {
 	case dump.ToolOptions.DB == "" && dump.ToolOptions.Collection == "":
@@ -442,11 +484,31 @@ func (dump *MongoDump) Dump() (err error) {
 		log.Logvf(log.DebugHigh, "oplog entry %v still exists", dump.oplogStart)
 	}
 
+	if dump.manifest != nil {
+		if err = dump.writeManifest(); err != nil {
+			return err
+		}
+	}
+
 	log.Logvf(log.DebugLow, "finishing dump")
 
 	return err
 }
 
+// writeManifest writes the checksum manifest of the dump directory. The
+// entries of files of an earlier dump to the same directory that this one
+// didn't write are kept.
+func (dump *MongoDump) writeManifest() error {
+	previous, err := manifest.Read(dump.manifest.Dir())
+	if err == nil {
+		dump.manifest.Merge(previous)
+	} else if !os.IsNotExist(err) {
+		log.Logvf(log.Always, "replacing checksum manifest: %v", err)
+	}
+	log.Logvf(log.Always, "writing checksum manifest to %v", filepath.Join(dump.manifest.Dir(), manifest.FileName))
+	return dump.manifest.Write()
+}
+
 type resettableOutputBuffer interface {
 	io.Writer
 	Close() error
@@ -523,7 +585,11 @@ func (dump *MongoDump) DumpIntents() error {
 }
 
 // DumpIntent dumps the specified database's collection.
-func (dump *MongoDump) DumpIntent(intent *intents.Intent, buffer resettableOutputBuffer) error {
+func (dump *MongoDump) DumpIntent(intent *intents.Intent, buffer resettableOutputBuffer) (err error) {
+	span := trace.Start("dump collection")
+	span.SetAttribute("db.namespace", intent.Namespace())
+	defer func() { span.End(err) }()
+
 	session, err := dump.SessionProvider.GetSession()
 	if err != nil {
 		return err
@@ -605,6 +671,9 @@ func copyDocumentFilter(in []byte) ([]byte, error) {
 // dumped, and any errors that occurred.
 func (dump *MongoDump) dumpQueryToIntent(
 	query *mgo.Query, intent *intents.Intent, buffer resettableOutputBuffer) (dumpCount int64, err error) {
+	if dump.encryption != nil {
+		return dump.dumpFilteredQueryToIntent(query, intent, buffer, dump.encryption.DecryptRaw)
+	}
 	return dump.dumpFilteredQueryToIntent(query, intent, buffer, copyDocumentFilter)
 }
 
@@ -645,7 +714,7 @@ func (dump *MongoDump) dumpFilteredQueryToIntent(
 	dumpProgressor := progress.NewCounter(int64(total))
 	if dump.ProgressManager != nil {
 		dump.ProgressManager.Attach(intent.Namespace(), dumpProgressor)
-		defer dump.ProgressManager.Detach(intent.Namespace())
+		defer func() { progress.Finish(dump.ProgressManager, intent.Namespace(), err) }()
 	}
 
 	var f io.Writer
@@ -680,56 +749,44 @@ func (dump *MongoDump) dumpIterToWriter(
 // a counter, and filters and dumps the iterator's contents to the writer.
 func (dump *MongoDump) dumpFilteredIterToWriter(
 	iter *mgo.Iter, writer io.Writer, progressCount progress.Updateable, filter documentFilter) error {
-	var termErr error
-
-	// We run the result iteration in its own goroutine,
-	// this allows disk i/o to not block reads from the db,
-	// which gives a slight speedup on benchmarks
-	buffChan := make(chan []byte)
-	go func() {
-		for {
-			select {
-			case <-dump.shutdownIntentsNotifier.notified:
-				log.Logvf(log.DebugHigh, "terminating writes")
-				termErr = util.ErrTerminated
-				close(buffChan)
-				return
-			default:
-				raw := &bson.Raw{}
-				next := iter.Next(raw)
-				if !next {
-					// we check the iterator for errors below
-					close(buffChan)
-					return
-				}
-				out, err := filter(raw.Data)
-				if err != nil {
-					termErr = err
-					close(buffChan)
-					return
-				}
-				buffChan <- out
-			}
-		}
-	}()
+	// The documents are read from the db in their own goroutine, up to a
+	// batch ahead, so disk i/o doesn't block reads from the db and the next
+	// batch is fetched while the current one is written. When reads are
+	// throttled, only a document is read ahead of the throttle
+	prefetch := db.DefaultPrefetchSize
+	if dump.limiter != nil {
+		prefetch = 1
+	}
+	cursor := db.NewPrefetchingIter(iter, prefetch, dump.limiter)
+	defer cursor.Close()
 
 	// while there are still results in the database,
 	// grab results from the goroutine and write them to filesystem
 	for {
-		buff, alive := <-buffChan
-		if !alive {
-			if iter.Err() != nil {
-				return fmt.Errorf("error reading collection: %v", iter.Err())
+		select {
+		case <-dump.shutdownIntentsNotifier.notified:
+			log.Logvf(log.DebugHigh, "terminating writes")
+			return util.ErrTerminated
+		default:
+		}
+		raw := bson.Raw{}
+		if !cursor.Next(&raw) {
+			if cursor.Err() != nil {
+				return fmt.Errorf("error reading collection: %v", cursor.Err())
 			}
-			break
+			return nil
 		}
-		_, err := writer.Write(buff)
+		dump.limiter.Wait(1, len(raw.Data))
+		buff, err := filter(raw.Data)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(buff)
 		if err != nil {
 			return fmt.Errorf("error writing to file: %v", err)
 		}
 		progressCount.Inc(1)
 	}
-	return termErr
 }
 
 // DumpUsersAndRolesForDB queries and dumps the users and roles tied to the given
@@ -832,6 +889,11 @@ func (*nopCloseWriter) Close() error {
 func (dump *MongoDump) getArchiveOut() (out io.WriteCloser, err error) {
 	if dump.OutputOptions.Archive == "-" {
 		out = &nopCloseWriter{dump.OutputWriter}
+	} else if storage.IsURL(dump.OutputOptions.Archive) {
+		if dump.archiveUpload, err = storage.Create(dump.OutputOptions.Archive); err != nil {
+			return nil, err
+		}
+		out = dump.archiveUpload
 	} else {
 		targetStat, err := os.Stat(dump.OutputOptions.Archive)
 		if err == nil && targetStat.IsDir() {
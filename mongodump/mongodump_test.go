@@ -21,6 +21,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/manifest"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/testtype"
 	"github.com/mongodb/mongo-tools/common/testutil"
@@ -458,6 +459,12 @@ func TestMongoDumpBSON(t *testing.T) {
 					So(err, ShouldBeNil)
 					So(countColls, ShouldEqual, 1)
 
+					m, err := manifest.Read(dumpDir)
+					So(err, ShouldBeNil)
+					problems, err := m.Verify(testDB)
+					So(err, ShouldBeNil)
+					So(problems, ShouldBeEmpty)
+
 					collOriginal := session.DB(testDB).C(testCollectionNames[0])
 					collRestore := session.DB(testRestoreDB).C(testCollectionNames[0])
 
@@ -12,6 +12,7 @@ import (
 
 	"fmt"
 	"io/ioutil"
+	"os"
 )
 
 var Usage = `<options>
@@ -24,9 +25,9 @@ See http://docs.mongodb.org/manual/reference/program/mongodump/ for more informa
 
 // InputOptions defines the set of options to use in retrieving data from the server.
 type InputOptions struct {
-	Query          string `long:"query" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
-	QueryFile      string `long:"queryFile" description:"path to a file containing a query filter (JSON)"`
-	ReadPreference string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference name or a preference json object"`
+	Query          string `long:"query" value-name:"<json>" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
+	QueryFile      string `long:"queryFile" value-name:"<filename>" description:"path to a file containing a query filter (JSON), or '-' to read it from stdin"`
+	ReadPreference string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference name or a preference json object, which may set maxStalenessSeconds and hedge, e.g. '{mode: \"nearest\", maxStalenessSeconds: 120, hedge: {enabled: true}}'"`
 	TableScan      bool   `long:"forceTableScan" description:"force a table scan"`
 }
 
@@ -40,6 +41,13 @@ func (inputOpts *InputOptions) SetOptionsFromURI(cs connstring.ConnString) error
 		return fmt.Errorf(options.IncompatibleArgsErrorFormat, "--readPreference")
 	}
 	inputOpts.ReadPreference = cs.ReadPreference
+	if cs.MaxStalenessSeconds > 0 {
+		mode := cs.ReadPreference
+		if mode == "" {
+			mode = "primary"
+		}
+		inputOpts.ReadPreference = fmt.Sprintf(`{"mode": %q, "maxStalenessSeconds": %v}`, mode, cs.MaxStalenessSeconds)
+	}
 	return nil
 }
 
@@ -50,6 +58,12 @@ func (inputOptions *InputOptions) HasQuery() bool {
 func (inputOptions *InputOptions) GetQuery() ([]byte, error) {
 	if inputOptions.Query != "" {
 		return []byte(inputOptions.Query), nil
+	} else if inputOptions.QueryFile == "-" {
+		content, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			err = fmt.Errorf("error reading query from stdin: %s", err)
+		}
+		return content, err
 	} else if inputOptions.QueryFile != "" {
 		content, err := ioutil.ReadFile(inputOptions.QueryFile)
 		if err != nil {
@@ -66,7 +80,7 @@ type OutputOptions struct {
 	Gzip                       bool     `long:"gzip" description:"compress archive our collection output with Gzip"`
 	Repair                     bool     `long:"repair" description:"try to recover documents from damaged data files (not supported by all storage engines)"`
 	Oplog                      bool     `long:"oplog" description:"use oplog for taking a point-in-time snapshot"`
-	Archive                    string   `long:"archive" value-name:"<file-path>" optional:"true" optional-value:"-" description:"dump as an archive to the specified path. If flag is specified without a value, archive is written to stdout"`
+	Archive                    string   `long:"archive" value-name:"<file-path>" optional:"true" optional-value:"-" description:"dump as an archive to the specified path, or to an s3://, gs:// or az:// URL of an object in cloud storage. If flag is specified without a value, archive is written to stdout"`
 	DumpDBUsersAndRoles        bool     `long:"dumpDbUsersAndRoles" description:"dump user and role definitions for the specified database"`
 	ExcludedCollections        []string `long:"excludeCollection" value-name:"<collection-name>" description:"collection to exclude from the dump (may be specified multiple times to exclude additional collections)"`
 	ExcludedCollectionPrefixes []string `long:"excludeCollectionsWithPrefix" value-name:"<collection-prefix>" description:"exclude all collections from the dump that have the given prefix (may be specified multiple times to exclude additional prefixes)"`
@@ -18,6 +18,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/manifest"
 )
 
 type NilPos struct{}
@@ -60,6 +61,8 @@ type realBSONFile struct {
 	// intent.file ( a ReadWriteOpenCloser )
 	errorReader
 	intent *intents.Intent
+	// manifest, if set, records the checksum of the file
+	manifest *manifest.Manifest
 	NilPos
 }
 
@@ -82,7 +85,7 @@ func (f *realBSONFile) Open() (err error) {
 		return fmt.Errorf("error creating BSON file %v: %v", f.path, err)
 	}
 
-	return nil
+	return trackFile(f.manifest, f.path, &f.WriteCloser)
 }
 
 // realMetadataFile implements intent.file, and corresponds to a Metadata file on disk
@@ -93,6 +96,8 @@ type realMetadataFile struct {
 	// errorWrite adds a Read() method to this object allowing it to be an
 	// intent.file ( a ReadWriteOpenCloser )
 	intent *intents.Intent
+	// manifest, if set, records the checksum of the file
+	manifest *manifest.Manifest
 	NilPos
 }
 
@@ -111,6 +116,20 @@ func (f *realMetadataFile) Open() (err error) {
 	if err != nil {
 		return fmt.Errorf("error creating metadata file %v: %v", f.path, err)
 	}
+	return trackFile(f.manifest, f.path, &f.WriteCloser)
+}
+
+// trackFile makes the manifest, if any, record the checksum of the file at
+// path, as it is written to w.
+func trackFile(m *manifest.Manifest, path string, w *io.WriteCloser) error {
+	if m == nil {
+		return nil
+	}
+	relative, err := m.Relative(path)
+	if err != nil {
+		return fmt.Errorf("error adding %v to the checksum manifest: %v", path, err)
+	}
+	*w = m.Track(relative, *w)
 	return nil
 }
 
@@ -219,7 +238,7 @@ func (dump *MongoDump) CreateOplogIntents() error {
 	if dump.OutputOptions.Archive != "" {
 		oplogIntent.BSONFile = &archive.MuxIn{Mux: dump.archive.Mux, Intent: oplogIntent}
 	} else {
-		oplogIntent.BSONFile = &realBSONFile{path: dump.outputPath("oplog.bson", ""), intent: oplogIntent}
+		oplogIntent.BSONFile = &realBSONFile{path: dump.outputPath("oplog.bson", ""), intent: oplogIntent, manifest: dump.manifest}
 	}
 	dump.manager.Put(oplogIntent)
 	return nil
@@ -249,9 +268,9 @@ func (dump *MongoDump) CreateUsersRolesVersionIntentsForDB(db string) error {
 		rolesIntent.BSONFile = &archive.MuxIn{Intent: rolesIntent, Mux: dump.archive.Mux}
 		versionIntent.BSONFile = &archive.MuxIn{Intent: versionIntent, Mux: dump.archive.Mux}
 	} else {
-		usersIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.users.bson")), intent: usersIntent}
-		rolesIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.roles.bson")), intent: rolesIntent}
-		versionIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.version.bson")), intent: versionIntent}
+		usersIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.users.bson")), intent: usersIntent, manifest: dump.manifest}
+		rolesIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.roles.bson")), intent: rolesIntent, manifest: dump.manifest}
+		versionIntent.BSONFile = &realBSONFile{path: filepath.Join(outDir, nameGz(dump.OutputOptions.Gzip, "$admin.system.version.bson")), intent: versionIntent, manifest: dump.manifest}
 	}
 	dump.manager.Put(usersIntent)
 	dump.manager.Put(rolesIntent)
@@ -316,7 +335,7 @@ func (dump *MongoDump) NewIntentFromOptions(dbName string, ci *db.CollectionInfo
 					`and can't be dumped to the filesystem`, dbName, ci.Name, c)
 			}
 			path := nameGz(dump.OutputOptions.Gzip, dump.outputPath(dbName, ci.Name)+".bson")
-			intent.BSONFile = &realBSONFile{path: path, intent: intent}
+			intent.BSONFile = &realBSONFile{path: path, intent: intent, manifest: dump.manifest}
 		} else {
 			// otherwise, it's a view and the options specify not dumping a view
 			// so don't dump it.
@@ -334,7 +353,7 @@ func (dump *MongoDump) NewIntentFromOptions(dbName string, ci *db.CollectionInfo
 					}
 				} else {
 					path := nameGz(dump.OutputOptions.Gzip, dump.outputPath(dbName, ci.Name+".metadata.json"))
-					intent.MetadataFile = &realMetadataFile{path: path, intent: intent}
+					intent.MetadataFile = &realMetadataFile{path: path, intent: intent, manifest: dump.manifest}
 				}
 			}
 		}
@@ -34,22 +34,61 @@ type CSVExportOutput struct {
 	// NoHeaderLine, if set, will export CSV data without a list of field names at the first line
 	NoHeaderLine bool
 
+	// Flatten, if non-nil, expands nested documents (and optionally arrays)
+	// into one column per nested field instead of writing them as JSON. The
+	// set of columns is determined by the first exported document.
+	Flatten *CSVFlattenOptions
+
+	// Formatter, if non-nil, rewrites dates and ObjectIds before they are written.
+	Formatter *ValueFormatter
+
 	csvWriter *csv.Writer
+
+	// columns holds the expanded column list once it is known, and
+	// headerPending is set while the header is waiting on that list.
+	columns       []csvColumn
+	headerPending bool
+}
+
+// CSVFlattenOptions controls how nested values are expanded into columns.
+type CSVFlattenOptions struct {
+	bsonutil.FlattenOptions
+
+	// Separator joins the components of a nested field name in the header.
+	Separator string
+}
+
+// csvColumn is a single expanded output column.
+type csvColumn struct {
+	header string
+	// path is the dot-delimited path used to extract the column's value.
+	path string
 }
 
 // NewCSVExportOutput returns a CSVExportOutput configured to write output to the
 // given io.Writer, extracting the specified fields only.
 func NewCSVExportOutput(fields []string, noHeaderLine bool, out io.Writer) *CSVExportOutput {
 	return &CSVExportOutput{
-		fields,
-		0,
-		noHeaderLine,
-		csv.NewWriter(out),
+		Fields:       fields,
+		NoHeaderLine: noHeaderLine,
+		csvWriter:    csv.NewWriter(out),
 	}
 }
 
+// SetDelimiter sets the character that separates the values of a row, such
+// as '\t' for tab-separated output. It must be called before anything is
+// written.
+func (csvExporter *CSVExportOutput) SetDelimiter(comma rune) {
+	csvExporter.csvWriter.Comma = comma
+}
+
 // WriteHeader writes a comma-delimited list of fields as the output header row.
 func (csvExporter *CSVExportOutput) WriteHeader() error {
+	if csvExporter.Flatten != nil {
+		// the header depends on the shape of the first document
+		csvExporter.headerPending = !csvExporter.NoHeaderLine
+		return nil
+	}
 	if !csvExporter.NoHeaderLine {
 		csvExporter.csvWriter.Write(csvExporter.Fields)
 		return csvExporter.csvWriter.Error()
@@ -57,9 +96,19 @@ func (csvExporter *CSVExportOutput) WriteHeader() error {
 	return nil
 }
 
-// WriteFooter is a no-op for CSV export formats.
+// WriteFooter is a no-op for CSV export formats, except that it writes a
+// pending flattened header if no documents were exported.
 func (csvExporter *CSVExportOutput) WriteFooter() error {
 	// no CSV footer
+	if csvExporter.headerPending {
+		headers := make([]string, 0, len(csvExporter.Fields))
+		for _, field := range csvExporter.Fields {
+			headers = append(headers, strings.Replace(field, ".", csvExporter.Flatten.Separator, -1))
+		}
+		csvExporter.headerPending = false
+		csvExporter.csvWriter.Write(headers)
+		return csvExporter.csvWriter.Error()
+	}
 	return nil
 }
 
@@ -71,53 +120,115 @@ func (csvExporter *CSVExportOutput) Flush() error {
 
 // ExportDocument writes a line to output with the CSV representation of a document.
 func (csvExporter *CSVExportOutput) ExportDocument(document bson.D) error {
-	rowOut := make([]string, 0, len(csvExporter.Fields))
 	extendedDoc, err := bsonutil.ConvertBSONValueToJSON(document)
 	if err != nil {
 		return err
 	}
+	if csvExporter.Formatter.IsEnabled() {
+		extendedDoc = csvExporter.Formatter.Format(extendedDoc)
+	}
 
+	if csvExporter.Flatten != nil {
+		return csvExporter.exportFlattened(extendedDoc)
+	}
+
+	rowOut := make([]string, 0, len(csvExporter.Fields))
 	for _, fieldName := range csvExporter.Fields {
-		fieldVal := extractFieldByName(fieldName, extendedDoc)
-		if fieldVal == nil {
-			rowOut = append(rowOut, "")
-		} else if reflect.TypeOf(fieldVal) == reflect.TypeOf(bson.M{}) ||
-			reflect.TypeOf(fieldVal) == reflect.TypeOf(bson.D{}) ||
-			reflect.TypeOf(fieldVal) == marshalDType ||
-			reflect.TypeOf(fieldVal) == reflect.TypeOf([]interface{}{}) {
-			buf, err := json.Marshal(fieldVal)
-			if err != nil {
-				rowOut = append(rowOut, "")
-			} else {
-				rowOut = append(rowOut, string(buf))
-			}
-		} else {
-			rowOut = append(rowOut, fmt.Sprintf("%v", fieldVal))
+		rowOut = append(rowOut, formatCSVValue(extractFieldByName(fieldName, extendedDoc)))
+	}
+	csvExporter.csvWriter.Write(rowOut)
+	csvExporter.NumExported++
+	return csvExporter.csvWriter.Error()
+}
+
+// exportFlattened writes a document using the expanded column list, computing
+// that list (and writing the header) from the document if this is the first one.
+func (csvExporter *CSVExportOutput) exportFlattened(extendedDoc interface{}) error {
+	if csvExporter.columns == nil {
+		csvExporter.columns = csvExporter.flattenColumns(extendedDoc)
+	}
+	if csvExporter.headerPending {
+		headers := make([]string, 0, len(csvExporter.columns))
+		for _, column := range csvExporter.columns {
+			headers = append(headers, column.header)
 		}
+		csvExporter.headerPending = false
+		csvExporter.csvWriter.Write(headers)
+	}
+
+	rowOut := make([]string, 0, len(csvExporter.columns))
+	for _, column := range csvExporter.columns {
+		rowOut = append(rowOut, formatCSVValue(extractFieldByName(column.path, extendedDoc)))
 	}
 	csvExporter.csvWriter.Write(rowOut)
 	csvExporter.NumExported++
 	return csvExporter.csvWriter.Error()
 }
 
+// flattenColumns expands each exported field into the leaf fields it
+// contains in the given document.
+func (csvExporter *CSVExportOutput) flattenColumns(extendedDoc interface{}) []csvColumn {
+	columns := []csvColumn{}
+	for _, fieldName := range csvExporter.Fields {
+		fieldVal := extractFieldByName(fieldName, extendedDoc)
+		leaves := bsonutil.Flatten(strings.Split(fieldName, "."), fieldVal, csvExporter.Flatten.FlattenOptions)
+		for _, leaf := range leaves {
+			columns = append(columns, csvColumn{
+				header: strings.Join(leaf.Path, csvExporter.Flatten.Separator),
+				path:   strings.Join(leaf.Path, "."),
+			})
+		}
+	}
+	return columns
+}
+
+// formatCSVValue returns the string written to a CSV cell for an extended
+// JSON value. Documents and arrays are written as JSON.
+func formatCSVValue(fieldVal interface{}) string {
+	if fieldVal == nil {
+		return ""
+	}
+	if reflect.TypeOf(fieldVal) == reflect.TypeOf(bson.M{}) ||
+		reflect.TypeOf(fieldVal) == reflect.TypeOf(bson.D{}) ||
+		reflect.TypeOf(fieldVal) == marshalDType ||
+		reflect.TypeOf(fieldVal) == reflect.TypeOf([]interface{}{}) {
+		buf, err := json.Marshal(fieldVal)
+		if err != nil {
+			return ""
+		}
+		return string(buf)
+	}
+	return fmt.Sprintf("%v", fieldVal)
+}
+
 // extractFieldByName takes a field name and document, and returns a value representing
 // the value of that field in the document in a format that can be printed as a string.
 // It will also handle dot-delimited field names for nested arrays or documents.
 func extractFieldByName(fieldName string, document interface{}) interface{} {
+	subdoc, ok := lookupFieldByName(fieldName, document)
+	if !ok {
+		return ""
+	}
+	return subdoc
+}
+
+// lookupFieldByName is like extractFieldByName, but reports whether the
+// field exists instead of returning a blank value for missing fields.
+func lookupFieldByName(fieldName string, document interface{}) (interface{}, bool) {
 	dotParts := strings.Split(fieldName, ".")
 	var subdoc interface{} = document
 
 	for _, path := range dotParts {
 		docValue := reflect.ValueOf(subdoc)
 		if !docValue.IsValid() {
-			return ""
+			return nil, false
 		}
 		docType := docValue.Type()
 		docKind := docType.Kind()
 		if docKind == reflect.Map {
 			subdocVal := docValue.MapIndex(reflect.ValueOf(path))
 			if subdocVal.Kind() == reflect.Invalid {
-				return ""
+				return nil, false
 			}
 			subdoc = subdocVal.Interface()
 		} else if docKind == reflect.Slice {
@@ -127,28 +238,28 @@ func extractFieldByName(fieldName string, document interface{}) interface{} {
 				var err error
 				subdoc, err = bsonutil.FindValueByKey(path, &asD)
 				if err != nil {
-					return ""
+					return nil, false
 				}
 			} else {
 				//  check that the path can be converted to int
 				arrayIndex, err := strconv.Atoi(path)
 				if err != nil {
-					return ""
+					return nil, false
 				}
 				// bounds check for slice
 				if arrayIndex < 0 || arrayIndex >= docValue.Len() {
-					return ""
+					return nil, false
 				}
 				subdocVal := docValue.Index(arrayIndex)
 				if subdocVal.Kind() == reflect.Invalid {
-					return ""
+					return nil, false
 				}
 				subdoc = subdocVal.Interface()
 			}
 		} else {
 			// trying to index into a non-compound type - just return blank.
-			return ""
+			return nil, false
 		}
 	}
-	return subdoc
+	return subdoc, true
 }
@@ -77,6 +77,67 @@ func TestWriteCSV(t *testing.T) {
 	})
 }
 
+func TestWriteFlattenedCSV(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a flattening CSV export output", t, func() {
+		out := &bytes.Buffer{}
+		csvExporter := NewCSVExportOutput([]string{"_id", "a", "b"}, false, out)
+		csvExporter.Flatten = &CSVFlattenOptions{Separator: "_"}
+
+		readAll := func() [][]string {
+			records, err := csv.NewReader(strings.NewReader(out.String())).ReadAll()
+			So(err, ShouldBeNil)
+			return records
+		}
+
+		Convey("nested documents should be expanded into columns", func() {
+			So(csvExporter.WriteHeader(), ShouldBeNil)
+			So(csvExporter.ExportDocument(bson.D{
+				{"_id", 1},
+				{"a", bson.D{{"x", 1}, {"y", bson.D{{"z", "deep"}}}}},
+				{"b", []interface{}{1, 2}},
+			}), ShouldBeNil)
+			So(csvExporter.ExportDocument(bson.D{
+				{"_id", 2},
+				{"a", bson.D{{"y", bson.D{{"z", "other"}}}}},
+			}), ShouldBeNil)
+			csvExporter.WriteFooter()
+			csvExporter.Flush()
+			So(readAll(), ShouldResemble, [][]string{
+				{"_id", "a_x", "a_y_z", "b"},
+				{"1", "1", "deep", "[1,2]"},
+				{"2", "", "other", ""},
+			})
+		})
+
+		Convey("arrays should be expanded by index when requested", func() {
+			csvExporter.Flatten.ExpandArrays = true
+			csvExporter.Flatten.MaxDepth = 1
+			So(csvExporter.WriteHeader(), ShouldBeNil)
+			So(csvExporter.ExportDocument(bson.D{
+				{"_id", 1},
+				{"a", bson.D{{"x", bson.D{{"z", 1}}}}},
+				{"b", []interface{}{"p", "q"}},
+			}), ShouldBeNil)
+			csvExporter.WriteFooter()
+			csvExporter.Flush()
+			So(readAll(), ShouldResemble, [][]string{
+				{"_id", "a_x", "b_0", "b_1"},
+				{"1", `{"z":1}`, "p", "q"},
+			})
+		})
+
+		Convey("the header should still be written if there are no documents", func() {
+			csvExporter.Fields = []string{"_id", "a.b"}
+			So(csvExporter.WriteHeader(), ShouldBeNil)
+			So(csvExporter.WriteFooter(), ShouldBeNil)
+			csvExporter.Flush()
+			So(readAll(), ShouldResemble, [][]string{{"_id", "a_b"}})
+		})
+	})
+}
+
 func TestExtractDField(t *testing.T) {
 	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
 	Convey("With a test bson.D", t, func() {
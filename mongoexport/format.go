@@ -0,0 +1,116 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Special values for --dateFormat and --objectIdFormat.
+const (
+	DateFormatMillis      = "millis"
+	ObjectIdFormatHex     = "hex"
+	ObjectIdFormatExtJSON = "extjson"
+)
+
+// ValueFormatter rewrites dates and ObjectIds in an extended JSON document
+// into the representation requested by the user, so that the exported values
+// can be loaded without post-processing.
+type ValueFormatter struct {
+	// DateFormat is either DateFormatMillis, to write dates as milliseconds
+	// since the epoch, or a Go time layout used to format dates in UTC.
+	// If empty, dates are left unchanged.
+	DateFormat string
+
+	// ObjectIdFormat is either ObjectIdFormatHex, to write ObjectIds as plain
+	// hex strings, or ObjectIdFormatExtJSON, to write them as {"$oid": ...}.
+	// If empty, ObjectIds are left unchanged.
+	ObjectIdFormat string
+}
+
+// validateValueFormats returns an error if the given date or ObjectId format
+// is not supported.
+func validateValueFormats(dateFormat, objectIdFormat string) error {
+	switch objectIdFormat {
+	case "", ObjectIdFormatHex, ObjectIdFormatExtJSON:
+	default:
+		return fmt.Errorf("invalid --objectIdFormat '%v', choose 'hex' or 'extjson'", objectIdFormat)
+	}
+	if dateFormat != "" && dateFormat != DateFormatMillis {
+		// a layout without any reference time components formats every
+		// date to the same string, which is certainly not what was intended
+		if time.Unix(0, 0).UTC().Format(dateFormat) == dateFormat {
+			return fmt.Errorf("invalid --dateFormat '%v', expected '%v' or a Go time layout such as '%v'",
+				dateFormat, DateFormatMillis, time.RFC3339)
+		}
+	}
+	return nil
+}
+
+// IsEnabled returns true if the formatter changes any values.
+func (f *ValueFormatter) IsEnabled() bool {
+	return f != nil && (f.DateFormat != "" || f.ObjectIdFormat != "")
+}
+
+// Format walks the given extended JSON value, as returned by
+// bsonutil.ConvertBSONValueToJSON, and returns it with dates and ObjectIds
+// rewritten. Documents and arrays are modified in place.
+func (f *ValueFormatter) Format(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bsonutil.MarshalD:
+		for i := range v {
+			v[i].Value = f.Format(v[i].Value)
+		}
+		return v
+	case bson.M:
+		for key, elem := range v {
+			v[key] = f.Format(elem)
+		}
+		return v
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = f.Format(elem)
+		}
+		return v
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = f.Format(elem)
+		}
+		return v
+	case json.Date:
+		return f.formatDate(v)
+	case json.ObjectId:
+		return f.formatObjectId(v)
+	}
+	return value
+}
+
+func (f *ValueFormatter) formatDate(d json.Date) interface{} {
+	switch f.DateFormat {
+	case "":
+		return d
+	case DateFormatMillis:
+		return int64(d)
+	}
+	n := int64(d)
+	return time.Unix(n/1e3, n%1e3*1e6).UTC().Format(f.DateFormat)
+}
+
+func (f *ValueFormatter) formatObjectId(oid json.ObjectId) interface{} {
+	switch f.ObjectIdFormat {
+	case ObjectIdFormatHex:
+		return string(oid)
+	case ObjectIdFormatExtJSON:
+		return bsonutil.MarshalD{{Name: "$oid", Value: string(oid)}}
+	}
+	return oid
+}
@@ -0,0 +1,85 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestValueFormatter(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	oid := bson.ObjectIdHex("5a934e000102030405000000")
+	date := time.Date(2018, 2, 25, 23, 30, 0, 0, time.UTC)
+	doc := func() bson.D {
+		return bson.D{{"_id", oid}, {"when", date}, {"sub", bson.D{{"at", []interface{}{date}}}}}
+	}
+
+	Convey("With a CSV export output", t, func() {
+		out := &bytes.Buffer{}
+		csvExporter := NewCSVExportOutput([]string{"_id", "when", "sub.at.0"}, true, out)
+
+		readRecord := func() []string {
+			So(csvExporter.ExportDocument(doc()), ShouldBeNil)
+			csvExporter.Flush()
+			rec, err := csv.NewReader(strings.NewReader(out.String())).Read()
+			So(err, ShouldBeNil)
+			return rec
+		}
+
+		Convey("values should be unchanged by default", func() {
+			So(readRecord(), ShouldResemble, []string{
+				"ObjectId(5a934e000102030405000000)",
+				"2018-02-25T23:30:00.000Z",
+				"2018-02-25T23:30:00.000Z",
+			})
+		})
+
+		Convey("dates and ObjectIds should be formatted as requested", func() {
+			csvExporter.Formatter = &ValueFormatter{DateFormat: "2006-01-02 15:04", ObjectIdFormat: ObjectIdFormatHex}
+			So(readRecord(), ShouldResemble, []string{
+				"5a934e000102030405000000",
+				"2018-02-25 23:30",
+				"2018-02-25 23:30",
+			})
+		})
+
+		Convey("dates should be written as epoch milliseconds", func() {
+			csvExporter.Formatter = &ValueFormatter{DateFormat: DateFormatMillis, ObjectIdFormat: ObjectIdFormatExtJSON}
+			So(readRecord(), ShouldResemble, []string{
+				`{"$oid":"5a934e000102030405000000"}`,
+				"1519601400000",
+				"1519601400000",
+			})
+		})
+	})
+
+	Convey("With a JSON export output", t, func() {
+		out := &bytes.Buffer{}
+		jsonExporter := NewJSONExportOutput(false, false, out)
+		jsonExporter.Formatter = &ValueFormatter{DateFormat: DateFormatMillis, ObjectIdFormat: ObjectIdFormatHex}
+		So(jsonExporter.ExportDocument(doc()), ShouldBeNil)
+		So(out.String(), ShouldEqual,
+			`{"_id":"5a934e000102030405000000","when":1519601400000,"sub":{"at":[1519601400000]}}`+"\n")
+	})
+
+	Convey("Format validation should reject unknown formats", t, func() {
+		So(validateValueFormats("", ""), ShouldBeNil)
+		So(validateValueFormats(DateFormatMillis, ObjectIdFormatExtJSON), ShouldBeNil)
+		So(validateValueFormats(time.RFC3339, ObjectIdFormatHex), ShouldBeNil)
+		So(validateValueFormats("nonsense", ""), ShouldNotBeNil)
+		So(validateValueFormats("", "base64"), ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,295 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// incrementalState tracks the high-water mark of an incremental export,
+// which only exports documents whose since field is greater than the mark.
+type incrementalState struct {
+	Namespace string
+	Field     string
+	// Since is the high-water mark the export started from, or nil to
+	// export every document.
+	Since interface{}
+	// Max is the greatest value of the field among exported documents.
+	Max interface{}
+
+	// projected is the top-level field added to the --fields projection to
+	// read the since field, which is removed from the exported documents.
+	projected string
+}
+
+// loadIncrementalState determines the high-water mark to export from, using
+// the state file of the previous run if there is one and --since otherwise.
+func (exp *MongoExport) loadIncrementalState() error {
+	field := exp.InputOpts.SinceField
+	if field == "" {
+		field = "_id"
+	}
+	state := &incrementalState{Namespace: exp.namespace(), Field: field}
+
+	if exp.InputOpts.Since != "" {
+		since, err := parseSinceValue(exp.InputOpts.Since, field)
+		if err != nil {
+			return err
+		}
+		state.Since = since
+	}
+
+	if exp.InputOpts.StateFile != "" {
+		previous, err := readIncrementalState(exp.InputOpts.StateFile)
+		if err != nil {
+			return err
+		}
+		if previous != nil {
+			if previous.Namespace != state.Namespace || previous.Field != field {
+				return fmt.Errorf("state file '%v' belongs to an export of '%v' by '%v', not '%v' by '%v'",
+					exp.InputOpts.StateFile, previous.Namespace, previous.Field, state.Namespace, field)
+			}
+			state.Since = previous.Since
+		}
+	}
+	state.Max = state.Since
+	exp.incremental = state
+	return nil
+}
+
+// saveIncrementalState writes the high-water mark to the state file, if there is one.
+func (exp *MongoExport) saveIncrementalState() error {
+	if exp.incremental == nil || exp.InputOpts.StateFile == "" || exp.incremental.Max == nil {
+		return nil
+	}
+	return exp.incremental.write(exp.InputOpts.StateFile)
+}
+
+// parseSinceValue parses the argument to --since. It accepts any extended
+// JSON value, such as ObjectId("...") or {"$date": "..."}, as well as bare
+// ObjectId hex strings and dates. Dates compared against _id are converted
+// to the smallest ObjectId generated at that time.
+func parseSinceValue(arg, field string) (interface{}, error) {
+	var value interface{}
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(`{"v":`+arg+`}`), &doc); err == nil {
+		if err = bsonutil.ConvertJSONDocumentToBSON(doc); err != nil {
+			return nil, fmt.Errorf("invalid --since value '%v': %v", arg, err)
+		}
+		value = doc["v"]
+	} else {
+		value = arg
+	}
+
+	if s, ok := value.(string); ok {
+		if bson.IsObjectIdHex(s) {
+			value = bson.ObjectIdHex(s)
+		} else if date, err := util.FormatDate(s); err == nil {
+			value = date
+		} else if date, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			value = date
+		} else if date, err := time.Parse("2006-01-02", s); err == nil {
+			value = date
+		} else if field == "_id" {
+			return nil, fmt.Errorf("invalid --since value '%v': expected an ObjectId or a date", arg)
+		}
+	}
+
+	if date, ok := value.(time.Time); ok && field == "_id" {
+		value = bson.NewObjectIdWithTime(date)
+	}
+	return value, nil
+}
+
+// readIncrementalState loads the high-water mark from the state file. It
+// returns nil and no error if the file does not exist.
+func readIncrementalState(filename string) (*incrementalState, error) {
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file: %v", err)
+	}
+
+	parsed := map[string]interface{}{}
+	if err = json.Unmarshal(content, &parsed); err != nil {
+		return nil, fmt.Errorf("state file '%v' is not valid JSON: %v", filename, err)
+	}
+	if err = bsonutil.ConvertJSONDocumentToBSON(parsed); err != nil {
+		return nil, fmt.Errorf("error parsing state file '%v': %v", filename, err)
+	}
+
+	state := &incrementalState{}
+	var ok bool
+	if state.Namespace, ok = parsed["ns"].(string); !ok {
+		return nil, fmt.Errorf("state file '%v' is missing the namespace", filename)
+	}
+	if state.Field, ok = parsed["field"].(string); !ok {
+		return nil, fmt.Errorf("state file '%v' is missing the field name", filename)
+	}
+	if state.Since, ok = parsed["since"]; !ok {
+		return nil, fmt.Errorf("state file '%v' is missing the high-water mark", filename)
+	}
+	return state, nil
+}
+
+// write saves the high-water mark reached by this export to the given file,
+// so that the next run continues from it.
+func (state *incrementalState) write(filename string) error {
+	since, err := bsonutil.GetBSONValueAsJSON(state.Max)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(bsonutil.MarshalD{
+		{Name: "ns", Value: state.Namespace},
+		{Name: "field", Value: state.Field},
+		{Name: "since", Value: since},
+	})
+	if err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+
+	tmpName := filename + ".tmp"
+	if err = ioutil.WriteFile(tmpName, content, 0640); err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	if err = os.Rename(tmpName, filename); err != nil {
+		return fmt.Errorf("error writing state file: %v", err)
+	}
+	return nil
+}
+
+// observe records the value of the since field in an exported document.
+func (state *incrementalState) observe(document bson.D) {
+	value, ok := lookupPath(document, state.Field)
+	if !ok {
+		return
+	}
+	if state.Max == nil || compareSinceValues(value, state.Max) > 0 {
+		state.Max = value
+	}
+}
+
+// project adds the since field to a --fields projection, if it doesn't
+// already select it. As with --fields, the whole of its top-level field is
+// selected.
+func (state *incrementalState) project(selector bson.M) error {
+	top := strings.SplitN(state.Field, ".", 2)[0]
+	if _, ok := selector[top]; ok {
+		return nil
+	}
+	for field := range selector {
+		if strings.HasPrefix(field, top+".") {
+			return fmt.Errorf("cannot use --sinceField '%v' with the projection of '%v'", state.Field, field)
+		}
+	}
+	selector[top] = 1
+	state.projected = top
+	return nil
+}
+
+// strip removes the field added by project from an exported document.
+func (state *incrementalState) strip(document bson.D) bson.D {
+	if state.projected == "" {
+		return document
+	}
+	for i, elem := range document {
+		if elem.Name == state.projected {
+			return append(document[:i], document[i+1:]...)
+		}
+	}
+	return document
+}
+
+// lookupPath returns the value at a dot-delimited path in a document.
+func lookupPath(document bson.D, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	var current interface{} = document
+	for _, part := range parts {
+		doc, ok := current.(bson.D)
+		if !ok {
+			return nil, false
+		}
+		value, err := bsonutil.FindValueByKey(part, &doc)
+		if err != nil {
+			return nil, false
+		}
+		current = value
+	}
+	return current, true
+}
+
+// compareSinceValues orders two values of the types that make sense as a
+// high-water mark. Values of different or unsupported types compare as
+// equal, so they never replace the current mark.
+func compareSinceValues(a, b interface{}) int {
+	switch av := a.(type) {
+	case bson.ObjectId:
+		if bv, ok := b.(bson.ObjectId); ok {
+			return strings.Compare(string(av), string(bv))
+		}
+	case time.Time:
+		if bv, ok := b.(time.Time); ok {
+			switch {
+			case av.Before(bv):
+				return -1
+			case av.After(bv):
+				return 1
+			}
+		}
+	case bson.MongoTimestamp:
+		if bv, ok := b.(bson.MongoTimestamp); ok {
+			return compareInt64(int64(av), int64(bv))
+		}
+	case string:
+		if bv, ok := b.(string); ok {
+			return strings.Compare(av, bv)
+		}
+	default:
+		af, aErr := util.ToFloat64(a)
+		bf, bErr := util.ToFloat64(b)
+		if aErr == nil && bErr == nil {
+			switch {
+			case af < bf:
+				return -1
+			case af > bf:
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// afterValueQuery returns a query matching the documents matched by query
+// whose field is greater than value.
+func afterValueQuery(query map[string]interface{}, field string, value interface{}) map[string]interface{} {
+	after := map[string]interface{}{field: bson.M{"$gt": value}}
+	if len(query) == 0 {
+		return after
+	}
+	return map[string]interface{}{"$and": []interface{}{query, after}}
+}
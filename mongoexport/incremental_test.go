@@ -0,0 +1,121 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseSinceValue(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	date := time.Date(2018, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	Convey("ObjectIds should be accepted as hex or extended JSON", t, func() {
+		oid := bson.ObjectIdHex("5a97c6800000000000000000")
+		value, err := parseSinceValue("5a97c6800000000000000000", "_id")
+		So(err, ShouldBeNil)
+		So(value, ShouldEqual, oid)
+		value, err = parseSinceValue(`ObjectId("5a97c6800000000000000000")`, "_id")
+		So(err, ShouldBeNil)
+		So(value, ShouldEqual, oid)
+	})
+
+	Convey("Dates should be converted to ObjectIds for _id", t, func() {
+		value, err := parseSinceValue("2018-03-01T00:00:00Z", "_id")
+		So(err, ShouldBeNil)
+		So(value, ShouldEqual, bson.NewObjectIdWithTime(date))
+	})
+
+	Convey("Dates should be kept as dates for other fields", t, func() {
+		value, err := parseSinceValue(`{"$date":"2018-03-01T00:00:00.000Z"}`, "updatedAt")
+		So(err, ShouldBeNil)
+		So(value.(time.Time).Equal(date), ShouldBeTrue)
+		value, err = parseSinceValue("2018-03-01", "updatedAt")
+		So(err, ShouldBeNil)
+		So(value.(time.Time).Equal(date), ShouldBeTrue)
+	})
+
+	Convey("Invalid values for _id should be rejected", t, func() {
+		_, err := parseSinceValue("yesterday", "_id")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestIncrementalState(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The high-water mark should track the greatest value", t, func() {
+		state := &incrementalState{Field: "meta.updated"}
+		state.observe(bson.D{{"meta", bson.D{{"updated", 5}}}})
+		state.observe(bson.D{{"meta", bson.D{{"updated", 9}}}})
+		state.observe(bson.D{{"meta", bson.D{{"updated", int64(7)}}}})
+		state.observe(bson.D{{"other", 100}})
+		So(state.Max, ShouldEqual, 9)
+	})
+
+	Convey("The since field should only be exported if --fields selects it", t, func() {
+		state := &incrementalState{Field: "meta.updated"}
+		selector := makeFieldSelector("a")
+		So(state.project(selector), ShouldBeNil)
+		So(selector, ShouldResemble, bson.M{"_id": 1, "a": 1, "meta": 1})
+		So(state.strip(bson.D{{"_id", 1}, {"a", 2}, {"meta", bson.D{{"updated", 5}}}}),
+			ShouldResemble, bson.D{{"_id", 1}, {"a", 2}})
+
+		state = &incrementalState{Field: "a.b"}
+		selector = makeFieldSelector("a")
+		So(state.project(selector), ShouldBeNil)
+		So(selector, ShouldResemble, bson.M{"_id": 1, "a": 1})
+		So(state.strip(bson.D{{"_id", 1}, {"a", bson.D{{"b", 5}}}}),
+			ShouldResemble, bson.D{{"_id", 1}, {"a", bson.D{{"b", 5}}}})
+
+		So(state.project(makeFieldSelector("a.$")), ShouldNotBeNil)
+	})
+
+	Convey("With a temporary directory", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_incremental")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		filename := filepath.Join(dir, "state.json")
+
+		exp := &MongoExport{
+			ToolOptions: options.ToolOptions{Namespace: &options.Namespace{DB: "db", Collection: "c"}},
+			OutputOpts:  &OutputFormatOptions{},
+			InputOpts:   &InputOptions{Since: "5a97c6800000000000000000", StateFile: filename},
+		}
+
+		Convey("--since should be used until there is a state file", func() {
+			So(exp.loadIncrementalState(), ShouldBeNil)
+			So(exp.incremental.Since, ShouldEqual, bson.ObjectIdHex("5a97c6800000000000000000"))
+
+			newer := bson.ObjectIdHex("5a97c6900000000000000000")
+			exp.incremental.observe(bson.D{{"_id", newer}})
+			So(exp.saveIncrementalState(), ShouldBeNil)
+
+			So(exp.loadIncrementalState(), ShouldBeNil)
+			So(exp.incremental.Since, ShouldEqual, newer)
+		})
+
+		Convey("a state file for a different field should be rejected", func() {
+			So(exp.loadIncrementalState(), ShouldBeNil)
+			So(exp.saveIncrementalState(), ShouldBeNil)
+			exp.InputOpts.SinceField = "updatedAt"
+			So(exp.loadIncrementalState(), ShouldNotBeNil)
+		})
+	})
+}
@@ -23,20 +23,24 @@ type JSONExportOutput struct {
 	ArrayOutput bool
 	// Pretty when set to true indicates that the output will be written in pretty mode.
 	PrettyOutput bool
-	Encoder      *json.Encoder
-	Out          io.Writer
-	NumExported  int64
+	// Formatter, if non-nil, rewrites dates and ObjectIds before they are written.
+	Formatter *ValueFormatter
+	// JSONFormat selects extended JSON v2 output when set to
+	// bsonutil.ExtJSONCanonical or bsonutil.ExtJSONRelaxed.
+	JSONFormat  string
+	Encoder     *json.Encoder
+	Out         io.Writer
+	NumExported int64
 }
 
 // NewJSONExportOutput creates a new JSONExportOutput in array mode if specified,
 // configured to write data to the given io.Writer.
 func NewJSONExportOutput(arrayOutput bool, prettyOutput bool, out io.Writer) *JSONExportOutput {
 	return &JSONExportOutput{
-		arrayOutput,
-		prettyOutput,
-		json.NewEncoder(out),
-		out,
-		0,
+		ArrayOutput:  arrayOutput,
+		PrettyOutput: prettyOutput,
+		Encoder:      json.NewEncoder(out),
+		Out:          out,
 	}
 }
 
@@ -77,6 +81,25 @@ func (jsonExporter *JSONExportOutput) Flush() error {
 // ExportDocument converts the given document to extended JSON, and writes it
 // to the output.
 func (jsonExporter *JSONExportOutput) ExportDocument(document bson.D) error {
+	var extendedDoc interface{}
+	var err error
+	switch jsonExporter.JSONFormat {
+	case bsonutil.ExtJSONCanonical, bsonutil.ExtJSONRelaxed:
+		canonical := jsonExporter.JSONFormat == bsonutil.ExtJSONCanonical
+		extendedDoc, err = bsonutil.ConvertBSONValueToExtJSONv2(document, canonical)
+		if err != nil {
+			return err
+		}
+	default:
+		extendedDoc, err = bsonutil.ConvertBSONValueToJSON(document)
+		if err != nil {
+			return err
+		}
+		if jsonExporter.Formatter.IsEnabled() {
+			extendedDoc = jsonExporter.Formatter.Format(extendedDoc)
+		}
+	}
+
 	if jsonExporter.ArrayOutput || jsonExporter.PrettyOutput {
 		if jsonExporter.NumExported >= 1 {
 			if jsonExporter.ArrayOutput {
@@ -86,10 +109,6 @@ func (jsonExporter *JSONExportOutput) ExportDocument(document bson.D) error {
 				jsonExporter.Out.Write([]byte("\n"))
 			}
 		}
-		extendedDoc, err := bsonutil.ConvertBSONValueToJSON(document)
-		if err != nil {
-			return err
-		}
 		jsonOut, err := json.Marshal(extendedDoc)
 		if err != nil {
 			return fmt.Errorf("error converting BSON to extended JSON: %v", err)
@@ -101,10 +120,6 @@ func (jsonExporter *JSONExportOutput) ExportDocument(document bson.D) error {
 		}
 		jsonExporter.Out.Write(jsonOut)
 	} else {
-		extendedDoc, err := bsonutil.ConvertBSONValueToJSON(document)
-		if err != nil {
-			return err
-		}
 		err = jsonExporter.Encoder.Encode(extendedDoc)
 		if err != nil {
 			return err
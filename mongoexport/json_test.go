@@ -9,7 +9,9 @@ package mongoexport
 import (
 	"bytes"
 	"testing"
+	"time"
 
+	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/testtype"
 	. "github.com/smartystreets/goconvey/convey"
@@ -78,3 +80,27 @@ func TestJSONArray(t *testing.T) {
 
 	})
 }
+
+func TestJSONFormat(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a JSON export output writing extended JSON v2", t, func() {
+		out := &bytes.Buffer{}
+		jsonExporter := NewJSONExportOutput(false, false, out)
+		doc := func() bson.D {
+			return bson.D{{"n", int64(3)}, {"d", time.Unix(0, 0)}}
+		}
+
+		Convey("canonical mode should preserve every type", func() {
+			jsonExporter.JSONFormat = bsonutil.ExtJSONCanonical
+			So(jsonExporter.ExportDocument(doc()), ShouldBeNil)
+			So(out.String(), ShouldEqual, `{"n":{"$numberLong":"3"},"d":{"$date":{"$numberLong":"0"}}}`+"\n")
+		})
+
+		Convey("relaxed mode should use plain numbers and ISO-8601 dates", func() {
+			jsonExporter.JSONFormat = bsonutil.ExtJSONRelaxed
+			So(jsonExporter.ExportDocument(doc()), ShouldBeNil)
+			So(out.String(), ShouldEqual, `{"n":3,"d":{"$date":"1970-01-01T00:00:00.000Z"}}`+"\n")
+		})
+	})
+}
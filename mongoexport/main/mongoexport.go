@@ -8,14 +8,20 @@
 package main
 
 import (
+	"io"
 	"os"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/db/csfle"
+	"github.com/mongodb/mongo-tools/common/diagnose"
+	"github.com/mongodb/mongo-tools/common/failure"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/signals"
+	"github.com/mongodb/mongo-tools/common/throttle"
+	"github.com/mongodb/mongo-tools/common/trace"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongoexport"
 	"gopkg.in/mgo.v2"
@@ -36,6 +42,12 @@ func main() {
 	opts.AddOptions(outputOpts)
 	inputOpts := &mongoexport.InputOptions{}
 	opts.AddOptions(inputOpts)
+	encryptionOpts := &options.Encryption{}
+	opts.AddOptions(encryptionOpts)
+	throttleOpts := &options.Throttle{}
+	opts.AddOptions(throttleOpts)
+	tracingOpts := &options.Tracing{}
+	opts.AddOptions(tracingOpts)
 
 	args, err := opts.ParseArgs(os.Args[1:])
 	if err != nil {
@@ -50,7 +62,7 @@ func main() {
 	}
 
 	log.SetVerbosity(opts.Verbosity)
-	signals.Handle()
+	log.SetFormat(opts.LogFormat, opts.AppName)
 
 	// print help, if specified
 	if opts.PrintHelp(false) {
@@ -65,10 +77,30 @@ func main() {
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
+	// test connecting to the server step by step, if specified
+	if opts.Diagnose {
+		os.Exit(diagnose.Run(opts, os.Stdout))
+	}
+
+	if err = trace.Init(tracingOpts.OTelEndpoint, opts.AppName); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		log.Logvf(log.Always, "try 'mongoexport --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	limiter, err := throttle.FromOptions(throttleOpts)
+	if err != nil {
+		log.Logvf(log.Always, "%v", err)
+		log.Logvf(log.Always, "try 'mongoexport --help' for more information")
+		trace.Shutdown(err)
+		os.Exit(util.ExitBadOptions)
+	}
+
 	provider, err := db.NewSessionProvider(*opts)
 	if err != nil {
 		log.Logvf(log.Always, "%v", err)
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		os.Exit(failure.ExitCode(err))
 	}
 	defer provider.Close()
 
@@ -77,7 +109,8 @@ func main() {
 	isMongos, err := provider.IsMongos()
 	if err != nil {
 		log.Logvf(log.Always, "%v", err)
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		os.Exit(failure.ExitCode(err))
 	}
 
 	provider.SetFlags(db.DisableSocketTimeout)
@@ -85,6 +118,7 @@ func main() {
 	if inputOpts.SlaveOk {
 		if inputOpts.ReadPreference != "" {
 			log.Logvf(log.Always, "--slaveOk can't be specified when --readPreference is specified")
+			trace.Shutdown(err)
 			os.Exit(util.ExitBadOptions)
 		}
 		log.Logvf(log.Always, "--slaveOk is deprecated and being internally rewritten as --readPreference=nearest")
@@ -102,11 +136,19 @@ func main() {
 		mode, tags, err = db.ParseReadPreference(inputOpts.ReadPreference)
 		if err != nil {
 			log.Logvf(log.Always, "error parsing --ReadPreference: %v", err)
+			trace.Shutdown(err)
 			os.Exit(util.ExitBadOptions)
 		}
 		if len(tags) > 0 {
 			provider.SetTags(tags)
 		}
+		readPrefOptions, err := db.ParseReadPreferenceOptions(inputOpts.ReadPreference)
+		if err != nil {
+			log.Logvf(log.Always, "error parsing --ReadPreference: %v", err)
+			trace.Shutdown(err)
+			os.Exit(util.ExitBadOptions)
+		}
+		provider.SetReadPreferenceOptions(readPrefOptions)
 	}
 
 	// warn if we are trying to export from a secondary in a sharded cluster
@@ -118,12 +160,42 @@ func main() {
 
 	if err != nil {
 		log.Logvf(log.Always, "error connecting to host: %v", err)
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		os.Exit(failure.ExitCode(err))
+	}
+
+	encryption, err := csfle.New(provider, encryptionOpts)
+	if err != nil {
+		log.Logvf(log.Always, "error setting up encryption: %v", err)
+		trace.Shutdown(err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if encryption != nil {
+		log.Logvf(log.Always, "decrypting encrypted fields: the export will hold their plaintext")
 	}
 
-	progressManager := progress.NewBarWriter(log.Writer(0), progressBarWaitTime, progressBarLength, false)
-	progressManager.Start()
-	defer progressManager.Stop()
+	// draw the bars in place on a terminal, unless the log is JSON
+	var terminal io.Writer
+	if opts.LogFormat != log.JSONFormat {
+		terminal = progress.Terminal()
+	}
+	barWriter := progress.NewMultiBarWriter(log.Writer(0), terminal, progressBarWaitTime, progressBarLength, false)
+	barWriter.Start()
+	defer barWriter.Stop()
+
+	// write progress events as well, if asked to
+	var progressManager progress.Manager = barWriter
+	eventWriter, err := progress.OpenEventWriter(opts.ProgressFD, opts.ProgressSocket, opts.AppName, progressBarWaitTime, false)
+	if err != nil {
+		log.Logvf(log.Always, "error opening progress event stream: %v", err)
+		trace.Shutdown(err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if eventWriter != nil {
+		eventWriter.Start()
+		defer eventWriter.Stop()
+		progressManager = progress.Managers{barWriter, eventWriter}
+	}
 
 	exporter := mongoexport.MongoExport{
 		ToolOptions:     *opts,
@@ -131,30 +203,60 @@ func main() {
 		InputOpts:       inputOpts,
 		SessionProvider: provider,
 		ProgressManager: progressManager,
+		Encryption:      encryption,
+		Limiter:         limiter,
 	}
 
+	finishedChan := signals.HandleWithInterrupt(exporter.HandleInterrupt)
+	defer close(finishedChan)
+
 	err = exporter.ValidateSettings()
 	if err != nil {
 		log.Logvf(log.Always, "error validating settings: %v", err)
 		log.Logvf(log.Always, "try 'mongoexport --help' for more information")
+		trace.Shutdown(err)
+		eventWriter.StopWithError(err)
 		os.Exit(util.ExitBadOptions)
 	}
 
 	writer, err := exporter.GetOutputWriter()
 	if err != nil {
 		log.Logvf(log.Always, "error opening output stream: %v", err)
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		eventWriter.StopWithError(err)
+		os.Exit(failure.ExitCode(err))
 	}
 	if writer == nil {
 		writer = os.Stdout
-	} else {
-		defer writer.Close()
 	}
 
 	numDocs, err := exporter.Export(writer)
 	if err != nil {
+		// don't leave a partial upload behind in cloud storage
+		if aborter, ok := writer.(interface {
+			Abort() error
+		}); ok {
+			aborter.Abort()
+		} else if err == util.ErrTerminated && writer != os.Stdout {
+			// keep what was exported, which --resumeFile can continue
+			writer.Close()
+		}
+		if err == util.ErrTerminated {
+			log.Logvf(log.Always, "exported %v records before stopping", numDocs)
+		}
 		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		eventWriter.StopWithError(err)
+		os.Exit(failure.ExitCode(err))
+	}
+
+	if writer != os.Stdout {
+		if err = writer.Close(); err != nil {
+			log.Logvf(log.Always, "Failed: error closing output: %v", err)
+			trace.Shutdown(err)
+			eventWriter.StopWithError(err)
+			os.Exit(failure.ExitCode(err))
+		}
 	}
 
 	if numDocs == 1 {
@@ -162,5 +264,5 @@ func main() {
 	} else {
 		log.Logvf(log.Always, "exported %v records", numDocs)
 	}
-
+	trace.Shutdown(nil)
 }
@@ -16,10 +16,13 @@ import (
 
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/db/csfle"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/storage"
+	"github.com/mongodb/mongo-tools/common/throttle"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -29,9 +32,22 @@ import (
 const (
 	CSV                            = "csv"
 	JSON                           = "json"
+	SQL                            = "sql"
+	TEMPLATE                       = "template"
 	watchProgressorUpdateFrequency = 8000
 )
 
+// Array handling modes for --flattenArrays.
+const (
+	FlattenArraysIndex = "index"
+	FlattenArraysJSON  = "json"
+)
+
+// JSONFormatLegacy selects the extended JSON dialect mongoexport has always
+// written; see bsonutil.ExtJSONCanonical and bsonutil.ExtJSONRelaxed for the
+// v2 formats.
+const JSONFormatLegacy = "legacy"
+
 // MongoExport is a container for the user-specified options and
 // internal state used for running mongoexport.
 type MongoExport struct {
@@ -48,6 +64,26 @@ type MongoExport struct {
 	ExportOutput    ExportOutput
 
 	ProgressManager progress.Manager
+
+	// Encryption, if set, decrypts the encrypted fields of the documents
+	// before they are exported.
+	Encryption *csfle.Client
+
+	// Limiter, if set, limits the rate at which documents are read.
+	Limiter *throttle.Limiter
+
+	// incremental tracks the high-water mark of an incremental export.
+	incremental *incrementalState
+
+	// resume tracks the last exported _id when the export is sorted on _id,
+	// so that a lost cursor or an interrupted export can be continued.
+	resume *resumeState
+
+	// output counts the bytes exported, for the offset of the resume state.
+	output *offsetWriter
+
+	// termChan is closed by HandleInterrupt to stop the export.
+	termChan chan struct{}
 }
 
 // ExportOutput is an interface that specifies how a document should be formatted
@@ -100,12 +136,92 @@ func (exp *MongoExport) ValidateSettings() error {
 		// special error for an empty type value
 		return fmt.Errorf("--type cannot be empty")
 	}
-	if exp.OutputOpts.Type != CSV && exp.OutputOpts.Type != JSON {
-		return fmt.Errorf("invalid output type '%v', choose 'json' or 'csv'", exp.OutputOpts.Type)
+	if exp.OutputOpts.Template != "" || exp.OutputOpts.TemplateFile != "" {
+		if exp.OutputOpts.Template != "" && exp.OutputOpts.TemplateFile != "" {
+			return fmt.Errorf("either --template or --templateFile can be specified as a template")
+		}
+		if exp.OutputOpts.Type != JSON && exp.OutputOpts.Type != TEMPLATE {
+			return fmt.Errorf("cannot use a template with --type=%v", exp.OutputOpts.Type)
+		}
+		if exp.OutputOpts.JSONArray || exp.OutputOpts.Pretty {
+			return fmt.Errorf("cannot use --jsonArray or --pretty with a template")
+		}
+		if _, err = parseExportTemplate(exp.OutputOpts.Template, exp.OutputOpts.TemplateFile); err != nil {
+			return err
+		}
+		exp.OutputOpts.Type = TEMPLATE
+	} else if exp.OutputOpts.Type == TEMPLATE {
+		return fmt.Errorf("--type=template requires --template or --templateFile")
+	}
+
+	if exp.OutputOpts.Type != CSV && exp.OutputOpts.Type != JSON && exp.OutputOpts.Type != SQL && exp.OutputOpts.Type != TEMPLATE {
+		return fmt.Errorf("invalid output type '%v', choose 'json', 'csv', 'sql' or 'template'", exp.OutputOpts.Type)
+	}
+
+	exp.OutputOpts.SQLFormat = strings.ToLower(exp.OutputOpts.SQLFormat)
+	switch exp.OutputOpts.SQLFormat {
+	case "", SQLInsert, SQLCopy:
+	default:
+		return fmt.Errorf("invalid --sqlFormat '%v', choose 'insert' or 'copy'", exp.OutputOpts.SQLFormat)
+	}
+
+	exp.OutputOpts.JSONFormat = strings.ToLower(exp.OutputOpts.JSONFormat)
+	switch exp.OutputOpts.JSONFormat {
+	case "", JSONFormatLegacy:
+	case bsonutil.ExtJSONCanonical, bsonutil.ExtJSONRelaxed:
+		if exp.OutputOpts.Type != JSON {
+			return fmt.Errorf("--jsonFormat can only be used with --type=json")
+		}
+		if exp.OutputOpts.DateFormat != "" || exp.OutputOpts.ObjectIdFormat != "" {
+			return fmt.Errorf("cannot use --dateFormat or --objectIdFormat with --jsonFormat=%v", exp.OutputOpts.JSONFormat)
+		}
+	default:
+		return fmt.Errorf("invalid --jsonFormat '%v', choose 'canonical', 'relaxed' or 'legacy'", exp.OutputOpts.JSONFormat)
+	}
+
+	exp.OutputOpts.ObjectIdFormat = strings.ToLower(exp.OutputOpts.ObjectIdFormat)
+	if err = validateValueFormats(exp.OutputOpts.DateFormat, exp.OutputOpts.ObjectIdFormat); err != nil {
+		return err
+	}
+
+	if exp.OutputOpts.ExcludeFields != "" {
+		if exp.OutputOpts.Fields != "" || exp.OutputOpts.FieldFile != "" {
+			return fmt.Errorf("cannot use --excludeFields with --fields or --fieldFile")
+		}
+		if exp.OutputOpts.Type == CSV || exp.OutputOpts.Type == SQL {
+			return fmt.Errorf("--excludeFields cannot be used with --type=%v, which requires a field list", exp.OutputOpts.Type)
+		}
+		if exp.InputOpts != nil && exp.InputOpts.ResumeFile != "" && exp.isExcluded("_id") {
+			return fmt.Errorf("cannot exclude _id when using --resumeFile")
+		}
+		if exp.InputOpts != nil && (exp.InputOpts.Since != "" || exp.InputOpts.StateFile != "") {
+			sinceField := exp.InputOpts.SinceField
+			if sinceField == "" {
+				sinceField = "_id"
+			}
+			if exp.isExcluded(sinceField) {
+				return fmt.Errorf("cannot exclude '%v', which is used for incremental export", sinceField)
+			}
+		}
+	}
+
+	if exp.OutputOpts.Flatten {
+		if exp.OutputOpts.Type != CSV {
+			return fmt.Errorf("--flatten can only be used with --type=csv")
+		}
+		exp.OutputOpts.FlattenArrays = strings.ToLower(exp.OutputOpts.FlattenArrays)
+		switch exp.OutputOpts.FlattenArrays {
+		case "", FlattenArraysIndex, FlattenArraysJSON:
+		default:
+			return fmt.Errorf("invalid --flattenArrays mode '%v', choose 'index' or 'json'", exp.OutputOpts.FlattenArrays)
+		}
+		if exp.OutputOpts.FlattenDepth < 0 {
+			return fmt.Errorf("--flattenDepth cannot be negative")
+		}
 	}
 
-	if exp.InputOpts.Query != "" && exp.InputOpts.ForceTableScan {
-		return fmt.Errorf("cannot use --forceTableScan when specifying --query")
+	if exp.InputOpts.HasQuery() && exp.InputOpts.ForceTableScan {
+		return fmt.Errorf("cannot use --forceTableScan when specifying --query or --queryFile")
 	}
 
 	if exp.InputOpts.Query != "" && exp.InputOpts.QueryFile != "" {
@@ -129,12 +245,101 @@ func (exp *MongoExport) ValidateSettings() error {
 			return err
 		}
 	}
+
+	if exp.InputOpts != nil {
+		if exp.InputOpts.BatchSize < 0 {
+			return fmt.Errorf("--batchSize cannot be negative")
+		}
+		if exp.InputOpts.Hint != "" {
+			if _, err = getHintFromArg(exp.InputOpts.Hint); err != nil {
+				return err
+			}
+		}
+	}
+
+	if exp.InputOpts != nil && (exp.InputOpts.Since != "" || exp.InputOpts.StateFile != "") {
+		if err = exp.loadIncrementalState(); err != nil {
+			return err
+		}
+	}
+
+	remote, err := storage.ParseURL(exp.OutputOpts.OutputFile)
+	if err != nil {
+		return err
+	}
+
+	if exp.InputOpts != nil && exp.InputOpts.ResumeFile != "" {
+		if remote != nil {
+			return fmt.Errorf("cannot use --resumeFile when writing to cloud storage")
+		}
+		if err = exp.loadResumeState(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadResumeState checks that the export can be resumed and loads the state
+// of a previous run from the resume file, if there is one.
+func (exp *MongoExport) loadResumeState() error {
+	if exp.OutputOpts.JSONArray {
+		return fmt.Errorf("cannot use --resumeFile with --jsonArray")
+	}
+	sortD, err := exp.getSort()
+	if err != nil {
+		return err
+	}
+	if !isIDSort(sortD) {
+		return fmt.Errorf("--resumeFile requires sorting on _id, e.g. --sort '{_id:1}'")
+	}
+
+	namespace := exp.namespace()
+	state, err := readResumeState(exp.InputOpts.ResumeFile)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		state = &resumeState{Namespace: namespace}
+	} else if state.Namespace != namespace {
+		return fmt.Errorf("resume file '%v' belongs to an export of '%v', not '%v'",
+			exp.InputOpts.ResumeFile, state.Namespace, namespace)
+	}
+	exp.resume = state
 	return nil
 }
 
+// namespace returns the full name of the exported collection.
+func (exp *MongoExport) namespace() string {
+	return fmt.Sprintf("%v.%v", exp.ToolOptions.Namespace.DB, exp.ToolOptions.Namespace.Collection)
+}
+
+// isResuming returns true if documents have already been exported by a
+// previous run or by a cursor that was lost.
+func (exp *MongoExport) isResuming() bool {
+	return exp.resume != nil && exp.resume.Exported > 0
+}
+
+// saveResumeState writes the resume state to the resume file, if there is one.
+func (exp *MongoExport) saveResumeState() error {
+	if exp.resume == nil || exp.InputOpts == nil || exp.InputOpts.ResumeFile == "" {
+		return nil
+	}
+	return exp.resume.write(exp.InputOpts.ResumeFile)
+}
+
 // GetOutputWriter opens and returns an io.WriteCloser for the output
 // options or nil if none is set. The caller is responsible for closing it.
+// Outputs in cloud storage are only complete once the writer is closed
+// without error.
 func (exp *MongoExport) GetOutputWriter() (io.WriteCloser, error) {
+	remote, err := storage.ParseURL(exp.OutputOpts.OutputFile)
+	if err != nil {
+		return nil, err
+	}
+	if remote != nil {
+		return newRemoteWriter(remote)
+	}
+
 	if exp.OutputOpts.OutputFile != "" {
 		// If the directory in which the output file is to be
 		// written does not exist, create it
@@ -144,7 +349,16 @@ func (exp *MongoExport) GetOutputWriter() (io.WriteCloser, error) {
 			return nil, err
 		}
 
-		file, err := os.Create(util.ToUniversalPath(exp.OutputOpts.OutputFile))
+		filename := util.ToUniversalPath(exp.OutputOpts.OutputFile)
+		if exp.isResuming() {
+			// continue the output of the interrupted export
+			file, err := openResumedOutput(filename, exp.resume.Offset)
+			if err != nil {
+				return nil, err
+			}
+			return file, nil
+		}
+		file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 		if err != nil {
 			return nil, err
 		}
@@ -176,6 +390,29 @@ func makeFieldSelector(fields string) bson.M {
 	return selector
 }
 
+// makeExclusionSelector takes a comma-delimited set of field names and builds
+// a projection that excludes them, e.g. "a,b.c" -> {a:0, "b.c":0}.
+func makeExclusionSelector(fields string) bson.M {
+	selector := bson.M{}
+	for _, field := range strings.Split(fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			selector[field] = 0
+		}
+	}
+	return selector
+}
+
+// isExcluded returns true if --excludeFields removes the given field, either
+// directly or by excluding one of its parents.
+func (exp *MongoExport) isExcluded(field string) bool {
+	for excluded := range makeExclusionSelector(exp.OutputOpts.ExcludeFields) {
+		if field == excluded || strings.HasPrefix(field, excluded+".") {
+			return true
+		}
+	}
+	return false
+}
+
 // getCount returns an estimate of how many documents the cursor will fetch
 // It always returns Limit if there is a limit, assuming that in general
 // limits will less then the total possible.
@@ -191,7 +428,7 @@ func (exp *MongoExport) getCount() (c int, err error) {
 	if exp.InputOpts != nil && exp.InputOpts.Limit != 0 {
 		return exp.InputOpts.Limit, nil
 	}
-	if exp.InputOpts != nil && exp.InputOpts.Query != "" {
+	if exp.InputOpts != nil && (exp.InputOpts.HasQuery() || exp.incremental != nil) {
 		return 0, nil
 	}
 	mgoCollection := session.DB(exp.ToolOptions.Namespace.DB).C(exp.ToolOptions.Namespace.Collection)
@@ -224,22 +461,18 @@ func (exp *MongoExport) getCount() (c int, err error) {
 // getCursor returns a cursor that can be iterated over to get all the documents
 // to export, based on the options given to mongoexport. Also returns the
 // associated session, so that it can be closed once the cursor is used up.
-func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
-	sortFields := []string{}
-	if exp.InputOpts != nil && exp.InputOpts.Sort != "" {
-		sortD, err := getSortFromArg(exp.InputOpts.Sort)
-		if err != nil {
-			return nil, nil, err
-		}
-		sortFields, err = bsonutil.MakeSortString(sortD)
-		if err != nil {
-			return nil, nil, err
-		}
+func (exp *MongoExport) getCursor() (*db.PrefetchingIter, *mgo.Session, error) {
+	sortD, err := exp.getSort()
+	if err != nil {
+		return nil, nil, err
+	}
+	sortFields, err := bsonutil.MakeSortString(sortD)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	query := map[string]interface{}{}
 	if exp.InputOpts != nil && exp.InputOpts.HasQuery() {
-		var err error
 		content, err := exp.InputOpts.GetQuery()
 		if err != nil {
 			return nil, nil, err
@@ -250,6 +483,10 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 		}
 	}
 
+	if exp.incremental != nil && exp.incremental.Since != nil {
+		query = afterValueQuery(query, exp.incremental.Field, exp.incremental.Since)
+	}
+
 	session, err := exp.SessionProvider.GetSession()
 	if err != nil {
 		return nil, nil, err
@@ -265,7 +502,7 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 	flags := 0
 	// don't snapshot if we've been asked not to,
 	// or if we cannot because  we are querying, sorting, or if the collection is a view
-	if !exp.InputOpts.ForceTableScan && len(query) == 0 && exp.InputOpts != nil && exp.InputOpts.Sort == "" && !collInfo.IsView() && !collInfo.IsSystemCollection() {
+	if !exp.InputOpts.ForceTableScan && len(query) == 0 && exp.InputOpts != nil && len(sortD) == 0 && exp.InputOpts.Hint == "" && !collInfo.IsView() && !collInfo.IsSystemCollection() {
 		flags = flags | db.Snapshot
 	}
 
@@ -278,6 +515,16 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 		limit = exp.InputOpts.Limit
 	}
 
+	// continue after the last exported document; the skip has already
+	// been applied and the limit counts the documents already exported
+	if exp.isResuming() {
+		query = afterIDQuery(query, exp.resume.LastID)
+		skip = 0
+		if limit > 0 {
+			limit -= int(exp.resume.Exported)
+		}
+	}
+
 	if exp.InputOpts.AssertExists {
 		collNames, err := session.DB(exp.ToolOptions.Namespace.DB).CollectionNames()
 		if err != nil {
@@ -293,18 +540,70 @@ func (exp *MongoExport) getCursor() (*mgo.Iter, *mgo.Session, error) {
 	q := collection.Find(query).Sort(sortFields...).Skip(skip).Limit(limit)
 
 	if len(exp.OutputOpts.Fields) > 0 {
-		q.Select(makeFieldSelector(exp.OutputOpts.Fields))
+		selector := makeFieldSelector(exp.OutputOpts.Fields)
+		if exp.incremental != nil {
+			// the high-water mark is read from the exported documents
+			if err = exp.incremental.project(selector); err != nil {
+				return nil, session, err
+			}
+		}
+		q.Select(selector)
+	} else if exp.OutputOpts.ExcludeFields != "" {
+		q.Select(makeExclusionSelector(exp.OutputOpts.ExcludeFields))
+	}
+
+	if exp.InputOpts != nil && exp.InputOpts.Hint != "" {
+		hint, err := getHintFromArg(exp.InputOpts.Hint)
+		if err != nil {
+			return nil, session, err
+		}
+		q.Hint(hint...)
 	}
 
+	// with throttling, small batches keep the server from reading far ahead
+	// of what is exported
+	batchSize := 0
+	if exp.InputOpts != nil && exp.InputOpts.BatchSize > 0 {
+		batchSize = exp.InputOpts.BatchSize
+	} else if docsPerSec := exp.Limiter.DocsPerSec(); docsPerSec > 0 {
+		batchSize = docsPerSec
+	}
+	if batchSize > 0 {
+		q.Batch(batchSize)
+	}
+
+	// fetch the next batch while the current one is being exported, unless
+	// reads are throttled, in which case at most a batch is read ahead
+	prefetch := batchSize
+	if exp.Limiter == nil {
+		flags |= db.Prefetch
+	} else if prefetch == 0 {
+		prefetch = 1
+	}
 	q = db.ApplyFlags(q, session, flags)
 
-	return q.Iter(), session, nil
+	return db.NewPrefetchingIter(q.Iter(), prefetch, exp.Limiter), session, nil
 
 }
 
+// getSort returns the sort specification for the export. Resumable exports
+// are sorted on _id if no sort was given.
+func (exp *MongoExport) getSort() (bson.D, error) {
+	if exp.InputOpts == nil {
+		return nil, nil
+	}
+	if exp.InputOpts.Sort != "" {
+		return getSortFromArg(exp.InputOpts.Sort)
+	}
+	if exp.InputOpts.ResumeFile != "" {
+		return bson.D{{Name: "_id", Value: 1}}, nil
+	}
+	return nil, nil
+}
+
 // Internal function that handles exporting to the given writer. Used primarily
 // for testing, because it bypasses writing to the file system.
-func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
+func (exp *MongoExport) exportInternal(out io.Writer) (_ int64, err error) {
 
 	max, err := exp.getCount()
 	if err != nil {
@@ -313,22 +612,55 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 
 	watchProgressor := progress.NewCounter(int64(max))
 	if exp.ProgressManager != nil {
-		name := fmt.Sprintf("%v.%v", exp.ToolOptions.Namespace.DB, exp.ToolOptions.Namespace.Collection)
+		name := exp.namespace()
 		exp.ProgressManager.Attach(name, watchProgressor)
-		defer exp.ProgressManager.Detach(name)
+		defer func() { progress.Finish(exp.ProgressManager, name, err) }()
 	}
 
-	exportOutput, err := exp.getExportOutput(out)
+	exp.output = &offsetWriter{Writer: out}
+	if exp.isResuming() {
+		exp.output.offset = exp.resume.Offset
+	}
+	exportOutput, err := exp.getExportOutput(exp.output)
 	if err != nil {
 		return 0, err
 	}
 
+	// exports sorted on _id can be continued after the last exported
+	// document if the cursor is lost
+	if exp.resume == nil {
+		sortD, err := exp.getSort()
+		if err != nil {
+			return 0, err
+		}
+		if isIDSort(sortD) && !exp.isExcluded("_id") {
+			exp.resume = &resumeState{Namespace: exp.namespace()}
+		}
+	}
+
+	resuming := exp.isResuming()
+	if resuming {
+		log.Logvf(log.Always, "resuming export after _id %v (%v documents previously exported)",
+			exp.resume.LastID, exp.resume.Exported)
+		limit := 0
+		if exp.InputOpts != nil {
+			limit = exp.InputOpts.Limit
+		}
+		if limit > 0 && exp.resume.Exported >= int64(limit) {
+			return 0, exp.finishResumableExport()
+		}
+	}
+
 	cursor, session, err := exp.getCursor()
 	if err != nil {
 		return 0, err
 	}
-	defer session.Close()
-	defer cursor.Close()
+	defer func() {
+		if cursor != nil {
+			cursor.Close()
+			session.Close()
+		}
+	}()
 
 	connURL := exp.ToolOptions.Host
 	if connURL == "" {
@@ -339,29 +671,92 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 	}
 	log.Logvf(log.Always, "connected to: %v", connURL)
 
-	// Write headers
-	err = exportOutput.WriteHeader()
-	if err != nil {
-		return 0, err
+	// Write headers, unless they were written by the interrupted export
+	if !resuming {
+		err = exportOutput.WriteHeader()
+		if err != nil {
+			return 0, err
+		}
 	}
 
 	var result bson.D
 
 	docsCount := int64(0)
+	retries := 0
 
 	// Write document content
-	for cursor.Next(&result) {
-		err := exportOutput.ExportDocument(result)
+	for {
+		for exp.next(cursor, &result) {
+			if exp.Encryption != nil {
+				if _, err := exp.Encryption.Decrypt(result); err != nil {
+					exp.checkpoint(exportOutput)
+					return docsCount, err
+				}
+			}
+			if exp.incremental != nil {
+				exp.incremental.observe(result)
+				result = exp.incremental.strip(result)
+			}
+			var id interface{}
+			if exp.resume != nil {
+				// ExportDocument converts the document in place, so the
+				// _id must be captured first
+				id, _ = bsonutil.FindValueByKey("_id", &result)
+			}
+			err := exportOutput.ExportDocument(result)
+			if err != nil {
+				exp.checkpoint(exportOutput)
+				return docsCount, err
+			}
+			docsCount++
+			if docsCount%watchProgressorUpdateFrequency == 0 {
+				watchProgressor.Set(docsCount)
+			}
+			if exp.resume != nil {
+				exp.resume.LastID = id
+				exp.resume.Exported++
+				if exp.resume.Exported%resumeCheckpointInterval == 0 {
+					if err = exp.checkpoint(exportOutput); err != nil {
+						return docsCount, err
+					}
+				}
+			}
+			select {
+			case <-exp.termChan:
+				// only a complete export moves the --stateFile high-water
+				// mark, since the documents aren't exported in its order
+				log.Logvf(log.DebugHigh, "terminating export")
+				watchProgressor.Set(docsCount)
+				if err = exp.checkpoint(exportOutput); err != nil {
+					return docsCount, err
+				}
+				return docsCount, util.ErrTerminated
+			default:
+			}
+		}
+		err = cursor.Err()
+		if err == nil || exp.resume == nil || !db.IsCursorLostError(err) ||
+			exp.InputOpts == nil || retries >= exp.InputOpts.CursorRetries {
+			break
+		}
+
+		// re-establish the cursor after the last exported document
+		retries++
+		log.Logvf(log.Always, "cursor lost (%v), re-establishing cursor after _id %v (attempt %v of %v)",
+			err, exp.resume.LastID, retries, exp.InputOpts.CursorRetries)
+		cursor.Close()
+		session.Close()
+		cursor, session, err = exp.getCursor()
 		if err != nil {
+			// the deferred cleanup must not touch the closed cursor
+			cursor, session = nil, nil
+			exp.checkpoint(exportOutput)
 			return docsCount, err
 		}
-		docsCount++
-		if docsCount%watchProgressorUpdateFrequency == 0 {
-			watchProgressor.Set(docsCount)
-		}
 	}
 	watchProgressor.Set(docsCount)
-	if err := cursor.Err(); err != nil {
+	if err != nil {
+		exp.checkpoint(exportOutput)
 		return docsCount, err
 	}
 
@@ -371,49 +766,183 @@ func (exp *MongoExport) exportInternal(out io.Writer) (int64, error) {
 		return docsCount, err
 	}
 	exportOutput.Flush()
-	return docsCount, nil
+	if err = exp.saveIncrementalState(); err != nil {
+		return docsCount, err
+	}
+	return docsCount, exp.finishResumableExport()
+}
+
+// checkpoint flushes the output and records the last exported _id and the
+// size of the output in the resume file, so that every document recorded as
+// exported has been written, and no other.
+func (exp *MongoExport) checkpoint(exportOutput ExportOutput) error {
+	if err := exportOutput.Flush(); err != nil {
+		return err
+	}
+	if exp.resume != nil && exp.output != nil {
+		exp.resume.Offset = exp.output.offset
+	}
+	return exp.saveResumeState()
+}
+
+// next reads the next document from the cursor at the rate the Limiter
+// allows. The cursor reports the time spent waiting on the server to it.
+func (exp *MongoExport) next(cursor *db.PrefetchingIter, result *bson.D) bool {
+	if !cursor.Next(result) {
+		return false
+	}
+	size := 0
+	if exp.Limiter.LimitsBytes() {
+		if raw, err := bson.Marshal(result); err == nil {
+			size = len(raw)
+		}
+	}
+	exp.Limiter.Wait(1, size)
+	return true
+}
+
+// finishResumableExport removes the resume file once the export is complete.
+func (exp *MongoExport) finishResumableExport() error {
+	if exp.resume == nil || exp.InputOpts == nil || exp.InputOpts.ResumeFile == "" {
+		return nil
+	}
+	err := os.Remove(exp.InputOpts.ResumeFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing resume file: %v", err)
+	}
+	return nil
+}
+
+// HandleInterrupt stops the export after the document being written, whose
+// output is flushed and recorded in the resume file, if there is one; Export
+// then returns util.ErrTerminated.
+func (exp *MongoExport) HandleInterrupt() {
+	if exp.termChan != nil {
+		close(exp.termChan)
+	}
 }
 
 // Export executes the entire export operation. It returns an integer of the count
 // of documents successfully exported, and a non-nil error if something went wrong
 // during the export operation.
 func (exp *MongoExport) Export(out io.Writer) (int64, error) {
+	exp.termChan = make(chan struct{})
 	count, err := exp.exportInternal(out)
 	return count, err
 }
 
+// getValueFormatter returns the ValueFormatter for the output options, or
+// nil if dates and ObjectIds should be written unchanged.
+func (exp *MongoExport) getValueFormatter() *ValueFormatter {
+	formatter := &ValueFormatter{
+		DateFormat:     exp.OutputOpts.DateFormat,
+		ObjectIdFormat: exp.OutputOpts.ObjectIdFormat,
+	}
+	if !formatter.IsEnabled() {
+		return nil
+	}
+	return formatter
+}
+
 // getExportOutput returns an implementation of ExportOutput which can handle
 // transforming BSON documents into the appropriate output format and writing
 // them to an output stream.
 func (exp *MongoExport) getExportOutput(out io.Writer) (ExportOutput, error) {
-	if exp.OutputOpts.Type == CSV {
-		// TODO what if user specifies *both* --fields and --fieldFile?
-		var fields []string
-		var err error
-		if len(exp.OutputOpts.Fields) > 0 {
-			fields = strings.Split(exp.OutputOpts.Fields, ",")
-		} else if exp.OutputOpts.FieldFile != "" {
-			fields, err = util.GetFieldsFromFile(exp.OutputOpts.FieldFile)
-			if err != nil {
-				return nil, err
+	if exp.OutputOpts.Type == TEMPLATE {
+		tmpl, err := parseExportTemplate(exp.OutputOpts.Template, exp.OutputOpts.TemplateFile)
+		if err != nil {
+			return nil, err
+		}
+		tmplOutput := NewTemplateExportOutput(tmpl, out)
+		tmplOutput.Formatter.DateFormat = exp.OutputOpts.DateFormat
+		if exp.OutputOpts.ObjectIdFormat != "" {
+			tmplOutput.Formatter.ObjectIdFormat = exp.OutputOpts.ObjectIdFormat
+		}
+		return tmplOutput, nil
+	}
+
+	if exp.OutputOpts.Type == SQL {
+		exportFields, err := exp.getExportFields("SQL")
+		if err != nil {
+			return nil, err
+		}
+		var columns []string
+		if exp.OutputOpts.SQLColumns != "" {
+			columns = strings.Split(exp.OutputOpts.SQLColumns, ",")
+			if len(columns) != len(exportFields) {
+				return nil, fmt.Errorf("--sqlColumns lists %v columns but %v fields are exported",
+					len(columns), len(exportFields))
 			}
-		} else {
-			return nil, fmt.Errorf("CSV mode requires a field list")
+		}
+		table := exp.OutputOpts.SQLTable
+		if table == "" {
+			table = exp.ToolOptions.Namespace.Collection
+		}
+		format := exp.OutputOpts.SQLFormat
+		if format == "" {
+			format = SQLInsert
+		}
+		sqlOutput := NewSQLExportOutput(exportFields, table, columns, format, out)
+		sqlOutput.Formatter = exp.getValueFormatter()
+		return sqlOutput, nil
+	}
+
+	if exp.OutputOpts.Type == CSV {
+		exportFields, err := exp.getExportFields("CSV")
+		if err != nil {
+			return nil, err
 		}
 
-		exportFields := make([]string, 0, len(fields))
-		for _, field := range fields {
-			// for '$' field projections, exclude '.$' from the field name
-			if i := strings.LastIndex(field, "."); i != -1 && field[i+1:] == "$" {
-				exportFields = append(exportFields, field[:i])
-			} else {
-				exportFields = append(exportFields, field)
+		csvOutput := NewCSVExportOutput(exportFields, exp.OutputOpts.NoHeaderLine, out)
+		csvOutput.Formatter = exp.getValueFormatter()
+		if exp.OutputOpts.Flatten {
+			separator := exp.OutputOpts.FlattenSeparator
+			if separator == "" {
+				separator = "."
+			}
+			csvOutput.Flatten = &CSVFlattenOptions{
+				FlattenOptions: bsonutil.FlattenOptions{
+					ExpandArrays: exp.OutputOpts.FlattenArrays == FlattenArraysIndex,
+					MaxDepth:     exp.OutputOpts.FlattenDepth,
+				},
+				Separator: separator,
 			}
 		}
+		return csvOutput, nil
+	}
+	jsonOutput := NewJSONExportOutput(exp.OutputOpts.JSONArray, exp.OutputOpts.Pretty, out)
+	jsonOutput.Formatter = exp.getValueFormatter()
+	jsonOutput.JSONFormat = exp.OutputOpts.JSONFormat
+	return jsonOutput, nil
+}
 
-		return NewCSVExportOutput(exportFields, exp.OutputOpts.NoHeaderLine, out), nil
+// getExportFields returns the list of fields to export for output formats
+// which require one, as given by --fields or --fieldFile.
+func (exp *MongoExport) getExportFields(mode string) ([]string, error) {
+	// TODO what if user specifies *both* --fields and --fieldFile?
+	var fields []string
+	var err error
+	if len(exp.OutputOpts.Fields) > 0 {
+		fields = strings.Split(exp.OutputOpts.Fields, ",")
+	} else if exp.OutputOpts.FieldFile != "" {
+		fields, err = util.GetFieldsFromFile(exp.OutputOpts.FieldFile)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, fmt.Errorf("%v mode requires a field list", mode)
 	}
-	return NewJSONExportOutput(exp.OutputOpts.JSONArray, exp.OutputOpts.Pretty, out), nil
+
+	exportFields := make([]string, 0, len(fields))
+	for _, field := range fields {
+		// for '$' field projections, exclude '.$' from the field name
+		if i := strings.LastIndex(field, "."); i != -1 && field[i+1:] == "$" {
+			exportFields = append(exportFields, field[:i])
+		} else {
+			exportFields = append(exportFields, field)
+		}
+	}
+	return exportFields, nil
 }
 
 // getObjectFromByteArg takes an object in extended JSON, and converts it to an object that
@@ -433,6 +962,19 @@ func getObjectFromByteArg(queryRaw []byte) (map[string]interface{}, error) {
 	return parsedJSON, nil
 }
 
+// getHintFromArg takes an index key pattern in JSON and returns it as the
+// list of keys accepted by mgo's Query.Hint, e.g. {a:1, b:-1} -> ["+a", "-b"].
+func getHintFromArg(hintRaw string) ([]string, error) {
+	hintD, err := getSortFromArg(hintRaw)
+	if err != nil {
+		return nil, fmt.Errorf("hint '%v' is not valid JSON: %v", hintRaw, err)
+	}
+	if len(hintD) == 0 {
+		return nil, fmt.Errorf("hint cannot be empty")
+	}
+	return bsonutil.MakeSortString(hintD)
+}
+
 // getSortFromArg takes a sort specification in JSON and returns it as a bson.D
 // object which preserves the ordering of the keys as they appear in the input.
 func getSortFromArg(queryRaw string) (bson.D, error) {
@@ -8,6 +8,7 @@ package mongoexport
 
 import (
 	"encoding/json"
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -49,3 +50,85 @@ func TestFieldSelect(t *testing.T) {
 		So(makeFieldSelector("x,foo.baz"), ShouldResemble, bson.M{"_id": 1, "foo": 1, "x": 1})
 	})
 }
+
+func TestExcludeFields(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Using makeExclusionSelector should return an exclusion projection", t, func() {
+		So(makeExclusionSelector("a, b.c"), ShouldResemble, bson.M{"a": 0, "b.c": 0})
+		So(makeExclusionSelector(""), ShouldResemble, bson.M{})
+	})
+
+	Convey("Excluding a field should exclude its subfields", t, func() {
+		exp := MongoExport{OutputOpts: &OutputFormatOptions{ExcludeFields: "blob,meta"}}
+		So(exp.isExcluded("blob"), ShouldBeTrue)
+		So(exp.isExcluded("meta.updated"), ShouldBeTrue)
+		So(exp.isExcluded("_id"), ShouldBeFalse)
+		So(exp.isExcluded("metadata"), ShouldBeFalse)
+	})
+}
+
+func TestGetQueryFromFile(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A query filter should be read from --queryFile", t, func() {
+		file, err := ioutil.TempFile("", "mongoexport-query")
+		So(err, ShouldBeNil)
+		defer os.Remove(file.Name())
+		_, err = file.WriteString(`{"_id": {"$in": [1, 2, 3]}}`)
+		So(err, ShouldBeNil)
+		So(file.Close(), ShouldBeNil)
+
+		inputOpts := &InputOptions{QueryFile: file.Name()}
+		So(inputOpts.HasQuery(), ShouldBeTrue)
+		content, err := inputOpts.GetQuery()
+		So(err, ShouldBeNil)
+		query, err := getObjectFromByteArg(content)
+		So(err, ShouldBeNil)
+		So(query, ShouldContainKey, "_id")
+
+		Convey("and an unreadable file should be reported", func() {
+			inputOpts = &InputOptions{QueryFile: file.Name() + ".missing"}
+			_, err = inputOpts.GetQuery()
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("A query filter read from stdin should be returned every time it is read", t, func() {
+		reader, writer, err := os.Pipe()
+		So(err, ShouldBeNil)
+		stdin := os.Stdin
+		os.Stdin = reader
+		defer func() {
+			os.Stdin = stdin
+			reader.Close()
+		}()
+		_, err = writer.WriteString(`{"_id": {"$in": [1, 2, 3]}}`)
+		So(err, ShouldBeNil)
+		So(writer.Close(), ShouldBeNil)
+
+		inputOpts := &InputOptions{QueryFile: "-"}
+		for i := 0; i < 2; i++ {
+			content, err := inputOpts.GetQuery()
+			So(err, ShouldBeNil)
+			query, err := getObjectFromByteArg(content)
+			So(err, ShouldBeNil)
+			So(query, ShouldContainKey, "_id")
+		}
+	})
+}
+
+func TestGetHint(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Index key patterns should be converted to hint keys", t, func() {
+		hint, err := getHintFromArg("{a:1, b:-1}")
+		So(err, ShouldBeNil)
+		So(hint, ShouldResemble, []string{"+a", "-b"})
+
+		_, err = getHintFromArg("{}")
+		So(err, ShouldNotBeNil)
+		_, err = getHintFromArg("a_1")
+		So(err, ShouldNotBeNil)
+	})
+}
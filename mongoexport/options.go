@@ -9,11 +9,12 @@ package mongoexport
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
 )
 
 var Usage = `<options>
 
-Export data from MongoDB in CSV or JSON format.
+Export data from MongoDB in CSV, JSON or SQL format.
 
 See http://docs.mongodb.org/manual/reference/program/mongoexport/ for more information.`
 
@@ -25,14 +26,17 @@ type OutputFormatOptions struct {
 	// FieldFile is a filename that refers to a list of fields to export, 1 per line.
 	FieldFile string `long:"fieldFile" value-name:"<filename>" description:"file with field names - 1 per line"`
 
-	// Type selects the type of output to export as (json or csv).
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"the output format, either json or csv (defaults to 'json')"`
+	// ExcludeFields is an option to specify comma-separated fields to leave out of the export.
+	ExcludeFields string `long:"excludeFields" value-name:"<field>[,<field>]*" description:"comma separated list of field names to leave out of exported documents e.g. --excludeFields \"blob,meta.internal\" "`
+
+	// Type selects the type of output to export as (json, csv, or sql).
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"the output format, either json, csv, sql or template (defaults to 'json')"`
 
 	// Deprecated: allow legacy --csv option in place of --type=csv
 	CSVOutputType bool `long:"csv" default:"false" hidden:"true"`
 
 	// OutputFile specifies an output file path.
-	OutputFile string `long:"out" value-name:"<filename>" short:"o" description:"output file; if not specified, stdout is used"`
+	OutputFile string `long:"out" value-name:"<filename>" short:"o" description:"output file, or an s3://<bucket>/<key>, gs://<bucket>/<key> or az://<container>/<blob> URL (compressed if the key ends in .gz); if not specified, stdout is used"`
 
 	// JSONArray if set will export the documents an array of JSON documents.
 	JSONArray bool `long:"jsonArray" description:"output to a JSON array rather than one object per line"`
@@ -40,8 +44,44 @@ type OutputFormatOptions struct {
 	// Pretty displays JSON data in a human-readable form.
 	Pretty bool `long:"pretty" description:"output JSON formatted to be human-readable"`
 
+	// JSONFormat selects the extended JSON dialect used for JSON output.
+	JSONFormat string `long:"jsonFormat" value-name:"<type>" description:"the extended JSON format to output, either canonical or relaxed (v2), or legacy (defaults to 'legacy')"`
+
 	// NoHeaderLine, if set, will export CSV data without a list of field names at the first line.
 	NoHeaderLine bool `long:"noHeaderLine" description:"export CSV data without a list of field names at the first line"`
+
+	// SQLTable is the table name used in SQL output.
+	SQLTable string `long:"sqlTable" value-name:"<table>" description:"table name used in SQL output (defaults to the collection name)"`
+
+	// SQLColumns maps each exported field to a column name in SQL output.
+	SQLColumns string `long:"sqlColumns" value-name:"<column>[,<column>]*" description:"comma separated column names for SQL output, one per exported field (defaults to the field names with '.' replaced by '_')"`
+
+	// SQLFormat selects INSERT statements or PostgreSQL COPY data for SQL output.
+	SQLFormat string `long:"sqlFormat" value-name:"<format>" default:"insert" default-mask:"-" description:"SQL output style, either insert (one INSERT statement per document) or copy (PostgreSQL COPY data) (defaults to 'insert')"`
+
+	// Template is a Go text/template used to render each document.
+	Template string `long:"template" value-name:"<template>" description:"render each document with a Go template, e.g. '{{._id}},{{.user.name}}\\n'"`
+
+	// TemplateFile is a file containing a Go text/template used to render each document.
+	TemplateFile string `long:"templateFile" value-name:"<filename>" description:"file containing a Go template used to render each document"`
+
+	// DateFormat controls how dates are written, either as epoch milliseconds or with a Go time layout.
+	DateFormat string `long:"dateFormat" value-name:"<format>" description:"write dates as 'millis' since the epoch or with a Go time layout in UTC, e.g. '2006-01-02 15:04:05'"`
+
+	// ObjectIdFormat controls how ObjectIds are written.
+	ObjectIdFormat string `long:"objectIdFormat" value-name:"<format>" description:"write ObjectIds as 'hex' strings or as 'extjson' $oid documents"`
+
+	// Flatten, if set, expands nested documents in CSV output into one column per nested field.
+	Flatten bool `long:"flatten" description:"expand nested documents in CSV output into one column per nested field, using the first document to determine the columns"`
+
+	// FlattenSeparator joins the parts of a nested field name in the CSV header.
+	FlattenSeparator string `long:"flattenSeparator" value-name:"<string>" default:"." default-mask:"-" description:"separator between nested field names in the CSV header when using --flatten (defaults to '.')"`
+
+	// FlattenArrays selects whether arrays are expanded by index or written as JSON.
+	FlattenArrays string `long:"flattenArrays" value-name:"<mode>" default:"json" default-mask:"-" description:"how --flatten handles arrays, either index (one column per element) or json (defaults to 'json')"`
+
+	// FlattenDepth limits how many levels of nesting are expanded.
+	FlattenDepth int `long:"flattenDepth" value-name:"<depth>" description:"maximum number of nesting levels expanded by --flatten; deeper values are written as JSON (defaults to unlimited)"`
 }
 
 // Name returns a human-readable group name for output format options.
@@ -52,14 +92,24 @@ func (*OutputFormatOptions) Name() string {
 // InputOptions defines the set of options to use in retrieving data from the server.
 type InputOptions struct {
 	Query          string `long:"query" value-name:"<json>" short:"q" description:"query filter, as a JSON string, e.g., '{x:{$gt:1}}'"`
-	QueryFile      string `long:"queryFile" value-name:"<filename>" description:"path to a file containing a query filter (JSON)"`
+	QueryFile      string `long:"queryFile" value-name:"<filename>" description:"path to a file containing a query filter (JSON), or '-' to read it from stdin"`
 	SlaveOk        bool   `long:"slaveOk" short:"k" description:"allow secondary reads if available (default true)" default:"false" default-mask:"-"`
-	ReadPreference string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference name or a preference json object"`
+	ReadPreference string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference name or a preference json object, which may set maxStalenessSeconds and hedge, e.g. '{mode: \"nearest\", maxStalenessSeconds: 120, hedge: {enabled: true}}'"`
 	ForceTableScan bool   `long:"forceTableScan" description:"force a table scan (do not use $snapshot)"`
 	Skip           int    `long:"skip" value-name:"<count>" description:"number of documents to skip"`
 	Limit          int    `long:"limit" value-name:"<count>" description:"limit the number of documents to export"`
 	Sort           string `long:"sort" value-name:"<json>" description:"sort order, as a JSON string, e.g. '{x:1}'"`
 	AssertExists   bool   `long:"assertExists" default:"false" description:"if specified, export fails if the collection does not exist"`
+	BatchSize      int    `long:"batchSize" value-name:"<count>" description:"number of documents the server returns per batch (defaults to --maxDocsPerSec if set, otherwise the server default)"`
+	Hint           string `long:"hint" value-name:"<json>" description:"index key pattern the query should use, as a JSON string, e.g. '{createdAt:1}'"`
+	Since          string `long:"since" value-name:"<value>" description:"only export documents whose --sinceField is greater than the given ObjectId, date or extended JSON value"`
+	SinceField     string `long:"sinceField" value-name:"<field>" default:"_id" default-mask:"-" description:"field compared against --since, e.g. an update timestamp (defaults to '_id')"`
+	StateFile      string `long:"stateFile" value-name:"<filename>" description:"file recording the greatest --sinceField value exported, used in place of --since by the next run"`
+	ResumeFile     string `long:"resumeFile" value-name:"<filename>" description:"file recording the last exported _id, used to continue an interrupted export (implies --sort '{_id:1}')"`
+	CursorRetries  int    `long:"cursorRetries" value-name:"<count>" default:"3" default-mask:"-" description:"number of times to re-establish a lost cursor when sorting on _id (defaults to 3)"`
+
+	// the query read by GetQuery, as stdin can only be read once
+	query []byte
 }
 
 // Name returns a human-readable group name for input options.
@@ -71,15 +121,28 @@ func (inputOptions *InputOptions) HasQuery() bool {
 	return inputOptions.Query != "" || inputOptions.QueryFile != ""
 }
 
+// GetQuery returns the query given with --query or read from --queryFile.
+// The file is only read the first time, so the query can be read from stdin
+// more than once.
 func (inputOptions *InputOptions) GetQuery() ([]byte, error) {
 	if inputOptions.Query != "" {
 		return []byte(inputOptions.Query), nil
+	} else if inputOptions.query != nil {
+		return inputOptions.query, nil
+	} else if inputOptions.QueryFile == "-" {
+		content, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("error reading query from stdin: %s", err)
+		}
+		inputOptions.query = content
+		return content, nil
 	} else if inputOptions.QueryFile != "" {
 		content, err := ioutil.ReadFile(inputOptions.QueryFile)
 		if err != nil {
-			err = fmt.Errorf("error reading queryFile: %s", err)
+			return nil, fmt.Errorf("error reading queryFile: %s", err)
 		}
-		return content, err
+		inputOptions.query = content
+		return content, nil
 	}
 	panic("GetQuery can return valid values only for query or queryFile input")
 }
@@ -0,0 +1,59 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"compress/gzip"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/storage"
+)
+
+// remoteWriter streams the export to cloud storage, gzip-compressing it if
+// the object name ends in ".gz".
+type remoteWriter struct {
+	upload storage.Writer
+	gzip   *gzip.Writer
+}
+
+func newRemoteWriter(output *storage.Object) (*remoteWriter, error) {
+	backend, err := storage.NewBackend(output.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	upload, err := backend.Create(output.Bucket, output.Key)
+	if err != nil {
+		return nil, err
+	}
+	writer := &remoteWriter{upload: upload}
+	if strings.HasSuffix(output.Key, ".gz") {
+		writer.gzip = gzip.NewWriter(writer.upload)
+	}
+	return writer, nil
+}
+func (w *remoteWriter) Write(p []byte) (int, error) {
+	if w.gzip != nil {
+		return w.gzip.Write(p)
+	}
+	return w.upload.Write(p)
+}
+
+// Close flushes any compressed data and completes the upload.
+func (w *remoteWriter) Close() error {
+	if w.gzip != nil {
+		if err := w.gzip.Close(); err != nil {
+			w.upload.Abort()
+			return err
+		}
+	}
+	return w.upload.Close()
+}
+
+// Abort discards the upload after a failed export.
+func (w *remoteWriter) Abort() error {
+	return w.upload.Abort()
+}
@@ -0,0 +1,182 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// resumeCheckpointInterval is the number of documents exported between
+// updates of the resume file.
+const resumeCheckpointInterval = 1000
+
+// resumeState records how far an export has progressed, so that an export
+// sorted on _id can continue after the last exported document.
+type resumeState struct {
+	// Namespace is the namespace being exported, to guard against resuming
+	// a different export with the same resume file.
+	Namespace string
+
+	// LastID is the _id of the last document written to the output.
+	LastID interface{}
+
+	// Exported is the number of documents written to the output so far.
+	Exported int64
+
+	// Offset is the number of bytes written to the output so far. Output
+	// written after it, by documents exported after the last checkpoint, is
+	// truncated when the export is resumed, as they are exported again.
+	Offset int64
+}
+
+// readResumeState loads the resume state from the given file. It returns
+// nil and no error if the file does not exist.
+func readResumeState(filename string) (*resumeState, error) {
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading resume file: %v", err)
+	}
+
+	parsed := map[string]interface{}{}
+	if err = json.Unmarshal(content, &parsed); err != nil {
+		return nil, fmt.Errorf("resume file '%v' is not valid JSON: %v", filename, err)
+	}
+	if err = bsonutil.ConvertJSONDocumentToBSON(parsed); err != nil {
+		return nil, fmt.Errorf("error parsing resume file '%v': %v", filename, err)
+	}
+
+	state := &resumeState{}
+	var ok bool
+	if state.Namespace, ok = parsed["ns"].(string); !ok {
+		return nil, fmt.Errorf("resume file '%v' is missing the namespace", filename)
+	}
+	if state.LastID, ok = parsed["lastId"]; !ok {
+		return nil, fmt.Errorf("resume file '%v' is missing the last exported _id", filename)
+	}
+	state.Exported = toInt64(parsed["exported"])
+	if _, ok = parsed["offset"]; !ok {
+		return nil, fmt.Errorf("resume file '%v' is missing the output offset", filename)
+	}
+	state.Offset = toInt64(parsed["offset"])
+	return state, nil
+}
+
+func toInt64(value interface{}) int64 {
+	switch v := value.(type) {
+	case int32:
+		return int64(v)
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// write saves the resume state to the given file. The state is written to a
+// temporary file first and renamed, so an interrupted write never leaves a
+// truncated resume file behind.
+func (state *resumeState) write(filename string) error {
+	lastID, err := bsonutil.GetBSONValueAsJSON(state.LastID)
+	if err != nil {
+		return err
+	}
+	content, err := json.Marshal(bsonutil.MarshalD{
+		{Name: "ns", Value: state.Namespace},
+		{Name: "lastId", Value: lastID},
+		{Name: "exported", Value: json.NumberLong(state.Exported)},
+		{Name: "offset", Value: json.NumberLong(state.Offset)},
+	})
+	if err != nil {
+		return fmt.Errorf("error writing resume file: %v", err)
+	}
+
+	tmpName := filename + ".tmp"
+	if err = ioutil.WriteFile(tmpName, content, 0640); err != nil {
+		return fmt.Errorf("error writing resume file: %v", err)
+	}
+	if err = os.Rename(tmpName, filename); err != nil {
+		return fmt.Errorf("error writing resume file: %v", err)
+	}
+	return nil
+}
+
+// openResumedOutput opens the output file of an interrupted export to
+// continue it, truncating what was written after its last checkpoint.
+func openResumedOutput(filename string, offset int64) (*os.File, error) {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() < offset {
+		file.Close()
+		return nil, fmt.Errorf("output file '%v' has %v bytes, but the interrupted export wrote %v",
+			filename, info.Size(), offset)
+	}
+	if err = file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("error truncating output file '%v': %v", filename, err)
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// offsetWriter counts the bytes written to the output, for the offset of
+// the resume state.
+type offsetWriter struct {
+	io.Writer
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.offset += int64(n)
+	return n, err
+}
+
+// isIDSort returns true if the sort specification sorts ascending on _id only.
+func isIDSort(sort bson.D) bool {
+	return len(sort) == 1 && sort[0].Name == "_id" && isPositive(sort[0].Value)
+}
+
+func isPositive(value interface{}) bool {
+	switch v := value.(type) {
+	case int:
+		return v > 0
+	case int32:
+		return v > 0
+	case int64:
+		return v > 0
+	case float64:
+		return v > 0
+	}
+	return false
+}
+
+// afterIDQuery returns a query matching the documents matched by query whose
+// _id is greater than lastID.
+func afterIDQuery(query map[string]interface{}, lastID interface{}) map[string]interface{} {
+	return afterValueQuery(query, "_id", lastID)
+}
@@ -0,0 +1,175 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestResumeState(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a temporary directory", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_resume")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		filename := filepath.Join(dir, "resume.json")
+
+		Convey("a missing resume file should not be an error", func() {
+			state, err := readResumeState(filename)
+			So(err, ShouldBeNil)
+			So(state, ShouldBeNil)
+		})
+
+		Convey("the resume state should round trip through the file", func() {
+			oid := bson.NewObjectId()
+			state := &resumeState{Namespace: "db.c", LastID: oid, Exported: 12345, Offset: 678901}
+			So(state.write(filename), ShouldBeNil)
+			read, err := readResumeState(filename)
+			So(err, ShouldBeNil)
+			So(read, ShouldResemble, state)
+		})
+
+		Convey("a resume file without the output offset should be an error", func() {
+			So(ioutil.WriteFile(filename, []byte(`{"ns":"db.c","lastId":5,"exported":1}`), 0640), ShouldBeNil)
+			_, err := readResumeState(filename)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("resuming requires an _id sort and a matching namespace", func() {
+			exp := &MongoExport{
+				ToolOptions: options.ToolOptions{Namespace: &options.Namespace{DB: "db", Collection: "c"}},
+				OutputOpts:  &OutputFormatOptions{},
+				InputOpts:   &InputOptions{ResumeFile: filename, Sort: "{x:1}"},
+			}
+			So(exp.loadResumeState(), ShouldNotBeNil)
+
+			exp.InputOpts.Sort = ""
+			So(exp.loadResumeState(), ShouldBeNil)
+			So(exp.isResuming(), ShouldBeFalse)
+
+			state := &resumeState{Namespace: "db.other", LastID: 5, Exported: 1}
+			So(state.write(filename), ShouldBeNil)
+			So(exp.loadResumeState(), ShouldNotBeNil)
+
+			state.Namespace = "db.c"
+			So(state.write(filename), ShouldBeNil)
+			So(exp.loadResumeState(), ShouldBeNil)
+			So(exp.isResuming(), ShouldBeTrue)
+		})
+	})
+}
+
+// exportIDs writes documents with the given _ids to the output of the
+// export, as exportInternal does.
+func exportIDs(exp *MongoExport, exportOutput ExportOutput, from, to int) {
+	for id := from; id <= to; id++ {
+		So(exportOutput.ExportDocument(bson.D{{"_id", id}}), ShouldBeNil)
+		exp.resume.LastID = id
+		exp.resume.Exported++
+	}
+}
+
+func TestResumedOutput(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an export to a file interrupted after its last checkpoint", t, func() {
+		dir, err := ioutil.TempDir("", "mongoexport_resume")
+		So(err, ShouldBeNil)
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+		newExport := func() *MongoExport {
+			return &MongoExport{
+				ToolOptions: options.ToolOptions{Namespace: &options.Namespace{DB: "db", Collection: "c"}},
+				OutputOpts:  &OutputFormatOptions{OutputFile: filepath.Join(dir, "out.json")},
+				InputOpts:   &InputOptions{ResumeFile: filepath.Join(dir, "resume.json")},
+			}
+		}
+
+		exp := newExport()
+		So(exp.loadResumeState(), ShouldBeNil)
+		file, err := exp.GetOutputWriter()
+		So(err, ShouldBeNil)
+		exp.output = &offsetWriter{Writer: file}
+		exportOutput := NewJSONExportOutput(false, false, exp.output)
+		exportIDs(exp, exportOutput, 1, 3)
+		So(exp.checkpoint(exportOutput), ShouldBeNil)
+		exportIDs(exp, exportOutput, 4, 5)
+		So(exportOutput.Flush(), ShouldBeNil)
+		So(file.Close(), ShouldBeNil)
+
+		Convey("the resumed export should contain each document once", func() {
+			exp = newExport()
+			So(exp.loadResumeState(), ShouldBeNil)
+			So(exp.isResuming(), ShouldBeTrue)
+			file, err = exp.GetOutputWriter()
+			So(err, ShouldBeNil)
+			exp.output = &offsetWriter{Writer: file, offset: exp.resume.Offset}
+			exportOutput = NewJSONExportOutput(false, false, exp.output)
+			exportIDs(exp, exportOutput, 4, 6)
+			So(exportOutput.Flush(), ShouldBeNil)
+			So(file.Close(), ShouldBeNil)
+
+			output, err := os.Open(filepath.Join(dir, "out.json"))
+			So(err, ShouldBeNil)
+			defer output.Close()
+			var lines []string
+			scanner := bufio.NewScanner(output)
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+			So(lines, ShouldResemble, []string{
+				`{"_id":1}`, `{"_id":2}`, `{"_id":3}`, `{"_id":4}`, `{"_id":5}`, `{"_id":6}`,
+			})
+		})
+
+		Convey("an output file shorter than the checkpoint should not be resumed", func() {
+			So(os.Truncate(filepath.Join(dir, "out.json"), 5), ShouldBeNil)
+			exp = newExport()
+			So(exp.loadResumeState(), ShouldBeNil)
+			_, err = exp.GetOutputWriter()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestResumeQuery(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Only ascending sorts on _id should allow resuming", t, func() {
+		sortD, err := getSortFromArg("{_id:1}")
+		So(err, ShouldBeNil)
+		So(isIDSort(sortD), ShouldBeTrue)
+		sortD, err = getSortFromArg("{_id:-1}")
+		So(err, ShouldBeNil)
+		So(isIDSort(sortD), ShouldBeFalse)
+		sortD, err = getSortFromArg("{_id:1, x:1}")
+		So(err, ShouldBeNil)
+		So(isIDSort(sortD), ShouldBeFalse)
+	})
+
+	Convey("The query should continue after the last _id", t, func() {
+		So(afterIDQuery(map[string]interface{}{}, 5), ShouldResemble,
+			map[string]interface{}{"_id": bson.M{"$gt": 5}})
+		query := map[string]interface{}{"x": 1}
+		So(afterIDQuery(query, 5), ShouldResemble, map[string]interface{}{
+			"$and": []interface{}{query, map[string]interface{}{"_id": bson.M{"$gt": 5}}},
+		})
+	})
+}
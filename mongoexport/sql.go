@@ -0,0 +1,229 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// SQL statement styles supported by --sqlFormat.
+const (
+	SQLInsert = "insert"
+	SQLCopy   = "copy"
+)
+
+// sqlDateFormat is the timestamp literal format understood by common
+// relational databases.
+const sqlDateFormat = "2006-01-02 15:04:05.000"
+
+// SQLExportOutput is an implementation of ExportOutput that writes documents
+// as SQL, either as one INSERT statement per document or as the data of a
+// PostgreSQL COPY statement.
+type SQLExportOutput struct {
+	// Fields is a list of field names in the bson documents to be exported.
+	Fields []string
+
+	// Table is the name of the table the rows are written to.
+	Table string
+
+	// Columns holds the name of the column each field is written to.
+	Columns []string
+
+	// Format is either SQLInsert or SQLCopy.
+	Format string
+
+	// NumExported maintains a running total of the number of documents written.
+	NumExported int64
+
+	// Formatter, if non-nil, rewrites dates and ObjectIds before they are written.
+	Formatter *ValueFormatter
+
+	out *bufio.Writer
+}
+
+// NewSQLExportOutput returns a SQLExportOutput configured to write the given
+// fields to the columns of table. If columns is empty, each column is named
+// after its field with dots replaced by underscores.
+func NewSQLExportOutput(fields []string, table string, columns []string, format string, out io.Writer) *SQLExportOutput {
+	if len(columns) == 0 {
+		columns = make([]string, 0, len(fields))
+		for _, field := range fields {
+			columns = append(columns, strings.Replace(field, ".", "_", -1))
+		}
+	}
+	return &SQLExportOutput{
+		Fields:  fields,
+		Table:   table,
+		Columns: columns,
+		Format:  format,
+		out:     bufio.NewWriter(out),
+	}
+}
+
+// WriteHeader starts the COPY statement in copy mode, otherwise it behaves
+// as a no-op.
+func (sqlExporter *SQLExportOutput) WriteHeader() error {
+	if sqlExporter.Format == SQLCopy {
+		_, err := fmt.Fprintf(sqlExporter.out, "COPY %v (%v) FROM stdin;\n",
+			quoteSQLIdentifier(sqlExporter.Table), sqlExporter.columnList())
+		return err
+	}
+	return nil
+}
+
+// WriteFooter ends the COPY data in copy mode, otherwise it behaves as a no-op.
+func (sqlExporter *SQLExportOutput) WriteFooter() error {
+	if sqlExporter.Format == SQLCopy {
+		_, err := sqlExporter.out.WriteString("\\.\n")
+		return err
+	}
+	return nil
+}
+
+// Flush writes any pending data to the underlying I/O stream.
+func (sqlExporter *SQLExportOutput) Flush() error {
+	return sqlExporter.out.Flush()
+}
+
+// ExportDocument writes the document as an INSERT statement or a COPY row.
+func (sqlExporter *SQLExportOutput) ExportDocument(document bson.D) error {
+	extendedDoc, err := bsonutil.ConvertBSONValueToJSON(document)
+	if err != nil {
+		return err
+	}
+	if sqlExporter.Formatter.IsEnabled() {
+		extendedDoc = sqlExporter.Formatter.Format(extendedDoc)
+	}
+
+	values := make([]string, 0, len(sqlExporter.Fields))
+	for _, fieldName := range sqlExporter.Fields {
+		fieldVal, ok := lookupFieldByName(fieldName, extendedDoc)
+		if !ok {
+			fieldVal = nil
+		}
+		if sqlExporter.Format == SQLCopy {
+			values = append(values, formatCopyValue(fieldVal))
+		} else {
+			values = append(values, formatSQLLiteral(fieldVal))
+		}
+	}
+
+	if sqlExporter.Format == SQLCopy {
+		_, err = fmt.Fprintf(sqlExporter.out, "%v\n", strings.Join(values, "\t"))
+	} else {
+		_, err = fmt.Fprintf(sqlExporter.out, "INSERT INTO %v (%v) VALUES (%v);\n",
+			quoteSQLIdentifier(sqlExporter.Table), sqlExporter.columnList(), strings.Join(values, ", "))
+	}
+	if err != nil {
+		return err
+	}
+	sqlExporter.NumExported++
+	return nil
+}
+
+func (sqlExporter *SQLExportOutput) columnList() string {
+	quoted := make([]string, 0, len(sqlExporter.Columns))
+	for _, column := range sqlExporter.Columns {
+		quoted = append(quoted, quoteSQLIdentifier(column))
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// quoteSQLIdentifier returns a double-quoted SQL identifier. A dot-qualified
+// name such as "schema.table" has each part quoted separately.
+func quoteSQLIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.Replace(part, `"`, `""`, -1) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+// sqlText returns the text of a value and whether it is numeric, or ok=false
+// for missing and null values.
+func sqlText(fieldVal interface{}) (text string, numeric bool, ok bool) {
+	switch v := fieldVal.(type) {
+	case nil:
+		return "", false, false
+	case bool:
+		if v {
+			return "true", true, true
+		}
+		return "false", true, true
+	case json.NumberInt:
+		return strconv.FormatInt(int64(v), 10), true, true
+	case json.NumberLong:
+		return strconv.FormatInt(int64(v), 10), true, true
+	case int64:
+		return strconv.FormatInt(v, 10), true, true
+	case json.NumberFloat:
+		f := float64(v)
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return strconv.FormatFloat(f, 'g', -1, 64), false, true
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), true, true
+	case json.Decimal128:
+		text := v.String()
+		if text == "NaN" || text == "Inf" || text == "-Inf" {
+			return text, false, true
+		}
+		return text, true, true
+	case json.Date:
+		n := int64(v)
+		return time.Unix(n/1e3, n%1e3*1e6).UTC().Format(sqlDateFormat), false, true
+	case json.ObjectId:
+		return string(v), false, true
+	case string:
+		return v, false, true
+	case bsonutil.MarshalD, bson.M, map[string]interface{}, []interface{}:
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return "", false, false
+		}
+		return string(buf), false, true
+	}
+	return fmt.Sprintf("%v", fieldVal), false, true
+}
+
+// formatSQLLiteral returns a value as a SQL literal for an INSERT statement.
+func formatSQLLiteral(fieldVal interface{}) string {
+	text, numeric, ok := sqlText(fieldVal)
+	if !ok {
+		return "NULL"
+	}
+	if numeric {
+		return text
+	}
+	return "'" + strings.Replace(text, "'", "''", -1) + "'"
+}
+
+// copyEscaper escapes the characters that are special in COPY text format.
+var copyEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\t", "\\t",
+	"\n", "\\n",
+	"\r", "\\r",
+)
+
+// formatCopyValue returns a value as a field of a COPY text format row.
+func formatCopyValue(fieldVal interface{}) string {
+	text, _, ok := sqlText(fieldVal)
+	if !ok {
+		return "\\N"
+	}
+	return copyEscaper.Replace(text)
+}
@@ -0,0 +1,79 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestWriteSQL(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	doc := func() bson.D {
+		return bson.D{
+			{"_id", bson.ObjectIdHex("5a934e000102030405000000")},
+			{"name", "O'Brien\tjr"},
+			{"age", 42},
+			{"ok", true},
+			{"when", time.Date(2018, 2, 25, 23, 30, 0, 0, time.UTC)},
+			{"tags", []interface{}{"a", "b"}},
+		}
+	}
+	fields := []string{"_id", "name", "age", "ok", "when", "tags", "missing"}
+
+	Convey("With a SQL export output", t, func() {
+		out := &bytes.Buffer{}
+
+		Convey("INSERT statements should be written with default column names", func() {
+			sqlExporter := NewSQLExportOutput(fields, "people", nil, SQLInsert, out)
+			So(sqlExporter.WriteHeader(), ShouldBeNil)
+			So(sqlExporter.ExportDocument(doc()), ShouldBeNil)
+			So(sqlExporter.WriteFooter(), ShouldBeNil)
+			So(sqlExporter.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual,
+				`INSERT INTO "people" ("_id", "name", "age", "ok", "when", "tags", "missing") VALUES `+
+					`('5a934e000102030405000000', 'O''Brien	jr', 42, true, '2018-02-25 23:30:00.000', '["a","b"]', NULL);`+"\n")
+		})
+
+		Convey("COPY data should be written with mapped columns", func() {
+			sqlExporter := NewSQLExportOutput([]string{"name", "missing"}, "staging.people",
+				[]string{"full_name", "extra"}, SQLCopy, out)
+			So(sqlExporter.WriteHeader(), ShouldBeNil)
+			So(sqlExporter.ExportDocument(doc()), ShouldBeNil)
+			So(sqlExporter.WriteFooter(), ShouldBeNil)
+			So(sqlExporter.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual,
+				`COPY "staging"."people" ("full_name", "extra") FROM stdin;`+"\n"+
+					`O'Brien\tjr`+"\t"+`\N`+"\n"+
+					`\.`+"\n")
+		})
+	})
+}
+
+func TestSQLLiteral(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	decimal := func(s string) json.Decimal128 {
+		d, err := bson.ParseDecimal128(s)
+		So(err, ShouldBeNil)
+		return json.Decimal128{d}
+	}
+
+	Convey("Decimals should be numeric literals unless they aren't finite", t, func() {
+		So(formatSQLLiteral(decimal("1.5")), ShouldEqual, "1.5")
+		So(formatSQLLiteral(decimal("NaN")), ShouldEqual, "'NaN'")
+		So(formatSQLLiteral(decimal("Infinity")), ShouldEqual, "'Inf'")
+		So(formatSQLLiteral(decimal("-Infinity")), ShouldEqual, "'-Inf'")
+	})
+}
@@ -0,0 +1,152 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/json"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// TemplateExportOutput is an implementation of ExportOutput that renders
+// each document with a Go text/template.
+type TemplateExportOutput struct {
+	Template *template.Template
+
+	// NumExported maintains a running total of the number of documents written.
+	NumExported int64
+
+	// Formatter rewrites dates and ObjectIds before the document is rendered.
+	Formatter *ValueFormatter
+
+	out *bufio.Writer
+}
+
+// templateFuncs are the functions available to export templates in addition
+// to the text/template builtins.
+var templateFuncs = template.FuncMap{
+	// json renders a value as extended JSON
+	"json": func(value interface{}) (string, error) {
+		buf, err := json.Marshal(value)
+		return string(buf), err
+	},
+	// join renders the elements of an array separated by sep
+	"join": func(sep string, value interface{}) string {
+		elems, ok := value.([]interface{})
+		if !ok {
+			return fmt.Sprintf("%v", value)
+		}
+		strs := make([]string, 0, len(elems))
+		for _, elem := range elems {
+			strs = append(strs, fmt.Sprintf("%v", elem))
+		}
+		return strings.Join(strs, sep)
+	},
+}
+
+// templateEscaper expands the escape sequences users are likely to type in a
+// template given on the command line.
+var templateEscaper = strings.NewReplacer(
+	`\\`, `\`,
+	`\n`, "\n",
+	`\r`, "\r",
+	`\t`, "\t",
+)
+
+// parseExportTemplate parses a template given on the command line, with
+// escape sequences expanded, or read from a file.
+func parseExportTemplate(text, filename string) (*template.Template, error) {
+	if filename != "" {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, fmt.Errorf("error reading template file: %v", err)
+		}
+		text = string(content)
+	} else {
+		text = templateEscaper.Replace(text)
+	}
+	tmpl, err := template.New("export").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %v", err)
+	}
+	return tmpl, nil
+}
+
+// NewTemplateExportOutput returns a TemplateExportOutput that renders each
+// document with tmpl and writes the result to out.
+func NewTemplateExportOutput(tmpl *template.Template, out io.Writer) *TemplateExportOutput {
+	return &TemplateExportOutput{
+		Template: tmpl,
+		// templates should see plain values rather than extended JSON
+		Formatter: &ValueFormatter{ObjectIdFormat: ObjectIdFormatHex},
+		out:       bufio.NewWriter(out),
+	}
+}
+
+// WriteHeader is a no-op for template export formats.
+func (tmplExporter *TemplateExportOutput) WriteHeader() error {
+	return nil
+}
+
+// WriteFooter is a no-op for template export formats.
+func (tmplExporter *TemplateExportOutput) WriteFooter() error {
+	return nil
+}
+
+// Flush writes any pending data to the underlying I/O stream.
+func (tmplExporter *TemplateExportOutput) Flush() error {
+	return tmplExporter.out.Flush()
+}
+
+// ExportDocument renders the template with the document as its data. Nested
+// documents are maps, so fields can be addressed as {{.user.name}}.
+func (tmplExporter *TemplateExportOutput) ExportDocument(document bson.D) error {
+	extendedDoc, err := bsonutil.ConvertBSONValueToJSON(document)
+	if err != nil {
+		return err
+	}
+	if tmplExporter.Formatter.IsEnabled() {
+		extendedDoc = tmplExporter.Formatter.Format(extendedDoc)
+	}
+	if err = tmplExporter.Template.Execute(tmplExporter.out, templateData(extendedDoc)); err != nil {
+		return fmt.Errorf("error rendering template: %v", err)
+	}
+	tmplExporter.NumExported++
+	return nil
+}
+
+// templateData converts ordered documents into maps, which templates can
+// index by field name.
+func templateData(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bsonutil.MarshalD:
+		m := make(map[string]interface{}, len(v))
+		for _, elem := range v {
+			m[elem.Name] = templateData(elem.Value)
+		}
+		return m
+	case bson.M:
+		m := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			m[key] = templateData(elem)
+		}
+		return m
+	case []interface{}:
+		for i, elem := range v {
+			v[i] = templateData(elem)
+		}
+		return v
+	}
+	return value
+}
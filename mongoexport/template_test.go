@@ -0,0 +1,59 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoexport
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestWriteTemplate(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	doc := func() bson.D {
+		return bson.D{
+			{"_id", bson.ObjectIdHex("5a934e000102030405000000")},
+			{"user", bson.D{{"name", "ann"}, {"age", 30}}},
+			{"tags", []interface{}{"a", "b"}},
+			{"when", time.Date(2018, 2, 25, 23, 30, 0, 0, time.UTC)},
+		}
+	}
+
+	Convey("With a template export output", t, func() {
+		out := &bytes.Buffer{}
+
+		Convey("fields should be addressable by path", func() {
+			tmpl, err := parseExportTemplate(`{{._id}},{{.user.name}},{{.user.age}},{{.when}}\n`, "")
+			So(err, ShouldBeNil)
+			tmplExporter := NewTemplateExportOutput(tmpl, out)
+			So(tmplExporter.ExportDocument(doc()), ShouldBeNil)
+			So(tmplExporter.ExportDocument(doc()), ShouldBeNil)
+			So(tmplExporter.Flush(), ShouldBeNil)
+			line := "5a934e000102030405000000,ann,30,2018-02-25T23:30:00.000Z\n"
+			So(out.String(), ShouldEqual, line+line)
+		})
+
+		Convey("template functions should be available", func() {
+			tmpl, err := parseExportTemplate(`{{join "|" .tags}} {{json .user}}`, "")
+			So(err, ShouldBeNil)
+			tmplExporter := NewTemplateExportOutput(tmpl, out)
+			So(tmplExporter.ExportDocument(doc()), ShouldBeNil)
+			So(tmplExporter.Flush(), ShouldBeNil)
+			So(out.String(), ShouldEqual, `a|b {"age":30,"name":"ann"}`)
+		})
+
+		Convey("invalid templates should be rejected", func() {
+			_, err := parseExportTemplate(`{{.x`, "")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
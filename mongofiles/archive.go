@@ -0,0 +1,153 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/storage"
+	"gopkg.in/mgo.v2"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// archiveMemberName returns the GridFS name of an archive member: its path
+// in the archive, cleaned so it can't climb out of it, after prefix.
+func archiveMemberName(prefix, member string) (string, error) {
+	name := strings.TrimPrefix(path.Clean("/"+strings.Replace(member, `\`, "/", -1)), "/")
+	if name == "" || name == "." {
+		return "", fmt.Errorf("archive member '%v' does not name a file", member)
+	}
+	return prefix + name, nil
+}
+
+// handle logic for 'put_archive' command
+func (mf *MongoFiles) handlePutArchive(gfs *mgo.GridFS) error {
+	if !mf.StorageOptions.Extract {
+		name := mf.FileName + filepath.Base(mf.Archive)
+		if mf.Archive == "-" {
+			return fmt.Errorf("an archive read from stdin can only be stored with --extract")
+		}
+		return mf.putFile(gfs, mf.Archive, name, nil)
+	}
+
+	var local io.Reader = os.Stdin
+	if storage.IsURL(mf.Archive) {
+		object, err := storage.Open(mf.Archive)
+		if err != nil {
+			return fmt.Errorf("error while opening archive '%v': %v", mf.Archive, err)
+		}
+		defer object.Close()
+		local = object
+	} else if mf.Archive != "-" {
+		file, err := os.Open(mf.Archive)
+		if err != nil {
+			return fmt.Errorf("error while opening archive '%v': %v", mf.Archive, err)
+		}
+		defer file.Close()
+		local = file
+	}
+	buffered := bufio.NewReader(local)
+	magic, _ := buffered.Peek(len(zipMagic))
+
+	var count int
+	var err error
+	switch {
+	case bytes.HasPrefix(magic, zipMagic):
+		count, err = mf.putZipMembers(gfs)
+	case bytes.HasPrefix(magic, gzipMagic):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(buffered); err != nil {
+			return fmt.Errorf("error while reading archive '%v': %v", mf.Archive, err)
+		}
+		count, err = mf.putTarMembers(gfs, tar.NewReader(gz))
+	default:
+		count, err = mf.putTarMembers(gfs, tar.NewReader(buffered))
+	}
+	if err != nil {
+		return fmt.Errorf("error while storing archive '%v' into GridFS: %v", mf.Archive, err)
+	}
+	log.Logvf(log.Always, "added %v file(s) from %v", count, mf.Archive)
+	return nil
+}
+
+// putTarMembers stores every regular file in a tar archive.
+func (mf *MongoFiles) putTarMembers(gfs *mgo.GridFS, archive *tar.Reader) (int, error) {
+	count := 0
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if header.Typeflag != tar.TypeReg && header.Typeflag != tar.TypeRegA {
+			log.Logvf(log.DebugLow, "skipping archive member '%v', which is not a file", header.Name)
+			continue
+		}
+		if err = mf.putArchiveMember(gfs, archive, header.Name); err != nil {
+			return count, err
+		}
+		count++
+	}
+}
+
+// putZipMembers stores every regular file in a zip archive, which must be
+// read from a file rather than stdin since its index is at the end.
+func (mf *MongoFiles) putZipMembers(gfs *mgo.GridFS) (int, error) {
+	if mf.Archive == "-" || storage.IsURL(mf.Archive) {
+		return 0, fmt.Errorf("zip archives can only be read from local files")
+	}
+	archive, err := zip.OpenReader(mf.Archive)
+	if err != nil {
+		return 0, err
+	}
+	defer archive.Close()
+	count := 0
+	for _, member := range archive.File {
+		if !member.Mode().IsRegular() {
+			log.Logvf(log.DebugLow, "skipping archive member '%v', which is not a file", member.Name)
+			continue
+		}
+		contents, err := member.Open()
+		if err != nil {
+			return count, err
+		}
+		err = mf.putArchiveMember(gfs, contents, member.Name)
+		contents.Close()
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// putArchiveMember stores one member of an archive.
+func (mf *MongoFiles) putArchiveMember(gfs *mgo.GridFS, contents io.Reader, member string) error {
+	name, err := archiveMemberName(mf.FileName, member)
+	if err != nil {
+		log.Logvf(log.Always, "skipping: %v", err)
+		return nil
+	}
+	return mf.putReader(gfs, contents, fmt.Sprintf("'%v' from '%v'", member, mf.Archive), name, nil)
+}
@@ -0,0 +1,103 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+
+	"github.com/mongodb/mongo-tools/common/fips"
+	"gopkg.in/mgo.v2"
+)
+
+// The checksums --hash can store files with: the MD5 of the GridFS spec, or
+// the SHA-256, in a sha256 field, for FIPS mode.
+const (
+	HashMD5    = "md5"
+	HashSHA256 = "sha256"
+)
+
+// fileChecksum hashes the data of a GridFS file, to store the checksum with
+// it or to check the data against the stored one.
+type fileChecksum struct {
+	hash      hash.Hash
+	algorithm string
+	// expected is the hex checksum stored with the file, if any
+	expected string
+}
+
+func newMD5Checksum(expected string) *fileChecksum {
+	return &fileChecksum{hash: md5.New(), algorithm: "MD5", expected: expected}
+}
+
+func newSHA256Checksum(expected string) *fileChecksum {
+	return &fileChecksum{hash: sha256.New(), algorithm: "SHA-256", expected: expected}
+}
+
+// storedChecksum returns the checksum to check the data of the file against:
+// its SHA-256 if it has one, and otherwise its MD5, which can't be checked
+// in FIPS mode. The data of files stored with neither is hashed with SHA-256,
+// with nothing to check it against.
+func storedChecksum(doc gridFileDoc) (*fileChecksum, error) {
+	switch {
+	case doc.SHA256 != "":
+		return newSHA256Checksum(doc.SHA256), nil
+	case doc.MD5 != "":
+		if err := fips.Forbid("MD5", "'"+doc.Filename+"' is only stored with its MD5, "+
+			"put it again with --hash=sha256 to check it"); err != nil {
+			return nil, err
+		}
+		return newMD5Checksum(doc.MD5), nil
+	}
+	return newSHA256Checksum(""), nil
+}
+
+// newChecksum returns the checksum to store new files with, given by --hash.
+func (mf *MongoFiles) newChecksum() *fileChecksum {
+	if mf.StorageOptions.Hash == HashSHA256 {
+		return newSHA256Checksum("")
+	}
+	return newMD5Checksum("")
+}
+
+// gridFS returns the GridFS bucket with the given prefix, storing new files
+// with the checksum given by --hash.
+func (mf *MongoFiles) gridFS(database *mgo.Database, prefix string) *mgo.GridFS {
+	gfs := database.GridFS(prefix)
+	gfs.SHA256 = mf.StorageOptions.Hash == HashSHA256
+	return gfs
+}
+
+func (c *fileChecksum) Write(data []byte) (int, error) {
+	return c.hash.Write(data)
+}
+
+// Sum returns the hex checksum of the data written.
+func (c *fileChecksum) Sum() string {
+	return hex.EncodeToString(c.hash.Sum(nil))
+}
+
+// Matches returns whether the data written has the expected checksum, which
+// it always does when there is none.
+func (c *fileChecksum) Matches() bool {
+	return c.expected == "" || c.Sum() == c.expected
+}
+
+// store sets the checksum of the file to that of the data written.
+func (c *fileChecksum) store(doc *gridFileDoc) {
+	if c.algorithm == "MD5" {
+		doc.MD5 = c.Sum()
+		return
+	}
+	doc.SHA256 = c.Sum()
+}
+
+func (c *fileChecksum) String() string {
+	return c.algorithm + " " + c.expected
+}
@@ -0,0 +1,64 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChecksums(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	const (
+		md5Hex    = "5d41402abc4b2a76b9719d911017c592"
+		sha256Hex = "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	)
+
+	Convey("The checksum of a stored file", t, func() {
+		Convey("should be its SHA-256 when it has one", func() {
+			sum, err := storedChecksum(gridFileDoc{MD5: md5Hex, SHA256: sha256Hex})
+			So(err, ShouldBeNil)
+			sum.Write([]byte("hello"))
+			So(sum.algorithm, ShouldEqual, "SHA-256")
+			So(sum.Matches(), ShouldBeTrue)
+		})
+
+		Convey("should be its MD5 otherwise", func() {
+			sum, err := storedChecksum(gridFileDoc{MD5: md5Hex})
+			So(err, ShouldBeNil)
+			sum.Write([]byte("hell"))
+			So(sum.Matches(), ShouldBeFalse)
+			So(sum.String(), ShouldEqual, "MD5 "+md5Hex)
+		})
+
+		Convey("should match any data when there is none", func() {
+			sum, err := storedChecksum(gridFileDoc{})
+			So(err, ShouldBeNil)
+			sum.Write([]byte("hello"))
+			So(sum.Matches(), ShouldBeTrue)
+		})
+	})
+
+	Convey("New files should be stored with the checksum given by --hash", t, func() {
+		mf := &MongoFiles{StorageOptions: &StorageOptions{}}
+		doc := gridFileDoc{}
+		sum := mf.newChecksum()
+		sum.Write([]byte("hello"))
+		sum.store(&doc)
+		So(doc, ShouldResemble, gridFileDoc{MD5: md5Hex})
+
+		mf.StorageOptions.Hash = HashSHA256
+		doc = gridFileDoc{}
+		sum = mf.newChecksum()
+		sum.Write([]byte("hello"))
+		sum.store(&doc)
+		So(doc, ShouldResemble, gridFileDoc{SHA256: sha256Hex})
+	})
+}
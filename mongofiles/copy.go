@@ -0,0 +1,226 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// targetGridFS returns the bucket that cp and mv write to: the one named by
+// --toPrefix, or the source bucket if it isn't given.
+func (mf *MongoFiles) targetGridFS(gfs *mgo.GridFS) *mgo.GridFS {
+	if mf.StorageOptions.ToPrefix == "" || mf.StorageOptions.ToPrefix == mf.StorageOptions.GridFSPrefix {
+		return gfs
+	}
+	return mf.gridFS(gfs.Files.Database, mf.StorageOptions.ToPrefix)
+}
+
+// isUnrecognizedStage returns true if err indicates the server doesn't
+// support an aggregation stage, such as $merge before 4.2.
+func isUnrecognizedStage(err error) bool {
+	e, ok := err.(*mgo.QueryError)
+	return ok && (e.Code == 40324 || strings.HasPrefix(e.Message, "Unrecognized pipeline stage name"))
+}
+
+// sameCollection returns true if a and b are the same collection.
+func sameCollection(a, b *mgo.Collection) bool {
+	return a.Database.Name == b.Database.Name && a.Name == b.Name
+}
+
+// copyChunks copies the chunks of the file srcId in src to the file dstId in
+// dst. The server copies them itself with $merge where it can; older servers,
+// and servers before 4.4 copying within a bucket, which can't $merge into
+// the collection being read, have them copied through mongofiles.
+func copyChunks(src, dst *mgo.GridFS, srcId, dstId interface{}) error {
+	pipeline := []bson.M{
+		{"$match": bson.M{"files_id": srcId}},
+		{"$project": bson.M{
+			"_id":      bson.M{"files_id": bson.M{"$literal": dstId}, "n": "$n"},
+			"files_id": bson.M{"$literal": dstId},
+			"n":        1,
+			"data":     1,
+		}},
+		{"$merge": bson.M{
+			"into":           bson.M{"db": dst.Chunks.Database.Name, "coll": dst.Chunks.Name},
+			"whenMatched":    "fail",
+			"whenNotMatched": "insert",
+		}},
+	}
+	err := src.Chunks.Pipe(pipeline).AllowDiskUse().Iter().Close()
+	if err == nil {
+		return nil
+	}
+	if !isUnrecognizedStage(err) && !sameCollection(src.Chunks, dst.Chunks) {
+		return err
+	}
+	if _, err = dst.Chunks.RemoveAll(bson.M{"files_id": dstId}); err != nil {
+		return err
+	}
+
+	log.Logvf(log.Info, "server can't copy the chunks with $merge, copying them through mongofiles")
+	var chunk gridChunk
+	iter := src.Chunks.Find(bson.M{"files_id": srcId}).Iter()
+	for iter.Next(&chunk) {
+		chunk.Id, chunk.FilesId = bson.NewObjectId(), dstId
+		if err = dst.Chunks.Insert(chunk); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	return iter.Close()
+}
+
+// copyFile copies the GridFS file with the given files document from src to
+// dst under a new _id and the given name, returning the new _id. Unless
+// keepDate is set, the copy is given the current time as its upload date.
+func copyFile(src, dst *mgo.GridFS, doc bson.M, name string, keepDate bool) (interface{}, error) {
+	dstId := bson.NewObjectId()
+	if err := copyChunks(src, dst, doc["_id"], dstId); err != nil {
+		dst.Chunks.RemoveAll(bson.M{"files_id": dstId})
+		return nil, fmt.Errorf("error copying chunks: %v", err)
+	}
+	copied := bson.M{}
+	for key, value := range doc {
+		copied[key] = value
+	}
+	copied["_id"], copied["filename"] = dstId, name
+	if !keepDate {
+		copied["uploadDate"] = bson.Now()
+	}
+	if err := dst.Files.Insert(copied); err != nil {
+		dst.Chunks.RemoveAll(bson.M{"files_id": dstId})
+		return nil, fmt.Errorf("error inserting files document: %v", err)
+	}
+	if err := dst.Chunks.EnsureIndex(mgo.Index{Key: []string{"files_id", "n"}, Unique: true}); err != nil {
+		return nil, err
+	}
+	return dstId, nil
+}
+
+// targetIds returns the _ids of the files named name in dst that --replace
+// would remove, or none if it isn't set.
+func (mf *MongoFiles) targetIds(dst *mgo.GridFS, name string) ([]interface{}, error) {
+	if !mf.StorageOptions.Replace {
+		return nil, nil
+	}
+	var docs []bson.M
+	if err := dst.Find(bson.M{"filename": name}).Select(bson.M{"_id": 1}).All(&docs); err != nil {
+		return nil, fmt.Errorf("error reading GridFS file '%v': %v", name, err)
+	}
+	ids := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc["_id"]
+	}
+	return ids, nil
+}
+
+// replaceTarget removes the files with the given _ids, found by targetIds
+// before the target was written, from dst.
+func replaceTarget(dst *mgo.GridFS, name string, ids []interface{}) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	for _, id := range ids {
+		if err := dst.RemoveId(id); err != nil {
+			return fmt.Errorf("error removing the replaced '%v': %v", name, err)
+		}
+	}
+	log.Logvf(log.Always, "removed all previous instances of '%v' from GridFS\n", name)
+	return nil
+}
+
+// handle logic for 'cp' command, copying the latest version of a file
+func (mf *MongoFiles) handleCopy(gfs *mgo.GridFS) error {
+	dst := mf.targetGridFS(gfs)
+	var doc bson.M
+	err := gfs.Find(bson.M{"filename": mf.FileName}).Sort("-uploadDate").One(&doc)
+	if err == mgo.ErrNotFound {
+		return fmt.Errorf("no GridFS file named '%v'", mf.FileName)
+	}
+	if err != nil {
+		return fmt.Errorf("error reading GridFS file '%v': %v", mf.FileName, err)
+	}
+	replaced, err := mf.targetIds(dst, mf.TargetName)
+	if err != nil {
+		return err
+	}
+	if _, err = copyFile(gfs, dst, doc, mf.TargetName, false); err != nil {
+		return fmt.Errorf("error while copying '%v': %v", mf.FileName, err)
+	}
+	if err = replaceTarget(dst, mf.TargetName, replaced); err != nil {
+		return err
+	}
+	log.Logvf(log.Always, "copied '%v' to '%v'", mf.FileName, mf.describeTarget())
+	return nil
+}
+
+// handle logic for 'mv' command, moving every version of a file. Within a
+// bucket, only the files documents change.
+func (mf *MongoFiles) handleMove(gfs *mgo.GridFS) error {
+	dst := mf.targetGridFS(gfs)
+	var docs []bson.M
+	if err := gfs.Find(bson.M{"filename": mf.FileName}).Sort("uploadDate").All(&docs); err != nil {
+		return fmt.Errorf("error reading GridFS file '%v': %v", mf.FileName, err)
+	}
+	if len(docs) == 0 {
+		return fmt.Errorf("no GridFS file named '%v'", mf.FileName)
+	}
+	replaced, err := mf.targetIds(dst, mf.TargetName)
+	if err != nil {
+		return err
+	}
+
+	if dst == gfs {
+		ids := make([]interface{}, len(docs))
+		for i, doc := range docs {
+			ids[i] = doc["_id"]
+		}
+		_, err = gfs.Files.UpdateAll(bson.M{"_id": bson.M{"$in": ids}},
+			bson.M{"$set": bson.M{"filename": mf.TargetName}})
+		if err != nil {
+			return fmt.Errorf("error while renaming '%v': %v", mf.FileName, err)
+		}
+	} else {
+		var copied []interface{}
+		for _, doc := range docs {
+			id, err := copyFile(gfs, dst, doc, mf.TargetName, true)
+			if err != nil {
+				// leave the source as it was
+				for _, id := range copied {
+					dst.RemoveId(id)
+				}
+				return fmt.Errorf("error while moving '%v': %v", mf.FileName, err)
+			}
+			copied = append(copied, id)
+		}
+		for _, doc := range docs {
+			if err = gfs.RemoveId(doc["_id"]); err != nil {
+				return fmt.Errorf("error while removing '%v' after copying it: %v", mf.FileName, err)
+			}
+		}
+	}
+
+	if err = replaceTarget(dst, mf.TargetName, replaced); err != nil {
+		return err
+	}
+	log.Logvf(log.Always, "moved '%v' to '%v'", mf.FileName, mf.describeTarget())
+	return nil
+}
+
+// describeTarget returns the name cp and mv write to, with its bucket if it
+// differs from the source's.
+func (mf *MongoFiles) describeTarget() string {
+	if mf.StorageOptions.ToPrefix == "" || mf.StorageOptions.ToPrefix == mf.StorageOptions.GridFSPrefix {
+		return mf.TargetName
+	}
+	return mf.StorageOptions.ToPrefix + ":" + mf.TargetName
+}
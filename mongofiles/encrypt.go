@@ -0,0 +1,198 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Files put with --encryptKeyFile are stored as a header followed by the
+// content in segments, each encrypted with AES-256-GCM. The nonce of each
+// segment is made of a random prefix from the header, the segment's number
+// and a flag set only on the last segment, so segments can't be reordered
+// and the content can't be truncated without the decryption failing.
+const (
+	encryptMagic       = "MFENC\x01"
+	encryptPrefixSize  = 7
+	encryptHeaderSize  = len(encryptMagic) + encryptPrefixSize
+	encryptSegmentSize = 64 * 1024
+	encryptOverhead    = 16
+)
+
+// parseEncryptionKey reads a 256-bit key from the contents of a key file,
+// encoded in hex or base64, e.g. as written by 'openssl rand -base64 32'.
+func parseEncryptionKey(contents []byte) ([]byte, error) {
+	text := strings.TrimSpace(string(contents))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("key file must hold a 32 byte key encoded in hex or base64")
+}
+
+// encryptionKey returns the key read from --encryptKeyFile, or nil if it
+// wasn't given.
+func (mf *MongoFiles) encryptionKey() ([]byte, error) {
+	if mf.StorageOptions.EncryptKeyFile == "" || mf.key != nil {
+		return mf.key, nil
+	}
+	contents, err := ioutil.ReadFile(mf.StorageOptions.EncryptKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading --encryptKeyFile: %v", err)
+	}
+	if mf.key, err = parseEncryptionKey(contents); err != nil {
+		return nil, fmt.Errorf("error reading --encryptKeyFile '%v': %v", mf.StorageOptions.EncryptKeyFile, err)
+	}
+	return mf.key, nil
+}
+
+// segmentNonce returns the nonce of segment n.
+func segmentNonce(prefix []byte, n uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encryptPrefixSize:], n)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptingReader encrypts everything read from an underlying reader.
+type encryptingReader struct {
+	source *bufio.Reader
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint32
+	out    bytes.Buffer
+	done   bool
+}
+
+// newEncryptingReader returns a reader of the encrypted form of everything
+// read from r.
+func newEncryptingReader(key []byte, r io.Reader) (io.Reader, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, encryptPrefixSize)
+	if _, err = io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, err
+	}
+	reader := &encryptingReader{
+		source: bufio.NewReaderSize(r, encryptSegmentSize),
+		aead:   aead,
+		prefix: prefix,
+	}
+	reader.out.WriteString(encryptMagic)
+	reader.out.Write(prefix)
+	return reader, nil
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		segment := make([]byte, encryptSegmentSize)
+		read, err := io.ReadFull(r.source, segment)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		// the segment is the last if nothing follows it
+		if err == nil {
+			_, err = r.source.Peek(1)
+			if err != nil && err != io.EOF {
+				return 0, err
+			}
+		}
+		last := err != nil
+		r.out.Write(r.aead.Seal(nil, segmentNonce(r.prefix, r.n, last), segment[:read], nil))
+		r.n++
+		r.done = last
+	}
+	return r.out.Read(p)
+}
+
+// decryptingWriter decrypts everything written to it into an underlying
+// writer. Close must be called to decrypt the last segment.
+type decryptingWriter struct {
+	dest   io.Writer
+	aead   cipher.AEAD
+	prefix []byte
+	n      uint32
+	in     bytes.Buffer
+}
+
+// newDecryptingWriter returns a writer that decrypts what is written to it
+// into w.
+func newDecryptingWriter(key []byte, w io.Writer) (io.WriteCloser, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptingWriter{dest: w, aead: aead}, nil
+}
+
+func (w *decryptingWriter) Write(p []byte) (int, error) {
+	w.in.Write(p)
+	if w.prefix == nil {
+		if w.in.Len() < encryptHeaderSize {
+			return len(p), nil
+		}
+		header := w.in.Next(encryptHeaderSize)
+		if string(header[:len(encryptMagic)]) != encryptMagic {
+			return 0, fmt.Errorf("file was not put with --encryptKeyFile")
+		}
+		w.prefix = append([]byte{}, header[len(encryptMagic):]...)
+	}
+	// a full segment is only known not to be the last once more follows
+	for w.in.Len() > encryptSegmentSize+encryptOverhead {
+		if err := w.decrypt(w.in.Next(encryptSegmentSize+encryptOverhead), false); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close decrypts the last segment.
+func (w *decryptingWriter) Close() error {
+	if w.prefix == nil {
+		return fmt.Errorf("file was not put with --encryptKeyFile")
+	}
+	return w.decrypt(w.in.Next(w.in.Len()), true)
+}
+
+func (w *decryptingWriter) decrypt(segment []byte, last bool) error {
+	plain, err := w.aead.Open(nil, segmentNonce(w.prefix, w.n, last), segment, nil)
+	if err != nil {
+		return fmt.Errorf("error decrypting file, it may be corrupt or the key may be wrong")
+	}
+	w.n++
+	_, err = w.dest.Write(plain)
+	return err
+}
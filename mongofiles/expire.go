@@ -0,0 +1,116 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ExpiresAtField is the metadata field that --expireAfter stamps files with.
+const ExpiresAtField = "expiresAt"
+
+// parseAge parses a positive duration such as "30d", "2w" or "36h". On top
+// of the units of time.ParseDuration, it accepts "d" for days and "w" for
+// weeks.
+func parseAge(value string) (time.Duration, error) {
+	age, err := parseDuration(value)
+	if err != nil {
+		return 0, err
+	}
+	if age <= 0 {
+		return 0, fmt.Errorf("duration '%v' must be positive", value)
+	}
+	return age, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if !strings.HasSuffix(value, suffix) {
+			continue
+		}
+		count, err := strconv.ParseFloat(strings.TrimSuffix(value, suffix), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%v'", value)
+		}
+		return time.Duration(count * float64(unit)), nil
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration '%v'", value)
+	}
+	return age, nil
+}
+
+// ensureExpiryIndex creates the index that expire uses to find the files
+// stamped by --expireAfter. It is not a TTL index, since the server would
+// then remove the files documents and leave their chunks behind.
+func ensureExpiryIndex(gfs *mgo.GridFS) error {
+	return gfs.Files.EnsureIndexKey("metadata." + ExpiresAtField)
+}
+
+// expiryQuery returns a query for the files that have expired as of now:
+// those stamped with a time that has passed and, with --olderThan, those
+// uploaded longer ago than it.
+func (mf *MongoFiles) expiryQuery(now time.Time) (bson.M, error) {
+	expired := []interface{}{bson.M{"metadata." + ExpiresAtField: bson.M{"$lte": now}}}
+	if mf.StorageOptions.OlderThan != "" {
+		age, err := parseAge(mf.StorageOptions.OlderThan)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing --olderThan: %v", err)
+		}
+		expired = append(expired, bson.M{"uploadDate": bson.M{"$lt": now.Add(-age)}})
+	}
+	query := bson.M{"$or": expired}
+	if mf.FileName == "" {
+		return query, nil
+	}
+	names := bson.M{"filename": mf.FileName}
+	if mf.isPattern() {
+		var err error
+		if names, err = mf.patternQuery(); err != nil {
+			return nil, err
+		}
+	}
+	return bson.M{"$and": []interface{}{names, query}}, nil
+}
+
+// handle logic for 'expire' command, removing every expired file, or
+// listing them with --dryRun
+func (mf *MongoFiles) handleExpire(gfs *mgo.GridFS) error {
+	query, err := mf.expiryQuery(time.Now())
+	if err != nil {
+		return err
+	}
+	var files []gridFileDoc
+	if err = gfs.Find(query).Sort("uploadDate").All(&files); err != nil {
+		return fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	for _, file := range files {
+		if mf.StorageOptions.DryRun {
+			log.Logvf(log.Always, "would expire '%v' (_id %v) uploaded %v", file.Filename, file.Id,
+				file.UploadDate.Format(time.RFC3339))
+			continue
+		}
+		if err = gfs.RemoveId(file.Id); err != nil {
+			return fmt.Errorf("error while removing '%v' from GridFS: %v", file.Filename, err)
+		}
+		log.Logvf(log.DebugLow, "expired '%v' (_id %v)", file.Filename, file.Id)
+	}
+	if mf.StorageOptions.DryRun {
+		log.Logvf(log.Always, "%v file(s) have expired; nothing was deleted", len(files))
+	} else {
+		log.Logvf(log.Always, "successfully deleted %v expired file(s) from GridFS", len(files))
+	}
+	return nil
+}
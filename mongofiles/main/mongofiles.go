@@ -9,8 +9,11 @@ package main
 
 import (
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/diagnose"
+	"github.com/mongodb/mongo-tools/common/failure"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/signals"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongofiles"
@@ -46,11 +49,16 @@ func main() {
 		return
 	}
 	log.SetVerbosity(opts.Verbosity)
-	signals.Handle()
+	log.SetFormat(opts.LogFormat, opts.AppName)
 
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
+	// test connecting to the server step by step, if specified
+	if opts.Diagnose {
+		os.Exit(diagnose.Run(opts, os.Stdout))
+	}
+
 	// add the specified database to the namespace options struct
 	opts.Namespace.DB = storageOpts.DB
 
@@ -58,7 +66,7 @@ func main() {
 	provider, err := db.NewSessionProvider(*opts)
 	if err != nil {
 		log.Logvf(log.Always, "error connecting to host: %v", err)
-		os.Exit(util.ExitError)
+		os.Exit(failure.ExitCode(err))
 	}
 	defer provider.Close()
 	mf := mongofiles.MongoFiles{
@@ -68,16 +76,33 @@ func main() {
 		InputOptions:    inputOpts,
 	}
 
+	// write progress events, if asked to
+	eventWriter, err := progress.OpenEventWriter(opts.ProgressFD, opts.ProgressSocket, opts.AppName, progress.DefaultWaitTime, true)
+	if err != nil {
+		log.Logvf(log.Always, "error opening progress event stream: %v", err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if eventWriter != nil {
+		eventWriter.Start()
+		defer eventWriter.Stop()
+		mf.ProgressManager = eventWriter
+	}
+
+	finishedChan := signals.HandleWithInterrupt(mf.HandleInterrupt)
+	defer close(finishedChan)
+
 	if err := mf.ValidateCommand(args); err != nil {
 		log.Logvf(log.Always, "%v", err)
 		log.Logvf(log.Always, "try 'mongofiles --help' for more information")
+		eventWriter.StopWithError(err)
 		os.Exit(util.ExitBadOptions)
 	}
 
 	output, err := mf.Run(true)
 	if err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitError)
+		eventWriter.StopWithError(err)
+		os.Exit(failure.ExitCode(err))
 	}
 	fmt.Printf("%s", output)
 }
@@ -0,0 +1,277 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// openBucket connects to the deployment at uri and returns the GridFS bucket
+// named prefix in the database the URI names, or in --db if it names none.
+// The returned function closes the connection.
+func (mf *MongoFiles) openBucket(uri, prefix string) (*mgo.GridFS, func(), error) {
+	opts := options.New("mongofiles", "", options.EnabledOptions{Auth: true, Connection: true, URI: true})
+	if mf.ToolOptions.SSL != nil {
+		ssl := *mf.ToolOptions.SSL
+		opts.SSL = &ssl
+	}
+	if _, err := opts.ParseArgs([]string{"--uri", uri}); err != nil {
+		return nil, nil, fmt.Errorf("error parsing connection string '%v': %v", uri, err)
+	}
+	provider, err := db.NewSessionProvider(*opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to '%v': %v", uri, err)
+	}
+	provider.SetFlags(db.DisableSocketTimeout)
+	session, err := provider.GetSession()
+	if err != nil {
+		provider.Close()
+		return nil, nil, fmt.Errorf("error connecting to '%v': %v", uri, err)
+	}
+	closer := func() {
+		session.Close()
+		provider.Close()
+	}
+
+	nodeType, err := provider.GetNodeType()
+	if err != nil {
+		closer()
+		return nil, nil, fmt.Errorf("error determining type of node connected: %v", err)
+	}
+	safety, err := db.BuildWriteConcern(mf.StorageOptions.WriteConcern, nodeType, opts.URI.ParsedConnString())
+	if err != nil {
+		closer()
+		return nil, nil, fmt.Errorf("error parsing write concern: %v", err)
+	}
+	session.SetSafe(safety)
+
+	database := opts.Namespace.DB
+	if database == "" {
+		database = mf.StorageOptions.DB
+	}
+	return mf.gridFS(session.DB(database), prefix), closer, nil
+}
+
+// migrateFile copies the GridFS file with the given files document from src
+// to dst, keeping its _id and files document as they are, and returns false
+// if dst already holds it. With --resume, chunks that an interrupted migration
+// left in dst are kept where they match the source's. Once every chunk is
+// stored, they're read back and checked against the source's checksum before the
+// files document is inserted, so the file only appears once it is whole.
+func (mf *MongoFiles) migrateFile(src, dst *mgo.GridFS, raw bson.Raw) (_ bool, err error) {
+	if mf.interrupted() {
+		return false, util.ErrTerminated
+	}
+	var doc gridFileDoc
+	var full bson.D
+	if err := raw.Unmarshal(&doc); err != nil {
+		return false, fmt.Errorf("error reading files document: %v", err)
+	}
+	if err := raw.Unmarshal(&full); err != nil {
+		return false, fmt.Errorf("error reading files document: %v", err)
+	}
+	if doc.ChunkSize <= 0 {
+		return false, fmt.Errorf("invalid chunk size %v", doc.ChunkSize)
+	}
+
+	var target gridFileDoc
+	err = dst.Files.FindId(doc.Id).One(&target)
+	switch {
+	case err == nil:
+		if target.Length == doc.Length && target.MD5 == doc.MD5 && target.SHA256 == doc.SHA256 {
+			return false, nil
+		}
+		return false, fmt.Errorf("the target already holds a different file with _id %v", doc.Id)
+	case err != mgo.ErrNotFound:
+		return false, fmt.Errorf("error reading target files document: %v", err)
+	}
+
+	// chunks left by an interrupted migration are kept with --resume, and
+	// otherwise replaced
+	var existing map[int]string
+	if mf.StorageOptions.Resume {
+		if existing, err = chunkHashes(dst.Chunks, doc.Id); err != nil {
+			return false, err
+		}
+	} else if _, err = dst.Chunks.RemoveAll(bson.M{"files_id": doc.Id}); err != nil {
+		return false, fmt.Errorf("error removing chunks of an earlier migration: %v", err)
+	}
+
+	transfer := mf.startTransfer(doc.Filename, doc.Length)
+	defer func() { transfer.Done(err) }()
+
+	session := dst.Chunks.Database.Session
+	jobs := make(chan gridChunk, mf.StorageOptions.NumParallelChunks)
+	failed := &firstError{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < mf.StorageOptions.NumParallelChunks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := session.Copy()
+			defer s.Close()
+			chunks := dst.Chunks.With(s)
+			for chunk := range jobs {
+				if failed.get() != nil {
+					continue
+				}
+				if err := chunks.Insert(chunk); err != nil {
+					failed.set(fmt.Errorf("error inserting chunk %v: %v", chunk.N, err))
+					continue
+				}
+				transfer.counter.Inc(int64(len(chunk.Data)))
+			}
+		}()
+	}
+
+	numChunks := int((doc.Length + int64(doc.ChunkSize) - 1) / int64(doc.ChunkSize))
+	sum, err := storedChecksum(doc)
+	if err != nil {
+		return false, err
+	}
+	next := 0
+	kept := 0
+	var chunk gridChunk
+	iter := src.Chunks.Find(bson.M{"files_id": doc.Id}).Select(bson.M{"_id": 0}).Sort("n").Iter()
+	for failed.get() == nil && iter.Next(&chunk) {
+		if mf.interrupted() {
+			// the chunks already migrated are kept for --resume
+			failed.set(util.ErrTerminated)
+			break
+		}
+		if chunk.N != next {
+			failed.set(fmt.Errorf("source chunk %v is missing", next))
+			break
+		}
+		if expected := expectedChunkLength(doc, next); int64(len(chunk.Data)) != expected {
+			failed.set(fmt.Errorf("source chunk %v has %v bytes, expected %v", next, len(chunk.Data), expected))
+			break
+		}
+		sum.Write(chunk.Data)
+		next++
+		if hash, ok := existing[chunk.N]; ok {
+			if hash == hashChunk(chunk.Data) {
+				transfer.counter.Inc(int64(len(chunk.Data)))
+				kept++
+				continue
+			}
+			if err = dst.Chunks.Remove(bson.M{"files_id": doc.Id, "n": chunk.N}); err != nil {
+				failed.set(fmt.Errorf("error removing chunk %v: %v", chunk.N, err))
+				break
+			}
+		}
+		jobs <- gridChunk{Id: bson.NewObjectId(), FilesId: doc.Id, N: chunk.N, Data: chunk.Data}
+		chunk = gridChunk{}
+	}
+	if err = iter.Close(); err != nil {
+		failed.set(fmt.Errorf("error reading source chunks: %v", err))
+	}
+	close(jobs)
+	wg.Wait()
+	if err = failed.get(); err != nil {
+		return false, err
+	}
+	if next < numChunks {
+		return false, fmt.Errorf("source chunk %v is missing", next)
+	}
+	if existing != nil {
+		log.Logvf(log.DebugLow, "kept %v chunks already migrated", kept)
+		if _, err = dst.Chunks.RemoveAll(bson.M{"files_id": doc.Id, "n": bson.M{"$gte": numChunks}}); err != nil {
+			return false, fmt.Errorf("error removing chunks past the end of the file: %v", err)
+		}
+	}
+
+	if !sum.Matches() {
+		return false, fmt.Errorf("source data does not match %v", sum)
+	}
+	// the copy is checked against what was read
+	check := doc
+	sum.store(&check)
+	problems, err := verifyFile(dst, check)
+	if err != nil {
+		return false, err
+	}
+	if len(problems) > 0 {
+		return false, fmt.Errorf("migrated chunks failed verification: %v", strings.Join(problems, "; "))
+	}
+
+	if err = dst.Files.Insert(full); err != nil {
+		return false, fmt.Errorf("error inserting files document: %v", err)
+	}
+	return true, nil
+}
+
+// handle logic for 'migrate' command, copying every file, or those matching
+// 'filename', from the source bucket to the one at --toUri
+func (mf *MongoFiles) handleMigrate(gfs *mgo.GridFS) error {
+	src := gfs
+	if mf.StorageOptions.FromURI != "" {
+		var closeSource func()
+		var err error
+		if src, closeSource, err = mf.openBucket(mf.StorageOptions.FromURI, mf.StorageOptions.GridFSPrefix); err != nil {
+			return err
+		}
+		defer closeSource()
+	}
+	prefix := mf.StorageOptions.ToPrefix
+	if prefix == "" {
+		prefix = mf.StorageOptions.GridFSPrefix
+	}
+	dst, closeTarget, err := mf.openBucket(mf.StorageOptions.ToURI, prefix)
+	if err != nil {
+		return err
+	}
+	defer closeTarget()
+	if err = dst.Chunks.EnsureIndex(mgo.Index{Key: []string{"files_id", "n"}, Unique: true}); err != nil {
+		return fmt.Errorf("error creating chunks index on the target: %v", err)
+	}
+	if err = dst.Files.EnsureIndexKey("filename", "uploadDate"); err != nil {
+		return fmt.Errorf("error creating files index on the target: %v", err)
+	}
+
+	query := bson.M{}
+	if mf.isPattern() {
+		if query, err = mf.patternQuery(); err != nil {
+			return err
+		}
+	} else if mf.FileName != "" {
+		query = bson.M{"filename": mf.FileName}
+	}
+	// the files documents are read up front so the cursor can't time out
+	// while large files are copied
+	var docs []bson.Raw
+	if err = src.Find(query).Sort("uploadDate").All(&docs); err != nil {
+		return fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+
+	migrated := 0
+	for _, raw := range docs {
+		var doc gridFileDoc
+		raw.Unmarshal(&doc)
+		copied, err := mf.migrateFile(src, dst, raw)
+		if err != nil {
+			return fmt.Errorf("error while migrating '%v' (_id %v): %v", doc.Filename, doc.Id, err)
+		}
+		if !copied {
+			log.Logvf(log.DebugLow, "'%v' (_id %v) is already in the target", doc.Filename, doc.Id)
+			continue
+		}
+		log.Logvf(log.DebugLow, "migrated '%v' (_id %v)", doc.Filename, doc.Id)
+		migrated++
+	}
+	log.Logvf(log.Always, "migrated %v file(s), %v already in the target", migrated, len(docs)-migrated)
+	return nil
+}
@@ -8,17 +8,25 @@
 package mongofiles
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/bsonutil"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/failure"
+	"github.com/mongodb/mongo-tools/common/fips"
 	"github.com/mongodb/mongo-tools/common/json"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/storage"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -26,14 +34,24 @@ import (
 
 // List of possible commands for mongofiles.
 const (
-	List     = "list"
-	Search   = "search"
-	Put      = "put"
-	PutID    = "put_id"
-	Get      = "get"
-	GetID    = "get_id"
-	Delete   = "delete"
-	DeleteID = "delete_id"
+	List       = "list"
+	Search     = "search"
+	Put        = "put"
+	PutID      = "put_id"
+	Get        = "get"
+	GetID      = "get_id"
+	Delete     = "delete"
+	DeleteID   = "delete_id"
+	PutDir     = "put_dir"
+	GetDir     = "get_dir"
+	PutArchive = "put_archive"
+	Meta       = "meta"
+	Sync       = "sync"
+	Verify     = "verify"
+	Copy       = "cp"
+	Move       = "mv"
+	Expire     = "expire"
+	Migrate    = "migrate"
 )
 
 // MongoFiles is a container for the user-specified options and
@@ -51,6 +69,9 @@ type MongoFiles struct {
 	// for connecting to the db
 	SessionProvider *db.SessionProvider
 
+	// if set, tracks the progress of transfers besides their progress bars
+	ProgressManager progress.Manager
+
 	// command to run
 	Command string
 
@@ -59,6 +80,27 @@ type MongoFiles struct {
 
 	//ID to put into GridFS
 	Id string
+
+	// local directory for put_dir, get_dir and sync
+	LocalDir string
+
+	// local archive for put_archive
+	Archive string
+
+	// name that cp and mv write to
+	TargetName string
+
+	// key read from --encryptKeyFile
+	key []byte
+
+	// totals of the files transferred
+	stats transferStats
+
+	// for sync, true when copying the local directory into GridFS
+	Upload bool
+
+	// termChan is closed by HandleInterrupt to stop the command.
+	termChan chan struct{}
 }
 
 // GFSFile represents a GridFS file.
@@ -70,6 +112,7 @@ type GFSFile struct {
 	Md5         string        `bson:"md5"`
 	UploadDate  time.Time     `bson:"uploadDate"`
 	ContentType string        `bson:"contentType,omitempty"`
+	Metadata    bson.D        `bson:"metadata,omitempty"`
 }
 
 // ValidateCommand ensures the arguments supplied are valid.
@@ -80,8 +123,15 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		return fmt.Errorf("no command specified")
 	}
 
-	switch args[0] {
-	case List:
+	// the directory and archive commands may also be spelled put-dir,
+	// get-dir and put-archive
+	command := strings.Replace(args[0], "-", "_", -1)
+	if command != PutDir && command != GetDir && command != PutArchive {
+		command = args[0]
+	}
+
+	switch command {
+	case List, Verify, Expire, Migrate:
 		if len(args) > 2 {
 			return fmt.Errorf("too many positional arguments")
 		}
@@ -90,7 +140,7 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		} else {
 			mf.FileName = args[1]
 		}
-	case Search, Put, Get, Delete:
+	case Search, Put, Get, Delete, Meta:
 		if len(args) > 2 {
 			return fmt.Errorf("too many positional arguments")
 		}
@@ -117,22 +167,247 @@ func (mf *MongoFiles) ValidateCommand(args []string) error {
 		}
 		mf.FileName = args[1]
 		mf.Id = args[2]
+	case PutDir:
+		if len(args) > 3 {
+			return fmt.Errorf("too many positional arguments")
+		}
+		if len(args) == 1 || args[1] == "" {
+			return fmt.Errorf("'%v' argument missing", command)
+		}
+		mf.LocalDir = args[1]
+		mf.FileName = ""
+		if len(args) == 3 {
+			mf.FileName = args[2]
+		}
+	case PutArchive:
+		if len(args) > 3 {
+			return fmt.Errorf("too many positional arguments")
+		}
+		if len(args) == 1 || args[1] == "" {
+			return fmt.Errorf("'%v' argument missing", command)
+		}
+		mf.Archive = args[1]
+		mf.FileName = ""
+		if len(args) == 3 {
+			mf.FileName = args[2]
+		}
+	case GetDir:
+		if len(args) > 3 {
+			return fmt.Errorf("too many positional arguments")
+		}
+		if len(args) == 1 {
+			return fmt.Errorf("'%v' argument missing", command)
+		}
+		mf.FileName = args[1]
+		mf.LocalDir = "."
+		if len(args) == 3 && args[2] != "" {
+			mf.LocalDir = args[2]
+		}
+	case Copy, Move:
+		if len(args) > 3 {
+			return fmt.Errorf("too many positional arguments")
+		}
+		if len(args) < 3 || args[1] == "" || args[2] == "" {
+			return fmt.Errorf("'%v' argument(s) missing", command)
+		}
+		mf.FileName, mf.TargetName = args[1], args[2]
+		sameBucket := mf.StorageOptions.ToPrefix == "" || mf.StorageOptions.ToPrefix == mf.StorageOptions.GridFSPrefix
+		if sameBucket && mf.FileName == mf.TargetName {
+			if command == Copy {
+				return fmt.Errorf("cannot copy '%v' onto itself", mf.FileName)
+			}
+			return fmt.Errorf("cannot move '%v' onto itself", mf.FileName)
+		}
+	case Sync:
+		if len(args) > 3 {
+			return fmt.Errorf("too many positional arguments")
+		}
+		if len(args) < 3 || args[1] == "" || args[2] == "" {
+			return fmt.Errorf("'%v' argument(s) missing", command)
+		}
+		srcBucket, srcPrefix, srcRemote := parseGridFSURL(args[1])
+		dstBucket, dstPrefix, dstRemote := parseGridFSURL(args[2])
+		if srcRemote == dstRemote {
+			return fmt.Errorf("sync needs a local directory and a %vbucket/prefix URL", GridFSURLScheme)
+		}
+		bucket := srcBucket
+		mf.FileName, mf.LocalDir, mf.Upload = srcPrefix, args[2], false
+		if dstRemote {
+			bucket = dstBucket
+			mf.FileName, mf.LocalDir, mf.Upload = dstPrefix, args[1], true
+		}
+		if bucket != "" {
+			mf.StorageOptions.GridFSPrefix = bucket
+		}
 	default:
 		return fmt.Errorf("'%v' is not a valid command", args[0])
 	}
 
+	if mf.StorageOptions.Out != "" {
+		if command != Get && command != GetID {
+			return fmt.Errorf("--out can only be used with get or get_id")
+		}
+		if mf.StorageOptions.LocalFileName != "" && mf.StorageOptions.LocalFileName != mf.StorageOptions.Out {
+			return fmt.Errorf("--out and --local cannot both be given")
+		}
+		mf.StorageOptions.LocalFileName = mf.StorageOptions.Out
+	}
+
 	if mf.StorageOptions.GridFSPrefix == "" {
 		return fmt.Errorf("--prefix can not be blank")
 	}
 
-	mf.Command = args[0]
+	if mf.InputOptions.Regex {
+		switch command {
+		case List, Get, Delete, Verify, Expire, Migrate:
+		default:
+			return fmt.Errorf("--regex can only be used with list, get, delete, verify, expire or migrate")
+		}
+	}
+	if mf.StorageOptions.NumParallelChunks < 1 {
+		return fmt.Errorf("--numParallelChunks must be at least 1")
+	}
+	if mf.StorageOptions.Metadata != "" && !isPutCommand(command) {
+		return fmt.Errorf("--metadata can only be used with put commands")
+	}
+	if mf.InputOptions.Filter != "" && command != List && command != Search {
+		return fmt.Errorf("--filter can only be used with list or search")
+	}
+	if mf.StorageOptions.DryRun && command != Delete && command != Sync && command != Expire {
+		return fmt.Errorf("--dryRun can only be used with delete, sync or expire")
+	}
+	if mf.StorageOptions.OlderThan != "" && command != Expire {
+		return fmt.Errorf("--olderThan can only be used with expire")
+	}
+	if mf.StorageOptions.ExpireAfter != "" && !isPutCommand(command) {
+		return fmt.Errorf("--expireAfter can only be used with put commands")
+	}
+	if mf.StorageOptions.Extract && command != PutArchive {
+		return fmt.Errorf("--extract can only be used with put_archive")
+	}
+	if mf.StorageOptions.EncryptKeyFile != "" {
+		switch command {
+		case Put, PutID, PutDir, PutArchive, Get, GetID, GetDir:
+		default:
+			return fmt.Errorf("--encryptKeyFile can only be used with put or get commands")
+		}
+		if mf.StorageOptions.Resume {
+			return fmt.Errorf("--resume cannot be used with --encryptKeyFile")
+		}
+	}
+	if mf.StorageOptions.ToPrefix != "" && command != Copy && command != Move && command != Migrate {
+		return fmt.Errorf("--toPrefix can only be used with cp, mv or migrate")
+	}
+	if (mf.StorageOptions.FromURI != "" || mf.StorageOptions.ToURI != "") && command != Migrate {
+		return fmt.Errorf("--fromUri and --toUri can only be used with migrate")
+	}
+	if command == Migrate && mf.StorageOptions.ToURI == "" {
+		return fmt.Errorf("migrate needs --toUri")
+	}
+	if mf.StorageOptions.Delete && command != Sync {
+		return fmt.Errorf("--delete can only be used with sync")
+	}
+	if mf.StorageOptions.Resume {
+		switch command {
+		case Put, PutID, PutDir, Migrate:
+		case Get, GetID, GetDir:
+			if mf.StorageOptions.NumParallelChunks > 1 {
+				return fmt.Errorf("--resume cannot be used with --numParallelChunks for %v", command)
+			}
+		default:
+			return fmt.Errorf("--resume can only be used with put, get or migrate commands")
+		}
+	}
+	if mf.StorageOptions.Hash == "" && fips.Enabled() {
+		mf.StorageOptions.Hash = HashSHA256
+	}
+	if mf.StorageOptions.Hash == HashMD5 {
+		if err := fips.Forbid("MD5", "use --hash=sha256 to store files with their SHA-256"); err != nil {
+			return err
+		}
+	}
+	if command == Get && mf.StorageOptions.LocalFileName != "" && mf.isPattern() {
+		return fmt.Errorf("--local cannot be used when get is given a pattern")
+	}
+
+	mf.Command = command
 	return nil
 }
 
+// isPutCommand returns true for the commands that store files.
+func isPutCommand(command string) bool {
+	return command == Put || command == PutID || command == PutDir || command == PutArchive
+}
+
+// isPattern returns true if the filename given on the command line matches
+// files by pattern, rather than naming a single file.
+func (mf *MongoFiles) isPattern() bool {
+	return mf.InputOptions.Regex || strings.ContainsAny(mf.FileName, "*?[")
+}
+
+// patternQuery returns a query for the files matched by the filename given
+// on the command line, which must be a pattern.
+func (mf *MongoFiles) patternQuery() (bson.M, error) {
+	expr := mf.FileName
+	if !mf.InputOptions.Regex {
+		var err error
+		if expr, err = globToRegex(mf.FileName); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := regexp.Compile(expr); err != nil {
+		return nil, fmt.Errorf("invalid pattern '%v': %v", mf.FileName, err)
+	}
+	return bson.M{"filename": bson.M{"$regex": expr}}, nil
+}
+
+// globToRegex translates a glob in which '*' and '?' match any characters
+// but '/', and '[...]' matches a class of characters, into an anchored
+// regular expression.
+func globToRegex(glob string) (string, error) {
+	var expr bytes.Buffer
+	expr.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			expr.WriteString("[^/]*")
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("invalid pattern '%v': unterminated '['", glob)
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return expr.String(), nil
+}
+
 // Query GridFS for files and display the results.
 func (mf *MongoFiles) findAndDisplay(gfs *mgo.GridFS, query bson.M) (string, error) {
 	display := ""
 
+	if mf.InputOptions.Filter != "" {
+		filter, err := parseJSONObject("--filter", mf.InputOptions.Filter)
+		if err != nil {
+			return "", err
+		}
+		if len(query) == 0 {
+			query = filter
+		} else {
+			query = bson.M{"$and": []interface{}{query, filter}}
+		}
+	}
+
 	cursor := gfs.Find(query).Iter()
 	defer cursor.Close()
 
@@ -169,10 +444,28 @@ func (mf *MongoFiles) handleGet(gfs *mgo.GridFS) error {
 		return fmt.Errorf("error opening GridFS file '%s': %v", mf.FileName, err)
 	}
 	defer gFile.Close()
-	if err = mf.writeFile(gFile); err != nil {
+	if err = mf.writeFile(gfs, gFile); err != nil {
+		return err
+	}
+	log.Logvf(log.Always, fmt.Sprintf("finished writing to %s\n", describeLocal(mf.getLocalFileName(gFile), "stdout")))
+	return nil
+}
+
+// handle logic for 'get' with a pattern, writing every matching file under
+// its own name
+func (mf *MongoFiles) handleGetMatching(gfs *mgo.GridFS) error {
+	query, err := mf.patternQuery()
+	if err != nil {
+		return err
+	}
+	count, err := mf.writeMatching(gfs, query, ".", "")
+	if err != nil {
 		return err
 	}
-	log.Logvf(log.Always, fmt.Sprintf("finished writing to %s\n", mf.getLocalFileName(gFile)))
+	if count == 0 {
+		return fmt.Errorf("no GridFS files match '%v'", mf.FileName)
+	}
+	log.Logvf(log.Always, "finished writing %v file(s) matching '%v'", count, mf.FileName)
 	return nil
 }
 
@@ -188,15 +481,18 @@ func (mf *MongoFiles) handleGetID(gfs *mgo.GridFS) error {
 		return fmt.Errorf("error opening GridFS file with _id %s: %v", mf.Id, err)
 	}
 	defer gFile.Close()
-	if err = mf.writeFile(gFile); err != nil {
+	if err = mf.writeFile(gfs, gFile); err != nil {
 		return err
 	}
-	log.Logvf(log.Always, fmt.Sprintf("finished writing to: %s\n", mf.getLocalFileName(gFile)))
+	log.Logvf(log.Always, fmt.Sprintf("finished writing to: %s\n", describeLocal(mf.getLocalFileName(gFile), "stdout")))
 	return nil
 }
 
 // logic for deleting a file
 func (mf *MongoFiles) handleDelete(gfs *mgo.GridFS) error {
+	if mf.isPattern() || mf.StorageOptions.DryRun {
+		return mf.handleDeleteMatching(gfs)
+	}
 	err := gfs.Remove(mf.FileName)
 	if err != nil {
 		return fmt.Errorf("error while removing '%v' from GridFS: %v\n", mf.FileName, err)
@@ -205,6 +501,38 @@ func (mf *MongoFiles) handleDelete(gfs *mgo.GridFS) error {
 	return nil
 }
 
+// logic for deleting every file matching a pattern, or listing them with
+// --dryRun
+func (mf *MongoFiles) handleDeleteMatching(gfs *mgo.GridFS) error {
+	query := bson.M{"filename": mf.FileName}
+	if mf.isPattern() {
+		var err error
+		if query, err = mf.patternQuery(); err != nil {
+			return err
+		}
+	}
+	var files []GFSFile
+	if err := gfs.Find(query).Sort("filename").All(&files); err != nil {
+		return fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	for _, file := range files {
+		if mf.StorageOptions.DryRun {
+			log.Logvf(log.Always, "would delete '%v' (_id %v)", file.Name, file.Id.Hex())
+			continue
+		}
+		if err := gfs.RemoveId(file.Id); err != nil {
+			return fmt.Errorf("error while removing '%v' from GridFS: %v", file.Name, err)
+		}
+		log.Logvf(log.DebugLow, "deleted '%v' (_id %v)", file.Name, file.Id.Hex())
+	}
+	if mf.StorageOptions.DryRun {
+		log.Logvf(log.Always, "%v file(s) match '%v'; nothing was deleted", len(files), mf.FileName)
+	} else {
+		log.Logvf(log.Always, "successfully deleted %v file(s) matching '%v' from GridFS", len(files), mf.FileName)
+	}
+	return nil
+}
+
 // logic for deleting a file with 'delete_id'
 func (mf *MongoFiles) handleDeleteID(gfs *mgo.GridFS) error {
 	id, err := mf.parseID()
@@ -218,6 +546,66 @@ func (mf *MongoFiles) handleDeleteID(gfs *mgo.GridFS) error {
 	return nil
 }
 
+// handle logic for 'meta' command, returning the metadata of the latest
+// file with the given name as extended JSON
+func (mf *MongoFiles) handleMeta(gfs *mgo.GridFS) (string, error) {
+	var file GFSFile
+	err := gfs.Find(bson.M{"filename": mf.FileName}).Sort("-uploadDate").One(&file)
+	if err == mgo.ErrNotFound {
+		return "", fmt.Errorf("no GridFS file named '%v'", mf.FileName)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading GridFS file '%v': %v", mf.FileName, err)
+	}
+	if file.Metadata == nil {
+		return "{}\n", nil
+	}
+	asJSON, err := bsonutil.ConvertBSONValueToJSON(file.Metadata)
+	if err != nil {
+		return "", fmt.Errorf("error converting metadata to JSON: %v", err)
+	}
+	out, err := json.Marshal(asJSON)
+	if err != nil {
+		return "", fmt.Errorf("error converting metadata to JSON: %v", err)
+	}
+	return string(out) + "\n", nil
+}
+
+// metadata returns the document given with --metadata, stamped with the
+// time the file expires if --expireAfter is set, or nil if there is none.
+func (mf *MongoFiles) metadata() (bson.M, error) {
+	var metadata bson.M
+	if mf.StorageOptions.Metadata != "" {
+		var err error
+		if metadata, err = parseJSONObject("--metadata", mf.StorageOptions.Metadata); err != nil {
+			return nil, err
+		}
+	}
+	if mf.StorageOptions.ExpireAfter != "" {
+		age, err := parseAge(mf.StorageOptions.ExpireAfter)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing --expireAfter: %v", err)
+		}
+		if metadata == nil {
+			metadata = bson.M{}
+		}
+		metadata[ExpiresAtField] = time.Now().Add(age)
+	}
+	return metadata, nil
+}
+
+// parseJSONObject parses an extended JSON document given with an option.
+func parseJSONObject(option, raw string) (bson.M, error) {
+	parsed := bson.M{}
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil, fmt.Errorf("error parsing %v as json: %v; make sure you are properly escaping input", option, err)
+	}
+	if err := bsonutil.ConvertJSONDocumentToBSON(parsed); err != nil {
+		return nil, fmt.Errorf("error converting %v to bson: %v", option, err)
+	}
+	return parsed, nil
+}
+
 // parse and convert extended JSON
 func (mf *MongoFiles) parseID() (interface{}, error) {
 	// parse the id using extended json
@@ -235,54 +623,202 @@ func (mf *MongoFiles) parseID() (interface{}, error) {
 }
 
 // writeFile writes a file from gridFS to stdout or the filesystem.
-func (mf *MongoFiles) writeFile(gridFile *mgo.GridFile) (err error) {
-	localFileName := mf.getLocalFileName(gridFile)
+func (mf *MongoFiles) writeFile(gfs *mgo.GridFS, gridFile *mgo.GridFile) error {
+	return mf.writeFileTo(gfs, gridFile, mf.getLocalFileName(gridFile))
+}
+
+// describeLocal returns how to refer to a local file in messages: stream,
+// i.e. "stdin" or "stdout", if localFileName is "-", or the quoted name.
+func describeLocal(localFileName, stream string) string {
+	if localFileName == "-" {
+		return stream
+	}
+	return fmt.Sprintf("'%v'", localFileName)
+}
+
+// writeFileTo writes a file from gridFS to stdout, if localFileName is "-",
+// or to the named local file.
+func (mf *MongoFiles) writeFileTo(gfs *mgo.GridFS, gridFile *mgo.GridFile, localFileName string) (err error) {
+	if mf.interrupted() {
+		return util.ErrTerminated
+	}
+	key, err := mf.encryptionKey()
+	if err != nil {
+		return err
+	}
+	transfer := mf.startTransfer(gridFile.Name(), gridFile.Size())
+	defer func() { transfer.Done(err) }()
+
 	var localFile io.WriteCloser
 	if localFileName == "-" {
+		if mf.StorageOptions.Resume {
+			return fmt.Errorf("cannot resume writing '%v' to stdout", gridFile.Name())
+		}
 		localFile = os.Stdout
+	} else if storage.IsURL(localFileName) {
+		if mf.StorageOptions.Resume {
+			return fmt.Errorf("cannot resume writing '%v' to cloud storage", gridFile.Name())
+		}
+		var upload storage.Writer
+		if upload, err = storage.Create(localFileName); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				// don't leave a partial object behind
+				upload.Abort()
+			} else if err = upload.Close(); err != nil {
+				err = fmt.Errorf("error while writing data into '%v': %v", localFileName, err)
+			}
+		}()
+		localFile = upload
+	} else if mf.StorageOptions.Resume {
+		var file *os.File
+		if file, err = os.OpenFile(localFileName, os.O_RDWR|os.O_CREATE, 0666); err != nil {
+			return fmt.Errorf("error while opening local file '%v': %v\n", localFileName, err)
+		}
+		defer file.Close()
+		if err = mf.getResumable(gfs, gridFile.Id(), file, transfer); err != nil {
+			return fmt.Errorf("error while writing data into local file '%v': %v\n", localFileName, err)
+		}
+		return nil
 	} else {
-		if localFile, err = os.Create(localFileName); err != nil {
+		var file *os.File
+		if file, err = os.Create(localFileName); err != nil {
 			return fmt.Errorf("error while opening local file '%v': %v\n", localFileName, err)
 		}
-		defer localFile.Close()
+		defer file.Close()
 		log.Logvf(log.DebugLow, "created local file '%v'", localFileName)
+
+		// stdout and encrypted content can only be written in order, so
+		// only other local files are fetched in parallel
+		if mf.StorageOptions.NumParallelChunks > 1 && key == nil {
+			if err = mf.getParallel(gfs, gridFile.Id(), file, transfer); err != nil {
+				return fmt.Errorf("error while writing data into local file '%v': %v\n", localFileName, err)
+			}
+			return nil
+		}
+		localFile = file
 	}
 
-	if _, err = io.Copy(localFile, gridFile); err != nil {
-		return fmt.Errorf("error while writing data into local file '%v': %v\n", localFileName, err)
+	if key != nil {
+		if localFile, err = newDecryptingWriter(key, localFile); err != nil {
+			return err
+		}
+	}
+	if _, err = io.Copy(localFile, transfer.Reader(gridFile)); err == nil && key != nil {
+		err = localFile.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("error while writing data into %v: %v\n", describeLocal(localFileName, "stdout"), err)
 	}
 	return nil
 }
 
-func (mf *MongoFiles) handlePut(gfs *mgo.GridFS, hasID bool) (err error) {
-	localFileName := mf.getLocalFileName(nil)
-
-	// check if --replace flag turned on
-	if mf.StorageOptions.Replace {
-		err = gfs.Remove(mf.FileName)
-		if err != nil {
+func (mf *MongoFiles) handlePut(gfs *mgo.GridFS, hasID bool) error {
+	var id interface{}
+	if hasID {
+		var err error
+		if id, err = mf.parseID(); err != nil {
 			return err
 		}
-		// always log that data has been removed
-		log.Logvf(log.Always, "removed all instances of '%v' from GridFS\n", mf.FileName)
 	}
+	return mf.putFile(gfs, mf.getLocalFileName(nil), mf.FileName, id)
+}
 
+// putFile stores a local file, or stdin if localFileName is "-", in GridFS
+// under fileName. If id is not nil, it is used as the file's _id.
+func (mf *MongoFiles) putFile(gfs *mgo.GridFS, localFileName, fileName string, id interface{}) error {
 	var localFile io.ReadCloser
 
 	if localFileName == "-" {
 		localFile = os.Stdin
+	} else if storage.IsURL(localFileName) {
+		object, err := storage.Open(localFileName)
+		if err != nil {
+			return err
+		}
+		defer object.Close()
+		localFile = object
+		log.Logvf(log.DebugLow, "creating GridFS file '%v' from '%v'", fileName, localFileName)
 	} else {
-		localFile, err = os.Open(localFileName)
+		file, err := os.Open(localFileName)
 		if err != nil {
 			return fmt.Errorf("error while opening local file '%v' : %v\n", localFileName, err)
 		}
-		defer localFile.Close()
-		log.Logvf(log.DebugLow, "creating GridFS file '%v' from local file '%v'", mf.FileName, localFileName)
+		defer file.Close()
+		localFile = file
+		log.Logvf(log.DebugLow, "creating GridFS file '%v' from local file '%v'", fileName, localFileName)
+	}
+
+	return mf.putReader(gfs, localFile, describeLocal(localFileName, "stdin"), fileName, id)
+}
+
+// putReader stores everything read from localFile in GridFS under
+// fileName. If id is not nil, it is used as the file's _id. description
+// names where the data comes from in errors.
+func (mf *MongoFiles) putReader(gfs *mgo.GridFS, localFile io.Reader, description, fileName string, id interface{}) (err error) {
+	if mf.interrupted() {
+		return util.ErrTerminated
+	}
+	metadata, err := mf.metadata()
+	if err != nil {
+		return err
+	}
+	key, err := mf.encryptionKey()
+	if err != nil {
+		return err
+	}
+	if mf.StorageOptions.ExpireAfter != "" {
+		if err = ensureExpiryIndex(gfs); err != nil {
+			return fmt.Errorf("error creating index on metadata.%v: %v", ExpiresAtField, err)
+		}
+	}
+
+	// check if --replace flag turned on
+	if mf.StorageOptions.Replace {
+		err = gfs.Remove(fileName)
+		if err != nil {
+			return err
+		}
+		// always log that data has been removed
+		log.Logvf(log.Always, "removed all instances of '%v' from GridFS\n", fileName)
+	}
+
+	var size int64
+	if file, ok := localFile.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			size = info.Size()
+		}
+	}
+	transfer := mf.startTransfer(fileName, size)
+	defer func() { transfer.Done(err) }()
+
+	var source io.Reader = transfer.Reader(localFile)
+	if key != nil {
+		if source, err = newEncryptingReader(key, source); err != nil {
+			return err
+		}
+	}
+
+	if mf.StorageOptions.Resume || mf.StorageOptions.NumParallelChunks > 1 {
+		var n int64
+		if mf.StorageOptions.Resume {
+			n, err = mf.putResumable(gfs, source, fileName, id)
+		} else {
+			n, err = mf.putParallel(gfs, source, fileName, id)
+		}
+		if err != nil {
+			return fmt.Errorf("error while storing %v into GridFS: %v\n", description, err)
+		}
+		log.Logvf(log.DebugLow, "copied %v bytes to server", n)
+		log.Logvf(log.Always, "added file: %v\n", fileName)
+		return nil
 	}
 
-	gridFile, err := gfs.Create(mf.FileName)
+	gridFile, err := gfs.Create(fileName)
 	if err != nil {
-		return fmt.Errorf("error while creating '%v' in GridFS: %v\n", mf.FileName, err)
+		return fmt.Errorf("error while creating '%v' in GridFS: %v\n", fileName, err)
 	}
 	defer func() {
 		// GridFS files flush a buffer on Close(), so it's important we
@@ -290,15 +826,11 @@ func (mf *MongoFiles) handlePut(gfs *mgo.GridFS, hasID bool) (err error) {
 		// overwrite the error if earlier writes executed successfully
 		if closeErr := gridFile.Close(); err == nil && closeErr != nil {
 			log.Logvf(log.DebugHigh, "error occurred while closing GridFS file handler")
-			err = fmt.Errorf("error while storing '%v' into GridFS: %v\n", localFileName, closeErr)
+			err = fmt.Errorf("error while storing %v into GridFS: %v\n", description, closeErr)
 		}
 	}()
 
-	if hasID {
-		id, err := mf.parseID()
-		if err != nil {
-			return err
-		}
+	if id != nil {
 		gridFile.SetId(id)
 	}
 
@@ -307,9 +839,15 @@ func (mf *MongoFiles) handlePut(gfs *mgo.GridFS, hasID bool) (err error) {
 		gridFile.SetContentType(mf.StorageOptions.ContentType)
 	}
 
-	n, err := io.Copy(gridFile, localFile)
+	if metadata != nil {
+		gridFile.SetMeta(metadata)
+	}
+
+	n, err := io.Copy(gridFile, source)
 	if err != nil {
-		return fmt.Errorf("error while storing '%v' into GridFS: %v\n", localFileName, err)
+		// don't store what was read as the whole file
+		gridFile.Abort()
+		return fmt.Errorf("error while storing %v into GridFS: %v\n", description, err)
 	}
 	log.Logvf(log.DebugLow, "copied %v bytes to server", n)
 
@@ -317,9 +855,134 @@ func (mf *MongoFiles) handlePut(gfs *mgo.GridFS, hasID bool) (err error) {
 	return nil
 }
 
+// handle logic for 'put_dir' command
+func (mf *MongoFiles) handlePutDir(gfs *mgo.GridFS) error {
+	count := 0
+	err := filepath.Walk(mf.LocalDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(mf.LocalDir, path)
+		if err != nil {
+			return err
+		}
+		if err = mf.putFile(gfs, path, mf.FileName+filepath.ToSlash(rel), nil); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error while storing directory '%v' into GridFS: %v", mf.LocalDir, err)
+	}
+	log.Logvf(log.Always, "added %v file(s) from %v", count, mf.LocalDir)
+	return nil
+}
+
+// localPathInDir returns where get_dir writes the GridFS file fileName,
+// which starts with prefix, under dir. It refuses names that would be
+// written outside of dir.
+func localPathInDir(dir, prefix, fileName string) (string, error) {
+	rel := strings.TrimLeft(strings.TrimPrefix(fileName, prefix), "/")
+	if rel == "" || strings.HasSuffix(rel, "/") {
+		return "", fmt.Errorf("GridFS file '%v' does not name a file under '%v'", fileName, prefix)
+	}
+	rel = path.Clean(rel)
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("GridFS file '%v' would be written outside of '%v'", fileName, dir)
+	}
+	return filepath.Join(dir, filepath.FromSlash(rel)), nil
+}
+
+// handle logic for 'get_dir' command
+func (mf *MongoFiles) handleGetDir(gfs *mgo.GridFS) error {
+	query := bson.M{"filename": bson.M{"$regex": "^" + regexp.QuoteMeta(mf.FileName)}}
+	count, err := mf.writeMatching(gfs, query, mf.LocalDir, mf.FileName)
+	if err != nil {
+		return err
+	}
+	log.Logvf(log.Always, "finished writing %v file(s) to %v", count, mf.LocalDir)
+	return nil
+}
+
+// writeMatching writes the latest version of every GridFS file matching
+// query to its path under dir, which is the rest of its name after prefix.
+// It returns the number of files written.
+func (mf *MongoFiles) writeMatching(gfs *mgo.GridFS, query bson.M, dir, prefix string) (int, error) {
+	// newest first, so that only the latest version of each name is written
+	cursor := gfs.Find(query).Sort("filename", "-uploadDate").Iter()
+	defer cursor.Close()
+
+	count := 0
+	seen := map[string]bool{}
+	var file GFSFile
+	for cursor.Next(&file) {
+		if seen[file.Name] {
+			continue
+		}
+		seen[file.Name] = true
+		localFileName, err := localPathInDir(dir, prefix, file.Name)
+		if err != nil {
+			log.Logvf(log.Always, "skipping: %v", err)
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(localFileName), 0755); err != nil {
+			return count, fmt.Errorf("error while creating directory for '%v': %v", localFileName, err)
+		}
+		gFile, err := gfs.OpenId(file.Id)
+		if err != nil {
+			return count, fmt.Errorf("error opening GridFS file '%s': %v", file.Name, err)
+		}
+		err = mf.writeFileTo(gfs, gFile, localFileName)
+		gFile.Close()
+		if err != nil {
+			return count, err
+		}
+		log.Logvf(log.DebugLow, "wrote GridFS file '%v' to '%v'", file.Name, localFileName)
+		count++
+	}
+	if err := cursor.Err(); err != nil {
+		return count, fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	return count, nil
+}
+
+// HandleInterrupt stops the command after the chunk being transferred. What
+// was transferred is kept where running the command again with --resume
+// continues from it; Run then returns an error of the interrupted class.
+func (mf *MongoFiles) HandleInterrupt() {
+	if mf.termChan != nil {
+		close(mf.termChan)
+	}
+}
+
+// interrupted returns true once HandleInterrupt has been called.
+func (mf *MongoFiles) interrupted() bool {
+	select {
+	case <-mf.termChan:
+		return true
+	default:
+		return false
+	}
+}
+
 // Run the mongofiles utility. If displayHost is true, the connected host/port is
 // displayed.
-func (mf *MongoFiles) Run(displayHost bool) (string, error) {
+func (mf *MongoFiles) Run(displayHost bool) (_ string, err error) {
+	mf.termChan = make(chan struct{})
+	defer func() {
+		if err != nil && mf.interrupted() {
+			switch mf.Command {
+			case Put, PutID, PutDir, Get, GetID, GetDir, Migrate:
+				log.Logvf(log.Always, "interrupted; run the command again with --resume to continue it")
+			}
+			err = failure.New(failure.Interrupted, err)
+		}
+	}()
+
 	connUrl := mf.ToolOptions.Host
 	if connUrl == "" {
 		connUrl = util.DefaultHost
@@ -380,12 +1043,16 @@ func (mf *MongoFiles) Run(displayHost bool) (string, error) {
 	// it's ok to validate only <db>.<prefix>.chunks (the longer one)
 	err = util.ValidateFullNamespace(fmt.Sprintf("%s.%s.chunks", mf.StorageOptions.DB,
 		mf.StorageOptions.GridFSPrefix))
+	if err == nil && mf.StorageOptions.ToPrefix != "" {
+		err = util.ValidateFullNamespace(fmt.Sprintf("%s.%s.chunks", mf.StorageOptions.DB,
+			mf.StorageOptions.ToPrefix))
+	}
 
 	if err != nil {
 		return "", err
 	}
 	// get GridFS handle
-	gfs := session.DB(mf.StorageOptions.DB).GridFS(mf.StorageOptions.GridFSPrefix)
+	gfs := mf.gridFS(session.DB(mf.StorageOptions.DB), mf.StorageOptions.GridFSPrefix)
 
 	var output string
 
@@ -396,7 +1063,11 @@ func (mf *MongoFiles) Run(displayHost bool) (string, error) {
 	case List:
 
 		query := bson.M{}
-		if mf.FileName != "" {
+		if mf.isPattern() {
+			if query, err = mf.patternQuery(); err != nil {
+				return "", err
+			}
+		} else if mf.FileName != "" {
 			regex := bson.M{"$regex": "^" + regexp.QuoteMeta(mf.FileName)}
 			query = bson.M{"filename": regex}
 		}
@@ -416,9 +1087,62 @@ func (mf *MongoFiles) Run(displayHost bool) (string, error) {
 			return "", err
 		}
 
+	case Meta:
+
+		output, err = mf.handleMeta(gfs)
+		if err != nil {
+			return "", err
+		}
+
+	case Copy:
+
+		err = mf.handleCopy(gfs)
+		if err != nil {
+			return "", err
+		}
+
+	case Move:
+
+		err = mf.handleMove(gfs)
+		if err != nil {
+			return "", err
+		}
+
+	case Expire:
+
+		err = mf.handleExpire(gfs)
+		if err != nil {
+			return "", err
+		}
+
+	case Migrate:
+
+		err = mf.handleMigrate(gfs)
+		if err != nil {
+			return "", err
+		}
+
+	case Verify:
+
+		err = mf.handleVerify(gfs)
+		if err != nil {
+			return "", err
+		}
+
+	case Sync:
+
+		err = mf.handleSync(gfs)
+		if err != nil {
+			return "", err
+		}
+
 	case Get:
 
-		err = mf.handleGet(gfs)
+		if mf.isPattern() {
+			err = mf.handleGetMatching(gfs)
+		} else {
+			err = mf.handleGet(gfs)
+		}
 		if err != nil {
 			return "", err
 		}
@@ -458,7 +1182,29 @@ func (mf *MongoFiles) Run(displayHost bool) (string, error) {
 			return "", err
 		}
 
+	case PutArchive:
+
+		err = mf.handlePutArchive(gfs)
+		if err != nil {
+			return "", err
+		}
+
+	case PutDir:
+
+		err = mf.handlePutDir(gfs)
+		if err != nil {
+			return "", err
+		}
+
+	case GetDir:
+
+		err = mf.handleGetDir(gfs)
+		if err != nil {
+			return "", err
+		}
+
 	}
 
+	mf.logSummary()
 	return output, nil
 }
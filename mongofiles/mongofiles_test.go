@@ -7,12 +7,17 @@
 package mongofiles
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/json"
@@ -23,6 +28,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/util"
 	. "github.com/smartystreets/goconvey/convey"
 	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
 var (
@@ -117,7 +123,7 @@ func simpleMongoFilesInstanceWithFilenameAndID(command, fname, Id string) (*Mong
 	mongofiles := MongoFiles{
 		ToolOptions:     toolOptions,
 		InputOptions:    &InputOptions{},
-		StorageOptions:  &StorageOptions{GridFSPrefix: "fs", DB: testDB},
+		StorageOptions:  &StorageOptions{GridFSPrefix: "fs", DB: testDB, NumParallelChunks: 1},
 		SessionProvider: sessionProvider,
 		Command:         command,
 		FileName:        fname,
@@ -283,6 +289,68 @@ func TestValidArguments(t *testing.T) {
 			}
 		})
 
+		Convey("put_dir and get_dir should take an optional second argument", func() {
+			So(mf.ValidateCommand([]string{"put_dir", "assets"}), ShouldBeNil)
+			So(mf.LocalDir, ShouldEqual, "assets")
+			So(mf.FileName, ShouldEqual, "")
+
+			So(mf.ValidateCommand([]string{"put-dir", "assets", "assets/"}), ShouldBeNil)
+			So(mf.Command, ShouldEqual, PutDir)
+			So(mf.FileName, ShouldEqual, "assets/")
+
+			So(mf.ValidateCommand([]string{"get_dir", "assets/"}), ShouldBeNil)
+			So(mf.LocalDir, ShouldEqual, ".")
+			So(mf.ValidateCommand([]string{"get_dir", "assets/", "out"}), ShouldBeNil)
+			So(mf.LocalDir, ShouldEqual, "out")
+
+			for _, command := range []string{"put_dir", "get_dir"} {
+				err := mf.ValidateCommand([]string{command, "arg1", "arg2", "arg3"})
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldEqual, "too many positional arguments")
+			}
+			err := mf.ValidateCommand([]string{"put_dir", ""})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "'put_dir' argument missing")
+		})
+
+		Convey("It should error out when --numParallelChunks is less than 1", func() {
+			mf.StorageOptions.NumParallelChunks = 0
+			err := mf.ValidateCommand([]string{"get", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--numParallelChunks must be at least 1")
+		})
+
+		Convey("It should error out when --resume is used with a command other than put or get", func() {
+			mf.StorageOptions.Resume = true
+			err := mf.ValidateCommand([]string{"list"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--resume can only be used with put, get or migrate commands")
+		})
+
+		Convey("It should error out when --resume is used with --numParallelChunks for get", func() {
+			mf.StorageOptions.Resume = true
+			mf.StorageOptions.NumParallelChunks = 4
+			err := mf.ValidateCommand([]string{"get", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--resume cannot be used with --numParallelChunks for get")
+			So(mf.ValidateCommand([]string{"put", "file"}), ShouldBeNil)
+		})
+
+		Convey("--out should set the local filename for get", func() {
+			mf.StorageOptions.Out = "-"
+			So(mf.ValidateCommand([]string{"get", "backup.tar"}), ShouldBeNil)
+			So(mf.getLocalFileName(nil), ShouldEqual, "-")
+
+			err := mf.ValidateCommand([]string{"put", "backup.tar"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--out can only be used with get or get_id")
+
+			mf.StorageOptions.LocalFileName = "backup.tar"
+			err = mf.ValidateCommand([]string{"get", "backup.tar"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--out and --local cannot both be given")
+		})
+
 		Convey("It should error out when a nonsensical command is given", func() {
 			args := []string{"commandnonexistent"}
 
@@ -294,6 +362,516 @@ func TestValidArguments(t *testing.T) {
 	})
 }
 
+func TestLocalPathInDir(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("get_dir should write files under the directory named by the rest of their name", t, func() {
+		local, err := localPathInDir("out", "assets/", "assets/img/logo.png")
+		So(err, ShouldBeNil)
+		So(local, ShouldEqual, filepath.Join("out", "img", "logo.png"))
+
+		local, err = localPathInDir("out", "assets", "assets/logo.png")
+		So(err, ShouldBeNil)
+		So(local, ShouldEqual, filepath.Join("out", "logo.png"))
+
+		Convey("and refuse names that are not files under it", func() {
+			_, err := localPathInDir("out", "assets/", "assets/img/")
+			So(err, ShouldNotBeNil)
+			_, err = localPathInDir("out", "assets/", "assets/../../etc/passwd")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestMetadataOptions(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstanceCommandOnly("")
+		So(err, ShouldBeNil)
+
+		Convey("--metadata should be parsed as extended JSON", func() {
+			mf.StorageOptions.Metadata = `{"owner": "ops", "expires": {"$date": "2024-01-01T00:00:00Z"}}`
+			So(mf.ValidateCommand([]string{"put", "file"}), ShouldBeNil)
+			metadata, err := mf.metadata()
+			So(err, ShouldBeNil)
+			So(metadata["owner"], ShouldEqual, "ops")
+			So(metadata["expires"], ShouldHaveSameTypeAs, time.Time{})
+
+			mf.StorageOptions.Metadata = `{"owner": `
+			_, err = mf.metadata()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("--metadata should only be allowed with put commands", func() {
+			mf.StorageOptions.Metadata = `{"owner": "ops"}`
+			err := mf.ValidateCommand([]string{"get", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--metadata can only be used with put commands")
+		})
+
+		Convey("--filter should only be allowed with list or search", func() {
+			mf.InputOptions.Filter = `{"metadata.owner": "ops"}`
+			So(mf.ValidateCommand([]string{"list"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{"search", "file"}), ShouldBeNil)
+			err := mf.ValidateCommand([]string{"delete", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--filter can only be used with list or search")
+		})
+
+		Convey("meta should require a filename", func() {
+			So(mf.ValidateCommand([]string{"meta", "file"}), ShouldBeNil)
+			So(mf.FileName, ShouldEqual, "file")
+			err := mf.ValidateCommand([]string{"meta"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "'meta' argument missing")
+		})
+	})
+}
+
+func TestSyncArguments(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("GridFS URLs should be split into bucket and prefix", t, func() {
+		bucket, prefix, ok := parseGridFSURL("gridfs://media/site")
+		So(ok, ShouldBeTrue)
+		So(bucket, ShouldEqual, "media")
+		So(prefix, ShouldEqual, "site/")
+
+		bucket, prefix, ok = parseGridFSURL("gridfs://fs")
+		So(ok, ShouldBeTrue)
+		So(bucket, ShouldEqual, "fs")
+		So(prefix, ShouldEqual, "")
+
+		_, _, ok = parseGridFSURL("./site")
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstanceCommandOnly("")
+		So(err, ShouldBeNil)
+
+		Convey("sync should upload to a GridFS destination", func() {
+			So(mf.ValidateCommand([]string{"sync", "./site", "gridfs://media/site/"}), ShouldBeNil)
+			So(mf.Upload, ShouldBeTrue)
+			So(mf.LocalDir, ShouldEqual, "./site")
+			So(mf.FileName, ShouldEqual, "site/")
+			So(mf.StorageOptions.GridFSPrefix, ShouldEqual, "media")
+		})
+
+		Convey("sync should download from a GridFS source", func() {
+			So(mf.ValidateCommand([]string{"sync", "gridfs://fs/site", "./out"}), ShouldBeNil)
+			So(mf.Upload, ShouldBeFalse)
+			So(mf.LocalDir, ShouldEqual, "./out")
+			So(mf.FileName, ShouldEqual, "site/")
+		})
+
+		Convey("sync should need exactly one GridFS side", func() {
+			err := mf.ValidateCommand([]string{"sync", "./a", "./b"})
+			So(err, ShouldNotBeNil)
+			err = mf.ValidateCommand([]string{"sync", "gridfs://fs/a", "gridfs://fs/b"})
+			So(err, ShouldNotBeNil)
+			err = mf.ValidateCommand([]string{"sync", "./a"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("cp and mv should take a source and a target name", func() {
+			So(mf.ValidateCommand([]string{"cp", "a.txt", "b.txt"}), ShouldBeNil)
+			So(mf.FileName, ShouldEqual, "a.txt")
+			So(mf.TargetName, ShouldEqual, "b.txt")
+			err := mf.ValidateCommand([]string{"mv", "a.txt"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "'mv' argument(s) missing")
+			err = mf.ValidateCommand([]string{"mv", "a.txt", "a.txt"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "cannot move 'a.txt' onto itself")
+			err = mf.ValidateCommand([]string{"cp", "a.txt", "a.txt"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "cannot copy 'a.txt' onto itself")
+
+			mf.StorageOptions.ToPrefix = "prod"
+			So(mf.ValidateCommand([]string{"mv", "a.txt", "a.txt"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{"cp", "a.txt", "a.txt"}), ShouldBeNil)
+			err = mf.ValidateCommand([]string{"get", "a.txt"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--toPrefix can only be used with cp, mv or migrate")
+		})
+
+		Convey("--delete should only be allowed with sync", func() {
+			mf.StorageOptions.Delete = true
+			err := mf.ValidateCommand([]string{"delete", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--delete can only be used with sync")
+		})
+
+		Convey("migrate should need --toUri, which only it takes", func() {
+			err := mf.ValidateCommand([]string{"migrate"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "migrate needs --toUri")
+
+			mf.StorageOptions.ToURI = "mongodb://backup:27017/files"
+			So(mf.ValidateCommand([]string{"migrate", "reports/*"}), ShouldBeNil)
+			So(mf.Command, ShouldEqual, Migrate)
+			So(mf.FileName, ShouldEqual, "reports/*")
+			err = mf.ValidateCommand([]string{"get", "a.txt"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--fromUri and --toUri can only be used with migrate")
+		})
+	})
+}
+
+func TestEncryption(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	key := bytes.Repeat([]byte{7}, 32)
+	encrypt := func(plain []byte) []byte {
+		reader, err := newEncryptingReader(key, bytes.NewReader(plain))
+		So(err, ShouldBeNil)
+		encrypted, err := ioutil.ReadAll(reader)
+		So(err, ShouldBeNil)
+		return encrypted
+	}
+	decrypt := func(key, encrypted []byte) ([]byte, error) {
+		out := &bytes.Buffer{}
+		writer, err := newDecryptingWriter(key, out)
+		So(err, ShouldBeNil)
+		// write in odd sizes to split segments across writes
+		for len(encrypted) > 0 {
+			n := 1000
+			if n > len(encrypted) {
+				n = len(encrypted)
+			}
+			if _, err = writer.Write(encrypted[:n]); err != nil {
+				return nil, err
+			}
+			encrypted = encrypted[n:]
+		}
+		err = writer.Close()
+		return out.Bytes(), err
+	}
+
+	Convey("Content should survive encryption and decryption", t, func() {
+		for _, size := range []int{0, 1, encryptSegmentSize, 2*encryptSegmentSize + 5} {
+			plain := bytes.Repeat([]byte("lorem ipsum "), size/12+1)[:size]
+			encrypted := encrypt(plain)
+			So(bytes.Contains(encrypted, []byte("lorem ipsum lorem")), ShouldBeFalse)
+			decrypted, err := decrypt(key, encrypted)
+			So(err, ShouldBeNil)
+			So(bytes.Equal(decrypted, plain), ShouldBeTrue)
+		}
+	})
+
+	Convey("Decryption should fail", t, func() {
+		encrypted := encrypt(bytes.Repeat([]byte("x"), 2*encryptSegmentSize))
+
+		Convey("with the wrong key", func() {
+			_, err := decrypt(bytes.Repeat([]byte{8}, 32), encrypted)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("when the content is changed", func() {
+			encrypted[encryptHeaderSize+10] ^= 1
+			_, err := decrypt(key, encrypted)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("when the content is truncated at a segment boundary", func() {
+			_, err := decrypt(key, encrypted[:encryptHeaderSize+encryptSegmentSize+encryptOverhead])
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("when the content was not encrypted", func() {
+			_, err := decrypt(key, []byte("plain text that is long enough"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Keys should be read in hex or base64", t, func() {
+		fromHex, err := parseEncryptionKey([]byte(strings.Repeat("07", 32) + "\n"))
+		So(err, ShouldBeNil)
+		So(fromHex, ShouldResemble, key)
+		fromBase64, err := parseEncryptionKey([]byte("BwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwc=\n"))
+		So(err, ShouldBeNil)
+		So(fromBase64, ShouldResemble, key)
+		_, err = parseEncryptionKey([]byte("secret"))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstanceCommandOnly("")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.EncryptKeyFile = "key"
+
+		Convey("--encryptKeyFile should only be allowed with put and get", func() {
+			So(mf.ValidateCommand([]string{"put", "file"}), ShouldBeNil)
+			So(mf.ValidateCommand([]string{"get_dir", "dir/"}), ShouldBeNil)
+			err := mf.ValidateCommand([]string{"sync", "./site", "gridfs://fs/site"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--encryptKeyFile can only be used with put or get commands")
+		})
+
+		Convey("--encryptKeyFile should not be allowed with --resume", func() {
+			mf.StorageOptions.Resume = true
+			err := mf.ValidateCommand([]string{"put", "file"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--resume cannot be used with --encryptKeyFile")
+		})
+	})
+}
+
+func TestTransferProgress(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a quiet mongofiles instance", t, func() {
+		mf := &MongoFiles{
+			ToolOptions: &options.ToolOptions{Verbosity: &options.Verbosity{Quiet: true}},
+		}
+
+		Convey("transfers should count the bytes read and written", func() {
+			transfer := mf.startTransfer("a", 10)
+			So(transfer.bar, ShouldBeNil)
+			read, err := ioutil.ReadAll(transfer.Reader(strings.NewReader("0123456789")))
+			So(err, ShouldBeNil)
+			So(string(read), ShouldEqual, "0123456789")
+			done, max := transfer.counter.Progress()
+			So(done, ShouldEqual, 10)
+			So(max, ShouldEqual, 10)
+
+			out := &bytes.Buffer{}
+			_, err = transfer.Writer(out).Write([]byte("abc"))
+			So(err, ShouldBeNil)
+			So(out.String(), ShouldEqual, "abc")
+			done, _ = transfer.counter.Progress()
+			So(done, ShouldEqual, 13)
+		})
+
+		Convey("finished transfers should add up in the stats", func() {
+			for _, size := range []int{3, 5} {
+				transfer := mf.startTransfer("a", 0)
+				_, err := ioutil.ReadAll(transfer.Reader(bytes.NewReader(make([]byte, size))))
+				So(err, ShouldBeNil)
+				transfer.Done(nil)
+			}
+			So(mf.stats.Files, ShouldEqual, 2)
+			So(mf.stats.Bytes, ShouldEqual, 8)
+			So(mf.stats.started.IsZero(), ShouldBeFalse)
+		})
+
+		Convey("failed transfers should not add up in the stats", func() {
+			transfer := mf.startTransfer("a", 0)
+			_, err := ioutil.ReadAll(transfer.Reader(bytes.NewReader(make([]byte, 3))))
+			So(err, ShouldBeNil)
+			transfer.Done(util.ErrTerminated)
+			So(mf.stats.Files, ShouldEqual, 0)
+		})
+
+		Convey("an interrupt should stop the reads of transfers and new files", func() {
+			mf.termChan = make(chan struct{})
+			transfer := mf.startTransfer("a", 0)
+			reader := transfer.Reader(bytes.NewReader(make([]byte, 3)))
+			buf := make([]byte, 1)
+			_, err := reader.Read(buf)
+			So(err, ShouldBeNil)
+			So(mf.interrupted(), ShouldBeFalse)
+
+			mf.HandleInterrupt()
+			So(mf.interrupted(), ShouldBeTrue)
+			_, err = reader.Read(buf)
+			So(err, ShouldEqual, util.ErrTerminated)
+			So(mf.putReader(nil, nil, "stdin", "a", nil), ShouldEqual, util.ErrTerminated)
+		})
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Durations should accept days and weeks", t, func() {
+		for value, expected := range map[string]time.Duration{
+			"30d":  30 * 24 * time.Hour,
+			"2w":   14 * 24 * time.Hour,
+			"12h":  12 * time.Hour,
+			"1.5d": 36 * time.Hour,
+		} {
+			age, err := parseAge(value)
+			So(err, ShouldBeNil)
+			So(age, ShouldEqual, expected)
+		}
+		_, err := parseAge("soon")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Durations that aren't positive should be rejected", t, func() {
+		for _, value := range []string{"-1d", "-5h", "-2w", "0d", "0s"} {
+			_, err := parseAge(value)
+			So(err, ShouldNotBeNil)
+		}
+	})
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstanceCommandOnly("")
+		So(err, ShouldBeNil)
+		now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+		Convey("expire should find files past their expiry time", func() {
+			So(mf.ValidateCommand([]string{"expire"}), ShouldBeNil)
+			query, err := mf.expiryQuery(now)
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, bson.M{"$or": []interface{}{
+				bson.M{"metadata.expiresAt": bson.M{"$lte": now}},
+			}})
+		})
+
+		Convey("expire with --olderThan and a pattern should also find old files", func() {
+			mf.StorageOptions.OlderThan = "30d"
+			So(mf.ValidateCommand([]string{"expire", "logs/*"}), ShouldBeNil)
+			query, err := mf.expiryQuery(now)
+			So(err, ShouldBeNil)
+			So(query, ShouldResemble, bson.M{"$and": []interface{}{
+				bson.M{"filename": bson.M{"$regex": "^logs/[^/]*$"}},
+				bson.M{"$or": []interface{}{
+					bson.M{"metadata.expiresAt": bson.M{"$lte": now}},
+					bson.M{"uploadDate": bson.M{"$lt": now.Add(-30 * 24 * time.Hour)}},
+				}},
+			}})
+
+			err = mf.ValidateCommand([]string{"list"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--olderThan can only be used with expire")
+		})
+
+		Convey("--expireAfter should stamp the metadata of files put", func() {
+			mf.StorageOptions.ExpireAfter = "1d"
+			mf.StorageOptions.Metadata = `{"owner": "ops"}`
+			So(mf.ValidateCommand([]string{"put", "file"}), ShouldBeNil)
+			metadata, err := mf.metadata()
+			So(err, ShouldBeNil)
+			So(metadata["owner"], ShouldEqual, "ops")
+			So(metadata[ExpiresAtField], ShouldHappenWithin, time.Minute, time.Now().Add(24*time.Hour))
+
+			err = mf.ValidateCommand([]string{"get", "file"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("negative durations should neither match every file nor stamp files as expired", func() {
+			mf.StorageOptions.OlderThan = "-1d"
+			So(mf.ValidateCommand([]string{"expire"}), ShouldBeNil)
+			_, err := mf.expiryQuery(now)
+			So(err, ShouldNotBeNil)
+
+			mf.StorageOptions.OlderThan = ""
+			mf.StorageOptions.ExpireAfter = "-1d"
+			So(mf.ValidateCommand([]string{"put", "file"}), ShouldBeNil)
+			_, err = mf.metadata()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestArchiveArguments(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Archive members should be named by their cleaned paths", t, func() {
+		for member, expected := range map[string]string{
+			"site/index.html":   "backup/site/index.html",
+			"./site/index.html": "backup/site/index.html",
+			"../../etc/passwd":  "backup/etc/passwd",
+			`windows\style.css`: "backup/windows/style.css",
+		} {
+			name, err := archiveMemberName("backup/", member)
+			So(err, ShouldBeNil)
+			So(name, ShouldEqual, expected)
+		}
+		_, err := archiveMemberName("backup/", "./")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstanceCommandOnly("")
+		So(err, ShouldBeNil)
+
+		Convey("put_archive should take an archive and an optional prefix", func() {
+			mf.StorageOptions.Extract = true
+			So(mf.ValidateCommand([]string{"put-archive", "backup.tar.gz", "backup/"}), ShouldBeNil)
+			So(mf.Command, ShouldEqual, "put_archive")
+			So(mf.Archive, ShouldEqual, "backup.tar.gz")
+			So(mf.FileName, ShouldEqual, "backup/")
+
+			err := mf.ValidateCommand([]string{"put", "backup.tar.gz"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--extract can only be used with put_archive")
+		})
+	})
+}
+
+func TestFilenamePatterns(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Globs should be translated to anchored regular expressions", t, func() {
+		for glob, expected := range map[string]string{
+			"reports/2024-*.pdf": `^reports/2024-[^/]*\.pdf$`,
+			"file?.txt":          `^file[^/]\.txt$`,
+			"[!a-c]*":            `^[^a-c][^/]*$`,
+		} {
+			expr, err := globToRegex(glob)
+			So(err, ShouldBeNil)
+			So(expr, ShouldEqual, expected)
+		}
+		_, err := globToRegex("file[")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("With a MongoFiles instance", t, func() {
+		mf, err := simpleMongoFilesInstanceCommandOnly("")
+		So(err, ShouldBeNil)
+
+		Convey("a filename with glob characters should be a pattern", func() {
+			So(mf.ValidateCommand([]string{"get", "reports/*.pdf"}), ShouldBeNil)
+			So(mf.isPattern(), ShouldBeTrue)
+			query, err := mf.patternQuery()
+			So(err, ShouldBeNil)
+			So(query["filename"], ShouldResemble, bson.M{"$regex": `^reports/[^/]*\.pdf$`})
+
+			So(mf.ValidateCommand([]string{"get", "reports/a.pdf"}), ShouldBeNil)
+			So(mf.isPattern(), ShouldBeFalse)
+		})
+
+		Convey("--regex should use the filename as is", func() {
+			mf.InputOptions.Regex = true
+			So(mf.ValidateCommand([]string{"delete", "^tmp/"}), ShouldBeNil)
+			query, err := mf.patternQuery()
+			So(err, ShouldBeNil)
+			So(query["filename"], ShouldResemble, bson.M{"$regex": "^tmp/"})
+
+			err = mf.ValidateCommand([]string{"put", "^tmp/"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--regex can only be used with list, get, delete, verify, expire or migrate")
+		})
+
+		Convey("verify should take an optional name or pattern", func() {
+			So(mf.ValidateCommand([]string{"verify"}), ShouldBeNil)
+			So(mf.FileName, ShouldEqual, "")
+			So(mf.ValidateCommand([]string{"verify", "reports/*"}), ShouldBeNil)
+			So(mf.isPattern(), ShouldBeTrue)
+			err := mf.ValidateCommand([]string{"verify", "a", "b"})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("--dryRun should only be allowed with delete", func() {
+			mf.StorageOptions.DryRun = true
+			So(mf.ValidateCommand([]string{"delete", "tmp/*"}), ShouldBeNil)
+			err := mf.ValidateCommand([]string{"get", "tmp/*"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "--dryRun can only be used with delete, sync or expire")
+		})
+
+		Convey("--local should not be allowed when get is given a pattern", func() {
+			mf.StorageOptions.LocalFileName = "out"
+			So(mf.ValidateCommand([]string{"get", "tmp/*"}), ShouldNotBeNil)
+		})
+	})
+}
+
 // Test that the output from mongofiles is actually correct
 func TestMongoFilesCommands(t *testing.T) {
 	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
@@ -636,3 +1214,615 @@ func runPutIdTestCase(idToTest string, t *testing.T) {
 	So(err, ShouldBeNil)
 	So(isContentSame, ShouldBeTrue)
 }
+
+// Test that a directory tree survives a round trip through put_dir and get_dir
+func TestDirectoryCommands(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With a directory tree put into GridFS with put_dir", t, func() {
+		src, err := ioutil.TempDir("", "mongofiles_put_dir")
+		So(err, ShouldBeNil)
+		dst, err := ioutil.TempDir("", "mongofiles_get_dir")
+		So(err, ShouldBeNil)
+		So(os.MkdirAll(filepath.Join(src, "img"), 0755), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(src, "index.html"), []byte("<html/>"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(src, "img", "logo.png"), []byte("png"), 0644), ShouldBeNil)
+
+		mf, err := simpleMongoFilesInstanceCommandOnly("")
+		So(err, ShouldBeNil)
+		So(mf.ValidateCommand([]string{"put_dir", src, "assets/"}), ShouldBeNil)
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		Convey("the files should be named by their relative paths", func() {
+			files, _, err := getFilesAndBytesListFromGridFS()
+			So(err, ShouldBeNil)
+			So(files, ShouldContain, "assets/index.html")
+			So(files, ShouldContain, "assets/img/logo.png")
+		})
+
+		Convey("get_dir should recreate the tree", func() {
+			mf, err := simpleMongoFilesInstanceCommandOnly("")
+			So(err, ShouldBeNil)
+			So(mf.ValidateCommand([]string{"get_dir", "assets/", dst}), ShouldBeNil)
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			logo, err := ioutil.ReadFile(filepath.Join(dst, "img", "logo.png"))
+			So(err, ShouldBeNil)
+			So(string(logo), ShouldEqual, "png")
+			index, err := ioutil.ReadFile(filepath.Join(dst, "index.html"))
+			So(err, ShouldBeNil)
+			So(string(index), ShouldEqual, "<html/>")
+		})
+
+		Reset(func() {
+			os.RemoveAll(src)
+			os.RemoveAll(dst)
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
+
+func TestSync(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With a directory synced into GridFS", t, func() {
+		src, err := ioutil.TempDir("", "mongofiles_sync_src")
+		So(err, ShouldBeNil)
+		dst, err := ioutil.TempDir("", "mongofiles_sync_dst")
+		So(err, ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(src, "index.html"), []byte("<html/>"), 0644), ShouldBeNil)
+		So(ioutil.WriteFile(filepath.Join(src, "style.css"), []byte("body {}"), 0644), ShouldBeNil)
+
+		sync := func(from, to string, delete bool) {
+			mf, err := simpleMongoFilesInstanceCommandOnly("")
+			So(err, ShouldBeNil)
+			mf.StorageOptions.Delete = delete
+			So(mf.ValidateCommand([]string{"sync", from, to}), ShouldBeNil)
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+		}
+		sync(src, "gridfs://fs/site", false)
+
+		Convey("syncing again should only put the files that changed", func() {
+			So(ioutil.WriteFile(filepath.Join(src, "index.html"), []byte("<html>new</html>"), 0644), ShouldBeNil)
+			So(os.Remove(filepath.Join(src, "style.css")), ShouldBeNil)
+			sync(src, "gridfs://fs/site", true)
+
+			files, _, err := getFilesAndBytesListFromGridFS()
+			So(err, ShouldBeNil)
+			So(files, ShouldResemble, []interface{}{"site/index.html"})
+		})
+
+		Convey("syncing out of GridFS should recreate the directory", func() {
+			So(ioutil.WriteFile(filepath.Join(dst, "stale.txt"), []byte("stale"), 0644), ShouldBeNil)
+			sync("gridfs://fs/site", dst, true)
+
+			index, err := ioutil.ReadFile(filepath.Join(dst, "index.html"))
+			So(err, ShouldBeNil)
+			So(string(index), ShouldEqual, "<html/>")
+			_, err = os.Stat(filepath.Join(dst, "stale.txt"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			os.RemoveAll(src)
+			os.RemoveAll(dst)
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
+
+func TestVerify(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With a file in GridFS", t, func() {
+		mf, err := simpleMongoFilesInstanceWithFilename("put", "lorem_verify.txt")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = util.ToUniversalPath("testdata/lorem_ipsum_287613_bytes.txt")
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		session, err := mf.SessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+		gfs := session.DB(testDB).GridFS("fs")
+		var doc gridFileDoc
+		So(gfs.Files.Find(bson.M{"filename": "lorem_verify.txt"}).One(&doc), ShouldBeNil)
+
+		verify := func(name string) error {
+			mf, err := simpleMongoFilesInstanceCommandOnly("")
+			So(err, ShouldBeNil)
+			if name == "" {
+				So(mf.ValidateCommand([]string{"verify"}), ShouldBeNil)
+			} else {
+				So(mf.ValidateCommand([]string{"verify", name}), ShouldBeNil)
+			}
+			_, err = mf.Run(false)
+			return err
+		}
+
+		Convey("verify should pass", func() {
+			So(verify(""), ShouldBeNil)
+			So(verify("lorem_*"), ShouldBeNil)
+		})
+
+		Convey("verify should find a missing chunk", func() {
+			So(gfs.Chunks.Remove(bson.M{"files_id": doc.Id, "n": 1}), ShouldBeNil)
+			problems, err := verifyFile(gfs, doc)
+			So(err, ShouldBeNil)
+			So(problems, ShouldResemble, []string{"chunks 1 to 1 are missing"})
+			So(verify("lorem_verify.txt"), ShouldNotBeNil)
+		})
+
+		Convey("verify should find changed data", func() {
+			So(gfs.Chunks.Update(bson.M{"files_id": doc.Id, "n": 0},
+				bson.M{"$set": bson.M{"data": make([]byte, doc.ChunkSize)}}), ShouldBeNil)
+			problems, err := verifyFile(gfs, doc)
+			So(err, ShouldBeNil)
+			So(problems, ShouldResemble, []string{"data does not match MD5 " + doc.MD5})
+		})
+
+		Convey("verify should find orphaned chunks", func() {
+			So(gfs.Files.RemoveId(doc.Id), ShouldBeNil)
+			orphans, err := mf.orphanedChunks(gfs)
+			So(err, ShouldBeNil)
+			So(len(orphans), ShouldEqual, 1)
+			So(orphans[0].Count, ShouldEqual, 2)
+			So(verify(""), ShouldNotBeNil)
+		})
+
+		Reset(func() {
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
+
+func TestCopyAndMove(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With a file in GridFS", t, func() {
+		original := util.ToUniversalPath("testdata/lorem_ipsum_287613_bytes.txt")
+		expected, err := ioutil.ReadFile(original)
+		So(err, ShouldBeNil)
+		mf, err := simpleMongoFilesInstanceWithFilename("put", "staged.txt")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = original
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		session, err := mf.SessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+
+		runReplacing := func(replace bool, toPrefix string, args ...string) error {
+			mf, err := simpleMongoFilesInstanceCommandOnly("")
+			So(err, ShouldBeNil)
+			mf.StorageOptions.ToPrefix = toPrefix
+			mf.StorageOptions.Replace = replace
+			So(mf.ValidateCommand(args), ShouldBeNil)
+			_, err = mf.Run(false)
+			return err
+		}
+		run := func(toPrefix string, args ...string) {
+			So(runReplacing(false, toPrefix, args...), ShouldBeNil)
+		}
+		count := func(prefix, name string) int {
+			n, err := session.DB(testDB).GridFS(prefix).Find(bson.M{"filename": name}).Count()
+			So(err, ShouldBeNil)
+			return n
+		}
+		read := func(prefix, name string) []byte {
+			gridFile, err := session.DB(testDB).GridFS(prefix).Open(name)
+			So(err, ShouldBeNil)
+			defer gridFile.Close()
+			data, err := ioutil.ReadAll(gridFile)
+			So(err, ShouldBeNil)
+			return data
+		}
+
+		Convey("cp should copy it within the bucket", func() {
+			run("", "cp", "staged.txt", "copy.txt")
+			So(bytes.Equal(read("fs", "copy.txt"), expected), ShouldBeTrue)
+			So(bytes.Equal(read("fs", "staged.txt"), expected), ShouldBeTrue)
+		})
+
+		Convey("cp should copy it to another bucket", func() {
+			run("prod", "cp", "staged.txt", "live.txt")
+			So(bytes.Equal(read("prod", "live.txt"), expected), ShouldBeTrue)
+		})
+
+		Convey("mv should rename it", func() {
+			run("", "mv", "staged.txt", "renamed.txt")
+			So(bytes.Equal(read("fs", "renamed.txt"), expected), ShouldBeTrue)
+			_, err := session.DB(testDB).GridFS("fs").Open("staged.txt")
+			So(err, ShouldEqual, mgo.ErrNotFound)
+		})
+
+		Convey("mv should move it to another bucket", func() {
+			run("prod", "mv", "staged.txt", "staged.txt")
+			So(bytes.Equal(read("prod", "staged.txt"), expected), ShouldBeTrue)
+			count, err := session.DB(testDB).C("fs.chunks").Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+		})
+
+		Convey("cp and mv with --replace should replace the target only once copied", func() {
+			run("", "cp", "staged.txt", "copy.txt")
+			So(runReplacing(true, "", "cp", "staged.txt", "copy.txt"), ShouldBeNil)
+			So(count("fs", "copy.txt"), ShouldEqual, 1)
+			So(bytes.Equal(read("fs", "copy.txt"), expected), ShouldBeTrue)
+
+			So(runReplacing(true, "", "mv", "staged.txt", "copy.txt"), ShouldBeNil)
+			So(count("fs", "copy.txt"), ShouldEqual, 1)
+			So(count("fs", "staged.txt"), ShouldEqual, 0)
+			So(bytes.Equal(read("fs", "copy.txt"), expected), ShouldBeTrue)
+
+			run("prod", "cp", "copy.txt", "live.txt")
+			So(runReplacing(true, "prod", "mv", "copy.txt", "live.txt"), ShouldBeNil)
+			So(count("prod", "live.txt"), ShouldEqual, 1)
+			So(bytes.Equal(read("prod", "live.txt"), expected), ShouldBeTrue)
+		})
+
+		Convey("cp and mv with --replace should keep the target if the source is missing", func() {
+			So(runReplacing(true, "", "mv", "missing.txt", "staged.txt"), ShouldNotBeNil)
+			So(runReplacing(true, "prod", "cp", "missing.txt", "staged.txt"), ShouldNotBeNil)
+			So(bytes.Equal(read("fs", "staged.txt"), expected), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With files in GridFS", t, func() {
+		_, err := setUpGridFSTestData()
+		So(err, ShouldBeNil)
+		original := util.ToUniversalPath("testdata/lorem_ipsum_287613_bytes.txt")
+		expected, err := ioutil.ReadFile(original)
+		So(err, ShouldBeNil)
+		mf, err := simpleMongoFilesInstanceWithFilename("put", "lorem.txt")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = original
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		session, err := mf.SessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+		target := session.DB(testDB).GridFS("migrated")
+
+		migrate := func(args ...string) {
+			mf, err := simpleMongoFilesInstanceCommandOnly("")
+			So(err, ShouldBeNil)
+			mf.StorageOptions.ToURI = fmt.Sprintf("mongodb://%v:%v/%v", testServer, testPort, testDB)
+			mf.StorageOptions.ToPrefix = "migrated"
+			mf.StorageOptions.Resume = true
+			So(mf.ValidateCommand(append([]string{"migrate"}, args...)), ShouldBeNil)
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+		}
+
+		Convey("migrate should copy every file with its _id", func() {
+			migrate()
+			count, err := target.Find(nil).Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 4)
+
+			var source, copied gridFileDoc
+			So(session.DB(testDB).GridFS("fs").Find(bson.M{"filename": "lorem.txt"}).One(&source), ShouldBeNil)
+			So(target.Find(bson.M{"filename": "lorem.txt"}).One(&copied), ShouldBeNil)
+			So(copied.Id, ShouldResemble, source.Id)
+			So(copied.UploadDate.Equal(source.UploadDate), ShouldBeTrue)
+			gridFile, err := target.Open("lorem.txt")
+			So(err, ShouldBeNil)
+			data, err := ioutil.ReadAll(gridFile)
+			So(err, ShouldBeNil)
+			So(gridFile.Close(), ShouldBeNil)
+			So(bytes.Equal(data, expected), ShouldBeTrue)
+
+			Convey("and skip them when run again", func() {
+				migrate()
+				count, err := target.Find(nil).Count()
+				So(err, ShouldBeNil)
+				So(count, ShouldEqual, 4)
+			})
+		})
+
+		Convey("migrate should only copy matching files", func() {
+			migrate("testfile*")
+			count, err := target.Find(nil).Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 3)
+		})
+
+		Convey("migrate should finish an interrupted migration", func() {
+			var source gridFileDoc
+			So(session.DB(testDB).GridFS("fs").Find(bson.M{"filename": "lorem.txt"}).One(&source), ShouldBeNil)
+			// leave the first chunk behind, as if an earlier run stopped
+			var chunk gridChunk
+			So(session.DB(testDB).GridFS("fs").Chunks.Find(bson.M{"files_id": source.Id, "n": 0}).One(&chunk), ShouldBeNil)
+			chunk.Id = bson.NewObjectId()
+			So(target.Chunks.Insert(chunk), ShouldBeNil)
+
+			migrate("lorem.txt")
+			problems, err := verifyFile(target, source)
+			So(err, ShouldBeNil)
+			So(problems, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
+
+func TestPutArchive(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With a tar.gz and a zip archive", t, func() {
+		dir, err := ioutil.TempDir("", "mongofiles_put_archive")
+		So(err, ShouldBeNil)
+		members := map[string]string{"site/index.html": "<html/>", "site/img/logo.png": "png"}
+
+		tarGz, err := os.Create(filepath.Join(dir, "site.tar.gz"))
+		So(err, ShouldBeNil)
+		gz := gzip.NewWriter(tarGz)
+		tw := tar.NewWriter(gz)
+		So(tw.WriteHeader(&tar.Header{Name: "site/", Typeflag: tar.TypeDir, Mode: 0755}), ShouldBeNil)
+		for name, contents := range members {
+			So(tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(contents))}), ShouldBeNil)
+			_, err = tw.Write([]byte(contents))
+			So(err, ShouldBeNil)
+		}
+		So(tw.Close(), ShouldBeNil)
+		So(gz.Close(), ShouldBeNil)
+		So(tarGz.Close(), ShouldBeNil)
+
+		zipFile, err := os.Create(filepath.Join(dir, "site.zip"))
+		So(err, ShouldBeNil)
+		zw := zip.NewWriter(zipFile)
+		for name, contents := range members {
+			w, err := zw.Create(name)
+			So(err, ShouldBeNil)
+			_, err = w.Write([]byte(contents))
+			So(err, ShouldBeNil)
+		}
+		So(zw.Close(), ShouldBeNil)
+		So(zipFile.Close(), ShouldBeNil)
+
+		putArchive := func(archive string) {
+			mf, err := simpleMongoFilesInstanceCommandOnly("")
+			So(err, ShouldBeNil)
+			mf.StorageOptions.Extract = true
+			So(mf.ValidateCommand([]string{"put_archive", filepath.Join(dir, archive), "backup/"}), ShouldBeNil)
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			files, _, err := getFilesAndBytesListFromGridFS()
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 2)
+			So(files, ShouldContain, "backup/site/index.html")
+			So(files, ShouldContain, "backup/site/img/logo.png")
+		}
+
+		Convey("put_archive --extract should store each file of a tar.gz", func() {
+			putArchive("site.tar.gz")
+		})
+
+		Convey("put_archive --extract should store each file of a zip", func() {
+			putArchive("site.zip")
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
+
+// Test that files put and got with several chunks in flight are unchanged
+func TestParallelChunks(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With a file put into GridFS with --numParallelChunks", t, func() {
+		original := util.ToUniversalPath("testdata/lorem_ipsum_287613_bytes.txt")
+		mf, err := simpleMongoFilesInstanceWithFilename("put", "lorem_parallel.txt")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = original
+		mf.StorageOptions.NumParallelChunks = 4
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		Convey("the driver should read it back unchanged", func() {
+			mf, err := simpleMongoFilesInstanceWithFilename("get", "lorem_parallel.txt")
+			So(err, ShouldBeNil)
+			mf.StorageOptions.LocalFileName = "lorem_parallel_copy.txt"
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			expected, err := ioutil.ReadFile(original)
+			So(err, ShouldBeNil)
+			actual, err := ioutil.ReadFile("lorem_parallel_copy.txt")
+			So(err, ShouldBeNil)
+			So(bytes.Equal(actual, expected), ShouldBeTrue)
+		})
+
+		Convey("and so should a parallel get", func() {
+			mf, err := simpleMongoFilesInstanceWithFilename("get", "lorem_parallel.txt")
+			So(err, ShouldBeNil)
+			mf.StorageOptions.LocalFileName = "lorem_parallel_copy.txt"
+			mf.StorageOptions.NumParallelChunks = 4
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			expected, err := ioutil.ReadFile(original)
+			So(err, ShouldBeNil)
+			actual, err := ioutil.ReadFile("lorem_parallel_copy.txt")
+			So(err, ShouldBeNil)
+			So(bytes.Equal(actual, expected), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			os.Remove("lorem_parallel_copy.txt")
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
+
+func TestResume(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	original := util.ToUniversalPath("testdata/lorem_ipsum_287613_bytes.txt")
+	expected, err := ioutil.ReadFile(original)
+	if err != nil {
+		t.Fatalf("error reading test data: %v", err)
+	}
+
+	Convey("With an interrupted put with --resume", t, func() {
+		mf, err := simpleMongoFilesInstanceWithFilename("put", "lorem_resume.txt")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = original
+		mf.StorageOptions.Resume = true
+
+		session, err := mf.SessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+		gfs := session.DB(testDB).GridFS("fs")
+		id := bson.NewObjectId()
+		So(mf.pendingUploads(gfs).Insert(pendingUpload{
+			Filename:  "lorem_resume.txt",
+			FilesId:   id,
+			ChunkSize: DefaultChunkSize,
+			Started:   bson.Now(),
+		}), ShouldBeNil)
+		So(gfs.Chunks.Insert(gridChunk{Id: bson.NewObjectId(), FilesId: id, N: 0, Data: expected[:DefaultChunkSize]}), ShouldBeNil)
+
+		Convey("resuming it should keep the stored chunk and complete the file", func() {
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			var doc gridFileDoc
+			So(gfs.Files.Find(bson.M{"filename": "lorem_resume.txt"}).One(&doc), ShouldBeNil)
+			So(doc.Id, ShouldEqual, id)
+			So(doc.Length, ShouldEqual, len(expected))
+			count, err := mf.pendingUploads(gfs).Count()
+			So(err, ShouldBeNil)
+			So(count, ShouldEqual, 0)
+
+			gridFile, err := gfs.OpenId(id)
+			So(err, ShouldBeNil)
+			actual, err := ioutil.ReadAll(gridFile)
+			So(err, ShouldBeNil)
+			So(gridFile.Close(), ShouldBeNil)
+			So(bytes.Equal(actual, expected), ShouldBeTrue)
+		})
+
+		Convey("a stored chunk that doesn't match the local file should be replaced", func() {
+			So(gfs.Chunks.Update(bson.M{"files_id": id, "n": 0},
+				bson.M{"$set": bson.M{"data": make([]byte, DefaultChunkSize)}}), ShouldBeNil)
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			gridFile, err := gfs.OpenId(id)
+			So(err, ShouldBeNil)
+			actual, err := ioutil.ReadAll(gridFile)
+			So(err, ShouldBeNil)
+			So(gridFile.Close(), ShouldBeNil)
+			So(bytes.Equal(actual, expected), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+
+	Convey("With a file in GridFS and part of it downloaded", t, func() {
+		mf, err := simpleMongoFilesInstanceWithFilename("put", "lorem_resume.txt")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = original
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		mf, err = simpleMongoFilesInstanceWithFilename("get", "lorem_resume.txt")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = "lorem_resume_copy.txt"
+		mf.StorageOptions.Resume = true
+
+		Convey("get with --resume should complete the local file", func() {
+			So(ioutil.WriteFile("lorem_resume_copy.txt", expected[:DefaultChunkSize+100], 0644), ShouldBeNil)
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			actual, err := ioutil.ReadFile("lorem_resume_copy.txt")
+			So(err, ShouldBeNil)
+			So(bytes.Equal(actual, expected), ShouldBeTrue)
+		})
+
+		Convey("get with --resume should start over if the local file doesn't match", func() {
+			So(ioutil.WriteFile("lorem_resume_copy.txt", make([]byte, DefaultChunkSize), 0644), ShouldBeNil)
+			_, err = mf.Run(false)
+			So(err, ShouldBeNil)
+
+			actual, err := ioutil.ReadFile("lorem_resume_copy.txt")
+			So(err, ShouldBeNil)
+			So(bytes.Equal(actual, expected), ShouldBeTrue)
+		})
+
+		Reset(func() {
+			os.Remove("lorem_resume_copy.txt")
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With files put into GridFS with and without --metadata", t, func() {
+		mf, err := simpleMongoFilesInstanceWithFilename("put", "owned.txt")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = util.ToUniversalPath("testdata/lorem_ipsum_287613_bytes.txt")
+		mf.StorageOptions.Metadata = `{"owner": "ops", "ttl": "30d"}`
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		mf, err = simpleMongoFilesInstanceWithFilename("put", "unowned.txt")
+		So(err, ShouldBeNil)
+		mf.StorageOptions.LocalFileName = util.ToUniversalPath("testdata/lorem_ipsum_287613_bytes.txt")
+		_, err = mf.Run(false)
+		So(err, ShouldBeNil)
+
+		Convey("meta should display the metadata", func() {
+			mf, err := simpleMongoFilesInstanceWithFilename("meta", "owned.txt")
+			So(err, ShouldBeNil)
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldEqual, "{\"owner\":\"ops\",\"ttl\":\"30d\"}\n")
+
+			mf, err = simpleMongoFilesInstanceWithFilename("meta", "unowned.txt")
+			So(err, ShouldBeNil)
+			output, err = mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldEqual, "{}\n")
+		})
+
+		Convey("list with --filter should only list matching files", func() {
+			mf, err := simpleMongoFilesInstanceWithFilename("list", "")
+			So(err, ShouldBeNil)
+			mf.InputOptions.Filter = `{"metadata.owner": "ops"}`
+			output, err := mf.Run(false)
+			So(err, ShouldBeNil)
+			So(output, ShouldEqual, "owned.txt\t287613\n")
+		})
+
+		Reset(func() {
+			So(tearDownGridFSTestData(), ShouldBeNil)
+		})
+	})
+}
@@ -19,6 +19,37 @@ Possible commands include:
 	get_id    - get a file with the given '_id'
 	delete    - delete all files with filename 'filename'
 	delete_id - delete a file with the given '_id'
+	cp        - copy the latest file with filename 'filename' to the name given as a second argument,
+	            in the same bucket or the one given with --toPrefix, without reading its data
+	mv        - rename every file with filename 'filename' to the name given as a second argument,
+	            or move them to the bucket given with --toPrefix
+	verify    - check the chunks of every file, or those matching 'filename', against their files
+	            documents and checksums, and report orphaned chunks if no filename is given
+	expire    - delete every file, or those matching 'filename', whose metadata.expiresAt has passed
+	            or, with --olderThan, that was uploaded longer ago than it
+	meta      - display the metadata of the latest file with filename 'filename'
+	put_dir   - add every file under the local directory 'filename', named by its path relative to it;
+	            an optional second argument is prepended to each name, e.g. put_dir ./assets assets/
+	get_dir   - get every file whose name begins with 'filename' into the current directory, or the one
+	            given as a second argument, recreating the directory tree from the rest of each name
+	put_archive - add a tar, tar.gz or zip archive; with --extract, add each file in it instead, named by
+	            its path in the archive; an optional second argument is prepended to each name
+	sync      - copy the files that are missing or differ from a local directory to gridfs://bucket/prefix,
+	            or the other way around, comparing lengths and checksums, e.g. sync ./site gridfs://fs/site/
+	migrate   - copy every file, or those matching 'filename', with its _id and metadata to the bucket of
+	            the deployment at --toUri, checking each copy against its checksum; the source is the deployment
+	            connected to, or the one at --fromUri
+
+The 'filename' given to list, get, delete, verify, expire and migrate may be a pattern such as 'reports/2024-*.pdf', in
+which '*' and '?' match any characters but '/', or a regular expression with --regex. They
+then act on every matching file.
+
+put reads from stdin and get writes to stdout when the local filename is '-', e.g.
+	mongofiles put backup.tar --local - < backup.tar
+	mongofiles get backup.tar -o - | tar x
+
+Commands that put or get files show the progress and transfer rate of each one on stderr, with a
+summary when there are several; --quiet hides them.
 
 See http://docs.mongodb.org/manual/reference/program/mongofiles/ for more information.`
 
@@ -28,13 +59,55 @@ type StorageOptions struct {
 	DB string `short:"d" value-name:"<database-name>" default:"test" default-mask:"-" long:"db" description:"database to use (default is 'test')"`
 
 	// 'LocalFileName' is an option that specifies what filename to use for (put|get)
-	LocalFileName string `long:"local" value-name:"<filename>" short:"l" description:"local filename for put|get"`
+	LocalFileName string `long:"local" value-name:"<filename>" short:"l" description:"local filename for put|get, '-' for stdin|stdout, or an s3://, gs:// or az:// URL of an object in cloud storage"`
+
+	// 'Out' is the same as 'LocalFileName', for get
+	Out string `long:"out" value-name:"<filename>" short:"o" description:"local filename for get, '-' for stdout, or a cloud storage URL; the same as --local"`
 
 	// 'ContentType' is an option that specifies the Content/MIME type to use for 'put'
 	ContentType string `long:"type" value-nane:"<content-type>" short:"t" description:"content/MIME type for put (optional)"`
 
+	// 'Metadata' is an extended JSON document to store as the metadata of each file put
+	Metadata string `long:"metadata" value-name:"<json>" description:"extended JSON document to store as the metadata of each file for put, put_id or put_dir"`
+
 	// if set, 'Replace' will remove other files with same name after 'put'
-	Replace bool `long:"replace" short:"r" description:"remove other files with same name after put"`
+	Replace bool `long:"replace" short:"r" description:"remove other files with same name after put, cp or mv"`
+
+	// 'ToPrefix' is the GridFS prefix of the bucket that 'cp' and 'mv' write to
+	ToPrefix string `long:"toPrefix" value-name:"<prefix>" description:"GridFS prefix of the bucket to copy or move files to with cp, mv or migrate (default is the bucket given by --prefix)"`
+
+	// 'FromURI' is the deployment that 'migrate' reads from, if not the one connected to
+	FromURI string `long:"fromUri" value-name:"<mongodb-uri>" description:"with migrate, connection string of the deployment to copy files from (default is the one connected to)"`
+
+	// 'ToURI' is the deployment that 'migrate' writes to
+	ToURI string `long:"toUri" value-name:"<mongodb-uri>" description:"with migrate, connection string of the deployment to copy files to; its database is used if it names one, and --db otherwise"`
+
+	// if set, 'DryRun' makes 'delete', 'sync' and 'expire' only print what they would do
+	DryRun bool `long:"dryRun" description:"with delete, sync or expire, print the files that would be transferred or removed without changing anything"`
+
+	// 'OlderThan' makes 'expire' also remove files uploaded longer ago than it
+	OlderThan string `long:"olderThan" value-name:"<duration>" description:"with expire, also delete files uploaded longer ago than this, e.g. 30d, 2w or 12h"`
+
+	// 'ExpireAfter' stamps files put with the time they expire
+	ExpireAfter string `long:"expireAfter" value-name:"<duration>" description:"with put, put_id or put_dir, set metadata.expiresAt to this long from now, e.g. 30d, so that expire removes the file then"`
+
+	// if set, 'Extract' makes 'put_archive' store each member of the archive as its own file
+	Extract bool `long:"extract" description:"with put_archive, store each file in the archive as its own GridFS file instead of storing the archive whole"`
+
+	// if set, 'Delete' makes 'sync' remove files that are not at the source
+	Delete bool `long:"delete" description:"with sync, delete files at the destination that are not at the source"`
+
+	// 'NumParallelChunks' is the number of chunks put and get transfer at once
+	NumParallelChunks int `long:"numParallelChunks" value-name:"<count>" default:"1" default-mask:"-" description:"number of chunks to transfer concurrently for put, get and migrate, each on its own connection (default is 1)"`
+
+	// 'EncryptKeyFile' holds the key that file content is encrypted with
+	EncryptKeyFile string `long:"encryptKeyFile" value-name:"<filename>" description:"file holding a 256-bit key, in hex or base64, to encrypt content with on put and decrypt it with on get, e.g. made with 'openssl rand -base64 32'"`
+
+	// if set, 'Resume' continues an interrupted put or get instead of restarting it
+	Resume bool `long:"resume" description:"continue an interrupted put or get from its last verified chunk, or keep the chunks an interrupted migrate copied"`
+
+	// 'Hash' is the checksum stored with each file put
+	Hash string `long:"hash" value-name:"<algorithm>" choice:"md5" choice:"sha256" description:"checksum to store with each file put: md5, or sha256 in a sha256 field, which FIPS mode requires (default is md5, or sha256 with --fips)"`
 
 	// GridFSPrefix specifies what GridFS prefix to use; defaults to 'fs'
 	GridFSPrefix string `long:"prefix" value-name:"<prefix>" default:"fs" default-mask:"-" description:"GridFS prefix to use (default is 'fs')"`
@@ -53,6 +126,12 @@ func (_ *StorageOptions) Name() string {
 // InputOptions defines the set of options to use in retrieving data from the server.
 type InputOptions struct {
 	ReadPreference string `long:"readPreference" value-name:"<string>|<json>" description:"specify either a preference name or a preference json object"`
+
+	// 'Filter' is an extended JSON query that files listed by list and search must also match
+	Filter string `long:"filter" value-name:"<json>" description:"extended JSON query on the files collection for list or search, e.g. '{\"metadata.owner\": \"ops\"}'"`
+
+	// if set, 'Regex' treats the filename given to list, get, delete, verify, expire and migrate as a regular expression
+	Regex bool `long:"regex" description:"treat the filename given to list, get, delete, verify, expire or migrate as a regular expression, e.g. '^tmp/'"`
 }
 
 // Name returns a human-readable group name for input options.
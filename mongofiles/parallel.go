@@ -0,0 +1,260 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultChunkSize is the size of the chunks mongofiles stores files in,
+// the same as the driver's.
+const DefaultChunkSize = 255 * 1024
+
+// gridFileDoc is a document of the <prefix>.files collection. Unlike
+// GFSFile, its _id may be of any type.
+type gridFileDoc struct {
+	Id          interface{} `bson:"_id"`
+	ChunkSize   int         `bson:"chunkSize"`
+	UploadDate  time.Time   `bson:"uploadDate"`
+	Length      int64       `bson:"length"`
+	MD5         string      `bson:"md5,omitempty"`
+	SHA256      string      `bson:"sha256,omitempty"`
+	Filename    string      `bson:"filename,omitempty"`
+	ContentType string      `bson:"contentType,omitempty"`
+	Metadata    bson.M      `bson:"metadata,omitempty"`
+}
+
+// gridChunk is a document of the <prefix>.chunks collection.
+type gridChunk struct {
+	Id      bson.ObjectId `bson:"_id"`
+	FilesId interface{}   `bson:"files_id"`
+	N       int           `bson:"n"`
+	Data    []byte        `bson:"data"`
+}
+
+// firstError keeps the first error reported by any of several workers.
+type firstError struct {
+	sync.Mutex
+	err error
+}
+
+func (f *firstError) set(err error) {
+	f.Lock()
+	defer f.Unlock()
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+func (f *firstError) get() error {
+	f.Lock()
+	defer f.Unlock()
+	return f.err
+}
+
+// putParallel stores everything read from local in GridFS under fileName,
+// inserting up to NumParallelChunks chunks at once, each on its own
+// connection. The files document is only inserted once every chunk is, so
+// readers never see a partial file. It returns the number of bytes stored.
+func (mf *MongoFiles) putParallel(gfs *mgo.GridFS, local io.Reader, fileName string, id interface{}) (int64, error) {
+	if id == nil {
+		id = bson.NewObjectId()
+	}
+	length, err := mf.putChunks(gfs, local, fileName, id, nil)
+	if err != nil {
+		gfs.Chunks.RemoveAll(bson.M{"files_id": id})
+		return 0, err
+	}
+	return length, nil
+}
+
+// putChunks stores everything read from local as the chunks of the file with
+// the given _id, then inserts its files document. existing maps the number
+// of each chunk already stored to the SHA-256 of its data; chunks matching the
+// local data are kept, and every chunk from the first that doesn't is
+// replaced. On error, the chunks inserted so far are left in place.
+func (mf *MongoFiles) putChunks(gfs *mgo.GridFS, local io.Reader, fileName string, id interface{}, existing map[int]string) (int64, error) {
+	metadata, err := mf.metadata()
+	if err != nil {
+		return 0, err
+	}
+	workers := mf.StorageOptions.NumParallelChunks
+	session := gfs.Chunks.Database.Session
+
+	jobs := make(chan gridChunk, workers)
+	failed := &firstError{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := session.Copy()
+			defer s.Close()
+			chunks := gfs.Chunks.With(s)
+			for chunk := range jobs {
+				if failed.get() != nil {
+					continue
+				}
+				if err := chunks.Insert(chunk); err != nil {
+					failed.set(fmt.Errorf("error inserting chunk %v: %v", chunk.N, err))
+				}
+			}
+		}()
+	}
+
+	sum := mf.newChecksum()
+	var length int64
+	n := 0
+	kept := 0
+	diverged := false
+	for ; failed.get() == nil; n++ {
+		if mf.interrupted() {
+			// stop before reading the next chunk
+			failed.set(util.ErrTerminated)
+			break
+		}
+		data := make([]byte, DefaultChunkSize)
+		read, err := io.ReadFull(local, data)
+		if read > 0 {
+			sum.Write(data[:read])
+			length += int64(read)
+			if !diverged && existing != nil {
+				if existing[n] == hashChunk(data[:read]) {
+					kept++
+				} else {
+					// chunks after the first bad one can't be trusted either
+					diverged = true
+					if _, err := gfs.Chunks.RemoveAll(bson.M{"files_id": id, "n": bson.M{"$gte": n}}); err != nil {
+						failed.set(fmt.Errorf("error removing chunks from %v on: %v", n, err))
+						break
+					}
+				}
+			}
+			if diverged || existing == nil {
+				jobs <- gridChunk{Id: bson.NewObjectId(), FilesId: id, N: n, Data: data[:read]}
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if read == 0 {
+				n--
+			}
+			break
+		}
+		if err != nil {
+			failed.set(err)
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	err = failed.get()
+	if err == nil && existing != nil {
+		log.Logvf(log.DebugLow, "kept %v chunks already stored", kept)
+		if !diverged {
+			// the local file may have shrunk since the interrupted transfer
+			_, err = gfs.Chunks.RemoveAll(bson.M{"files_id": id, "n": bson.M{"$gt": n}})
+		}
+	}
+	if err == nil {
+		doc := gridFileDoc{
+			Id:          id,
+			ChunkSize:   DefaultChunkSize,
+			UploadDate:  bson.Now(),
+			Length:      length,
+			Filename:    fileName,
+			ContentType: mf.StorageOptions.ContentType,
+			Metadata:    metadata,
+		}
+		sum.store(&doc)
+		err = gfs.Files.Insert(doc)
+	}
+	if err != nil {
+		return 0, err
+	}
+	err = gfs.Chunks.EnsureIndex(mgo.Index{Key: []string{"files_id", "n"}, Unique: true})
+	return length, err
+}
+
+// getParallel writes the GridFS file with the given _id to a local file,
+// fetching up to NumParallelChunks chunks at once, each on its own
+// connection, and writing each at its own offset.
+func (mf *MongoFiles) getParallel(gfs *mgo.GridFS, id interface{}, localFile *os.File, t *transfer) error {
+	var doc gridFileDoc
+	if err := gfs.Files.FindId(id).One(&doc); err != nil {
+		return fmt.Errorf("error reading GridFS file document: %v", err)
+	}
+	if doc.ChunkSize <= 0 {
+		return fmt.Errorf("GridFS file has an invalid chunk size of %v", doc.ChunkSize)
+	}
+	if err := localFile.Truncate(doc.Length); err != nil {
+		return err
+	}
+	numChunks := int((doc.Length + int64(doc.ChunkSize) - 1) / int64(doc.ChunkSize))
+	log.Logvf(log.DebugLow, "fetching %v chunks with %v workers", numChunks, mf.StorageOptions.NumParallelChunks)
+
+	session := gfs.Chunks.Database.Session
+	jobs := make(chan int, mf.StorageOptions.NumParallelChunks)
+	failed := &firstError{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < mf.StorageOptions.NumParallelChunks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := session.Copy()
+			defer s.Close()
+			chunks := gfs.Chunks.With(s)
+			for n := range jobs {
+				if failed.get() != nil {
+					continue
+				}
+				var chunk gridChunk
+				if err := chunks.Find(bson.M{"files_id": id, "n": n}).One(&chunk); err != nil {
+					failed.set(fmt.Errorf("error reading chunk %v: %v", n, err))
+					continue
+				}
+				offset := int64(n) * int64(doc.ChunkSize)
+				expected := expectedChunkLength(doc, n)
+				if int64(len(chunk.Data)) != expected {
+					failed.set(fmt.Errorf("chunk %v has %v bytes, expected %v", n, len(chunk.Data), expected))
+					continue
+				}
+				if _, err := localFile.WriteAt(chunk.Data, offset); err != nil {
+					failed.set(err)
+					continue
+				}
+				t.counter.Inc(int64(len(chunk.Data)))
+			}
+		}()
+	}
+	for n := 0; n < numChunks && failed.get() == nil; n++ {
+		if mf.interrupted() {
+			failed.set(util.ErrTerminated)
+			break
+		}
+		jobs <- n
+	}
+	close(jobs)
+	wg.Wait()
+	return failed.get()
+}
+
+// hashChunk returns the hex SHA-256 of a chunk's data.
+func hashChunk(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
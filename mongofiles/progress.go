@@ -0,0 +1,134 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+const progressBarLength = 24
+
+// transferStats sums up the files transferred by one command.
+type transferStats struct {
+	Files   int
+	Bytes   int64
+	started time.Time
+}
+
+// transfer tracks the bytes of one file put or got, showing a progress bar
+// unless --quiet is set.
+type transfer struct {
+	name    string
+	counter progress.Updateable
+	bar     *progress.Bar
+	manager progress.Manager
+	stats   *transferStats
+	// term, once closed, stops the reads of the transfer
+	term <-chan struct{}
+}
+
+// startTransfer starts tracking a transfer of the named file, which has the
+// given size, or 0 if it isn't known.
+func (mf *MongoFiles) startTransfer(name string, size int64) *transfer {
+	if mf.stats.started.IsZero() {
+		mf.stats.started = time.Now()
+	}
+	t := &transfer{name: name, counter: progress.NewCounter(size), stats: &mf.stats, term: mf.termChan}
+	if mf.ToolOptions.Verbosity != nil && !mf.ToolOptions.IsQuiet() {
+		t.bar = &progress.Bar{
+			Name:      name,
+			Watching:  t.counter,
+			Writer:    log.Writer(0),
+			BarLength: progressBarLength,
+			IsBytes:   true,
+			ShowRate:  true,
+		}
+		t.bar.Start()
+	}
+	if mf.ProgressManager != nil {
+		t.manager = mf.ProgressManager
+		t.manager.Attach(name, t.counter)
+	}
+	return t
+}
+
+// Reader returns a reader that counts the bytes read from r, and that fails
+// with util.ErrTerminated once the command is interrupted.
+func (t *transfer) Reader(r io.Reader) io.Reader {
+	return &countingReader{r, t.counter, t.term}
+}
+
+// Writer returns a writer that counts the bytes written to w.
+func (t *transfer) Writer(w io.Writer) io.Writer {
+	return &countingWriter{w, t.counter}
+}
+
+// Done stops the progress bar and, unless the transfer failed with err, adds
+// it to the command's stats.
+func (t *transfer) Done(err error) {
+	if t.bar != nil {
+		t.bar.Stop()
+	}
+	if t.manager != nil {
+		progress.Finish(t.manager, t.name, err)
+	}
+	if err != nil {
+		return
+	}
+	done, _ := t.counter.Progress()
+	t.stats.Files++
+	t.stats.Bytes += done
+}
+
+type countingReader struct {
+	io.Reader
+	counter progress.Updateable
+	term    <-chan struct{}
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.term:
+		return 0, util.ErrTerminated
+	default:
+	}
+	n, err := r.Reader.Read(p)
+	r.counter.Inc(int64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	io.Writer
+	counter progress.Updateable
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.counter.Inc(int64(n))
+	return n, err
+}
+
+// logSummary logs the totals of a command that transferred several files.
+func (mf *MongoFiles) logSummary() {
+	if mf.stats.Files < 2 {
+		return
+	}
+	elapsed := time.Since(mf.stats.started)
+	summary := fmt.Sprintf("transferred %v file(s), %v in %v", mf.stats.Files,
+		text.FormatByteAmount(mf.stats.Bytes), elapsed.Round(time.Millisecond))
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		summary += fmt.Sprintf(" (%v/s)", text.FormatByteAmount(int64(float64(mf.stats.Bytes)/seconds)))
+	}
+	log.Logv(log.Always, summary)
+}
@@ -0,0 +1,219 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// pendingUpload is a document of the <prefix>.uploads collection, which
+// records the _id of each file being put with --resume until its files
+// document is inserted.
+type pendingUpload struct {
+	Filename  string      `bson:"_id"`
+	FilesId   interface{} `bson:"files_id"`
+	ChunkSize int         `bson:"chunkSize"`
+	Started   time.Time   `bson:"started"`
+}
+
+// pendingUploads returns the collection of uploads that can be resumed.
+func (mf *MongoFiles) pendingUploads(gfs *mgo.GridFS) *mgo.Collection {
+	return gfs.Files.Database.C(mf.StorageOptions.GridFSPrefix + ".uploads")
+}
+
+// putResumable stores everything read from local in GridFS under fileName,
+// continuing an earlier put of the same file with --resume if one was
+// interrupted. Chunks already stored are compared with the local data and
+// kept up to the first one that differs. It returns the number of bytes
+// stored.
+func (mf *MongoFiles) putResumable(gfs *mgo.GridFS, local io.Reader, fileName string, id interface{}) (int64, error) {
+	uploads := mf.pendingUploads(gfs)
+	var pending pendingUpload
+	err := uploads.FindId(fileName).One(&pending)
+	switch {
+	case err == mgo.ErrNotFound:
+		if id == nil {
+			id = bson.NewObjectId()
+		}
+		pending = pendingUpload{Filename: fileName, FilesId: id, ChunkSize: DefaultChunkSize, Started: bson.Now()}
+		if err = uploads.Insert(pending); err != nil {
+			return 0, fmt.Errorf("error recording upload of '%v': %v", fileName, err)
+		}
+	case err != nil:
+		return 0, fmt.Errorf("error reading pending upload of '%v': %v", fileName, err)
+	default:
+		if id != nil {
+			// let the server compare the _ids, since their types may have
+			// changed on the round trip
+			count, err := uploads.Find(bson.M{"_id": fileName, "files_id": id}).Count()
+			if err != nil {
+				return 0, fmt.Errorf("error reading pending upload of '%v': %v", fileName, err)
+			}
+			if count == 0 {
+				return 0, fmt.Errorf("an upload of '%v' with a different _id is pending", fileName)
+			}
+		}
+		if pending.ChunkSize != DefaultChunkSize {
+			return 0, fmt.Errorf("pending upload of '%v' has a chunk size of %v, expected %v",
+				fileName, pending.ChunkSize, DefaultChunkSize)
+		}
+		log.Logvf(log.Info, "resuming upload of '%v' started at %v", fileName, pending.Started)
+	}
+
+	existing, err := chunkHashes(gfs.Chunks, pending.FilesId)
+	if err != nil {
+		return 0, err
+	}
+	length, err := mf.putChunks(gfs, local, fileName, pending.FilesId, existing)
+	if err != nil {
+		return 0, err
+	}
+	if err = uploads.RemoveId(fileName); err != nil {
+		return 0, fmt.Errorf("error removing record of upload of '%v': %v", fileName, err)
+	}
+	return length, nil
+}
+
+// chunkHashes returns the SHA-256 of the data of every chunk stored for the
+// file with the given _id, by chunk number.
+func chunkHashes(chunks *mgo.Collection, id interface{}) (map[int]string, error) {
+	hashes := map[int]string{}
+	var chunk gridChunk
+	iter := chunks.Find(bson.M{"files_id": id}).Select(bson.M{"n": 1, "data": 1}).Iter()
+	for iter.Next(&chunk) {
+		hashes[chunk.N] = hashChunk(chunk.Data)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("error reading stored chunks: %v", err)
+	}
+	return hashes, nil
+}
+
+// getResumable writes the GridFS file with the given _id to a local file
+// that may already hold part of it. The last whole chunk in the local file
+// is compared with the stored one and, if they match, the download continues
+// after it; otherwise it starts over. Chunks are fetched in order so that an
+// interrupted download always leaves a valid prefix of the file behind. Once
+// done, the whole local file is checked against the file's checksum.
+func (mf *MongoFiles) getResumable(gfs *mgo.GridFS, id interface{}, localFile *os.File, t *transfer) error {
+	var doc gridFileDoc
+	if err := gfs.Files.FindId(id).One(&doc); err != nil {
+		return fmt.Errorf("error reading GridFS file document: %v", err)
+	}
+	if doc.ChunkSize <= 0 {
+		return fmt.Errorf("GridFS file has an invalid chunk size of %v", doc.ChunkSize)
+	}
+	info, err := localFile.Stat()
+	if err != nil {
+		return err
+	}
+	chunkSize := int64(doc.ChunkSize)
+	numChunks := int((doc.Length + chunkSize - 1) / chunkSize)
+
+	start := int(info.Size() / chunkSize)
+	if info.Size() >= doc.Length {
+		start = numChunks
+	}
+	if start > 0 {
+		ok, err := mf.localChunkMatches(gfs, id, localFile, start-1, doc)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			log.Logvf(log.Info, "local file does not match chunk %v, starting over", start-1)
+			start = 0
+		}
+	}
+	log.Logvf(log.DebugLow, "resuming download at chunk %v of %v", start, numChunks)
+
+	offset := int64(start) * chunkSize
+	if offset > doc.Length {
+		offset = doc.Length
+	}
+	if err = localFile.Truncate(offset); err != nil {
+		return err
+	}
+	// hash what is kept, so the whole file can be checked at the end
+	sum, err := storedChecksum(doc)
+	if err != nil {
+		return err
+	}
+	if _, err = localFile.Seek(0, 0); err != nil {
+		return err
+	}
+	if _, err = io.CopyN(sum, localFile, offset); err != nil {
+		return fmt.Errorf("error reading local file: %v", err)
+	}
+
+	t.counter.Inc(offset)
+	out := io.MultiWriter(t.Writer(localFile), sum)
+	var chunk gridChunk
+	next := start
+	iter := gfs.Chunks.Find(bson.M{"files_id": id, "n": bson.M{"$gte": start}}).Sort("n").Iter()
+	for iter.Next(&chunk) {
+		if mf.interrupted() {
+			// the local file holds every chunk before this one
+			iter.Close()
+			return util.ErrTerminated
+		}
+		if chunk.N != next {
+			iter.Close()
+			return fmt.Errorf("chunk %v is missing", next)
+		}
+		if int64(len(chunk.Data)) != expectedChunkLength(doc, next) {
+			iter.Close()
+			return fmt.Errorf("chunk %v has %v bytes, expected %v", next, len(chunk.Data), expectedChunkLength(doc, next))
+		}
+		if _, err = out.Write(chunk.Data); err != nil {
+			iter.Close()
+			return err
+		}
+		next++
+	}
+	if err = iter.Close(); err != nil {
+		return fmt.Errorf("error reading chunks: %v", err)
+	}
+	if next < numChunks {
+		return fmt.Errorf("chunk %v is missing", next)
+	}
+	if !sum.Matches() {
+		return fmt.Errorf("local file does not match the %v of the GridFS file, run again without --resume", sum.algorithm)
+	}
+	return nil
+}
+
+// localChunkMatches returns true if chunk n of the local file has the same
+// data as the stored chunk.
+func (mf *MongoFiles) localChunkMatches(gfs *mgo.GridFS, id interface{}, localFile *os.File, n int, doc gridFileDoc) (bool, error) {
+	var chunk gridChunk
+	if err := gfs.Chunks.Find(bson.M{"files_id": id, "n": n}).One(&chunk); err != nil {
+		return false, fmt.Errorf("error reading chunk %v: %v", n, err)
+	}
+	local := make([]byte, expectedChunkLength(doc, n))
+	if _, err := localFile.ReadAt(local, int64(n)*int64(doc.ChunkSize)); err != nil {
+		return false, fmt.Errorf("error reading local file: %v", err)
+	}
+	return bytes.Equal(local, chunk.Data), nil
+}
+
+// expectedChunkLength returns the number of bytes chunk n of a file holds.
+func expectedChunkLength(doc gridFileDoc, n int) int64 {
+	length := doc.Length - int64(n)*int64(doc.ChunkSize)
+	if length > int64(doc.ChunkSize) {
+		length = int64(doc.ChunkSize)
+	}
+	return length
+}
@@ -0,0 +1,306 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/fips"
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GridFSURLScheme starts the GridFS side of a sync, e.g. gridfs://fs/site/.
+const GridFSURLScheme = "gridfs://"
+
+// parseGridFSURL splits a URL of the form gridfs://bucket/prefix into the
+// GridFS prefix of the bucket and the prefix of the file names in it, which
+// is given a trailing '/' if it lacks one. ok is false if url is not a
+// GridFS URL.
+func parseGridFSURL(url string) (bucket, prefix string, ok bool) {
+	if !strings.HasPrefix(url, GridFSURLScheme) {
+		return "", "", false
+	}
+	rest := strings.TrimPrefix(url, GridFSURLScheme)
+	bucket = rest
+	if i := strings.Index(rest, "/"); i >= 0 {
+		bucket, prefix = rest[:i], strings.TrimLeft(rest[i+1:], "/")
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return bucket, prefix, true
+}
+
+// remoteFile is every version of a GridFS file with a given name.
+type remoteFile struct {
+	// ids of every version, newest first
+	ids []interface{}
+	// the newest version
+	latest gridFileDoc
+}
+
+// remoteFiles returns the GridFS files whose names start with the sync
+// prefix, by name.
+func (mf *MongoFiles) remoteFiles(gfs *mgo.GridFS) (map[string]*remoteFile, error) {
+	query := bson.M{"filename": bson.M{"$regex": "^" + regexp.QuoteMeta(mf.FileName)}}
+	cursor := gfs.Find(query).Sort("filename", "-uploadDate").Iter()
+	files := map[string]*remoteFile{}
+	for {
+		var doc gridFileDoc
+		if !cursor.Next(&doc) {
+			break
+		}
+		if file, ok := files[doc.Filename]; ok {
+			file.ids = append(file.ids, doc.Id)
+			continue
+		}
+		files[doc.Filename] = &remoteFile{ids: []interface{}{doc.Id}, latest: doc}
+	}
+	if err := cursor.Close(); err != nil {
+		return nil, fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+	for _, file := range files {
+		if file.latest.MD5 != "" || file.latest.SHA256 != "" || fips.Enabled() {
+			continue
+		}
+		// files stored without a checksum can have their MD5 computed by the
+		// server, except in FIPS mode
+		var result struct {
+			MD5 string `bson:"md5"`
+		}
+		cmd := bson.D{{"filemd5", file.latest.Id}, {"root", mf.StorageOptions.GridFSPrefix}}
+		if err := gfs.Files.Database.Run(cmd, &result); err != nil {
+			log.Logvf(log.DebugLow, "error computing MD5 of '%v': %v", file.latest.Filename, err)
+			continue
+		}
+		file.latest.MD5 = result.MD5
+	}
+	return files, nil
+}
+
+// sameContent returns true if the local file exists and has the length and
+// checksum of the GridFS file.
+func sameContent(localFileName string, doc gridFileDoc) (bool, error) {
+	info, err := os.Stat(localFileName)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() || info.Size() != doc.Length {
+		return false, nil
+	}
+	sum, err := storedChecksum(doc)
+	if err != nil {
+		// transferred again, as it can't be compared
+		log.Logvf(log.Info, "%v", err)
+		return false, nil
+	}
+	if sum.expected == "" {
+		return false, nil
+	}
+	file, err := os.Open(localFileName)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	if _, err = io.Copy(sum, file); err != nil {
+		return false, err
+	}
+	return sum.Matches(), nil
+}
+
+// handle logic for 'sync' command
+func (mf *MongoFiles) handleSync(gfs *mgo.GridFS) error {
+	remote, err := mf.remoteFiles(gfs)
+	if err != nil {
+		return err
+	}
+	var transferred, unchanged, deleted int
+	if mf.Upload {
+		transferred, unchanged, deleted, err = mf.syncUp(gfs, remote)
+	} else {
+		transferred, unchanged, deleted, err = mf.syncDown(gfs, remote)
+	}
+	if err != nil {
+		return err
+	}
+	if mf.StorageOptions.DryRun {
+		log.Logvf(log.Always, "would transfer %v file(s) and delete %v; %v file(s) unchanged",
+			transferred, deleted, unchanged)
+		return nil
+	}
+	log.Logvf(log.Always, "transferred %v file(s) and deleted %v; %v file(s) unchanged",
+		transferred, deleted, unchanged)
+	return nil
+}
+
+// syncUp puts every file under the local directory that is missing or
+// different in GridFS, removing the versions it replaces.
+func (mf *MongoFiles) syncUp(gfs *mgo.GridFS, remote map[string]*remoteFile) (transferred, unchanged, deleted int, err error) {
+	// Walk visits files in lexical order, so names are sorted
+	var names []string
+	local := map[string]string{}
+	err = filepath.Walk(mf.LocalDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(mf.LocalDir, path)
+		if err != nil {
+			return err
+		}
+		name := mf.FileName + filepath.ToSlash(rel)
+		names = append(names, name)
+		local[name] = path
+		return nil
+	})
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("error while reading directory '%v': %v", mf.LocalDir, err)
+	}
+
+	for _, name := range names {
+		path := local[name]
+		if file, ok := remote[name]; ok {
+			same, err := sameContent(path, file.latest)
+			if err != nil {
+				return transferred, unchanged, deleted, err
+			}
+			if same {
+				unchanged++
+				continue
+			}
+		}
+		transferred++
+		if mf.StorageOptions.DryRun {
+			log.Logvf(log.Always, "would put '%v' as '%v'", path, name)
+			continue
+		}
+		if err = mf.putFile(gfs, path, name, nil); err != nil {
+			return transferred, unchanged, deleted, err
+		}
+		if file, ok := remote[name]; ok {
+			for _, id := range file.ids {
+				if err = gfs.RemoveId(id); err != nil {
+					return transferred, unchanged, deleted, fmt.Errorf("error while removing old version of '%v': %v", name, err)
+				}
+			}
+		}
+	}
+
+	if !mf.StorageOptions.Delete {
+		return transferred, unchanged, deleted, nil
+	}
+	for _, name := range remoteNames(remote) {
+		if _, ok := local[name]; ok {
+			continue
+		}
+		deleted++
+		if mf.StorageOptions.DryRun {
+			log.Logvf(log.Always, "would delete '%v' from GridFS", name)
+			continue
+		}
+		for _, id := range remote[name].ids {
+			if err = gfs.RemoveId(id); err != nil {
+				return transferred, unchanged, deleted, fmt.Errorf("error while removing '%v' from GridFS: %v", name, err)
+			}
+		}
+		log.Logvf(log.Always, "deleted '%v' from GridFS", name)
+	}
+	return transferred, unchanged, deleted, nil
+}
+
+// syncDown writes the latest version of every GridFS file under the prefix
+// that is missing or different in the local directory.
+func (mf *MongoFiles) syncDown(gfs *mgo.GridFS, remote map[string]*remoteFile) (transferred, unchanged, deleted int, err error) {
+	wanted := map[string]bool{}
+	for _, name := range remoteNames(remote) {
+		file := remote[name]
+		localFileName, err := localPathInDir(mf.LocalDir, mf.FileName, name)
+		if err != nil {
+			log.Logvf(log.Always, "skipping: %v", err)
+			continue
+		}
+		wanted[localFileName] = true
+		same, err := sameContent(localFileName, file.latest)
+		if err != nil {
+			return transferred, unchanged, deleted, err
+		}
+		if same {
+			unchanged++
+			continue
+		}
+		transferred++
+		if mf.StorageOptions.DryRun {
+			log.Logvf(log.Always, "would get '%v' as '%v'", name, localFileName)
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(localFileName), 0755); err != nil {
+			return transferred, unchanged, deleted, fmt.Errorf("error while creating directory for '%v': %v", localFileName, err)
+		}
+		gFile, err := gfs.OpenId(file.latest.Id)
+		if err != nil {
+			return transferred, unchanged, deleted, fmt.Errorf("error opening GridFS file '%s': %v", name, err)
+		}
+		err = mf.writeFileTo(gfs, gFile, localFileName)
+		gFile.Close()
+		if err != nil {
+			return transferred, unchanged, deleted, err
+		}
+		log.Logvf(log.Always, "wrote '%v' to '%v'", name, localFileName)
+	}
+
+	if !mf.StorageOptions.Delete {
+		return transferred, unchanged, deleted, nil
+	}
+	var extraneous []string
+	err = filepath.Walk(mf.LocalDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && !wanted[path] {
+			extraneous = append(extraneous, path)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return transferred, unchanged, deleted, fmt.Errorf("error while reading directory '%v': %v", mf.LocalDir, err)
+	}
+	for _, path := range extraneous {
+		deleted++
+		if mf.StorageOptions.DryRun {
+			log.Logvf(log.Always, "would delete '%v'", path)
+			continue
+		}
+		if err = os.Remove(path); err != nil {
+			return transferred, unchanged, deleted, fmt.Errorf("error while removing '%v': %v", path, err)
+		}
+		log.Logvf(log.Always, "deleted '%v'", path)
+	}
+	return transferred, unchanged, deleted, nil
+}
+
+// remoteNames returns the names of the remote files, sorted.
+func remoteNames(remote map[string]*remoteFile) []string {
+	names := make([]string, 0, len(remote))
+	for name := range remote {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,148 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongofiles
+
+import (
+	"fmt"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// verifyFile reads every chunk of a GridFS file and returns a description of
+// each problem found with them: chunks missing, out of sequence or of the
+// wrong size, or data that doesn't match the file's checksum.
+func verifyFile(gfs *mgo.GridFS, doc gridFileDoc) ([]string, error) {
+	if doc.ChunkSize <= 0 {
+		return []string{fmt.Sprintf("invalid chunk size %v", doc.ChunkSize)}, nil
+	}
+	numChunks := int((doc.Length + int64(doc.ChunkSize) - 1) / int64(doc.ChunkSize))
+
+	sum, err := storedChecksum(doc)
+	if err != nil {
+		return nil, err
+	}
+	var problems []string
+	next := 0
+	var chunk gridChunk
+	iter := gfs.Chunks.Find(bson.M{"files_id": doc.Id}).Sort("n").Iter()
+	for iter.Next(&chunk) {
+		switch {
+		case chunk.N < next:
+			problems = append(problems, fmt.Sprintf("duplicate chunk %v", chunk.N))
+			continue
+		case chunk.N >= numChunks:
+			problems = append(problems, fmt.Sprintf("chunk %v is past the end of the file", chunk.N))
+			continue
+		case chunk.N > next:
+			problems = append(problems, fmt.Sprintf("chunks %v to %v are missing", next, chunk.N-1))
+		}
+		if expected := expectedChunkLength(doc, chunk.N); int64(len(chunk.Data)) != expected {
+			problems = append(problems, fmt.Sprintf("chunk %v has %v bytes, expected %v", chunk.N, len(chunk.Data), expected))
+		}
+		sum.Write(chunk.Data)
+		next = chunk.N + 1
+	}
+	if err = iter.Close(); err != nil {
+		return nil, fmt.Errorf("error reading chunks of '%v': %v", doc.Filename, err)
+	}
+	if next < numChunks {
+		problems = append(problems, fmt.Sprintf("chunks %v to %v are missing", next, numChunks-1))
+	}
+	// a hash over missing or broken chunks says nothing more
+	if len(problems) == 0 && !sum.Matches() {
+		problems = append(problems, fmt.Sprintf("data does not match %v", sum))
+	}
+	return problems, nil
+}
+
+// chunkGroup is the number of chunks with a given files_id.
+type chunkGroup struct {
+	FilesId interface{} `bson:"_id"`
+	Count   int         `bson:"count"`
+}
+
+// orphanedChunks returns the number of chunks of each files_id that has no
+// files document, leaving out uploads that can be continued with --resume.
+func (mf *MongoFiles) orphanedChunks(gfs *mgo.GridFS) ([]chunkGroup, error) {
+	var groups []chunkGroup
+	pipeline := []bson.M{{"$group": bson.M{"_id": "$files_id", "count": bson.M{"$sum": 1}}}}
+	if err := gfs.Chunks.Pipe(pipeline).AllowDiskUse().All(&groups); err != nil {
+		return nil, fmt.Errorf("error grouping chunks: %v", err)
+	}
+	var orphans []chunkGroup
+	for _, group := range groups {
+		n, err := gfs.Files.FindId(group.FilesId).Count()
+		if err == nil && n == 0 {
+			n, err = mf.pendingUploads(gfs).Find(bson.M{"files_id": group.FilesId}).Count()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error looking up files_id %v: %v", group.FilesId, err)
+		}
+		if n == 0 {
+			orphans = append(orphans, group)
+		}
+	}
+	return orphans, nil
+}
+
+// handle logic for 'verify' command, checking every file matching the name
+// or pattern given, or every file and any orphaned chunks if none was given
+func (mf *MongoFiles) handleVerify(gfs *mgo.GridFS) error {
+	query := bson.M{}
+	if mf.isPattern() {
+		var err error
+		if query, err = mf.patternQuery(); err != nil {
+			return err
+		}
+	} else if mf.FileName != "" {
+		query = bson.M{"filename": mf.FileName}
+	}
+
+	checked, corrupt := 0, 0
+	iter := gfs.Find(query).Sort("filename", "uploadDate").Iter()
+	for {
+		var doc gridFileDoc
+		if !iter.Next(&doc) {
+			break
+		}
+		problems, err := verifyFile(gfs, doc)
+		if err != nil {
+			iter.Close()
+			return err
+		}
+		checked++
+		if len(problems) > 0 {
+			corrupt++
+		}
+		for _, problem := range problems {
+			log.Logvf(log.Always, "corrupt file '%v' (_id %v): %v", doc.Filename, doc.Id, problem)
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return fmt.Errorf("error retrieving list of GridFS files: %v", err)
+	}
+
+	orphaned := 0
+	if mf.FileName == "" {
+		orphans, err := mf.orphanedChunks(gfs)
+		if err != nil {
+			return err
+		}
+		for _, group := range orphans {
+			log.Logvf(log.Always, "%v orphaned chunk(s) with files_id %v", group.Count, group.FilesId)
+			orphaned += group.Count
+		}
+	}
+
+	log.Logvf(log.Always, "verified %v file(s): %v corrupt, %v orphaned chunk(s)", checked, corrupt, orphaned)
+	if corrupt > 0 || orphaned > 0 {
+		return fmt.Errorf("found %v corrupt file(s) and %v orphaned chunk(s)", corrupt, orphaned)
+	}
+	return nil
+}
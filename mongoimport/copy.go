@@ -0,0 +1,165 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/mongodb/mongo-tools/common/bsonutil"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/json"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// CollectionInputReader is an InputReader of the documents a query of a
+// collection returns, for copying them from another deployment.
+type CollectionInputReader struct {
+	// numRead is the number of documents read, updated atomically
+	numRead int64
+
+	query *mgo.Query
+}
+
+// NewCollectionInputReader returns a CollectionInputReader of the documents
+// the query returns.
+func NewCollectionInputReader(query *mgo.Query) *CollectionInputReader {
+	return &CollectionInputReader{query: query}
+}
+
+// StreamDocument streams the documents the query returns, in the order they
+// are returned whether or not ordered is set.
+func (r *CollectionInputReader) StreamDocument(ordered bool, readChan chan bson.D) error {
+	defer close(readChan)
+	iter := r.query.Iter()
+	for {
+		var document bson.D
+		if !iter.Next(&document) {
+			break
+		}
+		readChan <- document
+		atomic.AddInt64(&r.numRead, 1)
+	}
+	if err := iter.Close(); err != nil {
+		return fmt.Errorf("error reading from the source collection: %v", err)
+	}
+	return nil
+}
+
+// ReadAndValidateHeader is a no-op for collection input readers.
+func (r *CollectionInputReader) ReadAndValidateHeader() error {
+	return nil
+}
+
+// ReadAndValidateTypedHeader is a no-op for collection input readers.
+func (r *CollectionInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) error {
+	return nil
+}
+
+// Size returns the number of documents read, as the progress of a copy is
+// tracked in documents rather than bytes.
+func (r *CollectionInputReader) Size() int64 {
+	return atomic.LoadInt64(&r.numRead)
+}
+
+// copyDocuments writes the documents of the collection of --fromUri matching
+// --query to the target namespace, as ImportDocuments does those of a file.
+func (imp *MongoImport) copyDocuments() (_ uint64, err error) {
+	session, uriDB, closeSource, err := imp.openSource()
+	if err != nil {
+		return 0, err
+	}
+	defer closeSource()
+
+	database, collection := util.SplitNamespace(imp.InputOptions.FromNamespace)
+	if database == "" {
+		database = uriDB
+	}
+	if database == "" {
+		database = imp.ToolOptions.DB
+	}
+	if collection == "" {
+		collection = imp.ToolOptions.Collection
+	}
+	query, err := parseCopyQuery(imp.InputOptions.Query)
+	if err != nil {
+		return 0, err
+	}
+	log.Logvf(log.Always, "copying from: %v.%v", database, collection)
+
+	source := session.DB(database).C(collection)
+	// the count only sizes the progress bar, so a copy can go on without it
+	total, err := source.Find(query).Count()
+	if err != nil {
+		log.Logvf(log.Info, "error counting the documents to copy: %v", err)
+		total = 0
+	}
+	inputReader := NewCollectionInputReader(source.Find(query))
+
+	bar := &progress.Bar{
+		Name:      fmt.Sprintf("%v.%v", imp.ToolOptions.DB, imp.ToolOptions.Collection),
+		Watching:  &fileSizeProgressor{int64(total), inputReader},
+		Writer:    log.Writer(0),
+		BarLength: progressBarLength,
+	}
+	bar.Start()
+	defer bar.Stop()
+	if imp.ProgressManager != nil {
+		imp.ProgressManager.Attach(bar.Name, bar.Watching)
+		defer func() { progress.Finish(imp.ProgressManager, bar.Name, err) }()
+	}
+	return imp.importDocuments(inputReader)
+}
+
+// openSource connects to the deployment of --fromUri, returning a session,
+// the database of the connection string, if any, and a func to close them.
+func (imp *MongoImport) openSource() (*mgo.Session, string, func(), error) {
+	opts := options.New("mongoimport", "", options.EnabledOptions{Auth: true, Connection: true, URI: true})
+	if imp.ToolOptions.SSL != nil {
+		ssl := *imp.ToolOptions.SSL
+		opts.SSL = &ssl
+	}
+	if _, err := opts.ParseArgs([]string{"--uri", imp.InputOptions.FromURI}); err != nil {
+		return nil, "", nil, fmt.Errorf("error parsing connection string '%v': %v", imp.InputOptions.FromURI, err)
+	}
+	provider, err := db.NewSessionProvider(*opts)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("error connecting to '%v': %v", imp.InputOptions.FromURI, err)
+	}
+	provider.SetFlags(db.DisableSocketTimeout)
+	session, err := provider.GetSession()
+	if err != nil {
+		provider.Close()
+		return nil, "", nil, fmt.Errorf("error connecting to '%v': %v", imp.InputOptions.FromURI, err)
+	}
+	closer := func() {
+		session.Close()
+		provider.Close()
+	}
+	return session, opts.Namespace.DB, closer, nil
+}
+
+// parseCopyQuery parses the --query filter of the documents to copy, which
+// is nil, matching every document, if it is empty.
+func parseCopyQuery(query string) (bson.M, error) {
+	if query == "" {
+		return nil, nil
+	}
+	parsedJSON := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(query), &parsedJSON); err != nil {
+		return nil, fmt.Errorf("query '%v' is not valid JSON: %v", query, err)
+	}
+	if err := bsonutil.ConvertJSONDocumentToBSON(parsedJSON); err != nil {
+		return nil, fmt.Errorf("error converting query to bson: %v", err)
+	}
+	return bson.M(parsedJSON), nil
+}
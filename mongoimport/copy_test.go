@@ -0,0 +1,104 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestCopyValidateSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Given a mongoimport instance copying from another deployment, ", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.InputOptions.Type = JSON
+		imp.InputOptions.FromURI = "mongodb://source:27017"
+
+		Convey("no error should be thrown with a namespace and query to copy", func() {
+			imp.InputOptions.FromNamespace = "src.people"
+			imp.InputOptions.Query = `{"age": {"$gt": 30}}`
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+		})
+
+		Convey("the collection of --fromNs should be used if none is given", func() {
+			imp.ToolOptions.Namespace.Collection = ""
+			imp.InputOptions.FromNamespace = "src.people"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			So(imp.ToolOptions.Namespace.Collection, ShouldEqual, "people")
+		})
+
+		Convey("an error should be thrown if no collection is given at all", func() {
+			imp.ToolOptions.Namespace.Collection = ""
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown if an input file is given too", func() {
+			So(imp.ValidateSettings([]string{"input.json"}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown for a type other than JSON", func() {
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("an error should be thrown for a query that isn't JSON", func() {
+			imp.InputOptions.Query = "{age: "
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+	})
+
+	Convey("--fromNs and --query should only be accepted with --fromUri", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.InputOptions.Query = `{"a": 1}`
+		So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+	})
+}
+
+func TestCopyDocuments(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.IntegrationTestType)
+
+	Convey("With documents in a source collection", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		session, err := imp.SessionProvider.GetSession()
+		So(err, ShouldBeNil)
+		defer session.Close()
+		source := session.DB(testDb).C("copy_source")
+		So(source.DropCollection(), ShouldBeNil)
+		for i := 1; i <= 5; i++ {
+			So(source.Insert(bson.M{"_id": i, "even": i%2 == 0}), ShouldBeNil)
+		}
+		Reset(func() {
+			session.DB(testDb).C("copy_source").DropCollection()
+			session.DB(testDb).C(testCollection).RemoveAll(nil)
+		})
+
+		Convey("the documents matching the query should be copied to the target", func() {
+			imp.InputOptions.FromURI = fmt.Sprintf("mongodb://localhost:%v/%v", db.DefaultTestPort, testDb)
+			imp.InputOptions.FromNamespace = testDb + ".copy_source"
+			imp.InputOptions.Query = `{"even": false}`
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+			numImported, err := imp.ImportDocuments()
+			So(err, ShouldBeNil)
+			So(numImported, ShouldEqual, 3)
+			So(checkOnlyHasDocuments(imp.SessionProvider, []bson.M{
+				{"_id": 1, "even": false},
+				{"_id": 3, "even": false},
+				{"_id": 5, "even": false},
+			}), ShouldBeNil)
+		})
+	})
+}
@@ -151,16 +151,10 @@ func (r *JSONInputReader) StreamDocument(ordered bool, readChan chan bson.D) (re
 // Convert implements the Converter interface for JSON input. It converts a
 // JSONConverter struct to a BSON document.
 func (c JSONConverter) Convert() (bson.D, error) {
-	document, err := json.UnmarshalBsonD(c.data)
+	bsonD, err := bsonutil.UnmarshalExtJSON(c.data)
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshaling bytes on document #%v: %v", c.index, err)
 	}
-	log.Logvf(log.DebugHigh, "got line: %v", document)
-
-	bsonD, err := bsonutil.GetExtendedBsonD(document)
-	if err != nil {
-		return nil, fmt.Errorf("error getting extended BSON for document #%v: %v", c.index, err)
-	}
 	log.Logvf(log.DebugHigh, "got extended line: %#v", bsonD)
 	return bsonD, nil
 }
@@ -12,9 +12,15 @@ import (
 	"os"
 
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/db/csfle"
+	"github.com/mongodb/mongo-tools/common/diagnose"
+	"github.com/mongodb/mongo-tools/common/failure"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/signals"
+	"github.com/mongodb/mongo-tools/common/throttle"
+	"github.com/mongodb/mongo-tools/common/trace"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongoimport"
 )
@@ -28,6 +34,12 @@ func main() {
 	opts.AddOptions(inputOpts)
 	ingestOpts := &mongoimport.IngestOptions{}
 	opts.AddOptions(ingestOpts)
+	encryptionOpts := &options.Encryption{}
+	opts.AddOptions(encryptionOpts)
+	throttleOpts := &options.Throttle{}
+	opts.AddOptions(throttleOpts)
+	tracingOpts := &options.Tracing{}
+	opts.AddOptions(tracingOpts)
 	opts.URI.AddKnownURIParameters(options.KnownURIOptionsWriteConcern)
 
 	args, err := opts.ParseArgs(os.Args[1:])
@@ -38,7 +50,7 @@ func main() {
 	}
 
 	log.SetVerbosity(opts.Verbosity)
-	signals.Handle()
+	log.SetFormat(opts.LogFormat, opts.AppName)
 
 	// print help, if specified
 	if opts.PrintHelp(false) {
@@ -53,26 +65,73 @@ func main() {
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
+	// test connecting to the server step by step, if specified
+	if opts.Diagnose {
+		os.Exit(diagnose.Run(opts, os.Stdout))
+	}
+
+	if err = trace.Init(tracingOpts.OTelEndpoint, opts.AppName); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		log.Logvf(log.Always, "try 'mongoimport --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	limiter, err := throttle.FromOptions(throttleOpts)
+	if err != nil {
+		log.Logvf(log.Always, "%v", err)
+		log.Logvf(log.Always, "try 'mongoimport --help' for more information")
+		trace.Shutdown(err)
+		os.Exit(util.ExitBadOptions)
+	}
+
 	// create a session provider to connect to the db
 	sessionProvider, err := db.NewSessionProvider(*opts)
 	if err != nil {
 		log.Logvf(log.Always, "error connecting to host: %v", err)
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		os.Exit(failure.ExitCode(err))
 	}
 	defer sessionProvider.Close()
 	sessionProvider.SetBypassDocumentValidation(ingestOpts.BypassDocumentValidation)
 
+	encryption, err := csfle.New(sessionProvider, encryptionOpts)
+	if err != nil {
+		log.Logvf(log.Always, "error setting up encryption: %v", err)
+		trace.Shutdown(err)
+		os.Exit(util.ExitBadOptions)
+	}
+
 	m := mongoimport.MongoImport{
 		ToolOptions:     opts,
 		InputOptions:    inputOpts,
 		IngestOptions:   ingestOpts,
 		SessionProvider: sessionProvider,
+		Encryption:      encryption,
+		Limiter:         limiter,
 	}
 
+	// write progress events, if asked to
+	eventWriter, err := progress.OpenEventWriter(opts.ProgressFD, opts.ProgressSocket, opts.AppName, progress.DefaultWaitTime, true)
+	if err != nil {
+		log.Logvf(log.Always, "error opening progress event stream: %v", err)
+		trace.Shutdown(err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if eventWriter != nil {
+		eventWriter.Start()
+		defer eventWriter.Stop()
+		m.ProgressManager = eventWriter
+	}
+
+	finishedChan := signals.HandleWithInterrupt(m.HandleInterrupt)
+	defer close(finishedChan)
+
 	if err = m.ValidateSettings(args); err != nil {
 		log.Logvf(log.Always, "error validating settings: %v", err)
 		log.Logvf(log.Always, "try 'mongoimport --help' for more information")
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		eventWriter.StopWithError(err)
+		os.Exit(util.ExitBadOptions)
 	}
 
 	numDocs, err := m.ImportDocuments()
@@ -86,7 +145,9 @@ func main() {
 		}
 		log.Logvf(log.Always, message)
 	}
+	trace.Shutdown(err)
 	if err != nil {
-		os.Exit(util.ExitError)
+		eventWriter.StopWithError(err)
+		os.Exit(failure.ExitCode(err))
 	}
 }
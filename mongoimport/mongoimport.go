@@ -9,9 +9,12 @@ package mongoimport
 
 import (
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/db/csfle"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/storage"
+	"github.com/mongodb/mongo-tools/common/throttle"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -24,6 +27,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Input format types accepted by mongoimport.
@@ -31,6 +35,7 @@ const (
 	CSV  = "csv"
 	TSV  = "tsv"
 	JSON = "json"
+	XLSX = "xlsx"
 )
 
 // Modes accepted by mongoimport.
@@ -65,6 +70,17 @@ type MongoImport struct {
 	// SessionProvider is used for connecting to the database
 	SessionProvider *db.SessionProvider
 
+	// ProgressManager, if set, tracks the progress of the import besides
+	// its progress bar
+	ProgressManager progress.Manager
+
+	// Encryption, if set, encrypts the fields of the documents that its
+	// schema map selects before they are written.
+	Encryption *csfle.Client
+
+	// Limiter, if set, limits the rate at which documents are written.
+	Limiter *throttle.Limiter
+
 	// the tomb is used to synchronize ingestion goroutines and causes
 	// other sibling goroutines to terminate immediately if one errors out
 	tomb.Tomb
@@ -74,6 +90,9 @@ type MongoImport struct {
 
 	// type of node the SessionProvider is connected to
 	nodeType db.NodeType
+
+	// termChan is closed by HandleInterrupt to stop the import.
+	termChan chan struct{}
 }
 
 type InputReader interface {
@@ -115,14 +134,42 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 	} else {
 		if !(imp.InputOptions.Type == TSV ||
 			imp.InputOptions.Type == JSON ||
-			imp.InputOptions.Type == CSV) {
+			imp.InputOptions.Type == CSV ||
+			imp.InputOptions.Type == XLSX) {
 			return fmt.Errorf("unknown type %v", imp.InputOptions.Type)
 		}
 	}
 
-	// ensure headers are supplied for CSV/TSV
+	if imp.InputOptions.FromURI != "" {
+		if imp.InputOptions.Type != JSON {
+			return fmt.Errorf("can not use --type %v with --fromUri", imp.InputOptions.Type)
+		}
+		if imp.InputOptions.JSONArray {
+			return fmt.Errorf("can not use --jsonArray with --fromUri")
+		}
+		if imp.InputOptions.File != "" || len(args) != 0 {
+			return fmt.Errorf("incompatible options: --fromUri and an input file")
+		}
+		if imp.InputOptions.FromNamespace != "" {
+			if _, _, err := util.SplitAndValidateNamespace(imp.InputOptions.FromNamespace); err != nil {
+				return fmt.Errorf("invalid --fromNs argument: %v", err)
+			}
+		}
+		if _, err := parseCopyQuery(imp.InputOptions.Query); err != nil {
+			return err
+		}
+	} else if imp.InputOptions.FromNamespace != "" || imp.InputOptions.Query != "" {
+		return fmt.Errorf("can only use --fromNs and --query with --fromUri")
+	}
+
+	if imp.InputOptions.Sheet != "" && imp.InputOptions.Type != XLSX {
+		return fmt.Errorf("can only use --sheet when input type is xlsx")
+	}
+
+	// ensure headers are supplied for CSV/TSV/XLSX
 	if imp.InputOptions.Type == CSV ||
-		imp.InputOptions.Type == TSV {
+		imp.InputOptions.Type == TSV ||
+		imp.InputOptions.Type == XLSX {
 		if !imp.InputOptions.HeaderLine {
 			if imp.InputOptions.Fields == nil &&
 				imp.InputOptions.FieldFile == nil {
@@ -246,6 +293,15 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 	}
 
 	// ensure we have a valid string to use for the collection
+	if imp.ToolOptions.Collection == "" && imp.InputOptions.FromURI != "" {
+		_, collection := util.SplitNamespace(imp.InputOptions.FromNamespace)
+		if collection == "" {
+			return fmt.Errorf("must specify --collection or --fromNs with --fromUri")
+		}
+		log.Logvf(log.Always, "no collection specified")
+		log.Logvf(log.Always, "using '%v' of --fromNs as collection", collection)
+		imp.ToolOptions.Collection = collection
+	}
 	if imp.ToolOptions.Collection == "" {
 		log.Logvf(log.Always, "no collection specified")
 		fileBaseName := filepath.Base(imp.InputOptions.File)
@@ -267,6 +323,15 @@ func (imp *MongoImport) ValidateSettings(args []string) error {
 // returns a progress.Progressor which can be used to track progress if the
 // reader supports it.
 func (imp *MongoImport) getSourceReader() (io.ReadCloser, int64, error) {
+	if storage.IsURL(imp.InputOptions.File) {
+		object, err := storage.Open(imp.InputOptions.File)
+		if err != nil {
+			return nil, -1, err
+		}
+		log.Logvf(log.Info, "reading from %v", imp.InputOptions.File)
+		// the size of the object isn't known, as for stdin
+		return object, 0, nil
+	}
 	if imp.InputOptions.File != "" {
 		file, err := os.Open(util.ToUniversalPath(imp.InputOptions.File))
 		if err != nil {
@@ -300,7 +365,10 @@ func (fsp *fileSizeProgressor) Progress() (int64, int64) {
 // ImportDocuments is used to write input data to the database. It returns the
 // number of documents successfully imported to the appropriate namespace and
 // any error encountered in doing this
-func (imp *MongoImport) ImportDocuments() (uint64, error) {
+func (imp *MongoImport) ImportDocuments() (_ uint64, err error) {
+	if imp.InputOptions.FromURI != "" {
+		return imp.copyDocuments()
+	}
 	source, fileSize, err := imp.getSourceReader()
 	if err != nil {
 		return 0, err
@@ -332,6 +400,10 @@ func (imp *MongoImport) ImportDocuments() (uint64, error) {
 	}
 	bar.Start()
 	defer bar.Stop()
+	if imp.ProgressManager != nil {
+		imp.ProgressManager.Attach(bar.Name, bar.Watching)
+		defer func() { progress.Finish(imp.ProgressManager, bar.Name, err) }()
+	}
 	return imp.importDocuments(inputReader)
 }
 
@@ -383,6 +455,7 @@ func (imp *MongoImport) importDocuments(inputReader InputReader) (numImported ui
 		}
 	}
 
+	imp.termChan = make(chan struct{})
 	readDocs := make(chan bson.D, workerBufferSize)
 	processingErrChan := make(chan error)
 	ordered := imp.IngestOptions.MaintainInsertionOrder
@@ -420,12 +493,19 @@ func (imp *MongoImport) ingestDocuments(readDocs chan bson.D) (retErr error) {
 	//    error - and stopOnError is set to true
 
 	wg := new(sync.WaitGroup)
+	var terminated int32
 	for i := 0; i < numInsertionWorkers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			// only set the first insertion error and cause sibling goroutines to terminate immediately
 			err := imp.runInsertionWorker(readDocs)
+			if err == util.ErrTerminated {
+				// the sibling goroutines stop on their own, once they have
+				// inserted the documents they hold
+				atomic.StoreInt32(&terminated, 1)
+				return
+			}
+			// only set the first insertion error and cause sibling goroutines to terminate immediately
 			if err != nil && retErr == nil {
 				retErr = err
 				imp.Kill(err)
@@ -433,9 +513,21 @@ func (imp *MongoImport) ingestDocuments(readDocs chan bson.D) (retErr error) {
 		}()
 	}
 	wg.Wait()
+	if retErr == nil && atomic.LoadInt32(&terminated) == 1 {
+		retErr = util.ErrTerminated
+	}
 	return
 }
 
+// HandleInterrupt stops the import: no more documents are read, the ones
+// already read are inserted, and ImportDocuments returns util.ErrTerminated
+// with the number of documents imported.
+func (imp *MongoImport) HandleInterrupt() {
+	if imp.termChan != nil {
+		close(imp.termChan)
+	}
+}
+
 // configureSession takes in a session and modifies it with properly configured
 // settings. It does the following configurations:
 //
@@ -474,13 +566,17 @@ func (imp *MongoImport) runInsertionWorker(readDocs chan bson.D) (err error) {
 		return fmt.Errorf("error configuring session: %v", err)
 	}
 	collection := session.DB(imp.ToolOptions.DB).C(imp.ToolOptions.Collection)
+	namespace := imp.ToolOptions.DB + "." + imp.ToolOptions.Collection
 
+	terminated := false
 	var inserter flushInserter
 	if imp.IngestOptions.Mode == modeInsert {
-		inserter = db.NewBufferedBulkInserter(collection, imp.IngestOptions.BulkBufferSize, !imp.IngestOptions.StopOnError)
+		bulk := db.NewBufferedBulkInserter(collection, imp.IngestOptions.BulkBufferSize, !imp.IngestOptions.StopOnError)
 		if !imp.IngestOptions.MaintainInsertionOrder {
-			inserter.(*db.BufferedBulkInserter).Unordered()
+			bulk.Unordered()
 		}
+		bulk.SetLimiter(imp.Limiter)
+		inserter = bulk
 	} else {
 		inserter = imp.newUpserter(collection)
 	}
@@ -492,11 +588,19 @@ readLoop:
 			if !alive {
 				break readLoop
 			}
+			if imp.Encryption != nil {
+				if _, err = imp.Encryption.Encrypt(namespace, document); err != nil {
+					return err
+				}
+			}
 			err = filterIngestError(imp.IngestOptions.StopOnError, inserter.Insert(document))
 			if err != nil {
 				return err
 			}
 			atomic.AddUint64(&imp.insertionCount, 1)
+		case <-imp.termChan:
+			terminated = true
+			break readLoop
 		case <-imp.Dying():
 			return nil
 		}
@@ -515,7 +619,13 @@ readLoop:
 			atomic.AddUint64(&imp.insertionCount, ^uint64(numFailures-1))
 		}
 	}
-	return filterIngestError(imp.IngestOptions.StopOnError, err)
+	if err = filterIngestError(imp.IngestOptions.StopOnError, err); err != nil {
+		return err
+	}
+	if terminated {
+		return util.ErrTerminated
+	}
+	return nil
 }
 
 type upserter struct {
@@ -535,6 +645,15 @@ func (imp *MongoImport) newUpserter(collection *mgo.Collection) *upserter {
 func (up *upserter) Insert(doc interface{}) error {
 	document := doc.(bson.D)
 	selector := constructUpsertDocument(up.imp.upsertFields, document)
+	size := 0
+	if up.imp.Limiter.LimitsBytes() {
+		if raw, err := bson.Marshal(document); err == nil {
+			size = len(raw)
+		}
+	}
+	up.imp.Limiter.Wait(1, size)
+	start := time.Now()
+	defer func() { up.imp.Limiter.Observe(time.Since(start)) }()
 	var err error
 	if selector == nil { // modeInsert || doc-not-exist
 		log.Logvf(log.Info, "Could not construct selector from %v, falling back to insert mode", up.imp.upsertFields)
@@ -609,6 +728,8 @@ func (imp *MongoImport) getInputReader(in io.Reader) (InputReader, error) {
 		return NewCSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks), nil
 	} else if imp.InputOptions.Type == TSV {
 		return NewTSVInputReader(colSpecs, in, out, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks), nil
+	} else if imp.InputOptions.Type == XLSX {
+		return NewXLSXInputReader(colSpecs, in, imp.InputOptions.Sheet, imp.IngestOptions.NumDecodingWorkers, ignoreBlanks), nil
 	}
 	return NewJSONInputReader(imp.InputOptions.JSONArray, in, imp.IngestOptions.NumDecodingWorkers), nil
 }
@@ -31,7 +31,7 @@ const (
 
 // checkOnlyHasDocuments returns an error if the documents in the test
 // collection don't exactly match those that are passed in
-func checkOnlyHasDocuments(sessionProvider db.SessionProvider, expectedDocuments []bson.M) error {
+func checkOnlyHasDocuments(sessionProvider *db.SessionProvider, expectedDocuments []bson.M) error {
 	session, err := sessionProvider.GetSession()
 	if err != nil {
 		return err
@@ -580,7 +580,7 @@ func TestImportDocuments(t *testing.T) {
 				bson.M{"_id": 5, "c": "6e"},
 				bson.M{"_id": 7, "b": int(8), "c": int(6)},
 			}
-			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+			So(checkOnlyHasDocuments(imp.SessionProvider, expectedDocuments), ShouldBeNil)
 		})
 		Convey("CSV import without --ignoreBlanks should include blanks", func() {
 			imp, err := NewMongoImport()
@@ -597,7 +597,7 @@ func TestImportDocuments(t *testing.T) {
 				bson.M{"_id": 5, "b": "", "c": "6e"},
 				bson.M{"_id": 7, "b": int(8), "c": int(6)},
 			}
-			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+			So(checkOnlyHasDocuments(imp.SessionProvider, expectedDocuments), ShouldBeNil)
 		})
 		Convey("no error should be thrown for CSV import on test data with --upsertFields", func() {
 			imp, err := NewMongoImport()
@@ -616,7 +616,7 @@ func TestImportDocuments(t *testing.T) {
 				bson.M{"_id": 3, "b": 5.4, "c": "string"},
 				bson.M{"_id": 5, "b": int(6), "c": int(6)},
 			}
-			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+			So(checkOnlyHasDocuments(imp.SessionProvider, expectedDocuments), ShouldBeNil)
 		})
 		Convey("no error should be thrown for CSV import on test data with "+
 			"--stopOnError. Only documents before error should be imported", func() {
@@ -637,7 +637,7 @@ func TestImportDocuments(t *testing.T) {
 				bson.M{"_id": 3, "b": 5.4, "c": "string"},
 				bson.M{"_id": 5, "b": int(6), "c": int(6)},
 			}
-			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+			So(checkOnlyHasDocuments(imp.SessionProvider, expectedDocuments), ShouldBeNil)
 		})
 		Convey("CSV import with duplicate _id's should not error if --stopOnError is not set", func() {
 			imp, err := NewMongoImport()
@@ -659,7 +659,7 @@ func TestImportDocuments(t *testing.T) {
 				bson.M{"_id": 8, "b": int(6), "c": int(6)},
 			}
 			// all docs except the one with duplicate _id - should be imported
-			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+			So(checkOnlyHasDocuments(imp.SessionProvider, expectedDocuments), ShouldBeNil)
 		})
 		Convey("no error should be thrown for CSV import on test data with --drop", func() {
 			imp, err := NewMongoImport()
@@ -679,7 +679,7 @@ func TestImportDocuments(t *testing.T) {
 				bson.M{"_id": 3, "b": 5.4, "c": "string"},
 				bson.M{"_id": 5, "b": int(6), "c": int(6)},
 			}
-			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+			So(checkOnlyHasDocuments(imp.SessionProvider, expectedDocuments), ShouldBeNil)
 		})
 		Convey("CSV import on test data with --headerLine should succeed", func() {
 			imp, err := NewMongoImport()
@@ -727,7 +727,7 @@ func TestImportDocuments(t *testing.T) {
 				bson.M{"_id": 3, "c": 5.4, "b": "string"},
 				bson.M{"_id": 5, "c": int(6), "b": int(6)},
 			}
-			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+			So(checkOnlyHasDocuments(imp.SessionProvider, expectedDocuments), ShouldBeNil)
 		})
 		Convey("CSV import with --mode=upsert/--upsertFields with duplicate id should succeed "+
 			"if stopOnError is not set", func() {
@@ -748,7 +748,7 @@ func TestImportDocuments(t *testing.T) {
 				bson.M{"_id": 5, "b": int(6), "c": int(9)},
 				bson.M{"_id": 8, "b": int(6), "c": int(6)},
 			}
-			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+			So(checkOnlyHasDocuments(imp.SessionProvider, expectedDocuments), ShouldBeNil)
 		})
 		Convey("an error should be thrown for CSV import on test data with "+
 			"duplicate _id if --stopOnError is set", func() {
@@ -768,7 +768,7 @@ func TestImportDocuments(t *testing.T) {
 				bson.M{"_id": 3, "b": 5.4, "c": "string"},
 				bson.M{"_id": 5, "b": int(6), "c": int(6)},
 			}
-			So(checkOnlyHasDocuments(*imp.SessionProvider, expectedDocuments), ShouldBeNil)
+			So(checkOnlyHasDocuments(imp.SessionProvider, expectedDocuments), ShouldBeNil)
 		})
 		Convey("an error should be thrown for JSON import on test data that "+
 			"is a JSON array without passing --jsonArray", func() {
@@ -8,7 +8,8 @@ package mongoimport
 
 var Usage = `<options> <file>
 
-Import CSV, TSV or JSON data into MongoDB. If no file is provided, mongoimport reads from stdin.
+Import CSV, TSV, JSON or Excel (.xlsx) data into MongoDB. If no file is provided, mongoimport reads from stdin,
+or copies a collection from another deployment with --fromUri.
 
 See http://docs.mongodb.org/manual/reference/program/mongoimport/ for more information.`
 
@@ -21,10 +22,10 @@ type InputOptions struct {
 	FieldFile *string `long:"fieldFile" value-name:"<filename>" description:"file with field names - 1 per line"`
 
 	// Specifies the location and name of a file containing the data to import.
-	File string `long:"file" value-name:"<filename>" description:"file to import from; if not specified, stdin is used"`
+	File string `long:"file" value-name:"<filename>" description:"file to import from, or an s3://, gs:// or az:// URL of an object in cloud storage; if not specified, stdin is used"`
 
-	// Treats the input source's first line as field list (csv and tsv only).
-	HeaderLine bool `long:"headerline" description:"use first line in input source as the field list (CSV and TSV only)"`
+	// Treats the input source's first line as field list (csv, tsv and xlsx only).
+	HeaderLine bool `long:"headerline" description:"use first line in input source, or first non-empty row of a worksheet, as the field list (CSV, TSV and XLSX only)"`
 
 	// Indicates that the underlying input source contains a single JSON array with the documents to import.
 	JSONArray bool `long:"jsonArray" description:"treat input source as a JSON array"`
@@ -33,10 +34,22 @@ type InputOptions struct {
 	ParseGrace string `long:"parseGrace" value-name:"<grace>" default:"stop" description:"controls behavior when type coercion fails - one of: autoCast, skipField, skipRow, stop (defaults to 'stop')"`
 
 	// Specifies the file type to import. The default format is JSON, but it’s possible to import CSV and TSV files.
-	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"input format to import: json, csv, or tsv (defaults to 'json')"`
+	Type string `long:"type" value-name:"<type>" default:"json" default-mask:"-" description:"input format to import: json, csv, tsv, or xlsx (defaults to 'json')"`
+
+	// Specifies the worksheet of an Excel workbook to import.
+	Sheet string `long:"sheet" value-name:"<name>|<number>" description:"worksheet to import, by name or 1-based position (xlsx only; defaults to the first)"`
 
 	// Indicates that field names include type descriptions
-	ColumnsHaveTypes bool `long:"columnsHaveTypes" description:"indicated that the field list (from --fields, --fieldsFile, or --headerline) specifies types; They must be in the form of '<colName>.<type>(<arg>)'. The type can be one of: auto, binary, bool, date, date_go, date_ms, date_oracle, double, int32, int64, string. For each of the date types, the argument is a datetime layout string. For the binary type, the argument can be one of: base32, base64, hex. All other types take an empty argument. Only valid for CSV and TSV imports. e.g. zipcode.string(), thumbnail.binary(base64)"`
+	ColumnsHaveTypes bool `long:"columnsHaveTypes" description:"indicated that the field list (from --fields, --fieldsFile, or --headerline) specifies types; They must be in the form of '<colName>.<type>(<arg>)'. The type can be one of: auto, binary, bool, date, date_go, date_ms, date_oracle, double, int32, int64, string. For each of the date types, the argument is a datetime layout string. For the binary type, the argument can be one of: base32, base64, hex. All other types take an empty argument. Only valid for CSV, TSV and XLSX imports. e.g. zipcode.string(), thumbnail.binary(base64)"`
+
+	// Specifies a deployment to copy a collection from, instead of reading an input source.
+	FromURI string `long:"fromUri" value-name:"<mongodb-uri>" description:"copy the documents of a collection of the deployment at the given connection string instead of reading a file"`
+
+	// Specifies the namespace to copy from, with --fromUri.
+	FromNamespace string `long:"fromNs" value-name:"<database>.<collection>" description:"with --fromUri, namespace to copy from (defaults to the database of --fromUri, or --db, and --collection)"`
+
+	// Specifies a filter for the documents copied, with --fromUri.
+	Query string `long:"query" value-name:"<json>" description:"with --fromUri, query filter of the documents to copy, as a JSON string, e.g., '{x:{$gt:1}}'"`
 }
 
 // Name returns a description of the InputOptions struct.
@@ -49,8 +62,8 @@ type IngestOptions struct {
 	// Drops target collection before importing.
 	Drop bool `long:"drop" description:"drop collection before inserting documents"`
 
-	// Ignores fields with empty values in CSV and TSV imports.
-	IgnoreBlanks bool `long:"ignoreBlanks" description:"ignore fields with empty values in CSV and TSV"`
+	// Ignores fields with empty values in CSV, TSV and XLSX imports.
+	IgnoreBlanks bool `long:"ignoreBlanks" description:"ignore fields with empty values in CSV, TSV and XLSX"`
 
 	// Indicates that documents will be inserted in the order of their appearance in the input source.
 	MaintainInsertionOrder bool `long:"maintainInsertionOrder" description:"insert documents in the order of their appearance in the input source"`
@@ -0,0 +1,507 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// XLSXInputReader implements the InputReader interface for Excel workbooks.
+// The whole workbook is read before its rows are, as it is a zip archive,
+// which can't be read as a stream.
+type XLSXInputReader struct {
+	// colSpecs is a list of column specifications in the BSON documents to be imported
+	colSpecs []ColumnSpec
+
+	// in is the reader of the workbook
+	in io.Reader
+
+	// sheet is the name or 1-based position of the worksheet to import;
+	// the first one is imported if it is empty
+	sheet string
+
+	// rows are the non-empty rows of the worksheet, once it is read
+	rows [][]xlsxCell
+
+	// numProcessed tracks the number of rows processed
+	numProcessed uint64
+
+	// numDecoders is the number of concurrent goroutines to use for decoding
+	numDecoders int
+
+	// embedded sizeTracker exposes the Size() method to check the number of bytes read so far
+	sizeTracker
+
+	// ignoreBlanks is whether empty cells should be ignored
+	ignoreBlanks bool
+}
+
+// XLSXConverter implements the Converter interface for rows of Excel
+// worksheets.
+type XLSXConverter struct {
+	colSpecs     []ColumnSpec
+	cells        []xlsxCell
+	index        uint64
+	ignoreBlanks bool
+}
+
+// xlsxCell is a cell of a worksheet, with its value mapped to the BSON type
+// of its cell type and number format, and the text it holds.
+type xlsxCell struct {
+	// value is nil for empty cells
+	value interface{}
+	text  string
+}
+
+// The parts of a workbook the reader needs, as SpreadsheetML has them.
+type xlsxWorkbook struct {
+	Properties struct {
+		Date1904 bool `xml:"date1904,attr"`
+	} `xml:"workbookPr"`
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxStyleSheet struct {
+	NumFmts []struct {
+		ID   int    `xml:"numFmtId,attr"`
+		Code string `xml:"formatCode,attr"`
+	} `xml:"numFmts>numFmt"`
+	CellXfs []struct {
+		NumFmtID int `xml:"numFmtId,attr"`
+	} `xml:"cellXfs>xf"`
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxRichText `xml:"si"`
+}
+
+// xlsxRichText is text that is either plain or made of runs of formatted
+// text.
+type xlsxRichText struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+type xlsxWorksheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string       `xml:"r,attr"`
+			Type   string       `xml:"t,attr"`
+			Style  int          `xml:"s,attr"`
+			Value  string       `xml:"v"`
+			Inline xlsxRichText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// NewXLSXInputReader returns an XLSXInputReader configured to read the given
+// worksheet of the workbook from the given io.Reader, extracting only the
+// specified columns using exactly "numDecoders" goroutines.
+func NewXLSXInputReader(colSpecs []ColumnSpec, in io.Reader, sheet string, numDecoders int, ignoreBlanks bool) *XLSXInputReader {
+	szCount := newSizeTrackingReader(in)
+	return &XLSXInputReader{
+		colSpecs:     colSpecs,
+		in:           szCount,
+		sheet:        sheet,
+		numProcessed: uint64(0),
+		numDecoders:  numDecoders,
+		sizeTracker:  szCount,
+		ignoreBlanks: ignoreBlanks,
+	}
+}
+
+// ReadAndValidateHeader reads the header from the first non-empty row of the
+// worksheet and validates the header fields. It sets err if the
+// read/validation fails.
+func (r *XLSXInputReader) ReadAndValidateHeader() (err error) {
+	fields, err := r.readHeader()
+	if err != nil {
+		return err
+	}
+	r.colSpecs = ParseAutoHeaders(fields)
+	return validateReaderFields(ColumnNames(r.colSpecs))
+}
+
+// ReadAndValidateTypedHeader is the same as ReadAndValidateHeader, except it
+// also parses types from the fields of the header.
+func (r *XLSXInputReader) ReadAndValidateTypedHeader(parseGrace ParseGrace) (err error) {
+	fields, err := r.readHeader()
+	if err != nil {
+		return err
+	}
+	r.colSpecs, err = ParseTypedHeaders(fields, parseGrace)
+	if err != nil {
+		return err
+	}
+	return validateReaderFields(ColumnNames(r.colSpecs))
+}
+
+func (r *XLSXInputReader) readHeader() ([]string, error) {
+	if err := r.readSheet(); err != nil {
+		return nil, err
+	}
+	if len(r.rows) == 0 {
+		return nil, io.EOF
+	}
+	fields := make([]string, len(r.rows[0]))
+	for i, cell := range r.rows[0] {
+		fields[i] = cell.text
+	}
+	r.rows = r.rows[1:]
+	return fields, nil
+}
+
+// StreamDocument takes a boolean indicating if the documents should be streamed
+// in read order and a channel on which to stream the documents processed from
+// the rows of the worksheet. Returns a non-nil error if streaming fails.
+func (r *XLSXInputReader) StreamDocument(ordered bool, readDocs chan bson.D) (retErr error) {
+	if err := r.readSheet(); err != nil {
+		close(readDocs)
+		return err
+	}
+	rowChan := make(chan Converter, r.numDecoders)
+	go func() {
+		for _, row := range r.rows {
+			rowChan <- XLSXConverter{
+				colSpecs:     r.colSpecs,
+				cells:        row,
+				index:        r.numProcessed,
+				ignoreBlanks: r.ignoreBlanks,
+			}
+			r.numProcessed++
+		}
+		close(rowChan)
+	}()
+	return streamDocuments(ordered, r.numDecoders, rowChan, readDocs)
+}
+
+// readSheet reads the workbook and the rows of the worksheet to import, if
+// they haven't been read yet.
+func (r *XLSXInputReader) readSheet() error {
+	if r.rows != nil {
+		return nil
+	}
+	content, err := ioutil.ReadAll(r.in)
+	if err != nil {
+		return err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return fmt.Errorf("error reading workbook: %v", err)
+	}
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	workbook := xlsxWorkbook{}
+	if err = readXLSXPart(files, "xl/workbook.xml", &workbook); err != nil {
+		return err
+	}
+	relationships := xlsxRelationships{}
+	if err = readXLSXPart(files, "xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return err
+	}
+	sheetPath, err := findSheet(&workbook, &relationships, r.sheet)
+	if err != nil {
+		return err
+	}
+
+	// styles and shared strings are optional parts
+	styles := xlsxStyleSheet{}
+	sharedStrings := xlsxSharedStrings{}
+	if _, ok := files["xl/styles.xml"]; ok {
+		if err = readXLSXPart(files, "xl/styles.xml", &styles); err != nil {
+			return err
+		}
+	}
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err = readXLSXPart(files, "xl/sharedStrings.xml", &sharedStrings); err != nil {
+			return err
+		}
+	}
+	worksheet := xlsxWorksheet{}
+	if err = readXLSXPart(files, sheetPath, &worksheet); err != nil {
+		return err
+	}
+
+	dateStyles := make(map[int]bool)
+	customFormats := make(map[int]string)
+	for _, numFmt := range styles.NumFmts {
+		customFormats[numFmt.ID] = numFmt.Code
+	}
+	for i, xf := range styles.CellXfs {
+		dateStyles[i] = isDateFormat(xf.NumFmtID, customFormats[xf.NumFmtID])
+	}
+
+	r.rows = [][]xlsxCell{}
+	for _, row := range worksheet.Rows {
+		var cells []xlsxCell
+		for _, c := range row.Cells {
+			column := len(cells)
+			if c.Ref != "" {
+				if column, err = columnIndex(c.Ref); err != nil {
+					return err
+				}
+			}
+			for len(cells) < column {
+				cells = append(cells, xlsxCell{})
+			}
+			cell := xlsxCell{text: c.Value}
+			switch c.Type {
+			case "s":
+				index, err := strconv.Atoi(c.Value)
+				if err != nil || index < 0 || index >= len(sharedStrings.Items) {
+					return fmt.Errorf("cell %v refers to shared string '%v', which doesn't exist", c.Ref, c.Value)
+				}
+				cell.text = sharedStrings.Items[index].String()
+				cell.value = cell.text
+			case "inlineStr":
+				cell.text = c.Inline.String()
+				cell.value = cell.text
+			case "str", "e":
+				cell.value = c.Value
+			case "b":
+				cell.value = c.Value == "1"
+			case "d":
+				if cell.value, err = time.Parse(time.RFC3339Nano, c.Value); err != nil {
+					cell.value = c.Value
+				}
+			default:
+				if c.Value == "" {
+					break
+				}
+				cell.value = autoParse(c.Value)
+				if serial, err := strconv.ParseFloat(c.Value, 64); err == nil && dateStyles[c.Style] {
+					cell.value = excelTime(serial, workbook.Properties.Date1904)
+				}
+			}
+			cells = append(cells, cell)
+		}
+		if !isBlankRow(cells) {
+			r.rows = append(r.rows, cells)
+		}
+	}
+	log.Logvf(log.Info, "read %v rows of worksheet %v", len(r.rows), sheetPath)
+	return nil
+}
+
+// readXLSXPart unmarshals the part of a workbook at the given path.
+func readXLSXPart(files map[string]*zip.File, name string, v interface{}) error {
+	file, ok := files[name]
+	if !ok {
+		return fmt.Errorf("error reading workbook: missing %v", name)
+	}
+	part, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("error reading %v of workbook: %v", name, err)
+	}
+	defer part.Close()
+	if err = xml.NewDecoder(part).Decode(v); err != nil {
+		return fmt.Errorf("error reading %v of workbook: %v", name, err)
+	}
+	return nil
+}
+
+// findSheet returns the path of the part of the worksheet with the given
+// name or 1-based position, or of the first worksheet if sheet is empty.
+func findSheet(workbook *xlsxWorkbook, relationships *xlsxRelationships, sheet string) (string, error) {
+	if len(workbook.Sheets) == 0 {
+		return "", fmt.Errorf("workbook has no worksheets")
+	}
+	index := -1
+	for i, s := range workbook.Sheets {
+		if s.Name == sheet {
+			index = i
+			break
+		}
+	}
+	if sheet == "" {
+		index = 0
+	} else if position, err := strconv.Atoi(sheet); index == -1 && err == nil {
+		if position < 1 || position > len(workbook.Sheets) {
+			return "", fmt.Errorf("workbook has %v worksheets, not %v", len(workbook.Sheets), position)
+		}
+		index = position - 1
+	}
+	if index == -1 {
+		var names []string
+		for _, s := range workbook.Sheets {
+			names = append(names, s.Name)
+		}
+		return "", fmt.Errorf("workbook has no worksheet '%v'; its worksheets are: %v", sheet, strings.Join(names, ", "))
+	}
+	for _, relationship := range relationships.Relationships {
+		if relationship.ID != workbook.Sheets[index].ID {
+			continue
+		}
+		if strings.HasPrefix(relationship.Target, "/") {
+			return strings.TrimPrefix(relationship.Target, "/"), nil
+		}
+		return path.Join("xl", relationship.Target), nil
+	}
+	return "", fmt.Errorf("error reading workbook: no part for worksheet '%v'", workbook.Sheets[index].Name)
+}
+
+// String returns the text of the rich text, with its runs joined.
+func (t xlsxRichText) String() string {
+	if len(t.Runs) == 0 {
+		return t.Text
+	}
+	var text string
+	for _, run := range t.Runs {
+		text += run.Text
+	}
+	return text
+}
+
+// columnIndex returns the 0-based index of the column of a cell reference,
+// e.g. 27 for "AB12".
+func columnIndex(ref string) (int, error) {
+	column := 0
+	i := 0
+	for ; i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z'; i++ {
+		column = column*26 + int(ref[i]-'A'+1)
+	}
+	if i == 0 {
+		return 0, fmt.Errorf("invalid cell reference '%v'", ref)
+	}
+	return column - 1, nil
+}
+
+// isDateFormat returns whether numbers of the given number format are dates:
+// the built-in date and time formats, and custom formats with date or time
+// placeholders outside of their literal text and [] sections.
+func isDateFormat(id int, code string) bool {
+	switch {
+	case id >= 14 && id <= 22, id >= 27 && id <= 36, id >= 45 && id <= 47, id >= 50 && id <= 58:
+		return true
+	case code == "":
+		return false
+	}
+	inQuotes, inBrackets, escaped := false, false, false
+	for _, c := range strings.ToLower(code) {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && !inQuotes:
+			escaped = true
+		case c == '"':
+			inQuotes = !inQuotes
+		case inQuotes:
+		case c == '[':
+			inBrackets = true
+		case c == ']':
+			inBrackets = false
+		case inBrackets:
+		case strings.ContainsRune("dmyhs", c):
+			return true
+		}
+	}
+	return false
+}
+
+// excelTime returns the time of a date serial number, the number of days
+// since the epoch of the workbook.
+func excelTime(serial float64, date1904 bool) time.Time {
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return epoch.Add(time.Duration(math.Round(serial*24*60*60*1000)) * time.Millisecond)
+}
+
+func isBlankRow(cells []xlsxCell) bool {
+	for _, cell := range cells {
+		if cell.value != nil && cell.text != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Convert implements the Converter interface for rows of Excel worksheets.
+// Cells keep the types they have in the worksheet in auto-typed columns;
+// text cells of typed columns are parsed as their types, as is the text of
+// any cell of string columns.
+func (c XLSXConverter) Convert() (bson.D, error) {
+	document := bson.D{}
+	for index, cell := range c.cells {
+		if cell.value == nil {
+			if c.ignoreBlanks {
+				continue
+			}
+			cell.value = ""
+		}
+		if index >= len(c.colSpecs) {
+			key := "field" + strconv.Itoa(index)
+			if util.StringSliceContains(ColumnNames(c.colSpecs), key) {
+				return nil, fmt.Errorf("duplicate field name - on %v - for cell #%v ('%v') in document #%v",
+					key, index+1, cell.value, c.index)
+			}
+			document = append(document, bson.DocElem{Name: key, Value: cell.value})
+			continue
+		}
+		spec := c.colSpecs[index]
+		value := cell.value
+		_, isText := value.(string)
+		if spec.TypeName == "string" || (isText && spec.TypeName != "auto") {
+			parsedValue, err := spec.Parser.Parse(cell.text)
+			if err != nil {
+				log.Logvf(log.DebugHigh, "parse failure in document #%d for column '%s',"+
+					"could not parse cell '%s' to type %s",
+					c.index, spec.Name, cell.text, spec.TypeName)
+				switch spec.ParseGrace {
+				case pgAutoCast:
+					parsedValue = autoParse(cell.text)
+				case pgSkipField:
+					continue
+				case pgSkipRow:
+					log.Logvf(log.Always, "skipping row #%d", c.index)
+					return nil, nil
+				case pgStop:
+					return nil, fmt.Errorf("type coercion failure in document #%d for column '%s', "+
+						"could not parse cell '%s' to type %s",
+						c.index, spec.Name, cell.text, spec.TypeName)
+				}
+			}
+			value = parsedValue
+		}
+		if strings.Index(spec.Name, ".") != -1 {
+			setNestedValue(spec.Name, value, &document)
+		} else {
+			document = append(document, bson.DocElem{Name: spec.Name, Value: value})
+		}
+	}
+	return document, nil
+}
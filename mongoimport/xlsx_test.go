@@ -0,0 +1,203 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoimport
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	testWorkbook = `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Notes" sheetId="1" r:id="rId1"/><sheet name="People" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`
+	testWorkbookRels = `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+</Relationships>`
+	testStyles = `<?xml version="1.0" encoding="UTF-8"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd;@"/></numFmts>
+<cellXfs count="3"><xf numFmtId="0"/><xf numFmtId="14"/><xf numFmtId="164"/></cellXfs>
+</styleSheet>`
+	testSharedStrings = `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<si><t>name</t></si><si><t>zip</t></si><si><t>born</t></si><si><t>active</t></si><si><t>score</t></si>
+<si><r><t>Ada </t></r><r><t>Lovelace</t></r></si><si><t>00501</t></si>
+</sst>`
+	testNotesSheet = `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="inlineStr"><is><t>note</t></is></c></row>
+<row r="2"><c r="A2" t="inlineStr"><is><t>hello</t></is></c></row>
+</sheetData></worksheet>`
+	testPeopleSheet = `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="2"><c r="A2" t="s"><v>0</v></c><c r="B2" t="s"><v>1</v></c><c r="C2" t="s"><v>2</v></c><c r="D2" t="s"><v>3</v></c><c r="E2" t="s"><v>4</v></c></row>
+<row r="3"><c r="A3" t="s"><v>5</v></c><c r="B3" t="s"><v>6</v></c><c r="C3" s="1"><v>45292.5</v></c><c r="D3" t="b"><v>1</v></c><c r="E3"><v>12</v></c></row>
+<row r="4"><c r="A4" t="s"><v>5</v></c><c r="C4" s="2"><v>45293</v></c><c r="D4" t="b"><v>0</v></c><c r="E4"><v>7.25</v></c></row>
+<row r="5"><c r="A5" s="1"/></row>
+</sheetData></worksheet>`
+)
+
+// newTestWorkbook returns an Excel workbook with a sheet of notes and a
+// sheet of people, whose header row isn't the first row.
+func newTestWorkbook() *bytes.Buffer {
+	buf := &bytes.Buffer{}
+	archive := zip.NewWriter(buf)
+	for name, content := range map[string]string{
+		"xl/workbook.xml":            testWorkbook,
+		"xl/_rels/workbook.xml.rels": testWorkbookRels,
+		"xl/styles.xml":              testStyles,
+		"xl/sharedStrings.xml":       testSharedStrings,
+		"xl/worksheets/sheet1.xml":   testNotesSheet,
+		"xl/worksheets/sheet2.xml":   testPeopleSheet,
+	} {
+		w, err := archive.Create(name)
+		if err != nil {
+			panic(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+func TestXLSXStreamDocument(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an Excel workbook", t, func() {
+		docChan := make(chan bson.D, 4)
+
+		Convey("the first worksheet should be imported by default", func() {
+			r := NewXLSXInputReader(nil, newTestWorkbook(), "", 1, false)
+			So(r.ReadAndValidateHeader(), ShouldBeNil)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So(<-docChan, ShouldResemble, bson.D{{"note", "hello"}})
+		})
+
+		Convey("a worksheet should be imported by name, with the cells as their types", func() {
+			r := NewXLSXInputReader(nil, newTestWorkbook(), "People", 1, false)
+			So(r.ReadAndValidateHeader(), ShouldBeNil)
+			So(ColumnNames(r.colSpecs), ShouldResemble, []string{"name", "zip", "born", "active", "score"})
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So(<-docChan, ShouldResemble, bson.D{
+				{"name", "Ada Lovelace"},
+				{"zip", "00501"},
+				{"born", time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)},
+				{"active", true},
+				{"score", int32(12)},
+			})
+			So(<-docChan, ShouldResemble, bson.D{
+				{"name", "Ada Lovelace"},
+				{"zip", ""},
+				{"born", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+				{"active", false},
+				{"score", 7.25},
+			})
+			_, open := <-docChan
+			So(open, ShouldBeFalse)
+		})
+
+		Convey("empty cells should be left out with ignoreBlanks", func() {
+			r := NewXLSXInputReader(nil, newTestWorkbook(), "2", 1, true)
+			So(r.ReadAndValidateHeader(), ShouldBeNil)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			<-docChan
+			So(<-docChan, ShouldResemble, bson.D{
+				{"name", "Ada Lovelace"},
+				{"born", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+				{"active", false},
+				{"score", 7.25},
+			})
+		})
+
+		Convey("text cells of typed columns should be parsed as their types", func() {
+			colSpecs := []ColumnSpec{
+				{"name", new(FieldStringParser), pgAutoCast, "string"},
+				{"zip", new(FieldInt32Parser), pgAutoCast, "int32"},
+			}
+			r := NewXLSXInputReader(colSpecs, newTestWorkbook(), "People", 1, true)
+			So(r.StreamDocument(true, docChan), ShouldBeNil)
+			So((<-docChan)[:2], ShouldResemble, bson.D{{"name", "name"}, {"zip", "zip"}})
+			So((<-docChan)[:2], ShouldResemble, bson.D{{"name", "Ada Lovelace"}, {"zip", int32(501)}})
+		})
+
+		Convey("an error should be returned for a worksheet that doesn't exist", func() {
+			r := NewXLSXInputReader(nil, newTestWorkbook(), "Orders", 1, false)
+			So(r.ReadAndValidateHeader(), ShouldNotBeNil)
+			r = NewXLSXInputReader(nil, newTestWorkbook(), "3", 1, false)
+			So(r.ReadAndValidateHeader(), ShouldNotBeNil)
+		})
+
+		Convey("an error should be returned for input that isn't a workbook", func() {
+			r := NewXLSXInputReader(nil, bytes.NewBufferString("a,b,c\n"), "", 1, false)
+			So(r.StreamDocument(true, docChan), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestIsDateFormat(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Date formats should be told apart from number formats", t, func() {
+		So(isDateFormat(14, ""), ShouldBeTrue)
+		So(isDateFormat(22, ""), ShouldBeTrue)
+		So(isDateFormat(2, ""), ShouldBeFalse)
+		So(isDateFormat(164, "dd/mm/yyyy hh:mm"), ShouldBeTrue)
+		So(isDateFormat(165, `0.00" days"`), ShouldBeFalse)
+		So(isDateFormat(166, "[Red]#,##0;[Blue]0"), ShouldBeFalse)
+		So(isDateFormat(167, `\d0`), ShouldBeFalse)
+		So(isDateFormat(168, "General"), ShouldBeFalse)
+	})
+
+	Convey("Cell references should give the index of their columns", t, func() {
+		for ref, expected := range map[string]int{"A1": 0, "Z9": 25, "AA10": 26, "AB12": 27} {
+			index, err := columnIndex(ref)
+			So(err, ShouldBeNil)
+			So(index, ShouldEqual, expected)
+		}
+		_, err := columnIndex("12")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestXLSXValidateSettings(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Given a mongoimport instance importing a workbook, ", t, func() {
+		imp, err := NewMongoImport()
+		So(err, ShouldBeNil)
+		imp.InputOptions.Type = XLSX
+
+		Convey("an error should be thrown if no fields are given", func() {
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+
+		Convey("no error should be thrown with --headerline and --sheet", func() {
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.Sheet = "People"
+			So(imp.ValidateSettings([]string{}), ShouldBeNil)
+		})
+
+		Convey("an error should be thrown for --sheet with another type", func() {
+			imp.InputOptions.Type = CSV
+			imp.InputOptions.HeaderLine = true
+			imp.InputOptions.Sheet = "People"
+			So(imp.ValidateSettings([]string{}), ShouldNotBeNil)
+		})
+	})
+}
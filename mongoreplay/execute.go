@@ -12,6 +12,9 @@ import (
 	"time"
 
 	mgo "github.com/10gen/llmgo"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/throttle"
+	"github.com/mongodb/mongo-tools/common/trace"
 	"github.com/patrickmn/go-cache"
 )
 
@@ -57,6 +60,17 @@ type ExecutionContext struct {
 
 	driverOpsFiltered bool
 
+	// limiter, if set, limits the rate at which operations are played
+	// back, each counting as a document.
+	limiter *throttle.Limiter
+
+	// played, if set, counts the operations played back.
+	played progress.Updateable
+
+	// termChan, once closed, stops the playback after the operations being
+	// executed.
+	termChan <-chan struct{}
+
 	session *mgo.Session
 }
 
@@ -65,6 +79,9 @@ type ExecutionContext struct {
 type ExecutionOptions struct {
 	fullSpeed         bool
 	driverOpsFiltered bool
+	limiter           *throttle.Limiter
+	played            progress.Updateable
+	termChan          <-chan struct{}
 }
 
 // NewExecutionContext initializes a new ExecutionContext.
@@ -76,10 +93,23 @@ func NewExecutionContext(statColl *StatCollector, session *mgo.Session, options
 		StatCollector:     statColl,
 		fullSpeed:         options.fullSpeed,
 		driverOpsFiltered: options.driverOpsFiltered,
+		limiter:           options.limiter,
+		played:            options.played,
+		termChan:          options.termChan,
 		session:           session,
 	}
 }
 
+// interrupted returns true once the playback has been interrupted.
+func (context *ExecutionContext) interrupted() bool {
+	select {
+	case <-context.termChan:
+		return true
+	default:
+		return false
+	}
+}
+
 // AddFromWire adds a from-wire reply to its IncompleteReplies ReplyPair and
 // moves that ReplyPair to CompleteReplies if it's complete.  The index is based
 // on the src/dest of the recordedOp which should be the op that this ReplyOp is
@@ -185,6 +215,10 @@ func (context *ExecutionContext) newExecutionConnection(start time.Time, connect
 			userInfoLogger.Logvf(Info, "(Connection %v) New Connection FAILED: %v", connectionNum, err)
 		}
 		for recordedOp := range ch {
+			if context.interrupted() {
+				// drop the ops queued behind the ones being executed
+				continue
+			}
 			var parsedOp Op
 			var reply Replyable
 			var err error
@@ -197,11 +231,22 @@ func (context *ExecutionContext) newExecutionConnection(start time.Time, connect
 
 				if !context.fullSpeed && recordedOp.RawOp.Header.OpCode != OpCodeReply {
 					if t.Before(recordedOp.PlayAt.Time) {
-						time.Sleep(recordedOp.PlayAt.Sub(t))
+						select {
+						case <-time.After(recordedOp.PlayAt.Sub(t)):
+						case <-context.termChan:
+							continue
+						}
 					}
 				}
 				userInfoLogger.Logvf(DebugHigh, "(Connection %v) op %v", connectionNum, recordedOp.String())
+				context.limiter.Wait(1, int(recordedOp.RawOp.Header.MessageLength))
+				span := trace.Start("replay op")
+				span.SetAttribute("op.code", recordedOp.RawOp.Header.OpCode.String())
+				span.SetAttribute("connection", connectionNum)
+				executed := time.Now()
 				parsedOp, reply, err = context.Execute(recordedOp, socket)
+				context.limiter.Observe(time.Since(executed))
+				span.End(err)
 				if err != nil {
 					toolDebugLogger.Logvf(Always, "context.Execute error: %v", err)
 				}
@@ -217,6 +262,9 @@ func (context *ExecutionContext) newExecutionConnection(start time.Time, connect
 			if shouldCollectOp(parsedOp, context.driverOpsFiltered) {
 				context.Collect(recordedOp, parsedOp, reply, msg)
 			}
+			if context.played != nil {
+				context.played.Inc(1)
+			}
 		}
 		userInfoLogger.Logvf(Info, "(Connection %v) Connection ENDED.", connectionNum)
 		context.ConnectionChansWaitGroup.Done()
@@ -0,0 +1,302 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoreplay
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	mgo "github.com/10gen/llmgo"
+	"github.com/10gen/llmgo/bson"
+	"github.com/mongodb/mongo-tools/common/text"
+)
+
+// IndexLister returns the keys of the indexes of a namespace, each as its
+// field names in order.
+type IndexLister func(ns string) ([][]string, error)
+
+// rangeOperators are the query operators matching ranges of values, whose
+// fields come last in the indexes suggested for them.
+var rangeOperators = map[string]bool{
+	"$gt":     true,
+	"$gte":    true,
+	"$lt":     true,
+	"$lte":    true,
+	"$ne":     true,
+	"$nin":    true,
+	"$exists": true,
+	"$regex":  true,
+	"$type":   true,
+}
+
+// unindexedShape is a shape of queries that no index of their namespace
+// supports.
+type unindexedShape struct {
+	*shapeSummary
+	// Suggested is the key of an index that would support the queries
+	Suggested string
+	// score ranks the shape by its frequency times its latency
+	score int64
+}
+
+// queryFields are the fields a query filters and sorts on, in the order an
+// index supporting it would have them: equality matches, then sorts, then
+// ranges.
+type queryFields struct {
+	Equality []string
+	Sort     []string
+	Range    []string
+}
+
+// ListIndexesWithSession returns an IndexLister listing indexes with the
+// session.
+func ListIndexesWithSession(session *mgo.Session) IndexLister {
+	return func(ns string) ([][]string, error) {
+		dot := strings.Index(ns, ".")
+		indexes, err := session.DB(ns[:dot]).C(ns[dot+1:]).Indexes()
+		if err != nil {
+			return nil, err
+		}
+		keys := make([][]string, len(indexes))
+		for i, index := range indexes {
+			for _, field := range index.Key {
+				// fields are given as "-field" for descending order and
+				// "$type:field" for special types of indexes
+				field = strings.TrimPrefix(field, "-")
+				if colon := strings.Index(field, ":"); strings.HasPrefix(field, "$") && colon >= 0 {
+					field = field[colon+1:]
+				}
+				keys[i] = append(keys[i], field)
+			}
+		}
+		return keys, nil
+	}
+}
+
+// unindexedShapes returns the shapes of queries that no index of their
+// namespace supports, as no index starts with a field they filter or sort
+// on, with the index suggested for each. They are ranked by their frequency
+// times their average latency, or their frequency if no latency was seen.
+func (summarizer *WorkloadSummarizer) unindexedShapes() []unindexedShape {
+	indexesByNs := make(map[string][][]string)
+	var unindexed []unindexedShape
+	for _, shape := range summarizer.sortedShapes() {
+		if !strings.Contains(shape.Ns, ".") {
+			continue
+		}
+		fields := queryFieldsOf(shape.Op, shape.doc)
+		if fields == nil {
+			continue
+		}
+		indexes, ok := indexesByNs[shape.Ns]
+		if !ok {
+			var err error
+			indexes, err = summarizer.IndexLister(shape.Ns)
+			if err != nil {
+				toolDebugLogger.Logvf(Info, "can't list the indexes of %v: %v", shape.Ns, err)
+			}
+			indexesByNs[shape.Ns] = indexes
+		}
+		if fields.supportedBy(indexes) {
+			continue
+		}
+		score := int64(shape.Count)
+		if len(shape.Latencies) > 0 {
+			score *= totalMicros(shape.Latencies) / int64(len(shape.Latencies))
+		}
+		unindexed = append(unindexed, unindexedShape{
+			shapeSummary: shape,
+			Suggested:    fields.suggestedIndex(),
+			score:        score,
+		})
+	}
+	sort.Stable(byScore(unindexed))
+	return unindexed
+}
+
+// writeUnindexedShapes writes the shapes no index supports in the given
+// format.
+func (summarizer *WorkloadSummarizer) writeUnindexedShapes(w io.Writer, format string, limit int) error {
+	unindexed := summarizer.unindexedShapes()
+	if limit > 0 && limit < len(unindexed) {
+		unindexed = unindexed[:limit]
+	}
+	table := text.NewTable("count", "avg", "op", "ns", "suggested index", "shape")
+	for i := 2; i < len(table.Columns); i++ {
+		table.Columns[i].Align = text.AlignLeft
+	}
+	table.Padding = 2
+	for _, shape := range unindexed {
+		avg := ""
+		if len(shape.Latencies) > 0 {
+			avg = formatMicros(totalMicros(shape.Latencies) / int64(len(shape.Latencies)))
+		}
+		table.AddRow(fmt.Sprint(shape.Count), avg, shape.Op, shape.Ns, shape.Suggested, shape.Shape)
+	}
+	return table.Write(w, format)
+}
+
+// queryFieldsOf returns the fields a query of the given shape filters and
+// sorts on, or nil if the op isn't a query or doesn't filter or sort.
+func queryFieldsOf(op string, shape bson.D) *queryFields {
+	var filter, orderBy interface{}
+	switch op {
+	case "find":
+		filter, _ = FindValueByKey("filter", &shape)
+		orderBy, _ = FindValueByKey("sort", &shape)
+	case "query":
+		// legacy queries wrap their filter when they have modifiers
+		filter = shape
+		for _, wrapper := range []string{"$query", "query"} {
+			if query, ok := FindValueByKey(wrapper, &shape); ok {
+				filter = query
+				orderBy, _ = FindValueByKey("$orderby", &shape)
+				if orderBy == nil {
+					orderBy, _ = FindValueByKey("orderby", &shape)
+				}
+				break
+			}
+		}
+	case "count", "distinct", "findAndModify", "findandmodify":
+		filter, _ = FindValueByKey("query", &shape)
+		orderBy, _ = FindValueByKey("sort", &shape)
+	case "update", "delete":
+		// the shapes of update and delete commands keep their first statement
+		for _, statements := range []string{"updates", "deletes"} {
+			if value, ok := FindValueByKey(statements, &shape); ok {
+				if list, ok := value.([]interface{}); ok && len(list) > 0 {
+					if statement, ok := list[0].(bson.D); ok {
+						filter, _ = FindValueByKey("q", &statement)
+					}
+				}
+			}
+		}
+		if op == "update" && filter == nil {
+			filter, _ = FindValueByKey("q", &shape)
+		}
+	case "remove":
+		filter = shape
+	case "aggregate":
+		pipeline, _ := FindValueByKey("pipeline", &shape)
+		if stages, ok := pipeline.([]interface{}); ok && len(stages) > 0 {
+			if stage, ok := stages[0].(bson.D); ok {
+				filter, _ = FindValueByKey("$match", &stage)
+			}
+		}
+	default:
+		return nil
+	}
+
+	fields := &queryFields{}
+	if doc, ok := filter.(bson.D); ok {
+		fields.addFilter(doc)
+	}
+	if doc, ok := orderBy.(bson.D); ok {
+		for _, elem := range doc {
+			fields.Sort = appendField(fields.Sort, elem.Name)
+		}
+	}
+	if len(fields.Equality)+len(fields.Sort)+len(fields.Range) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// addFilter adds the fields of a filter, and of the filters it combines with
+// $and, $or and $nor.
+func (fields *queryFields) addFilter(filter bson.D) {
+	for _, elem := range filter {
+		switch {
+		case logicalOperators[elem.Name]:
+			if clauses, ok := elem.Value.([]interface{}); ok {
+				for _, clause := range clauses {
+					if doc, ok := clause.(bson.D); ok {
+						fields.addFilter(doc)
+					}
+				}
+			}
+		case strings.HasPrefix(elem.Name, "$"):
+			// $text, $where and $expr don't filter on fields of their own
+		case isRangeMatch(elem.Value):
+			fields.Range = appendField(fields.Range, elem.Name)
+		default:
+			fields.Equality = appendField(fields.Equality, elem.Name)
+		}
+	}
+}
+
+// isRangeMatch returns whether the shape of the value a field is matched
+// with has a range operator.
+func isRangeMatch(value interface{}) bool {
+	doc, ok := value.(bson.D)
+	if !ok {
+		return false
+	}
+	for _, elem := range doc {
+		if rangeOperators[elem.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// supportedBy returns whether any of the indexes starts with one of the
+// fields.
+func (fields *queryFields) supportedBy(indexes [][]string) bool {
+	for _, key := range indexes {
+		if len(key) == 0 {
+			continue
+		}
+		for _, list := range [][]string{fields.Equality, fields.Sort, fields.Range} {
+			for _, field := range list {
+				if key[0] == field {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// suggestedIndex returns the key of an index supporting the query, with
+// equality matches first, then sorts, then ranges.
+func (fields *queryFields) suggestedIndex() string {
+	var key []string
+	for _, list := range [][]string{fields.Equality, fields.Sort, fields.Range} {
+		for _, field := range list {
+			if !containsField(key, field) {
+				key = append(key, field)
+			}
+		}
+	}
+	return "{" + strings.Join(key, ": 1, ") + ": 1}"
+}
+
+func appendField(fields []string, field string) []string {
+	if containsField(fields, field) {
+		return fields
+	}
+	return append(fields, field)
+}
+
+func containsField(fields []string, field string) bool {
+	for _, f := range fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// byScore sorts unindexed shapes by their scores.
+type byScore []unindexedShape
+
+func (s byScore) Len() int           { return len(s) }
+func (s byScore) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byScore) Less(i, j int) bool { return s[i].score > s[j].score }
@@ -0,0 +1,106 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoreplay
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/10gen/llmgo/bson"
+	"github.com/mongodb/mongo-tools/common/testtype"
+)
+
+func TestQueryFields(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.MongoReplayTestType)
+
+	cases := []struct {
+		op       string
+		command  bson.D
+		expected *queryFields
+	}{
+		{"find", bson.D{{"find", "c"}, {"filter", bson.D{{"b", bson.D{{"$gt", 1}}}, {"a", 1}}}, {"sort", bson.D{{"s", 1}}}},
+			&queryFields{Equality: []string{"a"}, Sort: []string{"s"}, Range: []string{"b"}}},
+		{"count", bson.D{{"count", "c"}, {"query", bson.D{{"$or", []interface{}{bson.D{{"x", 1}}, bson.D{{"y", bson.D{{"$in", []interface{}{1}}}}}}}}}},
+			&queryFields{Equality: []string{"x", "y"}}},
+		{"delete", bson.D{{"delete", "c"}, {"deletes", []interface{}{bson.D{{"q", bson.D{{"d", 1}}}, {"limit", 1}}}}},
+			&queryFields{Equality: []string{"d"}}},
+		{"aggregate", bson.D{{"aggregate", "c"}, {"pipeline", []interface{}{bson.D{{"$match", bson.D{{"m", bson.D{{"$lte", 2}}}}}}}}},
+			&queryFields{Range: []string{"m"}}},
+		{"find", bson.D{{"find", "c"}, {"filter", bson.D{}}}, nil},
+		{"insert", bson.D{{"insert", "c"}, {"documents", []interface{}{bson.D{{"a", 1}}}}}, nil},
+	}
+	for _, c := range cases {
+		_, _, shape := commandShape("db", c.command)
+		fields := queryFieldsOf(c.op, shape)
+		if !reflect.DeepEqual(fields, c.expected) {
+			t.Errorf("expected fields %#v of %v, got %#v", c.expected, c.command, fields)
+		}
+	}
+
+	legacy := shapeOfDocument(bson.D{{"$query", bson.D{{"q", 1}}}, {"$orderby", bson.D{{"o", -1}}}}, false)
+	fields := queryFieldsOf("query", legacy)
+	if !reflect.DeepEqual(fields, &queryFields{Equality: []string{"q"}, Sort: []string{"o"}}) {
+		t.Errorf("unexpected fields of a legacy query with modifiers %#v", fields)
+	}
+	if index := fields.suggestedIndex(); index != "{q: 1, o: 1}" {
+		t.Errorf("expected the suggested index {q: 1, o: 1}, got %v", index)
+	}
+}
+
+func TestUnindexedShapes(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.MongoReplayTestType)
+
+	generator := newRecordedOpGenerator()
+	requests := []bson.D{
+		{{"a", 1}, {"b", bson.D{{"$gt", 3}}}},
+		{{"a", 2}, {"b", bson.D{{"$gt", 4}}}},
+		{{"indexed", 1}},
+		{},
+	}
+	for i, filter := range requests {
+		if err := generator.generateMsgOpFind(filter, 0, int32(i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(generator.opChan)
+
+	summarizer := NewWorkloadSummarizer()
+	var listed []string
+	summarizer.IndexLister = func(ns string) ([][]string, error) {
+		listed = append(listed, ns)
+		return [][]string{{"_id"}, {"indexed", "other"}}, nil
+	}
+	for op := range generator.opChan {
+		parsedOp, err := op.RawOp.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		summarizer.Add(op, parsedOp)
+	}
+
+	unindexed := summarizer.unindexedShapes()
+	if len(unindexed) != 1 {
+		t.Fatalf("expected 1 unindexed shape, got %v: %#v", len(unindexed), unindexed)
+	}
+	if unindexed[0].Count != 2 || unindexed[0].Suggested != "{a: 1, b: 1}" {
+		t.Errorf("unexpected unindexed shape %#v", unindexed[0])
+	}
+	if len(listed) != 1 || listed[0] != "mongoreplay.test" {
+		t.Errorf("expected the indexes of mongoreplay.test to be listed once, got %v", listed)
+	}
+
+	out := &bytes.Buffer{}
+	if err := summarizer.WriteReport(out, "csv", 0); err != nil {
+		t.Fatal(err)
+	}
+	report := out.String()
+	if !strings.Contains(report, "suggested index") || !strings.Contains(report, "{a: 1, b: 1}") || strings.Contains(report, "p95") {
+		t.Errorf("expected only the unindexed shapes in the report:\n%v", report)
+	}
+}
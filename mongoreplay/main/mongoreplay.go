@@ -8,7 +8,9 @@ package main
 
 import (
 	"github.com/jessevdk/go-flags"
+	"github.com/mongodb/mongo-tools/common/failure"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongoreplay"
 
 	"fmt"
@@ -16,29 +18,22 @@ import (
 	"runtime"
 )
 
-const (
-	ExitOk       = 0
-	ExitError    = 1
-	ExitNonFatal = 3
-	// Go reserves exit code 2 for its own use
-)
-
 func main() {
 	versionOpts := mongoreplay.VersionOptions{}
 	versionFlagParser := flags.NewParser(&versionOpts, flags.Default)
 	versionFlagParser.Options = flags.IgnoreUnknown
 	_, err := versionFlagParser.Parse()
 	if err != nil {
-		os.Exit(ExitError)
+		os.Exit(util.ExitError)
 	}
 
 	if versionOpts.PrintVersion() {
-		os.Exit(ExitOk)
+		os.Exit(util.ExitClean)
 	}
 
 	if runtime.NumCPU() == 1 {
 		fmt.Fprint(os.Stderr, "mongoreplay must be run with multiple threads")
-		os.Exit(ExitError)
+		os.Exit(util.ExitError)
 	}
 
 	opts := mongoreplay.Options{}
@@ -57,6 +52,10 @@ func main() {
 			panic(err)
 		}
 	}
+	playCmd.ThrottleOpts = &options.Throttle{}
+	if _, err = playCmdParser.AddGroup("throttle", "", playCmd.ThrottleOpts); err != nil {
+		panic(err)
+	}
 
 	_, err = parser.AddCommand("record", "Convert network traffic into mongodb queries", "",
 		&mongoreplay.RecordCommand{GlobalOpts: &opts})
@@ -70,6 +69,19 @@ func main() {
 		panic(err)
 	}
 
+	summarizeCmd := &mongoreplay.SummarizeCommand{GlobalOpts: &opts}
+	summarizeCmdParser, err := parser.AddCommand("summarize", "Summarize the workload of captured traffic by query shape", "", summarizeCmd)
+	if err != nil {
+		panic(err)
+	}
+	if options.BuiltWithSSL {
+		summarizeCmd.SSLOpts = &options.SSL{}
+		_, err := summarizeCmdParser.AddGroup("ssl", "", summarizeCmd.SSLOpts)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	_, err = parser.AddCommand("filter", "Filter playback file", "",
 		&mongoreplay.FilterCommand{GlobalOpts: &opts})
 	if err != nil {
@@ -79,11 +91,12 @@ func main() {
 	_, err = parser.Parse()
 
 	if err != nil {
-		switch err.(type) {
-		case mongoreplay.ErrPacketsDropped:
-			os.Exit(ExitNonFatal)
-		default:
-			os.Exit(ExitError)
+		if flagsErr, ok := err.(*flags.Error); ok {
+			if flagsErr.Type == flags.ErrHelp {
+				os.Exit(util.ExitClean)
+			}
+			os.Exit(util.ExitBadOptions)
 		}
+		os.Exit(failure.ExitCode(err))
 	}
 }
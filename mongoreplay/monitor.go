@@ -20,7 +20,7 @@ type MonitorCommand struct {
 	GlobalOpts *Options `no-flag:"true"`
 	StatOptions
 	OpStreamSettings
-	Collect      string `long:"collect" description:"Stat collection format; 'format' option uses the --format string" choice:"json" choice:"format" choice:"none" default:"format"`
+	Collect      string `long:"collect" description:"Stat collection format; 'format' option uses the --format string, 'text' and 'csv' write a table" choice:"json" choice:"format" choice:"text" choice:"csv" choice:"none" default:"format"`
 	PairedMode   bool   `long:"paired" description:"Output only one line for a request/reply pair"`
 	Gzip         bool   `long:"gzip" description:"decompress gzipped input"`
 	PlaybackFile string `short:"p" description:"path to playback file to read from" long:"playback-file"`
@@ -97,40 +97,9 @@ func (monitor *MonitorCommand) Execute(args []string) error {
 	monitor.GlobalOpts.SetLogging()
 	monitor.ValidateParams(args)
 
-	var opChan <-chan *RecordedOp
-	var errChan <-chan error
-	if monitor.PlaybackFile != "" {
-		playbackFileReader, err := NewPlaybackFileReader(monitor.PlaybackFile, monitor.Gzip)
-		if err != nil {
-			return err
-		}
-		opChan, errChan = playbackFileReader.OpChan(1)
-
-	} else {
-		ctx, err := getOpstream(monitor.OpStreamSettings)
-		if err != nil {
-			return err
-		}
-		opChan = ctx.mongoOpStream.Ops
-		e := make(chan error)
-		errChan = e
-		go func() {
-			defer close(e)
-			if err := ctx.packetHandler.Handle(ctx.mongoOpStream, -1); err != nil {
-				e <- fmt.Errorf("monitor: error handling packet stream: %s", err)
-			}
-		}()
-		// When a signal is received to kill the process, stop the packet
-		// handler so we gracefully flush all ops being processed before
-		// exiting.
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
-		go func() {
-			// Block until a signal is received.
-			s := <-sigChan
-			toolDebugLogger.Logvf(Info, "Got signal %v, closing PCAP handle", s)
-			ctx.packetHandler.Close()
-		}()
+	opChan, errChan, err := openOpInput(monitor.OpStreamSettings, monitor.PlaybackFile, monitor.Gzip, "monitor")
+	if err != nil {
+		return err
 	}
 	statColl, err := newStatCollector(monitor.StatOptions, monitor.Collect, monitor.PairedMode, false)
 	if err != nil {
@@ -152,25 +121,71 @@ func (monitor *MonitorCommand) Execute(args []string) error {
 	return nil
 }
 
+// openOpInput returns the ops read from a playback file, or captured from a
+// pcap file or a network interface, along with a channel on which the error
+// ending them is sent. Capturing stops on SIGTERM, SIGINT and SIGHUP, once
+// the ops being processed are flushed.
+func openOpInput(settings OpStreamSettings, playbackFile string, gzip bool, command string) (<-chan *RecordedOp, <-chan error, error) {
+	if playbackFile != "" {
+		playbackFileReader, err := NewPlaybackFileReader(playbackFile, gzip)
+		if err != nil {
+			return nil, nil, err
+		}
+		opChan, errChan := playbackFileReader.OpChan(1)
+		return opChan, errChan, nil
+	}
+
+	ctx, err := getOpstream(settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	e := make(chan error)
+	go func() {
+		defer close(e)
+		if err := ctx.packetHandler.Handle(ctx.mongoOpStream, -1); err != nil {
+			e <- fmt.Errorf("%v: error handling packet stream: %s", command, err)
+		}
+	}()
+	// When a signal is received to kill the process, stop the packet
+	// handler so we gracefully flush all ops being processed before
+	// exiting.
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	go func() {
+		// Block until a signal is received.
+		s := <-sigChan
+		toolDebugLogger.Logvf(Info, "Got signal %v, closing PCAP handle", s)
+		ctx.packetHandler.Close()
+	}()
+	return ctx.mongoOpStream.Ops, e, nil
+}
+
 // ValidateParams validates the settings described in the MonitorCommand struct.
 func (monitor *MonitorCommand) ValidateParams(args []string) error {
+	return validateOpInput(&monitor.OpStreamSettings, monitor.PlaybackFile, monitor.Gzip, args)
+}
+
+// validateOpInput checks that exactly one input is given for ops: a pcap
+// file, a network interface or a playback file. It sets the default size of
+// the packet buffer for the input.
+func validateOpInput(settings *OpStreamSettings, playbackFile string, gzip bool, args []string) error {
 	numInputTypes := 0
 
-	if monitor.PcapFile != "" {
-		if monitor.Gzip {
+	if settings.PcapFile != "" {
+		if gzip {
 			return fmt.Errorf("incompatible options: pcap file and gzip")
 		}
 		numInputTypes++
 	}
-	if monitor.NetworkInterface != "" {
-		if monitor.Gzip {
+	if settings.NetworkInterface != "" {
+		if gzip {
 			return fmt.Errorf("incompatible options: network interface and gzip")
 		}
 		numInputTypes++
 	}
-	if monitor.PlaybackFile != "" {
+	if playbackFile != "" {
 		numInputTypes++
-		if monitor.Expression != "" {
+		if settings.Expression != "" {
 			return fmt.Errorf("incompatible options: tape file with a filter expression")
 		}
 	}
@@ -183,12 +198,12 @@ func (monitor *MonitorCommand) ValidateParams(args []string) error {
 		return fmt.Errorf("must not specify more than one input")
 	}
 
-	if monitor.OpStreamSettings.PacketBufSize == 0 {
+	if settings.PacketBufSize == 0 {
 		// default heap size
-		if monitor.OpStreamSettings.NetworkInterface != "" {
-			monitor.OpStreamSettings.PacketBufSize = 1
+		if settings.NetworkInterface != "" {
+			settings.PacketBufSize = 1
 		} else {
-			monitor.OpStreamSettings.PacketBufSize = 1000
+			settings.PacketBufSize = 1000
 		}
 	}
 
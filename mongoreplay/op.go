@@ -114,7 +114,12 @@ func IsDriverOp(op Op) bool {
 	default:
 		return false
 	}
+	return isDriverCommand(commandType)
+}
 
+// isDriverCommand returns whether the command is one drivers run for
+// themselves, to monitor servers and authenticate.
+func isDriverCommand(commandType string) bool {
 	switch commandType {
 	case "isMaster", "ismaster":
 		return true
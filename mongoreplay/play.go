@@ -12,8 +12,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/failure"
 	"github.com/mongodb/mongo-tools/common/lldb"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/signals"
+	"github.com/mongodb/mongo-tools/common/throttle"
+	"github.com/mongodb/mongo-tools/common/trace"
+	"github.com/mongodb/mongo-tools/common/util"
 )
 
 // PlayCommand stores settings for the mongoreplay 'play' subcommand
@@ -27,9 +33,21 @@ type PlayCommand struct {
 	QueueTime    int          `long:"queueTime" description:"don't queue ops much further in the future than this number of seconds" default:"15"`
 	NoPreprocess bool         `long:"no-preprocess" description:"don't preprocess the input file to premap data such as mongo cursorIDs"`
 	Gzip         bool         `long:"gzip" description:"decompress gzipped input"`
-	Collect      string       `long:"collect" description:"Stat collection format; 'format' option uses the --format string" choice:"json" choice:"format" choice:"none" default:"none"`
+	Collect      string       `long:"collect" description:"Stat collection format; 'format' option uses the --format string, 'text' and 'csv' write a table" choice:"json" choice:"format" choice:"text" choice:"csv" choice:"none" default:"none"`
 	FullSpeed    bool         `long:"fullSpeed" description:"run the playback as fast as possible"`
+	OTelEndpoint string       `long:"otelEndpoint" value-name:"<url>" description:"OTLP/HTTP endpoint of an OpenTelemetry collector to export trace spans of the playback to"`
 	SSLOpts      *options.SSL `no-flag:"true"`
+	// ThrottleOpts limit the rate of playback on top of its speed, with
+	// each operation counting as a document.
+	ThrottleOpts *options.Throttle `no-flag:"true"`
+
+	// ProgressFD and ProgressSocket stream the count of ops played back as
+	// progress events, as the other tools do with their documents and bytes.
+	ProgressFD     int    `long:"progressFD" value-name:"<fd>" description:"file descriptor to write progress events to, as one JSON object per line"`
+	ProgressSocket string `long:"progressSocket" value-name:"<path>" description:"Unix socket to write progress events to, as one JSON object per line"`
+
+	// termChan is closed by HandleInterrupt to stop the playback.
+	termChan chan struct{}
 }
 
 const queueGranularity = 1000
@@ -48,13 +66,39 @@ func (play *PlayCommand) ValidateParams(args []string) error {
 }
 
 // Execute runs the program for the 'play' subcommand
-func (play *PlayCommand) Execute(args []string) error {
-	err := play.ValidateParams(args)
+func (play *PlayCommand) Execute(args []string) (err error) {
+	err = play.ValidateParams(args)
 	if err != nil {
 		return err
 	}
 	play.GlobalOpts.SetLogging()
 
+	if err = trace.Init(play.OTelEndpoint, "mongoreplay"); err != nil {
+		return err
+	}
+	defer func() { trace.Shutdown(err) }()
+
+	eventWriter, err := progress.OpenEventWriter(play.ProgressFD, play.ProgressSocket, "mongoreplay", progress.DefaultWaitTime, false)
+	if err != nil {
+		return failure.New(failure.User, err)
+	}
+	if eventWriter != nil {
+		eventWriter.SetUnit("ops")
+		eventWriter.Start()
+		defer func() {
+			if err != nil {
+				eventWriter.StopWithError(err)
+			} else {
+				eventWriter.Stop()
+			}
+		}()
+	}
+
+	limiter, err := throttle.FromOptions(play.ThrottleOpts)
+	if err != nil {
+		return err
+	}
+
 	statColl, err := newStatCollector(play.StatOptions, play.Collect, true, true)
 	if err != nil {
 		return err
@@ -71,22 +115,7 @@ func (play *PlayCommand) Execute(args []string) error {
 		return err
 	}
 
-	// Reparse given host via ToolOptions so we can use a SessionProvider
-	// for the llmgo session.
-	toolOpts := options.New("", "", options.EnabledOptions{Connection: true, URI: true, Auth: true})
-	// SSL options must be non-nil before parsing to enable parsing ssl;
-	// play.SSLopts will be nil if SSL is not enabled
-	toolOpts.SSL = play.SSLOpts
-	if !(strings.HasPrefix(play.URL, "mongodb://") || strings.HasPrefix(play.URL, "mongodb+srv://")) {
-		play.URL = fmt.Sprintf("mongodb://%s", play.URL)
-	}
-	_, err = toolOpts.ParseArgs([]string{"--uri", play.URL})
-
-	if err != nil {
-		return err
-	}
-
-	sp, err := lldb.NewSessionProvider(*toolOpts)
+	sp, err := newSessionProvider(play.URL, play.SSLOpts)
 	if err != nil {
 		return err
 	}
@@ -98,8 +127,14 @@ func (play *PlayCommand) Execute(args []string) error {
 	}
 	session.SetSocketTimeout(0)
 
+	play.termChan = make(chan struct{})
+	finishedChan := signals.HandleWithInterrupt(play.HandleInterrupt)
+	defer close(finishedChan)
+
+	played := progress.NewCounter(0)
 	context := NewExecutionContext(statColl, session, &ExecutionOptions{fullSpeed: play.FullSpeed,
-		driverOpsFiltered: playbackFileReader.metadata.DriverOpsFiltered})
+		driverOpsFiltered: playbackFileReader.metadata.DriverOpsFiltered, limiter: limiter, played: played,
+		termChan: play.termChan})
 
 	session.SetPoolLimit(-1)
 
@@ -129,8 +164,19 @@ func (play *PlayCommand) Execute(args []string) error {
 
 	opChan, errChan = playbackFileReader.OpChan(play.Repeat)
 
-	if err := Play(context, opChan, play.Speed, play.Repeat, play.QueueTime); err != nil {
-		userInfoLogger.Logvf(Always, "Play: %v\n", err)
+	if eventWriter != nil {
+		eventWriter.Attach(play.PlaybackFile, played)
+	}
+	playErr := Play(context, opChan, play.Speed, play.Repeat, play.QueueTime)
+	if eventWriter != nil {
+		progress.Finish(eventWriter, play.PlaybackFile, playErr)
+	}
+	if playErr == util.ErrTerminated {
+		// the ops left in the file are never read
+		return playErr
+	}
+	if playErr != nil {
+		userInfoLogger.Logvf(Always, "Play: %v\n", playErr)
 	}
 
 	//handle the error from the errchan
@@ -141,7 +187,16 @@ func (play *PlayCommand) Execute(args []string) error {
 	return nil
 }
 
+// HandleInterrupt stops the playback: no more ops are read, the ones being
+// executed finish, and Execute then returns util.ErrTerminated.
+func (play *PlayCommand) HandleInterrupt() {
+	if play.termChan != nil {
+		close(play.termChan)
+	}
+}
+
 // Play is responsible for playing ops from a RecordedOp channel to the session.
+// It returns util.ErrTerminated if the context's playback is interrupted.
 func Play(context *ExecutionContext,
 	opChan <-chan *RecordedOp,
 	speed float64,
@@ -153,6 +208,9 @@ func Play(context *ExecutionContext,
 	var connectionID int64
 	var opCounter int
 	for op := range opChan {
+		if context.interrupted() {
+			break
+		}
 		opCounter++
 		if op.Seen.IsZero() {
 			return fmt.Errorf("Can't play operation found with zero-timestamp: %#v", op)
@@ -182,7 +240,10 @@ func Play(context *ExecutionContext,
 		if !context.fullSpeed {
 			if opCounter%queueGranularity == 0 {
 				toolDebugLogger.Logvf(DebugHigh, "Waiting to prevent excess buffering with opCounter: %v", opCounter)
-				time.Sleep(op.PlayAt.Add(time.Duration(-queueTime) * time.Second).Sub(time.Now()))
+				select {
+				case <-time.After(op.PlayAt.Add(time.Duration(-queueTime) * time.Second).Sub(time.Now())):
+				case <-context.termChan:
+				}
 			}
 		}
 
@@ -212,5 +273,27 @@ func Play(context *ExecutionContext,
 	if repeat > 1 {
 		toolDebugLogger.Logvf(Always, "%v ops per generation for %v generations", opCounter/repeat, repeat)
 	}
+	if context.interrupted() {
+		return util.ErrTerminated
+	}
 	return nil
 }
+
+// newSessionProvider returns a SessionProvider for the llmgo sessions of the
+// host, given as a connection string or as host:port. The SSL options are nil
+// when the tool isn't built with SSL support.
+func newSessionProvider(url string, sslOpts *options.SSL) (*lldb.SessionProvider, error) {
+	// Reparse given host via ToolOptions so we can use a SessionProvider
+	// for the llmgo session.
+	toolOpts := options.New("", "", options.EnabledOptions{Connection: true, URI: true, Auth: true})
+	// SSL options must be non-nil before parsing to enable parsing ssl
+	toolOpts.SSL = sslOpts
+	if !(strings.HasPrefix(url, "mongodb://") || strings.HasPrefix(url, "mongodb+srv://")) {
+		url = fmt.Sprintf("mongodb://%s", url)
+	}
+	_, err := toolOpts.ParseArgs([]string{"--uri", url})
+	if err != nil {
+		return nil, err
+	}
+	return lldb.NewSessionProvider(*toolOpts)
+}
@@ -12,7 +12,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/common/util"
 )
 
 func TestRepeatGeneration(t *testing.T) {
@@ -131,3 +133,22 @@ func TestPlayOpEOF(t *testing.T) {
 		t.Errorf("should have eof at end, but got %v", err)
 	}
 }
+
+func TestPlayInterrupted(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.MongoReplayTestType)
+	termChan := make(chan struct{})
+	close(termChan)
+	played := progress.NewCounter(0)
+	context := NewExecutionContext(&StatCollector{}, nil, &ExecutionOptions{played: played, termChan: termChan})
+
+	opChan := make(chan *RecordedOp, 1)
+	opChan <- &RecordedOp{Seen: &PreciseTime{time.Now()}}
+	close(opChan)
+	err := Play(context, opChan, 1.0, 1, 15)
+	if err != util.ErrTerminated {
+		t.Errorf("interrupted playback should return %v, got %v", util.ErrTerminated, err)
+	}
+	if done, _ := played.Progress(); done != 0 {
+		t.Errorf("interrupted playback should play no ops, played %v", done)
+	}
+}
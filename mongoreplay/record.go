@@ -8,11 +8,11 @@ package mongoreplay
 
 import (
 	"fmt"
-	"os"
-	"os/signal"
-	"syscall"
 
 	"github.com/google/gopacket/pcap"
+	"github.com/mongodb/mongo-tools/common/failure"
+	"github.com/mongodb/mongo-tools/common/signals"
+	"github.com/mongodb/mongo-tools/common/util"
 )
 
 // RecordCommand stores settings for the mongoreplay 'record' subcommand
@@ -22,6 +22,9 @@ type RecordCommand struct {
 	Gzip         bool   `long:"gzip" description:"compress output file with Gzip"`
 	FullReplies  bool   `long:"full-replies" description:"save full reply payload in playback file"`
 	PlaybackFile string `short:"p" description:"path to playback file to record to" long:"playback-file" required:"yes"`
+
+	// termChan is closed by HandleInterrupt to stop the capture.
+	termChan chan struct{}
 }
 
 // ErrPacketsDropped means that some packets were dropped
@@ -143,13 +146,16 @@ func (record *RecordCommand) Execute(args []string) error {
 
 	// When a signal is received to kill the process, stop the packet handler so
 	// we gracefully flush all ops being processed before exiting.
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	record.termChan = make(chan struct{})
+	finishedChan := signals.HandleWithInterrupt(record.HandleInterrupt)
+	defer close(finishedChan)
 	go func() {
-		// Block until a signal is received.
-		s := <-sigChan
-		toolDebugLogger.Logvf(Info, "Got signal %v, closing PCAP handle", s)
-		ctx.packetHandler.Close()
+		select {
+		case <-record.termChan:
+			toolDebugLogger.Logvf(Info, "closing PCAP handle")
+			ctx.packetHandler.Close()
+		case <-finishedChan:
+		}
 	}()
 	playbackFileWriter, err := NewPlaybackFileWriter(record.PlaybackFile, false, record.Gzip)
 	if err != nil {
@@ -157,8 +163,30 @@ func (record *RecordCommand) Execute(args []string) error {
 	}
 	defer playbackFileWriter.Close()
 
-	return Record(ctx, playbackFileWriter, record.FullReplies)
+	err = Record(ctx, playbackFileWriter, record.FullReplies)
+	if err == nil && record.interrupted() {
+		return util.ErrTerminated
+	}
+	return err
+}
 
+// HandleInterrupt stops the capture. The ops already captured are written to
+// the playback file, which is left whole, and Execute then returns
+// util.ErrTerminated.
+func (record *RecordCommand) HandleInterrupt() {
+	if record.termChan != nil {
+		close(record.termChan)
+	}
+}
+
+// interrupted returns true once HandleInterrupt has been called.
+func (record *RecordCommand) interrupted() bool {
+	select {
+	case <-record.termChan:
+		return true
+	default:
+		return false
+	}
 }
 
 // Record writes pcap data into a playback file
@@ -208,7 +236,7 @@ func Record(ctx *packetHandlerContext,
 
 	err = <-ch
 	if err == nil && stats != nil && stats.PacketsDropped != 0 {
-		err = ErrPacketsDropped{stats.PacketsDropped}
+		err = failure.New(failure.PartialData, ErrPacketsDropped{stats.PacketsDropped})
 	}
 	return err
 }
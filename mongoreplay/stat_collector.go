@@ -11,10 +11,12 @@ import (
 	"encoding/json"
 	"io"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/10gen/llmgo/bson"
+	"github.com/mongodb/mongo-tools/common/text"
 )
 
 // TruncateLength is the maximum number of characters allowed for long
@@ -106,6 +108,8 @@ func newStatCollector(opts StatOptions, collectFormat string, isPairedMode bool,
 			truncate: !opts.NoTruncate,
 			format:   opts.Format,
 		}
+	case text.FormatText, text.FormatCSV:
+		statRec = newTableStatRecorder(o, collectFormat)
 	}
 
 	if opts.BufferSize < 1 {
@@ -187,6 +191,18 @@ type TerminalStatRecorder struct {
 	format   string
 }
 
+// tableBlockRows is the number of stats in each block of --collect table
+// output, after which the header is repeated.
+const tableBlockRows = 20
+
+// TableStatRecorder records stats as the rows of a table, for terminal
+// output as text or for spreadsheets as CSV.
+type TableStatRecorder struct {
+	out    io.WriteCloser
+	format string
+	table  *text.Table
+}
+
 // BufferedStatRecorder implements the StatRecorder interface using an in-memory
 // slice of OpStats. This allows for the statistics on operations executed by
 // mongoreplay to be reviewed by a program directly following execution.
@@ -294,6 +310,53 @@ func (dsr *TerminalStatRecorder) RecordStat(stat *OpStat) {
 	}
 }
 
+func newTableStatRecorder(out io.WriteCloser, format string) *TableStatRecorder {
+	table := text.NewTable("time", "connection", "request", "latency", "op", "command", "ns", "errors")
+	for i := 4; i < len(table.Columns); i++ {
+		table.Columns[i].Align = text.AlignLeft
+	}
+	table.Padding = 2
+	return &TableStatRecorder{out: out, format: format, table: table}
+}
+
+// RecordStat adds the stat to the table, writing a block of the table once
+// it is full
+func (tsr *TableStatRecorder) RecordStat(stat *OpStat) {
+	if stat == nil {
+		return
+	}
+	errors := make([]string, len(stat.Errors))
+	for i, err := range stat.Errors {
+		errors[i] = err.Error()
+	}
+	tsr.table.AddRow(stat.getTime(time.StampMilli),
+		stat.getConnectionNum(),
+		stat.getRequestID(),
+		stat.getLatency(),
+		stat.getOpType(),
+		stat.getCommand(),
+		stat.getNs(),
+		strings.Join(errors, "; "))
+	if tsr.table.Len() >= tableBlockRows {
+		tsr.flush()
+	}
+}
+
+// flush writes the stats in the table as a block. Text blocks keep the
+// widths of the previous ones, and CSV has a single header.
+func (tsr *TableStatRecorder) flush() {
+	if tsr.table.Len() == 0 {
+		return
+	}
+	err := tsr.table.Write(tsr.out, tsr.format)
+	if err != nil {
+		toolDebugLogger.Logvf(Always, "error recording stat: %v", err)
+	}
+	tsr.table.MinWidths = tsr.table.Widths()
+	tsr.table.NoHeader = tsr.format == text.FormatCSV
+	tsr.table.Reset()
+}
+
 // RecordStat doesn't do anything for the NopRecorder
 func (nr *NopRecorder) RecordStat(stat *OpStat) {
 }
@@ -313,6 +376,12 @@ func (nr *NopRecorder) Close() error {
 	return nil
 }
 
+// Close writes the remaining stats and closes the TableStatRecorder
+func (tsr *TableStatRecorder) Close() error {
+	tsr.flush()
+	return tsr.out.Close()
+}
+
 // Close closes the TerminalStatRecorder
 func (dsr *TerminalStatRecorder) Close() error {
 	return dsr.out.Close()
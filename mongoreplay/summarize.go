@@ -0,0 +1,590 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoreplay
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	mgo "github.com/10gen/llmgo"
+	"github.com/10gen/llmgo/bson"
+	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/text"
+)
+
+// SummarizeCommand stores settings for the mongoreplay 'summarize' subcommand
+type SummarizeCommand struct {
+	GlobalOpts *Options `no-flag:"true"`
+	OpStreamSettings
+	Gzip         bool   `long:"gzip" description:"decompress gzipped input"`
+	PlaybackFile string `short:"p" description:"path to playback file to read from" long:"playback-file"`
+	Report       string `long:"report" description:"Write the summary to the given output path instead of stdout"`
+	Format       string `long:"format" description:"Summary format; 'text' also writes a table of the namespaces, 'csv' and 'json' only the table of the shapes" choice:"text" choice:"csv" choice:"json" default:"text"`
+	Limit        int    `long:"limit" description:"Only report the given number of the most frequent shapes (all by default)"`
+	DriverOps    bool   `long:"include-driver-ops" description:"Include the commands drivers run for themselves, such as isMaster and authentication"`
+	// SuggestIndexes reports the shapes of queries that no index of the host
+	// supports, with an index for each.
+	SuggestIndexes bool         `long:"suggest-indexes" description:"Report the frequent query shapes no index of --host supports, with an index to support each"`
+	URL            string       `long:"host" env:"MONGOREPLAY_HOST" description:"Location of the host to list the indexes of with --suggest-indexes" default:"mongodb://localhost:27017"`
+	SSLOpts        *options.SSL `no-flag:"true"`
+}
+
+// shapeIgnoredFields are the fields of commands left out of their shapes, as
+// they describe how a command is sent rather than what it does.
+var shapeIgnoredFields = map[string]bool{
+	"$db":                true,
+	"$clusterTime":       true,
+	"$readPreference":    true,
+	"$client":            true,
+	"$audit":             true,
+	"$configServerState": true,
+	"$gleStats":          true,
+	"$replData":          true,
+	"$oplogQueryData":    true,
+	"lsid":               true,
+	"txnNumber":          true,
+	"autocommit":         true,
+	"startTransaction":   true,
+	"readConcern":        true,
+	"writeConcern":       true,
+	"maxTimeMS":          true,
+	"comment":            true,
+}
+
+// opShape is the shape of an op: the operation it runs on a namespace, and
+// the field names of its arguments, with their values stripped.
+type opShape struct {
+	Op    string
+	Ns    string
+	Shape string
+}
+
+// shapeSummary is what is known of the ops of a shape.
+type shapeSummary struct {
+	opShape
+	Count int
+	// Latencies are the latencies of the ops whose reply was seen, in
+	// microseconds
+	Latencies []int64
+
+	doc bson.D
+}
+
+// namespaceSummary is what is known of the ops on a namespace.
+type namespaceSummary struct {
+	Ns            string
+	Count         int
+	Shapes        int
+	LatencyMicros int64
+}
+
+// pendingOp is a request waiting for its reply, for its latency.
+type pendingOp struct {
+	summary *shapeSummary
+	seen    time.Time
+}
+
+// WorkloadSummarizer groups ops by their shapes, pairing requests with their
+// replies for their latencies.
+type WorkloadSummarizer struct {
+	DriverOps bool
+	// IndexLister lists the indexes of the namespaces of queries, to report
+	// the shapes no index supports. They aren't reported if it is nil.
+	IndexLister IndexLister
+
+	shapes  map[opShape]*shapeSummary
+	pending map[opKey]pendingOp
+}
+
+// NewWorkloadSummarizer returns a WorkloadSummarizer with no ops.
+func NewWorkloadSummarizer() *WorkloadSummarizer {
+	return &WorkloadSummarizer{
+		shapes:  make(map[opShape]*shapeSummary),
+		pending: make(map[opKey]pendingOp),
+	}
+}
+
+// Execute runs the program for the 'summarize' subcommand
+func (summarize *SummarizeCommand) Execute(args []string) error {
+	summarize.GlobalOpts.SetLogging()
+	err := validateOpInput(&summarize.OpStreamSettings, summarize.PlaybackFile, summarize.Gzip, args)
+	if err != nil {
+		return err
+	}
+	if summarize.Limit < 0 {
+		return fmt.Errorf("--limit must not be negative")
+	}
+
+	opChan, errChan, err := openOpInput(summarize.OpStreamSettings, summarize.PlaybackFile, summarize.Gzip, "summarize")
+	if err != nil {
+		return err
+	}
+	summarizer := NewWorkloadSummarizer()
+	summarizer.DriverOps = summarize.DriverOps
+	if summarize.SuggestIndexes {
+		sp, err := newSessionProvider(summarize.URL, summarize.SSLOpts)
+		if err != nil {
+			return err
+		}
+		defer sp.Close()
+		session, err := sp.GetSession()
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+		summarizer.IndexLister = ListIndexesWithSession(session)
+	}
+	for op := range opChan {
+		parsedOp, err := op.RawOp.Parse()
+		if err != nil {
+			return err
+		}
+		summarizer.Add(op, parsedOp)
+	}
+	err = <-errChan
+	if err != nil && err != io.EOF {
+		userInfoLogger.Logvf(Always, "OpChan: %v", err)
+	}
+
+	var out io.WriteCloser = os.Stdout
+	if summarize.Report != "" {
+		out, err = os.Create(summarize.Report)
+		if err != nil {
+			return err
+		}
+	}
+	defer out.Close()
+	return summarizer.WriteReport(out, summarize.Format, summarize.Limit)
+}
+
+// Add adds an op to the summary. Requests are counted under their shapes,
+// and replies give the latency of their requests.
+func (summarizer *WorkloadSummarizer) Add(op *RecordedOp, parsedOp Op) {
+	if parsedOp == nil {
+		return
+	}
+	switch parsedOp.(type) {
+	case *ReplyOp, *CommandReplyOp, *MsgOpReply:
+		key := opKey{
+			driverEndpoint: op.DstEndpoint,
+			serverEndpoint: op.SrcEndpoint,
+			opID:           op.Header.ResponseTo,
+		}
+		if pending, ok := summarizer.pending[key]; ok {
+			latency := op.Seen.Sub(pending.seen) / time.Microsecond
+			pending.summary.Latencies = append(pending.summary.Latencies, int64(latency))
+			delete(summarizer.pending, key)
+		}
+		return
+	}
+	if !summarizer.DriverOps && isDriverOpOrMsg(parsedOp) {
+		return
+	}
+	shape, doc, ok := shapeOf(parsedOp)
+	if !ok {
+		return
+	}
+	summary, ok := summarizer.shapes[shape]
+	if !ok {
+		summary = &shapeSummary{opShape: shape, doc: doc}
+		summarizer.shapes[shape] = summary
+	}
+	summary.Count++
+	switch op.Header.OpCode {
+	case OpCodeQuery, OpCodeGetMore, OpCodeCommand, OpCodeMessage:
+		summarizer.pending[opKey{
+			driverEndpoint: op.SrcEndpoint,
+			serverEndpoint: op.DstEndpoint,
+			opID:           op.Header.RequestID,
+		}] = pendingOp{summary: summary, seen: op.Seen.Time}
+	}
+}
+
+// isDriverOpOrMsg returns whether the op is run by drivers for themselves,
+// as IsDriverOp does, including those sent as OP_MSG.
+func isDriverOpOrMsg(op Op) bool {
+	if msgOp, ok := op.(*MsgOp); ok {
+		return isDriverCommand(msgOp.CommandName)
+	}
+	return IsDriverOp(op)
+}
+
+// sortedShapes returns the summaries of the shapes, the most frequent first, and
+// those with the most total latency first among equally frequent ones.
+func (summarizer *WorkloadSummarizer) sortedShapes() []*shapeSummary {
+	shapes := make([]*shapeSummary, 0, len(summarizer.shapes))
+	for _, summary := range summarizer.shapes {
+		shapes = append(shapes, summary)
+	}
+	sort.Sort(byFrequency(shapes))
+	return shapes
+}
+
+// sortedNamespaces returns the summaries of the namespaces the ops ran on, the
+// namespace with the most ops first.
+func (summarizer *WorkloadSummarizer) sortedNamespaces() []*namespaceSummary {
+	byNs := make(map[string]*namespaceSummary)
+	var namespaces []*namespaceSummary
+	for _, shape := range summarizer.sortedShapes() {
+		ns, ok := byNs[shape.Ns]
+		if !ok {
+			ns = &namespaceSummary{Ns: shape.Ns}
+			byNs[shape.Ns] = ns
+			namespaces = append(namespaces, ns)
+		}
+		ns.Count += shape.Count
+		ns.Shapes++
+		ns.LatencyMicros += totalMicros(shape.Latencies)
+	}
+	sort.Stable(byCount(namespaces))
+	return namespaces
+}
+
+// WriteReport writes the summary of the shapes in the given format, limited
+// to the most frequent ones if limit is positive. Text also has the summary
+// of the namespaces, and of the shapes no index supports if the summarizer
+// has an IndexLister; CSV and JSON only have the latter then.
+func (summarizer *WorkloadSummarizer) WriteReport(w io.Writer, format string, limit int) error {
+	if summarizer.IndexLister != nil && format != text.FormatText {
+		return summarizer.writeUnindexedShapes(w, format, limit)
+	}
+	shapes := summarizer.sortedShapes()
+	total := 0
+	for _, shape := range shapes {
+		total += shape.Count
+	}
+	if limit > 0 && limit < len(shapes) {
+		shapes = shapes[:limit]
+	}
+
+	shapeTable := text.NewTable("count", "%", "op", "ns", "avg", "p50", "p95", "p99", "max", "shape")
+	shapeTable.Columns[2].Align = text.AlignLeft
+	shapeTable.Columns[3].Align = text.AlignLeft
+	shapeTable.Columns[9].Align = text.AlignLeft
+	shapeTable.Padding = 2
+	for _, shape := range shapes {
+		latencies := shape.Latencies
+		sort.Sort(int64Slice(latencies))
+		avg := ""
+		if len(latencies) > 0 {
+			avg = formatMicros(totalMicros(latencies) / int64(len(latencies)))
+		}
+		shapeTable.AddRow(fmt.Sprint(shape.Count),
+			fmt.Sprintf("%.1f", 100*float64(shape.Count)/float64(total)),
+			shape.Op,
+			shape.Ns,
+			avg,
+			percentile(latencies, 50),
+			percentile(latencies, 95),
+			percentile(latencies, 99),
+			percentile(latencies, 100),
+			shape.Shape)
+	}
+	if err := shapeTable.Write(w, format); err != nil {
+		return err
+	}
+	if format != text.FormatText {
+		return nil
+	}
+
+	nsTable := text.NewTable("ns", "count", "shapes", "total latency")
+	nsTable.Columns[0].Align = text.AlignLeft
+	nsTable.Padding = 2
+	for _, ns := range summarizer.sortedNamespaces() {
+		nsTable.AddRow(ns.Ns, fmt.Sprint(ns.Count), fmt.Sprint(ns.Shapes), formatMicros(ns.LatencyMicros))
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return err
+	}
+	if err := nsTable.Write(w, format); err != nil {
+		return err
+	}
+	if summarizer.IndexLister == nil {
+		return nil
+	}
+	if _, err := io.WriteString(w, "\nunindexed shapes:\n"); err != nil {
+		return err
+	}
+	return summarizer.writeUnindexedShapes(w, format, limit)
+}
+
+// byFrequency sorts the summaries of shapes by their counts, then by their
+// total latencies.
+type byFrequency []*shapeSummary
+
+func (s byFrequency) Len() int      { return len(s) }
+func (s byFrequency) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byFrequency) Less(i, j int) bool {
+	if s[i].Count != s[j].Count {
+		return s[i].Count > s[j].Count
+	}
+	if ti, tj := totalMicros(s[i].Latencies), totalMicros(s[j].Latencies); ti != tj {
+		return ti > tj
+	}
+	return s[i].Shape < s[j].Shape
+}
+
+// byCount sorts the summaries of namespaces by their counts.
+type byCount []*namespaceSummary
+
+func (s byCount) Len() int           { return len(s) }
+func (s byCount) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byCount) Less(i, j int) bool { return s[i].Count > s[j].Count }
+
+type int64Slice []int64
+
+func (s int64Slice) Len() int           { return len(s) }
+func (s int64Slice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s int64Slice) Less(i, j int) bool { return s[i] < s[j] }
+
+func totalMicros(latencies []int64) int64 {
+	var total int64
+	for _, latency := range latencies {
+		total += latency
+	}
+	return total
+}
+
+// percentile returns the latency at the percentile p of the sorted
+// latencies, by the nearest-rank method.
+func percentile(sorted []int64, p int) string {
+	if len(sorted) == 0 {
+		return ""
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return formatMicros(sorted[rank-1])
+}
+
+func formatMicros(micros int64) string {
+	return (time.Duration(micros) * time.Microsecond).String()
+}
+
+// shapeOf returns the shape of an op, with the shape of its arguments as a
+// document, or false if it has none, as ops that kill cursors don't.
+func shapeOf(parsedOp Op) (opShape, bson.D, bool) {
+	var op, ns string
+	var shape bson.D
+	switch o := parsedOp.(type) {
+	case *QueryOp:
+		doc, _ := toDocument(o.Query)
+		if strings.HasSuffix(o.Collection, ".$cmd") {
+			op, ns, shape = commandShape(strings.TrimSuffix(o.Collection, ".$cmd"), doc)
+		} else {
+			op, ns, shape = "query", o.Collection, shapeOfDocument(doc, false)
+		}
+	case *CommandOp:
+		doc, _ := toDocument(o.CommandArgs)
+		op, ns, shape = commandShape(o.Database, doc)
+	case *CommandGetMore:
+		doc, _ := toDocument(o.CommandArgs)
+		op, ns, shape = commandShape(o.Database, doc)
+	case *MsgOp:
+		op, ns, shape = commandShape(o.Database, msgDocument(&o.MsgOp))
+	case *MsgOpGetMore:
+		op, ns, shape = commandShape(o.Database, msgDocument(&o.MsgOp.MsgOp))
+	case *InsertOp:
+		op, ns, shape = "insert", o.Collection, bson.D{}
+		if len(o.Documents) > 0 {
+			doc, _ := toDocument(o.Documents[0])
+			shape = shapeOfDocument(doc, false)
+		}
+	case *UpdateOp:
+		selector, _ := toDocument(o.Selector)
+		update, _ := toDocument(o.Update)
+		op, ns = "update", o.Collection
+		shape = bson.D{{"q", shapeOfDocument(selector, false)}, {"u", shapeOfDocument(update, false)}}
+	case *DeleteOp:
+		selector, _ := toDocument(o.Selector)
+		op, ns, shape = "remove", o.Collection, shapeOfDocument(selector, false)
+	case *GetMoreOp:
+		op, ns, shape = "getmore", o.Collection, bson.D{}
+	default:
+		return opShape{}, nil, false
+	}
+	return opShape{Op: op, Ns: ns, Shape: renderShape(shape)}, shape, true
+}
+
+// commandShape returns the name, namespace and shape of a command run on a
+// database. The collection the command runs on is part of its namespace, not
+// of its shape.
+func commandShape(database string, command bson.D) (string, string, bson.D) {
+	if len(command) == 0 {
+		return "command", database, bson.D{}
+	}
+	ns := database
+	if collection, ok := command[0].Value.(string); ok {
+		ns = database + "." + collection
+	} else if command[0].Name == "getMore" {
+		if collection, ok := FindValueByKey("collection", &command); ok {
+			ns = fmt.Sprintf("%v.%v", database, collection)
+		}
+	}
+	return command[0].Name, ns, shapeOfDocument(command[1:], true)
+}
+
+// msgDocument returns the body of an OP_MSG, with the documents of its
+// document sequences as arrays under their identifiers.
+func msgDocument(op *mgo.MsgOp) bson.D {
+	var doc bson.D
+	for _, section := range op.Sections {
+		switch section.PayloadType {
+		case mgo.MsgPayload0:
+			body, _ := toDocument(section.Data)
+			doc = append(body, doc...)
+		case mgo.MsgPayload1:
+			if payload, ok := section.Data.(mgo.PayloadType1); ok {
+				doc = append(doc, bson.DocElem{Name: payload.Identifier, Value: payload.Docs})
+			}
+		}
+	}
+	return doc
+}
+
+// shapeOfDocument returns the shape of a document: its fields, with the
+// shapes of their values. The fields that don't change what a command does
+// are left out of commands.
+func shapeOfDocument(doc bson.D, command bool) bson.D {
+	shape := bson.D{}
+	for _, elem := range doc {
+		if command && shapeIgnoredFields[elem.Name] {
+			continue
+		}
+		value := shapeOfValue(elem.Value)
+		if clauses, ok := elem.Value.([]interface{}); ok && logicalOperators[elem.Name] {
+			// the clauses of logical operators are each part of the shape
+			shapes := make([]interface{}, len(clauses))
+			for i, clause := range clauses {
+				shapes[i] = shapeOfValue(clause)
+			}
+			value = shapes
+		}
+		shape = append(shape, bson.DocElem{Name: elem.Name, Value: value})
+	}
+	return shape
+}
+
+// logicalOperators are the query operators combining the clauses of an
+// array, which, unlike other arrays, are kept whole in shapes.
+var logicalOperators = map[string]bool{
+	"$and": true,
+	"$or":  true,
+	"$nor": true,
+}
+
+// shapeOfValue returns the shape of a value: documents have the shapes of
+// their fields, arrays the shape of their first element, so that $in lists
+// and batches of documents of any length have the same shape, and other
+// values are stripped.
+func shapeOfValue(value interface{}) interface{} {
+	if doc, ok := toDocument(value); ok {
+		return shapeOfDocument(doc, false)
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		if len(v) == 0 {
+			return []interface{}{}
+		}
+		return []interface{}{shapeOfValue(v[0])}
+	}
+	return nil
+}
+
+// toDocument returns a value as a bson.D, if it is a document of any of the
+// types ops are parsed into.
+func toDocument(value interface{}) (bson.D, bool) {
+	switch v := value.(type) {
+	case bson.D:
+		return v, true
+	case *bson.D:
+		if v == nil {
+			return nil, false
+		}
+		return *v, true
+	case bson.M:
+		return mapToDocument(v), true
+	case *bson.M:
+		if v == nil {
+			return nil, false
+		}
+		return mapToDocument(*v), true
+	case map[string]interface{}:
+		return mapToDocument(v), true
+	case bson.Raw:
+		if v.Kind != 0x03 && v.Kind != 0 {
+			return nil, false
+		}
+		doc := bson.D{}
+		if err := v.Unmarshal(&doc); err != nil {
+			return nil, false
+		}
+		return doc, true
+	case *bson.Raw:
+		if v == nil {
+			return nil, false
+		}
+		return toDocument(*v)
+	}
+	return nil, false
+}
+
+// mapToDocument returns the fields of a map in order of their names, as
+// maps have no order.
+func mapToDocument(m map[string]interface{}) bson.D {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	doc := make(bson.D, len(names))
+	for i, name := range names {
+		doc[i] = bson.DocElem{Name: name, Value: m[name]}
+	}
+	return doc
+}
+
+// renderShape renders a shape like the shell does documents, with its
+// stripped values as question marks.
+func renderShape(shape interface{}) string {
+	buf := &bytes.Buffer{}
+	writeShape(buf, shape)
+	return buf.String()
+}
+
+func writeShape(buf *bytes.Buffer, shape interface{}) {
+	switch v := shape.(type) {
+	case bson.D:
+		buf.WriteString("{")
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(elem.Name)
+			buf.WriteString(": ")
+			writeShape(buf, elem.Value)
+		}
+		buf.WriteString("}")
+	case []interface{}:
+		buf.WriteString("[")
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			writeShape(buf, elem)
+		}
+		buf.WriteString("]")
+	default:
+		buf.WriteString("?")
+	}
+}
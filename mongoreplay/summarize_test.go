@@ -0,0 +1,108 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongoreplay
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/10gen/llmgo/bson"
+	"github.com/mongodb/mongo-tools/common/testtype"
+)
+
+func TestSummarizeShapes(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.MongoReplayTestType)
+
+	generator := newRecordedOpGenerator()
+	requests := []bson.D{
+		{{"a", 5}, {"b", bson.D{{"$gt", 3}}}},
+		{{"a", "x"}, {"b", bson.D{{"$gt", 10}}}},
+		{{"c", bson.D{{"$in", []interface{}{1, 2, 3}}}}},
+	}
+	for i, filter := range requests {
+		if err := generator.generateMsgOpFind(filter, 0, int32(i+1)); err != nil {
+			t.Fatal(err)
+		}
+		if err := generator.generateMsgOpReply(int32(i+1), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := generator.generateCommandOp("isMaster", bson.D{}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := generator.generateInsert([]interface{}{bson.D{{"_id", 1}, {"name", "x"}}}); err != nil {
+		t.Fatal(err)
+	}
+	close(generator.opChan)
+
+	summarizer := NewWorkloadSummarizer()
+	for op := range generator.opChan {
+		parsedOp, err := op.RawOp.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		summarizer.Add(op, parsedOp)
+	}
+
+	shapes := summarizer.sortedShapes()
+	if len(shapes) != 3 {
+		t.Fatalf("expected 3 shapes, got %v: %#v", len(shapes), shapes)
+	}
+	find := shapes[0]
+	if find.Op != "find" || find.Ns != "mongoreplay.test" || find.Shape != "{filter: {a: ?, b: {$gt: ?}}}" {
+		t.Errorf("unexpected most frequent shape %#v", find.opShape)
+	}
+	if find.Count != 2 || len(find.Latencies) != 2 || find.Latencies[0] != 2000 {
+		t.Errorf("expected 2 finds of 2ms, got %v with latencies %v", find.Count, find.Latencies)
+	}
+	for _, shape := range shapes[1:] {
+		switch shape.Op {
+		case "find":
+			if shape.Shape != "{filter: {c: {$in: [?]}}}" {
+				t.Errorf("unexpected shape of $in %v", shape.Shape)
+			}
+		case "insert":
+			if shape.Ns != "mongoreplay.test" || shape.Shape != "{_id: ?, name: ?}" || len(shape.Latencies) != 0 {
+				t.Errorf("unexpected shape of legacy insert %#v", shape)
+			}
+		default:
+			t.Errorf("unexpected shape %#v", shape.opShape)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	if err := summarizer.WriteReport(out, "text", 1); err != nil {
+		t.Fatal(err)
+	}
+	report := out.String()
+	if strings.Contains(report, "$in") || !strings.Contains(report, "{filter: {a: ?, b: {$gt: ?}}}") {
+		t.Errorf("expected only the most frequent shape in the report:\n%v", report)
+	}
+	if !strings.Contains(report, "mongoreplay.test") || !strings.Contains(report, "total latency") {
+		t.Errorf("expected the namespaces in the report:\n%v", report)
+	}
+}
+
+func TestCommandShape(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.MongoReplayTestType)
+
+	cases := []struct {
+		command  bson.D
+		expected string
+	}{
+		{bson.D{{"count", "c"}, {"query", bson.D{{"x", 1}}}, {"lsid", bson.D{{"id", 1}}}, {"$db", "db"}}, "{query: {x: ?}}"},
+		{bson.D{{"aggregate", 1}, {"pipeline", []interface{}{bson.D{{"$match", bson.D{{"y", 2}}}}}}}, "{pipeline: [{$match: {y: ?}}]}"},
+		{bson.D{{"insert", "c"}, {"documents", []interface{}{}}}, "{documents: []}"},
+	}
+	for _, c := range cases {
+		_, _, shape := commandShape("db", c.command)
+		if renderShape(shape) != c.expected {
+			t.Errorf("expected shape %v of %v, got %v", c.expected, c.command, renderShape(shape))
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGetArchiveReader(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With an archive", t, func() {
+		data := bytes.Repeat([]byte("archive"), 1000)
+		restore := &MongoRestore{InputOptions: &InputOptions{}}
+
+		Convey("streamed from stdin, the bytes read should be counted out of --archiveSize", func() {
+			restore.InputOptions.Archive = "-"
+			restore.InputOptions.ArchiveSize = 10000
+			restore.InputReader = bytes.NewReader(data)
+			rc, err := restore.getArchiveReader()
+			So(err, ShouldBeNil)
+			read, err := ioutil.ReadAll(rc)
+			So(err, ShouldBeNil)
+			So(read, ShouldResemble, data)
+			So(rc.Close(), ShouldBeNil)
+			current, max := restore.archiveProgress.Progress()
+			So(current, ShouldEqual, len(data))
+			So(max, ShouldEqual, 10000)
+		})
+
+		Convey("compressed in a file, the compressed bytes should be counted out of its size", func() {
+			compressed := &bytes.Buffer{}
+			gzw := gzip.NewWriter(compressed)
+			gzw.Write(data)
+			gzw.Close()
+			file, err := ioutil.TempFile("", "archive")
+			So(err, ShouldBeNil)
+			defer os.Remove(file.Name())
+			file.Write(compressed.Bytes())
+			file.Close()
+
+			restore.InputOptions.Archive = file.Name()
+			restore.InputOptions.Gzip = true
+			rc, err := restore.getArchiveReader()
+			So(err, ShouldBeNil)
+			read, err := ioutil.ReadAll(rc)
+			So(err, ShouldBeNil)
+			So(read, ShouldResemble, data)
+			So(rc.Close(), ShouldBeNil)
+			current, max := restore.archiveProgress.Progress()
+			So(current, ShouldEqual, compressed.Len())
+			So(max, ShouldEqual, compressed.Len())
+		})
+	})
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/manifest"
 	"github.com/mongodb/mongo-tools/common/util"
 )
 
@@ -293,6 +294,8 @@ func (restore *MongoRestore) CreateAllIntents(dir archive.DirLike) error {
 					oplogIntent.BSONFile = &realBSONFile{path: entry.Path(), intent: oplogIntent, gzip: restore.InputOptions.Gzip}
 				}
 				restore.manager.Put(oplogIntent)
+			} else if entry.Name() == manifest.FileName {
+				log.Logvf(log.DebugLow, "found checksum manifest %v; use --verifyManifest to check the dump against it", entry.Path())
 			} else {
 				log.Logvf(log.Always, `don't know what to do with file "%v", skipping...`, entry.Path())
 			}
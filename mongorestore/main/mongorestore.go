@@ -9,14 +9,20 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/db/csfle"
+	"github.com/mongodb/mongo-tools/common/diagnose"
+	"github.com/mongodb/mongo-tools/common/failure"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
 	"github.com/mongodb/mongo-tools/common/signals"
+	"github.com/mongodb/mongo-tools/common/throttle"
+	"github.com/mongodb/mongo-tools/common/trace"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongorestore"
 )
@@ -36,6 +42,12 @@ func main() {
 	opts.AddOptions(inputOpts)
 	outputOpts := &mongorestore.OutputOptions{}
 	opts.AddOptions(outputOpts)
+	encryptionOpts := &options.Encryption{}
+	opts.AddOptions(encryptionOpts)
+	throttleOpts := &options.Throttle{}
+	opts.AddOptions(throttleOpts)
+	tracingOpts := &options.Tracing{}
+	opts.AddOptions(tracingOpts)
 	opts.URI.AddKnownURIParameters(options.KnownURIOptionsWriteConcern)
 
 	extraArgs, err := opts.ParseArgs(os.Args[1:])
@@ -59,22 +71,62 @@ func main() {
 	}
 
 	log.SetVerbosity(opts.Verbosity)
+	log.SetFormat(opts.LogFormat, opts.AppName)
 
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
+	// test connecting to the server step by step, if specified
+	if opts.Diagnose {
+		os.Exit(diagnose.Run(opts, os.Stdout))
+	}
+
+	if err = trace.Init(tracingOpts.OTelEndpoint, opts.AppName); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		log.Logvf(log.Always, "try 'mongorestore --help' for more information")
+		os.Exit(util.ExitBadOptions)
+	}
+
 	targetDir, err := getTargetDirFromArgs(extraArgs, inputOpts.Directory)
 	if err != nil {
 		log.Logvf(log.Always, "%v", err)
 		log.Logvf(log.Always, "try 'mongorestore --help' for more information")
+		trace.Shutdown(err)
 		os.Exit(util.ExitBadOptions)
 	}
 	targetDir = util.ToUniversalPath(targetDir)
 
+	// check a dump directory against its manifest, without connecting
+	if inputOpts.VerifyManifest {
+		if inputOpts.Archive != "" || targetDir == "-" {
+			err = fmt.Errorf("--verifyManifest can only be used with a dump directory")
+			log.Logvf(log.Always, "%v", err)
+			log.Logvf(log.Always, "try 'mongorestore --help' for more information")
+			trace.Shutdown(err)
+			os.Exit(util.ExitBadOptions)
+		}
+		err = mongorestore.VerifyManifest(targetDir)
+		trace.Shutdown(err)
+		if err != nil {
+			log.Logvf(log.Always, "Failed: %v", err)
+			os.Exit(failure.ExitCode(err))
+		}
+		return
+	}
+
+	limiter, err := throttle.FromOptions(throttleOpts)
+	if err != nil {
+		log.Logvf(log.Always, "%v", err)
+		log.Logvf(log.Always, "try 'mongorestore --help' for more information")
+		trace.Shutdown(err)
+		os.Exit(util.ExitBadOptions)
+	}
+
 	provider, err := db.NewSessionProvider(*opts)
 	if err != nil {
 		log.Logvf(log.Always, "error connecting to host: %v", err)
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		os.Exit(failure.ExitCode(err))
 	}
 	defer provider.Close()
 	provider.SetBypassDocumentValidation(outputOpts.BypassDocumentValidation)
@@ -82,10 +134,36 @@ func main() {
 	// disable TCP timeouts for restore jobs
 	provider.SetFlags(db.DisableSocketTimeout)
 
+	encryption, err := csfle.New(provider, encryptionOpts)
+	if err != nil {
+		log.Logvf(log.Always, "error setting up encryption: %v", err)
+		trace.Shutdown(err)
+		os.Exit(util.ExitBadOptions)
+	}
+
 	// start up the progress bar manager
-	progressManager := progress.NewBarWriter(log.Writer(0), progressBarWaitTime, progressBarLength, true)
-	progressManager.Start()
-	defer progressManager.Stop()
+	// draw the bars in place on a terminal, unless the log is JSON
+	var terminal io.Writer
+	if opts.LogFormat != log.JSONFormat {
+		terminal = progress.Terminal()
+	}
+	barWriter := progress.NewMultiBarWriter(log.Writer(0), terminal, progressBarWaitTime, progressBarLength, true)
+	barWriter.Start()
+	defer barWriter.Stop()
+
+	// write progress events as well, if asked to
+	var progressManager progress.Manager = barWriter
+	eventWriter, err := progress.OpenEventWriter(opts.ProgressFD, opts.ProgressSocket, opts.AppName, progressBarWaitTime, true)
+	if err != nil {
+		log.Logvf(log.Always, "error opening progress event stream: %v", err)
+		trace.Shutdown(err)
+		os.Exit(util.ExitBadOptions)
+	}
+	if eventWriter != nil {
+		eventWriter.Start()
+		defer eventWriter.Stop()
+		progressManager = progress.Managers{barWriter, eventWriter}
+	}
 
 	restore := mongorestore.MongoRestore{
 		ToolOptions:     opts,
@@ -95,6 +173,8 @@ func main() {
 		TargetDirectory: targetDir,
 		SessionProvider: provider,
 		ProgressManager: progressManager,
+		Encryption:      encryption,
+		Limiter:         limiter,
 	}
 
 	finishedChan := signals.HandleWithInterrupt(restore.HandleInterrupt)
@@ -102,11 +182,11 @@ func main() {
 
 	if err = restore.Restore(); err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		if err == util.ErrTerminated {
-			os.Exit(util.ExitKill)
-		}
-		os.Exit(util.ExitError)
+		trace.Shutdown(err)
+		eventWriter.StopWithError(err)
+		os.Exit(failure.ExitCode(err))
 	}
+	trace.Shutdown(nil)
 }
 
 // getTargetDirFromArgs handles the logic and error cases of figuring out
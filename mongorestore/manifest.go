@@ -0,0 +1,78 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/manifest"
+)
+
+// manifestSearchDepth is how many directories above the target of a restore
+// its manifest is looked for in, as the target can be a database directory
+// or a BSON file of a dump.
+const manifestSearchDepth = 2
+
+// VerifyManifest checks the files of the dump at target, which can be a dump
+// directory or a database directory or file in one, against the sizes and
+// checksums of the manifest mongodump wrote for it.
+func VerifyManifest(target string) error {
+	if target == "" {
+		target = "dump"
+	}
+	m, err := findManifest(target)
+	if err != nil {
+		return err
+	}
+	prefix, err := m.Relative(target)
+	if err != nil {
+		return err
+	}
+	if prefix == "." {
+		prefix = ""
+	}
+	log.Logvf(log.Always, "verifying %v against manifest %v", target, filepath.Join(m.Dir(), manifest.FileName))
+
+	problems, err := m.Verify(prefix)
+	if err != nil {
+		return err
+	}
+	for _, problem := range problems {
+		log.Logvf(log.Always, "%v", problem)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%v file(s) of the dump don't match its manifest", len(problems))
+	}
+	log.Logvf(log.Always, "all files of the dump match its manifest")
+	return nil
+}
+
+// findManifest reads the manifest of the dump the target is part of.
+func findManifest(target string) (*manifest.Manifest, error) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, fmt.Errorf("mongorestore target '%v' invalid: %v", target, err)
+	}
+	dir := target
+	if !info.IsDir() {
+		dir = filepath.Dir(target)
+	}
+	for i := 0; i <= manifestSearchDepth; i++ {
+		m, err := manifest.Read(dir)
+		if err == nil {
+			return m, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		dir = filepath.Dir(dir)
+	}
+	return nil, fmt.Errorf("no %v found for '%v'; only directory dumps written by mongodump have one", manifest.FileName, target)
+}
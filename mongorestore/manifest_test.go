@@ -0,0 +1,57 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/manifest"
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVerifyManifest(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a dump directory with a manifest", t, func() {
+		dir, err := ioutil.TempDir("", "verify_manifest")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+
+		m := manifest.New(dir)
+		for _, relative := range []string{"test/c.bson", "test/c.metadata.json", "oplog.bson"} {
+			path := filepath.Join(dir, filepath.FromSlash(relative))
+			So(os.MkdirAll(filepath.Dir(path), 0755), ShouldBeNil)
+			So(ioutil.WriteFile(path, []byte(relative), 0644), ShouldBeNil)
+			entry, err := manifest.Checksum(path, relative)
+			So(err, ShouldBeNil)
+			m.Add(entry)
+		}
+		So(m.Write(), ShouldBeNil)
+
+		Convey("the dump, a database or a file of it should be verified", func() {
+			So(VerifyManifest(dir), ShouldBeNil)
+			So(VerifyManifest(filepath.Join(dir, "test")), ShouldBeNil)
+			So(VerifyManifest(filepath.Join(dir, "test", "c.bson")), ShouldBeNil)
+		})
+
+		Convey("a truncated file should fail the verification of the parts it is in", func() {
+			So(ioutil.WriteFile(filepath.Join(dir, "test", "c.bson"), []byte("test/"), 0644), ShouldBeNil)
+			So(VerifyManifest(dir), ShouldNotBeNil)
+			So(VerifyManifest(filepath.Join(dir, "test")), ShouldNotBeNil)
+			So(VerifyManifest(filepath.Join(dir, "oplog.bson")), ShouldBeNil)
+		})
+
+		Convey("a directory without a manifest should fail the verification", func() {
+			So(os.Remove(filepath.Join(dir, manifest.FileName)), ShouldBeNil)
+			So(VerifyManifest(dir), ShouldNotBeNil)
+		})
+	})
+}
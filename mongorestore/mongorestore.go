@@ -8,6 +8,7 @@
 package mongorestore
 
 import (
+	"bufio"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -19,10 +20,13 @@ import (
 	"github.com/mongodb/mongo-tools/common/archive"
 	"github.com/mongodb/mongo-tools/common/auth"
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/db/csfle"
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/storage"
+	"github.com/mongodb/mongo-tools/common/throttle"
 	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongorestore/ns"
 	"gopkg.in/mgo.v2"
@@ -40,6 +44,13 @@ type MongoRestore struct {
 	SessionProvider *db.SessionProvider
 	ProgressManager progress.Manager
 
+	// Encryption, if set, encrypts the fields of the documents that its
+	// schema map selects, by their target namespace, before they are written.
+	Encryption *csfle.Client
+
+	// Limiter, if set, limits the rate at which documents are inserted.
+	Limiter *throttle.Limiter
+
 	TargetDirectory string
 
 	// Skip restoring users and roles, regardless of namespace, when true.
@@ -67,6 +78,8 @@ type MongoRestore struct {
 	dbCollectionIndexes map[string]collectionIndexes
 
 	archive *archive.Reader
+	// archiveProgress counts the bytes read from the archive
+	archiveProgress progress.Updateable
 
 	// channel on which to notify if/when a termination signal is received
 	termChan chan struct{}
@@ -138,6 +151,12 @@ func (restore *MongoRestore) ParseAndValidateOptions() error {
 			return fmt.Errorf("cannot use --oplogFile with --archive specified")
 		}
 	}
+	if restore.InputOptions.ArchiveSize < 0 {
+		return fmt.Errorf("--archiveSize cannot be negative")
+	}
+	if restore.InputOptions.ArchiveSize > 0 && restore.InputOptions.Archive == "" {
+		return fmt.Errorf("cannot use --archiveSize without --archive")
+	}
 
 	// check if we are using a replica set and fall back to w=1 if we aren't (for <= 2.4)
 	nodeType, err := restore.SessionProvider.GetNodeType()
@@ -282,6 +301,9 @@ func (restore *MongoRestore) Restore() error {
 				In:      archiveReader,
 				Prelude: &archive.Prelude{},
 			}
+			if setter, ok := restore.ProgressManager.(progress.TotalSetter); ok {
+				setter.SetTotal(restore.archiveProgress)
+			}
 		}
 		err = restore.archive.Prelude.Read(restore.archive.In)
 		if err != nil {
@@ -406,6 +428,13 @@ func (restore *MongoRestore) Restore() error {
 		return fmt.Errorf("cannot restore with conflicting namespace destinations")
 	}
 
+	if !restore.OutputOptions.NoPreflightChecks {
+		err = restore.PreflightChecks()
+		if err != nil {
+			return err
+		}
+	}
+
 	if restore.OutputOptions.DryRun {
 		log.Logvf(log.Always, "dry run completed")
 		return nil
@@ -521,9 +550,22 @@ func (restore *MongoRestore) Restore() error {
 	return nil
 }
 
+// archiveBufferSize is how much of the archive is read ahead of the
+// demultiplexer, which reads it a document at a time. The archive is only
+// ever read forward, so it can be streamed from a pipe.
+const archiveBufferSize = 1024 * 1024
+
+// getArchiveReader opens the archive, counting the bytes read from it in
+// archiveProgress, out of --archiveSize or the size of the archive file.
+// Compressed archives are counted before they are decompressed.
 func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 	if restore.InputOptions.Archive == "-" {
 		rc = ioutil.NopCloser(restore.InputReader)
+	} else if storage.IsURL(restore.InputOptions.Archive) {
+		rc, err = storage.Open(restore.InputOptions.Archive)
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		targetStat, err := os.Stat(restore.InputOptions.Archive)
 		if err != nil {
@@ -545,14 +587,52 @@ func (restore *MongoRestore) getArchiveReader() (rc io.ReadCloser, err error) {
 			}
 		}
 	}
+	size := restore.InputOptions.ArchiveSize
+	if size == 0 {
+		size = fileSize(rc)
+		if restore.InputOptions.Archive == "-" {
+			size = fileSize(restore.InputReader)
+		}
+	}
+	counter := progress.NewCounter(size)
+	restore.archiveProgress = counter
+	rc = &countingReadCloser{ReadCloser: rc, counter: counter}
+	buffered := bufio.NewReaderSize(rc, archiveBufferSize)
+
 	if restore.InputOptions.Gzip {
-		gzrc, err := gzip.NewReader(rc)
+		gzrc, err := gzip.NewReader(buffered)
 		if err != nil {
 			return nil, err
 		}
 		return &util.WrappedReadCloser{gzrc, rc}, nil
 	}
-	return rc, nil
+	return &util.WrappedReadCloser{ioutil.NopCloser(buffered), rc}, nil
+}
+
+// fileSize returns the size of r if it is a regular file, such as stdin
+// redirected from one, and 0 otherwise.
+func fileSize(r io.Reader) int64 {
+	file, ok := r.(*os.File)
+	if !ok {
+		return 0
+	}
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return 0
+	}
+	return info.Size()
+}
+
+// countingReadCloser counts the bytes read through it.
+type countingReadCloser struct {
+	io.ReadCloser
+	counter progress.Updateable
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.counter.Inc(int64(n))
+	return n, err
 }
 
 func (restore *MongoRestore) HandleInterrupt() {
@@ -27,7 +27,7 @@ import (
 const oplogMaxCommandSize = 1024 * 1024 * 8
 
 // RestoreOplog attempts to restore a MongoDB oplog.
-func (restore *MongoRestore) RestoreOplog() error {
+func (restore *MongoRestore) RestoreOplog() (err error) {
 	log.Logv(log.Always, "replaying oplog")
 	intent := restore.manager.Oplog()
 	if intent == nil {
@@ -56,7 +56,7 @@ func (restore *MongoRestore) RestoreOplog() error {
 	oplogProgressor := progress.NewCounter(intent.BSONSize)
 	if restore.ProgressManager != nil {
 		restore.ProgressManager.Attach("oplog", oplogProgressor)
-		defer restore.ProgressManager.Detach("oplog")
+		defer func() { progress.Finish(restore.ProgressManager, "oplog", err) }()
 	}
 
 	session, err := restore.SessionProvider.GetSession()
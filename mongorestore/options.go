@@ -22,10 +22,12 @@ type InputOptions struct {
 	OplogReplay            bool   `long:"oplogReplay" description:"replay oplog for point-in-time restore"`
 	OplogLimit             string `long:"oplogLimit" value-name:"<seconds>[:ordinal]" description:"only include oplog entries before the provided Timestamp"`
 	OplogFile              string `long:"oplogFile" value-name:"<filename>" description:"oplog file to use for replay of oplog"`
-	Archive                string `long:"archive" value-name:"<filename>" optional:"true" optional-value:"-" description:"restore dump from the specified archive file.  If flag is specified without a value, archive is read from stdin"`
+	Archive                string `long:"archive" value-name:"<filename>" optional:"true" optional-value:"-" description:"restore dump from the specified archive file, or from an s3://, gs:// or az:// URL of an object in cloud storage.  If flag is specified without a value, archive is read from stdin"`
 	RestoreDBUsersAndRoles bool   `long:"restoreDbUsersAndRoles" description:"restore user and role definitions for the given database"`
 	Directory              string `long:"dir" value-name:"<directory-name>" description:"input directory, use '-' for stdin"`
 	Gzip                   bool   `long:"gzip" description:"decompress gzipped input"`
+	ArchiveSize            int64  `long:"archiveSize" value-name:"<bytes>" description:"size in bytes of the archive read from stdin or a cloud storage URL, e.g. the Content-Length it is downloaded with, to show the progress of reading it; the size of an archive file is known without it"`
+	VerifyManifest         bool   `long:"verifyManifest" description:"check the files of the dump directory against the sizes and SHA-256 checksums of its manifest, then exit without restoring"`
 }
 
 // Name returns a human-readable group name for input options.
@@ -38,6 +40,10 @@ type OutputOptions struct {
 	Drop   bool `long:"drop" description:"drop each collection before import"`
 	DryRun bool `long:"dryRun" description:"view summary without importing anything. recommended with verbosity"`
 
+	// Before restoring, mongorestore checks that the server supports the
+	// collection options and indexes of the dump and has the disk space for it.
+	NoPreflightChecks bool `long:"noPreflightChecks" description:"don't check that the server can restore the dump before restoring anything"`
+
 	// By default mongorestore uses a write concern of 'majority'.
 	// Cannot be used simultaneously with write concern options in a URI.
 	WriteConcern             string `long:"writeConcern" value-name:"<write-concern>" default-mask:"-" description:"write concern options e.g. --writeConcern majority, --writeConcern '{w: 3, wtimeout: 500, fsync: true, j: true}'"`
@@ -0,0 +1,393 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/intents"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// collationVersion is the ICU version of the collations the server supports,
+// which it records in the collations of collections and indexes.
+const collationVersion = "57.1"
+
+// compressionRatio is how many times smaller the documents of a dump may be
+// once the server compresses them, as it does by default.
+const compressionRatio = 4
+
+// targetServer is what the pre-flight checks know of the server restored to.
+type targetServer struct {
+	// version is the server's version, as major, minor and patch numbers
+	version []int
+	// fcv is the featureCompatibilityVersion of the server, or nil if it
+	// isn't known
+	fcv []int
+	// freeDisk is the free space on the disk of the server's data files, in
+	// bytes, or -1 if it isn't known
+	freeDisk int64
+}
+
+// feature is something in a dump that not all servers support.
+type feature struct {
+	name string
+	// since is the first version supporting the feature
+	since [2]int
+	// removed is the first version not supporting the feature anymore, if
+	// it was removed
+	removed [2]int
+}
+
+// PreflightChecks checks that the server can restore the intents, before
+// anything is written: that it supports the collection options and indexes
+// of their metadata, and that it has the disk space for their documents. It
+// reports every problem found, and returns an error if there is any.
+func (restore *MongoRestore) PreflightChecks() error {
+	server, err := restore.getTargetServer()
+	if err != nil {
+		return fmt.Errorf("error checking the server before restoring: %v", err)
+	}
+	log.Logvf(log.DebugLow, "pre-flight checks against server version %v, featureCompatibilityVersion %v",
+		versionString(server.version), versionString(server.fcv))
+	if restore.archive != nil && restore.archive.Prelude.Header != nil {
+		log.Logvf(log.Info, "restoring an archive of server version %v to server version %v",
+			restore.archive.Prelude.Header.ServerVersion, versionString(server.version))
+	}
+
+	var problems []string
+	allIntents := restore.manager.Intents()
+	sort.Sort(byNamespace(allIntents))
+	for _, intent := range allIntents {
+		if intent.MetadataFile == nil {
+			continue
+		}
+		metadata, err := restore.readMetadata(intent)
+		if err != nil {
+			return err
+		}
+		if metadata != nil {
+			problems = append(problems, restore.checkMetadata(intent.Namespace(), metadata, server)...)
+		}
+	}
+	if problem := checkDiskSpace(restore.dumpSize(), server); problem != "" {
+		problems = append(problems, problem)
+	}
+
+	if len(problems) == 0 {
+		log.Logv(log.DebugLow, "pre-flight checks passed")
+		return nil
+	}
+	log.Logv(log.Always, "the server can't restore this dump:")
+	for _, problem := range problems {
+		log.Logvf(log.Always, "\t%v", problem)
+	}
+	return fmt.Errorf("%v pre-flight check(s) failed, nothing was restored; "+
+		"use --noPreflightChecks to restore anyway", len(problems))
+}
+
+// getTargetServer finds the version, featureCompatibilityVersion and free
+// disk space of the server. The last two are left unknown when the server
+// can't report them, as old servers and mongos can't.
+func (restore *MongoRestore) getTargetServer() (*targetServer, error) {
+	session, err := restore.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	buildInfo, err := session.BuildInfo()
+	if err != nil {
+		return nil, fmt.Errorf("error getting the server's version: %v", err)
+	}
+	server := &targetServer{version: buildInfo.VersionArray, freeDisk: -1}
+
+	fcvResult := bson.M{}
+	err = session.DB("admin").Run(bson.D{{"getParameter", 1}, {"featureCompatibilityVersion", 1}}, &fcvResult)
+	if err == nil {
+		// 3.4 reports the version as a string, later versions in a document
+		fcv := fcvResult["featureCompatibilityVersion"]
+		if doc, ok := fcv.(bson.M); ok {
+			fcv = doc["version"]
+		}
+		if s, ok := fcv.(string); ok {
+			server.fcv = parseVersion(s)
+		}
+	} else {
+		log.Logvf(log.DebugLow, "can't get the featureCompatibilityVersion of the server: %v", err)
+	}
+
+	if !restore.isMongos {
+		stats := struct {
+			FSUsedSize  float64 `bson:"fsUsedSize"`
+			FSTotalSize float64 `bson:"fsTotalSize"`
+		}{}
+		err = session.DB("admin").Run(bson.M{"dbStats": 1}, &stats)
+		if err == nil && stats.FSTotalSize > 0 {
+			server.freeDisk = int64(stats.FSTotalSize - stats.FSUsedSize)
+		}
+	}
+	return server, nil
+}
+
+// readMetadata reads and parses the metadata of the intent.
+func (restore *MongoRestore) readMetadata(intent *intents.Intent) (*Metadata, error) {
+	err := intent.MetadataFile.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer intent.MetadataFile.Close()
+	metadataJSON, err := ioutil.ReadAll(intent.MetadataFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading metadata from %v: %v", intent.MetadataLocation, err)
+	}
+	metadata, err := restore.MetadataFromJSON(metadataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing metadata from %v: %v", intent.MetadataLocation, err)
+	}
+	return metadata, nil
+}
+
+// checkMetadata returns the problems restoring the collection options and
+// indexes of a namespace to the server, leaving out those that won't be
+// restored.
+func (restore *MongoRestore) checkMetadata(ns string, metadata *Metadata, server *targetServer) []string {
+	var problems []string
+	if !restore.OutputOptions.NoOptionsRestore {
+		for _, f := range collectionFeatures(metadata.Options) {
+			if problem := server.check(f); problem != "" {
+				problems = append(problems, fmt.Sprintf("collection %v has %v", ns, problem))
+			}
+		}
+		if collation, ok := documentField(metadata.Options, "collation"); ok {
+			if problem := checkCollation(collation); problem != "" {
+				problems = append(problems, fmt.Sprintf("collection %v has %v", ns, problem))
+			}
+		}
+	}
+	if restore.OutputOptions.NoIndexRestore {
+		return problems
+	}
+	for _, index := range metadata.Indexes {
+		name, _ := index.Options["name"].(string)
+		for _, f := range indexFeatures(index, restore.OutputOptions.KeepIndexVersion) {
+			if problem := server.check(f); problem != "" {
+				problems = append(problems, fmt.Sprintf("index %v of %v has %v", name, ns, problem))
+			}
+		}
+		if collation, ok := index.Options["collation"]; ok {
+			if problem := checkCollation(collation); problem != "" {
+				problems = append(problems, fmt.Sprintf("index %v of %v has %v", name, ns, problem))
+			}
+		}
+	}
+	return problems
+}
+
+// collectionFeatures returns the features used by the options of a
+// collection.
+func collectionFeatures(options bson.D) []feature {
+	var features []feature
+	for _, option := range options {
+		switch option.Name {
+		case "validator":
+			features = append(features, feature{name: "a validator", since: [2]int{3, 2}})
+		case "collation":
+			features = append(features, feature{name: "a collation", since: [2]int{3, 4}})
+		case "viewOn":
+			features = append(features, feature{name: "a view definition", since: [2]int{3, 4}})
+		case "timeseries":
+			features = append(features, feature{name: "time-series options", since: [2]int{5, 0}})
+		case "clusteredIndex":
+			features = append(features, feature{name: "a clustered index", since: [2]int{5, 3}})
+		}
+	}
+	return features
+}
+
+// indexFeatures returns the features used by an index. Its version is only
+// checked when it is kept.
+func indexFeatures(index IndexDocument, keepVersion bool) []feature {
+	var features []feature
+	for _, key := range index.Key {
+		switch {
+		case key.Name == "$**" || strings.HasSuffix(key.Name, ".$**"):
+			features = append(features, feature{name: "a wildcard key", since: [2]int{4, 2}})
+		case key.Value == "geoHaystack":
+			features = append(features, feature{name: "a geoHaystack key", removed: [2]int{5, 0}})
+		}
+	}
+	if version, ok := index.Options["2dsphereIndexVersion"]; ok && numberAtLeast(version, 3) {
+		features = append(features, feature{name: "2dsphere index version 3", since: [2]int{3, 2}})
+	}
+	if version, ok := index.Options["textIndexVersion"]; ok && numberAtLeast(version, 3) {
+		features = append(features, feature{name: "text index version 3", since: [2]int{3, 2}})
+	}
+	if version, ok := index.Options["v"]; ok && keepVersion && numberAtLeast(version, 2) {
+		features = append(features, feature{name: "index version 2", since: [2]int{3, 4}})
+	}
+	if index.PartialFilterExpression != nil {
+		features = append(features, feature{name: "a partial filter expression", since: [2]int{3, 2}})
+	}
+	if _, ok := index.Options["collation"]; ok {
+		features = append(features, feature{name: "a collation", since: [2]int{3, 4}})
+	}
+	if hidden, ok := index.Options["hidden"].(bool); ok && hidden {
+		features = append(features, feature{name: "the hidden option", since: [2]int{4, 4}})
+	}
+	return features
+}
+
+// checkCollation returns the problem with a collation, if its ICU version
+// isn't the one the server supports.
+func checkCollation(collation interface{}) string {
+	version, ok := documentField(collation, "version")
+	if ok && version != collationVersion {
+		return fmt.Sprintf("a collation of ICU version %v, but servers only support version %v",
+			version, collationVersion)
+	}
+	return ""
+}
+
+// documentField returns the value of a field of a document, as metadata can
+// be parsed into any of bson.D, bson.M and map[string]interface{}.
+func documentField(doc interface{}, name string) (interface{}, bool) {
+	switch d := doc.(type) {
+	case bson.D:
+		for _, elem := range d {
+			if elem.Name == name {
+				return elem.Value, true
+			}
+		}
+	case bson.M:
+		value, ok := d[name]
+		return value, ok
+	case map[string]interface{}:
+		value, ok := d[name]
+		return value, ok
+	}
+	return nil, false
+}
+
+// check returns the problem restoring the feature to the server, or "" if
+// the server supports it.
+func (s *targetServer) check(f feature) string {
+	switch {
+	case versionBefore(s.version, f.since):
+		return fmt.Sprintf("%v, which requires MongoDB %v.%v or later, but the server is %v",
+			f.name, f.since[0], f.since[1], versionString(s.version))
+	case s.fcv != nil && versionBefore(s.fcv, f.since):
+		return fmt.Sprintf("%v, which requires a featureCompatibilityVersion of %v.%v or later, but the server's is %v",
+			f.name, f.since[0], f.since[1], versionString(s.fcv))
+	case f.removed != [2]int{} && !versionBefore(s.version, f.removed):
+		return fmt.Sprintf("%v, which MongoDB %v.%v and later don't support, but the server is %v",
+			f.name, f.removed[0], f.removed[1], versionString(s.version))
+	}
+	return ""
+}
+
+// checkDiskSpace returns the problem restoring a dump of the given size to
+// the server, if it doesn't have the disk space for it. The server compresses
+// the documents of the dump, so only a dump that can't fit even once
+// compressed fails the check.
+func checkDiskSpace(dumpSize int64, server *targetServer) string {
+	if server.freeDisk < 0 || dumpSize == 0 {
+		return ""
+	}
+	log.Logvf(log.DebugLow, "restoring %v to a disk with %v free",
+		text.FormatByteAmount(dumpSize), text.FormatByteAmount(server.freeDisk))
+	if dumpSize > server.freeDisk*compressionRatio {
+		return fmt.Sprintf("the dump holds %v of documents, which can't fit in the %v free on the server's disk",
+			text.FormatByteAmount(dumpSize), text.FormatByteAmount(server.freeDisk))
+	}
+	return ""
+}
+
+// dumpSize returns the size of the dump, or 0 if it isn't known: the size of
+// the archive, or the sum of the sizes of the files of the intents.
+func (restore *MongoRestore) dumpSize() int64 {
+	if restore.InputOptions.Archive != "" {
+		if restore.archiveProgress == nil {
+			return 0
+		}
+		_, size := restore.archiveProgress.Progress()
+		return size
+	}
+	var size int64
+	for _, intent := range restore.manager.Intents() {
+		size += intent.Size
+	}
+	return size
+}
+
+// byNamespace sorts intents by their namespaces, for the problems found with
+// them to be reported in that order.
+type byNamespace []*intents.Intent
+
+func (s byNamespace) Len() int           { return len(s) }
+func (s byNamespace) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byNamespace) Less(i, j int) bool { return s[i].Namespace() < s[j].Namespace() }
+
+// versionBefore returns whether the version is before major.minor.
+func versionBefore(version []int, since [2]int) bool {
+	for i := range since {
+		v := 0
+		if i < len(version) {
+			v = version[i]
+		}
+		if v != since[i] {
+			return v < since[i]
+		}
+	}
+	return false
+}
+
+// parseVersion parses a version such as "4.0" into its numbers.
+func parseVersion(s string) []int {
+	var version []int
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return nil
+		}
+		version = append(version, n)
+	}
+	return version
+}
+
+func versionString(version []int) string {
+	if version == nil {
+		return "unknown"
+	}
+	parts := make([]string, 0, 3)
+	for i := 0; i < len(version) && i < 3; i++ {
+		parts = append(parts, strconv.Itoa(version[i]))
+	}
+	return strings.Join(parts, ".")
+}
+
+// numberAtLeast returns whether a number of any of the types metadata can be
+// parsed into is at least min.
+func numberAtLeast(value interface{}, min float64) bool {
+	switch n := value.(type) {
+	case int:
+		return float64(n) >= min
+	case int32:
+		return float64(n) >= min
+	case int64:
+		return float64(n) >= min
+	case float64:
+		return n >= min
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongorestore
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckMetadata(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With the metadata of a collection using features of recent servers", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		metadata, err := restore.MetadataFromJSON([]byte(`{
+			"options": {"collation": {"locale": "fr", "version": "57.1"}, "timeseries": {"timeField": "t"}},
+			"indexes": [
+				{"v": 2, "key": {"_id": 1}, "name": "_id_", "ns": "test.c"},
+				{"v": 2, "key": {"$**": 1}, "name": "wildcard", "ns": "test.c"},
+				{"v": 2, "key": {"loc": "geoHaystack", "kind": 1}, "name": "haystack", "ns": "test.c", "bucketSize": 1}
+			]}`))
+		So(err, ShouldBeNil)
+
+		Convey("a server supporting all of them should have no problems restoring it", func() {
+			server := &targetServer{version: []int{5, 0, 3}, fcv: []int{5, 0}}
+			restore.OutputOptions.NoIndexRestore = true
+			So(restore.checkMetadata("test.c", metadata, server), ShouldBeEmpty)
+		})
+
+		Convey("a server too old for them should have a problem with each", func() {
+			server := &targetServer{version: []int{4, 0, 1}}
+			problems := restore.checkMetadata("test.c", metadata, server)
+			So(problems, ShouldResemble, []string{
+				"collection test.c has time-series options, which requires MongoDB 5.0 or later, but the server is 4.0.1",
+				"index wildcard of test.c has a wildcard key, which requires MongoDB 4.2 or later, but the server is 4.0.1",
+			})
+		})
+
+		Convey("an older featureCompatibilityVersion should be a problem", func() {
+			server := &targetServer{version: []int{5, 0, 3}, fcv: []int{4, 4}}
+			restore.OutputOptions.NoIndexRestore = true
+			problems := restore.checkMetadata("test.c", metadata, server)
+			So(problems, ShouldHaveLength, 1)
+			So(problems[0], ShouldContainSubstring, "featureCompatibilityVersion of 5.0")
+		})
+
+		Convey("features removed from newer servers should be a problem", func() {
+			server := &targetServer{version: []int{5, 0, 3}}
+			problems := restore.checkMetadata("test.c", metadata, server)
+			So(problems, ShouldHaveLength, 1)
+			So(problems[0], ShouldContainSubstring, "geoHaystack")
+		})
+
+		Convey("options that won't be restored should not be checked", func() {
+			server := &targetServer{version: []int{3, 2, 0}}
+			restore.OutputOptions.NoOptionsRestore = true
+			restore.OutputOptions.NoIndexRestore = true
+			So(restore.checkMetadata("test.c", metadata, server), ShouldBeEmpty)
+		})
+	})
+
+	Convey("A collation of another ICU version should be a problem", t, func() {
+		restore := &MongoRestore{OutputOptions: &OutputOptions{}}
+		metadata, err := restore.MetadataFromJSON([]byte(`{
+			"options": {"collation": {"locale": "fr", "version": "60.2"}}, "indexes": []}`))
+		So(err, ShouldBeNil)
+		problems := restore.checkMetadata("test.c", metadata, &targetServer{version: []int{4, 4, 0}})
+		So(problems, ShouldHaveLength, 1)
+		So(problems[0], ShouldContainSubstring, "ICU version 60.2")
+	})
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A dump should only fail the disk space check if it can't fit compressed", t, func() {
+		server := &targetServer{freeDisk: 1024}
+		So(checkDiskSpace(4*1024, server), ShouldEqual, "")
+		So(checkDiskSpace(4*1024+1, server), ShouldContainSubstring, "can't fit")
+		So(checkDiskSpace(1<<40, &targetServer{freeDisk: -1}), ShouldEqual, "")
+	})
+}
+
+func TestVersionBefore(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Versions should be compared by their major and minor numbers", t, func() {
+		So(versionBefore([]int{3, 6, 8}, [2]int{4, 0}), ShouldBeTrue)
+		So(versionBefore([]int{4, 0, 0}, [2]int{4, 0}), ShouldBeFalse)
+		So(versionBefore([]int{10, 0}, [2]int{4, 2}), ShouldBeFalse)
+		So(versionBefore(parseVersion("4.4"), [2]int{4, 4}), ShouldBeFalse)
+	})
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/intents"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/progress"
+	"github.com/mongodb/mongo-tools/common/trace"
 	"github.com/mongodb/mongo-tools/common/util"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -86,7 +87,10 @@ func (restore *MongoRestore) RestoreIntents() error {
 }
 
 // RestoreIntent attempts to restore a given intent into MongoDB.
-func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
+func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) (err error) {
+	span := trace.Start("restore collection")
+	span.SetAttribute("db.namespace", intent.Namespace())
+	defer func() { span.End(err) }()
 
 	collectionExists, err := restore.CollectionExists(intent)
 	if err != nil {
@@ -239,7 +243,7 @@ func (restore *MongoRestore) RestoreIntent(intent *intents.Intent) error {
 // RestoreCollectionToDB pipes the given BSON data into the database.
 // Returns the number of documents restored and any errors that occurred.
 func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
-	bsonSource *db.DecodedBSONSource, file PosReader, fileSize int64) (int64, error) {
+	bsonSource *db.DecodedBSONSource, file PosReader, fileSize int64) (_ int64, err error) {
 
 	var termErr error
 	session, err := restore.SessionProvider.GetSession()
@@ -256,7 +260,7 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 	if restore.ProgressManager != nil {
 		name := fmt.Sprintf("%v.%v", dbName, colName)
 		restore.ProgressManager.Attach(name, watchProgressor)
-		defer restore.ProgressManager.Detach(name)
+		defer func() { progress.Finish(restore.ProgressManager, name, err) }()
 	}
 
 	maxInsertWorkers := restore.OutputOptions.NumInsertionWorkers
@@ -298,6 +302,7 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 			coll := collection.With(s)
 			bulk := db.NewBufferedBulkInserter(
 				coll, restore.OutputOptions.BulkBufferSize, !restore.OutputOptions.StopOnError)
+			bulk.SetLimiter(restore.Limiter)
 			for rawDoc := range docChan {
 				if restore.objCheck {
 					err := bson.Unmarshal(rawDoc.Data, &bson.D{})
@@ -306,6 +311,14 @@ func (restore *MongoRestore) RestoreCollectionToDB(dbName, colName string,
 						return
 					}
 				}
+				if restore.Encryption != nil {
+					data, err := restore.Encryption.EncryptRaw(dbName+"."+colName, rawDoc.Data)
+					if err != nil {
+						resultChan <- err
+						return
+					}
+					rawDoc = bson.Raw{Data: data}
+				}
 				if err := bulk.Insert(rawDoc); err != nil {
 					if db.IsConnectionError(err) || restore.OutputOptions.StopOnError {
 						// Propagate this error, since it's either a fatal connection error
@@ -8,11 +8,14 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
+	"github.com/mongodb/mongo-tools/common/diagnose"
+	"github.com/mongodb/mongo-tools/common/failure"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/password"
@@ -24,18 +27,29 @@ import (
 	"github.com/mongodb/mongo-tools/mongostat/status"
 )
 
+// splitColumn separates a column specification into the field to read and
+// the header to display it under. The header follows the first '=', or the
+// last ':' if there is no '=', e.g. "metrics.commands.find.total:finds";
+// without either, the field name is used as the header.
+func splitColumn(column string) (field, header string) {
+	if strings.Contains(column, "=") {
+		naming := strings.Split(column, "=")
+		return naming[0], naming[1]
+	}
+	if i := strings.LastIndex(column, ":"); i != -1 {
+		return column[:i], column[i+1:]
+	}
+	return column, column
+}
+
 // optionKeyNames interprets the CLI options Columns and AppendColumns into
 // the internal keyName mapping.
 func optionKeyNames(option string) map[string]string {
 	kn := make(map[string]string)
 	columns := strings.Split(option, ",")
 	for _, column := range columns {
-		naming := strings.Split(column, "=")
-		if len(naming) == 1 {
-			kn[naming[0]] = naming[0]
-		} else {
-			kn[naming[0]] = naming[1]
-		}
+		field, header := splitColumn(column)
+		kn[field] = header
 	}
 	return kn
 }
@@ -45,12 +59,35 @@ func optionKeyNames(option string) map[string]string {
 func optionCustomHeaders(option string) (headers []string) {
 	columns := strings.Split(option, ",")
 	for _, column := range columns {
-		naming := strings.Split(column, "=")
-		headers = append(headers, naming[0])
+		field, _ := splitColumn(column)
+		headers = append(headers, field)
 	}
 	return
 }
 
+// loadBaseline reads the session recorded in the --baseline file.
+func loadBaseline(filename string) (*stat_consumer.Baseline, error) {
+	file, err := os.Open(util.ToUniversalPath(filename))
+	if err != nil {
+		return nil, fmt.Errorf("error opening baseline file: %v", err)
+	}
+	defer file.Close()
+	return stat_consumer.LoadBaseline(file)
+}
+
+// rfc3339Milli is time.RFC3339 with milliseconds, for sub-second intervals.
+const rfc3339Milli = "2006-01-02T15:04:05.000Z07:00"
+
+// replay shows the session recorded in the --replay file.
+func replay(filename string, interval time.Duration, consumer *stat_consumer.StatConsumer) error {
+	file, err := os.Open(util.ToUniversalPath(filename))
+	if err != nil {
+		return fmt.Errorf("error opening replay file: %v", err)
+	}
+	defer file.Close()
+	return mongostat.Replay(file, interval, consumer)
+}
+
 func main() {
 	// initialize command-line opts
 	opts := options.New(
@@ -78,22 +115,19 @@ func main() {
 	}
 
 	log.SetVerbosity(opts.Verbosity)
+	log.SetFormat(opts.LogFormat, opts.AppName)
 	signals.Handle()
 
-	sleepInterval := 1
+	sleepInterval := time.Second
 	if len(args) > 0 {
 		if len(args) != 1 {
 			log.Logvf(log.Always, "too many positional arguments: %v", args)
 			log.Logvf(log.Always, "try 'mongostat --help' for more information")
 			os.Exit(util.ExitBadOptions)
 		}
-		sleepInterval, err = strconv.Atoi(args[0])
+		sleepInterval, err = util.ParseInterval(args[0])
 		if err != nil {
-			log.Logvf(log.Always, "invalid sleep interval: %v", args[0])
-			os.Exit(util.ExitBadOptions)
-		}
-		if sleepInterval < 1 {
-			log.Logvf(log.Always, "sleep interval must be at least 1 second")
+			log.Logvf(log.Always, "invalid sleep interval: %v", err)
 			os.Exit(util.ExitBadOptions)
 		}
 	}
@@ -111,14 +145,13 @@ func main() {
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
-	if opts.Auth.Username != "" && opts.GetAuthenticationDatabase() == "" && !opts.Auth.RequiresExternalDB() {
-		// add logic to have different error if using uri
-		if opts.URI != nil && opts.URI.ConnectionString != "" {
-			log.Logvf(log.Always, "authSource is required when authenticating against a non $external database")
-			os.Exit(util.ExitBadOptions)
-		}
+	// test connecting to the server step by step, if specified
+	if opts.Diagnose {
+		os.Exit(diagnose.Run(opts, os.Stdout))
+	}
 
-		log.Logvf(log.Always, "--authenticationDatabase is required when authenticating against a non $external database")
+	if err := opts.RejectProgressEvents(); err != nil {
+		log.Logvf(log.Always, "%v", err)
 		os.Exit(util.ExitBadOptions)
 	}
 
@@ -127,6 +160,118 @@ func main() {
 		os.Exit(util.ExitBadOptions)
 	}
 
+	if statOpts.Format != "" {
+		if statOpts.Json || statOpts.Interactive || statOpts.CSV || statOpts.Prometheus != "" {
+			log.Logvf(log.Always, "cannot use --format with --json, --interactive, --csv or --prometheus")
+			os.Exit(util.ExitBadOptions)
+		}
+		if statOpts.Columns != "" || statOpts.AppendColumns != "" || statOpts.Sparklines > 0 {
+			log.Logvf(log.Always, "cannot use --format with -o, -O or --sparklines, since its fields are fixed")
+			os.Exit(util.ExitBadOptions)
+		}
+	}
+
+	if strings.HasSuffix(strings.ToLower(statOpts.Out), ".csv") && !statOpts.Json && statOpts.Format == "" {
+		statOpts.CSV = true
+	}
+	if statOpts.CSV && (statOpts.Json || statOpts.Interactive) {
+		log.Logvf(log.Always, "cannot use --csv with --json or --interactive")
+		os.Exit(util.ExitBadOptions)
+	}
+	if statOpts.Out != "" && (statOpts.Interactive || statOpts.Prometheus != "") {
+		log.Logvf(log.Always, "cannot use --out with --interactive or --prometheus")
+		os.Exit(util.ExitBadOptions)
+	}
+	if statOpts.Sparklines < 0 {
+		log.Logvf(log.Always, "--sparklines cannot be negative")
+		os.Exit(util.ExitBadOptions)
+	}
+	if statOpts.Sparklines > 0 && (statOpts.Json || statOpts.CSV || statOpts.Prometheus != "") {
+		log.Logvf(log.Always, "--sparklines can only be used with table or interactive output")
+		os.Exit(util.ExitBadOptions)
+	}
+	if statOpts.Baseline != "" && (statOpts.Json || statOpts.Format != "" || statOpts.CSV || statOpts.Prometheus != "") {
+		log.Logvf(log.Always, "--baseline can only be used with table or interactive output")
+		os.Exit(util.ExitBadOptions)
+	}
+	if statOpts.RotateInterval != 0 {
+		if statOpts.Out == "" {
+			log.Logvf(log.Always, "--rotateInterval can only be used when --out is also specified")
+			os.Exit(util.ExitBadOptions)
+		}
+		if statOpts.RotateInterval < time.Second {
+			log.Logvf(log.Always, "--rotateInterval must be at least one second")
+			os.Exit(util.ExitBadOptions)
+		}
+	}
+
+	if statOpts.Prometheus != "" && (statOpts.Json || statOpts.Interactive) {
+		log.Logvf(log.Always, "cannot use --prometheus with --json or --interactive")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	var alertRules []stat_consumer.AlertRule
+	if statOpts.Alert != "" {
+		if statOpts.Prometheus != "" {
+			log.Logvf(log.Always, "cannot use --alert with --prometheus")
+			os.Exit(util.ExitBadOptions)
+		}
+		if statOpts.AlertSamples < 1 {
+			log.Logvf(log.Always, "--alertSamples must be at least 1")
+			os.Exit(util.ExitBadOptions)
+		}
+		alertRules, err = stat_consumer.ParseAlertRules(statOpts.Alert)
+		if err != nil {
+			log.Logvf(log.Always, "%v", err)
+			os.Exit(util.ExitBadOptions)
+		}
+	} else if statOpts.AlertWebhook != "" || statOpts.AlertExit {
+		log.Logvf(log.Always, "--alertWebhook and --alertExit can only be used when --alert is also specified")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if statOpts.Shards && (statOpts.Discover || statOpts.PerDatabase || statOpts.Replay != "") {
+		log.Logvf(log.Always, "cannot use --shards with --discover, --perDatabase or --replay")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if statOpts.PerDatabase {
+		if statOpts.Columns != "" || statOpts.AppendColumns != "" || statOpts.All {
+			log.Logvf(log.Always, "cannot use --perDatabase with -o, -O or --all")
+			os.Exit(util.ExitBadOptions)
+		}
+		if statOpts.Prometheus != "" {
+			log.Logvf(log.Always, "cannot use --perDatabase with --prometheus")
+			os.Exit(util.ExitBadOptions)
+		}
+	}
+
+	if statOpts.WiredTiger && (statOpts.Columns != "" || statOpts.AppendColumns != "" ||
+		statOpts.All || statOpts.PerDatabase) {
+		log.Logvf(log.Always, "cannot use --wt with -o, -O, --all or --perDatabase")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if statOpts.Latency && (statOpts.Columns != "" || statOpts.PerDatabase || statOpts.WiredTiger) {
+		log.Logvf(log.Always, "cannot use --latency with -o, --perDatabase or --wt; use -o r_lat,w_lat,c_lat instead")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if statOpts.Replay != "" {
+		if statOpts.Record != "" || statOpts.Interactive || statOpts.Prometheus != "" || statOpts.Discover {
+			log.Logvf(log.Always, "cannot use --replay with --record, --interactive, --prometheus or --discover")
+			os.Exit(util.ExitBadOptions)
+		}
+		if statOpts.InfluxURL != "" || statOpts.GraphiteAddr != "" {
+			log.Logvf(log.Always, "cannot use --replay with --influxUrl or --graphiteAddr")
+			os.Exit(util.ExitBadOptions)
+		}
+	}
+	if statOpts.Record != "" && statOpts.Prometheus != "" {
+		log.Logvf(log.Always, "cannot use --record with --prometheus")
+		os.Exit(util.ExitBadOptions)
+	}
+
 	if statOpts.Deprecated && !statOpts.Json {
 		log.Logvf(log.Always, "--useDeprecatedJsonKeys can only be used when --json is also specified")
 		os.Exit(util.ExitBadOptions)
@@ -149,17 +294,30 @@ func main() {
 	}
 
 	var factory stat_consumer.FormatterConstructor
-	if statOpts.Json {
+	if statOpts.Format == "json" {
+		factory = stat_consumer.FormatterConstructors["sample"]
+	} else if statOpts.Json {
 		factory = stat_consumer.FormatterConstructors["json"]
+	} else if statOpts.CSV {
+		factory = stat_consumer.FormatterConstructors["csv"]
 	} else if statOpts.Interactive {
 		factory = stat_consumer.FormatterConstructors["interactive"]
 	} else {
 		factory = stat_consumer.FormatterConstructors[""]
 	}
 	formatter := factory(statOpts.RowCount, !statOpts.NoHeaders)
+	if highlighter, ok := formatter.(stat_consumer.Highlighter); ok && len(alertRules) > 0 {
+		highlighter.SetHighlights(alertRules)
+	}
+
+	// the hosts of the connection string, or of --host
+	seedHosts := util.CreateConnectionAddrs(opts.Host, opts.Port)
+	if opts.URI != nil && opts.URI.ConnectionString != "" {
+		seedHosts = opts.URI.GetConnectionAddrs()
+	}
 
 	cliFlags := 0
-	if statOpts.Columns == "" {
+	if statOpts.Columns == "" && !statOpts.PerDatabase && !statOpts.WiredTiger {
 		cliFlags = line.FlagAlways
 		if statOpts.Discover {
 			cliFlags |= line.FlagDiscover
@@ -168,13 +326,23 @@ func main() {
 		if statOpts.All {
 			cliFlags |= line.FlagAll
 		}
-		if strings.Contains(opts.Host, ",") {
+		if statOpts.Latency {
+			cliFlags |= line.FlagLatency
+		}
+		if len(seedHosts) > 1 || statOpts.Replay != "" || statOpts.Shards {
 			cliFlags |= line.FlagHosts
 		}
 	}
 
 	var customHeaders []string
-	if statOpts.Columns != "" {
+	if statOpts.PerDatabase {
+		customHeaders = line.DatabaseHeaders
+	} else if statOpts.WiredTiger {
+		customHeaders = line.WiredTigerHeaders
+		if statOpts.Discover || strings.Contains(opts.Host, ",") {
+			customHeaders = append([]string{"host"}, customHeaders...)
+		}
+	} else if statOpts.Columns != "" {
 		customHeaders = optionCustomHeaders(statOpts.Columns)
 	} else if statOpts.AppendColumns != "" {
 		customHeaders = optionCustomHeaders(statOpts.AppendColumns)
@@ -200,13 +368,77 @@ func main() {
 	}
 	if statOpts.Json {
 		readerConfig.TimeFormat = "15:04:05"
+	} else if statOpts.CSV {
+		// CSV logs can span days, so the date is needed too
+		readerConfig.TimeFormat = time.RFC3339
+	}
+	if sleepInterval < time.Second {
+		// show when each sample was taken to the millisecond
+		switch {
+		case statOpts.Json:
+			readerConfig.TimeFormat = "15:04:05.000"
+		case statOpts.CSV || !readerConfig.HumanReadable:
+			readerConfig.TimeFormat = rfc3339Milli
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if statOpts.Out != "" {
+		outFile, err := mongostat.NewRotatingFile(statOpts.Out, statOpts.RotateInterval)
+		if err != nil {
+			log.Logvf(log.Always, "%v", err)
+			os.Exit(failure.ExitCode(err))
+		}
+		outFile.RepeatHeader = statOpts.CSV && !statOpts.NoHeaders
+		defer outFile.Close()
+		out = outFile
+	}
+
+	// render sub-second samples in batches, rather than writing to the
+	// terminal many times a second
+	var batch *util.BatchWriter
+	if sleepInterval < time.Second && !statOpts.Interactive {
+		batch = util.NewBatchWriter(out, time.Second)
+		out = batch
 	}
 
 	consumer := stat_consumer.NewStatConsumer(cliFlags, customHeaders,
-		keyNames, readerConfig, formatter, os.Stdout)
-	seedHosts := util.CreateConnectionAddrs(opts.Host, opts.Port)
+		keyNames, readerConfig, formatter, out)
+	if statOpts.Sparklines > 0 {
+		consumer.Trends = stat_consumer.NewTrendTracker(statOpts.Sparklines)
+	}
+	if statOpts.Baseline != "" {
+		consumer.Baseline, err = loadBaseline(statOpts.Baseline)
+		if err != nil {
+			log.Logvf(log.Always, "%v", err)
+			os.Exit(failure.ExitCode(err))
+		}
+	}
+	if len(alertRules) > 0 {
+		consumer.Alerts = stat_consumer.NewAlertMonitor(alertRules, statOpts.AlertSamples, os.Stderr)
+		consumer.Alerts.Webhook = statOpts.AlertWebhook
+		consumer.Alerts.ExitOnAlert = statOpts.AlertExit
+	}
+	if statOpts.Replay != "" {
+		err = replay(statOpts.Replay, sleepInterval, consumer)
+		formatter.Finish()
+		if batch != nil {
+			batch.Close()
+		}
+		if err != nil {
+			log.Logvf(log.Always, "Failed: %v", err)
+			os.Exit(failure.ExitCode(err))
+		}
+		if consumer.Alerts != nil && consumer.Alerts.ExitOnAlert && consumer.Alerts.Fired() {
+			os.Exit(util.ExitError)
+		}
+		return
+	}
+
 	var cluster mongostat.ClusterMonitor
-	if statOpts.Discover || len(seedHosts) > 1 {
+	if statOpts.Prometheus != "" {
+		cluster = mongostat.NewPrometheusClusterMonitor(statOpts.Prometheus)
+	} else if statOpts.Discover || statOpts.PerDatabase || statOpts.Shards || len(seedHosts) > 1 {
 		cluster = &mongostat.AsyncClusterMonitor{
 			ReportChan:    make(chan *status.ServerStatus),
 			ErrorChan:     make(chan *status.NodeError),
@@ -221,6 +453,35 @@ func main() {
 		}
 	}
 
+	var shardTotals *mongostat.ShardTotalsClusterMonitor
+	var shardsChan chan mongostat.ConfigShard
+	if statOpts.Shards {
+		shardTotals = mongostat.NewShardTotalsClusterMonitor(cluster)
+		cluster = shardTotals
+		shardsChan = make(chan mongostat.ConfigShard, 128)
+	}
+
+	var sinks []mongostat.MetricSink
+	if statOpts.InfluxURL != "" {
+		sinks = append(sinks, mongostat.NewInfluxSink(statOpts.InfluxURL))
+	}
+	if statOpts.GraphiteAddr != "" {
+		sinks = append(sinks, mongostat.NewGraphiteSink(statOpts.GraphiteAddr, statOpts.GraphitePrefix))
+	}
+	if len(sinks) > 0 {
+		cluster = &mongostat.SinkClusterMonitor{ClusterMonitor: cluster, Sinks: sinks}
+	}
+
+	if statOpts.Record != "" {
+		recordFile, err := os.Create(util.ToUniversalPath(statOpts.Record))
+		if err != nil {
+			log.Logvf(log.Always, "error creating record file: %v", err)
+			os.Exit(failure.ExitCode(err))
+		}
+		defer recordFile.Close()
+		cluster = &mongostat.RecordingClusterMonitor{ClusterMonitor: cluster, Out: recordFile}
+	}
+
 	var discoverChan chan string
 	if statOpts.Discover {
 		discoverChan = make(chan string, 128)
@@ -228,12 +489,14 @@ func main() {
 
 	opts.Direct = true
 	stat := &mongostat.MongoStat{
-		Options:       opts,
-		StatOptions:   statOpts,
-		Nodes:         map[string]*mongostat.NodeMonitor{},
-		Discovered:    discoverChan,
-		SleepInterval: time.Duration(sleepInterval) * time.Second,
-		Cluster:       cluster,
+		Options:          opts,
+		StatOptions:      statOpts,
+		Nodes:            map[string]*mongostat.NodeMonitor{},
+		Discovered:       discoverChan,
+		DiscoveredShards: shardsChan,
+		ShardTotals:      shardTotals,
+		SleepInterval:    sleepInterval,
+		Cluster:          cluster,
 	}
 
 	for _, v := range seedHosts {
@@ -243,8 +506,14 @@ func main() {
 	// kick it off
 	err = stat.Run()
 	formatter.Finish()
+	if batch != nil {
+		batch.Close()
+	}
 	if err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
+		os.Exit(failure.ExitCode(err))
+	}
+	if consumer.Alerts != nil && consumer.Alerts.ExitOnAlert && consumer.Alerts.Fired() {
 		os.Exit(util.ExitError)
 	}
 }
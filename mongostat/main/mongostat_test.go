@@ -0,0 +1,46 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOptionKeyNames(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Column specifications should map fields to their headers", t, func() {
+		tests := []struct {
+			option   string
+			expected map[string]string
+		}{
+			{"insert,query", map[string]string{"insert": "insert", "query": "query"}},
+			{"host=server", map[string]string{"host": "server"}},
+			{"metrics.commands.find.total:finds", map[string]string{"metrics.commands.find.total": "finds"}},
+			{"metrics.document.inserted.rate():ins,conn", map[string]string{
+				"metrics.document.inserted.rate()": "ins",
+				"conn":                             "conn",
+			}},
+			// with '=', ':' belongs to the field or the header
+			{"host=h:port", map[string]string{"host": "h:port"}},
+			{"a:b=c", map[string]string{"a:b": "c"}},
+			{"a=b=c", map[string]string{"a": "b"}},
+			{"a:b:c", map[string]string{"a:b": "c"}},
+		}
+		for _, test := range tests {
+			So(optionKeyNames(test.option), ShouldResemble, test.expected)
+		}
+	})
+
+	Convey("Custom headers should list the fields of the columns", t, func() {
+		So(optionCustomHeaders("host=server,a:b=c,metrics.x:y,conn"), ShouldResemble,
+			[]string{"host", "a:b", "metrics.x", "conn"})
+	})
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"github.com/mongodb/mongo-tools/common/util"
 	"github.com/mongodb/mongo-tools/mongostat/stat_consumer"
 	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
 	"github.com/mongodb/mongo-tools/mongostat/status"
@@ -38,6 +39,13 @@ type MongoStat struct {
 	// on this channel.
 	Discovered chan string
 
+	// With --shards, the shards of the cluster are sent on this channel by
+	// the mongos being monitored.
+	DiscoveredShards chan ConfigShard
+
+	// ShardTotals, if set, adds a row with the totals of all shards.
+	ShardTotals *ShardTotalsClusterMonitor
+
 	// A map of hostname -> NodeMonitor for all the hosts that
 	// are being monitored.
 	Nodes map[string]*NodeMonitor
@@ -56,12 +64,39 @@ type ConfigShard struct {
 	Host string `bson:"host"`
 }
 
+// ConfigMongos holds the format of routers as they appear in the
+// config.mongos collection.
+type ConfigMongos struct {
+	Host string    `bson:"_id"`
+	Ping time.Time `bson:"ping"`
+}
+
+// activeMongosWindow is how recently a mongos must have pinged the config
+// servers to be discovered; config.mongos keeps entries for routers that
+// have long been shut down.
+const activeMongosWindow = 10 * time.Minute
+
 // NodeMonitor contains the connection pool for a single host and collects the
 // mongostat data for that host on a regular interval.
 type NodeMonitor struct {
 	host, alias     string
 	sessionProvider *db.SessionProvider
 
+	// perDatabase makes the monitor collect counters for every database.
+	perDatabase bool
+
+	// latencyHistograms makes the monitor ask for the histograms of
+	// serverStatus opLatencies, from which percentiles are computed.
+	latencyHistograms bool
+
+	// primary makes the monitor read from the primary of a replica set,
+	// rather than the single host it is connected to.
+	primary bool
+
+	// shards, if set, receives the shards of the cluster when the monitored
+	// host is a mongos.
+	shards chan ConfigShard
+
 	// The time at which the node monitor last processed an update successfully.
 	LastUpdate time.Time
 
@@ -228,18 +263,11 @@ func (cluster *AsyncClusterMonitor) Monitor(sleep time.Duration) error {
 	return nil
 }
 
-// NewNodeMonitor copies the same connection settings from an instance of
-// ToolOptions, but monitors fullHost.
+// NewNodeMonitor copies the same connection settings and credentials from an
+// instance of ToolOptions, but monitors fullHost.
 func NewNodeMonitor(opts options.ToolOptions, fullHost string) (*NodeMonitor, error) {
-	optsCopy := opts
 	host, port := parseHostPort(fullHost)
-	optsCopy.Connection = &options.Connection{
-		Host:    host,
-		Port:    port,
-		Timeout: opts.Timeout,
-	}
-	optsCopy.Direct = true
-	sessionProvider, err := db.NewSessionProvider(optsCopy)
+	sessionProvider, err := db.NewSessionProvider(opts.DirectTo(host, port))
 	if err != nil {
 		return nil, err
 	}
@@ -251,6 +279,25 @@ func NewNodeMonitor(opts options.ToolOptions, fullHost string) (*NodeMonitor, er
 	}, nil
 }
 
+// NewShardMonitor copies the same connection settings from an instance of
+// ToolOptions, but monitors the primary of a shard, connecting through its
+// replica set so that a new primary is followed after a failover.
+func NewShardMonitor(opts options.ToolOptions, shard ConfigShard) (*NodeMonitor, error) {
+	optsCopy := opts.DirectTo(shard.Host, "")
+	_, optsCopy.ReplicaSetName = util.ParseConnectionString(shard.Host)
+	optsCopy.Direct = optsCopy.ReplicaSetName == ""
+	sessionProvider, err := db.NewSessionProvider(optsCopy)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeMonitor{
+		host:            shard.Id,
+		sessionProvider: sessionProvider,
+		primary:         true,
+		LastUpdate:      time.Now(),
+	}, nil
+}
+
 // Report collects the stat info for a single node and sends found hostnames on
 // the "discover" channel if checkShards is true.
 func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.ServerStatus, error) {
@@ -266,20 +313,28 @@ func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.S
 	// The read pref for the session must be set to 'secondary' to enable using
 	// the driver with 'direct' connections, which disables the built-in
 	// replset discovery mechanism since we do our own node discovery here.
-	s.SetMode(mgo.Eventual, true)
+	if node.primary {
+		s.SetMode(mgo.Primary, true)
+	} else {
+		s.SetMode(mgo.Eventual, true)
+	}
 
 	// Disable the socket timeout - otherwise if db.serverStatus() takes a long time on the server
 	// side, the client will close the connection early and report an error.
 	s.SetSocketTimeout(0)
 	defer s.Close()
 
-	err = s.DB("admin").Run(bson.D{{"serverStatus", 1}, {"recordStats", 0}}, stat)
+	command := bson.D{{"serverStatus", 1}, {"recordStats", 0}}
+	if node.latencyHistograms {
+		command = append(command, bson.DocElem{"opLatencies", bson.M{"histograms": true}})
+	}
+	err = s.DB("admin").Run(command, stat)
 	if err != nil {
 		log.Logvf(log.DebugLow, "got error calling serverStatus against server %v", node.host)
 		return nil, err
 	}
 	statMap := make(map[string]interface{})
-	s.DB("admin").Run(bson.D{{"serverStatus", 1}, {"recordStats", 0}}, statMap)
+	s.DB("admin").Run(command, statMap)
 	stat.Flattened = status.Flatten(statMap)
 
 	node.Err = nil
@@ -293,8 +348,25 @@ func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.S
 			discover <- host
 		}
 	}
+	if node.perDatabase && !status.IsMongos(stat) {
+		stat.Databases, err = pollDatabases(s)
+		if err != nil {
+			log.Logvf(log.DebugLow, "got error collecting database stats from server %v", node.host)
+			return nil, err
+		}
+	}
+
 	node.alias = stat.Host
 	stat.Host = node.host
+	if node.shards != nil && status.IsMongos(stat) && checkShards {
+		log.Logvf(log.DebugLow, "checking config database to find shards")
+		shardCursor := s.DB("config").C("shards").Find(bson.M{}).Iter()
+		shard := ConfigShard{}
+		for shardCursor.Next(&shard) {
+			node.shards <- shard
+		}
+		shardCursor.Close()
+	}
 	if discover != nil && stat != nil && status.IsMongos(stat) && checkShards {
 		log.Logvf(log.DebugLow, "checking config database to discover shards")
 		shardCursor := s.DB("config").C("shards").Find(bson.M{}).Iter()
@@ -306,11 +378,55 @@ func (node *NodeMonitor) Poll(discover chan string, checkShards bool) (*status.S
 			}
 		}
 		shardCursor.Close()
+
+		log.Logvf(log.DebugLow, "checking config database to discover routers")
+		mongosCursor := s.DB("config").C("mongos").Find(bson.M{
+			"ping": bson.M{"$gt": time.Now().Add(-activeMongosWindow)},
+		}).Iter()
+		mongos := ConfigMongos{}
+		for mongosCursor.Next(&mongos) {
+			discover <- mongos.Host
+		}
+		mongosCursor.Close()
+
+		_, configHosts := status.ConfigServers(stat)
+		for _, configHost := range configHosts {
+			discover <- configHost
+		}
 	}
 
 	return stat, nil
 }
 
+// pollDatabases collects the "top" counters and data size of every database.
+func pollDatabases(s *mgo.Session) ([]*status.DatabaseStats, error) {
+	top := &status.TopStats{}
+	if err := s.DB("admin").Run(bson.D{{"top", 1}}, top); err != nil {
+		return nil, err
+	}
+	counters := status.DatabaseOpcounters(top)
+
+	names, err := s.DatabaseNames()
+	if err != nil {
+		return nil, err
+	}
+	databases := make([]*status.DatabaseStats, 0, len(names))
+	for _, name := range names {
+		dbStats := struct {
+			DataSize int64 `bson:"dataSize"`
+		}{}
+		if err = s.DB(name).Run(bson.D{{"dbStats", 1}}, &dbStats); err != nil {
+			return nil, err
+		}
+		stats := &status.DatabaseStats{Name: name, DataSize: dbStats.DataSize}
+		if ops, ok := counters[name]; ok {
+			stats.Opcounters = *ops
+		}
+		databases = append(databases, stats)
+	}
+	return databases, nil
+}
+
 // Watch continuously collects and processes stats for a single node on a
 // regular interval. At each interval, it triggers the node's Poll function
 // with the 'discover' channel.
@@ -327,7 +443,13 @@ func (node *NodeMonitor) Watch(sleep time.Duration, discover chan string, cluste
 		if err != nil {
 			nodeError = status.NewNodeError(node.host, err)
 		}
-		cluster.Update(stat, nodeError)
+		if stat != nil && stat.Databases != nil {
+			for _, dbStat := range status.SplitDatabases(stat) {
+				cluster.Update(dbStat, nil)
+			}
+		} else {
+			cluster.Update(stat, nodeError)
+		}
 		cycle++
 	}
 }
@@ -363,11 +485,37 @@ func (mstat *MongoStat) AddNewNode(fullhost string) error {
 	if err != nil {
 		return err
 	}
+	node.perDatabase = mstat.StatOptions != nil && mstat.StatOptions.PerDatabase
+	node.latencyHistograms = mstat.StatOptions != nil && mstat.StatOptions.Latency
+	node.shards = mstat.DiscoveredShards
 	mstat.Nodes[fullhost] = node
 	go node.Watch(mstat.SleepInterval, mstat.Discovered, mstat.Cluster)
 	return nil
 }
 
+// AddShard adds the primary of a shard to be monitored under the shard's
+// name, and spawns the necessary goroutine to collect data from it.
+func (mstat *MongoStat) AddShard(shard ConfigShard) error {
+	mstat.nodesLock.Lock()
+	defer mstat.nodesLock.Unlock()
+
+	if _, hasKey := mstat.Nodes[shard.Id]; hasKey {
+		return nil
+	}
+	log.Logvf(log.DebugLow, "adding primary of shard %v to monitoring: %v", shard.Id, shard.Host)
+	node, err := NewShardMonitor(*mstat.Options, shard)
+	if err != nil {
+		return err
+	}
+	node.latencyHistograms = mstat.StatOptions != nil && mstat.StatOptions.Latency
+	mstat.Nodes[shard.Id] = node
+	if mstat.ShardTotals != nil {
+		mstat.ShardTotals.AddShard(shard.Id)
+	}
+	go node.Watch(mstat.SleepInterval, nil, mstat.Cluster)
+	return nil
+}
+
 // Run is the top-level function that starts the monitoring
 // and discovery goroutines
 func (mstat *MongoStat) Run() error {
@@ -382,5 +530,16 @@ func (mstat *MongoStat) Run() error {
 			}
 		}()
 	}
+	if mstat.DiscoveredShards != nil {
+		go func() {
+			for {
+				shard := <-mstat.DiscoveredShards
+				err := mstat.AddShard(shard)
+				if err != nil {
+					log.Logvf(log.Always, "can't add shard %v: %v", shard.Id, err)
+				}
+			}
+		}()
+	}
 	return mstat.Cluster.Monitor(mstat.SleepInterval)
 }
@@ -7,12 +7,22 @@
 package mongostat
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/testtype"
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer"
 	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
 	"github.com/mongodb/mongo-tools/mongostat/status"
 	. "github.com/smartystreets/goconvey/convey"
@@ -126,3 +136,652 @@ func TestIsMongos(t *testing.T) {
 		So(runCheck("mongodb/bin/mongod"), ShouldBeFalse)
 	})
 }
+
+func TestPrometheusMetrics(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a Prometheus cluster monitor", t, func() {
+		cluster := NewPrometheusClusterMonitor(":0")
+		primaryWrite := time.Unix(1000, 0)
+		cluster.Update(&status.ServerStatus{
+			Host:       "a:27017",
+			Opcounters: &status.OpcountStats{Insert: 10, Query: 3},
+			Repl: &status.ReplStatus{SetName: "rs", IsMaster: true,
+				LastWrite: &status.LastWrite{LastWriteDate: primaryWrite}},
+		}, nil)
+		cluster.Update(&status.ServerStatus{
+			Host:        "b:27017",
+			Connections: &status.ConnectionStats{Current: 7},
+			Repl: &status.ReplStatus{SetName: "rs", Secondary: true,
+				LastWrite: &status.LastWrite{LastWriteDate: primaryWrite.Add(-2 * time.Second)}},
+		}, nil)
+		cluster.Update(nil, status.NewNodeError("c:27017", io.EOF))
+
+		out := &bytes.Buffer{}
+		So(cluster.WriteMetrics(out), ShouldBeNil)
+		metrics := out.String()
+
+		Convey("every host should report whether it is up", func() {
+			So(metrics, ShouldContainSubstring, "# TYPE mongodb_up gauge\n")
+			So(metrics, ShouldContainSubstring, `mongodb_up{host="a:27017"} 1`)
+			So(metrics, ShouldContainSubstring, `mongodb_up{host="c:27017"} 0`)
+		})
+
+		Convey("counters and gauges should be labeled by host", func() {
+			So(metrics, ShouldContainSubstring, "# TYPE mongodb_opcounters_total counter\n")
+			So(metrics, ShouldContainSubstring, `mongodb_opcounters_total{host="a:27017",type="insert"} 10`)
+			So(metrics, ShouldContainSubstring, `mongodb_connections{host="b:27017",state="current"} 7`)
+		})
+
+		Convey("secondaries should report their lag behind the primary", func() {
+			So(metrics, ShouldContainSubstring, `mongodb_repl_lag_seconds{host="b:27017"} 2`)
+			So(metrics, ShouldNotContainSubstring, `mongodb_repl_lag_seconds{host="a:27017"}`)
+		})
+	})
+}
+
+func TestMetricSinks(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	sampleTime := time.Unix(1500000000, 0)
+	metrics := []status.Metric{
+		{Name: "mongodb_opcounters_total", Type: status.Counter, Label: "type", LabelValue: "insert", Value: 10},
+		{Name: "mongodb_uptime_seconds", Type: status.Gauge, Value: 3.5},
+	}
+
+	Convey("Metrics should be formatted as InfluxDB line protocol", t, func() {
+		So(formatInfluxLines("db 1:27017", sampleTime, metrics), ShouldEqual,
+			"mongodb_opcounters_total,host=db\\ 1:27017,type=insert value=10 1500000000000000000\n"+
+				"mongodb_uptime_seconds,host=db\\ 1:27017 value=3.5 1500000000000000000\n")
+	})
+
+	Convey("Metrics should be formatted as Graphite plaintext", t, func() {
+		So(formatGraphiteLines("mongostat", "db.example.com:27017", sampleTime, metrics), ShouldEqual,
+			"mongostat.db_example_com_27017.mongodb_opcounters_total.insert 10 1500000000\n"+
+				"mongostat.db_example_com_27017.mongodb_uptime_seconds 3.5 1500000000\n")
+	})
+
+	Convey("The InfluxDB sink should post samples to the write URL", t, func() {
+		var received string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			received = r.URL.RawQuery + "\n" + string(body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		sink := NewInfluxSink(server.URL + "/write?db=stats")
+		So(sink.Push("h", sampleTime, metrics[1:]), ShouldBeNil)
+		So(received, ShouldEqual, "db=stats\nmongodb_uptime_seconds,host=h value=3.5 1500000000000000000\n")
+	})
+}
+
+func TestShardGrouping(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	sharding := &status.ShardingStats{ConfigsvrConnectionString: "csrs/cfg1:27019,cfg2:27019"}
+
+	Convey("Config servers should be read from the sharding section", t, func() {
+		setName, hosts := status.ConfigServers(&status.ServerStatus{Sharding: sharding})
+		So(setName, ShouldEqual, "csrs")
+		So(hosts, ShouldResemble, []string{"cfg1:27019", "cfg2:27019"})
+	})
+
+	Convey("Nodes should be labeled with the part of the cluster they belong to", t, func() {
+		So(status.ReadShard(nil, &status.ServerStatus{Process: "mongos"}, nil), ShouldEqual, "mongos")
+		So(status.ReadShard(nil, &status.ServerStatus{Sharding: sharding,
+			Repl: &status.ReplStatus{SetName: "csrs"}}, nil), ShouldEqual, "config")
+		So(status.ReadShard(nil, &status.ServerStatus{Sharding: sharding,
+			Repl: &status.ReplStatus{SetName: "shard01"}}, nil), ShouldEqual, "shard01")
+	})
+
+	Convey("Stat lines should be grouped by shard", t, func() {
+		lines := line.StatLines{
+			{Fields: map[string]string{"host": "a", "shard": "shard02"}},
+			{Fields: map[string]string{"host": "b", "shard": "shard01"}},
+			{Fields: map[string]string{"host": "c", "shard": "shard02"}},
+		}
+		sort.Sort(lines)
+		So(lines[0].Fields["host"], ShouldEqual, "b")
+		So(lines[1].Fields["host"], ShouldEqual, "a")
+		So(lines[2].Fields["host"], ShouldEqual, "c")
+	})
+}
+
+func TestAlerts(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Alert rules should be parsed with units", t, func() {
+		rules, err := stat_consumer.ParseAlertRules("qrw>100, dirty>=20%,res>2G")
+		So(err, ShouldBeNil)
+		So(len(rules), ShouldEqual, 3)
+		So(rules[0].Key, ShouldEqual, "qrw")
+		So(rules[1].Op, ShouldEqual, ">=")
+		So(rules[1].Threshold, ShouldEqual, 20)
+		So(rules[2].Threshold, ShouldEqual, 2<<30)
+
+		_, err = stat_consumer.ParseAlertRules("qrw=100")
+		So(err, ShouldNotBeNil)
+		_, err = stat_consumer.ParseAlertRules("qrw>lots")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Any value of a multi-valued field should breach a rule", t, func() {
+		rules, _ := stat_consumer.ParseAlertRules("qrw>100,net_in>1m")
+		So(rules[0].Breached("3|150"), ShouldBeTrue)
+		So(rules[0].Breached("3|2"), ShouldBeFalse)
+		So(rules[1].Breached("2.00m"), ShouldBeTrue)
+		So(rules[1].Breached("666k"), ShouldBeFalse)
+	})
+
+	Convey("With an alert monitor requiring two samples", t, func() {
+		out := &bytes.Buffer{}
+		rules, _ := stat_consumer.ParseAlertRules("dirty>20%")
+		alerts := stat_consumer.NewAlertMonitor(rules, 2, out)
+		alerts.ExitOnAlert = true
+		sample := func(dirty string) bool {
+			return alerts.Check([]*line.StatLine{{Fields: map[string]string{"host": "h", "dirty": dirty}}})
+		}
+
+		Convey("an alert should only be raised after consecutive breaches", func() {
+			So(sample("25.0%"), ShouldBeFalse)
+			So(sample("5.0%"), ShouldBeFalse)
+			So(sample("25.0%"), ShouldBeFalse)
+			So(alerts.Fired(), ShouldBeFalse)
+			So(sample("30.0%"), ShouldBeTrue)
+			So(alerts.Fired(), ShouldBeTrue)
+			So(out.String(), ShouldContainSubstring, "h: dirty>20% is 30.0% for 2 sample(s)")
+		})
+	})
+}
+
+func TestCSVOutput(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The CSV formatter should write the header before the first sample only", t, func() {
+		formatter := stat_consumer.NewCSVLineFormatter(0, true)
+		keyNames := map[string]string{"host": "host", "qrw": "qr|qw"}
+		headers := []string{"host", "qrw"}
+		first := formatter.FormatLines([]*line.StatLine{
+			{Fields: map[string]string{"host": "b", "qrw": "1|2"}},
+			{Fields: map[string]string{"host": "a"}, Error: io.EOF},
+		}, headers, keyNames)
+		So(first, ShouldEqual, "host,qr|qw,error\na,,EOF\nb,1|2,\n")
+		second := formatter.FormatLines([]*line.StatLine{
+			{Fields: map[string]string{"host": "b", "qrw": "0|0"}},
+		}, headers, keyNames)
+		So(second, ShouldEqual, "b,0|0,\n")
+	})
+
+	Convey("With a rotating output file", t, func() {
+		dir, err := ioutil.TempDir("", "mongostat-rotate")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "stats.csv")
+
+		now := time.Date(2018, 3, 1, 12, 0, 0, 0, time.UTC)
+		rf, err := NewRotatingFile(path, time.Hour)
+		So(err, ShouldBeNil)
+		rf.RepeatHeader = true
+		rf.now = func() time.Time { return now }
+		rf.opened = now
+
+		_, err = rf.Write([]byte("h1,h2\n1,2\n"))
+		So(err, ShouldBeNil)
+		now = now.Add(30 * time.Minute)
+		_, err = rf.Write([]byte("3,4\n"))
+		So(err, ShouldBeNil)
+		now = now.Add(30 * time.Minute)
+		_, err = rf.Write([]byte("5,6\n"))
+		So(err, ShouldBeNil)
+		So(rf.Close(), ShouldBeNil)
+
+		Convey("the previous file should be kept under a timestamped name", func() {
+			rotated, err := ioutil.ReadFile(filepath.Join(dir, "stats-20180301T120000.csv"))
+			So(err, ShouldBeNil)
+			So(string(rotated), ShouldEqual, "h1,h2\n1,2\n3,4\n")
+		})
+
+		Convey("the new file should start with the header", func() {
+			current, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(string(current), ShouldEqual, "h1,h2\n5,6\n")
+		})
+	})
+}
+
+func TestTrends(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Numeric fields should be decorated with a sparkline and trend", t, func() {
+		trends := stat_consumer.NewTrendTracker(3)
+		sample := func(qrw, repl string) *line.StatLine {
+			l := &line.StatLine{Fields: map[string]string{"host": "h", "qrw": qrw, "repl": repl}}
+			trends.Decorate([]*line.StatLine{l}, []string{"host", "qrw", "repl"})
+			return l
+		}
+
+		So(sample("1|1", "PRI").Fields["qrw"], ShouldEqual, "1|1 ▁→")
+		So(sample("4|4", "PRI").Fields["qrw"], ShouldEqual, "4|4 ▁█↑")
+		So(sample("2|2", "PRI").Fields["qrw"], ShouldEqual, "2|2 ▁█▃↓")
+		last := sample("8|0", "PRI")
+		So(last.Fields["qrw"], ShouldEqual, "8|0 █▁█↑")
+		So(last.Fields["repl"], ShouldEqual, "PRI")
+		So(last.Fields["host"], ShouldEqual, "h")
+	})
+}
+
+func TestSampleFormat(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With two statuses of a WiredTiger primary", t, func() {
+		start := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+		oldStat := &status.ServerStatus{
+			Host:       "h1:27017",
+			SampleTime: start,
+			Opcounters: &status.OpcountStats{Insert: 100, Query: 10},
+			Network:    &status.NetworkStats{BytesIn: 1000, BytesOut: 2000, NumRequests: 10},
+			WiredTiger: &status.WiredTiger{},
+			Repl:       &status.ReplStatus{SetName: "rs0", IsMaster: true},
+		}
+		newStat := &status.ServerStatus{
+			Host:        "h1:27017",
+			SampleTime:  start.Add(2 * time.Second),
+			Opcounters:  &status.OpcountStats{Insert: 120, Query: 15},
+			Network:     &status.NetworkStats{BytesIn: 3000, BytesOut: 2000, NumRequests: 14},
+			Connections: &status.ConnectionStats{Current: 5, Available: 95},
+			WiredTiger: &status.WiredTiger{
+				Cache:       status.CacheStats{TrackedDirtyBytes: 10, CurrentCachedBytes: 50, MaxBytesConfigured: 100},
+				Transaction: status.TransactionStats{TransCheckpoints: 1},
+			},
+			StorageEngine: map[string]string{"name": "wiredTiger"},
+			Repl:          &status.ReplStatus{SetName: "rs0", IsMaster: true},
+		}
+
+		Convey("the sample should hold typed rates and values", func() {
+			sample := status.NewSample(newStat, oldStat)
+			So(sample.Version, ShouldEqual, status.SampleSchemaVersion)
+			So(sample.IntervalSeconds, ShouldEqual, 2)
+			So(sample.StorageEngine, ShouldEqual, "wiredTiger")
+			So(sample.ReplSet, ShouldEqual, "rs0")
+			So(sample.ReplState, ShouldEqual, "PRI")
+			So(sample.Ops.Insert, ShouldEqual, 10)
+			So(sample.Ops.Query, ShouldEqual, 2.5)
+			So(sample.ReplOps, ShouldBeNil)
+			So(*sample.Flushes, ShouldEqual, 1)
+			So(sample.Cache.DirtyPercent, ShouldEqual, 10)
+			So(sample.Cache.UsedPercent, ShouldEqual, 50)
+			So(sample.Network.BytesInPerSecond, ShouldEqual, 1000)
+			So(sample.Network.RequestsPerSecond, ShouldEqual, 2)
+			So(sample.Connections.Current, ShouldEqual, 5)
+			So(sample.Memory, ShouldBeNil)
+		})
+
+		Convey("the formatter should write one JSON document per host", func() {
+			formatter := stat_consumer.NewSampleLineFormatter(0, true)
+			lines := []*line.StatLine{
+				line.NewStatLine(oldStat, newStat, []string{"host"}, &status.ReaderConfig{}),
+				{Fields: map[string]string{"host": "h2:27017"}, Error: fmt.Errorf("connection refused")},
+			}
+			out := strings.Split(strings.TrimSpace(formatter.FormatLines(lines, nil, nil)), "\n")
+			So(len(out), ShouldEqual, 2)
+
+			var doc map[string]interface{}
+			So(json.Unmarshal([]byte(out[0]), &doc), ShouldBeNil)
+			So(doc["version"], ShouldEqual, 1)
+			So(doc["host"], ShouldEqual, "h1:27017")
+			So(doc["time"], ShouldEqual, "2017-03-01T12:00:02Z")
+			So(doc["ops"].(map[string]interface{})["insert"], ShouldEqual, 10)
+			_, hasError := doc["error"]
+			So(hasError, ShouldBeFalse)
+
+			doc = nil
+			So(json.Unmarshal([]byte(out[1]), &doc), ShouldBeNil)
+			So(doc["host"], ShouldEqual, "h2:27017")
+			So(doc["error"], ShouldEqual, "connection refused")
+			_, hasOps := doc["ops"]
+			So(hasOps, ShouldBeFalse)
+
+			Convey("and report hosts without new data as errors", func() {
+				out := formatter.FormatLines(lines[:1], nil, nil)
+				So(out, ShouldContainSubstring, `"error":"no data received"`)
+			})
+		})
+	})
+}
+
+func TestBaseline(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a recorded baseline session", t, func() {
+		start := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+		recorded := &bytes.Buffer{}
+		for i, inserts := range []float64{100, 200} {
+			sample := &status.Sample{
+				Version: status.SampleSchemaVersion,
+				Host:    "old:27017",
+				Time:    start.Add(time.Duration(i) * time.Minute),
+				Ops:     &status.SampleOps{Insert: inserts},
+			}
+			So(json.NewEncoder(recorded).Encode(sample), ShouldBeNil)
+		}
+		So(json.NewEncoder(recorded).Encode(status.NewErrorSample("old:27017", start, fmt.Errorf("down"))), ShouldBeNil)
+
+		baseline, err := stat_consumer.LoadBaseline(recorded)
+		So(err, ShouldBeNil)
+
+		Convey("samples should be matched by time since the start", func() {
+			So(baseline.At("old:27017", 0).Ops.Insert, ShouldEqual, 100)
+			So(baseline.At("old:27017", 59*time.Second).Ops.Insert, ShouldEqual, 100)
+			So(baseline.At("old:27017", time.Hour).Ops.Insert, ShouldEqual, 200)
+			So(baseline.At("new:27017", time.Hour).Ops.Insert, ShouldEqual, 200)
+		})
+
+		Convey("new lines should show the change from the baseline", func() {
+			newLine := func(at time.Duration, inserts, queries float64) *line.StatLine {
+				return &line.StatLine{
+					Fields: map[string]string{"host": "new:27017", "insert": "x", "query": "y", "repl": "PRI"},
+					Sample: &status.Sample{
+						Host: "new:27017",
+						Time: start.Add(time.Hour + at),
+						Ops:  &status.SampleOps{Insert: inserts, Query: queries},
+					},
+				}
+			}
+			headers := []string{"host", "insert", "query", "repl"}
+
+			first := newLine(0, 150, 3)
+			baseline.Decorate([]*line.StatLine{first}, headers)
+			So(first.Fields["insert"], ShouldEqual, "x (+50%)")
+			So(first.Fields["query"], ShouldEqual, "y (+3)")
+			So(first.Fields["repl"], ShouldEqual, "PRI")
+
+			later := newLine(time.Minute, 100, 0)
+			baseline.Decorate([]*line.StatLine{later}, headers)
+			So(later.Fields["insert"], ShouldEqual, "x (-50%)")
+			So(later.Fields["query"], ShouldEqual, "y (+0)")
+		})
+	})
+
+	Convey("An empty or newer baseline should be rejected", t, func() {
+		_, err := stat_consumer.LoadBaseline(strings.NewReader(""))
+		So(err, ShouldNotBeNil)
+		_, err = stat_consumer.LoadBaseline(strings.NewReader(`{"version":99,"host":"h"}`))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestPerDatabase(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("top counters should be summed by database", t, func() {
+		top := &status.TopStats{Totals: map[string]status.TopNamespace{
+			"app.users":  {Insert: status.TopCounter{Count: 3}, Queries: status.TopCounter{Count: 10}},
+			"app.orders": {Insert: status.TopCounter{Count: 2}, Remove: status.TopCounter{Count: 1}},
+			"admin.$cmd": {Commands: status.TopCounter{Count: 7}},
+			"note":       {},
+		}}
+		counters := status.DatabaseOpcounters(top)
+		So(len(counters), ShouldEqual, 2)
+		So(*counters["app"], ShouldResemble, status.OpcountStats{Insert: 5, Query: 10, Delete: 1})
+		So(counters["admin"].Command, ShouldEqual, 7)
+	})
+
+	Convey("Each database should be shown as its own row", t, func() {
+		start := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+		sample := func(at time.Duration, inserts int64) *status.ServerStatus {
+			return &status.ServerStatus{
+				Host:       "h1:27017",
+				SampleTime: start.Add(at),
+				Databases: []*status.DatabaseStats{
+					{Name: "logs", Opcounters: status.OpcountStats{Insert: inserts}, DataSize: 2048},
+					{Name: "app", DataSize: 10},
+				},
+			}
+		}
+		oldStats := status.SplitDatabases(sample(0, 100))
+		newStats := status.SplitDatabases(sample(time.Second, 150))
+		So(len(newStats), ShouldEqual, 2)
+		So(newStats[0].Host, ShouldEqual, "h1:27017/app")
+		So(newStats[1].Host, ShouldEqual, "h1:27017/logs")
+
+		c := &status.ReaderConfig{HumanReadable: true}
+		l := line.NewStatLine(oldStats[1], newStats[1], line.DatabaseHeaders, c)
+		So(l.Fields["host"], ShouldEqual, "h1:27017/logs")
+		So(l.Fields["insert"], ShouldEqual, "50")
+		So(l.Fields["size"], ShouldEqual, "2.00K")
+	})
+}
+
+func TestWiredTigerPanel(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The WiredTiger columns should be read from serverStatus", t, func() {
+		start := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+		oldStat := &status.ServerStatus{
+			SampleTime: start,
+			WiredTiger: &status.WiredTiger{
+				Cache: status.CacheStats{UnmodifiedEvicted: 100, ModifiedEvicted: 50, AppThreadEvicted: 10},
+				Log:   status.WTLogStats{BytesWritten: 1 << 20},
+			},
+		}
+		newStat := &status.ServerStatus{
+			SampleTime: start.Add(2 * time.Second),
+			WiredTiger: &status.WiredTiger{
+				Cache: status.CacheStats{
+					UnmodifiedEvicted: 130, ModifiedEvicted: 60, AppThreadEvicted: 14,
+					CurrentCachedBytes: 80, TrackedDirtyBytes: 5, MaxBytesConfigured: 100,
+				},
+				Transaction: status.TransactionStats{LastCheckpointMillis: 1234},
+				Concurrent: status.ConcurrentTransactions{
+					Read:  status.ConcurrentTransStats{Out: 2, Available: 126},
+					Write: status.ConcurrentTransStats{Out: 1, Available: 127},
+				},
+				Log: status.WTLogStats{BytesWritten: 5 << 20},
+			},
+		}
+		l := line.NewStatLine(oldStat, newStat, line.WiredTigerHeaders, &status.ReaderConfig{HumanReadable: true})
+		So(l.Fields["used"], ShouldEqual, "80.0%")
+		So(l.Fields["dirty"], ShouldEqual, "5.0%")
+		So(l.Fields["evicted"], ShouldEqual, "20")
+		So(l.Fields["app_evict"], ShouldEqual, "2")
+		So(l.Fields["ckpt_ms"], ShouldEqual, "1234")
+		So(l.Fields["tickets"], ShouldEqual, "126|127")
+		So(l.Fields["log_out"], ShouldEqual, "2.00M")
+
+		Convey("and be blank for other storage engines", func() {
+			mmap := &status.ServerStatus{SampleTime: start}
+			l := line.NewStatLine(mmap, mmap, line.WiredTigerHeaders, &status.ReaderConfig{})
+			So(l.Fields["evicted"], ShouldEqual, "")
+			So(l.Fields["tickets"], ShouldEqual, "")
+		})
+	})
+}
+
+func TestLatencyColumns(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("The latency columns should be read from serverStatus", t, func() {
+		start := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+		headers := []string{"r_lat", "w_lat", "c_lat", "gl_queue", "gl_wait"}
+		oldStat := &status.ServerStatus{
+			SampleTime: start,
+			OpLatencies: &status.OpLatenciesStats{
+				Reads: &status.OpLatencyStats{Histogram: []status.LatencyBucket{
+					{Micros: 128, Count: 10},
+				}},
+				Writes: &status.OpLatencyStats{Latency: 1000, Ops: 10},
+			},
+			Locks: map[string]status.LockStats{
+				"Global": {AcquireWaitCount: &status.ReadWriteLockTimes{}},
+			},
+		}
+		newStat := &status.ServerStatus{
+			SampleTime: start.Add(2 * time.Second),
+			OpLatencies: &status.OpLatenciesStats{
+				Reads: &status.OpLatencyStats{Histogram: []status.LatencyBucket{
+					{Micros: 1024, Count: 1}, {Micros: 128, Count: 60}, {Micros: 256, Count: 49},
+				}},
+				Writes: &status.OpLatencyStats{Latency: 3000, Ops: 20},
+			},
+			GlobalLock: &status.GlobalLockStats{
+				CurrentQueue: &status.QueueStats{Total: 5, Readers: 3, Writers: 2},
+			},
+			Locks: map[string]status.LockStats{
+				"Global": {AcquireWaitCount: &status.ReadWriteLockTimes{Read: 4, ReadLower: 2, Write: 2}},
+			},
+		}
+		l := line.NewStatLine(oldStat, newStat, headers, &status.ReaderConfig{})
+
+		Convey("with percentiles taken from the upper bound of histogram buckets", func() {
+			So(l.Fields["r_lat"], ShouldEqual, "256|1024")
+		})
+		Convey("with the average latency when there is no histogram", func() {
+			So(l.Fields["w_lat"], ShouldEqual, "200")
+			So(l.Fields["c_lat"], ShouldEqual, "")
+		})
+		Convey("with the global lock queue and waits per second", func() {
+			So(l.Fields["gl_queue"], ShouldEqual, "5|3|2")
+			So(l.Fields["gl_wait"], ShouldEqual, "3|1")
+		})
+	})
+}
+
+func TestSortLines(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("Lines should be sortable by a column", t, func() {
+		newLine := func(host, qrw string) *line.StatLine {
+			return &line.StatLine{Fields: map[string]string{"host": host, "qrw": qrw}}
+		}
+		failed := &line.StatLine{Fields: map[string]string{"host": "a"}, Error: fmt.Errorf("down")}
+		lines := []*line.StatLine{
+			newLine("b", "10|0"), failed, newLine("c", "2|1 ▁█↑"), newLine("d", ""), newLine("e", "9|1"),
+		}
+		hosts := func() (out []string) {
+			for _, l := range lines {
+				out = append(out, l.Fields["host"])
+			}
+			return
+		}
+
+		stat_consumer.SortLines(lines, "qrw", true)
+		So(hosts(), ShouldResemble, []string{"b", "e", "c", "d", "a"})
+
+		stat_consumer.SortLines(lines, "qrw", false)
+		So(hosts(), ShouldResemble, []string{"c", "b", "e", "d", "a"})
+	})
+}
+
+func TestRecordReplay(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("A recorded session should replay at the requested interval", t, func() {
+		start := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+		recorded := &bytes.Buffer{}
+		cluster := &RecordingClusterMonitor{ClusterMonitor: NewPrometheusClusterMonitor(""), Out: recorded}
+		for i := 0; i < 5; i++ {
+			for _, host := range []string{"h1:27017", "h2:27017"} {
+				cluster.Update(&status.ServerStatus{
+					Host:       host,
+					SampleTime: start.Add(time.Duration(i)*time.Second - 3*time.Millisecond*time.Duration(i%2)),
+					Opcounters: &status.OpcountStats{Insert: int64(i * 10)},
+					Flattened:  map[string]interface{}{"metrics.document.inserted": int64(i * 10)},
+				}, nil)
+			}
+		}
+		// errors aren't recorded
+		cluster.Update(nil, status.NewNodeError("h3:27017", fmt.Errorf("down")))
+
+		out := &bytes.Buffer{}
+		formatter := stat_consumer.NewCSVLineFormatter(0, true)
+		consumer := stat_consumer.NewStatConsumer(0, []string{"host", "metrics.document.inserted"},
+			line.DefaultKeyMap(), &status.ReaderConfig{}, formatter, out)
+
+		Convey("showing every sample at the recorded interval", func() {
+			So(Replay(bytes.NewReader(recorded.Bytes()), time.Second, consumer), ShouldBeNil)
+			rows := strings.Split(strings.TrimSpace(out.String()), "\n")
+			So(len(rows), ShouldEqual, 9)
+			So(rows[1], ShouldEqual, "h1:27017,10,")
+			So(rows[8], ShouldEqual, "h2:27017,40,")
+		})
+
+		Convey("and skipping samples for a longer interval", func() {
+			So(Replay(bytes.NewReader(recorded.Bytes()), 2*time.Second, consumer), ShouldBeNil)
+			rows := strings.Split(strings.TrimSpace(out.String()), "\n")
+			So(len(rows), ShouldEqual, 5)
+			So(rows[1], ShouldEqual, "h1:27017,20,")
+			So(rows[4], ShouldEqual, "h2:27017,40,")
+		})
+	})
+}
+
+type recordedUpdates struct {
+	stats  []*status.ServerStatus
+	errors []*status.NodeError
+}
+
+func (r *recordedUpdates) Update(stat *status.ServerStatus, err *status.NodeError) {
+	if err != nil {
+		r.errors = append(r.errors, err)
+		return
+	}
+	r.stats = append(r.stats, stat)
+}
+
+func (r *recordedUpdates) Monitor(time.Duration) error {
+	return nil
+}
+
+func TestShardTotals(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With the primaries of two shards", t, func() {
+		start := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+		sample := func(shard string, at time.Duration, inserts, conns int64) *status.ServerStatus {
+			return &status.ServerStatus{
+				Host:        shard,
+				SampleTime:  start.Add(at),
+				Opcounters:  &status.OpcountStats{Insert: inserts},
+				Connections: &status.ConnectionStats{Current: conns},
+				Mem:         &status.MemStats{Supported: true, Resident: 100},
+			}
+		}
+		updates := &recordedUpdates{}
+		cluster := NewShardTotalsClusterMonitor(updates)
+		cluster.AddShard("shard0")
+		cluster.AddShard("shard1")
+
+		Convey("a total should follow each round of samples from every shard", func() {
+			cluster.Update(sample("shard0", 0, 10, 1), nil)
+			cluster.Update(sample("shard0", time.Second, 20, 2), nil)
+			cluster.Update(nil, status.NewNodeError("shard1", fmt.Errorf("failover")))
+			cluster.Update(sample("mongos:27017", time.Second, 99, 99), nil)
+			So(len(updates.stats), ShouldEqual, 3)
+			So(len(updates.errors), ShouldEqual, 1)
+
+			cluster.Update(sample("shard1", 1500*time.Millisecond, 5, 3), nil)
+			So(len(updates.stats), ShouldEqual, 5)
+			total := updates.stats[4]
+			So(total.Host, ShouldEqual, ClusterTotalHost)
+			So(total.SampleTime, ShouldResemble, start.Add(1500*time.Millisecond))
+			So(total.Opcounters.Insert, ShouldEqual, 25)
+			So(total.Connections.Current, ShouldEqual, 5)
+			So(total.Mem.Resident, ShouldEqual, 200)
+			So(total.Network, ShouldNotBeNil)
+
+			Convey("and the totals should be shown like any other host", func() {
+				cluster.Update(sample("shard0", 2*time.Second, 40, 1), nil)
+				cluster.Update(sample("shard1", 2500*time.Millisecond, 15, 1), nil)
+				next := updates.stats[len(updates.stats)-1]
+				So(next.Host, ShouldEqual, ClusterTotalHost)
+
+				headers := []string{"host", "insert", "conn", "res", "net_in"}
+				l := line.NewStatLine(total, next, headers, &status.ReaderConfig{})
+				So(l.Fields["host"], ShouldEqual, "(cluster)")
+				So(l.Fields["insert"], ShouldEqual, "30")
+				So(l.Fields["conn"], ShouldEqual, "2")
+			})
+		})
+	})
+}
@@ -6,25 +6,51 @@
 
 package mongostat
 
+import (
+	"time"
+)
+
 var Usage = `<options> <polling interval in seconds>
 
 Monitor basic MongoDB server statistics.
 
+The polling interval may be fractional, e.g. 0.25, or have a unit, e.g. 250ms.
+
 See http://docs.mongodb.org/manual/reference/program/mongostat/ for more information.`
 
 // StatOptions defines the set of options to use for configuring mongostat.
 type StatOptions struct {
-	Columns       string `short:"o" value-name:"<field>[,<field>]*" description:"fields to show. For custom fields, use dot-syntax to index into serverStatus output, and optional methods .diff() and .rate() e.g. metrics.record.moves.diff()"`
-	AppendColumns string `short:"O" value-name:"<field>[,<field>]*" description:"like -o, but preloaded with default fields. Specified fields inserted after default output"`
-	HumanReadable string `long:"humanReadable" default:"true" description:"print sizes and time in human readable format (e.g. 1K 234M 2G). To use the more precise machine readable format, use --humanReadable=false"`
-	NoHeaders     bool   `long:"noheaders" description:"don't output column names"`
-	RowCount      int64  `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
-	Discover      bool   `long:"discover" description:"discover nodes and display stats for all"`
-	Http          bool   `long:"http" description:"use HTTP instead of raw db connection"`
-	All           bool   `long:"all" description:"all optional fields"`
-	Json          bool   `long:"json" description:"output as JSON rather than a formatted table"`
-	Deprecated    bool   `long:"useDeprecatedJsonKeys" description:"use old key names; only valid with the json output option."`
-	Interactive   bool   `short:"i" long:"interactive" description:"display stats in a non-scrolling interface"`
+	Columns        string        `short:"o" long:"columns" value-name:"<field>[,<field>]*" description:"fields to show. For custom fields, use dot-syntax to index into serverStatus output, and optional methods .diff() and .rate() e.g. metrics.record.moves.diff(). Append ':<header>' to a field to set its column header, e.g. metrics.commands.find.total.rate():finds"`
+	AppendColumns  string        `short:"O" value-name:"<field>[,<field>]*" description:"like -o, but preloaded with default fields. Specified fields inserted after default output"`
+	HumanReadable  string        `long:"humanReadable" default:"true" description:"print sizes and time in human readable format (e.g. 1K 234M 2G). To use the more precise machine readable format, use --humanReadable=false"`
+	NoHeaders      bool          `long:"noheaders" description:"don't output column names"`
+	RowCount       int64         `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
+	Discover       bool          `long:"discover" description:"discover nodes and display stats for all"`
+	Http           bool          `long:"http" description:"use HTTP instead of raw db connection"`
+	Shards         bool          `long:"shards" description:"when connected to a mongos, show the primary of each shard and the totals of all shards"`
+	PerDatabase    bool          `long:"perDatabase" description:"show operations and data size for each database, using the top and dbStats commands, rather than server-wide totals"`
+	Latency        bool          `long:"latency" description:"add read, write and command latency percentiles from opLatencies, and global lock queue and wait columns"`
+	WiredTiger     bool          `long:"wt" description:"show WiredTiger cache, eviction, checkpoint, ticket and log columns instead of the default fields"`
+	All            bool          `long:"all" description:"all optional fields"`
+	Json           bool          `long:"json" description:"output as JSON rather than a formatted table"`
+	Format         string        `long:"format" value-name:"<format>" choice:"json" description:"output in a stable, machine-readable format; 'json' writes one versioned JSON document per host per interval with typed numeric fields"`
+	Deprecated     bool          `long:"useDeprecatedJsonKeys" description:"use old key names; only valid with the json output option."`
+	Interactive    bool          `short:"i" long:"interactive" description:"display stats in a non-scrolling interface that can be paused, scrolled back through, sorted and have columns hidden; press '?' for keys"`
+	Sparklines     int           `long:"sparklines" value-name:"<count>" description:"show a sparkline of the last <count> samples and a trend arrow next to each numeric field"`
+	Baseline       string        `long:"baseline" value-name:"<filename>" description:"show the change in each numeric field from a session recorded with '--format json --out <filename>', at the same time since the start"`
+	CSV            bool          `long:"csv" description:"output as CSV rather than a formatted table (the default if --out ends in .csv)"`
+	Out            string        `long:"out" value-name:"<filename>" description:"write stats to a file rather than stdout"`
+	RotateInterval time.Duration `long:"rotateInterval" value-name:"<duration>" description:"start a new --out file at this interval, e.g. '24h', keeping the previous files under timestamped names"`
+	InfluxURL      string        `long:"influxUrl" value-name:"<url>" description:"push each sample to InfluxDB using this write URL, e.g. 'http://localhost:8086/write?db=mongostat'"`
+	GraphiteAddr   string        `long:"graphiteAddr" value-name:"<host:port>" description:"push each sample to the Graphite plaintext listener at this address"`
+	GraphitePrefix string        `long:"graphitePrefix" value-name:"<prefix>" default:"mongostat" description:"prefix for metric paths sent to Graphite"`
+	Alert          string        `long:"alert" value-name:"<rule>[,<rule>]*" description:"alert when a column crosses a threshold, e.g. 'qrw>100,dirty>20%'"`
+	AlertSamples   int           `long:"alertSamples" value-name:"<count>" default:"1" description:"number of consecutive samples a rule must be breached for before alerting"`
+	AlertWebhook   string        `long:"alertWebhook" value-name:"<url>" description:"POST each alert as JSON to this URL"`
+	AlertExit      bool          `long:"alertExit" description:"exit with a non-zero status after the first alert"`
+	Record         string        `long:"record" value-name:"<filename>" description:"also write every sample to a BSON file, which can be shown again later with --replay"`
+	Replay         string        `long:"replay" value-name:"<filename>" description:"show the samples recorded with --record in a file instead of connecting to a server; the sleep time selects samples at least that far apart"`
+	Prometheus     string        `long:"prometheus" value-name:"<address>" description:"serve stats as Prometheus metrics on the given address, e.g. ':9216', instead of printing them"`
 }
 
 // Name returns a human-readable group name for mongostat options.
@@ -0,0 +1,153 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongostat
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+)
+
+// PrometheusClusterMonitor is an implementation of ClusterMonitor that serves
+// the most recent stats of every monitored host as Prometheus metrics,
+// instead of writing them to stdout.
+type PrometheusClusterMonitor struct {
+	// Address to serve metrics on, e.g. ":9216".
+	Address string
+
+	// Map of hostname -> latest stat data for the host
+	LastStats map[string]*status.ServerStatus
+
+	// Map of hostname -> error from the latest poll of the host
+	LastErrors map[string]error
+
+	// Mutex to protect access to LastStats and LastErrors
+	mapLock sync.RWMutex
+}
+
+// NewPrometheusClusterMonitor returns a PrometheusClusterMonitor that serves
+// metrics on the given address.
+func NewPrometheusClusterMonitor(address string) *PrometheusClusterMonitor {
+	return &PrometheusClusterMonitor{
+		Address:    address,
+		LastStats:  map[string]*status.ServerStatus{},
+		LastErrors: map[string]error{},
+	}
+}
+
+// Update records the latest stats or error for a host.
+func (cluster *PrometheusClusterMonitor) Update(stat *status.ServerStatus, err *status.NodeError) {
+	cluster.mapLock.Lock()
+	defer cluster.mapLock.Unlock()
+	if err != nil {
+		cluster.LastErrors[err.Host] = err
+		return
+	}
+	delete(cluster.LastErrors, stat.Host)
+	cluster.LastStats[stat.Host] = stat
+}
+
+// Monitor serves metrics on the cluster's address until the server fails.
+func (cluster *PrometheusClusterMonitor) Monitor(_ time.Duration) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := cluster.WriteMetrics(w); err != nil {
+			log.Logvf(log.DebugLow, "error writing metrics: %v", err)
+		}
+	})
+	log.Logvf(log.Always, "serving Prometheus metrics on %v/metrics", cluster.Address)
+	return http.ListenAndServe(cluster.Address, mux)
+}
+
+// WriteMetrics writes the latest stats of every host in the Prometheus text
+// exposition format.
+func (cluster *PrometheusClusterMonitor) WriteMetrics(w io.Writer) error {
+	cluster.mapLock.RLock()
+	defer cluster.mapLock.RUnlock()
+
+	hosts := make([]string, 0, len(cluster.LastStats)+len(cluster.LastErrors))
+	for host := range cluster.LastStats {
+		hosts = append(hosts, host)
+	}
+	for host := range cluster.LastErrors {
+		if _, ok := cluster.LastStats[host]; !ok {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+
+	// group the samples of every host by metric name, keeping the order in
+	// which the metrics were first seen
+	var names []string
+	families := map[string][]string{}
+	headers := map[string]status.Metric{}
+	addSample := func(metric status.Metric, host string) {
+		if _, ok := families[metric.Name]; !ok {
+			names = append(names, metric.Name)
+			headers[metric.Name] = metric
+		}
+		labels := fmt.Sprintf(`host="%v"`, text.EscapePrometheusLabel(host))
+		if metric.Label != "" {
+			labels += fmt.Sprintf(`,%v="%v"`, metric.Label, text.EscapePrometheusLabel(metric.LabelValue))
+		}
+		families[metric.Name] = append(families[metric.Name], fmt.Sprintf("%v{%v} %v",
+			metric.Name, labels, strconv.FormatFloat(metric.Value, 'g', -1, 64)))
+	}
+
+	stats := make([]*status.ServerStatus, 0, len(cluster.LastStats))
+	for _, host := range hosts {
+		up := status.Metric{Name: "mongodb_up", Help: "Whether the last poll of the server succeeded", Type: status.Gauge}
+		stat, ok := cluster.LastStats[host]
+		if _, failed := cluster.LastErrors[host]; !failed && ok {
+			up.Value = 1
+		}
+		addSample(up, host)
+		if !ok {
+			continue
+		}
+		stats = append(stats, stat)
+		for _, metric := range status.ReadMetrics(stat) {
+			addSample(metric, host)
+		}
+	}
+
+	lags := status.ReplicationLag(stats)
+	for _, host := range hosts {
+		if lag, ok := lags[host]; ok {
+			addSample(status.Metric{
+				Name:  "mongodb_repl_lag_seconds",
+				Help:  "Time the member's last write is behind its primary",
+				Type:  status.Gauge,
+				Value: lag.Seconds(),
+			}, host)
+		}
+	}
+
+	out := bufio.NewWriter(w)
+	for _, name := range names {
+		header := headers[name]
+		typ := "gauge"
+		if header.Type == status.Counter {
+			typ = "counter"
+		}
+		fmt.Fprintf(out, "# HELP %v %v\n# TYPE %v %v\n", name, header.Help, name, typ)
+		for _, sample := range families[name] {
+			fmt.Fprintln(out, sample)
+		}
+	}
+	return out.Flush()
+}
@@ -0,0 +1,105 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongostat
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer"
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// RecordingClusterMonitor is a ClusterMonitor that writes every sample to a
+// BSON file before passing it on to the wrapped ClusterMonitor, so that the
+// session can be analyzed later with --replay.
+type RecordingClusterMonitor struct {
+	ClusterMonitor
+
+	Out io.Writer
+
+	// Mutex to serialize writes from the goroutines polling each host
+	outLock sync.Mutex
+}
+
+// Update records the sample and then updates the wrapped ClusterMonitor.
+// Samples are recorded with their full serverStatus, so that any column can
+// be shown when they are replayed.
+func (cluster *RecordingClusterMonitor) Update(stat *status.ServerStatus, err *status.NodeError) {
+	if err == nil {
+		if recordErr := cluster.record(stat); recordErr != nil {
+			log.Logvf(log.Always, "error recording stats for %v: %v", stat.Host, recordErr)
+		}
+	}
+	cluster.ClusterMonitor.Update(stat, err)
+}
+
+func (cluster *RecordingClusterMonitor) record(stat *status.ServerStatus) error {
+	raw, err := bson.Marshal(stat)
+	if err != nil {
+		return err
+	}
+	cluster.outLock.Lock()
+	defer cluster.outLock.Unlock()
+	_, err = cluster.Out.Write(raw)
+	return err
+}
+
+// replayTolerance is how much earlier than a full interval a recorded sample
+// may be and still be used, since polling times jitter slightly.
+const replayTolerance = 10
+
+// Replay formats the samples of a session recorded with --record, in order,
+// as if each host had been polled every interval. Samples recorded more
+// frequently than the interval are skipped. Lines are formatted together
+// until a host repeats, so that hosts sampled at the same time are shown
+// together.
+func Replay(in io.Reader, interval time.Duration, consumer *stat_consumer.StatConsumer) error {
+	source := db.NewDecodedBSONSource(db.NewBSONSource(ioutil.NopCloser(in)))
+	minGap := interval - interval/replayTolerance
+
+	lastUsed := map[string]time.Time{}
+	var batch []*line.StatLine
+	batchHosts := map[string]bool{}
+	for {
+		stat := &status.ServerStatus{}
+		if !source.Next(stat) {
+			break
+		}
+		if last, ok := lastUsed[stat.Host]; ok && stat.SampleTime.Sub(last) < minGap {
+			continue
+		}
+		lastUsed[stat.Host] = stat.SampleTime
+
+		statLine, ok := consumer.Update(stat)
+		if !ok {
+			continue
+		}
+		if batchHosts[stat.Host] {
+			if consumer.FormatLines(batch) {
+				return nil
+			}
+			batch, batchHosts = nil, map[string]bool{}
+		}
+		batch = append(batch, statLine)
+		batchHosts[stat.Host] = true
+	}
+	if err := source.Err(); err != nil {
+		return fmt.Errorf("error reading recorded samples: %v", err)
+	}
+	if len(batch) > 0 {
+		consumer.FormatLines(batch)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongostat
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedFileTimeFormat is the timestamp added to the names of rotated files.
+const rotatedFileTimeFormat = "20060102T150405"
+
+// RotatingFile is an io.Writer that writes to a file and, every Interval,
+// moves the file aside under a timestamped name and starts a new one.
+type RotatingFile struct {
+	Path string
+
+	// Interval is how often to rotate the file, or 0 to never rotate it.
+	Interval time.Duration
+
+	// RepeatHeader makes the first line written a header that is repeated
+	// at the top of each new file, so that every rotated CSV file can be
+	// loaded on its own.
+	RepeatHeader bool
+
+	file      *os.File
+	opened    time.Time
+	header    []byte
+	hasHeader bool
+	now       func() time.Time
+	lock      sync.Mutex
+}
+
+// NewRotatingFile creates the file at path, truncating it if it exists.
+func NewRotatingFile(path string, interval time.Duration) (*RotatingFile, error) {
+	rf := &RotatingFile{Path: path, Interval: interval, now: time.Now}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening output file: %v", err)
+	}
+	rf.file = file
+	rf.opened = rf.now()
+	return nil
+}
+
+// rotatedName returns the name the current file is moved to, e.g.
+// stats-20180301T120000.csv for a file opened at that time.
+func (rf *RotatingFile) rotatedName() string {
+	ext := filepath.Ext(rf.Path)
+	return fmt.Sprintf("%v-%v%v", strings.TrimSuffix(rf.Path, ext), rf.opened.Format(rotatedFileTimeFormat), ext)
+}
+
+func (rf *RotatingFile) rotate() error {
+	if err := rf.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(rf.Path, rf.rotatedName()); err != nil {
+		return fmt.Errorf("error rotating output file: %v", err)
+	}
+	if err := rf.open(); err != nil {
+		return err
+	}
+	if len(rf.header) > 0 {
+		_, err := rf.file.Write(rf.header)
+		return err
+	}
+	return nil
+}
+
+// Write writes p to the current file, rotating it first if it is due.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	if rf.RepeatHeader && !rf.hasHeader {
+		if i := bytes.IndexByte(p, '\n'); i != -1 {
+			rf.header = append([]byte{}, p[:i+1]...)
+		}
+		rf.hasHeader = true
+	} else if rf.Interval > 0 && rf.now().Sub(rf.opened) >= rf.Interval {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	return rf.file.Write(p)
+}
+
+// Close closes the current file.
+func (rf *RotatingFile) Close() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	return rf.file.Close()
+}
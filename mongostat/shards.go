@@ -0,0 +1,81 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongostat
+
+import (
+	"sync"
+
+	"github.com/mongodb/mongo-tools/mongostat/status"
+)
+
+// ClusterTotalHost is the name of the row holding the totals of all shards,
+// chosen to sort before the shards.
+const ClusterTotalHost = "(cluster)"
+
+// ShardTotalsClusterMonitor is a ClusterMonitor that passes on the samples
+// of every shard primary, along with the totals of all shards. A total is
+// computed each time every shard has reported a new sample, so that its
+// rates cover each shard exactly once.
+type ShardTotalsClusterMonitor struct {
+	ClusterMonitor
+
+	// Set of shard names, as the hosts of their samples
+	shards map[string]bool
+
+	// Map of shard name -> sample not yet included in a total
+	latest map[string]*status.ServerStatus
+
+	// Mutex to protect access to shards and latest
+	lock sync.Mutex
+}
+
+// NewShardTotalsClusterMonitor returns a ShardTotalsClusterMonitor that
+// passes samples on to cluster.
+func NewShardTotalsClusterMonitor(cluster ClusterMonitor) *ShardTotalsClusterMonitor {
+	return &ShardTotalsClusterMonitor{
+		ClusterMonitor: cluster,
+		shards:         map[string]bool{},
+		latest:         map[string]*status.ServerStatus{},
+	}
+}
+
+// AddShard includes the samples of a shard in the totals.
+func (cluster *ShardTotalsClusterMonitor) AddShard(name string) {
+	cluster.lock.Lock()
+	defer cluster.lock.Unlock()
+	cluster.shards[name] = true
+}
+
+// Update passes the sample on, followed by a new total if it was the last
+// shard to report.
+func (cluster *ShardTotalsClusterMonitor) Update(stat *status.ServerStatus, err *status.NodeError) {
+	cluster.ClusterMonitor.Update(stat, err)
+	if err != nil {
+		return
+	}
+	if total := cluster.addSample(stat); total != nil {
+		cluster.ClusterMonitor.Update(total, nil)
+	}
+}
+
+func (cluster *ShardTotalsClusterMonitor) addSample(stat *status.ServerStatus) *status.ServerStatus {
+	cluster.lock.Lock()
+	defer cluster.lock.Unlock()
+	if !cluster.shards[stat.Host] {
+		return nil
+	}
+	cluster.latest[stat.Host] = stat
+	if len(cluster.latest) < len(cluster.shards) {
+		return nil
+	}
+	stats := make([]*status.ServerStatus, 0, len(cluster.latest))
+	for _, latest := range cluster.latest {
+		stats = append(stats, latest)
+	}
+	cluster.latest = map[string]*status.ServerStatus{}
+	return status.SumStatuses(ClusterTotalHost, stats)
+}
@@ -0,0 +1,161 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongostat
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+)
+
+// sinkTimeout bounds how long pushing a sample to a sink may take, so that a
+// slow time-series database doesn't stall polling.
+const sinkTimeout = 5 * time.Second
+
+// MetricSink receives the metrics of every sample collected from a host.
+type MetricSink interface {
+	Push(host string, sampleTime time.Time, metrics []status.Metric) error
+}
+
+// SinkClusterMonitor is a ClusterMonitor that pushes every sample to a set
+// of sinks before passing it on to the wrapped ClusterMonitor.
+type SinkClusterMonitor struct {
+	ClusterMonitor
+
+	Sinks []MetricSink
+}
+
+// Update pushes the sample to every sink and then updates the wrapped
+// ClusterMonitor. Errors from sinks are logged rather than returned, so an
+// unavailable sink doesn't interrupt monitoring.
+func (cluster *SinkClusterMonitor) Update(stat *status.ServerStatus, err *status.NodeError) {
+	if err == nil {
+		metrics := status.ReadMetrics(stat)
+		for _, sink := range cluster.Sinks {
+			if pushErr := sink.Push(stat.Host, stat.SampleTime, metrics); pushErr != nil {
+				log.Logvf(log.Always, "error pushing stats for %v: %v", stat.Host, pushErr)
+			}
+		}
+	}
+	cluster.ClusterMonitor.Update(stat, err)
+}
+
+// InfluxSink writes samples to InfluxDB using the line protocol.
+type InfluxSink struct {
+	// URL is the full write endpoint, e.g. http://localhost:8086/write?db=mongostat
+	URL    string
+	Client *http.Client
+}
+
+// NewInfluxSink returns an InfluxSink that posts to the given write URL.
+func NewInfluxSink(url string) *InfluxSink {
+	return &InfluxSink{
+		URL:    url,
+		Client: &http.Client{Timeout: sinkTimeout},
+	}
+}
+
+// Push posts the metrics as one line per metric.
+func (sink *InfluxSink) Push(host string, sampleTime time.Time, metrics []status.Metric) error {
+	body := formatInfluxLines(host, sampleTime, metrics)
+	resp, err := sink.Client.Post(sink.URL, "text/plain; charset=utf-8", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("InfluxDB responded with %v: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+var influxTagEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// formatInfluxLines returns the metrics in InfluxDB line protocol, with the
+// metric name as the measurement and the host and label as tags.
+func formatInfluxLines(host string, sampleTime time.Time, metrics []status.Metric) string {
+	buf := &bytes.Buffer{}
+	for _, metric := range metrics {
+		fmt.Fprintf(buf, "%v,host=%v", metric.Name, influxTagEscaper.Replace(host))
+		if metric.Label != "" {
+			fmt.Fprintf(buf, ",%v=%v", metric.Label, influxTagEscaper.Replace(metric.LabelValue))
+		}
+		fmt.Fprintf(buf, " value=%v %v\n", strconv.FormatFloat(metric.Value, 'g', -1, 64), sampleTime.UnixNano())
+	}
+	return buf.String()
+}
+
+// GraphiteSink writes samples to Graphite using the plaintext protocol.
+type GraphiteSink struct {
+	// Address is the host:port of the Graphite plaintext listener.
+	Address string
+	// Prefix is prepended to every metric path.
+	Prefix string
+
+	conn     net.Conn
+	connLock sync.Mutex
+}
+
+// NewGraphiteSink returns a GraphiteSink that writes to the given address.
+func NewGraphiteSink(address, prefix string) *GraphiteSink {
+	return &GraphiteSink{Address: address, Prefix: prefix}
+}
+
+// Push writes the metrics over a persistent connection, reconnecting once if
+// the connection was lost since the last sample.
+func (sink *GraphiteSink) Push(host string, sampleTime time.Time, metrics []status.Metric) error {
+	sink.connLock.Lock()
+	defer sink.connLock.Unlock()
+	data := []byte(formatGraphiteLines(sink.Prefix, host, sampleTime, metrics))
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if sink.conn == nil {
+			sink.conn, err = net.DialTimeout("tcp", sink.Address, sinkTimeout)
+			if err != nil {
+				return err
+			}
+		}
+		sink.conn.SetWriteDeadline(time.Now().Add(sinkTimeout))
+		if _, err = sink.conn.Write(data); err == nil {
+			return nil
+		}
+		sink.conn.Close()
+		sink.conn = nil
+	}
+	return err
+}
+
+var graphitePathEscaper = strings.NewReplacer(".", "_", ":", "_", " ", "_", "/", "_")
+
+// formatGraphiteLines returns the metrics in the Graphite plaintext
+// protocol, as prefix.host.name[.label] paths.
+func formatGraphiteLines(prefix, host string, sampleTime time.Time, metrics []status.Metric) string {
+	buf := &bytes.Buffer{}
+	for _, metric := range metrics {
+		path := []string{graphitePathEscaper.Replace(host), metric.Name}
+		if prefix != "" {
+			path = append([]string{prefix}, path...)
+		}
+		if metric.Label != "" {
+			path = append(path, graphitePathEscaper.Replace(metric.LabelValue))
+		}
+		fmt.Fprintf(buf, "%v %v %v\n", strings.Join(path, "."),
+			strconv.FormatFloat(metric.Value, 'g', -1, 64), sampleTime.Unix())
+	}
+	return buf.String()
+}
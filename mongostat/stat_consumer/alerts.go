@@ -0,0 +1,219 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// AlertRule is a threshold on a single mongostat column, such as "qrw>100".
+type AlertRule struct {
+	// Key is the column the rule applies to, e.g. "qrw".
+	Key string
+	// Op is one of ">", ">=", "<" or "<=".
+	Op        string
+	Threshold float64
+	// Text is the rule as the user wrote it.
+	Text string
+}
+
+var alertRuleRE = regexp.MustCompile(`^\s*([^<>=]+?)\s*(>=|<=|>|<)\s*(\S+)\s*$`)
+
+// ParseAlertRules parses a comma-separated list of rules, e.g.
+// "qrw>100,dirty>20%". Thresholds may use the same units mongostat prints,
+// e.g. "net_in>10m" or "res>2G".
+func ParseAlertRules(spec string) ([]AlertRule, error) {
+	var rules []AlertRule
+	for _, text := range strings.Split(spec, ",") {
+		match := alertRuleRE.FindStringSubmatch(text)
+		if match == nil {
+			return nil, fmt.Errorf("invalid alert rule '%v', expected e.g. 'qrw>100'", text)
+		}
+		thresholds, ok := parseStatValue(match[3])
+		if !ok || len(thresholds) != 1 {
+			return nil, fmt.Errorf("invalid threshold '%v' in alert rule '%v'", match[3], text)
+		}
+		rules = append(rules, AlertRule{
+			Key:       match[1],
+			Op:        match[2],
+			Threshold: thresholds[0],
+			Text:      strings.TrimSpace(text),
+		})
+	}
+	return rules, nil
+}
+
+// Breached returns true if any of the values in a formatted field breach
+// the rule. Fields such as "qrw" hold several values, e.g. "3|2".
+func (rule AlertRule) Breached(field string) bool {
+	values, ok := parseStatValue(field)
+	if !ok {
+		return false
+	}
+	for _, value := range values {
+		switch {
+		case rule.Op == ">" && value > rule.Threshold,
+			rule.Op == ">=" && value >= rule.Threshold,
+			rule.Op == "<" && value < rule.Threshold,
+			rule.Op == "<=" && value <= rule.Threshold:
+			return true
+		}
+	}
+	return false
+}
+
+// statUnits are the multipliers for the unit suffixes mongostat prints:
+// lowercase for network bits, uppercase for memory bytes.
+var statUnits = map[byte]float64{
+	'b': 1, 'k': 1e3, 'm': 1e6, 'g': 1e9, 't': 1e12,
+	'B': 1, 'K': 1 << 10, 'M': 1 << 20, 'G': 1 << 30, 'T': 1 << 40,
+}
+
+// parseStatValue parses the numbers in a formatted mongostat field, ignoring
+// the '*' marking replicated operations and any percent sign or unit.
+func parseStatValue(field string) ([]float64, bool) {
+	field = strings.TrimPrefix(strings.TrimSpace(field), "*")
+	if field == "" {
+		return nil, false
+	}
+	var values []float64
+	for _, part := range strings.Split(field, "|") {
+		part = strings.TrimSuffix(strings.TrimPrefix(part, "*"), "%")
+		multiplier := 1.0
+		if n := len(part); n > 0 {
+			if unit, ok := statUnits[part[n-1]]; ok {
+				multiplier = unit
+				part = part[:n-1]
+			}
+		}
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, false
+		}
+		values = append(values, value*multiplier)
+	}
+	return values, true
+}
+
+// AlertMonitor checks every formatted sample against a set of rules and
+// raises an alert when a rule is breached for a number of consecutive
+// samples of a host.
+type AlertMonitor struct {
+	Rules []AlertRule
+
+	// Samples is the number of consecutive samples a rule must be breached
+	// for before an alert is raised.
+	Samples int
+
+	// Webhook, if set, is a URL that each alert is POSTed to as JSON.
+	Webhook string
+
+	// ExitOnAlert makes mongostat stop after the first alert.
+	ExitOnAlert bool
+
+	// Out is where alert lines are written.
+	Out io.Writer
+
+	Client *http.Client
+
+	// breaches counts consecutive breaching samples by host and rule.
+	breaches map[string]int
+	fired    bool
+}
+
+// Alert describes a rule breached by a host, as sent to the webhook.
+type Alert struct {
+	Host    string    `json:"host"`
+	Rule    string    `json:"rule"`
+	Value   string    `json:"value"`
+	Samples int       `json:"samples"`
+	Time    time.Time `json:"time"`
+}
+
+// NewAlertMonitor returns an AlertMonitor for the given rules.
+func NewAlertMonitor(rules []AlertRule, samples int, out io.Writer) *AlertMonitor {
+	if samples < 1 {
+		samples = 1
+	}
+	return &AlertMonitor{
+		Rules:    rules,
+		Samples:  samples,
+		Out:      out,
+		Client:   &http.Client{Timeout: 5 * time.Second},
+		breaches: map[string]int{},
+	}
+}
+
+// Check evaluates the rules against a set of lines, raising any alerts.
+// It returns true if mongostat should stop because an alert was raised.
+func (am *AlertMonitor) Check(lines []*line.StatLine) bool {
+	for _, l := range lines {
+		// lines that were already printed are stale, not a new sample
+		if l.Error != nil || l.Printed {
+			continue
+		}
+		host := l.Fields["host"]
+		for _, rule := range am.Rules {
+			key := host + "\x00" + rule.Text
+			field, ok := l.Fields[rule.Key]
+			if !ok || !rule.Breached(field) {
+				delete(am.breaches, key)
+				continue
+			}
+			am.breaches[key]++
+			// alert once per run of breaching samples
+			if am.breaches[key] == am.Samples {
+				am.raise(Alert{
+					Host:    host,
+					Rule:    rule.Text,
+					Value:   field,
+					Samples: am.Samples,
+					Time:    time.Now(),
+				})
+			}
+		}
+	}
+	return am.fired && am.ExitOnAlert
+}
+
+// Fired returns true if any alert has been raised.
+func (am *AlertMonitor) Fired() bool {
+	return am.fired
+}
+
+func (am *AlertMonitor) raise(alert Alert) {
+	am.fired = true
+	fmt.Fprintf(am.Out, "ALERT %v %v: %v is %v for %v sample(s)\n",
+		alert.Time.Format(time.RFC3339), alert.Host, alert.Rule, alert.Value, alert.Samples)
+	if am.Webhook == "" {
+		return
+	}
+	body, err := json.Marshal(alert)
+	if err == nil {
+		var resp *http.Response
+		resp, err = am.Client.Post(am.Webhook, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("webhook responded with %v", resp.Status)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(am.Out, "error sending alert to webhook: %v\n", err)
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+)
+
+// baselineColumns reads the value shown in a column from a Sample, for the
+// columns that can be compared against a baseline.
+var baselineColumns = map[string]func(*status.Sample) (float64, bool){
+	"insert":  baselineOps(func(ops *status.SampleOps) float64 { return ops.Insert }),
+	"query":   baselineOps(func(ops *status.SampleOps) float64 { return ops.Query }),
+	"update":  baselineOps(func(ops *status.SampleOps) float64 { return ops.Update }),
+	"delete":  baselineOps(func(ops *status.SampleOps) float64 { return ops.Delete }),
+	"getmore": baselineOps(func(ops *status.SampleOps) float64 { return ops.GetMore }),
+	"command": baselineOps(func(ops *status.SampleOps) float64 { return ops.Command }),
+	"dirty": func(s *status.Sample) (float64, bool) {
+		if s.Cache == nil {
+			return 0, false
+		}
+		return s.Cache.DirtyPercent, true
+	},
+	"used": func(s *status.Sample) (float64, bool) {
+		if s.Cache == nil {
+			return 0, false
+		}
+		return s.Cache.UsedPercent, true
+	},
+	"flushes": func(s *status.Sample) (float64, bool) {
+		if s.Flushes == nil {
+			return 0, false
+		}
+		return float64(*s.Flushes), true
+	},
+	"vsize": func(s *status.Sample) (float64, bool) {
+		if s.Memory == nil {
+			return 0, false
+		}
+		return float64(s.Memory.VirtualBytes), true
+	},
+	"res": func(s *status.Sample) (float64, bool) {
+		if s.Memory == nil {
+			return 0, false
+		}
+		return float64(s.Memory.ResidentBytes), true
+	},
+	"qrw": func(s *status.Sample) (float64, bool) {
+		if s.Queued == nil {
+			return 0, false
+		}
+		return float64(s.Queued.Read + s.Queued.Write), true
+	},
+	"arw": func(s *status.Sample) (float64, bool) {
+		if s.Active == nil {
+			return 0, false
+		}
+		return float64(s.Active.Read + s.Active.Write), true
+	},
+	"net_in": func(s *status.Sample) (float64, bool) {
+		if s.Network == nil {
+			return 0, false
+		}
+		return s.Network.BytesInPerSecond, true
+	},
+	"net_out": func(s *status.Sample) (float64, bool) {
+		if s.Network == nil {
+			return 0, false
+		}
+		return s.Network.BytesOutPerSecond, true
+	},
+	"conn": func(s *status.Sample) (float64, bool) {
+		if s.Connections == nil {
+			return 0, false
+		}
+		return float64(s.Connections.Current), true
+	},
+}
+
+// baselineOps reads an operation rate, including replicated operations.
+func baselineOps(read func(*status.SampleOps) float64) func(*status.Sample) (float64, bool) {
+	return func(s *status.Sample) (float64, bool) {
+		if s.Ops == nil && s.ReplOps == nil {
+			return 0, false
+		}
+		var total float64
+		if s.Ops != nil {
+			total += read(s.Ops)
+		}
+		if s.ReplOps != nil {
+			total += read(s.ReplOps)
+		}
+		return total, true
+	}
+}
+
+// Baseline is a previously recorded mongostat session that new samples are
+// compared against, at the same time elapsed since the start of each session.
+type Baseline struct {
+	// samples holds the recorded samples of each host, in time order.
+	samples map[string][]*status.Sample
+
+	// starts holds the time of the first new sample of each host.
+	starts map[string]time.Time
+}
+
+// LoadBaseline reads a session recorded with --format json.
+func LoadBaseline(r io.Reader) (*Baseline, error) {
+	baseline := &Baseline{
+		samples: map[string][]*status.Sample{},
+		starts:  map[string]time.Time{},
+	}
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		sample := &status.Sample{}
+		if err := json.Unmarshal([]byte(text), sample); err != nil {
+			return nil, fmt.Errorf("error parsing baseline line %v: %v", lineNum, err)
+		}
+		if sample.Version > status.SampleSchemaVersion {
+			return nil, fmt.Errorf("baseline line %v has unsupported version %v", lineNum, sample.Version)
+		}
+		if sample.Error != "" {
+			continue
+		}
+		baseline.samples[sample.Host] = append(baseline.samples[sample.Host], sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading baseline: %v", err)
+	}
+	if len(baseline.samples) == 0 {
+		return nil, fmt.Errorf("baseline has no samples; record one with --format json")
+	}
+	return baseline, nil
+}
+
+// At returns the baseline sample of a host at the given time since the start
+// of the baseline session. If the host wasn't recorded but the baseline has a
+// single host, that host's samples are used, so that a session can be
+// compared with one recorded against a different server.
+func (b *Baseline) At(host string, elapsed time.Duration) *status.Sample {
+	samples, ok := b.samples[host]
+	if !ok {
+		if len(b.samples) != 1 {
+			return nil
+		}
+		for _, only := range b.samples {
+			samples = only
+		}
+	}
+	start := samples[0].Time
+	match := samples[0]
+	for _, sample := range samples[1:] {
+		if sample.Time.Sub(start) > elapsed {
+			break
+		}
+		match = sample
+	}
+	return match
+}
+
+// Decorate appends the change from the baseline to the comparable fields of
+// lines that haven't been printed yet.
+func (b *Baseline) Decorate(lines []*line.StatLine, headerKeys []string) {
+	for _, l := range lines {
+		if l.Printed || l.Error != nil || l.Sample == nil {
+			continue
+		}
+		host := l.Sample.Host
+		start, ok := b.starts[host]
+		if !ok {
+			start = l.Sample.Time
+			b.starts[host] = start
+		}
+		base := b.At(host, l.Sample.Time.Sub(start))
+		if base == nil {
+			continue
+		}
+		for _, key := range headerKeys {
+			read, ok := baselineColumns[key]
+			if !ok {
+				continue
+			}
+			current, ok := read(l.Sample)
+			if !ok {
+				continue
+			}
+			previous, ok := read(base)
+			if !ok {
+				continue
+			}
+			l.Fields[key] += " (" + formatBaselineChange(current, previous) + ")"
+		}
+	}
+}
+
+// formatBaselineChange returns the percent change from the baseline value, or
+// the absolute change if the baseline value was zero.
+func formatBaselineChange(current, previous float64) string {
+	if previous == 0 {
+		return fmt.Sprintf("%+.0f", current)
+	}
+	return fmt.Sprintf("%+.0f%%", 100*(current-previous)/previous)
+}
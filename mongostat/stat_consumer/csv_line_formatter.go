@@ -0,0 +1,80 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/mongodb/mongo-tools/common/text"
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// CSVLineFormatter writes one CSV row per host per sample, for loading
+// mongostat output into spreadsheets and data analysis tools.
+type CSVLineFormatter struct {
+	*limitableFormatter
+
+	// If true, enables printing of headers to output
+	includeHeader bool
+
+	wroteHeader bool
+}
+
+func NewCSVLineFormatter(maxRows int64, includeHeader bool) LineFormatter {
+	return &CSVLineFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: maxRows},
+		includeHeader:      includeHeader,
+	}
+}
+
+func init() {
+	FormatterConstructors["csv"] = NewCSVLineFormatter
+}
+
+func (clf *CSVLineFormatter) Finish() {
+}
+
+// FormatLines formats the StatLines as CSV rows. The header row is written
+// before the first sample only, and a trailing "error" column holds the
+// error for hosts that couldn't be sampled.
+func (clf *CSVLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []string, keyNames map[string]string) string {
+	names := make([]string, 0, len(headerKeys)+1)
+	for _, key := range headerKeys {
+		names = append(names, keyNames[key])
+	}
+	table := text.NewTable(append(names, "error")...)
+	table.NoHeader = !clf.includeHeader || clf.wroteHeader
+	clf.wroteHeader = true
+
+	sort.Sort(line.StatLines(lines))
+	for _, l := range lines {
+		if l.Printed && l.Error == nil {
+			l.Error = fmt.Errorf("no data received")
+		}
+		l.Printed = true
+
+		row := make([]string, 0, len(headerKeys)+1)
+		for _, key := range headerKeys {
+			if l.Error != nil && key != "host" {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, l.Fields[key])
+		}
+		if l.Error != nil {
+			row = append(row, l.Error.Error())
+		}
+		table.AddRow(row...)
+	}
+	buf := &bytes.Buffer{}
+	table.WriteCSV(buf)
+
+	clf.increment()
+	return buf.String()
+}
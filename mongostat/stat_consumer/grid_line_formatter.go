@@ -10,16 +10,18 @@ import (
 	"bytes"
 	"fmt"
 	"sort"
-	"strings"
 
 	"github.com/mongodb/mongo-tools/common/text"
 	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
 )
 
-// GridLineFormatter uses a text.GridWriter to format the StatLines as a grid
+// GridLineFormatter uses a text.Table to format the StatLines as a grid
 type GridLineFormatter struct {
 	*limitableFormatter
-	*text.GridWriter
+
+	// The widths of the columns of the previous chunk, kept so that they
+	// don't shrink from one chunk to the next
+	widths []int
 
 	// If true, enables printing of headers to output
 	includeHeader bool
@@ -35,7 +37,6 @@ func NewGridLineFormatter(maxRows int64, includeHeader bool) LineFormatter {
 	return &GridLineFormatter{
 		limitableFormatter: &limitableFormatter{maxRows: maxRows},
 		includeHeader:      includeHeader,
-		GridWriter:         &text.GridWriter{ColumnPadding: 1},
 	}
 }
 
@@ -58,11 +59,15 @@ func (glf *GridLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 	sort.Sort(line.StatLines(lines))
 
 	// Print the columns that are enabled
-	for _, key := range headerKeys {
-		header := keyNames[key]
-		glf.WriteCell(header)
+	names := make([]string, len(headerKeys))
+	for i, key := range headerKeys {
+		names[i] = keyNames[key]
+	}
+	table := text.NewTable(names...)
+	// reuse the previous widths unless columns were added or removed
+	if len(glf.widths) == len(headerKeys) {
+		table.MinWidths = glf.widths
 	}
-	glf.EndRow()
 
 	for _, l := range lines {
 		if l.Printed && l.Error == nil {
@@ -71,42 +76,33 @@ func (glf *GridLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []s
 		l.Printed = true
 
 		if l.Error != nil {
-			glf.WriteCell(l.Fields["host"])
-			glf.Feed(l.Error.Error())
+			table.AddOverflowRow(l.Fields["host"], l.Error.Error())
 			continue
 		}
 
-		for _, key := range headerKeys {
-			glf.WriteCell(l.Fields[key])
+		cells := make([]string, len(headerKeys))
+		for i, key := range headerKeys {
+			cells[i] = l.Fields[key]
 		}
-		glf.EndRow()
+		table.AddRow(cells...)
 	}
-	glf.Flush(buf)
-
-	// clear the flushed data
-	glf.Reset()
-
-	gridLine := buf.String()
 
 	if glf.prevLineCount != len(lines) {
 		glf.index = 0
 	}
 	glf.prevLineCount = len(lines)
 
-	if !glf.includeHeader || glf.index != 0 {
-		// Strip out the first line of the formatted output,
-		// which contains the headers. They've been left in up until this point
-		// in order to force the formatting of the columns to be wide enough.
-		firstNewLinePos := strings.Index(gridLine, "\n")
-		if firstNewLinePos >= 0 {
-			gridLine = gridLine[firstNewLinePos+1:]
-		}
-	}
+	// The header still counts toward the widths of the columns when left out
+	table.NoHeader = !glf.includeHeader || glf.index != 0
 	glf.index++
 	if glf.index == headerInterval {
 		glf.index = 0
 	}
 
+	table.WriteText(buf)
+	glf.widths = table.Widths()
+	gridLine := buf.String()
+
 	if len(lines) > 1 {
 		// For multi-node stats, add an extra newline to tell each block apart
 		gridLine = fmt.Sprintf("\n%s", gridLine)
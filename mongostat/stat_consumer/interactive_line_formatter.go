@@ -18,6 +18,9 @@ import (
 	"github.com/nsf/termbox-go"
 )
 
+// maxHistory is the number of samples kept for scrolling back in time.
+const maxHistory = 300
+
 // InteractiveLineFormatter produces ncurses-style output
 type InteractiveLineFormatter struct {
 	*limitableFormatter
@@ -26,13 +29,39 @@ type InteractiveLineFormatter struct {
 	table         []*column
 	row, col      int
 	showHelp      bool
+
+	// history holds the most recent samples, and view is the index of the
+	// one being shown. While paused, new samples are kept but not shown.
+	history []*snapshot
+	view    int
+	paused  bool
+
+	// keys are the columns currently shown, hidden are the ones the user
+	// has hidden.
+	keys   []string
+	hidden map[string]bool
+
+	// sortKey is the column hosts are ordered by, if any.
+	sortKey        string
+	sortDescending bool
+
+	// rules are the alert rules whose breaching fields are highlighted.
+	rules []AlertRule
 	sync.Mutex
 }
 
+// snapshot is a copy of one sample, as shown in the table.
+type snapshot struct {
+	lines      []*line.StatLine
+	headerKeys []string
+	keyNames   map[string]string
+}
+
 func NewInteractiveLineFormatter(_ int64, includeHeader bool) LineFormatter {
 	ilf := &InteractiveLineFormatter{
 		limitableFormatter: &limitableFormatter{maxRows: 1},
 		includeHeader:      includeHeader,
+		hidden:             map[string]bool{},
 	}
 	if err := termbox.Init(); err != nil {
 		fmt.Printf("Error setting up terminal UI: %v", err)
@@ -63,39 +92,104 @@ type cell struct {
 	feed     bool
 	selected bool
 	header   bool
+	alert    bool
 }
 
 func (ilf *InteractiveLineFormatter) Finish() {
 	termbox.Close()
 }
 
+// SetHighlights sets the alert rules whose breaching fields are highlighted.
+func (ilf *InteractiveLineFormatter) SetHighlights(rules []AlertRule) {
+	ilf.Lock()
+	defer ilf.Unlock()
+	ilf.rules = rules
+}
+
 // FormatLines formats the StatLines as a table in the terminal ui
 func (ilf *InteractiveLineFormatter) FormatLines(lines []*line.StatLine, headerKeys []string, keyNames map[string]string) string {
 	defer ilf.update() // so that it runs after the unlock, because update locks again
 	ilf.Lock()
 	defer ilf.Unlock()
-	// keep ordering consistent
-	sort.Sort(line.StatLines(lines))
+
+	// copy the lines, since they are reused for the next sample
+	snap := &snapshot{headerKeys: headerKeys, keyNames: keyNames}
+	for _, l := range lines {
+		fields := make(map[string]string, len(l.Fields))
+		for k, v := range l.Fields {
+			fields[k] = v
+		}
+		snap.lines = append(snap.lines, &line.StatLine{Fields: fields, Error: l.Error})
+	}
+
+	following := ilf.view == len(ilf.history)-1
+	ilf.history = append(ilf.history, snap)
+	if len(ilf.history) > maxHistory {
+		ilf.history = ilf.history[1:]
+		if ilf.view > 0 {
+			ilf.view--
+		}
+	}
+	if !ilf.paused && (following || len(ilf.history) == 1) {
+		ilf.view = len(ilf.history) - 1
+		ilf.render()
+	}
+	return ""
+}
+
+// render fills the table with the sample being viewed.
+func (ilf *InteractiveLineFormatter) render() {
+	snap := ilf.history[ilf.view]
+
+	lines := make([]*line.StatLine, len(snap.lines))
+	copy(lines, snap.lines)
+	if ilf.sortKey != "" {
+		SortLines(lines, ilf.sortKey, ilf.sortDescending)
+	} else {
+		// keep ordering consistent
+		sort.Sort(line.StatLines(lines))
+	}
 
 	if ilf.includeHeader {
 		headerLine := &line.StatLine{
-			Fields: keyNames,
+			Fields: snap.keyNames,
 		}
 		lines = append([]*line.StatLine{headerLine}, lines...)
 	}
 
-	// add new rows and columns when new hosts and stats are shown
-	for len(ilf.table) < len(headerKeys) {
+	var keys []string
+	for _, key := range snap.headerKeys {
+		if !ilf.hidden[key] {
+			keys = append(keys, key)
+		}
+	}
+	// column widths only grow, to avoid jitter, unless the columns change
+	keysChanged := strings.Join(keys, ",") != strings.Join(ilf.keys, ",")
+	ilf.keys = keys
+
+	// add and remove rows and columns as hosts and stats are shown or hidden
+	for len(ilf.table) < len(ilf.keys) {
 		ilf.table = append(ilf.table, new(column))
 	}
+	ilf.table = ilf.table[:len(ilf.keys)]
 	for _, column := range ilf.table {
 		for len(column.cells) < len(lines) {
 			column.cells = append(column.cells, new(cell))
 		}
+		column.cells = column.cells[:len(lines)]
+		if keysChanged {
+			column.width = 0
+		}
+	}
+	if ilf.col >= len(ilf.table) {
+		ilf.col = len(ilf.table) - 1
+	}
+	if ilf.row >= len(lines) {
+		ilf.row = len(lines) - 1
 	}
 
 	for i, column := range ilf.table {
-		key := headerKeys[i]
+		key := ilf.keys[i]
 		for j, cell := range column.cells {
 			// i, j <=> col, row
 			l := lines[j]
@@ -109,13 +203,26 @@ func (ilf *InteractiveLineFormatter) FormatLines(lines []*line.StatLine, headerK
 			cell.text = newText
 			cell.feed = false
 			cell.header = j == 0 && ilf.includeHeader
-			if w := len(cell.text); w > column.width {
+			cell.alert = !cell.header && ilf.breaches(key, newText)
+			if w := len([]rune(cell.text)); w > column.width {
 				column.width = w
 			}
 		}
 	}
+}
 
-	return ""
+// breaches returns true if a field breaches any of the alert rules.
+func (ilf *InteractiveLineFormatter) breaches(key, field string) bool {
+	parts := strings.Fields(field)
+	if len(parts) == 0 {
+		return false
+	}
+	for _, rule := range ilf.rules {
+		if rule.Key == key && rule.Breached(parts[0]) {
+			return true
+		}
+	}
+	return false
 }
 
 func (ilf *InteractiveLineFormatter) handleEvent(ev termbox.Event) {
@@ -125,6 +232,9 @@ func (ilf *InteractiveLineFormatter) handleEvent(ev termbox.Event) {
 		return
 	}
 
+	if len(ilf.table) == 0 || len(ilf.table[0].cells) == 0 {
+		return
+	}
 	currSelected := ilf.table[ilf.col].cells[ilf.row].selected
 	switch {
 	case ev.Key == termbox.KeyCtrlC:
@@ -176,6 +286,47 @@ func (ilf *InteractiveLineFormatter) handleEvent(ev termbox.Event) {
 			cell := column.cells[ilf.row]
 			cell.selected = !currSelected
 		}
+	case ev.Ch == 'p':
+		ilf.paused = !ilf.paused
+		if !ilf.paused {
+			ilf.view = len(ilf.history) - 1
+		}
+		ilf.render()
+	case ev.Key == termbox.KeyPgup:
+		fallthrough
+	case ev.Ch == '[':
+		if ilf.view > 0 {
+			ilf.paused = true
+			ilf.view--
+			ilf.render()
+		}
+	case ev.Key == termbox.KeyPgdn:
+		fallthrough
+	case ev.Ch == ']':
+		if ilf.view+1 < len(ilf.history) {
+			ilf.view++
+			ilf.render()
+		}
+	case ev.Ch == 'x':
+		if len(ilf.keys) > 1 {
+			ilf.hidden[ilf.keys[ilf.col]] = true
+			ilf.render()
+		}
+	case ev.Ch == 'X':
+		ilf.hidden = map[string]bool{}
+		ilf.render()
+	case ev.Ch == 'o':
+		key := ilf.keys[ilf.col]
+		switch {
+		case ilf.sortKey != key:
+			// numbers are most interesting largest first
+			ilf.sortKey, ilf.sortDescending = key, true
+		case ilf.sortDescending:
+			ilf.sortDescending = false
+		default:
+			ilf.sortKey = ""
+		}
+		ilf.render()
 	case ev.Ch == 'r':
 		termbox.Sync()
 	case ev.Ch == '?':
@@ -195,12 +346,18 @@ Highlighting: 'v' to toggle row
               'c' to toggle column
               's' to toggle cell
               <Space> to clear all highlighting
+History: 'p' to pause or resume
+         '[' or <PgUp> for the previous sample
+         ']' or <PgDn> for the next sample
+Columns: 'x' to hide the current column
+         'X' to show all columns
+         'o' to sort hosts by the current column, again to reverse or reset
 Redraw: 'r' to fix broken-looking output`
 )
 
 func writeString(x, y int, text string, fg, bg termbox.Attribute) {
 	for i, str := range strings.Split(text, "\n") {
-		for j, ch := range str {
+		for j, ch := range []rune(str) {
 			termbox.SetCell(x+j, y+i, ch, fg, bg)
 		}
 	}
@@ -225,6 +382,9 @@ func (ilf *InteractiveLineFormatter) update() {
 				fgAttr = termbox.ColorBlack
 				bgAttr = termbox.ColorWhite
 			}
+			if cell.alert {
+				fgAttr = termbox.ColorRed
+			}
 			if cell.changed || cell.feed {
 				fgAttr |= termbox.AttrBold
 			}
@@ -232,7 +392,7 @@ func (ilf *InteractiveLineFormatter) update() {
 				fgAttr |= termbox.AttrUnderline
 				fgAttr |= termbox.AttrBold
 			}
-			padding := column.width - len(cell.text)
+			padding := column.width - len([]rune(cell.text))
 			if cell.feed && padding < 0 {
 				padding = 0
 			}
@@ -241,10 +401,30 @@ func (ilf *InteractiveLineFormatter) update() {
 		}
 		x += 1 + column.width
 	}
+	if len(ilf.table) == 0 {
+		termbox.Flush()
+		return
+	}
 	rowCount := len(ilf.table[0].cells)
-	writeString(0, rowCount+1, helpPrompt, termbox.ColorWhite, termbox.ColorDefault)
+	writeString(0, rowCount+1, ilf.statusLine(), termbox.ColorWhite, termbox.ColorDefault)
 	if ilf.showHelp {
 		writeString(0, rowCount+2, helpMessage, termbox.ColorWhite, termbox.ColorDefault)
 	}
 	termbox.Flush()
 }
+
+// statusLine describes the sample being viewed and how it is sorted.
+func (ilf *InteractiveLineFormatter) statusLine() string {
+	status := []string{helpPrompt}
+	if ilf.paused {
+		status = append(status, fmt.Sprintf("PAUSED at sample %v of %v", ilf.view+1, len(ilf.history)))
+	}
+	if ilf.sortKey != "" {
+		order := "ascending"
+		if ilf.sortDescending {
+			order = "descending"
+		}
+		status = append(status, fmt.Sprintf("sorted by %v, %v", ilf.sortKey, order))
+	}
+	return strings.Join(status, " | ")
+}
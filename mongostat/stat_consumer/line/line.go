@@ -15,6 +15,9 @@ type StatLine struct {
 	Fields  map[string]string
 	Error   error
 	Printed bool
+
+	// Sample holds the typed values of the line for --format json
+	Sample *status.Sample
 }
 
 type StatLines []*StatLine
@@ -23,7 +26,12 @@ func (slice StatLines) Len() int {
 	return len(slice)
 }
 
+// Less orders lines by shard, so that the members of each shard are shown
+// together in discover mode, and then by host.
 func (slice StatLines) Less(i, j int) bool {
+	if slice[i].Fields["shard"] != slice[j].Fields["shard"] {
+		return slice[i].Fields["shard"] < slice[j].Fields["shard"]
+	}
 	return slice[i].Fields["host"] < slice[j].Fields["host"]
 }
 
@@ -35,6 +43,7 @@ func (slice StatLines) Swap(i, j int) {
 func NewStatLine(oldStat, newStat *status.ServerStatus, headerKeys []string, c *status.ReaderConfig) *StatLine {
 	line := &StatLine{
 		Fields: make(map[string]string),
+		Sample: status.NewSample(newStat, oldStat),
 	}
 	for _, key := range headerKeys {
 		_, ok := StatHeaders[key]
@@ -20,6 +20,7 @@ const (
 	FlagAll                  // only active if mongostat was run with --all option
 	FlagMMAP                 // only active if node has mmap-specific fields
 	FlagWT                   // only active if node has wiredtiger-specific fields
+	FlagLatency              // only active if mongostat was run with --latency option
 )
 
 // StatHeader describes a single column for mongostat's terminal output,
@@ -34,6 +35,7 @@ type StatHeader struct {
 var (
 	keyNames = map[string][]string{ // short, long, deprecated
 		"host":           {"host", "Host", "host"},
+		"shard":          {"shard", "Shard, or config or mongos", "shard"},
 		"storage_engine": {"storage_engine", "Storage engine", "engine"},
 		"insert":         {"insert", "Insert opcounter (diff)", "insert"},
 		"query":          {"query", "Query opcounter (diff)", "query"},
@@ -44,6 +46,11 @@ var (
 		"dirty":          {"dirty", "Cache dirty (percentage)", "% dirty"},
 		"used":           {"used", "Cache used (percentage)", "% used"},
 		"flushes":        {"flushes", "Number of flushes (diff)", "flushes"},
+		"evicted":        {"evicted", "WiredTiger cache pages evicted (diff)", "evicted"},
+		"app_evict":      {"app_evict", "WiredTiger cache pages evicted by application threads (diff)", "appEvicted"},
+		"ckpt_ms":        {"ckpt_ms", "Duration of the last WiredTiger checkpoint (milliseconds)", "ckptMs"},
+		"tickets":        {"tickets", "WiredTiger tickets available, read|write", "ticketsR|W"},
+		"log_out":        {"log_out", "WiredTiger log bytes written (size)", "logOut"},
 		"mapped":         {"mapped", "Mapped (size)", "mapped"},
 		"vsize":          {"vsize", "Virtual (size)", "vsize"},
 		"res":            {"res", "Resident (size)", "res"},
@@ -54,15 +61,22 @@ var (
 		"locked_db":      {"locked_db", "Locked db info, '(db):(percentage)'", "locked"},
 		"qrw":            {"qrw", "Queued accesses, read|write", "qr|qw"},
 		"arw":            {"arw", "Active accesses, read|write", "ar|aw"},
+		"r_lat":          {"r_lat", "Read latency p50|p99 in microseconds, or the average without --latency (diff)", "rLat"},
+		"w_lat":          {"w_lat", "Write latency p50|p99 in microseconds, or the average without --latency (diff)", "wLat"},
+		"c_lat":          {"c_lat", "Command latency p50|p99 in microseconds, or the average without --latency (diff)", "cLat"},
+		"gl_queue":       {"gl_queue", "Global lock queue, total|read|write", "glQueue"},
+		"gl_wait":        {"gl_wait", "Global lock acquisitions that had to wait, read|write (diff)", "glWait"},
 		"net_in":         {"net_in", "Network input (size)", "netIn"},
 		"net_out":        {"net_out", "Network output (size)", "netOut"},
 		"conn":           {"conn", "Current connection count", "conn"},
+		"size":           {"size", "Database data size (size)", "size"},
 		"set":            {"set", "FlagReplica set name", "set"},
 		"repl":           {"repl", "FlagReplica set type", "repl"},
 		"time":           {"time", "Time of sample", "time"},
 	}
 	StatHeaders = map[string]StatHeader{
 		"host":           {status.ReadHost},
+		"shard":          {status.ReadShard},
 		"storage_engine": {status.ReadStorageEngine},
 		"insert":         {status.ReadInsert},
 		"query":          {status.ReadQuery},
@@ -73,6 +87,11 @@ var (
 		"dirty":          {status.ReadDirty},
 		"used":           {status.ReadUsed},
 		"flushes":        {status.ReadFlushes},
+		"evicted":        {status.ReadEvicted},
+		"app_evict":      {status.ReadAppEvicted},
+		"ckpt_ms":        {status.ReadCheckpointTime},
+		"tickets":        {status.ReadTickets},
+		"log_out":        {status.ReadLogOut},
 		"mapped":         {status.ReadMapped},
 		"vsize":          {status.ReadVSize},
 		"res":            {status.ReadRes},
@@ -83,9 +102,15 @@ var (
 		"locked_db":      {status.ReadLockedDB},
 		"qrw":            {status.ReadQRW},
 		"arw":            {status.ReadARW},
+		"r_lat":          {status.ReadReadLatency},
+		"w_lat":          {status.ReadWriteLatency},
+		"c_lat":          {status.ReadCommandLatency},
+		"gl_queue":       {status.ReadGlobalQueue},
+		"gl_wait":        {status.ReadGlobalWaits},
 		"net_in":         {status.ReadNetIn},
 		"net_out":        {status.ReadNetOut},
 		"conn":           {status.ReadConn},
+		"size":           {status.ReadDataSize},
 		"set":            {status.ReadSet},
 		"repl":           {status.ReadRepl},
 		"time":           {status.ReadTime},
@@ -95,6 +120,7 @@ var (
 		Flag int
 	}{
 		{"host", FlagHosts},
+		{"shard", FlagDiscover},
 		{"insert", FlagAlways},
 		{"query", FlagAlways},
 		{"update", FlagAlways},
@@ -114,6 +140,11 @@ var (
 		{"locked_db", FlagLocks},
 		{"qrw", FlagAlways},
 		{"arw", FlagAlways},
+		{"r_lat", FlagLatency},
+		{"w_lat", FlagLatency},
+		{"c_lat", FlagLatency},
+		{"gl_queue", FlagLatency},
+		{"gl_wait", FlagLatency},
 		{"net_in", FlagAlways},
 		{"net_out", FlagAlways},
 		{"conn", FlagAlways},
@@ -123,6 +154,13 @@ var (
 	}
 )
 
+// DatabaseHeaders are the columns shown with --perDatabase, for which the
+// host is named "<host>/<database>".
+var DatabaseHeaders = []string{"host", "insert", "query", "update", "delete", "getmore", "command", "size", "time"}
+
+// WiredTigerHeaders are the columns shown with --wt.
+var WiredTigerHeaders = []string{"used", "dirty", "evicted", "app_evict", "flushes", "ckpt_ms", "tickets", "log_out", "time"}
+
 func defaultKeyMap(index int) map[string]string {
 	names := make(map[string]string)
 	for k, v := range keyNames {
@@ -0,0 +1,65 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+	"github.com/mongodb/mongo-tools/mongostat/status"
+)
+
+// SampleLineFormatter writes every StatLine as a versioned status.Sample,
+// one JSON document per line, for consumption by other programs.
+type SampleLineFormatter struct {
+	*limitableFormatter
+}
+
+func NewSampleLineFormatter(maxRows int64, _ bool) LineFormatter {
+	return &SampleLineFormatter{
+		limitableFormatter: &limitableFormatter{maxRows: maxRows},
+	}
+}
+
+func init() {
+	FormatterConstructors["sample"] = NewSampleLineFormatter
+}
+
+func (slf *SampleLineFormatter) Finish() {
+}
+
+// FormatLines ignores the headers, since a Sample has a fixed structure.
+func (slf *SampleLineFormatter) FormatLines(lines []*line.StatLine, _ []string, _ map[string]string) string {
+	buf := &bytes.Buffer{}
+	for _, l := range lines {
+		if l.Printed && l.Error == nil {
+			l.Error = fmt.Errorf("no data received")
+		}
+		l.Printed = true
+
+		sample := l.Sample
+		if l.Error != nil || sample == nil {
+			err := l.Error
+			if err == nil {
+				err = fmt.Errorf("no data received")
+			}
+			sample = status.NewErrorSample(l.Fields["host"], time.Now(), err)
+		}
+		sampleJSON, err := json.Marshal(sample)
+		if err != nil {
+			fmt.Fprintf(buf, `{"json error": "%v"}`+"\n", err.Error())
+			continue
+		}
+		buf.Write(sampleJSON)
+		buf.WriteByte('\n')
+	}
+	slf.increment()
+	return buf.String()
+}
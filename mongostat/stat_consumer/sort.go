@@ -0,0 +1,70 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// fieldValue returns the total of the numbers in a field, ignoring any
+// sparkline or baseline change appended to it.
+func fieldValue(field string) (float64, bool) {
+	parts := strings.Fields(field)
+	if len(parts) == 0 {
+		return 0, false
+	}
+	values, ok := parseStatValue(parts[0])
+	if !ok {
+		return 0, false
+	}
+	var total float64
+	for _, value := range values {
+		total += value
+	}
+	return total, true
+}
+
+// SortLines orders lines by the value of a column, numerically where the
+// values are numbers. Lines with errors always sort last, and lines with
+// equal values keep the default host order.
+func SortLines(lines []*line.StatLine, key string, descending bool) {
+	sort.Sort(line.StatLines(lines))
+	sort.SliceStable(lines, func(i, j int) bool {
+		a, b := lines[i], lines[j]
+		if (a.Error == nil) != (b.Error == nil) {
+			return a.Error == nil
+		}
+		if a.Error != nil {
+			return false
+		}
+		aValue, aNumeric := fieldValue(a.Fields[key])
+		bValue, bNumeric := fieldValue(b.Fields[key])
+		switch {
+		case aNumeric && bNumeric:
+			if descending {
+				return aValue > bValue
+			}
+			return aValue < bValue
+		case aNumeric != bNumeric:
+			// numbers before blanks and text
+			return aNumeric
+		}
+		if descending {
+			return a.Fields[key] > b.Fields[key]
+		}
+		return a.Fields[key] < b.Fields[key]
+	})
+}
+
+// Highlighter is implemented by formatters that can highlight the fields
+// breaching alert rules.
+type Highlighter interface {
+	SetHighlights(rules []AlertRule)
+}
@@ -27,6 +27,17 @@ type StatConsumer struct {
 	keyNames               map[string]string
 	writer                 io.Writer
 	flags                  int
+
+	// Alerts, if non-nil, checks every set of formatted lines against
+	// threshold rules.
+	Alerts *AlertMonitor
+
+	// Trends, if non-nil, adds sparklines and trend arrows to numeric fields.
+	Trends *TrendTracker
+
+	// Baseline, if non-nil, adds the change from a recorded session to
+	// numeric fields.
+	Baseline *Baseline
 }
 
 // NewStatConsumer creates a new StatConsumer with no previous records
@@ -83,11 +94,19 @@ func (sc *StatConsumer) Update(newStat *status.ServerStatus) (l *line.StatLine,
 // FormatLines consumes StatLines, formats them, and sends them to its writer
 // It returns true if the formatter should no longer receive data
 func (sc *StatConsumer) FormatLines(lines []*line.StatLine) bool {
+	// alerts are checked before the fields are decorated for display
+	alerted := sc.Alerts != nil && sc.Alerts.Check(lines)
+	if sc.Trends != nil {
+		sc.Trends.Decorate(lines, sc.headers)
+	}
+	if sc.Baseline != nil {
+		sc.Baseline.Decorate(lines, sc.headers)
+	}
 	str := sc.formatter.FormatLines(lines, sc.headers, sc.keyNames)
 	_, err := fmt.Fprintf(sc.writer, "%s", str)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "error writing formatted output: %v", err)
 		os.Exit(util.ExitError)
 	}
-	return sc.formatter.IsFinished()
+	return alerted || sc.formatter.IsFinished()
 }
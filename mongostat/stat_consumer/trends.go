@@ -0,0 +1,107 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package stat_consumer
+
+import (
+	"github.com/mongodb/mongo-tools/mongostat/stat_consumer/line"
+)
+
+// sparkTicks are the bars used to draw sparklines, from lowest to highest.
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// Trend arrows comparing a value to the previous sample.
+const (
+	trendUp   = "↑"
+	trendDown = "↓"
+	trendFlat = "→"
+)
+
+// TrendTracker keeps the recent values of every numeric column of every
+// host, and decorates new samples with a sparkline and a trend arrow.
+type TrendTracker struct {
+	// Samples is the number of samples shown in each sparkline.
+	Samples int
+
+	// history holds the recent values by host and column.
+	history map[string][]float64
+}
+
+// NewTrendTracker returns a TrendTracker drawing sparklines of the given length.
+func NewTrendTracker(samples int) *TrendTracker {
+	return &TrendTracker{
+		Samples: samples,
+		history: map[string][]float64{},
+	}
+}
+
+// Decorate appends a sparkline and a trend arrow to the numeric fields of
+// lines that haven't been printed yet. Fields holding several values, such
+// as "qrw", are tracked by their total.
+func (tt *TrendTracker) Decorate(lines []*line.StatLine, headerKeys []string) {
+	for _, l := range lines {
+		if l.Printed || l.Error != nil {
+			continue
+		}
+		for _, key := range headerKeys {
+			field := l.Fields[key]
+			values, ok := parseStatValue(field)
+			if !ok || key == "host" {
+				continue
+			}
+			var total float64
+			for _, value := range values {
+				total += value
+			}
+
+			historyKey := l.Fields["host"] + "\x00" + key
+			history := append(tt.history[historyKey], total)
+			if len(history) > tt.Samples {
+				history = history[len(history)-tt.Samples:]
+			}
+			tt.history[historyKey] = history
+
+			l.Fields[key] = field + " " + sparkline(history) + trend(history)
+		}
+	}
+}
+
+// sparkline draws values as bars scaled between their minimum and maximum.
+func sparkline(values []float64) string {
+	min, max := values[0], values[0]
+	for _, value := range values {
+		if value < min {
+			min = value
+		}
+		if value > max {
+			max = value
+		}
+	}
+	bars := make([]rune, 0, len(values))
+	for _, value := range values {
+		tick := 0
+		if max > min {
+			tick = int((value - min) / (max - min) * float64(len(sparkTicks)-1))
+		}
+		bars = append(bars, sparkTicks[tick])
+	}
+	return string(bars)
+}
+
+// trend compares the latest value to the one before it.
+func trend(values []float64) string {
+	if len(values) < 2 {
+		return trendFlat
+	}
+	current, previous := values[len(values)-1], values[len(values)-2]
+	switch {
+	case current > previous:
+		return trendUp
+	case current < previous:
+		return trendDown
+	}
+	return trendFlat
+}
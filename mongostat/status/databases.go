@@ -0,0 +1,102 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mongodb/mongo-tools/common/text"
+)
+
+// TopStats holds the output of the "top" command, which reports counters
+// for every namespace.
+type TopStats struct {
+	Totals map[string]TopNamespace `bson:"totals"`
+}
+
+// TopNamespace holds the "top" counters of a single namespace.
+type TopNamespace struct {
+	Queries  TopCounter `bson:"queries"`
+	GetMore  TopCounter `bson:"getmore"`
+	Insert   TopCounter `bson:"insert"`
+	Update   TopCounter `bson:"update"`
+	Remove   TopCounter `bson:"remove"`
+	Commands TopCounter `bson:"commands"`
+}
+
+// TopCounter holds the time spent on and number of operations of one type.
+type TopCounter struct {
+	Time  int64 `bson:"time"`
+	Count int64 `bson:"count"`
+}
+
+// DatabaseStats holds the counters of a single database, for --perDatabase.
+type DatabaseStats struct {
+	Name       string
+	Opcounters OpcountStats
+	// DataSize is the uncompressed size of the database's documents, in bytes.
+	DataSize int64
+}
+
+// DatabaseOpcounters sums the "top" counters of every namespace by database.
+func DatabaseOpcounters(top *TopStats) map[string]*OpcountStats {
+	counters := map[string]*OpcountStats{}
+	for namespace, ns := range top.Totals {
+		dot := strings.Index(namespace, ".")
+		if dot <= 0 {
+			// e.g. the "note" entry
+			continue
+		}
+		dbName := namespace[:dot]
+		ops, ok := counters[dbName]
+		if !ok {
+			ops = &OpcountStats{}
+			counters[dbName] = ops
+		}
+		ops.Insert += ns.Insert.Count
+		ops.Query += ns.Queries.Count
+		ops.Update += ns.Update.Count
+		ops.Delete += ns.Remove.Count
+		ops.GetMore += ns.GetMore.Count
+		ops.Command += ns.Commands.Count
+	}
+	return counters
+}
+
+// SplitDatabases returns a ServerStatus for every database of a sample
+// collected with per-database stats, named "<host>/<database>", so that
+// each database is shown and diffed as a host of its own.
+func SplitDatabases(stat *ServerStatus) []*ServerStatus {
+	stats := make([]*ServerStatus, 0, len(stat.Databases))
+	for _, dbStats := range stat.Databases {
+		ops := dbStats.Opcounters
+		stats = append(stats, &ServerStatus{
+			SampleTime: stat.SampleTime,
+			Host:       fmt.Sprintf("%v/%v", stat.Host, dbStats.Name),
+			Version:    stat.Version,
+			Process:    stat.Process,
+			Uptime:     stat.Uptime,
+			Opcounters: &ops,
+			Repl:       stat.Repl,
+			Database:   dbStats,
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Host < stats[j].Host })
+	return stats
+}
+
+func ReadDataSize(c *ReaderConfig, newStat, _ *ServerStatus) string {
+	if newStat.Database == nil {
+		return ""
+	}
+	if c.HumanReadable {
+		return text.FormatShortByteAmount(newStat.Database.DataSize)
+	}
+	return fmt.Sprintf("%v", newStat.Database.DataSize)
+}
@@ -0,0 +1,143 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+// MetricType describes how a metric's value changes over time.
+type MetricType int
+
+const (
+	// Gauge metrics can go up and down, e.g. the number of connections.
+	Gauge MetricType = iota
+	// Counter metrics only increase while the server is running, e.g. opcounters.
+	Counter
+)
+
+// Metric is a single typed value read from a ServerStatus, for consumers
+// that export raw values rather than formatted table columns.
+type Metric struct {
+	// Name is the metric name, e.g. "mongodb_opcounters_total".
+	Name string
+	// Help is a one-line description of the metric.
+	Help string
+	Type MetricType
+	// Label and LabelValue optionally distinguish series of the same metric,
+	// e.g. Label "type" with LabelValue "insert".
+	Label, LabelValue string
+	Value             float64
+}
+
+// ReadMetrics returns the metrics mongostat reports for a single sample.
+// Counters are the raw totals reported by the server, so that consumers can
+// compute rates over any interval they choose.
+func ReadMetrics(stat *ServerStatus) []Metric {
+	var metrics []Metric
+	add := func(name, help string, typ MetricType, label, labelValue string, value int64) {
+		metrics = append(metrics, Metric{
+			Name:       name,
+			Help:       help,
+			Type:       typ,
+			Label:      label,
+			LabelValue: labelValue,
+			Value:      float64(value),
+		})
+	}
+
+	add("mongodb_uptime_seconds", "Time since the server started", Gauge, "", "", stat.Uptime)
+
+	opcounters := func(name, help string, ops *OpcountStats) {
+		if ops == nil {
+			return
+		}
+		add(name, help, Counter, "type", "insert", ops.Insert)
+		add(name, help, Counter, "type", "query", ops.Query)
+		add(name, help, Counter, "type", "update", ops.Update)
+		add(name, help, Counter, "type", "delete", ops.Delete)
+		add(name, help, Counter, "type", "getmore", ops.GetMore)
+		add(name, help, Counter, "type", "command", ops.Command)
+	}
+	opcounters("mongodb_opcounters_total", "Operations received by the server", stat.Opcounters)
+	opcounters("mongodb_opcounters_repl_total", "Replicated operations applied by the server", stat.OpcountersRepl)
+
+	if gl := stat.GlobalLock; gl != nil {
+		if gl.CurrentQueue != nil {
+			help := "Operations queued waiting for a lock"
+			add("mongodb_global_lock_queue", help, Gauge, "type", "read", gl.CurrentQueue.Readers)
+			add("mongodb_global_lock_queue", help, Gauge, "type", "write", gl.CurrentQueue.Writers)
+		}
+		if gl.ActiveClients != nil {
+			help := "Clients with active operations"
+			add("mongodb_global_lock_active_clients", help, Gauge, "type", "read", gl.ActiveClients.Readers)
+			add("mongodb_global_lock_active_clients", help, Gauge, "type", "write", gl.ActiveClients.Writers)
+		}
+	}
+
+	if wt := stat.WiredTiger; wt != nil {
+		add("mongodb_wiredtiger_cache_bytes", "Bytes currently in the WiredTiger cache",
+			Gauge, "", "", wt.Cache.CurrentCachedBytes)
+		add("mongodb_wiredtiger_cache_dirty_bytes", "Tracked dirty bytes in the WiredTiger cache",
+			Gauge, "", "", wt.Cache.TrackedDirtyBytes)
+		add("mongodb_wiredtiger_cache_max_bytes", "Maximum size of the WiredTiger cache",
+			Gauge, "", "", wt.Cache.MaxBytesConfigured)
+		help := "WiredTiger read and write tickets in use"
+		add("mongodb_wiredtiger_concurrent_transactions", help, Gauge, "type", "read", wt.Concurrent.Read.Out)
+		add("mongodb_wiredtiger_concurrent_transactions", help, Gauge, "type", "write", wt.Concurrent.Write.Out)
+		add("mongodb_wiredtiger_checkpoints_total", "WiredTiger checkpoints taken",
+			Counter, "", "", wt.Transaction.TransCheckpoints)
+	}
+
+	if net := stat.Network; net != nil {
+		add("mongodb_network_bytes_total", "Network traffic", Counter, "direction", "in", net.BytesIn)
+		add("mongodb_network_bytes_total", "Network traffic", Counter, "direction", "out", net.BytesOut)
+		add("mongodb_network_requests_total", "Requests received", Counter, "", "", net.NumRequests)
+	}
+
+	if conn := stat.Connections; conn != nil {
+		add("mongodb_connections", "Incoming connections", Gauge, "state", "current", conn.Current)
+		add("mongodb_connections", "Incoming connections", Gauge, "state", "available", conn.Available)
+	}
+
+	if mem := stat.Mem; mem != nil && util.IsTruthy(mem.Supported) {
+		add("mongodb_memory_bytes", "Memory used by the server process", Gauge, "type", "resident", mem.Resident*1024*1024)
+		add("mongodb_memory_bytes", "Memory used by the server process", Gauge, "type", "virtual", mem.Virtual*1024*1024)
+	}
+
+	return metrics
+}
+
+// ReplicationLag returns how far each secondary's last write is behind the
+// last write of the primary of its replica set, keyed by host. Only members
+// whose primary is among the given statuses are included.
+func ReplicationLag(stats []*ServerStatus) map[string]time.Duration {
+	primaries := map[string]time.Time{}
+	for _, stat := range stats {
+		if stat.Repl != nil && stat.Repl.LastWrite != nil && util.IsTruthy(stat.Repl.IsMaster) {
+			primaries[stat.Repl.SetName] = stat.Repl.LastWrite.LastWriteDate
+		}
+	}
+	lags := map[string]time.Duration{}
+	for _, stat := range stats {
+		if stat.Repl == nil || stat.Repl.LastWrite == nil || !util.IsTruthy(stat.Repl.Secondary) {
+			continue
+		}
+		primaryWrite, ok := primaries[stat.Repl.SetName]
+		if !ok {
+			continue
+		}
+		lag := primaryWrite.Sub(stat.Repl.LastWrite.LastWriteDate)
+		if lag < 0 {
+			lag = 0
+		}
+		lags[stat.Host] = lag
+	}
+	return lags
+}
@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"regexp"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/mongodb/mongo-tools/common/text"
@@ -247,6 +248,52 @@ func ReadUsed(c *ReaderConfig, newStat, _ *ServerStatus) (val string) {
 	return
 }
 
+func ReadEvicted(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if newStat.WiredTiger == nil || oldStat.WiredTiger == nil {
+		return ""
+	}
+	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+	newCache, oldCache := newStat.WiredTiger.Cache, oldStat.WiredTiger.Cache
+	return fmt.Sprintf("%d", diff(newCache.UnmodifiedEvicted+newCache.ModifiedEvicted,
+		oldCache.UnmodifiedEvicted+oldCache.ModifiedEvicted, sampleSecs))
+}
+
+func ReadAppEvicted(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if newStat.WiredTiger == nil || oldStat.WiredTiger == nil {
+		return ""
+	}
+	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+	return fmt.Sprintf("%d", diff(newStat.WiredTiger.Cache.AppThreadEvicted,
+		oldStat.WiredTiger.Cache.AppThreadEvicted, sampleSecs))
+}
+
+func ReadCheckpointTime(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	if newStat.WiredTiger == nil {
+		return ""
+	}
+	return fmt.Sprintf("%d", newStat.WiredTiger.Transaction.LastCheckpointMillis)
+}
+
+func ReadTickets(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	if newStat.WiredTiger == nil {
+		return ""
+	}
+	concurrent := newStat.WiredTiger.Concurrent
+	return fmt.Sprintf("%v|%v", concurrent.Read.Available, concurrent.Write.Available)
+}
+
+func ReadLogOut(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if newStat.WiredTiger == nil || oldStat.WiredTiger == nil {
+		return ""
+	}
+	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+	val := diff(newStat.WiredTiger.Log.BytesWritten, oldStat.WiredTiger.Log.BytesWritten, sampleSecs)
+	if c.HumanReadable {
+		return text.FormatShortByteAmount(val)
+	}
+	return fmt.Sprintf("%d", val)
+}
+
 func ReadFlushes(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
 	var val int64
 	if newStat.WiredTiger != nil && oldStat.WiredTiger != nil {
@@ -381,15 +428,15 @@ func ReadLockedDB(_ *ReaderConfig, newStat, oldStat *ServerStatus) (val string)
 	return
 }
 
-func ReadQRW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
-	var qr int64
-	var qw int64
-	gl := newStat.GlobalLock
+// queuedReadWrite returns the number of readers and writers waiting for a
+// lock, or for a ticket when WiredTiger stats are available.
+func queuedReadWrite(stat *ServerStatus) (qr, qw int64) {
+	gl := stat.GlobalLock
 	if gl != nil && gl.CurrentQueue != nil {
 		// If we have wiredtiger stats, use those instead
-		if newStat.WiredTiger != nil {
-			qr = gl.CurrentQueue.Readers + gl.ActiveClients.Readers - newStat.WiredTiger.Concurrent.Read.Out
-			qw = gl.CurrentQueue.Writers + gl.ActiveClients.Writers - newStat.WiredTiger.Concurrent.Write.Out
+		if stat.WiredTiger != nil {
+			qr = gl.CurrentQueue.Readers + gl.ActiveClients.Readers - stat.WiredTiger.Concurrent.Read.Out
+			qw = gl.CurrentQueue.Writers + gl.ActiveClients.Writers - stat.WiredTiger.Concurrent.Write.Out
 			if qr < 0 {
 				qr = 0
 			}
@@ -401,24 +448,124 @@ func ReadQRW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
 			qw = gl.CurrentQueue.Writers
 		}
 	}
-	return fmt.Sprintf("%v|%v", qr, qw)
+	return
 }
 
-func ReadARW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
-	var ar int64
-	var aw int64
-	if gl := newStat.GlobalLock; gl != nil {
-		if newStat.WiredTiger != nil {
-			ar = newStat.WiredTiger.Concurrent.Read.Out
-			aw = newStat.WiredTiger.Concurrent.Write.Out
-		} else if newStat.GlobalLock.ActiveClients != nil {
+// activeReadWrite returns the number of active readers and writers.
+func activeReadWrite(stat *ServerStatus) (ar, aw int64) {
+	if gl := stat.GlobalLock; gl != nil {
+		if stat.WiredTiger != nil {
+			ar = stat.WiredTiger.Concurrent.Read.Out
+			aw = stat.WiredTiger.Concurrent.Write.Out
+		} else if stat.GlobalLock.ActiveClients != nil {
 			ar = gl.ActiveClients.Readers
 			aw = gl.ActiveClients.Writers
 		}
 	}
+	return
+}
+
+func ReadQRW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	qr, qw := queuedReadWrite(newStat)
+	return fmt.Sprintf("%v|%v", qr, qw)
+}
+
+func ReadARW(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	ar, aw := activeReadWrite(newStat)
 	return fmt.Sprintf("%v|%v", ar, aw)
 }
 
+// latencyPercentiles returns the latencies in microseconds below which the
+// given fractions of operations between two samples completed. Each is the
+// upper bound of the histogram bucket it falls in.
+func latencyPercentiles(newLat, oldLat *OpLatencyStats, fractions ...float64) ([]int64, bool) {
+	if newLat == nil || oldLat == nil || len(newLat.Histogram) == 0 {
+		return nil, false
+	}
+	oldCounts := map[int64]int64{}
+	for _, bucket := range oldLat.Histogram {
+		oldCounts[bucket.Micros] = bucket.Count
+	}
+	buckets := make([]LatencyBucket, len(newLat.Histogram))
+	var total int64
+	for i, bucket := range newLat.Histogram {
+		buckets[i] = LatencyBucket{Micros: bucket.Micros, Count: bucket.Count - oldCounts[bucket.Micros]}
+		total += buckets[i].Count
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Micros < buckets[j].Micros })
+
+	values := make([]int64, len(fractions))
+	for i, fraction := range fractions {
+		if total == 0 {
+			continue
+		}
+		var seen int64
+		for j, bucket := range buckets {
+			seen += bucket.Count
+			if float64(seen) >= fraction*float64(total) {
+				values[i] = bucket.Micros
+				if j+1 < len(buckets) {
+					values[i] = buckets[j+1].Micros
+				}
+				break
+			}
+		}
+	}
+	return values, true
+}
+
+// readLatency formats the p50|p99 latency of one kind of operation, or the
+// average latency when the server did not report a histogram.
+func readLatency(newStat, oldStat *ServerStatus, kind func(*OpLatenciesStats) *OpLatencyStats) string {
+	if newStat.OpLatencies == nil || oldStat.OpLatencies == nil {
+		return ""
+	}
+	newLat, oldLat := kind(newStat.OpLatencies), kind(oldStat.OpLatencies)
+	if newLat == nil || oldLat == nil {
+		return ""
+	}
+	if percentiles, ok := latencyPercentiles(newLat, oldLat, 0.5, 0.99); ok {
+		return fmt.Sprintf("%v|%v", percentiles[0], percentiles[1])
+	}
+	return fmt.Sprintf("%v", averageInt64(newLat.Latency-oldLat.Latency, newLat.Ops-oldLat.Ops))
+}
+
+func ReadReadLatency(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return readLatency(newStat, oldStat, func(l *OpLatenciesStats) *OpLatencyStats { return l.Reads })
+}
+
+func ReadWriteLatency(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return readLatency(newStat, oldStat, func(l *OpLatenciesStats) *OpLatencyStats { return l.Writes })
+}
+
+func ReadCommandLatency(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	return readLatency(newStat, oldStat, func(l *OpLatenciesStats) *OpLatencyStats { return l.Commands })
+}
+
+func ReadGlobalQueue(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	if newStat.GlobalLock == nil || newStat.GlobalLock.CurrentQueue == nil {
+		return ""
+	}
+	queue := newStat.GlobalLock.CurrentQueue
+	return fmt.Sprintf("%v|%v|%v", queue.Total, queue.Readers, queue.Writers)
+}
+
+func ReadGlobalWaits(_ *ReaderConfig, newStat, oldStat *ServerStatus) string {
+	if IsMongos(newStat) || newStat.Locks == nil || oldStat.Locks == nil {
+		return ""
+	}
+	newGlobal, inNew := newStat.Locks["Global"]
+	oldGlobal, inOld := oldStat.Locks["Global"]
+	if !inNew || !inOld || newGlobal.AcquireWaitCount == nil || oldGlobal.AcquireWaitCount == nil {
+		return ""
+	}
+	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
+	newWaits, oldWaits := newGlobal.AcquireWaitCount, oldGlobal.AcquireWaitCount
+	return fmt.Sprintf("%v|%v",
+		diff(newWaits.Read+newWaits.ReadLower, oldWaits.Read+oldWaits.ReadLower, sampleSecs),
+		diff(newWaits.Write+newWaits.WriteLower, oldWaits.Write+oldWaits.WriteLower, sampleSecs))
+}
+
 func ReadNetIn(c *ReaderConfig, newStat, oldStat *ServerStatus) string {
 	sampleSecs := float64(newStat.SampleTime.Sub(oldStat.SampleTime).Seconds())
 	val := diff(newStat.Network.BytesIn, oldStat.Network.BytesIn, sampleSecs)
@@ -435,6 +582,35 @@ func ReadConn(_ *ReaderConfig, newStat, _ *ServerStatus) string {
 	return fmt.Sprintf("%d", newStat.Connections.Current)
 }
 
+// ConfigServers returns the replica set name and hosts of the config servers
+// of the sharded cluster the node belongs to, if it reports them.
+func ConfigServers(stat *ServerStatus) (setName string, hosts []string) {
+	if stat.Sharding == nil || stat.Sharding.ConfigsvrConnectionString == "" {
+		return "", nil
+	}
+	connString := stat.Sharding.ConfigsvrConnectionString
+	if slash := strings.Index(connString, "/"); slash != -1 {
+		setName, connString = connString[:slash], connString[slash+1:]
+	}
+	return setName, strings.Split(connString, ",")
+}
+
+// ReadShard returns the part of the cluster a node belongs to: "mongos" for
+// routers, "config" for config servers, and otherwise its replica set name,
+// which names the shard it serves.
+func ReadShard(_ *ReaderConfig, newStat, _ *ServerStatus) string {
+	if IsMongos(newStat) {
+		return "mongos"
+	}
+	if newStat.Repl == nil {
+		return ""
+	}
+	if configSet, _ := ConfigServers(newStat); configSet != "" && configSet == newStat.Repl.SetName {
+		return "config"
+	}
+	return newStat.Repl.SetName
+}
+
 func ReadSet(_ *ReaderConfig, newStat, _ *ServerStatus) (name string) {
 	if newStat.Repl != nil {
 		name = newStat.Repl.SetName
@@ -0,0 +1,195 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+// SampleSchemaVersion is the version of the Sample structure. It is
+// incremented whenever a field is removed or changes meaning; fields may be
+// added without changing it, so consumers should ignore unknown fields.
+const SampleSchemaVersion = 1
+
+// Sample is the machine-readable form of one interval of stats for one host,
+// as written by --format json. Unlike the table columns, its fields are typed
+// numbers that don't depend on --humanReadable, and sections the server
+// doesn't report are omitted rather than left blank.
+type Sample struct {
+	// Version is always SampleSchemaVersion.
+	Version int    `json:"version"`
+	Host    string `json:"host"`
+	// Time is when the sample was taken.
+	Time time.Time `json:"time"`
+	// IntervalSeconds is the time since the previous sample of the host,
+	// over which the rates are computed.
+	IntervalSeconds float64 `json:"intervalSeconds,omitempty"`
+	// Error is set, and every other section omitted, if the host couldn't
+	// be sampled.
+	Error string `json:"error,omitempty"`
+
+	StorageEngine string `json:"storageEngine,omitempty"`
+	// ReplSet and ReplState are the replica set name and the member state,
+	// using the same abbreviations as the "repl" column, e.g. "PRI".
+	ReplSet   string `json:"replSet,omitempty"`
+	ReplState string `json:"replState,omitempty"`
+
+	// Ops and ReplOps are the operations per second received by the server
+	// and applied by replication.
+	Ops     *SampleOps `json:"ops,omitempty"`
+	ReplOps *SampleOps `json:"replOps,omitempty"`
+	// Queued and Active are the clients waiting for and holding locks or
+	// storage engine tickets.
+	Queued *SampleReadWrite `json:"queued,omitempty"`
+	Active *SampleReadWrite `json:"active,omitempty"`
+	// Flushes is the number of checkpoints or background flushes during the
+	// interval.
+	Flushes     *int64             `json:"flushes,omitempty"`
+	Cache       *SampleCache       `json:"cache,omitempty"`
+	Memory      *SampleMemory      `json:"memory,omitempty"`
+	Network     *SampleNetwork     `json:"network,omitempty"`
+	Connections *SampleConnections `json:"connections,omitempty"`
+}
+
+// SampleOps holds operations per second by type.
+type SampleOps struct {
+	Insert  float64 `json:"insert"`
+	Query   float64 `json:"query"`
+	Update  float64 `json:"update"`
+	Delete  float64 `json:"delete"`
+	GetMore float64 `json:"getmore"`
+	Command float64 `json:"command"`
+}
+
+// SampleReadWrite holds a pair of client counts.
+type SampleReadWrite struct {
+	Read  int64 `json:"read"`
+	Write int64 `json:"write"`
+}
+
+// SampleCache holds the WiredTiger cache usage, as percentages of its
+// configured size.
+type SampleCache struct {
+	DirtyPercent float64 `json:"dirtyPercent"`
+	UsedPercent  float64 `json:"usedPercent"`
+}
+
+// SampleMemory holds the memory used by the server process.
+type SampleMemory struct {
+	ResidentBytes int64 `json:"residentBytes"`
+	VirtualBytes  int64 `json:"virtualBytes"`
+}
+
+// SampleNetwork holds the network traffic rates.
+type SampleNetwork struct {
+	BytesInPerSecond  float64 `json:"bytesInPerSecond"`
+	BytesOutPerSecond float64 `json:"bytesOutPerSecond"`
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+}
+
+// SampleConnections holds the incoming connection counts.
+type SampleConnections struct {
+	Current   int64 `json:"current"`
+	Available int64 `json:"available"`
+}
+
+// NewSample builds the Sample for the interval between two statuses of the
+// same host.
+func NewSample(newStat, oldStat *ServerStatus) *Sample {
+	sampleSecs := newStat.SampleTime.Sub(oldStat.SampleTime).Seconds()
+	rate := func(newVal, oldVal int64) float64 {
+		if sampleSecs <= 0 {
+			return 0
+		}
+		return float64(newVal-oldVal) / sampleSecs
+	}
+
+	sample := &Sample{
+		Version:         SampleSchemaVersion,
+		Host:            newStat.Host,
+		Time:            newStat.SampleTime,
+		IntervalSeconds: sampleSecs,
+		StorageEngine:   getStorageEngine(newStat),
+		ReplState:       ReadRepl(nil, newStat, oldStat),
+	}
+	if newStat.Repl != nil {
+		sample.ReplSet = newStat.Repl.SetName
+	}
+
+	ops := func(newOps, oldOps *OpcountStats) *SampleOps {
+		if newOps == nil || oldOps == nil {
+			return nil
+		}
+		return &SampleOps{
+			Insert:  rate(newOps.Insert, oldOps.Insert),
+			Query:   rate(newOps.Query, oldOps.Query),
+			Update:  rate(newOps.Update, oldOps.Update),
+			Delete:  rate(newOps.Delete, oldOps.Delete),
+			GetMore: rate(newOps.GetMore, oldOps.GetMore),
+			Command: rate(newOps.Command, oldOps.Command),
+		}
+	}
+	sample.Ops = ops(newStat.Opcounters, oldStat.Opcounters)
+	sample.ReplOps = ops(newStat.OpcountersRepl, oldStat.OpcountersRepl)
+
+	if gl := newStat.GlobalLock; gl != nil {
+		if gl.CurrentQueue != nil {
+			qr, qw := queuedReadWrite(newStat)
+			sample.Queued = &SampleReadWrite{Read: qr, Write: qw}
+		}
+		ar, aw := activeReadWrite(newStat)
+		sample.Active = &SampleReadWrite{Read: ar, Write: aw}
+	}
+
+	if newStat.WiredTiger != nil && oldStat.WiredTiger != nil {
+		flushes := newStat.WiredTiger.Transaction.TransCheckpoints - oldStat.WiredTiger.Transaction.TransCheckpoints
+		sample.Flushes = &flushes
+	} else if newStat.BackgroundFlushing != nil && oldStat.BackgroundFlushing != nil {
+		flushes := newStat.BackgroundFlushing.Flushes - oldStat.BackgroundFlushing.Flushes
+		sample.Flushes = &flushes
+	}
+
+	if wt := newStat.WiredTiger; wt != nil && wt.Cache.MaxBytesConfigured != 0 {
+		max := float64(wt.Cache.MaxBytesConfigured)
+		sample.Cache = &SampleCache{
+			DirtyPercent: 100 * float64(wt.Cache.TrackedDirtyBytes) / max,
+			UsedPercent:  100 * float64(wt.Cache.CurrentCachedBytes) / max,
+		}
+	}
+
+	if mem := newStat.Mem; mem != nil && util.IsTruthy(mem.Supported) {
+		sample.Memory = &SampleMemory{
+			ResidentBytes: mem.Resident * 1024 * 1024,
+			VirtualBytes:  mem.Virtual * 1024 * 1024,
+		}
+	}
+
+	if newStat.Network != nil && oldStat.Network != nil {
+		sample.Network = &SampleNetwork{
+			BytesInPerSecond:  rate(newStat.Network.BytesIn, oldStat.Network.BytesIn),
+			BytesOutPerSecond: rate(newStat.Network.BytesOut, oldStat.Network.BytesOut),
+			RequestsPerSecond: rate(newStat.Network.NumRequests, oldStat.Network.NumRequests),
+		}
+	}
+
+	if conn := newStat.Connections; conn != nil {
+		sample.Connections = &SampleConnections{Current: conn.Current, Available: conn.Available}
+	}
+	return sample
+}
+
+// NewErrorSample builds the Sample reporting that a host couldn't be sampled.
+func NewErrorSample(host string, sampleTime time.Time, err error) *Sample {
+	return &Sample{
+		Version: SampleSchemaVersion,
+		Host:    host,
+		Time:    sampleTime,
+		Error:   err.Error(),
+	}
+}
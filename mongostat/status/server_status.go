@@ -27,14 +27,21 @@ type ServerStatus struct {
 	GlobalLock         *GlobalLockStats       `bson:"globalLock"`
 	Locks              map[string]LockStats   `bson:"locks,omitempty"`
 	Network            *NetworkStats          `bson:"network"`
+	OpLatencies        *OpLatenciesStats      `bson:"opLatencies"`
 	Opcounters         *OpcountStats          `bson:"opcounters"`
 	OpcountersRepl     *OpcountStats          `bson:"opcountersRepl"`
 	RecordStats        *DBRecordStats         `bson:"recordStats"`
 	Mem                *MemStats              `bson:"mem"`
 	Repl               *ReplStatus            `bson:"repl"`
+	Sharding           *ShardingStats         `bson:"sharding"`
 	ShardCursorType    map[string]interface{} `bson:"shardCursorType"`
 	StorageEngine      map[string]string      `bson:"storageEngine"`
 	WiredTiger         *WiredTiger            `bson:"wiredTiger"`
+
+	// Databases holds per-database counters, when they were requested.
+	Databases []*DatabaseStats `bson:"-"`
+	// Database is set on the statuses returned by SplitDatabases.
+	Database *DatabaseStats `bson:"database,omitempty"`
 }
 
 // WiredTiger stores information related to the WiredTiger storage engine.
@@ -42,6 +49,7 @@ type WiredTiger struct {
 	Transaction TransactionStats       `bson:"transaction"`
 	Concurrent  ConcurrentTransactions `bson:"concurrentTransactions"`
 	Cache       CacheStats             `bson:"cache"`
+	Log         WTLogStats             `bson:"log"`
 }
 
 type ConcurrentTransactions struct {
@@ -50,7 +58,8 @@ type ConcurrentTransactions struct {
 }
 
 type ConcurrentTransStats struct {
-	Out int64 `bson:"out"`
+	Out       int64 `bson:"out"`
+	Available int64 `bson:"available"`
 }
 
 // CacheStats stores cache statistics for WiredTiger.
@@ -58,11 +67,20 @@ type CacheStats struct {
 	TrackedDirtyBytes  int64 `bson:"tracked dirty bytes in the cache"`
 	CurrentCachedBytes int64 `bson:"bytes currently in the cache"`
 	MaxBytesConfigured int64 `bson:"maximum bytes configured"`
+	UnmodifiedEvicted  int64 `bson:"unmodified pages evicted"`
+	ModifiedEvicted    int64 `bson:"modified pages evicted"`
+	AppThreadEvicted   int64 `bson:"pages evicted by application threads"`
 }
 
 // TransactionStats stores transaction checkpoints in WiredTiger.
 type TransactionStats struct {
-	TransCheckpoints int64 `bson:"transaction checkpoints"`
+	TransCheckpoints     int64 `bson:"transaction checkpoints"`
+	LastCheckpointMillis int64 `bson:"transaction checkpoint most recent time (msecs)"`
+}
+
+// WTLogStats stores journal statistics for WiredTiger.
+type WTLogStats struct {
+	BytesWritten int64 `bson:"log bytes written"`
 }
 
 // ReplStatus stores data related to replica sets.
@@ -75,6 +93,18 @@ type ReplStatus struct {
 	Hosts        []string    `bson:"hosts"`
 	Passives     []string    `bson:"passives"`
 	Me           string      `bson:"me"`
+	LastWrite    *LastWrite  `bson:"lastWrite"`
+}
+
+// LastWrite stores the time of the most recent write applied by a replica
+// set member.
+type LastWrite struct {
+	LastWriteDate time.Time `bson:"lastWriteDate"`
+}
+
+// ShardingStats stores information about the sharded cluster a node belongs to.
+type ShardingStats struct {
+	ConfigsvrConnectionString string `bson:"configsvrConnectionString"`
 }
 
 // DBRecordStats stores data related to memory operations across databases.
@@ -158,6 +188,29 @@ type GlobalLockStats struct {
 	ActiveClients *ClientStats `bson:"activeClients"`
 }
 
+// OpLatenciesStats stores the cumulative latency of each kind of operation,
+// reported by MongoDB 3.2 and newer.
+type OpLatenciesStats struct {
+	Reads    *OpLatencyStats `bson:"reads"`
+	Writes   *OpLatencyStats `bson:"writes"`
+	Commands *OpLatencyStats `bson:"commands"`
+}
+
+// OpLatencyStats stores the total latency and count of one kind of operation.
+// The histogram is only reported when serverStatus is asked for it.
+type OpLatencyStats struct {
+	Latency   int64           `bson:"latency"`
+	Ops       int64           `bson:"ops"`
+	Histogram []LatencyBucket `bson:"histogram"`
+}
+
+// LatencyBucket counts the operations that took at least Micros, and less
+// than the Micros of the next bucket.
+type LatencyBucket struct {
+	Micros int64 `bson:"micros"`
+	Count  int64 `bson:"count"`
+}
+
 // NetworkStats stores information related to network traffic.
 type NetworkStats struct {
 	BytesIn     int64 `bson:"bytesIn"`
@@ -0,0 +1,101 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package status
+
+import (
+	"github.com/mongodb/mongo-tools/common/util"
+)
+
+// SumStatuses returns a ServerStatus whose counters are the totals of the
+// given statuses, such as those of every shard of a cluster, and whose
+// sample time is the latest of theirs. Fields that can't be meaningfully
+// added up, such as replication state, are left unset.
+func SumStatuses(host string, stats []*ServerStatus) *ServerStatus {
+	// the table's readers expect these sections to be present
+	total := &ServerStatus{
+		Host:        host,
+		Network:     &NetworkStats{},
+		Connections: &ConnectionStats{},
+		Mem:         &MemStats{},
+	}
+	addOps := func(total **OpcountStats, ops *OpcountStats) {
+		if ops == nil {
+			return
+		}
+		if *total == nil {
+			*total = &OpcountStats{}
+		}
+		(*total).Insert += ops.Insert
+		(*total).Query += ops.Query
+		(*total).Update += ops.Update
+		(*total).Delete += ops.Delete
+		(*total).GetMore += ops.GetMore
+		(*total).Command += ops.Command
+	}
+
+	for _, stat := range stats {
+		if stat.SampleTime.After(total.SampleTime) {
+			total.SampleTime = stat.SampleTime
+		}
+		if total.StorageEngine == nil {
+			total.StorageEngine = stat.StorageEngine
+		}
+		addOps(&total.Opcounters, stat.Opcounters)
+		addOps(&total.OpcountersRepl, stat.OpcountersRepl)
+
+		if net := stat.Network; net != nil {
+			total.Network.BytesIn += net.BytesIn
+			total.Network.BytesOut += net.BytesOut
+			total.Network.NumRequests += net.NumRequests
+		}
+		if conn := stat.Connections; conn != nil {
+			total.Connections.Current += conn.Current
+			total.Connections.Available += conn.Available
+			total.Connections.TotalCreated += conn.TotalCreated
+		}
+		if mem := stat.Mem; mem != nil && util.IsTruthy(mem.Supported) {
+			total.Mem.Supported = true
+			total.Mem.Resident += mem.Resident
+			total.Mem.Virtual += mem.Virtual
+			total.Mem.Mapped += mem.Mapped
+		}
+		if gl := stat.GlobalLock; gl != nil {
+			if total.GlobalLock == nil {
+				total.GlobalLock = &GlobalLockStats{CurrentQueue: &QueueStats{}, ActiveClients: &ClientStats{}}
+			}
+			if gl.CurrentQueue != nil {
+				total.GlobalLock.CurrentQueue.Readers += gl.CurrentQueue.Readers
+				total.GlobalLock.CurrentQueue.Writers += gl.CurrentQueue.Writers
+				total.GlobalLock.CurrentQueue.Total += gl.CurrentQueue.Total
+			}
+			if gl.ActiveClients != nil {
+				total.GlobalLock.ActiveClients.Readers += gl.ActiveClients.Readers
+				total.GlobalLock.ActiveClients.Writers += gl.ActiveClients.Writers
+				total.GlobalLock.ActiveClients.Total += gl.ActiveClients.Total
+			}
+		}
+		if wt := stat.WiredTiger; wt != nil {
+			if total.WiredTiger == nil {
+				total.WiredTiger = &WiredTiger{}
+			}
+			twt := total.WiredTiger
+			twt.Cache.TrackedDirtyBytes += wt.Cache.TrackedDirtyBytes
+			twt.Cache.CurrentCachedBytes += wt.Cache.CurrentCachedBytes
+			twt.Cache.MaxBytesConfigured += wt.Cache.MaxBytesConfigured
+			twt.Cache.UnmodifiedEvicted += wt.Cache.UnmodifiedEvicted
+			twt.Cache.ModifiedEvicted += wt.Cache.ModifiedEvicted
+			twt.Cache.AppThreadEvicted += wt.Cache.AppThreadEvicted
+			twt.Concurrent.Read.Out += wt.Concurrent.Read.Out
+			twt.Concurrent.Read.Available += wt.Concurrent.Read.Available
+			twt.Concurrent.Write.Out += wt.Concurrent.Write.Out
+			twt.Concurrent.Write.Available += wt.Concurrent.Write.Available
+			twt.Transaction.TransCheckpoints += wt.Transaction.TransCheckpoints
+			twt.Log.BytesWritten += wt.Log.BytesWritten
+		}
+	}
+	return total
+}
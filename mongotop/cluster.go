@@ -0,0 +1,212 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"fmt"
+	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/util"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+	"net"
+	"sync"
+	"time"
+)
+
+// isMasterResult holds the fields of isMaster used to discover hosts.
+type isMasterResult struct {
+	Msg      string   `bson:"msg"`
+	Hosts    []string `bson:"hosts"`
+	Passives []string `bson:"passives"`
+	Me       string   `bson:"me"`
+}
+
+// configShard holds a shard as it appears in the config.shards collection.
+type configShard struct {
+	Id   string `bson:"_id"`
+	Host string `bson:"host"`
+}
+
+// DiscoverHosts returns every member of the replica set mongotop is
+// connected to or, when connected to a mongos, every member of every shard.
+// A standalone server is returned on its own.
+func (mt *MongoTop) DiscoverHosts() ([]string, error) {
+	session, err := mt.SessionProvider.GetSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	result := isMasterResult{}
+	if err = session.DB("admin").Run("isMaster", &result); err != nil {
+		return nil, fmt.Errorf("error running isMaster: %v", err)
+	}
+	if result.Msg == "isdbgrid" {
+		var hosts []string
+		shard := configShard{}
+		iter := session.DB("config").C("shards").Find(bson.M{}).Iter()
+		for iter.Next(&shard) {
+			shardHosts, _ := util.ParseConnectionString(shard.Host)
+			hosts = append(hosts, shardHosts...)
+		}
+		if err = iter.Close(); err != nil {
+			return nil, fmt.Errorf("error reading config.shards: %v", err)
+		}
+		return hosts, nil
+	}
+	hosts := append(result.Hosts, result.Passives...)
+	if len(hosts) == 0 && result.Me != "" {
+		hosts = []string{result.Me}
+	}
+	if len(hosts) == 0 {
+		hosts = []string{mt.connURL()}
+	}
+	return hosts, nil
+}
+
+// AddMember adds a host to be sampled alongside the others. Once any member
+// is added, mongotop reports on the members instead of its own connection.
+func (mt *MongoTop) AddMember(host string) error {
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = host, ""
+	}
+	optsCopy := mt.Options.DirectTo(hostname, port)
+	sessionProvider, err := db.NewSessionProvider(optsCopy)
+	if err != nil {
+		return fmt.Errorf("error connecting to %v: %v", host, err)
+	}
+	sessionProvider.SetReadPreference(mgo.PrimaryPreferred)
+
+	log.Logvf(log.DebugLow, "adding %v to the hosts sampled", host)
+	mt.members = append(mt.members, &MongoTop{
+		Options:         &optsCopy,
+		OutputOptions:   mt.OutputOptions,
+		SessionProvider: sessionProvider,
+		Sleeptime:       mt.Sleeptime,
+		View:            View{Filter: mt.View.Filter},
+		Exporter:        mt.Exporter,
+		host:            host,
+	})
+	return nil
+}
+
+// runClusterDiff samples every member at once and merges their diffs, either
+// under "host/namespace" or, with --aggregate, summed by namespace.
+func (mt *MongoTop) runClusterDiff() (FormattableDiff, error) {
+	diffs := make([]FormattableDiff, len(mt.members))
+	errs := make([]error, len(mt.members))
+	wg := sync.WaitGroup{}
+	for i, member := range mt.members {
+		wg.Add(1)
+		go func(i int, member *MongoTop) {
+			defer wg.Done()
+			diffs[i], errs[i] = member.runDiff()
+		}(i, member)
+	}
+	wg.Wait()
+
+	var firstErr error
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			log.Logvf(log.Always, "error sampling %v: %v", mt.members[i].host, err)
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if failed == len(mt.members) {
+		return nil, firstErr
+	}
+
+	prefix := func(host, ns string) string {
+		if mt.OutputOptions.Aggregate {
+			return ns
+		}
+		return host + "/" + ns
+	}
+	// members only produce a diff once they have two samples
+	sampled := false
+	view := View{SortBy: mt.View.SortBy, Limit: mt.View.Limit}
+	if mt.OutputOptions.Locks {
+		out := ServerStatusDiff{Totals: map[string]LockDelta{}, micros: map[string]LockDelta{}}
+		for i, diff := range diffs {
+			ssd, ok := diff.(ServerStatusDiff)
+			if !ok {
+				continue
+			}
+			for ns, totals := range ssd.Totals {
+				key := prefix(mt.members[i].host, ns)
+				out.Totals[key] = addLockDeltas(out.Totals[key], totals)
+				out.micros[key] = addLockDeltas(out.micros[key], ssd.micros[ns])
+			}
+			out.Time, out.TimeFormat = laterTime(out.Time, ssd.Time), ssd.TimeFormat
+			sampled = true
+		}
+		if !sampled {
+			return nil, nil
+		}
+		out.Apply(view)
+		return out, nil
+	}
+
+	out := TopDiff{
+		Totals:    map[string]NSTopInfo{},
+		Breakdown: mt.OutputOptions.Breakdown,
+		micros:    map[string]NSTopInfo{},
+	}
+	for i, diff := range diffs {
+		td, ok := diff.(TopDiff)
+		if !ok {
+			continue
+		}
+		for ns, totals := range td.Totals {
+			key := prefix(mt.members[i].host, ns)
+			out.Totals[key] = addTopInfos(out.Totals[key], totals)
+			out.micros[key] = addTopInfos(out.micros[key], td.micros[ns])
+		}
+		out.Time, out.TimeFormat = laterTime(out.Time, td.Time), td.TimeFormat
+		sampled = true
+	}
+	if !sampled {
+		return nil, nil
+	}
+	out.Apply(view)
+	return out, nil
+}
+
+func addLockDeltas(a, b LockDelta) LockDelta {
+	return LockDelta{Read: a.Read + b.Read, Write: a.Write + b.Write}
+}
+
+func addTopFields(a, b TopField) TopField {
+	return TopField{Time: a.Time + b.Time, Count: a.Count + b.Count}
+}
+
+func addTopInfos(a, b NSTopInfo) NSTopInfo {
+	return NSTopInfo{
+		Total:    addTopFields(a.Total, b.Total),
+		Read:     addTopFields(a.Read, b.Read),
+		Write:    addTopFields(a.Write, b.Write),
+		Queries:  addTopFields(a.Queries, b.Queries),
+		GetMore:  addTopFields(a.GetMore, b.GetMore),
+		Insert:   addTopFields(a.Insert, b.Insert),
+		Update:   addTopFields(a.Update, b.Update),
+		Remove:   addTopFields(a.Remove, b.Remove),
+		Commands: addTopFields(a.Commands, b.Commands),
+	}
+}
+
+func laterTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -11,7 +11,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/text"
+	"regexp"
 	"sort"
+	"strconv"
 	"time"
 )
 
@@ -22,6 +24,124 @@ type FormattableDiff interface {
 	JSON() string
 	// Generate a table-like representation which can be printed to a terminal
 	Grid() string
+	// Generate one Record per namespace, busiest first
+	Records() []Record
+}
+
+// View selects which namespaces of a diff are reported, and in what order.
+type View struct {
+	// Filter, if set, keeps only namespaces that it matches.
+	Filter *regexp.Regexp
+	// SortBy is "total", "read", "write" or one of OperationCategories;
+	// the default is "total".
+	SortBy string
+	// Limit keeps only the busiest namespaces; 0 keeps them all.
+	Limit int
+}
+
+// defaultGridRows is the number of rows of the table when no limit is set.
+const defaultGridRows = 10
+
+// rank applies the filter and limit of the View to a map from namespace
+// to busyness, and returns the selected namespaces busiest first.
+func (v View) rank(values map[string]int64) []string {
+	totals := make(sortableTotals, 0, len(values))
+	for ns, value := range values {
+		if v.Filter != nil && !v.Filter.MatchString(ns) {
+			continue
+		}
+		totals = append(totals, sortableTotal{ns, value})
+	}
+	sort.Sort(sort.Reverse(totals))
+	if v.Limit > 0 && len(totals) > v.Limit {
+		totals = totals[:v.Limit]
+	}
+	names := make([]string, len(totals))
+	for i, st := range totals {
+		names[i] = st.Name
+	}
+	return names
+}
+
+// pick returns the read, write or total value named by SortBy.
+func (v View) pick(total, read, write int64) int64 {
+	switch v.SortBy {
+	case "read":
+		return read
+	case "write":
+		return write
+	}
+	return total
+}
+
+// pickTop returns the time of the field of info named by SortBy.
+func (v View) pickTop(info NSTopInfo) int64 {
+	if field, ok := info.Operation(v.SortBy); ok {
+		return int64(field.Time)
+	}
+	return v.pick(int64(info.Total.Time), int64(info.Read.Time), int64(info.Write.Time))
+}
+
+// Record is the usage of a single namespace over one interval, as written
+// by --format. Unlike the table, times are in microseconds.
+type Record struct {
+	Time        time.Time `json:"time"`
+	Namespace   string    `json:"ns"`
+	TotalMicros int64     `json:"totalMicros"`
+	ReadMicros  int64     `json:"readMicros"`
+	WriteMicros int64     `json:"writeMicros"`
+	// Counts are only reported by the top command, not with --locks.
+	TotalCount int64 `json:"totalCount"`
+	ReadCount  int64 `json:"readCount"`
+	WriteCount int64 `json:"writeCount"`
+	// Operations holds the usage of each of OperationCategories, with --breakdown.
+	Operations map[string]OperationUsage `json:"operations,omitempty"`
+}
+
+// OperationUsage is the time and count of one category of operation.
+type OperationUsage struct {
+	Micros int64 `json:"micros"`
+	Count  int64 `json:"count"`
+}
+
+// OperationCategories are the kinds of operation the top command reports
+// on besides read and write locks, in the order of the --breakdown columns.
+var OperationCategories = []string{"queries", "getmore", "insert", "update", "remove", "commands"}
+
+// RecordHeader is the header row of --format csv.
+var RecordHeader = []string{"time", "ns", "total_micros", "read_micros", "write_micros",
+	"total_count", "read_count", "write_count"}
+
+// BreakdownHeader returns the extra columns of --format csv with --breakdown.
+func BreakdownHeader() []string {
+	header := make([]string, 0, 2*len(OperationCategories))
+	for _, category := range OperationCategories {
+		header = append(header, category+"_micros", category+"_count")
+	}
+	return header
+}
+
+// CSV returns the record as a row of --format csv.
+func (r Record) CSV() []string {
+	row := []string{
+		r.Time.Format(MilliTimeFormat),
+		r.Namespace,
+		strconv.FormatInt(r.TotalMicros, 10),
+		strconv.FormatInt(r.ReadMicros, 10),
+		strconv.FormatInt(r.WriteMicros, 10),
+		strconv.FormatInt(r.TotalCount, 10),
+		strconv.FormatInt(r.ReadCount, 10),
+		strconv.FormatInt(r.WriteCount, 10),
+	}
+	if r.Operations != nil {
+		for _, category := range OperationCategories {
+			usage := r.Operations[category]
+			row = append(row,
+				strconv.FormatInt(usage.Micros, 10),
+				strconv.FormatInt(usage.Count, 10))
+		}
+	}
+	return row
 }
 
 // ServerStatus represents the results of the "serverStatus" command.
@@ -49,6 +169,16 @@ type ServerStatusDiff struct {
 	// namespace -> lock times
 	Totals map[string]LockDelta `json:"totals"`
 	Time   time.Time            `json:"time"`
+
+	// TimeFormat is the format of the sample time in the table header.
+	TimeFormat string `json:"-"`
+
+	// namespace -> lock times in microseconds
+	micros map[string]LockDelta
+
+	// namespaces to report, set by Apply
+	view  View
+	order []string
 }
 
 // LockDelta represents the differences in read/write lock times between two samples.
@@ -62,6 +192,20 @@ type TopDiff struct {
 	// namespace -> totals
 	Totals map[string]NSTopInfo `json:"totals"`
 	Time   time.Time            `json:"time"`
+
+	// TimeFormat is the format of the sample time in the table header.
+	TimeFormat string `json:"-"`
+
+	// Breakdown adds a column for each of OperationCategories to the table
+	// and records.
+	Breakdown bool `json:"-"`
+
+	// namespace -> totals with times in microseconds
+	micros map[string]NSTopInfo
+
+	// namespaces to report, set by Apply
+	view  View
+	order []string
 }
 
 // Top holds raw output of the "top" command.
@@ -74,6 +218,54 @@ type NSTopInfo struct {
 	Total TopField `bson:"total" json:"total"`
 	Read  TopField `bson:"readLock" json:"read"`
 	Write TopField `bson:"writeLock" json:"write"`
+
+	Queries  TopField `bson:"queries" json:"queries"`
+	GetMore  TopField `bson:"getmore" json:"getmore"`
+	Insert   TopField `bson:"insert" json:"insert"`
+	Update   TopField `bson:"update" json:"update"`
+	Remove   TopField `bson:"remove" json:"remove"`
+	Commands TopField `bson:"commands" json:"commands"`
+}
+
+// Operation returns the field of one of OperationCategories.
+func (info NSTopInfo) Operation(category string) (TopField, bool) {
+	switch category {
+	case "queries":
+		return info.Queries, true
+	case "getmore":
+		return info.GetMore, true
+	case "insert":
+		return info.Insert, true
+	case "update":
+		return info.Update, true
+	case "remove":
+		return info.Remove, true
+	case "commands":
+		return info.Commands, true
+	}
+	return TopField{}, false
+}
+
+// diff subtracts the times and counts of an older sample, dividing the
+// times by scale.
+func (info NSTopInfo) diff(previous NSTopInfo, scale int) NSTopInfo {
+	sub := func(cur, prev TopField) TopField {
+		return TopField{
+			Time:  (cur.Time - prev.Time) / scale,
+			Count: cur.Count - prev.Count,
+		}
+	}
+	return NSTopInfo{
+		Total:    sub(info.Total, previous.Total),
+		Read:     sub(info.Read, previous.Read),
+		Write:    sub(info.Write, previous.Write),
+		Queries:  sub(info.Queries, previous.Queries),
+		GetMore:  sub(info.GetMore, previous.GetMore),
+		Insert:   sub(info.Insert, previous.Insert),
+		Update:   sub(info.Update, previous.Update),
+		Remove:   sub(info.Remove, previous.Remove),
+		Commands: sub(info.Commands, previous.Commands),
+	}
 }
 
 // TopField contains the timing and counts for a single lock statistic within the "top" command.
@@ -106,63 +298,120 @@ func (top Top) Diff(previous Top) TopDiff {
 	diff := TopDiff{
 		Totals: map[string]NSTopInfo{},
 		Time:   time.Now(),
+		micros: map[string]NSTopInfo{},
 	}
 
 	// For each namespace we are tracking, subtract the times and counts
-	// for total/read/write and build a new map containing the diffs.
+	// of each field and build a new map containing the diffs.
 	prevTotals := previous.Totals
 	curTotals := top.Totals
 	for ns, prevNSInfo := range prevTotals {
 		if curNSInfo, ok := curTotals[ns]; ok {
-			diff.Totals[ns] = NSTopInfo{
-				Total: TopField{
-					Time:  (curNSInfo.Total.Time - prevNSInfo.Total.Time) / 1000,
-					Count: curNSInfo.Total.Count - prevNSInfo.Total.Count,
-				},
-				Read: TopField{
-					Time:  (curNSInfo.Read.Time - prevNSInfo.Read.Time) / 1000,
-					Count: curNSInfo.Read.Count - prevNSInfo.Read.Count,
-				},
-				Write: TopField{
-					Time:  (curNSInfo.Write.Time - prevNSInfo.Write.Time) / 1000,
-					Count: curNSInfo.Write.Count - prevNSInfo.Write.Count,
-				},
-			}
+			diff.micros[ns] = curNSInfo.diff(prevNSInfo, 1)
+			diff.Totals[ns] = curNSInfo.diff(prevNSInfo, 1000)
 		}
 	}
 	return diff
 }
 
+// DefaultTimeFormat is the format of the sample time in the table header.
+const DefaultTimeFormat = "2006-01-02T15:04:05Z07:00"
+
+// MilliTimeFormat is used instead of DefaultTimeFormat for sub-second
+// intervals.
+const MilliTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+func headerTime(t time.Time, format string) string {
+	if format == "" {
+		format = DefaultTimeFormat
+	}
+	return t.Format(format)
+}
+
+// Apply drops the namespaces not selected by the View, and orders the rest.
+func (td *TopDiff) Apply(v View) {
+	td.view = v
+	td.order = td.namespaces()
+	totals := make(map[string]NSTopInfo, len(td.order))
+	for _, ns := range td.order {
+		totals[ns] = td.Totals[ns]
+	}
+	td.Totals = totals
+}
+
+// namespaces returns the namespaces selected by the View, busiest first.
+func (td TopDiff) namespaces() []string {
+	if td.order != nil {
+		return td.order
+	}
+	values := make(map[string]int64, len(td.micros))
+	for ns, diff := range td.micros {
+		values[ns] = td.view.pickTop(diff)
+	}
+	return td.view.rank(values)
+}
+
 // Grid returns a tabular representation of the TopDiff.
 func (td TopDiff) Grid() string {
-	buf := &bytes.Buffer{}
-	out := &text.GridWriter{ColumnPadding: 4}
-	out.WriteCells("ns", "total", "read", "write", time.Now().Format("2006-01-02T15:04:05Z07:00"))
-	out.EndRow()
-
-	//Sort by total time
-	totals := make(sortableTotals, 0, len(td.Totals))
-	for ns, diff := range td.Totals {
-		totals = append(totals, sortableTotal{ns, int64(diff.Total.Time)})
+	header := []string{"ns", "total", "read", "write"}
+	if td.Breakdown {
+		header = append(header, OperationCategories...)
 	}
+	out := text.NewTable(append(header, headerTime(td.Time, td.TimeFormat))...)
+	out.Padding = 4
 
-	sort.Sort(sort.Reverse(totals))
-	for i, st := range totals {
-		diff := td.Totals[st.Name]
-		out.WriteCells(st.Name,
+	for i, ns := range td.namespaces() {
+		if td.view.Limit == 0 && i >= defaultGridRows {
+			break
+		}
+		diff := td.Totals[ns]
+		row := []string{ns,
 			fmt.Sprintf("%vms", diff.Total.Time),
 			fmt.Sprintf("%vms", diff.Read.Time),
-			fmt.Sprintf("%vms", diff.Write.Time),
-			"")
-		out.EndRow()
-		if i >= 9 {
-			break
+			fmt.Sprintf("%vms", diff.Write.Time)}
+		if td.Breakdown {
+			// time and count, so that a few slow operations stand out from
+			// many fast ones
+			for _, category := range OperationCategories {
+				field, _ := diff.Operation(category)
+				row = append(row, fmt.Sprintf("%vms/%v", field.Time, field.Count))
+			}
 		}
+		out.AddRow(row...)
 	}
-	out.Flush(buf)
+	buf := &bytes.Buffer{}
+	out.WriteText(buf)
 	return buf.String()
 }
 
+// Records returns the usage of every namespace in the TopDiff.
+func (td TopDiff) Records() []Record {
+	namespaces := td.namespaces()
+	records := make([]Record, 0, len(namespaces))
+	for _, ns := range namespaces {
+		diff := td.micros[ns]
+		records = append(records, Record{
+			Time:        td.Time,
+			Namespace:   ns,
+			TotalMicros: int64(diff.Total.Time),
+			ReadMicros:  int64(diff.Read.Time),
+			WriteMicros: int64(diff.Write.Time),
+			TotalCount:  int64(diff.Total.Count),
+			ReadCount:   int64(diff.Read.Count),
+			WriteCount:  int64(diff.Write.Count),
+		})
+		if td.Breakdown {
+			operations := make(map[string]OperationUsage, len(OperationCategories))
+			for _, category := range OperationCategories {
+				field, _ := diff.Operation(category)
+				operations[category] = OperationUsage{Micros: int64(field.Time), Count: int64(field.Count)}
+			}
+			records[len(records)-1].Operations = operations
+		}
+	}
+	return records
+}
+
 // JSON returns a JSON representation of the TopDiff.
 func (td TopDiff) JSON() string {
 	bytes, err := json.Marshal(td)
@@ -172,6 +421,23 @@ func (td TopDiff) JSON() string {
 	return string(bytes)
 }
 
+// Records returns the lock usage of every database in the ServerStatusDiff.
+func (ssd ServerStatusDiff) Records() []Record {
+	namespaces := ssd.namespaces()
+	records := make([]Record, 0, len(namespaces))
+	for _, ns := range namespaces {
+		diff := ssd.micros[ns]
+		records = append(records, Record{
+			Time:        ssd.Time,
+			Namespace:   ns,
+			TotalMicros: diff.Read + diff.Write,
+			ReadMicros:  diff.Read,
+			WriteMicros: diff.Write,
+		})
+	}
+	return records
+}
+
 // JSON returns a JSON representation of the ServerStatusDiff.
 func (ssd ServerStatusDiff) JSON() string {
 	bytes, err := json.Marshal(ssd)
@@ -181,34 +447,47 @@ func (ssd ServerStatusDiff) JSON() string {
 	return string(bytes)
 }
 
-// Grid returns a tabular representation of the ServerStatusDiff.
-func (ssd ServerStatusDiff) Grid() string {
-	buf := &bytes.Buffer{}
-	out := &text.GridWriter{ColumnPadding: 4}
-	out.WriteCells("db", "total", "read", "write", time.Now().Format("2006-01-02T15:04:05Z07:00"))
-	out.EndRow()
+// Apply drops the databases not selected by the View, and orders the rest.
+func (ssd *ServerStatusDiff) Apply(v View) {
+	ssd.view = v
+	ssd.order = ssd.namespaces()
+	totals := make(map[string]LockDelta, len(ssd.order))
+	for _, ns := range ssd.order {
+		totals[ns] = ssd.Totals[ns]
+	}
+	ssd.Totals = totals
+}
 
-	//Sort by total time
-	totals := make(sortableTotals, 0, len(ssd.Totals))
-	for ns, diff := range ssd.Totals {
-		totals = append(totals, sortableTotal{ns, diff.Read + diff.Write})
+// namespaces returns the databases selected by the View, busiest first.
+func (ssd ServerStatusDiff) namespaces() []string {
+	if ssd.order != nil {
+		return ssd.order
+	}
+	values := make(map[string]int64, len(ssd.micros))
+	for ns, diff := range ssd.micros {
+		values[ns] = ssd.view.pick(diff.Read+diff.Write, diff.Read, diff.Write)
 	}
+	return ssd.view.rank(values)
+}
 
-	sort.Sort(sort.Reverse(totals))
-	for i, st := range totals {
-		diff := ssd.Totals[st.Name]
-		out.WriteCells(st.Name,
-			fmt.Sprintf("%vms", diff.Read+diff.Write),
-			fmt.Sprintf("%vms", diff.Read),
-			fmt.Sprintf("%vms", diff.Write),
-			"")
-		out.EndRow()
-		if i >= 9 {
+// Grid returns a tabular representation of the ServerStatusDiff.
+func (ssd ServerStatusDiff) Grid() string {
+	out := text.NewTable("db", "total", "read", "write", headerTime(ssd.Time, ssd.TimeFormat))
+	out.Padding = 4
+
+	for i, ns := range ssd.namespaces() {
+		if ssd.view.Limit == 0 && i >= defaultGridRows {
 			break
 		}
+		diff := ssd.Totals[ns]
+		out.AddRow(ns,
+			fmt.Sprintf("%vms", diff.Read+diff.Write),
+			fmt.Sprintf("%vms", diff.Read),
+			fmt.Sprintf("%vms", diff.Write))
 	}
 
-	out.Flush(buf)
+	buf := &bytes.Buffer{}
+	out.WriteText(buf)
 	return buf.String()
 }
 
@@ -219,6 +498,7 @@ func (ss ServerStatus) Diff(previous ServerStatus) ServerStatusDiff {
 	diff := ServerStatusDiff{
 		Totals: map[string]LockDelta{},
 		Time:   time.Now(),
+		micros: map[string]LockDelta{},
 	}
 
 	prevLocks := previous.Locks
@@ -228,11 +508,16 @@ func (ss ServerStatus) Diff(previous ServerStatus) ServerStatusDiff {
 			prevTimeLocked := prevNSInfo.TimeLockedMicros
 			curTimeLocked := curNSInfo.TimeLockedMicros
 
+			micros := LockDelta{
+				Read: curTimeLocked.Read + curTimeLocked.ReadLower -
+					(prevTimeLocked.Read + prevTimeLocked.ReadLower),
+				Write: curTimeLocked.Write + curTimeLocked.WriteLower -
+					(prevTimeLocked.Write + prevTimeLocked.WriteLower),
+			}
+			diff.micros[ns] = micros
 			diff.Totals[ns] = LockDelta{
-				Read: (curTimeLocked.Read + curTimeLocked.ReadLower -
-					(prevTimeLocked.Read + prevTimeLocked.ReadLower)) / 1000,
-				Write: (curTimeLocked.Write + curTimeLocked.WriteLower -
-					(prevTimeLocked.Write + prevTimeLocked.WriteLower)) / 1000,
+				Read:  micros.Read / 1000,
+				Write: micros.Write / 1000,
 			}
 		}
 	}
@@ -9,6 +9,8 @@ package main
 
 import (
 	"github.com/mongodb/mongo-tools/common/db"
+	"github.com/mongodb/mongo-tools/common/diagnose"
+	"github.com/mongodb/mongo-tools/common/failure"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
 	"github.com/mongodb/mongo-tools/common/signals"
@@ -16,7 +18,7 @@ import (
 	"github.com/mongodb/mongo-tools/mongotop"
 	"gopkg.in/mgo.v2"
 	"os"
-	"strconv"
+	"regexp"
 	"time"
 )
 
@@ -48,44 +50,102 @@ func main() {
 	}
 
 	log.SetVerbosity(opts.Verbosity)
+	log.SetFormat(opts.LogFormat, opts.AppName)
 	signals.Handle()
 
 	// verify uri options and log them
 	opts.URI.LogUnsupportedOptions()
 
+	// test connecting to the server step by step, if specified
+	if opts.Diagnose {
+		os.Exit(diagnose.Run(opts, os.Stdout))
+	}
+
 	if len(args) > 1 {
 		log.Logvf(log.Always, "too many positional arguments")
 		log.Logvf(log.Always, "try 'mongotop --help' for more information")
 		os.Exit(util.ExitBadOptions)
 	}
 
-	sleeptime := 1 // default to 1 second sleep time
+	sleeptime := time.Second // default to 1 second sleep time
 	if len(args) > 0 {
-		sleeptime, err = strconv.Atoi(args[0])
-		if err != nil || sleeptime <= 0 {
-			log.Logvf(log.Always, "invalid sleep time: %v", args[0])
+		sleeptime, err = util.ParseInterval(args[0])
+		if err != nil {
+			log.Logvf(log.Always, "invalid sleep time: %v", err)
 			os.Exit(util.ExitBadOptions)
 		}
 	}
+	if err := opts.RejectProgressEvents(); err != nil {
+		log.Logvf(log.Always, "%v", err)
+		os.Exit(util.ExitBadOptions)
+	}
 	if outputOpts.RowCount < 0 {
 		log.Logvf(log.Always, "invalid value for --rowcount: %v", outputOpts.RowCount)
 		os.Exit(util.ExitBadOptions)
 	}
 
-	if opts.Auth.Username != "" && opts.Auth.Source == "" && !opts.Auth.RequiresExternalDB() {
-		if opts.URI != nil && opts.URI.ConnectionString != "" {
-			log.Logvf(log.Always, "authSource is required when authenticating against a non $external database")
+	if outputOpts.CSV && outputOpts.Format != "" && outputOpts.Format != "csv" {
+		log.Logvf(log.Always, "cannot use --csv with --format %v", outputOpts.Format)
+		os.Exit(util.ExitBadOptions)
+	}
+	if outputOpts.Json && outputOpts.RecordFormat() != "" {
+		log.Logvf(log.Always, "cannot use --json with --format or --csv")
+		os.Exit(util.ExitBadOptions)
+	}
+
+	if outputOpts.Prometheus != "" && (outputOpts.Json || outputOpts.RecordFormat() != "") {
+		log.Logvf(log.Always, "cannot use --prometheus with --json, --format or --csv")
+		os.Exit(util.ExitBadOptions)
+	}
+	if outputOpts.Aggregate && !outputOpts.Discover {
+		log.Logvf(log.Always, "cannot use --aggregate without --discover")
+		os.Exit(util.ExitBadOptions)
+	}
+	if outputOpts.Locks {
+		if outputOpts.Breakdown {
+			log.Logvf(log.Always, "cannot use --breakdown with --locks")
+			os.Exit(util.ExitBadOptions)
+		}
+		if _, ok := (mongotop.NSTopInfo{}).Operation(outputOpts.SortBy); ok {
+			log.Logvf(log.Always, "cannot use --sortBy %v with --locks", outputOpts.SortBy)
 			os.Exit(util.ExitBadOptions)
 		}
-		log.Logvf(log.Always, "--authenticationDatabase is required when authenticating against a non $external database")
+	}
+	var watchRules []mongotop.WatchRule
+	if outputOpts.Watch != "" {
+		watchRules, err = mongotop.ParseWatchRules(outputOpts.Watch)
+		if err != nil {
+			log.Logvf(log.Always, "%v", err)
+			os.Exit(util.ExitBadOptions)
+		}
+		for _, rule := range watchRules {
+			if rule.UsesBreakdown() && (outputOpts.Locks || !outputOpts.Breakdown) {
+				log.Logvf(log.Always, "watch rule '%v' can only be used with --breakdown", rule.Text)
+				os.Exit(util.ExitBadOptions)
+			}
+		}
+	} else if outputOpts.WatchWebhook != "" || outputOpts.WatchExit {
+		log.Logvf(log.Always, "--watchWebhook and --watchExit can only be used when --watch is also specified")
 		os.Exit(util.ExitBadOptions)
 	}
+	if outputOpts.Top < 0 {
+		log.Logvf(log.Always, "invalid value for --top: %v", outputOpts.Top)
+		os.Exit(util.ExitBadOptions)
+	}
+	view := mongotop.View{SortBy: outputOpts.SortBy, Limit: outputOpts.Top}
+	if outputOpts.NSFilter != "" {
+		view.Filter, err = regexp.Compile(outputOpts.NSFilter)
+		if err != nil {
+			log.Logvf(log.Always, "invalid value for --nsFilter: %v", err)
+			os.Exit(util.ExitBadOptions)
+		}
+	}
 
 	// create a session provider to connect to the db
 	sessionProvider, err := db.NewSessionProvider(*opts)
 	if err != nil {
 		log.Logvf(log.Always, "error connecting to host: %v", err)
-		os.Exit(util.ExitError)
+		os.Exit(failure.ExitCode(err))
 	}
 
 	if opts.ReplicaSetName == "" {
@@ -96,10 +156,10 @@ func main() {
 	isMongos, err := sessionProvider.IsMongos()
 	if err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
-		os.Exit(util.ExitError)
+		os.Exit(failure.ExitCode(err))
 	}
-	if isMongos {
-		log.Logvf(log.Always, "cannot run mongotop against a mongos")
+	if isMongos && !outputOpts.Discover {
+		log.Logvf(log.Always, "cannot run mongotop against a mongos without --discover")
 		os.Exit(util.ExitError)
 	}
 
@@ -108,12 +168,51 @@ func main() {
 		Options:         opts,
 		OutputOptions:   outputOpts,
 		SessionProvider: sessionProvider,
-		Sleeptime:       time.Duration(sleeptime) * time.Second,
+		Sleeptime:       sleeptime,
+		View:            view,
+	}
+	if len(watchRules) > 0 {
+		top.Watcher = mongotop.NewWatcher(watchRules, os.Stderr)
+		top.Watcher.Webhook = outputOpts.WatchWebhook
+		top.Watcher.ExitOnAlert = outputOpts.WatchExit
+	}
+	if outputOpts.Prometheus != "" {
+		top.Exporter = mongotop.NewPrometheusExporter(outputOpts.Prometheus)
+		top.Exporter.Filter = view.Filter
+	}
+
+	if outputOpts.Discover {
+		hosts, err := top.DiscoverHosts()
+		if err != nil {
+			log.Logvf(log.Always, "Failed: %v", err)
+			os.Exit(failure.ExitCode(err))
+		}
+		for _, host := range hosts {
+			if err = top.AddMember(host); err != nil {
+				log.Logvf(log.Always, "Failed: %v", err)
+				os.Exit(failure.ExitCode(err))
+			}
+		}
+	}
+
+	// render sub-second samples in batches, rather than writing to the
+	// terminal many times a second
+	var batch *util.BatchWriter
+	if sleeptime < time.Second {
+		batch = util.NewBatchWriter(os.Stdout, time.Second)
+		top.Out = batch
 	}
 
 	// kick it off
-	if err := top.Run(); err != nil {
+	err = top.Run()
+	if batch != nil {
+		batch.Close()
+	}
+	if err != nil {
 		log.Logvf(log.Always, "Failed: %v", err)
+		os.Exit(failure.ExitCode(err))
+	}
+	if top.Watcher != nil && top.Watcher.ExitOnAlert && top.Watcher.Fired() {
 		os.Exit(util.ExitError)
 	}
 }
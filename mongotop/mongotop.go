@@ -8,10 +8,14 @@
 package mongotop
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"github.com/mongodb/mongo-tools/common/db"
 	"github.com/mongodb/mongo-tools/common/log"
 	"github.com/mongodb/mongo-tools/common/options"
+	"io"
+	"os"
 	"time"
 )
 
@@ -30,11 +34,55 @@ type MongoTop struct {
 	// Length of time to sleep between each polling.
 	Sleeptime time.Duration
 
+	// Where to write output; defaults to stdout.
+	Out io.Writer
+
+	// Which namespaces to report, and in what order.
+	View View
+
+	// If set, samples are served as Prometheus metrics instead of printed.
+	Exporter *PrometheusExporter
+
+	// If set, every interval is checked against the --watch rules.
+	Watcher *Watcher
+
 	previousServerStatus *ServerStatus
 	previousTop          *Top
+
+	// hosts sampled in place of SessionProvider, added by AddMember
+	members []*MongoTop
+	host    string
+}
+
+// connURL returns the host mongotop was asked to connect to.
+func (mt *MongoTop) connURL() string {
+	if mt.Options.URI != nil && mt.Options.URI.ConnectionString != "" {
+		if addrs := mt.Options.URI.GetConnectionAddrs(); len(addrs) > 0 {
+			return addrs[0]
+		}
+	}
+	connURL := mt.Options.Host
+	if connURL == "" {
+		connURL = "127.0.0.1"
+	}
+	if mt.Options.Port != "" {
+		connURL = connURL + ":" + mt.Options.Port
+	}
+	return connURL
+}
+
+// hostName returns the host a member samples, or the one connected to.
+func (mt *MongoTop) hostName() string {
+	if mt.host != "" {
+		return mt.host
+	}
+	return mt.connURL()
 }
 
 func (mt *MongoTop) runDiff() (outDiff FormattableDiff, err error) {
+	if len(mt.members) > 0 {
+		return mt.runClusterDiff()
+	}
 	session, err := mt.SessionProvider.GetSession()
 	if err != nil {
 		return nil, err
@@ -51,11 +99,23 @@ func (mt *MongoTop) runDiff() (outDiff FormattableDiff, err error) {
 		dest = &currentServerStatus
 	}
 	err = session.DB("admin").Run(commandName, dest)
+	if mt.Exporter != nil {
+		if mt.OutputOptions.Locks {
+			mt.Exporter.update(mt.hostName(), nil, &currentServerStatus, err)
+		} else {
+			mt.Exporter.update(mt.hostName(), &currentTop, nil, err)
+		}
+	}
 	if err != nil {
 		mt.previousServerStatus = nil
 		mt.previousTop = nil
 		return nil, err
 	}
+	sampleTime := time.Now()
+	timeFormat := DefaultTimeFormat
+	if mt.Sleeptime < time.Second {
+		timeFormat = MilliTimeFormat
+	}
 	if mt.OutputOptions.Locks {
 		if currentServerStatus.Locks == nil {
 			return nil, fmt.Errorf("server does not support reporting lock information")
@@ -67,12 +127,17 @@ func (mt *MongoTop) runDiff() (outDiff FormattableDiff, err error) {
 		}
 		if mt.previousServerStatus != nil {
 			serverStatusDiff := currentServerStatus.Diff(*mt.previousServerStatus)
+			serverStatusDiff.Time, serverStatusDiff.TimeFormat = sampleTime, timeFormat
+			serverStatusDiff.Apply(mt.View)
 			outDiff = serverStatusDiff
 		}
 		mt.previousServerStatus = &currentServerStatus
 	} else {
 		if mt.previousTop != nil {
 			topDiff := currentTop.Diff(*mt.previousTop)
+			topDiff.Time, topDiff.TimeFormat = sampleTime, timeFormat
+			topDiff.Breakdown = mt.OutputOptions.Breakdown
+			topDiff.Apply(mt.View)
 			outDiff = topDiff
 		}
 		mt.previousTop = &currentTop
@@ -82,13 +147,31 @@ func (mt *MongoTop) runDiff() (outDiff FormattableDiff, err error) {
 
 // Run executes the mongotop program.
 func (mt *MongoTop) Run() error {
+	connURL := mt.connURL()
 
-	connURL := mt.Options.Host
-	if connURL == "" {
-		connURL = "127.0.0.1"
+	out := mt.Out
+	if out == nil {
+		out = os.Stdout
 	}
-	if mt.Options.Port != "" {
-		connURL = connURL + ":" + mt.Options.Port
+
+	format := mt.OutputOptions.RecordFormat()
+	var csvOut *csv.Writer
+	if format == "csv" {
+		csvOut = csv.NewWriter(out)
+		header := RecordHeader
+		if mt.OutputOptions.Breakdown {
+			header = append(append([]string{}, header...), BreakdownHeader()...)
+		}
+		csvOut.Write(header)
+		csvOut.Flush()
+	}
+
+	var serveErr chan error
+	if mt.Exporter != nil {
+		serveErr = make(chan error, 1)
+		go func() {
+			serveErr <- mt.Exporter.Serve()
+		}()
 	}
 
 	hasData := false
@@ -99,6 +182,11 @@ func (mt *MongoTop) Run() error {
 			return nil
 		}
 		numPrinted++
+		select {
+		case err := <-serveErr:
+			return fmt.Errorf("error serving metrics: %v", err)
+		default:
+		}
 		diff, err := mt.runDiff()
 		if err != nil {
 			// If this is the first time trying to poll the server and it fails,
@@ -113,17 +201,38 @@ func (mt *MongoTop) Run() error {
 
 		// if this is the first time and the connection is successful, print
 		// the connection message
-		if !hasData && !mt.OutputOptions.Json {
+		if !hasData && !mt.OutputOptions.Json && format == "" {
 			log.Logvf(log.Always, "connected to: %v\n", connURL)
 		}
 
 		hasData = true
 
 		if diff != nil {
-			if mt.OutputOptions.Json {
-				fmt.Println(diff.JSON())
-			} else {
-				fmt.Println(diff.Grid())
+			switch {
+			case mt.Exporter != nil:
+				// the exporter was updated with the raw counters
+			case format == "csv":
+				for _, record := range diff.Records() {
+					csvOut.Write(record.CSV())
+				}
+				csvOut.Flush()
+				if err := csvOut.Error(); err != nil {
+					return fmt.Errorf("error writing csv: %v", err)
+				}
+			case format == "json":
+				encoder := json.NewEncoder(out)
+				for _, record := range diff.Records() {
+					if err := encoder.Encode(record); err != nil {
+						return fmt.Errorf("error writing json: %v", err)
+					}
+				}
+			case mt.OutputOptions.Json:
+				fmt.Fprintln(out, diff.JSON())
+			default:
+				fmt.Fprintln(out, diff.Grid())
+			}
+			if mt.Watcher != nil && mt.Watcher.Check(diff.Records()) {
+				return nil
 			}
 		}
 		time.Sleep(mt.Sleeptime)
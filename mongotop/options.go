@@ -10,16 +10,39 @@ var Usage = `<options> <polling interval in seconds>
 
 Monitor basic usage statistics for each collection.
 
+The polling interval may be fractional, e.g. 0.25, or have a unit, e.g. 250ms.
+
 See http://docs.mongodb.org/manual/reference/program/mongotop/ for more information.`
 
 // Output defines the set of options to use in displaying data from the server.
 type Output struct {
-	Locks    bool `long:"locks" description:"report on use of per-database locks"`
-	RowCount int  `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
-	Json     bool `long:"json" description:"format output as JSON"`
+	Locks        bool   `long:"locks" description:"report on use of per-database locks"`
+	RowCount     int    `long:"rowcount" value-name:"<count>" short:"n" description:"number of stats lines to print (0 for indefinite)"`
+	Json         bool   `long:"json" description:"format output as JSON"`
+	Format       string `long:"format" value-name:"<format>" choice:"json" choice:"csv" description:"write one record per namespace per interval, with times in microseconds, as 'json' lines or 'csv'"`
+	CSV          bool   `long:"csv" description:"same as --format csv"`
+	Prometheus   string `long:"prometheus" value-name:"<address>" description:"serve the cumulative time and count of each namespace as Prometheus metrics on the given address, e.g. ':9217', instead of printing them"`
+	Watch        string `long:"watch" value-name:"<rule>[,<rule>]*" description:"alert on stderr when a namespace's time per interval crosses a threshold, e.g. 'orders.*:write>500ms'"`
+	WatchWebhook string `long:"watchWebhook" value-name:"<url>" description:"POST each --watch alert as JSON to this URL"`
+	WatchExit    bool   `long:"watchExit" description:"exit with a non-zero status after the first --watch alert"`
+	NSFilter     string `long:"nsFilter" value-name:"<regex>" description:"only report namespaces matching the regular expression"`
+	Top          int    `long:"top" value-name:"<count>" description:"only report the <count> busiest namespaces (default 10 for the table, all otherwise)"`
+	Discover     bool   `long:"discover" description:"sample every member of the replica set, or of every shard when connected to a mongos"`
+	Aggregate    bool   `long:"aggregate" description:"with --discover, sum the usage of each namespace across hosts instead of reporting each host"`
+	Breakdown    bool   `long:"breakdown" description:"add the time and count of queries, getmore, insert, update, remove and commands for each namespace"`
+	SortBy       string `long:"sortBy" value-name:"<field>" choice:"total" choice:"read" choice:"write" choice:"queries" choice:"getmore" choice:"insert" choice:"update" choice:"remove" choice:"commands" default:"total" description:"rank namespaces by 'total', 'read' or 'write' time, or by the time of one kind of operation, e.g. 'queries'"`
 }
 
 // Name returns a human-readable group name for output options.
 func (_ *Output) Name() string {
 	return "output"
 }
+
+// RecordFormat returns the per-namespace record format selected by --format
+// or --csv, or "" when the table or legacy --json output is in use.
+func (o *Output) RecordFormat() string {
+	if o.CSV {
+		return "csv"
+	}
+	return o.Format
+}
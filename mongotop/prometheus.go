@@ -0,0 +1,190 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/mongodb/mongo-tools/common/log"
+	"github.com/mongodb/mongo-tools/common/text"
+)
+
+// PrometheusExporter serves the latest top or lock counters of every sampled
+// host as Prometheus metrics. The counters are the server's own cumulative
+// totals, so rates over any window can be computed by Prometheus.
+type PrometheusExporter struct {
+	// Address to serve metrics on, e.g. ":9217".
+	Address string
+
+	// Filter, if set, keeps only namespaces that it matches.
+	Filter *regexp.Regexp
+
+	// Map of hostname -> latest output of the top command
+	LastTops map[string]*Top
+
+	// Map of hostname -> latest output of serverStatus, with --locks
+	LastServerStatuses map[string]*ServerStatus
+
+	// Map of hostname -> error from the latest sample of the host
+	LastErrors map[string]error
+
+	// Mutex to protect access to the maps
+	mapLock sync.RWMutex
+}
+
+// NewPrometheusExporter returns a PrometheusExporter that serves metrics on
+// the given address.
+func NewPrometheusExporter(address string) *PrometheusExporter {
+	return &PrometheusExporter{
+		Address:            address,
+		LastTops:           map[string]*Top{},
+		LastServerStatuses: map[string]*ServerStatus{},
+		LastErrors:         map[string]error{},
+	}
+}
+
+// update records the latest sample or error for a host.
+func (exporter *PrometheusExporter) update(host string, top *Top, serverStatus *ServerStatus, err error) {
+	exporter.mapLock.Lock()
+	defer exporter.mapLock.Unlock()
+	if err != nil {
+		exporter.LastErrors[host] = err
+		return
+	}
+	delete(exporter.LastErrors, host)
+	if top != nil {
+		exporter.LastTops[host] = top
+	}
+	if serverStatus != nil {
+		exporter.LastServerStatuses[host] = serverStatus
+	}
+}
+
+// Serve serves metrics on the exporter's address until the server fails.
+func (exporter *PrometheusExporter) Serve() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := exporter.WriteMetrics(w); err != nil {
+			log.Logvf(log.DebugLow, "error writing metrics: %v", err)
+		}
+	})
+	log.Logvf(log.Always, "serving Prometheus metrics on %v/metrics", exporter.Address)
+	return http.ListenAndServe(exporter.Address, mux)
+}
+
+// WriteMetrics writes the latest counters of every host in the Prometheus
+// text exposition format.
+func (exporter *PrometheusExporter) WriteMetrics(w io.Writer) error {
+	exporter.mapLock.RLock()
+	defer exporter.mapLock.RUnlock()
+
+	seen := map[string]bool{}
+	for host := range exporter.LastTops {
+		seen[host] = true
+	}
+	for host := range exporter.LastServerStatuses {
+		seen[host] = true
+	}
+	for host := range exporter.LastErrors {
+		seen[host] = true
+	}
+	hosts := make([]string, 0, len(seen))
+	for host := range seen {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "# HELP mongodb_up Whether the last sample of the server succeeded\n# TYPE mongodb_up gauge\n")
+	for _, host := range hosts {
+		up := 0
+		if _, failed := exporter.LastErrors[host]; !failed {
+			up = 1
+		}
+		fmt.Fprintf(out, "mongodb_up{host=\"%v\"} %v\n", text.EscapePrometheusLabel(host), up)
+	}
+
+	if len(exporter.LastTops) > 0 {
+		fmt.Fprintf(out, "# HELP mongodb_top_time_microseconds_total Time spent on each namespace, by operation\n"+
+			"# TYPE mongodb_top_time_microseconds_total counter\n")
+		exporter.writeTopSamples(out, hosts, "mongodb_top_time_microseconds_total",
+			func(field TopField) int { return field.Time })
+		fmt.Fprintf(out, "# HELP mongodb_top_count_total Operations on each namespace, by operation\n"+
+			"# TYPE mongodb_top_count_total counter\n")
+		exporter.writeTopSamples(out, hosts, "mongodb_top_count_total",
+			func(field TopField) int { return field.Count })
+	}
+
+	if len(exporter.LastServerStatuses) > 0 {
+		fmt.Fprintf(out, "# HELP mongodb_lock_time_microseconds_total Time each database lock was held, by mode\n"+
+			"# TYPE mongodb_lock_time_microseconds_total counter\n")
+		for _, host := range hosts {
+			serverStatus, ok := exporter.LastServerStatuses[host]
+			if !ok {
+				continue
+			}
+			var dbs []string
+			for db := range serverStatus.Locks {
+				dbs = append(dbs, db)
+			}
+			for _, db := range exporter.filtered(dbs) {
+				timeLocked := serverStatus.Locks[db].TimeLockedMicros
+				labels := fmt.Sprintf(`host="%v",db="%v"`, text.EscapePrometheusLabel(host), text.EscapePrometheusLabel(db))
+				fmt.Fprintf(out, "mongodb_lock_time_microseconds_total{%v,mode=\"read\"} %v\n",
+					labels, timeLocked.Read+timeLocked.ReadLower)
+				fmt.Fprintf(out, "mongodb_lock_time_microseconds_total{%v,mode=\"write\"} %v\n",
+					labels, timeLocked.Write+timeLocked.WriteLower)
+			}
+		}
+	}
+	return out.Flush()
+}
+
+// writeTopSamples writes one sample of the named metric for every operation
+// of every namespace of every host.
+func (exporter *PrometheusExporter) writeTopSamples(out io.Writer, hosts []string, name string, value func(TopField) int) {
+	for _, host := range hosts {
+		top, ok := exporter.LastTops[host]
+		if !ok {
+			continue
+		}
+		var namespaces []string
+		for ns := range top.Totals {
+			namespaces = append(namespaces, ns)
+		}
+		for _, ns := range exporter.filtered(namespaces) {
+			info := top.Totals[ns]
+			labels := fmt.Sprintf(`host="%v",ns="%v"`, text.EscapePrometheusLabel(host), text.EscapePrometheusLabel(ns))
+			fmt.Fprintf(out, "%v{%v,op=\"total\"} %v\n", name, labels, value(info.Total))
+			fmt.Fprintf(out, "%v{%v,op=\"read\"} %v\n", name, labels, value(info.Read))
+			fmt.Fprintf(out, "%v{%v,op=\"write\"} %v\n", name, labels, value(info.Write))
+			for _, category := range OperationCategories {
+				field, _ := info.Operation(category)
+				fmt.Fprintf(out, "%v{%v,op=\"%v\"} %v\n", name, labels, category, value(field))
+			}
+		}
+	}
+}
+
+// filtered returns the namespaces that match the exporter's filter, sorted.
+func (exporter *PrometheusExporter) filtered(namespaces []string) []string {
+	var names []string
+	for _, ns := range namespaces {
+		if exporter.Filter == nil || exporter.Filter.MatchString(ns) {
+			names = append(names, ns)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,91 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a Prometheus exporter", t, func() {
+		exporter := NewPrometheusExporter(":0")
+		metrics := func() string {
+			out := &bytes.Buffer{}
+			So(exporter.WriteMetrics(out), ShouldBeNil)
+			return out.String()
+		}
+
+		Convey("nothing but the help of mongodb_up should be written before any sample", func() {
+			So(metrics(), ShouldEqual, "# HELP mongodb_up Whether the last sample of the server succeeded\n"+
+				"# TYPE mongodb_up gauge\n")
+		})
+
+		Convey("the top totals of each namespace should be written", func() {
+			exporter.update("b:27017", &Top{Totals: map[string]NSTopInfo{
+				"app.users": {
+					Total:   TopField{Time: 30, Count: 3},
+					Read:    TopField{Time: 10, Count: 1},
+					Write:   TopField{Time: 20, Count: 2},
+					Queries: TopField{Time: 7, Count: 1},
+				},
+			}}, nil, nil)
+			exporter.update("a:27017", nil, nil, fmt.Errorf("connection refused"))
+			out := metrics()
+			So(out, ShouldContainSubstring, "mongodb_up{host=\"a:27017\"} 0\nmongodb_up{host=\"b:27017\"} 1\n")
+			So(out, ShouldContainSubstring, "# TYPE mongodb_top_time_microseconds_total counter\n")
+			So(out, ShouldContainSubstring, `mongodb_top_time_microseconds_total{host="b:27017",ns="app.users",op="total"} 30`+"\n")
+			So(out, ShouldContainSubstring, `mongodb_top_time_microseconds_total{host="b:27017",ns="app.users",op="write"} 20`+"\n")
+			So(out, ShouldContainSubstring, `mongodb_top_time_microseconds_total{host="b:27017",ns="app.users",op="queries"} 7`+"\n")
+			So(out, ShouldContainSubstring, `mongodb_top_count_total{host="b:27017",ns="app.users",op="read"} 1`+"\n")
+			So(out, ShouldContainSubstring, `mongodb_top_count_total{host="b:27017",ns="app.users",op="commands"} 0`+"\n")
+			So(out, ShouldNotContainSubstring, "mongodb_lock_time_microseconds_total")
+		})
+
+		Convey("a host should be up again after a successful sample", func() {
+			exporter.update("a:27017", nil, nil, fmt.Errorf("connection refused"))
+			exporter.update("a:27017", &Top{Totals: map[string]NSTopInfo{}}, nil, nil)
+			So(metrics(), ShouldContainSubstring, "mongodb_up{host=\"a:27017\"} 1\n")
+		})
+
+		Convey("lock times should be written per database and mode", func() {
+			exporter.update("a:27017", nil, &ServerStatus{Locks: map[string]LockStats{
+				"app": {TimeLockedMicros: ReadWriteLockTimes{Read: 1, ReadLower: 2, Write: 3, WriteLower: 4}},
+			}}, nil)
+			out := metrics()
+			So(out, ShouldContainSubstring, `mongodb_lock_time_microseconds_total{host="a:27017",db="app",mode="read"} 3`+"\n")
+			So(out, ShouldContainSubstring, `mongodb_lock_time_microseconds_total{host="a:27017",db="app",mode="write"} 7`+"\n")
+			So(out, ShouldNotContainSubstring, "mongodb_top_")
+		})
+
+		Convey("the filter should drop namespaces it doesn't match", func() {
+			exporter.Filter = regexp.MustCompile(`^app\.`)
+			exporter.update("a:27017", &Top{Totals: map[string]NSTopInfo{
+				"app.users":   {},
+				"admin.users": {},
+			}}, nil, nil)
+			out := metrics()
+			So(out, ShouldContainSubstring, `ns="app.users"`)
+			So(out, ShouldNotContainSubstring, `ns="admin.users"`)
+		})
+
+		Convey("label values should be escaped", func() {
+			exporter.update("a:27017", &Top{Totals: map[string]NSTopInfo{
+				`app.we"ird`: {},
+			}}, nil, nil)
+			So(strings.Contains(metrics(), `ns="app.we\"ird"`), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,233 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WatchRule is a threshold on the time a namespace spends on one kind of
+// operation per interval, such as "orders.*:write>500ms".
+type WatchRule struct {
+	// Namespace is a pattern in which '*' matches any characters.
+	Namespace string
+	// Field is "total", "read", "write" or one of OperationCategories.
+	Field string
+	// Op is one of ">", ">=", "<" or "<=".
+	Op        string
+	Threshold time.Duration
+	// Text is the rule as the user wrote it.
+	Text string
+
+	pattern *regexp.Regexp
+}
+
+var watchRuleRE = regexp.MustCompile(`^\s*([^:]+?)\s*:\s*(\w+)\s*(>=|<=|>|<)\s*(\S+)\s*$`)
+
+// ParseWatchRules parses a comma-separated list of rules, e.g.
+// "orders.*:write>500ms,app.users:total>1s". A threshold without a unit is
+// in milliseconds, like the table.
+func ParseWatchRules(spec string) ([]WatchRule, error) {
+	var rules []WatchRule
+	for _, text := range strings.Split(spec, ",") {
+		match := watchRuleRE.FindStringSubmatch(text)
+		if match == nil {
+			return nil, fmt.Errorf("invalid watch rule '%v', expected e.g. 'orders.*:write>500ms'", text)
+		}
+		field := match[2]
+		if _, ok := (NSTopInfo{}).Operation(field); !ok && field != "total" && field != "read" && field != "write" {
+			return nil, fmt.Errorf("invalid field '%v' in watch rule '%v'", field, text)
+		}
+		threshold, err := parseWatchThreshold(match[4])
+		if err != nil {
+			return nil, fmt.Errorf("invalid threshold '%v' in watch rule '%v'", match[4], text)
+		}
+		rules = append(rules, WatchRule{
+			Namespace: match[1],
+			Field:     field,
+			Op:        match[3],
+			Threshold: threshold,
+			Text:      strings.TrimSpace(text),
+			pattern:   globToRegexp(match[1]),
+		})
+	}
+	return rules, nil
+}
+
+func parseWatchThreshold(value string) (time.Duration, error) {
+	if millis, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(millis * float64(time.Millisecond)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// globToRegexp returns a regular expression matching the whole of a
+// namespace, in which '*' matches any characters.
+func globToRegexp(glob string) *regexp.Regexp {
+	parts := strings.Split(glob, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
+
+// Matches returns true if the rule applies to a namespace. With --discover,
+// namespaces are reported as "host/namespace", and the host is ignored.
+func (rule WatchRule) Matches(ns string) bool {
+	if rule.pattern.MatchString(ns) {
+		return true
+	}
+	if i := strings.Index(ns, "/"); i >= 0 {
+		return rule.pattern.MatchString(ns[i+1:])
+	}
+	return false
+}
+
+// UsesBreakdown returns true if the rule needs the per-operation times of
+// --breakdown.
+func (rule WatchRule) UsesBreakdown() bool {
+	_, ok := (NSTopInfo{}).Operation(rule.Field)
+	return ok
+}
+
+// Breached returns the time the record spent on the rule's field, and true
+// if it breaches the rule.
+func (rule WatchRule) Breached(record Record) (time.Duration, bool) {
+	var micros int64
+	switch rule.Field {
+	case "total":
+		micros = record.TotalMicros
+	case "read":
+		micros = record.ReadMicros
+	case "write":
+		micros = record.WriteMicros
+	default:
+		usage, ok := record.Operations[rule.Field]
+		if !ok {
+			return 0, false
+		}
+		micros = usage.Micros
+	}
+	value := time.Duration(micros) * time.Microsecond
+	switch rule.Op {
+	case ">":
+		return value, value > rule.Threshold
+	case ">=":
+		return value, value >= rule.Threshold
+	case "<":
+		return value, value < rule.Threshold
+	case "<=":
+		return value, value <= rule.Threshold
+	}
+	return value, false
+}
+
+// Watcher checks the records of every interval against a set of rules and
+// raises an alert when a namespace starts breaching a rule.
+type Watcher struct {
+	Rules []WatchRule
+
+	// Webhook, if set, is a URL that each alert is POSTed to as JSON.
+	Webhook string
+
+	// ExitOnAlert makes mongotop stop after the first alert.
+	ExitOnAlert bool
+
+	// Out is where alert lines are written.
+	Out io.Writer
+
+	Client *http.Client
+
+	// breached holds the namespaces and rules breached in the last interval.
+	breached map[string]bool
+	fired    bool
+}
+
+// WatchAlert describes a rule breached by a namespace, as sent to the webhook.
+type WatchAlert struct {
+	Namespace string    `json:"ns"`
+	Rule      string    `json:"rule"`
+	Micros    int64     `json:"micros"`
+	Time      time.Time `json:"time"`
+}
+
+// NewWatcher returns a Watcher for the given rules.
+func NewWatcher(rules []WatchRule, out io.Writer) *Watcher {
+	return &Watcher{
+		Rules:    rules,
+		Out:      out,
+		Client:   &http.Client{Timeout: 5 * time.Second},
+		breached: map[string]bool{},
+	}
+}
+
+// Check evaluates the rules against the records of one interval, raising
+// any alerts. It returns true if mongotop should stop because an alert was
+// raised.
+func (w *Watcher) Check(records []Record) bool {
+	breached := map[string]bool{}
+	for _, record := range records {
+		for _, rule := range w.Rules {
+			if !rule.Matches(record.Namespace) {
+				continue
+			}
+			value, ok := rule.Breached(record)
+			if !ok {
+				continue
+			}
+			key := record.Namespace + "\x00" + rule.Text
+			breached[key] = true
+			// alert once per run of breaching intervals
+			if !w.breached[key] {
+				w.raise(WatchAlert{
+					Namespace: record.Namespace,
+					Rule:      rule.Text,
+					Micros:    int64(value / time.Microsecond),
+					Time:      record.Time,
+				})
+			}
+		}
+	}
+	w.breached = breached
+	return w.fired && w.ExitOnAlert
+}
+
+// Fired returns true if any alert has been raised.
+func (w *Watcher) Fired() bool {
+	return w.fired
+}
+
+func (w *Watcher) raise(alert WatchAlert) {
+	w.fired = true
+	fmt.Fprintf(w.Out, "ALERT %v %v: %v is %v\n", alert.Time.Format(time.RFC3339),
+		alert.Namespace, alert.Rule, time.Duration(alert.Micros)*time.Microsecond)
+	if w.Webhook == "" {
+		return
+	}
+	body, err := json.Marshal(alert)
+	if err == nil {
+		var resp *http.Response
+		resp, err = w.Client.Post(w.Webhook, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("webhook responded with %v", resp.Status)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(w.Out, "error sending alert to webhook: %v\n", err)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright (C) MongoDB, Inc. 2014-present.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at http://www.apache.org/licenses/LICENSE-2.0
+
+package mongotop
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-tools/common/testtype"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseWatchRules(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("When parsing watch rules", t, func() {
+		Convey("a list of rules should be parsed in order", func() {
+			rules, err := ParseWatchRules("orders.*:write>500ms, app.users : total >= 1s")
+			So(err, ShouldBeNil)
+			So(len(rules), ShouldEqual, 2)
+			So(rules[0].Namespace, ShouldEqual, "orders.*")
+			So(rules[0].Field, ShouldEqual, "write")
+			So(rules[0].Op, ShouldEqual, ">")
+			So(rules[0].Threshold, ShouldEqual, 500*time.Millisecond)
+			So(rules[0].Text, ShouldEqual, "orders.*:write>500ms")
+			So(rules[1].Namespace, ShouldEqual, "app.users")
+			So(rules[1].Field, ShouldEqual, "total")
+			So(rules[1].Op, ShouldEqual, ">=")
+			So(rules[1].Threshold, ShouldEqual, time.Second)
+		})
+
+		Convey("a threshold without a unit should be in milliseconds", func() {
+			rules, err := ParseWatchRules("a.b:read<2.5")
+			So(err, ShouldBeNil)
+			So(rules[0].Threshold, ShouldEqual, 2500*time.Microsecond)
+		})
+
+		Convey("operation categories should be accepted as fields", func() {
+			rules, err := ParseWatchRules("a.b:getmore<=10ms")
+			So(err, ShouldBeNil)
+			So(rules[0].UsesBreakdown(), ShouldBeTrue)
+		})
+
+		Convey("malformed rules should be rejected", func() {
+			for _, spec := range []string{"", "a.b", "a.b:write", "a.b:write=5", "a.b:bogus>5", "a.b:write>soon", "a.b:write>5,"} {
+				_, err := ParseWatchRules(spec)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+
+	Convey("Namespace patterns should match whole namespaces", t, func() {
+		rules, err := ParseWatchRules("orders.*:total>1,app.users:total>1")
+		So(err, ShouldBeNil)
+		So(rules[0].Matches("orders.eu"), ShouldBeTrue)
+		So(rules[0].Matches("orders."), ShouldBeTrue)
+		So(rules[0].Matches("ordersXeu"), ShouldBeFalse)
+		So(rules[0].Matches("myorders.eu"), ShouldBeFalse)
+		So(rules[1].Matches("app.users"), ShouldBeTrue)
+		So(rules[1].Matches("app.users2"), ShouldBeFalse)
+		So(rules[1].Matches("host:27017/app.users"), ShouldBeTrue)
+	})
+}
+
+func TestWatchRuleBreached(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a record of one interval", t, func() {
+		record := Record{
+			Namespace:   "app.users",
+			TotalMicros: 1500,
+			ReadMicros:  1000,
+			WriteMicros: 500,
+			Operations: map[string]OperationUsage{
+				"queries": {Micros: 800, Count: 4},
+			},
+		}
+		breached := func(spec string) (time.Duration, bool) {
+			rules, err := ParseWatchRules(spec)
+			So(err, ShouldBeNil)
+			return rules[0].Breached(record)
+		}
+
+		Convey("the value of the rule's field should be compared to the threshold", func() {
+			value, ok := breached("app.users:total>1ms")
+			So(ok, ShouldBeTrue)
+			So(value, ShouldEqual, 1500*time.Microsecond)
+			_, ok = breached("app.users:total>1500us")
+			So(ok, ShouldBeFalse)
+			_, ok = breached("app.users:total>=1500us")
+			So(ok, ShouldBeTrue)
+			_, ok = breached("app.users:read<1ms")
+			So(ok, ShouldBeFalse)
+			_, ok = breached("app.users:read<=1ms")
+			So(ok, ShouldBeTrue)
+			value, ok = breached("app.users:write<1ms")
+			So(ok, ShouldBeTrue)
+			So(value, ShouldEqual, 500*time.Microsecond)
+		})
+
+		Convey("operation categories should use the breakdown of the record", func() {
+			value, ok := breached("app.users:queries>0.5")
+			So(ok, ShouldBeTrue)
+			So(value, ShouldEqual, 800*time.Microsecond)
+		})
+
+		Convey("a record without the breakdown should never breach a category", func() {
+			record.Operations = nil
+			_, ok := breached("app.users:queries<1s")
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestWatcherCheck(t *testing.T) {
+	testtype.SkipUnlessTestType(t, testtype.UnitTestType)
+
+	Convey("With a watcher on write time", t, func() {
+		rules, err := ParseWatchRules("orders.*:write>1ms")
+		So(err, ShouldBeNil)
+		out := &bytes.Buffer{}
+		watcher := NewWatcher(rules, out)
+		at := time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)
+		interval := func(writeMicros int64) []Record {
+			return []Record{
+				{Time: at, Namespace: "orders.eu", WriteMicros: writeMicros},
+				{Time: at, Namespace: "app.users", WriteMicros: 5000},
+			}
+		}
+
+		Convey("no alert should be raised while the rule holds", func() {
+			So(watcher.Check(interval(1000)), ShouldBeFalse)
+			So(watcher.Fired(), ShouldBeFalse)
+			So(out.String(), ShouldEqual, "")
+		})
+
+		Convey("a breach should raise one alert per run of breaching intervals", func() {
+			So(watcher.Check(interval(2000)), ShouldBeFalse)
+			So(watcher.Fired(), ShouldBeTrue)
+			So(out.String(), ShouldEqual, "ALERT 2018-01-02T03:04:05Z orders.eu: orders.*:write>1ms is 2ms\n")
+
+			watcher.Check(interval(3000))
+			So(strings.Count(out.String(), "ALERT"), ShouldEqual, 1)
+
+			watcher.Check(interval(0))
+			watcher.Check(interval(4000))
+			So(strings.Count(out.String(), "ALERT"), ShouldEqual, 2)
+		})
+
+		Convey("an alert should stop mongotop with ExitOnAlert", func() {
+			watcher.ExitOnAlert = true
+			So(watcher.Check(interval(1000)), ShouldBeFalse)
+			So(watcher.Check(interval(2000)), ShouldBeTrue)
+		})
+	})
+}
@@ -3,6 +3,10 @@
 # To add new directories, after running this tool, manually delete the
 # .git directory in the vended directory before running "git add".  Then
 # you can run this tool again to reclone it.
+#
+# A dependency with a patch at patches/<dir>.patch has it applied after it
+# is cloned. Once the changes are in the dependency's repository, bump its
+# revision and remove the patch.
 
 set -eu
 set -x
@@ -34,6 +38,12 @@ set_dependencies() {
     git clone $giturl "$install_path"
 
     ( cd $install_path && git checkout  "$version" && rm -rf '.git' )
+
+    # changes the tools need that aren't in the pinned revision yet
+    local patch="$SCRIPT_DIR/patches/$dest.patch"
+    if [ -f "$patch" ]; then
+      ( cd $install_path && patch -p1 < "$patch" )
+    fi
   done < $1
 
   echo ">> All Done"